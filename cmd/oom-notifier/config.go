@@ -0,0 +1,579 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/config"
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/monitor"
+	"github.com/oom-notifier/go/internal/notifier"
+	flag "github.com/spf13/pflag"
+)
+
+// validateConfig checks the parsed flags and returns every problem found. It
+// has no side effects beyond reading referenced files, so it is safe to run
+// with --check-config on a host without /dev/kmsg.
+func validateConfig() []string {
+	var problems []string
+
+	problems = append(problems, validateNotifiers()...)
+	for _, webhook := range slackWebhooks {
+		if !validHTTPURL(webhook, "http", "https") {
+			problems = append(problems, fmt.Sprintf("--slack-webhook %q is not a valid http(s) or unix socket URL", webhook))
+		}
+	}
+	if slackToken != "" && len(slackWebhooks) > 0 {
+		problems = append(problems, "--slack-token and --slack-webhook cannot be combined")
+	}
+	if slackThread < 0 {
+		problems = append(problems, "--slack-thread must not be negative")
+	}
+	if slackThread > 0 && slackToken == "" {
+		problems = append(problems, "--slack-thread requires --slack-token, webhooks cannot post replies")
+	}
+	if discordWebhook != "" {
+		if u, err := url.Parse(discordWebhook); err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("--discord-webhook %q is not a valid https URL", discordWebhook))
+		}
+	}
+	if teamsWebhook != "" {
+		if !validHTTPURL(teamsWebhook, "https") {
+			problems = append(problems, fmt.Sprintf("--teams-webhook %q is not a valid https or unix socket URL", teamsWebhook))
+		}
+	}
+	if mattermostWebhook != "" {
+		if !validHTTPURL(mattermostWebhook, "http", "https") {
+			problems = append(problems, fmt.Sprintf("--mattermost-webhook %q is not a valid http(s) or unix socket URL", mattermostWebhook))
+		}
+	}
+	if mattermostChannel != "" && mattermostWebhook == "" {
+		problems = append(problems, "--mattermost-channel requires --mattermost-webhook")
+	}
+	if (telegramToken == "") != (telegramChatID == "") {
+		problems = append(problems, "--telegram-bot-token and --telegram-chat-id must be set together")
+	}
+	if (pushoverToken == "") != (pushoverUser == "") {
+		problems = append(problems, "--pushover-token and --pushover-user must be set together")
+	}
+	if webhookURL != "" {
+		if !validHTTPURL(webhookURL, "http", "https") {
+			problems = append(problems, fmt.Sprintf("--webhook-url %q is not a valid http(s) or unix socket URL", webhookURL))
+		}
+	}
+	if webhookSecret != "" && webhookURL == "" {
+		problems = append(problems, "--webhook-secret requires --webhook-url")
+	}
+	if webhookGzip && webhookURL == "" {
+		problems = append(problems, "--webhook-gzip requires --webhook-url")
+	}
+	if webhookBatch && webhookURL == "" {
+		problems = append(problems, "--webhook-batch requires --webhook-url")
+	}
+	if _, err := notifier.ParseSchema(outputSchema); err != nil {
+		problems = append(problems, fmt.Sprintf("--output-schema: %v", err))
+	} else if outputSchema != notifier.SchemaNative && webhookURL == "" && !printEvents && auditFile == "" {
+		problems = append(problems, "--output-schema requires --webhook-url, --print-events or --audit-file")
+	}
+	if _, err := notifier.ParseNaming(jsonNaming); err != nil {
+		problems = append(problems, fmt.Sprintf("--json-naming: %v", err))
+	}
+	if _, err := notifier.ParseEmptyFields(jsonEmptyFields); err != nil {
+		problems = append(problems, fmt.Sprintf("--json-empty-fields: %v", err))
+	}
+	if jsonNaming != notifier.NamingSnake || jsonEmptyFields != notifier.EmptyDefault {
+		if outputSchema == notifier.SchemaECS {
+			problems = append(problems, "--json-naming and --json-empty-fields apply to the native schema only, ECS field names are fixed")
+		} else if webhookURL == "" && !printEvents && auditFile == "" {
+			problems = append(problems, "--json-naming and --json-empty-fields require --webhook-url, --print-events or --audit-file")
+		}
+	}
+	if smtpHost != "" {
+		if smtpPort <= 0 || smtpPort > 65535 {
+			problems = append(problems, fmt.Sprintf("--smtp-port %d is not a valid port", smtpPort))
+		}
+		if emailFrom == "" {
+			problems = append(problems, "--email-from is required with --smtp-host")
+		}
+		if len(emailTo) == 0 {
+			problems = append(problems, "--email-to is required with --smtp-host")
+		}
+	}
+	if snsTopicARN != "" {
+		// arn:partition:sns:region:account:topic
+		if parts := strings.Split(snsTopicARN, ":"); len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" {
+			problems = append(problems, fmt.Sprintf("--sns-topic-arn %q is not a valid SNS topic ARN", snsTopicARN))
+		}
+	}
+	if snsRegion != "" && snsTopicARN == "" {
+		problems = append(problems, "--sns-region requires --sns-topic-arn")
+	}
+	if kafkaTopic != "" && len(kafkaBrokers) == 0 {
+		problems = append(problems, "--kafka-broker is required with --kafka-topic")
+	}
+	if len(kafkaBrokers) > 0 && kafkaTopic == "" {
+		problems = append(problems, "--kafka-broker requires --kafka-topic")
+	}
+	for _, broker := range kafkaBrokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			problems = append(problems, fmt.Sprintf("--kafka-broker %q is not a valid host:port address", broker))
+		}
+	}
+	if natsURL != "" {
+		for _, server := range strings.Split(natsURL, ",") {
+			if _, _, err := net.SplitHostPort(server); err == nil {
+				// Bare host:port, the nats:// scheme is implied
+				continue
+			}
+			if u, err := url.Parse(server); err != nil || (u.Scheme != "nats" && u.Scheme != "tls" && u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+				problems = append(problems, fmt.Sprintf("--nats-url %q is not a valid nats://, tls://, ws:// or wss:// URL", server))
+			}
+		}
+		if natsSubject == "" {
+			problems = append(problems, "--nats-subject must not be empty with --nats-url")
+		}
+	}
+	if gelfAddr != "" {
+		if _, _, err := net.SplitHostPort(gelfAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("--gelf-addr %q is not a valid host:port address", gelfAddr))
+		}
+	}
+	if syslogAddr != "" {
+		if _, _, err := net.SplitHostPort(syslogAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("--syslog-addr %q is not a valid host:port address", syslogAddr))
+		}
+		if _, err := notifier.NewSyslogNotifier(syslogNetwork, syslogAddr, syslogFacility); err != nil {
+			problems = append(problems, fmt.Sprintf("--syslog-addr: %v", err))
+		}
+	}
+	if (flag.CommandLine.Changed("syslog-network") || flag.CommandLine.Changed("syslog-facility")) && syslogAddr == "" {
+		problems = append(problems, "--syslog-network and --syslog-facility require --syslog-addr")
+	}
+	if lokiURL != "" {
+		if u, err := url.Parse(lokiURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("--loki-url %q is not a valid http(s) URL", lokiURL))
+		}
+	}
+	if _, err := notifier.ParseLokiLabels(lokiLabels); err != nil {
+		problems = append(problems, fmt.Sprintf("--loki-label: %v", err))
+	}
+	if len(lokiLabels) > 0 && lokiURL == "" {
+		problems = append(problems, "--loki-label requires --loki-url")
+	}
+	if lokiGzip && lokiURL == "" {
+		problems = append(problems, "--loki-gzip requires --loki-url")
+	}
+	if lokiBatch && lokiURL == "" {
+		problems = append(problems, "--loki-batch requires --loki-url")
+	}
+	if (webhookBatch || lokiBatch) && batchWindow == 0 && !quietDigest {
+		problems = append(problems, "--webhook-batch and --loki-batch require --batch-window or --quiet-hours-digest")
+	}
+	if slackMode != notifier.SlackModeAll && slackMode != notifier.SlackModeFailover {
+		problems = append(problems, fmt.Sprintf("--slack-mode must be %q or %q", notifier.SlackModeAll, notifier.SlackModeFailover))
+	}
+	if slackUsername == "" {
+		problems = append(problems, "--slack-username must not be empty")
+	}
+	if len(slackIconEmoji) < 3 || !strings.HasPrefix(slackIconEmoji, ":") || !strings.HasSuffix(slackIconEmoji, ":") {
+		problems = append(problems, fmt.Sprintf("--slack-icon-emoji %q must be an emoji code like :firecracker:", slackIconEmoji))
+	}
+	if messageTemplate != "" {
+		if _, err := notifier.ParseMessageTemplate(messageTemplate); err != nil {
+			problems = append(problems, fmt.Sprintf("--message-template: %v", err))
+		}
+	}
+	if _, err := notifier.ParseSeverityStyles(severityColors, severityEmojis); err != nil {
+		problems = append(problems, fmt.Sprintf("--severity-color/--severity-emoji: %v", err))
+	}
+	if severityMapFile != "" {
+		if _, err := notifier.LoadSeverityMap(severityMapFile); err != nil {
+			problems = append(problems, fmt.Sprintf("--severity-map: %v", err))
+		}
+	}
+	if _, err := notifier.ParseFields(shownFields); err != nil {
+		problems = append(problems, fmt.Sprintf("--fields: %v", err))
+	}
+	if linkTemplate != "" {
+		if _, err := notifier.ParseLinkTemplate(linkTemplate); err != nil {
+			problems = append(problems, fmt.Sprintf("--link-template: %v", err))
+		}
+	}
+	if slackFormat != notifier.SlackFormatAttachment && slackFormat != notifier.SlackFormatBlocks {
+		problems = append(problems, fmt.Sprintf("--slack-format must be %q or %q", notifier.SlackFormatAttachment, notifier.SlackFormatBlocks))
+	}
+	if _, err := notifier.NormalizeSlackChannel(slackChannel); err != nil {
+		problems = append(problems, fmt.Sprintf("--slack-channel: %v", err))
+	}
+	if _, err := notifier.ParseChannelRoutes(channelRoutes); err != nil {
+		problems = append(problems, fmt.Sprintf("--channel-route: %v", err))
+	}
+	if len(channelRoutes) > 0 && len(slackWebhooks) == 0 && slackToken == "" {
+		problems = append(problems, "--channel-route requires --slack-webhook or --slack-token")
+	}
+	if slackRetries < 1 {
+		problems = append(problems, "--slack-retry-attempts must be at least 1")
+	}
+	if httpTimeout <= 0 {
+		problems = append(problems, "--http-timeout must be positive")
+	}
+	if _, err := notifier.NewTLSConfig(tlsOptions()); err != nil {
+		problems = append(problems, fmt.Sprintf("--ca-file/--client-cert/--client-key: %v", err))
+	}
+	if slackBackoff < 0 {
+		problems = append(problems, "--slack-retry-backoff must not be negative")
+	}
+
+	if len(logSources()) == 0 {
+		problems = append(problems, "--log-source must name at least one source")
+	}
+	seenSources := make(map[string]bool)
+	for _, source := range logSources() {
+		if source != monitor.SourceKmsg && source != monitor.SourceJournal && source != monitor.SourceDmesg {
+			problems = append(problems, fmt.Sprintf("--log-source %q must be %q, %q or %q", source, monitor.SourceKmsg, monitor.SourceJournal, monitor.SourceDmesg))
+		} else if seenSources[source] {
+			problems = append(problems, fmt.Sprintf("--log-source lists %q twice", source))
+		}
+		seenSources[source] = true
+	}
+	if dmesgFile != "" && !seenSources[monitor.SourceDmesg] {
+		problems = append(problems, "--dmesg-file requires dmesg in --log-source")
+	}
+	if processRefresh <= 0 {
+		problems = append(problems, "--process-refresh must be positive")
+	}
+	if minRefreshInterval < 0 {
+		problems = append(problems, "--min-refresh-interval must not be negative")
+	}
+	if processScan < 0 {
+		problems = append(problems, "--process-scan must not be negative")
+	}
+	if kernelLogRefresh <= 0 {
+		problems = append(problems, "--kernel-log-refresh must be positive")
+	}
+	if summarizeContainers && summarizeWindow <= 0 {
+		problems = append(problems, "--summarize-window must be positive")
+	}
+	if summarizeContainers && summarizeThreshold < 1 {
+		problems = append(problems, "--summarize-threshold must be at least 1")
+	}
+	if summaryInterval < 0 {
+		problems = append(problems, "--summary-interval must not be negative")
+	}
+	if batchWindow < 0 {
+		problems = append(problems, "--batch-window must not be negative")
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		problems = append(problems, fmt.Sprintf("--timezone: unknown time zone %q", timezone))
+	}
+	if quietHours != "" {
+		if _, err := notifier.NewQuietHours(quietHours, quietSeverity); err != nil {
+			problems = append(problems, fmt.Sprintf("--quiet-hours: %v", err))
+		}
+	} else if quietDigest {
+		problems = append(problems, "--quiet-hours-digest requires --quiet-hours")
+	}
+	if batchWindow > 0 && summarizeContainers {
+		problems = append(problems, "--batch-window cannot be combined with --summarize-containers")
+	}
+	if (muteFile != "" || muteURL != "") && muteRefresh <= 0 {
+		problems = append(problems, "--mute-refresh must be positive")
+	}
+	if _, err := notifier.NewHostMutes(muteHosts); err != nil {
+		problems = append(problems, fmt.Sprintf("--mute-host: %v", err))
+	}
+	if muteURL != "" {
+		if u, err := url.Parse(muteURL); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("--mute-url %q is not a valid URL", muteURL))
+		}
+	}
+	if kubeletURL != "" {
+		if u, err := url.Parse(kubeletURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("--kubelet-url %q is not a valid http(s) URL", kubeletURL))
+		}
+	}
+	if enrichTimeout <= 0 {
+		problems = append(problems, "--enrich-timeout must be positive")
+	}
+	if auditFile != "" {
+		if info, err := os.Stat(filepath.Dir(auditFile)); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("--audit-file %q is not in an existing directory", auditFile))
+		}
+	}
+	if replayFile != "" {
+		if stateFile != "" {
+			problems = append(problems, "--replay-file cannot be combined with --state-file")
+		}
+		if len(cgroupWatch) > 0 {
+			problems = append(problems, "--replay-file cannot be combined with --cgroup-watch")
+		}
+		if psiThreshold > 0 {
+			problems = append(problems, "--replay-file cannot be combined with --psi-threshold")
+		}
+		if receiveAddr != "" {
+			problems = append(problems, "--replay-file cannot be combined with --receive-addr")
+		}
+	}
+	if replayFilter && replayFile == "" {
+		problems = append(problems, "--replay-startup-filter requires --replay-file")
+	}
+	if stateFile != "" && logSource != monitor.SourceKmsg {
+		problems = append(problems, "--state-file requires --log-source kmsg without fallbacks")
+	}
+	if scanHistory && historyWindow <= 0 {
+		problems = append(problems, "--history-window must be positive")
+	}
+	if startupGrace < 0 {
+		problems = append(problems, "--startup-grace must not be negative")
+	}
+	if metricsAddr != "" {
+		if _, _, err := net.SplitHostPort(metricsAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("--metrics-addr %q is not a valid host:port address", metricsAddr))
+		}
+	}
+	if statsdAddr != "" {
+		if _, _, err := net.SplitHostPort(statsdAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("--statsd-addr %q is not a valid host:port address", statsdAddr))
+		}
+	}
+	if healthAddr != "" {
+		if _, _, err := net.SplitHostPort(healthAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("--health-addr %q is not a valid host:port address", healthAddr))
+		}
+	}
+	if pprofAddr != "" {
+		if _, _, err := net.SplitHostPort(pprofAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("--pprof-addr %q is not a valid host:port address", pprofAddr))
+		}
+	}
+	if receiveAddr != "" {
+		if _, _, err := net.SplitHostPort(receiveAddr); err != nil {
+			problems = append(problems, fmt.Sprintf("--receive-addr %q is not a valid host:port address", receiveAddr))
+		}
+	}
+	if receiveSecret != "" && receiveAddr == "" {
+		problems = append(problems, "--receive-secret requires --receive-addr")
+	}
+	if len(cgroupWatch) > 0 && cgroupWatchInterval <= 0 {
+		problems = append(problems, "--cgroup-watch-interval must be positive")
+	}
+	if psiThreshold < 0 || psiThreshold > 100 {
+		problems = append(problems, "--psi-threshold must be between 0 and 100")
+	}
+	if psiLine != monitor.PressureSome && psiLine != monitor.PressureFull {
+		problems = append(problems, fmt.Sprintf("--psi-line must be %q or %q", monitor.PressureSome, monitor.PressureFull))
+	}
+	if psiThreshold > 0 && psiDuration < 0 {
+		problems = append(problems, "--psi-duration must not be negative")
+	}
+	if _, err := regexp.Compile(fingerprintStrip); err != nil {
+		problems = append(problems, fmt.Sprintf("--fingerprint-strip is not a valid regex: %v", err))
+	}
+	if _, err := regexp.Compile(dedupNormalizeRegex); err != nil {
+		problems = append(problems, fmt.Sprintf("--dedup-normalize-regex is not a valid regex: %v", err))
+	}
+	if maxCmdlineLen != 0 && maxCmdlineLen < 16 {
+		problems = append(problems, "--max-cmdline-len must be 0 or at least 16")
+	}
+	if deliveryInterval < 0 {
+		problems = append(problems, "--delivery-report-interval must not be negative")
+	}
+	if eventBuffer < 1 {
+		problems = append(problems, "--event-buffer must be at least 1")
+	}
+	if topConsumers < 0 {
+		problems = append(problems, "--top-consumers must not be negative")
+	}
+	if includeAncestry < 0 {
+		problems = append(problems, "--include-ancestry must not be negative")
+	}
+	if contextLines < 0 || contextLines > monitor.MaxContextLines {
+		problems = append(problems, fmt.Sprintf("--context-lines must be between 0 and %d", monitor.MaxContextLines))
+	}
+	if reaperWait < 0 {
+		problems = append(problems, "--reaper-wait must not be negative")
+	}
+	if maxAlertsPerMinute < 0 {
+		problems = append(problems, "--max-alerts-per-minute must not be negative")
+	}
+	if maxEventAge < 0 {
+		problems = append(problems, "--max-event-age must not be negative")
+	}
+	if protectSelfScore < -1000 || protectSelfScore > 1000 {
+		problems = append(problems, "--protect-self-score must be between -1000 and 1000")
+	}
+	if dedupWindow < 0 {
+		problems = append(problems, "--dedup-window must not be negative")
+	}
+	if flapThreshold < 0 {
+		problems = append(problems, "--flap-threshold must not be negative")
+	}
+	if flapThreshold > 0 && flapWindow <= 0 {
+		problems = append(problems, "--flap-window must be positive")
+	}
+	if recoveryWindow < 0 {
+		problems = append(problems, "--recovery-window must not be negative")
+	}
+	if recoveryWindow > 0 && flapThreshold == 0 {
+		problems = append(problems, "--recovery-window requires --flap-threshold")
+	}
+	if flapChannel != "" && (flapThreshold == 0 || (len(slackWebhooks) == 0 && slackToken == "")) {
+		problems = append(problems, "--flap-channel requires --flap-threshold and --slack-webhook or --slack-token")
+	}
+	if flapChannel != "" {
+		if _, err := notifier.NormalizeSlackChannel(flapChannel); err != nil {
+			problems = append(problems, fmt.Sprintf("--flap-channel: %v", err))
+		}
+	}
+	if alertCooldown < 0 {
+		problems = append(problems, "--alert-cooldown must not be negative")
+	}
+	if _, err := notifier.NewCmdlineFilter(includeCmdlines, excludeCmdlines); err != nil {
+		problems = append(problems, fmt.Sprintf("--include-cmdline/--exclude-cmdline: %v", err))
+	}
+	if _, err := notifier.NewUIDFilter(includeUIDs, excludeUIDs); err != nil {
+		problems = append(problems, fmt.Sprintf("--include-uid/--exclude-uid: %v", err))
+	}
+	if minRSS != "" {
+		if _, err := notifier.ParseSize(minRSS); err != nil {
+			problems = append(problems, fmt.Sprintf("--min-rss: %v", err))
+		}
+	}
+	if sampleRate <= 0 || sampleRate > 1 {
+		problems = append(problems, "--sample-rate must be greater than 0 and at most 1")
+	}
+	if retryQueueMaxAge <= 0 {
+		problems = append(problems, "--retry-queue-max-age must be positive")
+	}
+	if samplingWindow <= 0 {
+		problems = append(problems, "--sampling-window must be positive")
+	}
+	if sampling && sampleRate < 1 {
+		problems = append(problems, "--sampling and --sample-rate cannot be combined")
+	}
+
+	if _, err := logLevel(); err != nil {
+		problems = append(problems, fmt.Sprintf("--log-level: %v", err))
+	}
+	switch {
+	case outputFormat != outputText && outputFormat != outputJSON:
+		problems = append(problems, fmt.Sprintf("invalid --output %q, expected %s or %s", outputFormat, outputText, outputJSON))
+	case outputFormat == outputJSON && !testNotification && replayFile == "":
+		problems = append(problems, "--output json requires --test-notification or --replay-file")
+	case outputFormat == outputJSON && printEvents:
+		problems = append(problems, "--output json and --print-events both write to stdout, use only one")
+	}
+	if logFormat != logger.FormatText && logFormat != logger.FormatJSON {
+		problems = append(problems, fmt.Sprintf("--log-format must be %s or %s", logger.FormatText, logger.FormatJSON))
+	}
+	if logFile != "" && logSyslog {
+		problems = append(problems, "--log-file and --syslog cannot be used together")
+	}
+	if logMaxSize < 0 {
+		problems = append(problems, "--log-max-size must not be negative")
+	}
+
+	if matchersFile != "" {
+		if _, err := monitor.LoadMatchers(matchersFile); err != nil {
+			problems = append(problems, fmt.Sprintf("--matchers-file: %v", err))
+		}
+	}
+	if _, err := regexp.Compile(oomPattern); err != nil {
+		problems = append(problems, fmt.Sprintf("--oom-pattern is not a valid regex: %v", err))
+	}
+	if re, err := regexp.Compile(pidPattern); err != nil {
+		problems = append(problems, fmt.Sprintf("--pid-pattern is not a valid regex: %v", err))
+	} else if re.NumSubexp() == 0 {
+		problems = append(problems, "--pid-pattern must have a capture group for the PID")
+	}
+
+	return problems
+}
+
+// logLevel returns the configured log level. --debug wins over --log-level,
+// which falls back to the LOGGING_LEVEL environment variable when it is not
+// set.
+func logLevel() (logger.Level, error) {
+	if debug {
+		return logger.LevelDebug, nil
+	}
+	name := logLevelName
+	if !flag.CommandLine.Changed("log-level") {
+		if env := os.Getenv("LOGGING_LEVEL"); env != "" {
+			name = env
+		}
+	}
+	return logger.ParseLevel(name)
+}
+
+// checkConfig prints a validation report and returns the exit code.
+func checkConfig() int {
+	problems := validateConfig()
+	if len(problems) == 0 {
+		fmt.Println("Configuration OK")
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "Configuration has %d problem(s):\n", len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(os.Stderr, "  - %s\n", problem)
+	}
+	return 1
+}
+
+// loadConfigFile applies the values from a YAML configuration file to the
+// flags that were not given on the command line.
+func loadConfigFile(path string) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	return cfg.Apply(flag.CommandLine)
+}
+
+// tlsOptions collects the TLS flags of the HTTP notifiers.
+func tlsOptions() notifier.TLSOptions {
+	return notifier.TLSOptions{
+		CAFile:             caFile,
+		CertFile:           clientCert,
+		KeyFile:            clientKey,
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+}
+
+// validHTTPURL reports whether raw is a URL of one of schemes with a host,
+// IPv6 literals in brackets included, or the unix:///path/to.sock URL of an
+// HTTP server on a unix socket.
+func validHTTPURL(raw string, schemes ...string) bool {
+	if _, _, ok := notifier.ParseUnixURL(raw); ok {
+		return true
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// logSources splits --log-source into the kernel log sources to try, in
+// order.
+func logSources() []string {
+	var sources []string
+	for _, source := range strings.Split(logSource, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
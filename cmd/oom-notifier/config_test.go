@@ -0,0 +1,689 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/oom-notifier/go/internal/config"
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/monitor"
+	flag "github.com/spf13/pflag"
+)
+
+// hasProblem reports whether validateConfig finds a problem mentioning flag.
+func hasProblem(flag string) bool {
+	for _, problem := range validateConfig() {
+		if strings.Contains(problem, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidateConfigRejectsUnknownTimezone(t *testing.T) {
+	override(t, &timezone, "America/Chicago")
+	if hasProblem("--timezone") {
+		t.Error("valid timezone rejected")
+	}
+
+	timezone = "Mars/Olympus_Mons"
+	if !hasProblem("--timezone") {
+		t.Error("unknown timezone accepted")
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	override(t, &webhookURL, "http://127.0.0.1:9/oom")
+	if status := checkConfig(); status != 0 {
+		t.Fatalf("checkConfig = %d for a valid configuration, want 0", status)
+	}
+
+	for _, tt := range []struct {
+		flag string
+		set  func(t *testing.T)
+	}{
+		{"--exclude-cmdline", func(t *testing.T) { override(t, &excludeCmdlines, []string{"("}) }},
+		{"--message-template", func(t *testing.T) { override(t, &messageTemplate, "{{.Cmdline") }},
+		{"--timezone", func(t *testing.T) { override(t, &timezone, "Nowhere/Atlantis") }},
+		{"--oom-pattern", func(t *testing.T) { override(t, &oomPattern, "[") }},
+		{"no notifier configured", func(t *testing.T) { override(t, &webhookURL, "") }},
+	} {
+		t.Run(tt.flag, func(t *testing.T) {
+			tt.set(t)
+			if !hasProblem(tt.flag) {
+				t.Errorf("no problem reported for %s: %v", tt.flag, validateConfig())
+			}
+			if status := checkConfig(); status != 1 {
+				t.Errorf("checkConfig = %d, want 1", status)
+			}
+		})
+	}
+}
+
+func TestValidateConfigRejectsNegativeDedupWindow(t *testing.T) {
+	override(t, &dedupWindow, -1)
+	if !hasProblem("--dedup-window") {
+		t.Error("negative --dedup-window accepted")
+	}
+	dedupWindow = 0
+	if hasProblem("--dedup-window") {
+		t.Error("--dedup-window 0, disabling deduplication, rejected")
+	}
+}
+
+// configFlags returns the flags named by the tags of the fields of t, a
+// struct of config.Config.
+func configFlags(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name := field.Tag.Get("flag"); name != "" {
+			names = append(names, name)
+		} else if field.Type.Kind() == reflect.Struct {
+			names = append(names, configFlags(field.Type)...)
+		}
+	}
+	return names
+}
+
+func TestConfigFileFieldsAreFlags(t *testing.T) {
+	for _, name := range configFlags(reflect.TypeOf(config.Config{})) {
+		if flag.Lookup(name) == nil {
+			t.Errorf("config file field for unknown flag --%s", name)
+		}
+	}
+}
+
+func TestValidateConfigChecksLogSource(t *testing.T) {
+	for source, ok := range map[string]bool{
+		"kmsg":         true,
+		"journal":      true,
+		"kmsg,journal": true,
+		"syslog":       false,
+		"kmsg,kmsg":    false,
+	} {
+		override(t, &logSource, source)
+		if hasProblem("--log-source") == ok {
+			t.Errorf("--log-source %s: problems %v, want valid %v", source, validateConfig(), ok)
+		}
+	}
+}
+
+func TestValidateConfigRejectsNegativeTopConsumers(t *testing.T) {
+	override(t, &topConsumers, -1)
+	if !hasProblem("--top-consumers") {
+		t.Error("negative --top-consumers accepted")
+	}
+	topConsumers = 0
+	if hasProblem("--top-consumers") {
+		t.Error("--top-consumers 0, disabling the list, rejected")
+	}
+}
+
+func TestValidateConfigRejectsNegativeIncludeAncestry(t *testing.T) {
+	override(t, &includeAncestry, -1)
+	if !hasProblem("--include-ancestry") {
+		t.Error("negative --include-ancestry accepted")
+	}
+	includeAncestry = 0
+	if hasProblem("--include-ancestry") {
+		t.Error("--include-ancestry 0, disabling the chain, rejected")
+	}
+}
+
+func TestValidateConfigChecksHistoryWindow(t *testing.T) {
+	override(t, &scanHistory, true)
+	override(t, &historyWindow, 0)
+	if !hasProblem("--history-window") {
+		t.Error("--scan-history with an empty --history-window accepted")
+	}
+	scanHistory = false
+	if hasProblem("--history-window") {
+		t.Error("--history-window checked without --scan-history")
+	}
+}
+
+func TestLogLevelPrecedence(t *testing.T) {
+	override(t, &debug, false)
+	override(t, &logLevelName, "info")
+	t.Setenv("LOGGING_LEVEL", "warn")
+
+	// --log-level is at its default, LOGGING_LEVEL applies
+	if level, err := logLevel(); err != nil || level != logger.LevelWarn {
+		t.Errorf("logLevel with LOGGING_LEVEL=warn = %v, %v, want warn", level, err)
+	}
+
+	override(t, &debug, true)
+	if level, err := logLevel(); err != nil || level != logger.LevelDebug {
+		t.Errorf("logLevel with --debug = %v, %v, want debug", level, err)
+	}
+
+	override(t, &debug, false)
+	t.Setenv("LOGGING_LEVEL", "verbose")
+	if !hasProblem("--log-level") {
+		t.Error("invalid LOGGING_LEVEL not reported")
+	}
+}
+
+func TestValidateConfigChecksMinRSS(t *testing.T) {
+	override(t, &minRSS, "256MB")
+	if hasProblem("--min-rss") {
+		t.Error("valid --min-rss reported")
+	}
+	override(t, &minRSS, "256 bananas")
+	if !hasProblem("--min-rss") {
+		t.Error("invalid --min-rss not reported")
+	}
+}
+
+func TestValidateConfigRejectsEmptyEventBuffer(t *testing.T) {
+	override(t, &eventBuffer, 0)
+	if !hasProblem("--event-buffer") {
+		t.Error("--event-buffer 0 not reported")
+	}
+}
+
+func TestValidateConfigChecksSlackIdentity(t *testing.T) {
+	for emoji, ok := range map[string]bool{
+		":firecracker:":    true,
+		":rotating_light:": true,
+		"firecracker":      false,
+		":firecracker":     false,
+		"::":               false,
+		"":                 false,
+	} {
+		override(t, &slackIconEmoji, emoji)
+		if hasProblem("--slack-icon-emoji") == ok {
+			t.Errorf("--slack-icon-emoji %q: problems %v, want valid %v", emoji, validateConfig(), ok)
+		}
+	}
+
+	override(t, &slackUsername, "")
+	if !hasProblem("--slack-username") {
+		t.Error("empty --slack-username accepted")
+	}
+}
+
+func TestValidateConfigRequiresPositiveHTTPTimeout(t *testing.T) {
+	override(t, &httpTimeout, 0)
+	if !hasProblem("--http-timeout") {
+		t.Error("--http-timeout 0 accepted")
+	}
+	httpTimeout = 30
+	if hasProblem("--http-timeout") {
+		t.Error("--http-timeout 30 rejected")
+	}
+}
+
+func TestValidateConfigRejectsNegativeProcessScan(t *testing.T) {
+	override(t, &processScan, -1)
+	if !hasProblem("--process-scan") {
+		t.Error("negative --process-scan accepted")
+	}
+	processScan = 0
+	if hasProblem("--process-scan") {
+		t.Error("--process-scan 0, disabling the scan, rejected")
+	}
+}
+
+func TestValidateConfigRejectsNegativeAlertCooldown(t *testing.T) {
+	override(t, &alertCooldown, -1)
+	if !hasProblem("--alert-cooldown") {
+		t.Error("negative --alert-cooldown accepted")
+	}
+}
+
+func TestValidateConfigAcceptsPrintEventsAlone(t *testing.T) {
+	override(t, &webhookURL, "")
+	if !hasProblem("no notifier configured") {
+		t.Fatal("no notifier reported without any backend")
+	}
+	override(t, &printEvents, true)
+	if problems := validateConfig(); len(problems) != 0 {
+		t.Errorf("--print-events alone: problems %v, want none", problems)
+	}
+}
+
+func TestValidateConfigRejectsNegativeDeliveryReportInterval(t *testing.T) {
+	override(t, &deliveryInterval, -1)
+	if !hasProblem("--delivery-report-interval") {
+		t.Error("negative --delivery-report-interval accepted")
+	}
+}
+
+func TestValidateConfigChecksFingerprintStrip(t *testing.T) {
+	override(t, &fingerprintStrip, "(")
+	if !hasProblem("--fingerprint-strip") {
+		t.Error("invalid --fingerprint-strip accepted")
+	}
+	fingerprintStrip = ""
+	if hasProblem("--fingerprint-strip") {
+		t.Error("empty --fingerprint-strip, keeping command lines whole, rejected")
+	}
+}
+
+func TestValidateConfigChecksFlapping(t *testing.T) {
+	override(t, &flapThreshold, -1)
+	if !hasProblem("--flap-threshold") {
+		t.Error("negative --flap-threshold accepted")
+	}
+
+	flapThreshold = 3
+	override(t, &flapWindow, 0)
+	if !hasProblem("--flap-window") {
+		t.Error("--flap-window 0 accepted")
+	}
+
+	flapWindow = 600
+	override(t, &flapChannel, "#oncall")
+	if !hasProblem("--flap-channel") {
+		t.Error("--flap-channel accepted without Slack")
+	}
+	override(t, &slackWebhooks, []string{"https://hooks.slack.com/services/T/B/X"})
+	if hasProblem("--flap") {
+		t.Errorf("valid flapping configuration rejected: %v", validateConfig())
+	}
+}
+
+func TestValidateConfigChecksRecoveryWindow(t *testing.T) {
+	override(t, &recoveryWindow, -1)
+	if !hasProblem("--recovery-window must not be negative") {
+		t.Error("negative --recovery-window accepted")
+	}
+
+	recoveryWindow = 300
+	if !hasProblem("--recovery-window requires --flap-threshold") {
+		t.Error("--recovery-window accepted without --flap-threshold")
+	}
+	override(t, &flapThreshold, 3)
+	if hasProblem("--recovery-window") {
+		t.Errorf("valid recovery configuration rejected: %v", validateConfig())
+	}
+}
+
+func TestValidateConfigChecksNATS(t *testing.T) {
+	for natsServers, ok := range map[string]bool{
+		"nats://127.0.0.1:4222":                    true,
+		"127.0.0.1:4222":                           true,
+		"nats://nats-1:4222,tls://nats-2:4222":     true,
+		"http://127.0.0.1:4222":                    false,
+		"nats://127.0.0.1:4222,mqtt://broker:1883": false,
+	} {
+		override(t, &natsURL, natsServers)
+		if hasProblem("--nats-url") == ok {
+			t.Errorf("--nats-url %q: problems %v, want valid %v", natsServers, validateConfig(), ok)
+		}
+	}
+
+	override(t, &natsSubject, "")
+	if !hasProblem("--nats-subject") {
+		t.Error("empty --nats-subject accepted")
+	}
+}
+
+func TestValidateConfigChecksGelfAddr(t *testing.T) {
+	override(t, &gelfAddr, "graylog:12201")
+	if hasProblem("--gelf-addr") {
+		t.Error("valid --gelf-addr rejected")
+	}
+	gelfAddr = "graylog"
+	if !hasProblem("--gelf-addr") {
+		t.Error("--gelf-addr without a port accepted")
+	}
+}
+
+func TestValidateConfigChecksOutput(t *testing.T) {
+	override(t, &outputFormat, "yaml")
+	if !hasProblem("invalid --output") {
+		t.Error("--output yaml accepted")
+	}
+
+	outputFormat = outputJSON
+	if !hasProblem("--output json requires --test-notification or --replay-file") {
+		t.Error("--output json accepted while monitoring")
+	}
+	override(t, &testNotification, true)
+	if hasProblem("--output") {
+		t.Errorf("--output json with --test-notification rejected: %v", validateConfig())
+	}
+	override(t, &printEvents, true)
+	if !hasProblem("--output json and --print-events") {
+		t.Error("--output json accepted with --print-events")
+	}
+}
+
+func TestValidateConfigChecksContextLines(t *testing.T) {
+	for lines, ok := range map[int]bool{0: true, 5: true, monitor.MaxContextLines: true, -1: false, monitor.MaxContextLines + 1: false} {
+		override(t, &contextLines, lines)
+		if hasProblem("--context-lines") == ok {
+			t.Errorf("--context-lines %d: problems %v, want valid %v", lines, validateConfig(), ok)
+		}
+	}
+}
+
+func TestValidateConfigChecksSyslog(t *testing.T) {
+	override(t, &syslogAddr, "logs.example.com:514")
+	for network, ok := range map[string]bool{"udp": true, "tcp": true, "tls": true, "sctp": false} {
+		override(t, &syslogNetwork, network)
+		if hasProblem("--syslog-addr") == ok {
+			t.Errorf("--syslog-network %s: problems %v, want valid %v", network, validateConfig(), ok)
+		}
+	}
+
+	syslogNetwork = "udp"
+	override(t, &syslogFacility, 24)
+	if !hasProblem("--syslog-addr: invalid syslog facility") {
+		t.Error("--syslog-facility 24 accepted")
+	}
+	syslogFacility = 16
+	syslogAddr = "logs.example.com"
+	if !hasProblem("--syslog-addr") {
+		t.Error("--syslog-addr without a port accepted")
+	}
+
+	syslogAddr = ""
+	network := flag.Lookup("syslog-network")
+	t.Cleanup(func() { network.Changed = false })
+	network.Changed = true
+	if !hasProblem("--syslog-network and --syslog-facility require --syslog-addr") {
+		t.Error("--syslog-network accepted without --syslog-addr")
+	}
+}
+
+func TestValidateConfigPairsPushoverCredentials(t *testing.T) {
+	override(t, &pushoverToken, "app-token")
+	if !hasProblem("--pushover-user") {
+		t.Error("--pushover-token accepted without --pushover-user")
+	}
+	override(t, &pushoverUser, "user-key")
+	if hasProblem("--pushover") {
+		t.Errorf("--pushover-token with --pushover-user rejected: %v", validateConfig())
+	}
+}
+
+func TestValidateConfigRejectsNegativeStartupGrace(t *testing.T) {
+	override(t, &startupGrace, -1)
+	if !hasProblem("--startup-grace") {
+		t.Error("negative --startup-grace accepted")
+	}
+}
+
+func TestValidateConfigChecksMattermost(t *testing.T) {
+	override(t, &mattermostChannel, "town-square")
+	if !hasProblem("--mattermost-channel") {
+		t.Error("--mattermost-channel accepted without --mattermost-webhook")
+	}
+	override(t, &mattermostWebhook, "ftp://chat.example.com/hooks/x")
+	if !hasProblem("--mattermost-webhook") {
+		t.Error("non-http --mattermost-webhook accepted")
+	}
+	mattermostWebhook = "https://chat.example.com/hooks/x"
+	if hasProblem("--mattermost") {
+		t.Errorf("valid Mattermost configuration rejected: %v", validateConfig())
+	}
+}
+
+func TestValidateConfigChecksLinkTemplate(t *testing.T) {
+	override(t, &linkTemplate, "https://logs.example.com/?host={{.Hostname")
+	if !hasProblem("--link-template") {
+		t.Error("invalid --link-template accepted")
+	}
+	linkTemplate = "https://logs.example.com/?host={{.Hostname}}"
+	if hasProblem("--link-template") {
+		t.Error("valid --link-template rejected")
+	}
+}
+
+func TestValidateConfigChecksSampling(t *testing.T) {
+	override(t, &samplingWindow, 0)
+	if !hasProblem("--sampling-window") {
+		t.Error("--sampling-window 0 accepted")
+	}
+	samplingWindow = 3600
+	override(t, &sampling, true)
+	override(t, &sampleRate, 0.5)
+	if !hasProblem("--sampling and --sample-rate") {
+		t.Error("--sampling accepted with --sample-rate")
+	}
+}
+
+func TestValidateConfigChecksSeverityStyles(t *testing.T) {
+	override(t, &severityColors, []string{"warning=#439FE0"})
+	override(t, &severityEmojis, []string{"critical=🔥"})
+	if hasProblem("--severity-color") {
+		t.Errorf("valid severity styles rejected: %v", validateConfig())
+	}
+	severityColors = []string{"warning=purple"}
+	if !hasProblem("--severity-color") {
+		t.Error("invalid --severity-color accepted")
+	}
+}
+
+func TestValidateConfigChecksReplayFile(t *testing.T) {
+	override(t, &replayFilter, true)
+	if !hasProblem("--replay-startup-filter requires --replay-file") {
+		t.Error("--replay-startup-filter accepted without --replay-file")
+	}
+	override(t, &replayFile, "kmsg.txt")
+	if hasProblem("--replay") {
+		t.Errorf("valid replay rejected: %v", validateConfig())
+	}
+	override(t, &stateFile, "/var/lib/oom-notifier/state")
+	override(t, &cgroupWatch, []string{"/sys/fs/cgroup/system.slice"})
+	if !hasProblem("--replay-file cannot be combined with --state-file") || !hasProblem("--replay-file cannot be combined with --cgroup-watch") {
+		t.Errorf("replay accepted with the live sources: %v", validateConfig())
+	}
+}
+
+func TestValidateConfigChecksUIDFilter(t *testing.T) {
+	override(t, &includeUIDs, []string{"1000"})
+	override(t, &excludeUIDs, []string{"root"})
+	if hasProblem("--include-uid") {
+		t.Errorf("valid UID filter rejected: %v", validateConfig())
+	}
+	excludeUIDs = []string{"no-such-user-oom"}
+	if !hasProblem("--include-uid/--exclude-uid") {
+		t.Error("unknown user name accepted")
+	}
+}
+
+func TestValidateConfigChecksReceiveAddr(t *testing.T) {
+	override(t, &receiveSecret, "s3cret")
+	if !hasProblem("--receive-secret requires --receive-addr") {
+		t.Error("--receive-secret accepted without --receive-addr")
+	}
+	override(t, &receiveAddr, ":9095")
+	if hasProblem("--receive-") {
+		t.Errorf("valid receiver rejected: %v", validateConfig())
+	}
+	receiveAddr = "9095"
+	if !hasProblem("--receive-addr") {
+		t.Error("--receive-addr without a port accepted")
+	}
+}
+
+func TestValidateConfigChecksDmesgFile(t *testing.T) {
+	override(t, &dmesgFile, "/var/log/kern.log")
+	if !hasProblem("--dmesg-file requires dmesg in --log-source") {
+		t.Error("--dmesg-file accepted without the dmesg source")
+	}
+	override(t, &logSource, "kmsg,dmesg")
+	if hasProblem("--dmesg-file") || hasProblem("--log-source") {
+		t.Errorf("valid dmesg source rejected: %v", validateConfig())
+	}
+}
+
+func TestValidateConfigChecksFields(t *testing.T) {
+	override(t, &shownFields, "pid,cmdline,hostname,time")
+	if hasProblem("--fields") {
+		t.Errorf("valid --fields rejected: %v", validateConfig())
+	}
+	shownFields = "pid,kernel_version"
+	if !hasProblem("--fields") {
+		t.Error("unknown field accepted")
+	}
+}
+
+func TestValidateConfigAcceptsUnixSocketAndIPv6URLs(t *testing.T) {
+	for url, ok := range map[string]bool{
+		"unix:///run/hook.sock":         true,
+		"unix:///run/hook.sock:/events": true,
+		"http://[fd00::1]:8080/events":  true,
+		"unix://run/hook.sock":          false,
+		"ftp://[fd00::1]/events":        false,
+	} {
+		override(t, &webhookURL, url)
+		override(t, &slackWebhooks, []string{url})
+		if hasProblem("--webhook-url") == ok || hasProblem("--slack-webhook") == ok {
+			t.Errorf("%s: problems %v, want valid %v", url, validateConfig(), ok)
+		}
+	}
+}
+
+func TestValidateConfigRejectsNegativeMaxEventAge(t *testing.T) {
+	override(t, &maxEventAge, -1)
+	if !hasProblem("--max-event-age") {
+		t.Error("negative --max-event-age accepted")
+	}
+	maxEventAge = 0
+	if hasProblem("--max-event-age") {
+		t.Error("--max-event-age 0, disabling the check, rejected")
+	}
+}
+
+func TestValidateConfigChecksProtectSelfScore(t *testing.T) {
+	for score, ok := range map[int]bool{-1000: true, 0: true, 1000: true, -1001: false, 1001: false} {
+		override(t, &protectSelfScore, score)
+		if hasProblem("--protect-self-score") == ok {
+			t.Errorf("--protect-self-score %d: problems %v, want valid %v", score, validateConfig(), ok)
+		}
+	}
+}
+
+func TestValidateConfigChecksMaxCmdlineLen(t *testing.T) {
+	for n, ok := range map[int]bool{0: true, 16: true, 200: true, 15: false, -1: false} {
+		override(t, &maxCmdlineLen, n)
+		if hasProblem("--max-cmdline-len") == ok {
+			t.Errorf("--max-cmdline-len %d: problems %v, want valid %v", n, validateConfig(), ok)
+		}
+	}
+}
+
+func TestValidateConfigChecksSlackThread(t *testing.T) {
+	override(t, &slackThread, 600)
+	if !hasProblem("--slack-thread requires --slack-token") {
+		t.Error("--slack-thread accepted with webhooks only")
+	}
+	override(t, &slackToken, "xoxb-test")
+	if hasProblem("--slack-") {
+		t.Errorf("valid threaded Slack rejected: %v", validateConfig())
+	}
+	override(t, &slackWebhooks, []string{"https://hooks.slack.com/services/T/B/X"})
+	if !hasProblem("--slack-token and --slack-webhook cannot be combined") {
+		t.Error("--slack-token accepted with --slack-webhook")
+	}
+}
+
+func TestValidateConfigChecksPSI(t *testing.T) {
+	override(t, &psiThreshold, 20)
+	if hasProblem("--psi-") {
+		t.Errorf("valid pressure watch rejected: %v", validateConfig())
+	}
+	for _, tt := range []struct {
+		flag string
+		set  func(t *testing.T)
+	}{
+		{"--psi-threshold", func(t *testing.T) { override(t, &psiThreshold, 101) }},
+		{"--psi-line", func(t *testing.T) { override(t, &psiLine, "avg10") }},
+		{"--psi-duration", func(t *testing.T) { override(t, &psiDuration, -1) }},
+		{"--replay-file cannot be combined with --psi-threshold", func(t *testing.T) { override(t, &replayFile, "kmsg.txt") }},
+	} {
+		t.Run(tt.flag, func(t *testing.T) {
+			tt.set(t)
+			if !hasProblem(tt.flag) {
+				t.Errorf("no problem reported for %s: %v", tt.flag, validateConfig())
+			}
+		})
+	}
+}
+
+func TestValidateConfigChecksPIDPattern(t *testing.T) {
+	override(t, &oomPattern, `(?i)oom killer terminated`)
+	override(t, &pidPattern, `terminated task (\d+)`)
+	if hasProblem("-pattern") {
+		t.Errorf("valid custom patterns rejected: %v", validateConfig())
+	}
+	pidPattern = "("
+	if !hasProblem("--pid-pattern is not a valid regex") {
+		t.Error("invalid --pid-pattern accepted")
+	}
+	pidPattern = `terminated task \d+`
+	if !hasProblem("--pid-pattern must have a capture group") {
+		t.Error("--pid-pattern without a capture group accepted")
+	}
+}
+
+func TestValidateConfigChecksEnrichTimeout(t *testing.T) {
+	override(t, &enrichTimeout, 0)
+	if !hasProblem("--enrich-timeout") {
+		t.Error("--enrich-timeout 0 accepted")
+	}
+	enrichTimeout = 5
+	if hasProblem("--enrich-timeout") {
+		t.Error("--enrich-timeout 5 rejected")
+	}
+}
+
+func TestValidateConfigChecksPushOptions(t *testing.T) {
+	for _, flag := range []*bool{&webhookGzip, &webhookBatch, &lokiGzip, &lokiBatch} {
+		override(t, flag, true)
+	}
+	for _, want := range []string{"--webhook-gzip requires", "--webhook-batch requires", "--loki-gzip requires", "--loki-batch requires", "require --batch-window"} {
+		if !hasProblem(want) {
+			t.Errorf("problems %v, want %q", validateConfig(), want)
+		}
+	}
+
+	override(t, &webhookURL, "https://hooks.example.com/oom")
+	override(t, &lokiURL, "http://loki:3100")
+	override(t, &batchWindow, 30)
+	if hasProblem("gzip") || hasProblem("batch") {
+		t.Errorf("problems %v, want the push options accepted", validateConfig())
+	}
+}
+
+func TestValidateConfigChecksSlackChannels(t *testing.T) {
+	override(t, &slackWebhooks, []string{"https://hooks.slack.com/services/T000/B000/XXXX"})
+	override(t, &flapThreshold, 3)
+	for _, tt := range []struct {
+		flag    string
+		channel *string
+	}{
+		{"--slack-channel", &slackChannel},
+		{"--flap-channel", &flapChannel},
+	} {
+		for channel, ok := range map[string]bool{"alerts": true, "#alerts": true, "@oncall": true, "C024BE91L": true, "my alerts": false, "alerts,ops": false} {
+			override(t, tt.channel, channel)
+			if hasProblem(tt.flag+":") == ok {
+				t.Errorf("%s %q: problems %v, want valid %v", tt.flag, channel, validateConfig(), ok)
+			}
+		}
+	}
+
+	override(t, &channelRoutes, []string{"^java=my alerts"})
+	if !hasProblem("--channel-route") {
+		t.Error("--channel-route to an invalid channel accepted")
+	}
+}
+
+func TestValidateConfigChecksMuteHosts(t *testing.T) {
+	override(t, &muteHosts, []string{"lab-1", "ci-[0-9]+"})
+	if hasProblem("--mute-host") {
+		t.Errorf("problems %v, want the muted hosts accepted", validateConfig())
+	}
+	muteHosts = []string{"lab-(1"}
+	if !hasProblem("--mute-host") {
+		t.Error("invalid --mute-host pattern accepted")
+	}
+}
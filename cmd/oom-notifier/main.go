@@ -1,115 +1,1450 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/oom-notifier/go/internal/audit"
+	"github.com/oom-notifier/go/internal/bus"
+	"github.com/oom-notifier/go/internal/config"
+	"github.com/oom-notifier/go/internal/docker"
+	"github.com/oom-notifier/go/internal/enrich"
+	"github.com/oom-notifier/go/internal/kube"
 	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/metrics"
 	"github.com/oom-notifier/go/internal/monitor"
 	"github.com/oom-notifier/go/internal/notifier"
+	"github.com/oom-notifier/go/internal/spool"
 	flag "github.com/spf13/pflag"
 )
 
 var (
-	slackWebhook     string
-	slackChannel     string
-	processRefresh   int
-	kernelLogRefresh int
-	procDir          string
-	debug            bool
+	notifierSpecs      []string
+	slackWebhooks      []string
+	slackToken         string
+	slackThread        int
+	slackChannel       string
+	channelRoutes      []string
+	slackMode          string
+	slackFormat        string
+	slackUsername      string
+	slackIconEmoji     string
+	messageTemplate    string
+	httpTimeout        int
+	caFile             string
+	clientCert         string
+	clientKey          string
+	insecureSkipVerify bool
+	slackRetries       int
+	slackBackoff       int
+	discordWebhook     string
+	teamsWebhook       string
+	mattermostWebhook  string
+	mattermostChannel  string
+	telegramToken      string
+	telegramChatID     string
+	pushoverToken      string
+	pushoverUser       string
+	webhookURL         string
+	webhookSecret      string
+	webhookGzip        bool
+	webhookBatch       bool
+	smtpHost           string
+	smtpPort           int
+	smtpUsername       string
+	smtpPassword       string
+	emailFrom          string
+	emailTo            []string
+	snsTopicARN        string
+	snsRegion          string
+	kafkaBrokers       []string
+	kafkaTopic         string
+	natsURL            string
+	natsSubject        string
+	gelfAddr           string
+	syslogAddr         string
+	syslogNetwork      string
+	syslogFacility     int
+	lokiURL            string
+	lokiLabels         []string
+	lokiGzip           bool
+	lokiBatch          bool
+	auditFile          string
+	outputSchema       string
+	jsonNaming         string
+	jsonEmptyFields    string
+	retryQueueDir      string
+	retryQueueMaxAge   int
+	kubeletURL         string
+	dockerEnrich       bool
+	dockerSocket       string
+	enrichCommand      string
+	enrichTimeout      int
+	processRefresh     int
+	minRefreshInterval int
+	processScan        int
+	kernelLogRefresh   int
+	procDirs           []string
+	logSource          string
+	dmesgFile          string
+	replayFile         string
+	replayFilter       bool
+	debug              bool
+	logLevelName       string
+	logFormat          string
+	logFile            string
+	logMaxSize         int
+	logSyslog          bool
+
+	summarizeContainers bool
+	summarizeWindow     int
+	summarizeThreshold  int
+	batchWindow         int
+	quietHours          string
+	quietSeverity       string
+	quietDigest         bool
+	summaryInterval     int
+	alertOnDropped      bool
+	captureEnv          []string
+	watchSegfaults      bool
+	watchHungTasks      bool
+	matchersFile        string
+	oomPattern          string
+	pidPattern          string
+	attachFullReport    bool
+	contextLines        int
+	muteFile            string
+	muteURL             string
+	muteRefresh         int
+	muteHosts           []string
+	reaperWait          int
+	sampleRate          float64
+	sampling            bool
+	samplingWindow      int
+	includeCmdlines     []string
+	excludeCmdlines     []string
+	includeUIDs         []string
+	excludeUIDs         []string
+	minRSS              string
+	dedupWindow         int
+	dedupNormalizeRegex string
+	alertCooldown       int
+	flapThreshold       int
+	flapWindow          int
+	flapChannel         string
+	recoveryWindow      int
+	maxAlertsPerMinute  int
+	maxEventAge         int
+	protectSelfOOM      bool
+	protectSelfScore    int
+	timezone            string
+	linkTemplate        string
+	severityColors      []string
+	severityEmojis      []string
+	severityMapFile     string
+	shownFields         string
+	configFile          string
+	checkOnly           bool
+	showVersion         bool
+	flattenCmdline      bool
+	topConsumers        int
+	includeAncestry     int
+	stateFile           string
+	cgroupWatch         []string
+	cgroupWatchInterval int
+	psiThreshold        float64
+	psiLine             string
+	psiDuration         int
+	psiFile             string
+	metricsAddr         string
+	healthAddr          string
+	pprofAddr           string
+	receiveAddr         string
+	receiveSecret       string
+	testNotification    bool
+	dryRun              bool
+	printEvents         bool
+	outputFormat        string
+	once                bool
+	fingerprintStrip    string
+	maxCmdlineLen       int
+	deliveryInterval    int
+	eventBuffer         int
+	statsdAddr          string
+	scanHistory         bool
+	historyWindow       int
+	startupGrace        int
 )
 
 func init() {
-	flag.StringVar(&slackWebhook, "slack-webhook", "", "Slack webhook URL")
+	flag.StringArrayVar(&notifierSpecs, "notifier", nil, "Notifier to send to, as name or name:key=value,... setting its flags, e.g. slack:webhook=URL (repeatable, default every configured notifier)")
+	flag.StringArrayVar(&slackWebhooks, "slack-webhook", nil, "Slack webhook URL (repeatable)")
+	flag.StringVar(&slackToken, "slack-token", "", "Slack bot token to post with through the Web API instead of a webhook, e.g. xoxb-...")
+	flag.IntVar(&slackThread, "slack-thread", 0, "Post the repeats of an event as replies in the thread of the first one until it was quiet for this many seconds, requires --slack-token")
 	flag.StringVar(&slackChannel, "slack-channel", "#alerts", "Slack channel to send notifications")
+	flag.StringArrayVar(&channelRoutes, "channel-route", nil, "Send events whose command line or hostname matches a regex to another Slack channel, as pattern=channel (repeatable)")
+	flag.StringVar(&slackMode, "slack-mode", notifier.SlackModeAll, "Delivery mode for multiple Slack webhooks: all or failover")
+	flag.StringVar(&slackUsername, "slack-username", notifier.SlackDefaultUsername, "Username Slack messages are posted as")
+	flag.StringVar(&slackIconEmoji, "slack-icon-emoji", notifier.SlackDefaultIconEmoji, "Emoji used as the icon of Slack messages, e.g. :rotating_light:")
+	flag.IntVar(&httpTimeout, "http-timeout", 10, "Timeout in seconds of HTTP requests made by notifiers and --mute-url")
+	flag.StringVar(&caFile, "ca-file", "", "PEM file with CA certificates trusted by HTTP notifiers, in addition to the system ones")
+	flag.StringVar(&clientCert, "client-cert", "", "PEM client certificate presented by HTTP notifiers, requires --client-key")
+	flag.StringVar(&clientKey, "client-key", "", "PEM private key of --client-cert")
+	flag.BoolVar(&insecureSkipVerify, "insecure-skip-verify", false, "Do not verify server certificates in HTTP notifiers")
+	flag.StringVar(&messageTemplate, "message-template", "", "Go text/template rendering the Slack message text from the event, e.g. '{{.Cmdline}} killed on {{.Hostname}}'")
+	flag.StringVar(&slackFormat, "slack-format", notifier.SlackFormatAttachment, "Slack message format: attachment or blocks")
+	flag.IntVar(&slackRetries, "slack-retry-attempts", 3, "Attempts per Slack webhook before giving up on a notification")
+	flag.IntVar(&slackBackoff, "slack-retry-backoff", 1, "Initial delay in seconds between Slack retries, doubled after each failure")
+	flag.StringVar(&discordWebhook, "discord-webhook", "", "Discord webhook URL")
+	flag.StringVar(&teamsWebhook, "teams-webhook", "", "Microsoft Teams incoming webhook URL")
+	flag.StringVar(&mattermostWebhook, "mattermost-webhook", "", "Mattermost incoming webhook URL")
+	flag.StringVar(&mattermostChannel, "mattermost-channel", "", "Mattermost channel to post to instead of the webhook's, e.g. town-square")
+	flag.StringVar(&telegramToken, "telegram-bot-token", "", "Telegram bot token, requires --telegram-chat-id")
+	flag.StringVar(&telegramChatID, "telegram-chat-id", "", "Telegram chat to send alerts to, e.g. -1001234567890 or @channel")
+	flag.StringVar(&pushoverToken, "pushover-token", "", "Pushover application token, requires --pushover-user")
+	flag.StringVar(&pushoverUser, "pushover-user", "", "Pushover user or group key to send alerts to")
+	flag.StringVar(&webhookURL, "webhook-url", "", "Generic webhook URL that receives events as JSON")
+	flag.StringVar(&webhookSecret, "webhook-secret", "", "Secret used to sign webhook requests with HMAC-SHA256")
+	flag.BoolVar(&webhookGzip, "webhook-gzip", false, "Compress webhook requests with gzip")
+	flag.BoolVar(&webhookBatch, "webhook-batch", false, "POST the OOM kills of a --batch-window or --quiet-hours-digest as one JSON array")
+	flag.StringVar(&smtpHost, "smtp-host", "", "SMTP server for email notifications")
+	flag.IntVar(&smtpPort, "smtp-port", 587, "SMTP server port, 587 requires STARTTLS")
+	flag.StringVar(&smtpUsername, "smtp-username", "", "SMTP username")
+	flag.StringVar(&smtpPassword, "smtp-password", "", "SMTP password")
+	flag.StringVar(&emailFrom, "email-from", "", "Sender address for email notifications")
+	flag.StringArrayVar(&emailTo, "email-to", nil, "Recipient address for email notifications (repeatable)")
+	flag.StringVar(&snsTopicARN, "sns-topic-arn", "", "AWS SNS topic ARN that receives events as JSON")
+	flag.StringVar(&snsRegion, "sns-region", "", "AWS region of the SNS topic, defaults to the AWS configuration")
+	flag.StringArrayVar(&kafkaBrokers, "kafka-broker", nil, "Kafka broker address, host:port (repeatable)")
+	flag.StringVar(&kafkaTopic, "kafka-topic", "", "Kafka topic that receives events as JSON")
+	flag.StringVar(&natsURL, "nats-url", "", "NATS server to publish events to, e.g. nats://127.0.0.1:4222, or a comma separated list")
+	flag.StringVar(&natsSubject, "nats-subject", "oom-notifier.events", "NATS subject that receives events as JSON")
+	flag.StringVar(&gelfAddr, "gelf-addr", "", "Graylog GELF UDP input to send events to, host:port")
+	flag.StringVar(&syslogAddr, "syslog-addr", "", "Syslog server to send events to as RFC 5424 messages, host:port")
+	flag.StringVar(&syslogNetwork, "syslog-network", notifier.SyslogUDP, "Transport of --syslog-addr: udp, tcp or tls")
+	flag.IntVar(&syslogFacility, "syslog-facility", 3, "Syslog facility code of events sent to --syslog-addr, 0 to 23")
+	flag.StringVar(&lokiURL, "loki-url", "", "Grafana Loki server to push events to, e.g. http://loki:3100")
+	flag.StringArrayVar(&lokiLabels, "loki-label", nil, "Extra Loki stream label, name=value (repeatable)")
+	flag.BoolVar(&lokiGzip, "loki-gzip", false, "Compress Loki pushes with gzip")
+	flag.BoolVar(&lokiBatch, "loki-batch", false, "Push the OOM kills of a --batch-window or --quiet-hours-digest to Loki in one request")
+	flag.StringVar(&kubeletURL, "kubelet-url", "", "Kubelet read-only API used to name the pod of cgroup OOM kills, e.g. http://127.0.0.1:10255")
+	flag.BoolVar(&dockerEnrich, "docker-enrich", false, "Add the Docker container name and image to OOM kills of containerized processes")
+	flag.StringVar(&dockerSocket, "docker-socket", docker.DefaultSocket, "Docker Engine API socket used by --docker-enrich")
+	flag.StringVar(&enrichCommand, "enrich-command", "", "Command run with /bin/sh -c for every event, given the event JSON on stdin, whose JSON object output is added to the event fields")
+	flag.IntVar(&enrichTimeout, "enrich-timeout", 5, "Seconds after which --enrich-command is killed and the event delivered without its fields")
+	flag.StringVar(&auditFile, "audit-file", "", "Append every detected event as a JSON line to this file, reopened on SIGHUP")
+	flag.StringVar(&outputSchema, "output-schema", notifier.SchemaNative, "JSON schema of the events of --webhook-url, --print-events and --audit-file: native or ecs (Elastic Common Schema)")
+	flag.StringVar(&jsonNaming, "json-naming", notifier.NamingSnake, "Naming convention of the keys of native --webhook-url, --print-events and --audit-file events: snake or camel")
+	flag.StringVar(&jsonEmptyFields, "json-empty-fields", notifier.EmptyDefault, "Empty fields of native --webhook-url, --print-events and --audit-file events: default leaves out the optional ones, omit leaves out all, keep writes all")
+	flag.StringVar(&retryQueueDir, "retry-queue-dir", "", "Directory where events that notifiers failed to deliver are kept and retried, surviving restarts")
+	flag.IntVar(&retryQueueMaxAge, "retry-queue-max-age", 86400, "Seconds after which an event in --retry-queue-dir is dropped")
+	flag.BoolVar(&protectSelfOOM, "protect-self", false, "Write --protect-self-score to our own oom_score_adj at startup so the OOM killer spares the notifier")
+	flag.IntVar(&protectSelfScore, "protect-self-score", -1000, "oom_score_adj written by --protect-self, -1000 exempts the notifier from the OOM killer")
 	flag.IntVar(&processRefresh, "process-refresh", 5, "Process cache refresh interval in seconds")
-	flag.IntVar(&kernelLogRefresh, "kernel-log-refresh", 10, "Kernel log check interval in seconds")
-	flag.StringVar(&procDir, "proc-dir", "/proc", "Path to proc directory")
-	flag.BoolVar(&debug, "debug", false, "Enable debug logging")
+	flag.IntVar(&minRefreshInterval, "min-refresh-interval", 1, "Least seconds between the starts of two full process cache refreshes (0 disables)")
+	flag.IntVar(&processScan, "process-scan", 500, "Interval in milliseconds of the lightweight scan caching new processes between refreshes, 0 disables")
+	flag.IntVar(&kernelLogRefresh, "kernel-log-refresh", 10, "Kernel log housekeeping interval in seconds")
+	flag.StringArrayVar(&procDirs, "proc-dir", nil, "Path to proc directory, repeatable to read other PID namespaces, consulted in order (default /proc)")
+	flag.StringVar(&logSource, "log-source", monitor.SourceKmsg, "Kernel log sources tried in order, comma separated: kmsg, journal, dmesg")
+	flag.StringVar(&dmesgFile, "dmesg-file", "", "File of dmesg output tailed by the dmesg log source instead of running dmesg")
+	flag.StringVar(&replayFile, "replay-file", "", "Replay kernel messages recorded from /dev/kmsg in this file instead of reading the kernel log, then exit")
+	flag.BoolVar(&replayFilter, "replay-startup-filter", false, "Skip the replayed messages logged before startup, as when reading the kernel log")
+	flag.BoolVar(&debug, "debug", false, "Enable debug logging, same as --log-level debug")
+	flag.StringVar(&logLevelName, "log-level", "info", "Minimum level logged: debug, info, warn or error")
+	flag.StringVar(&logFormat, "log-format", logger.FormatText, "Log output format: text or json")
+	flag.StringVar(&logFile, "log-file", "", "Write logs to this file instead of stdout")
+	flag.IntVar(&logMaxSize, "log-max-size", 100, "Rotate --log-file once it reaches this many megabytes, 0 disables rotation")
+	flag.BoolVar(&logSyslog, "syslog", false, "Send logs to the local syslog daemon instead of stdout")
+	flag.BoolVar(&summarizeContainers, "summarize-containers", false, "Roll up bursts of kills on a node into a single summary alert")
+	flag.IntVar(&summarizeWindow, "summarize-window", 30, "Window in seconds used to detect node-level memory pressure")
+	flag.IntVar(&summarizeThreshold, "summarize-threshold", 3, "Distinct processes killed within the window that trigger a summary")
+	flag.IntVar(&batchWindow, "batch-window", 0, "Collect OOM kills for this many seconds and send bursts as one digest (0 disables)")
+	flag.StringVar(&quietHours, "quiet-hours", "", "Daily window, HH:MM-HH:MM in --timezone, during which events below --quiet-hours-severity are suppressed")
+	flag.StringVar(&quietSeverity, "quiet-hours-severity", notifier.SeverityCritical, "Lowest severity still delivered during --quiet-hours: warning or critical")
+	flag.BoolVar(&quietDigest, "quiet-hours-digest", false, "Send the OOM kills suppressed during --quiet-hours as one digest when the window ends")
+	flag.IntVar(&summaryInterval, "summary-interval", 0, "Send a report of the OOM kills counted every this many seconds, also when there were none (0 disables)")
+	flag.BoolVar(&alertOnDropped, "alert-on-dropped", false, "Send an alert to the configured notifiers when kernel messages are dropped")
+	flag.StringArrayVar(&captureEnv, "capture-env", nil, "Environment variable to capture from the killed process (repeatable)")
+	flag.BoolVar(&watchSegfaults, "watch-segfaults", false, "Also report segfaults and traps logged by the kernel")
+	flag.BoolVar(&watchHungTasks, "watch-hung-tasks", false, "Also report hung task warnings logged by the kernel")
+	flag.StringVar(&matchersFile, "matchers-file", "", "JSON file with additional kernel message matchers")
+	flag.StringVar(&oomPattern, "oom-pattern", monitor.DefaultOOMPattern, "Regex of the kernel messages reporting an OOM kill")
+	flag.StringVar(&pidPattern, "pid-pattern", monitor.DefaultPIDPattern, "Regex capturing the victim's PID in its first group from an OOM kill message")
+	flag.BoolVar(&attachFullReport, "attach-full-report", false, "Attach the complete kernel OOM report to notifications")
+	flag.IntVar(&contextLines, "context-lines", 0, "Attach this many kernel log lines from before and after the kill to OOM notifications (0 disables)")
+	flag.StringVar(&muteFile, "mute-file", "", "File listing hostnames or key=value label selectors whose alerts are suppressed")
+	flag.StringVar(&muteURL, "mute-url", "", "URL returning hostnames or key=value label selectors whose alerts are suppressed")
+	flag.IntVar(&muteRefresh, "mute-refresh", 30, "Mute list reload interval in seconds")
+	flag.StringArrayVar(&muteHosts, "mute-host", nil, "Drop the events of hosts matching this hostname or regex, matched against the whole hostname (repeatable)")
+	flag.IntVar(&reaperWait, "reaper-wait", 0, "Seconds to wait for the oom_reaper line confirming a kill (0 disables)")
+	flag.StringArrayVar(&includeCmdlines, "include-cmdline", nil, "Only alert on processes whose command line matches this regex (repeatable)")
+	flag.StringArrayVar(&excludeCmdlines, "exclude-cmdline", nil, "Never alert on processes whose command line matches this regex, wins over --include-cmdline (repeatable)")
+	flag.StringArrayVar(&includeUIDs, "include-uid", nil, "Only alert on processes owned by this UID or user name (repeatable)")
+	flag.StringArrayVar(&excludeUIDs, "exclude-uid", nil, "Never alert on processes owned by this UID or user name, e.g. 0, wins over --include-uid (repeatable)")
+	flag.StringVar(&minRSS, "min-rss", "", "Only alert on OOM kills of processes using at least this much memory, e.g. 256MB")
+	flag.Float64Var(&sampleRate, "sample-rate", 1, "Fraction of repeated OOM events to deliver, first kills of a process are always delivered")
+	flag.BoolVar(&sampling, "sampling", false, "Deliver only the 1st, 2nd, 4th, 8th... occurrence of the same event within a burst")
+	flag.IntVar(&samplingWindow, "sampling-window", 3600, "Seconds without an occurrence ending a --sampling burst")
+	flag.IntVar(&dedupWindow, "dedup-window", 60, "Suppress repeats of the same event within this many seconds, 0 disables")
+	flag.StringVar(&dedupNormalizeRegex, "dedup-normalize-regex", "", "Regex of volatile command line parts, such as temporary paths or request IDs, replaced by "+notifier.DedupPlaceholder+" before deduplication and --alert-cooldown")
+	flag.IntVar(&flapThreshold, "flap-threshold", 0, "Escalate events repeating this many times within --flap-window to severity high, 0 disables")
+	flag.IntVar(&flapWindow, "flap-window", 600, "Sliding window in seconds over which --flap-threshold repeats are counted")
+	flag.StringVar(&flapChannel, "flap-channel", "", "Slack channel receiving escalated events instead of the routed channel")
+	flag.IntVar(&recoveryWindow, "recovery-window", 0, "Send a recovery once an escalated event has not repeated for this many seconds, 0 disables")
+	flag.IntVar(&alertCooldown, "alert-cooldown", 0, "Alert at most once per this many seconds for the same command line on a host, 0 disables")
+	flag.StringVar(&timezone, "timezone", "UTC", "IANA time zone used for times in notifications")
+	flag.StringArrayVar(&severityColors, "severity-color", nil, "Slack and Teams color of a severity, severity=color with good, warning, danger or #RRGGBB, e.g. warning=#439FE0 (repeatable)")
+	flag.StringArrayVar(&severityEmojis, "severity-emoji", nil, "Emoji leading Slack and Teams titles for a severity, severity=emoji, e.g. critical=🔥 (repeatable)")
+	flag.StringVar(&severityMapFile, "severity-map", "", "YAML or JSON file mapping event classes to their severity, Slack and Teams color and emoji, and Slack channel")
+	flag.StringVar(&shownFields, "fields", "", "Comma separated event fields shown in notifications, e.g. pid,cmdline,hostname,time (default all)")
+	flag.StringVar(&linkTemplate, "link-template", "", "Go text/template rendering a URL about the event, linked from Slack and Teams notifications, e.g. 'https://grafana.example.com/explore?host={{.Hostname}}'")
+	flag.IntVar(&maxAlertsPerMinute, "max-alerts-per-minute", 0, "Maximum alerts delivered per minute, 0 means unlimited")
+	flag.IntVar(&maxEventAge, "max-event-age", 0, "Drop events that happened more than this many seconds before they reach delivery, 0 disables")
+	flag.StringVarP(&configFile, "config", "c", "", "YAML configuration file, command line flags override its values")
+	flag.BoolVar(&checkOnly, "check-config", false, "Validate the configuration and exit")
+	flag.BoolVar(&showVersion, "version", false, "Print version information and exit")
+	flag.BoolVar(&flattenCmdline, "flatten-cmdline-spaces", true, "Only keep the space-joined command line, set to false to also keep argv boundaries")
+	flag.IntVar(&topConsumers, "top-consumers", 5, "Largest processes by RSS to list in global OOM alerts, 0 disables")
+	flag.IntVar(&includeAncestry, "include-ancestry", 0, "Ancestors of the killed process to list in alerts, 0 disables")
+	flag.BoolVar(&scanHistory, "scan-history", false, "Report recent events already in the kernel log at startup")
+	flag.IntVar(&historyWindow, "history-window", 3600, "Lookback in seconds for --scan-history")
+	flag.IntVar(&startupGrace, "startup-grace", 5, "Also report events logged up to this many seconds before startup")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on, e.g. :9090")
+	flag.StringVar(&statsdAddr, "statsd-addr", "", "StatsD server to send metrics to over UDP, e.g. localhost:8125")
+	flag.StringVar(&healthAddr, "health-addr", "", "Address to serve /healthz and /readyz on, e.g. :8080")
+	flag.StringVar(&pprofAddr, "pprof-addr", "", "Address to serve runtime profiles on at /debug/pprof/, e.g. localhost:6060")
+	flag.StringVar(&receiveAddr, "receive-addr", "", "Address to accept events POSTed by the webhook notifier of other hosts on at /events, e.g. :9095")
+	flag.StringVar(&receiveSecret, "receive-secret", "", "Secret that received events must be signed with, the --webhook-secret of the senders")
+	flag.BoolVar(&testNotification, "test-notification", false, "Send a test event through every notifier at startup, exit with an error if any fails")
+	flag.IntVar(&eventBuffer, "event-buffer", 10, "Events buffered between the monitor and the notifiers, further events are dropped")
+	flag.BoolVar(&dryRun, "dry-run", false, "Log notifications instead of sending them")
+	flag.IntVar(&deliveryInterval, "delivery-report-interval", 0, "Log the notifications sent and failed per notifier every this many seconds, 0 only logs them at shutdown")
+	flag.StringVar(&fingerprintStrip, "fingerprint-strip", notifier.DefaultFingerprintStrip, "Regex of volatile command line parts left out of event fingerprints, empty keeps command lines whole")
+	flag.IntVar(&maxCmdlineLen, "max-cmdline-len", 0, "Truncate command lines longer than this many bytes in notifications and fingerprint them by program and non-option arguments, 0 keeps them whole")
+	flag.BoolVar(&printEvents, "print-events", false, "Write every event to stdout as one JSON object per line, logging to stderr instead")
+	flag.StringVar(&outputFormat, "output", outputText, "Result of --test-notification and --replay-file runs: text in the logs, or json printed to stdout, logging to stderr instead")
+	flag.BoolVar(&once, "once", false, "Exit with status 3 after notifying the first OOM kill")
+	flag.StringVar(&stateFile, "state-file", "", "File recording the last processed kernel message, to resume after a restart")
+	flag.StringArrayVar(&cgroupWatch, "cgroup-watch", nil, "Also report OOM kills counted in the memory.events of this cgroup v2 group, e.g. /kubepods/pod1 (repeatable)")
+	flag.IntVar(&cgroupWatchInterval, "cgroup-watch-interval", 1, "Interval in seconds at which --cgroup-watch counters are read")
+	flag.Float64Var(&psiThreshold, "psi-threshold", 0, "Warn when the memory pressure avg10 stays at or above this percentage for --psi-duration, 0 disables")
+	flag.StringVar(&psiLine, "psi-line", monitor.PressureSome, "Memory pressure compared with --psi-threshold: some or full")
+	flag.IntVar(&psiDuration, "psi-duration", 30, "Seconds the memory pressure must stay above --psi-threshold before warning")
+	flag.StringVar(&psiFile, "psi-file", monitor.PressureFile, "Memory pressure file read for --psi-threshold, e.g. the memory.pressure of a cgroup")
 }
 
 func main() {
 	flag.Parse()
 
-	// Validate required parameters
-	if slackWebhook == "" {
-		fmt.Fprintf(os.Stderr, "Error: --slack-webhook is required\n")
+	// Nothing else is loaded or validated before printing the version
+	if showVersion || flag.Arg(0) == "version" {
+		fmt.Println(versionString())
+		os.Exit(0)
+	}
+
+	// Flags win over environment variables, which win over the config file
+	if err := config.ApplyEnv(flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	pinFlags(flag.CommandLine)
+	if configFile != "" {
+		if err := loadConfigFile(configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := applyNotifierOptions(flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Initialize logging before anything logs, an invalid level or format
+	// is reported by validation
+	level, _ := logLevel()
+	logOptions := logger.Options{
+		Level:   level,
+		Format:  logFormat,
+		File:    logFile,
+		MaxSize: int64(logMaxSize) * 1024 * 1024,
+		Syslog:  logSyslog,
+		Stderr:  printEvents || outputFormat == outputJSON,
+	}
+	if err := logger.Init(logOptions); err != nil {
+		logOptions.Format = logger.FormatText
+		logger.Init(logOptions)
+	}
+
+	if checkOnly {
+		os.Exit(checkConfig())
+	}
+
+	// Validate parameters
+	if problems := validateConfig(); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", problem)
+		}
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// Initialize logging
-	logger.Init(debug)
+	if outputFormat == outputJSON {
+		err := run()
+		if errors.Is(err, errNotifiedOnce) {
+			err = nil
+		} else if err != nil {
+			logger.Error("%v", err)
+		}
+		os.Exit(printSummary(err))
+	}
+	if err := run(); err != nil {
+		if errors.Is(err, errNotifiedOnce) {
+			os.Exit(onceExitStatus)
+		}
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+}
+
+// onceExitStatus is the exit status with --once after an OOM kill was
+// notified, telling it apart from a shutdown by signal.
+const onceExitStatus = 3
+
+// errNotifiedOnce is returned by run with --once after the first OOM kill
+// was notified.
+var errNotifiedOnce = errors.New("notified an OOM kill with --once")
+
+// run starts the notifiers and the monitor from the validated flags and
+// delivers events until shutdown. Errors stopping oom-notifier are returned
+// once everything started so far is closed.
+func run() error {
+	logger.Info("Starting %s", versionString())
+	logger.Debug("Configuration: slack-webhook=%v, slack-channel=%s, slack-mode=%s, slack-format=%s, process-refresh=%ds, kernel-log-refresh=%ds, proc-dir=%v, debug=%t",
+		slackWebhooks, slackChannel, slackMode, slackFormat, processRefresh, kernelLogRefresh, procDirs, debug)
+	logger.Debug("Captured environment variables: %v", captureEnv)
+	logger.Debug("Extra events: watch-segfaults=%t, watch-hung-tasks=%t", watchSegfaults, watchHungTasks)
+	logger.Debug("Summaries: summarize-containers=%t, summarize-window=%ds, summarize-threshold=%d, batch-window=%ds",
+		summarizeContainers, summarizeWindow, summarizeThreshold, batchWindow)
+
+	if protectSelfOOM {
+		protectSelf(protectSelfScore)
+	}
+
+	if err := monitor.SetDetectionPatterns(oomPattern, pidPattern); err != nil {
+		return err
+	}
+
+	// Load custom kernel message matchers
+	var matchers []monitor.Matcher
+	if matchersFile != "" {
+		logger.Debug("Loading kernel message matchers from %s", matchersFile)
+		var err error
+		matchers, err = monitor.LoadMatchers(matchersFile)
+		if err != nil {
+			return fmt.Errorf("failed to load matchers: %v", err)
+		}
+		logger.Info("Loaded %d custom kernel message matchers", len(matchers))
+	}
+
+	// Shared by the notifiers and mute URL, honors HTTP_PROXY and friends
+	tlsConfig, err := notifier.NewTLSConfig(tlsOptions())
+	if err != nil {
+		return fmt.Errorf("invalid TLS configuration: %v", err)
+	}
+	if insecureSkipVerify {
+		logger.Warn("TLS certificate verification is disabled for HTTP notifiers")
+	}
+	httpClient := notifier.NewHTTPClient(time.Duration(httpTimeout)*time.Second, tlsConfig)
+
+	// Load mute lists
+	var muteLists []*notifier.MuteList
+	if muteFile != "" {
+		logger.Debug("Watching mute file %s every %ds", muteFile, muteRefresh)
+		muteLists = append(muteLists, notifier.NewMuteFile(muteFile, time.Duration(muteRefresh)*time.Second))
+	}
+	if muteURL != "" {
+		logger.Debug("Polling mute URL %s every %ds", muteURL, muteRefresh)
+		muteLists = append(muteLists, notifier.NewMuteURL(muteURL, time.Duration(muteRefresh)*time.Second, httpClient))
+	}
+	for _, muteList := range muteLists {
+		muteList.Start()
+	}
+
+	// Cancelled on SIGINT or SIGTERM so pending retries don't hold up shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := notifier.SetTimezone(timezone); err != nil {
+		return err
+	}
+	if err := notifier.SetFingerprintStrip(fingerprintStrip); err != nil {
+		return err
+	}
+	if err := notifier.SetDedupNormalize(dedupNormalizeRegex); err != nil {
+		return err
+	}
+	notifier.SetMaxCmdlineLen(maxCmdlineLen)
+	styles, err := notifier.ParseSeverityStyles(severityColors, severityEmojis)
+	if err != nil {
+		return err
+	}
+	notifier.SetSeverityStyles(styles)
+	if severityMapFile != "" {
+		severityMap, err := notifier.LoadSeverityMap(severityMapFile)
+		if err != nil {
+			return err
+		}
+		logger.Debug("Loaded severity map for %d event classes from %s", len(severityMap), severityMapFile)
+		notifier.SetSeverityMap(severityMap)
+	}
+	selected, err := notifier.ParseFields(shownFields)
+	if err != nil {
+		return err
+	}
+	notifier.SetFields(selected)
 
-	logger.Info("Starting oom-notifier")
-	logger.Debug("Configuration: slack-webhook=%s, slack-channel=%s, process-refresh=%ds, kernel-log-refresh=%ds, proc-dir=%s, debug=%t",
-		slackWebhook, slackChannel, processRefresh, kernelLogRefresh, procDir, debug)
+	if statsdAddr != "" {
+		statsd, err := metrics.NewStatsdReporter(statsdAddr)
+		if err != nil {
+			return fmt.Errorf("failed to create statsd reporter: %v", err)
+		}
+		defer statsd.Close()
+		reporter = statsd
+		logger.Debug("Sending metrics to statsd at %s", statsdAddr)
+	}
 
-	// Create Slack notifier
-	logger.Debug("Creating Slack notifier")
-	slackNotifier := notifier.NewSlackNotifier(slackWebhook, slackChannel)
+	// Create notifiers
+	if dryRun {
+		logger.Info("Dry run: notifications are logged instead of sent")
+	}
+	notifiers, err := buildNotifiers(ctx, httpClient)
+	if err != nil {
+		return err
+	}
+	var slack *notifier.SlackNotifier
+	for _, n := range notifiers {
+		if s, ok := n.(*notifier.SlackNotifier); ok {
+			slack = s
+		}
+	}
+
+	// Notifiers holding connections flush them on shutdown
+	for _, n := range notifiers {
+		if closer, ok := n.(io.Closer); ok {
+			name := n.Name()
+			defer func() {
+				if err := closer.Close(); err != nil {
+					logger.Warn("Failed to close %s notifier: %v", name, err)
+				}
+			}()
+		}
+	}
+
+	if testNotification {
+		if err := sendTestNotification(ctx, notifiers); err != nil {
+			return fmt.Errorf("test notification failed: %v", err)
+		}
+		logger.Info("Test notification sent through %d notifier(s)", len(notifiers))
+		if outputFormat == outputJSON && replayFile == "" {
+			// The summary is meant for CI, which does not keep monitoring
+			return nil
+		}
+	}
 
 	// Create OOM monitor
+	// Replay a recording instead of reading the kernel log
+	var source monitor.KernelLogSource
+	if replayFile != "" {
+		file, err := os.Open(replayFile)
+		if err != nil {
+			return fmt.Errorf("failed to open replay file: %v", err)
+		}
+		defer file.Close()
+		logger.Info("Replaying kernel messages from %s", replayFile)
+		source = monitor.NewLineSource(file)
+	}
+
 	logger.Debug("Creating OOM monitor")
-	oomMonitor, err := monitor.NewOOMMonitor(
-		procDir,
-		time.Duration(kernelLogRefresh)*time.Second,
-		time.Duration(processRefresh)*time.Second,
-	)
+	var lookback time.Duration
+	if scanHistory {
+		lookback = time.Duration(historyWindow) * time.Second
+	}
+	// Errors the monitor keeps running after, handled by the main loop
+	monitorErrors := make(chan *monitor.MonitorError, 16)
+	oomMonitor, err := monitor.NewOOMMonitor(monitor.Options{
+		ProcDirs:           procDirs,
+		LogSources:         logSources(),
+		DmesgFile:          dmesgFile,
+		Source:             source,
+		FilterSource:       replayFilter,
+		CheckInterval:      time.Duration(kernelLogRefresh) * time.Second,
+		RefreshInterval:    time.Duration(processRefresh) * time.Second,
+		MinRefreshInterval: time.Duration(minRefreshInterval) * time.Second,
+		ScanInterval:       time.Duration(processScan) * time.Millisecond,
+		CaptureEnv:         captureEnv,
+		KeepArgs:           !flattenCmdline,
+		TopConsumers:       topConsumers,
+		Ancestry:           includeAncestry,
+		StateFile:          stateFile,
+		HistoryWindow:      lookback,
+		StartupGrace:       time.Duration(startupGrace) * time.Second,
+		WatchSegfaults:     watchSegfaults,
+		WatchHungTasks:     watchHungTasks,
+		Matchers:           matchers,
+		AttachFullReport:   attachFullReport,
+		ContextLines:       contextLines,
+		ReaperWait:         time.Duration(reaperWait) * time.Second,
+		Errors:             monitorErrors,
+	})
 	if err != nil {
-		logger.Error("Failed to create OOM monitor: %v", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to create OOM monitor: %v", err)
 	}
+	// Runs after Close, for the errors raised while stopping
+	defer drainMonitorErrors(monitorErrors)
 	defer oomMonitor.Close()
+	reportedEvents = oomMonitor
 	logger.Debug("OOM monitor created successfully")
 
+	var cgroupWatcher *monitor.CgroupWatcher
+	if len(cgroupWatch) > 0 {
+		cgroupWatcher, err = monitor.NewCgroupWatcher(cgroupWatch, time.Duration(cgroupWatchInterval)*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to watch cgroups: %v", err)
+		}
+		logger.Info("Watching OOM kill counters of cgroups %v", cgroupWatch)
+	}
+
+	var pressureWatcher *monitor.PressureWatcher
+	if psiThreshold > 0 {
+		pressureWatcher, err = monitor.NewPressureWatcher(psiFile, psiLine, psiThreshold, time.Duration(psiDuration)*time.Second)
+		if err != nil {
+			return fmt.Errorf("failed to watch memory pressure: %v", err)
+		}
+		logger.Info("Warning of memory pressure %s avg10 at or above %g%% for %ds in %s", psiLine, psiThreshold, psiDuration, psiFile)
+	}
+
+	if metricsAddr != "" {
+		registerMetrics(oomMonitor, muteLists, notifiers)
+	}
 	// Create event channel
-	logger.Debug("Creating event channel with buffer size 10")
-	eventChan := make(chan monitor.OOMEventData, 10)
+	logger.Debug("Creating event channel with buffer size %d", eventBuffer)
+	eventChan := make(chan monitor.OOMEventData, eventBuffer)
 
 	// Start OOM monitor in a goroutine
 	logger.Debug("Starting OOM monitor goroutine")
+	monitorDone := make(chan struct{})
+	monitorErr := make(chan error, 1)
 	go func() {
-		if err := oomMonitor.Start(eventChan); err != nil {
-			logger.Error("OOM monitor error: %v", err)
-			os.Exit(1)
+		defer close(monitorDone)
+		if err := oomMonitor.Start(ctx, eventChan); err != nil {
+			monitorErr <- err
+		}
+	}()
+	if cgroupWatcher != nil {
+		go cgroupWatcher.Start(ctx, eventChan)
+	}
+	if pressureWatcher != nil {
+		go pressureWatcher.Start(ctx, eventChan)
+	}
+	if replayFile != "" {
+		// Once the replay is exhausted the pipeline drains stage by stage
+		// and the main loop returns
+		go func() {
+			<-monitorDone
+			close(eventChan)
+		}()
+	}
+
+	// Set up command line and RSS filtering and deduplication, which can
+	// change when the config file is reloaded
+	filterConfig, err := newFilterSettings()
+	if err != nil {
+		return err
+	}
+	logger.Debug("Filtering events by command line: include=%v, exclude=%v, uid include=%v, exclude=%v, min-rss=%q",
+		includeCmdlines, excludeCmdlines, includeUIDs, excludeUIDs, minRSS)
+	filterUpdates := make(chan filterSettings, 1)
+
+	// Set up sampling
+	var sampler *notifier.Sampler
+	if sampleRate < 1 {
+		var err error
+		sampler, err = notifier.NewSampler(sampleRate)
+		if err != nil {
+			return fmt.Errorf("failed to create sampler: %v", err)
+		}
+		logger.Info("Sampling repeated OOM events at rate %v", sampleRate)
+	}
+
+	// Set up exponential sampling of bursts
+	var expSampler *notifier.ExponentialSampler
+	if sampling {
+		logger.Info("Sampling bursts of the same event exponentially, bursts end after %ds", samplingWindow)
+		expSampler = notifier.NewExponentialSampler(time.Duration(samplingWindow) * time.Second)
+	}
+
+	// Set up escalation of flapping services
+	var flaps *notifier.FlapDetector
+	if flapThreshold > 0 {
+		logger.Debug("Escalating events repeating %d times within %ds", flapThreshold, flapWindow)
+		flaps = notifier.NewFlapDetector(flapThreshold, time.Duration(flapWindow)*time.Second)
+		if recoveryWindow > 0 {
+			logger.Debug("Sending recoveries of escalated events quiet for %ds", recoveryWindow)
+			flaps.SetRecoveryWindow(time.Duration(recoveryWindow) * time.Second)
+		}
+	}
+
+	// Set up the per-service cooldown
+	var cooldown *notifier.Cooldown
+	if alertCooldown > 0 {
+		logger.Debug("Alerting at most once per %ds for the same command line", alertCooldown)
+		cooldown = notifier.NewCooldown(time.Duration(alertCooldown) * time.Second)
+	}
+
+	// Set up rate limiting
+	var limiter *notifier.RateLimiter
+	if maxAlertsPerMinute > 0 {
+		logger.Debug("Limiting alerts to %d per minute", maxAlertsPerMinute)
+		limiter = notifier.NewRateLimiter(maxAlertsPerMinute)
+		go reportRateLimited(limiter, time.Minute)
+	}
+
+	// Wire the event pipeline: detections are filtered, then delivered by
+	// the main loop
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	ready := events.Subscribe(bus.TopicEnriched)
+	go filterStage(events, detected, filterConfig, filterUpdates, muteLists, flaps, cooldown, expSampler, sampler, limiter)
+
+	// Record every detection in the audit log, before any filtering
+	if auditFile != "" {
+		auditLog, err := audit.Open(auditFile, eventEncoding())
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %v", err)
+		}
+		defer auditLog.Close()
+		logger.Info("Recording events in audit log %s", auditFile)
+
+		go recordAudit(auditLog, events.Subscribe(bus.TopicDetected))
+		go reopenOnHangup(auditLog)
+	}
+	// Keep the events that failed to be delivered, to retry them
+	var retryTicker <-chan time.Time
+	if retryQueueDir != "" {
+		queue, err := spool.Open(retryQueueDir, time.Duration(retryQueueMaxAge)*time.Second)
+		if err != nil {
+			return err
+		}
+		logger.Info("Queueing failed notifications in %s, %d events left to retry", retryQueueDir, queue.Len())
+		retryQueue = queue
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		retryTicker = ticker.C
+	}
+
+	// Report the kills counted every interval, as a heartbeat
+	var tally *notifier.Tally
+	var tallyTicker <-chan time.Time
+	if summaryInterval > 0 {
+		logger.Debug("Reporting OOM kill counts every %ds", summaryInterval)
+		tally = notifier.NewTally()
+		go countKills(tally, events.Subscribe(bus.TopicDetected))
+		ticker := time.NewTicker(time.Duration(summaryInterval) * time.Second)
+		defer ticker.Stop()
+		tallyTicker = ticker.C
+	}
+
+	var pods *kube.Resolver
+	if kubeletURL != "" {
+		logger.Debug("Resolving pods of memcg kills through the kubelet at %s", kubeletURL)
+		pods = kube.NewResolver(kubeletURL)
+	}
+	var containers *docker.Client
+	if dockerEnrich {
+		logger.Debug("Resolving Docker containers of OOM kills through %s", dockerSocket)
+		containers = docker.NewClient(dockerSocket)
+	}
+	var hook *enrich.Command
+	if enrichCommand != "" {
+		logger.Debug("Enriching events with %q", enrichCommand)
+		hook = enrich.NewCommand(enrichCommand, time.Duration(enrichTimeout)*time.Second)
+	}
+	var mutes *notifier.HostMutes
+	if len(muteHosts) > 0 {
+		logger.Debug("Dropping the events of hosts matching %v", muteHosts)
+		if mutes, err = notifier.NewHostMutes(muteHosts); err != nil {
+			return err
+		}
+	}
+	go publishDetections(eventChan, events, mutes, pods, containers, hook)
+
+	// Serve the HTTP endpoints once received events have a pipeline to go to
+	for _, server := range startServers(metricsAddr, healthAddr, pprofAddr, receiveAddr, oomMonitor.Ready, oomMonitor, receiveHandler(events, receiveSecret, mutes)) {
+		defer server.Close()
+	}
+
+	// Set up node-level summaries
+	var summarizer *notifier.Summarizer
+	var summaryTimer <-chan time.Time
+	if summarizeContainers {
+		logger.Debug("Creating summarizer with window %ds and threshold %d", summarizeWindow, summarizeThreshold)
+		summarizer = notifier.NewSummarizer(time.Duration(summarizeWindow)*time.Second, summarizeThreshold)
+	}
+
+	// Set up digests of bursts
+	var batcher *notifier.Batcher
+	var batchTimer <-chan time.Time
+	if batchWindow > 0 {
+		logger.Debug("Creating batcher with window %ds", batchWindow)
+		batcher = notifier.NewBatcher(time.Duration(batchWindow) * time.Second)
+	}
+
+	// Hold back low-severity events during quiet hours
+	var quiet *notifier.QuietHours
+	var quietTimer <-chan time.Time
+	if quietHours != "" {
+		logger.Debug("Suppressing events below %s during quiet hours %s", quietSeverity, quietHours)
+		if quiet, err = notifier.NewQuietHours(quietHours, quietSeverity); err != nil {
+			return err
 		}
+	}
+
+	// Log the notifications sent so far every interval, and at shutdown
+	defer func() {
+		logger.Info("Notifications sent: %s", deliveries)
 	}()
+	var deliveryTicker <-chan time.Time
+	if deliveryInterval > 0 {
+		ticker := time.NewTicker(time.Duration(deliveryInterval) * time.Second)
+		defer ticker.Stop()
+		deliveryTicker = ticker.C
+	}
 
-	// Set up signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	// Watch for kernel messages dropped by the reader
+	var dropTicker <-chan time.Time
+	var alertedDrops uint64
+	if alertOnDropped {
+		ticker := time.NewTicker(time.Duration(kernelLogRefresh) * time.Second)
+		defer ticker.Stop()
+		dropTicker = ticker.C
+	}
+
+	// Reload the config file on SIGHUP
+	var hangup chan os.Signal
+	if configFile != "" {
+		hangup = make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+	}
 
 	// Main event loop
 	logger.Info("oom-notifier started successfully, entering main event loop")
+	var replayed, notified bool
 	for {
+		if once && notified {
+			logger.Info("OOM kill notified, exiting because of --once")
+			stop()
+			<-monitorDone
+			return errNotifiedOnce
+		}
+		// A finished replay still waits for the open summary and batch
+		// windows, but not for quiet hours to end
+		if replayed && summaryTimer == nil && batchTimer == nil {
+			if quietTimer != nil {
+				quietTimer = nil
+				events := quiet.Flush()
+				logger.Info("Replay finished during quiet hours, sending the %d OOM kills held back", len(events))
+				sendBatch(ctx, notifiers, events)
+			}
+			logger.Info("Replay of %s finished", replayFile)
+			return nil
+		}
+
 		select {
-		case event := <-eventChan:
-			logger.Info("OOM event received: PID=%s, Command=%s", event.PID, event.Cmdline)
-
-			// Convert to notifier event format
-			notifierEvent := notifier.OOMEvent{
-				Cmdline:  event.Cmdline,
-				PID:      event.PID,
-				Hostname: event.Hostname,
-				Kernel:   event.Kernel,
-				Time:     event.Time,
+		case notifierEvent, ok := <-ready:
+			if !ok {
+				ready = nil
+				replayed = true
+				continue
+			}
+			if alreadyReported(notifierEvent) {
+				logger.Info("Skipping %s event for %s already reported before a restart", notifierEvent.Kind, notifierEvent.Cmdline)
+				continue
+			}
+			deliveredEvents.Add(1)
+			// Checked before batching, which delays events on purpose
+			if maxEventAge > 0 && dropStale(notifierEvent, time.Duration(maxEventAge)*time.Second) {
+				continue
+			}
+			if quiet != nil && quiet.Suppresses(notifierEvent) {
+				if !quietDigest || notifierEvent.Kind != monitor.KindOOM {
+					logger.Info("Suppressing %s %s event for %s during quiet hours", notifierEvent.Severity, notifierEvent.Kind, notifierEvent.Cmdline)
+					continue
+				}
+				if quiet.Add(notifierEvent) {
+					logger.Debug("Holding OOM kills until quiet hours end in %v", quiet.Remaining())
+					quietTimer = time.After(quiet.Remaining())
+				}
+				continue
+			}
+			if summarizer != nil && notifierEvent.Kind == monitor.KindOOM {
+				if summarizer.Add(notifierEvent) {
+					logger.Debug("Opened summary window for %v", summarizer.Window())
+					summaryTimer = time.After(summarizer.Window())
+				}
+				continue
+			}
+			if batcher != nil && notifierEvent.Kind == monitor.KindOOM {
+				if batcher.Add(notifierEvent) {
+					logger.Debug("Opened batch window for %v", batcher.Window())
+					batchTimer = time.After(batcher.Window())
+				}
+				continue
 			}
 
-			logger.Debug("Sending Slack notification")
-			// Send notification
-			if err := slackNotifier.Notify(notifierEvent); err != nil {
-				logger.Error("Failed to send Slack notification: %v", err)
+			// Only a delivered OOM kill ends a --once run
+			if sendNotification(ctx, notifiers, notifierEvent) && notifierEvent.Kind == monitor.KindOOM {
+				notified = true
+			}
+
+		case <-summaryTimer:
+			summaryTimer = nil
+			notified = sendSummarized(ctx, notifiers, summarizer) || notified
+
+		case <-batchTimer:
+			batchTimer = nil
+			events := batcher.Flush()
+			logger.Debug("Batch window closed with %d events", len(events))
+			notified = sendBatch(ctx, notifiers, events) || notified
+
+		case <-quietTimer:
+			quietTimer = nil
+			events := quiet.Flush()
+			logger.Info("Quiet hours ended, sending the %d OOM kills held back", len(events))
+			notified = sendBatch(ctx, notifiers, events) || notified
+
+		case <-tallyTicker:
+			report := tally.Take()
+			logger.Info("Sending report of %d OOM kills since %s", report.Total, report.Start.Format(time.RFC3339))
+			sendText(ctx, notifiers, notifier.TallyText(report))
+
+		case <-deliveryTicker:
+			logger.Info("Notifications sent: %s", deliveries)
+
+		case <-dropTicker:
+			dropped := oomMonitor.DroppedEntries()
+			if dropped <= alertedDrops {
+				continue
+			}
+			text := fmt.Sprintf("oom-notifier dropped %d kernel messages", dropped-alertedDrops)
+			alertedDrops = dropped
+			logger.Warn("%s, sending alert", text)
+			sendText(ctx, notifiers, text)
+
+		case <-retryTicker:
+			retryQueue.Retry(func(event notifier.OOMEvent, names []string) []string {
+				return retryNotification(ctx, notifiers, event, names)
+			}, func(text string, names []string) []string {
+				return retryText(ctx, notifiers, text, names)
+			})
+
+		case <-hangup:
+			applyReload(slack, filterUpdates)
+
+		case err := <-monitorErr:
+			return fmt.Errorf("OOM monitor error: %v", err)
+
+		case err := <-monitorErrors:
+			handleMonitorError(err)
+
+		case <-ctx.Done():
+			logger.Info("Received shutdown signal, shutting down...")
+			flushOnShutdown(notifiers, summarizer, batcher, quiet)
+			// Let the monitor stop its goroutines before it is closed
+			<-monitorDone
+			return nil
+		}
+	}
+}
+
+// shutdownFlushTimeout bounds the delivery of the events still held in
+// summary, batch and quiet hours windows at shutdown.
+const shutdownFlushTimeout = 10 * time.Second
+
+// flushOnShutdown delivers the events held by summarizer, batcher and
+// quiet, any of which may be nil, rather than lose them. The shutdown has
+// already cancelled the context of the main loop, so they get their own.
+func flushOnShutdown(notifiers []notifier.Notifier, summarizer *notifier.Summarizer, batcher *notifier.Batcher, quiet *notifier.QuietHours) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+
+	if summarizer != nil {
+		sendSummarized(ctx, notifiers, summarizer)
+	}
+	if batcher != nil {
+		sendBatch(ctx, notifiers, batcher.Flush())
+	}
+	if quiet != nil {
+		if events := quiet.Flush(); len(events) > 0 {
+			logger.Info("Sending the %d OOM kills held back by quiet hours before shutting down", len(events))
+			sendBatch(ctx, notifiers, events)
+		}
+	}
+}
+
+// sendSummarized flushes summarizer and delivers its summaries and the
+// events left out of them. It reports whether anything was delivered.
+func sendSummarized(ctx context.Context, notifiers []notifier.Notifier, summarizer *notifier.Summarizer) bool {
+	events, summaries := summarizer.Flush()
+	logger.Debug("Summary window closed: %d individual events, %d summaries", len(events), len(summaries))
+	delivered := false
+	for _, summary := range summaries {
+		logger.Info("Node %s under memory pressure: %s killed", summary.Hostname, strings.Join(summary.Victims, ", "))
+		delivered = sendSummary(ctx, notifiers, summary) || delivered
+	}
+	for _, event := range events {
+		delivered = sendNotification(ctx, notifiers, event) || delivered
+	}
+	return delivered
+}
+
+// sendBatch delivers the events of a closed batch window or quiet hours, a
+// single event on its own and several as a digest. It reports whether
+// anything was delivered.
+func sendBatch(ctx context.Context, notifiers []notifier.Notifier, events []notifier.OOMEvent) bool {
+	switch len(events) {
+	case 0:
+		return false
+	case 1:
+		return sendNotification(ctx, notifiers, events[0])
+	}
+	logger.Info("Sending digest of %d OOM kills", len(events))
+	return sendDigest(ctx, notifiers, notifier.NewDigest(events))
+}
+
+// sendNotification delivers event through every notifier, except those that
+// delivered it before. With --retry-queue-dir, the event is queued for the
+// notifiers that failed. It reports whether any notifier has delivered the
+// event.
+func sendNotification(ctx context.Context, notifiers []notifier.Notifier, event notifier.OOMEvent) bool {
+	var failed []string
+	for _, n := range notifiers {
+		if alreadyDelivered(event, n.Name()) {
+			logger.Info("%s event for %s was already delivered by %s, skipping", event.Kind, event.Cmdline, n.Name())
+			continue
+		}
+		logger.Debug("Sending %s notification", n.Name())
+		start := time.Now()
+		if err := notify(ctx, n, event); err != nil {
+			logger.Error("Failed to send %s notification: %v", n.Name(), err)
+			countNotification(n, start, err)
+			failed = append(failed, n.Name())
+		} else {
+			logger.Info("%s notification sent successfully", n.Name())
+			countNotification(n, start, nil)
+			markDelivered(event, n.Name())
+		}
+	}
+
+	queued := queueRetry(event, failed)
+	delivered := len(failed) < len(notifiers)
+	// The retry queue survives restarts and delivers the rest
+	if delivered || queued {
+		markReported(event)
+	}
+	return delivered
+}
+
+// queueRetry queues event for the notifiers named in failed, when there are
+// any and --retry-queue-dir is set, and reports whether it was queued.
+func queueRetry(event notifier.OOMEvent, failed []string) bool {
+	if retryQueue == nil || len(failed) == 0 {
+		return false
+	}
+	if err := retryQueue.Add(event, failed); err != nil {
+		logger.Error("Failed to queue %s event for %s: %v", event.Kind, event.Cmdline, err)
+		return false
+	}
+	logger.Info("Queued %s event for %s to retry %s", event.Kind, event.Cmdline, strings.Join(failed, ", "))
+	return true
+}
+
+// notify delivers event through n, giving up once ctx is done when n
+// supports cancellation.
+func notify(ctx context.Context, n notifier.Notifier, event notifier.OOMEvent) error {
+	if cn, ok := n.(notifier.ContextNotifier); ok {
+		return cn.NotifyContext(ctx, event)
+	}
+	return n.Notify(event)
+}
+
+// notifyText delivers text through tn, giving up once ctx is done when tn
+// supports cancellation.
+func notifyText(ctx context.Context, tn notifier.TextNotifier, text string) error {
+	if cn, ok := tn.(notifier.TextContextNotifier); ok {
+		return cn.NotifyTextContext(ctx, text)
+	}
+	return tn.NotifyText(text)
+}
+
+// notifySummary delivers summary through sn, giving up once ctx is done when
+// sn supports cancellation.
+func notifySummary(ctx context.Context, sn notifier.SummaryNotifier, summary notifier.NodeSummary) error {
+	if cn, ok := sn.(notifier.SummaryContextNotifier); ok {
+		return cn.NotifySummaryContext(ctx, summary)
+	}
+	return sn.NotifySummary(summary)
+}
+
+// notifyDigest delivers digest through dn, giving up once ctx is done when dn
+// supports cancellation.
+func notifyDigest(ctx context.Context, dn notifier.DigestNotifier, digest notifier.Digest) error {
+	if cn, ok := dn.(notifier.DigestContextNotifier); ok {
+		return cn.NotifyDigestContext(ctx, digest)
+	}
+	return dn.NotifyDigest(digest)
+}
+
+// staleEvents counts the events dropped by dropStale.
+var staleEvents int
+
+// dropStale reports whether event happened more than maxAge ago, counting
+// and logging it as dropped when it did.
+func dropStale(event notifier.OOMEvent, maxAge time.Duration) bool {
+	age := time.Since(time.UnixMilli(event.Time))
+	if event.Test || age <= maxAge {
+		return false
+	}
+	staleEvents++
+	metrics.StaleEvents.Inc()
+	logger.Warn("Dropping %s event for %s from %v ago, older than --max-event-age (%d stale events dropped)",
+		event.Kind, event.Cmdline, age.Round(time.Second), staleEvents)
+	return true
+}
+
+// retryNotification delivers a queued event through the notifiers named in
+// names and returns those that failed again. Notifiers no longer configured
+// are left out, and so are those that delivered the event already, e.g.
+// when a crash kept the queue from recording it.
+func retryNotification(ctx context.Context, notifiers []notifier.Notifier, event notifier.OOMEvent, names []string) []string {
+	var failed []string
+	for _, name := range names {
+		for _, n := range notifiers {
+			if n.Name() != name {
+				continue
+			}
+			if alreadyDelivered(event, name) {
+				logger.Info("Queued %s event for %s was already delivered by %s, skipping", event.Kind, event.Cmdline, name)
+				break
+			}
+			start := time.Now()
+			err := notify(ctx, n, event)
+			countNotification(n, start, err)
+			if err != nil {
+				logger.Debug("Retry of %s notification failed: %v", name, err)
+				failed = append(failed, name)
 			} else {
-				logger.Info("Slack notification sent successfully")
+				logger.Info("Queued %s notification sent successfully", name)
+				markDelivered(event, name)
 			}
+			break
+		}
+	}
+	return failed
+}
 
-		case sig := <-sigChan:
-			logger.Info("Received signal %v, shutting down...", sig)
-			return
+// sendTestNotification sends a synthetic event, marked as a test, through
+// every notifier and returns the failures.
+func sendTestNotification(ctx context.Context, notifiers []notifier.Notifier) error {
+	hostname, _ := os.Hostname()
+	event := notifier.OOMEvent{
+		Kind:     monitor.KindOOM,
+		Message:  "oom-notifier test notification, no process was killed",
+		Cmdline:  "oom-notifier --test-notification",
+		PID:      strconv.Itoa(os.Getpid()),
+		Hostname: hostname,
+		Kernel:   monitor.KernelVersion(),
+		Time:     time.Now().UnixMilli(),
+		Test:     true,
+	}
+
+	var errs []error
+	for _, n := range notifiers {
+		logger.Debug("Sending %s test notification", n.Name())
+		start := time.Now()
+		err := notify(ctx, n, event)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", n.Name(), err))
+		}
+		countNotification(n, start, err)
+	}
+	return errors.Join(errs...)
+}
+
+// registerMetrics registers the metrics read from oomMonitor, the mute lists
+// and the streaming notifiers at every scrape.
+func registerMetrics(oomMonitor *monitor.OOMMonitor, muteLists []*notifier.MuteList, notifiers []notifier.Notifier) {
+	metrics.RegisterGauge("oom_process_cache_size", "Processes in the process cache.", func() float64 {
+		return float64(oomMonitor.CachedProcesses())
+	})
+	for _, muteList := range muteLists {
+		muteList := muteList
+		metrics.RegisterCounterFunc("oom_mute_list_suppressed_total", "Events suppressed by a mute list, by source.", func() float64 {
+			return float64(muteList.Suppressed())
+		}, "source", muteList.Source())
+	}
+	// Streaming notifiers reconnect in the background
+	for _, n := range notifiers {
+		if stream, ok := n.(interface{ Connected() bool }); ok {
+			metrics.RegisterGauge("oom_stream_connected", "Whether a streaming notifier is connected to its broker.", func() float64 {
+				if stream.Connected() {
+					return 1
+				}
+				return 0
+			}, "notifier", n.Name())
+		}
+	}
+	metrics.RegisterCounterFunc("oom_dropped_events_total", "Events dropped because the event buffer was full.", func() float64 {
+		return float64(oomMonitor.DroppedEvents())
+	})
+	metrics.RegisterCounterFunc("oom_dropped_kernel_messages_total", "Kernel messages dropped because the kernel log reader buffer was full.", func() float64 {
+		return float64(oomMonitor.DroppedEntries())
+	})
+}
+
+// reporter receives measurements pushed to --statsd-addr. It discards them
+// when no address is set.
+var reporter metrics.Reporter = metrics.NopReporter{}
+
+// retryQueue keeps the events notifiers failed to deliver when
+// --retry-queue-dir is set.
+var retryQueue *spool.Queue
+
+// reportedEvents records the IDs of the events delivered in the
+// --state-file, so that a restart reading their kernel messages again, e.g.
+// with --scan-history, does not send them twice, and the notifiers that
+// delivered each, so that retries never repeat a delivery. Nil in tests.
+var reportedEvents interface {
+	Reported(id string) bool
+	MarkReported(id string)
+	Delivered(id, notifier string) bool
+	MarkDelivered(id, notifier string)
+}
+
+// alreadyReported reports whether event was delivered before, by this run
+// or a previous one.
+func alreadyReported(event notifier.OOMEvent) bool {
+	return reportedEvents != nil && reportedEvents.Reported(event.ID)
+}
+
+// markReported records events as delivered.
+func markReported(events ...notifier.OOMEvent) {
+	if reportedEvents == nil {
+		return
+	}
+	for _, event := range events {
+		reportedEvents.MarkReported(event.ID)
+	}
+}
+
+// alreadyDelivered reports whether event was delivered by the notifier named
+// name before, by this run or a previous one.
+func alreadyDelivered(event notifier.OOMEvent, name string) bool {
+	return reportedEvents != nil && reportedEvents.Delivered(event.ID, name)
+}
+
+// markDelivered records event as delivered by the notifier named name.
+func markDelivered(event notifier.OOMEvent, name string) {
+	if reportedEvents != nil {
+		reportedEvents.MarkDelivered(event.ID, name)
+	}
+}
+
+// deliveries counts the notifications of each notifier for the summary
+// logged at shutdown and every --delivery-report-interval.
+var deliveries = notifier.NewDeliveries()
+
+// countNotification records the result of a delivery started at start in the
+// metrics and deliveries.
+func countNotification(n notifier.Notifier, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	deliveries.Record(n.Name(), err)
+	metrics.Notifications.Inc(n.Name(), result)
+	reporter.Notification(n.Name(), result, time.Since(start))
+}
+
+// sendSummary delivers a node summary to the notifiers that can render one,
+// falling back to the individual events for the others. With
+// --retry-queue-dir, the events of a failed summary are queued one by one
+// for the notifiers that failed. It reports whether any notifier delivered
+// any of the events.
+func sendSummary(ctx context.Context, notifiers []notifier.Notifier, summary notifier.NodeSummary) bool {
+	failures := newGroupFailures(summary.Events)
+	for _, n := range notifiers {
+		sn, ok := n.(notifier.SummaryNotifier)
+		if !ok {
+			sendEach(ctx, n, summary.Events, failures)
+			continue
+		}
+
+		start := time.Now()
+		err := notifySummary(ctx, sn, summary)
+		if err != nil {
+			logger.Error("Failed to send %s summary notification: %v", n.Name(), err)
+		} else {
+			logger.Info("%s summary notification sent successfully", n.Name())
+		}
+		failures.record(n.Name(), -1, err)
+		countNotification(n, start, err)
+	}
+	return failures.settle()
+}
+
+// sendDigest delivers a digest to the notifiers that can render one, as text
+// to those that only support text, and as individual events to the others.
+// Like sendSummary, it queues failed events and reports whether anything was
+// delivered.
+func sendDigest(ctx context.Context, notifiers []notifier.Notifier, digest notifier.Digest) bool {
+	failures := newGroupFailures(digest.Events)
+	for _, n := range notifiers {
+		var err error
+		start := time.Now()
+		switch dn := n.(type) {
+		case notifier.DigestNotifier:
+			err = notifyDigest(ctx, dn, digest)
+		case notifier.BatchNotifier:
+			err = dn.NotifyBatch(ctx, digest.Events)
+		case notifier.TextNotifier:
+			err = notifyText(ctx, dn, notifier.DigestText(digest))
+		default:
+			sendEach(ctx, n, digest.Events, failures)
+			continue
+		}
+
+		if err != nil {
+			logger.Error("Failed to send %s digest notification: %v", n.Name(), err)
+		} else {
+			logger.Info("%s digest notification sent successfully", n.Name())
+		}
+		failures.record(n.Name(), -1, err)
+		countNotification(n, start, err)
+	}
+	return failures.settle()
+}
+
+// groupFailures collects the results of delivering a summary or digest,
+// which bundles events, so that each event is queued for the notifiers that
+// failed to deliver it, alone or within the bundle.
+type groupFailures struct {
+	events    []notifier.OOMEvent
+	failed    [][]string
+	delivered bool
+}
+
+func newGroupFailures(events []notifier.OOMEvent) *groupFailures {
+	return &groupFailures{events: events, failed: make([][]string, len(events))}
+}
+
+// record notes the result of the delivery by the notifier named name of the
+// event at index i, or of every event when i is negative.
+func (g *groupFailures) record(name string, i int, err error) {
+	for j, event := range g.events {
+		if i >= 0 && j != i {
+			continue
+		}
+		if err != nil {
+			g.failed[j] = append(g.failed[j], name)
+		} else {
+			g.delivered = true
+			markDelivered(event, name)
+		}
+	}
+}
+
+// settle queues the failed events and marks the events as reported once
+// anything was delivered, which it reports.
+func (g *groupFailures) settle() bool {
+	for i, event := range g.events {
+		queueRetry(event, g.failed[i])
+	}
+	if g.delivered {
+		markReported(g.events...)
+	}
+	return g.delivered
+}
+
+// sendEach delivers events one by one through n, recording the results in
+// failures.
+func sendEach(ctx context.Context, n notifier.Notifier, events []notifier.OOMEvent, failures *groupFailures) {
+	for i, event := range events {
+		start := time.Now()
+		err := notify(ctx, n, event)
+		if err != nil {
+			logger.Error("Failed to send %s notification: %v", n.Name(), err)
+		}
+		failures.record(n.Name(), i, err)
+		countNotification(n, start, err)
+	}
+}
+
+// sendText delivers a plain text message to the notifiers that support one.
+// With --retry-queue-dir, it is queued for the notifiers that failed.
+func sendText(ctx context.Context, notifiers []notifier.Notifier, text string) {
+	var failed []string
+	for _, n := range notifiers {
+		tn, ok := n.(notifier.TextNotifier)
+		if !ok {
+			continue
+		}
+		start := time.Now()
+		err := notifyText(ctx, tn, text)
+		if err != nil {
+			logger.Error("Failed to send %s text notification: %v", n.Name(), err)
+			failed = append(failed, n.Name())
+		}
+		countNotification(n, start, err)
+	}
+
+	if retryQueue != nil && len(failed) > 0 {
+		if err := retryQueue.AddText(text, failed); err != nil {
+			logger.Error("Failed to queue text notification: %v", err)
+		} else {
+			logger.Info("Queued text notification to retry %s", strings.Join(failed, ", "))
+		}
+	}
+}
+
+// retryText delivers a queued text message through the notifiers named in
+// names and returns those that failed again.
+func retryText(ctx context.Context, notifiers []notifier.Notifier, text string, names []string) []string {
+	var failed []string
+	for _, name := range names {
+		for _, n := range notifiers {
+			tn, ok := n.(notifier.TextNotifier)
+			if !ok || n.Name() != name {
+				continue
+			}
+			start := time.Now()
+			err := notifyText(ctx, tn, text)
+			countNotification(n, start, err)
+			if err != nil {
+				logger.Debug("Retry of %s text notification failed: %v", name, err)
+				failed = append(failed, name)
+			} else {
+				logger.Info("Queued %s text notification sent successfully", name)
+			}
+			break
 		}
 	}
+	return failed
 }
@@ -0,0 +1,789 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/monitor"
+	"github.com/oom-notifier/go/internal/notifier"
+	"github.com/oom-notifier/go/internal/spool"
+)
+
+// fakeNotifier records the events it is given, failing while err is set.
+type fakeNotifier struct {
+	name string
+
+	mu     sync.Mutex
+	err    error
+	events []notifier.OOMEvent
+}
+
+func (f *fakeNotifier) Name() string {
+	return f.name
+}
+
+func (f *fakeNotifier) Notify(event notifier.OOMEvent) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.events = append(f.events, event)
+	return nil
+}
+
+func (f *fakeNotifier) sent() []notifier.OOMEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]notifier.OOMEvent(nil), f.events...)
+}
+
+// fakeLedger is an in-memory reportedEvents.
+type fakeLedger struct {
+	mu        sync.Mutex
+	reported  map[string]bool
+	delivered map[string]bool
+}
+
+func (l *fakeLedger) Reported(id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reported[id]
+}
+
+func (l *fakeLedger) MarkReported(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reported == nil {
+		l.reported = make(map[string]bool)
+	}
+	l.reported[id] = true
+}
+
+func (l *fakeLedger) Delivered(id, notifier string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.delivered[id+"/"+notifier]
+}
+
+func (l *fakeLedger) MarkDelivered(id, notifier string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.delivered == nil {
+		l.delivered = make(map[string]bool)
+	}
+	l.delivered[id+"/"+notifier] = true
+}
+
+// useLedger sets reportedEvents for the duration of the test.
+func useLedger(t *testing.T) *fakeLedger {
+	t.Helper()
+	ledger := &fakeLedger{}
+	reportedEvents = ledger
+	t.Cleanup(func() { reportedEvents = nil })
+	return ledger
+}
+
+func testKill(id string) notifier.OOMEvent {
+	return notifier.OOMEvent{ID: id, Kind: "oom", PID: "4242", Cmdline: "stress --vm 1", Hostname: "node-1"}
+}
+
+func TestSendNotificationMarksDeliveredEventsReported(t *testing.T) {
+	ledger := useLedger(t)
+	ok, failing := &fakeNotifier{name: "ok"}, &fakeNotifier{name: "failing", err: errors.New("down")}
+
+	sendNotification(context.Background(), []notifier.Notifier{ok, failing}, testKill("partly"))
+	if !ledger.Reported("partly") {
+		t.Error("event delivered by one notifier not marked reported")
+	}
+
+	sendNotification(context.Background(), []notifier.Notifier{failing}, testKill("failed"))
+	if ledger.Reported("failed") {
+		t.Error("event no notifier delivered marked reported")
+	}
+	if !alreadyReported(testKill("partly")) || alreadyReported(testKill("failed")) {
+		t.Error("alreadyReported does not follow the ledger")
+	}
+}
+
+func TestSendSummaryAndDigestMarkEventsReported(t *testing.T) {
+	ledger := useLedger(t)
+	ok := &fakeNotifier{name: "ok"}
+	events := []notifier.OOMEvent{testKill("a"), testKill("b")}
+
+	sendSummary(context.Background(), []notifier.Notifier{ok}, notifier.NodeSummary{Hostname: "node-1", Events: events})
+	if !ledger.Reported("a") || !ledger.Reported("b") {
+		t.Error("events of a delivered summary not marked reported")
+	}
+
+	sendDigest(context.Background(), []notifier.Notifier{ok}, notifier.NewDigest([]notifier.OOMEvent{testKill("c"), testKill("d")}))
+	if !ledger.Reported("c") || !ledger.Reported("d") {
+		t.Error("events of a delivered digest not marked reported")
+	}
+}
+
+// crashingNotifier stops the goroutine delivering through it, as if the
+// process died right after the notifiers before it were sent the event.
+type crashingNotifier struct{}
+
+func (crashingNotifier) Name() string { return "crashing" }
+
+func (crashingNotifier) Notify(notifier.OOMEvent) error {
+	runtime.Goexit()
+	return nil
+}
+
+// startRun sets reportedEvents to a monitor keeping its state in path, as
+// one run of oom-notifier.
+func startRun(t *testing.T, path string) *monitor.OOMMonitor {
+	t.Helper()
+	m, err := monitor.NewOOMMonitor(monitor.Options{
+		Source:        monitor.NewLineSource(strings.NewReader("")),
+		ProcFS:        []fs.FS{fstest.MapFS{"sys/kernel/pid_max": {Data: []byte("32768\n")}}},
+		CheckInterval: time.Second,
+		StateFile:     path,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	reportedEvents = m
+	t.Cleanup(func() {
+		reportedEvents = nil
+		m.Close()
+	})
+	return m
+}
+
+func TestNoDuplicateDeliveryAfterCrashDuringFanOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	event := testKill("fan-out")
+	first, second := &fakeNotifier{name: "first"}, &fakeNotifier{name: "second"}
+
+	// The first run delivers through first and dies before second
+	startRun(t, path)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sendNotification(context.Background(), []notifier.Notifier{first, crashingNotifier{}, second}, event)
+	}()
+	<-done
+
+	// The restart reads the kill again and delivers it
+	run := startRun(t, path)
+	if run.Reported(event.ID) {
+		t.Fatal("event of the crashed run reported, the restart would skip second")
+	}
+	sendNotification(context.Background(), []notifier.Notifier{first, second}, event)
+
+	if n := len(first.sent()); n != 1 {
+		t.Errorf("first received the event %d times, want once", n)
+	}
+	if n := len(second.sent()); n != 1 {
+		t.Errorf("second received the event %d times, want once", n)
+	}
+	if !run.Reported(event.ID) {
+		t.Error("event delivered by every notifier not reported")
+	}
+}
+
+func TestNoDuplicateDeliveryAfterCrashBeforeRetryAck(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	event := testKill("retried")
+	ok, flaky := &fakeNotifier{name: "ok"}, &fakeNotifier{name: "flaky", err: errors.New("down")}
+	notifiers := []notifier.Notifier{ok, flaky}
+
+	queue := useRetryQueue(t, filepath.Join(dir, "queue"))
+	startRun(t, path)
+	sendNotification(context.Background(), notifiers, event)
+	if queue.Len() != 1 {
+		t.Fatalf("%d queued events, want the one flaky failed", queue.Len())
+	}
+
+	// flaky recovers and is sent the queued event, then the run dies
+	// before the queue removed it
+	flaky.mu.Lock()
+	flaky.err = nil
+	flaky.mu.Unlock()
+	if failed := retryNotification(context.Background(), notifiers, event, []string{"flaky"}); len(failed) != 0 {
+		t.Fatalf("retry failed for %v", failed)
+	}
+
+	// The restart finds the event still queued for flaky
+	startRun(t, path)
+	if failed := retryNotification(context.Background(), notifiers, event, []string{"flaky"}); len(failed) != 0 {
+		t.Fatalf("retry after restart failed for %v", failed)
+	}
+	// and reads the kill again
+	sendNotification(context.Background(), notifiers, event)
+
+	if n := len(ok.sent()); n != 1 {
+		t.Errorf("ok received the event %d times, want once", n)
+	}
+	if n := len(flaky.sent()); n != 1 {
+		t.Errorf("flaky received the event %d times, want once", n)
+	}
+}
+
+// fakeChat is a fakeNotifier also rendering summaries and text, failing
+// them along with events.
+type fakeChat struct {
+	fakeNotifier
+	texts []string
+}
+
+func (f *fakeChat) NotifySummary(notifier.NodeSummary) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+func (f *fakeChat) NotifyText(text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.texts = append(f.texts, text)
+	return nil
+}
+
+// useRetryQueue sets retryQueue to a queue in dir.
+func useRetryQueue(t *testing.T, dir string) *spool.Queue {
+	t.Helper()
+	queue, err := spool.Open(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retryQueue = queue
+	t.Cleanup(func() { retryQueue = nil })
+	return queue
+}
+
+func TestFailedSummaryAndDigestAreQueuedAsEvents(t *testing.T) {
+	dir := t.TempDir()
+	queue := useRetryQueue(t, dir)
+	chat := &fakeChat{fakeNotifier: fakeNotifier{name: "chat", err: errors.New("down")}}
+	plain := &fakeNotifier{name: "plain"}
+	notifiers := []notifier.Notifier{chat, plain}
+
+	sendSummary(context.Background(), notifiers, notifier.NodeSummary{Hostname: "node-1", Events: []notifier.OOMEvent{testKill("a"), testKill("b")}})
+	sendDigest(context.Background(), notifiers, notifier.NewDigest([]notifier.OOMEvent{testKill("c")}))
+	if queue.Len() != 3 {
+		t.Fatalf("%d events queued, want the 3 chat failed", queue.Len())
+	}
+
+	// A restart retries the queue right away
+	chat.mu.Lock()
+	chat.err = nil
+	chat.mu.Unlock()
+	queue = useRetryQueue(t, dir)
+	var retried []string
+	queue.Retry(func(event notifier.OOMEvent, names []string) []string {
+		if len(names) != 1 || names[0] != "chat" {
+			t.Errorf("event %s queued for %v, want chat only", event.ID, names)
+		}
+		retried = append(retried, event.ID)
+		return retryNotification(context.Background(), notifiers, event, names)
+	}, nil)
+
+	if want := []string{"a", "b", "c"}; strings.Join(retried, ",") != strings.Join(want, ",") {
+		t.Errorf("retried %v, want %v", retried, want)
+	}
+	if n := len(chat.sent()); n != 3 {
+		t.Errorf("chat received %d events once recovered, want 3", n)
+	}
+	if n := len(plain.sent()); n != 3 {
+		t.Errorf("plain received %d events, want each once", n)
+	}
+}
+
+func TestFailedTextIsQueuedAndRetried(t *testing.T) {
+	queue := useRetryQueue(t, t.TempDir())
+	chat := &fakeChat{fakeNotifier: fakeNotifier{name: "chat", err: errors.New("down")}}
+	notifiers := []notifier.Notifier{chat}
+
+	sendText(context.Background(), notifiers, "12 OOM kills in the last hour")
+	if queue.Len() != 1 {
+		t.Fatalf("%d messages queued, want the failed text", queue.Len())
+	}
+
+	chat.mu.Lock()
+	chat.err = nil
+	chat.mu.Unlock()
+	if failed := retryText(context.Background(), notifiers, "12 OOM kills in the last hour", []string{"chat"}); len(failed) != 0 {
+		t.Fatalf("retry failed for %v", failed)
+	}
+	if len(chat.texts) != 1 {
+		t.Errorf("chat received %d texts, want 1", len(chat.texts))
+	}
+}
+
+func TestTextAndSummarySendsStopWhenCancelled(t *testing.T) {
+	useLedger(t)
+	hang := make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-hang:
+		}
+	}))
+	defer webhook.Close()
+	defer close(hang)
+	// The client timeout would end the requests long after the test
+	slack := notifier.NewSlackNotifier([]string{webhook.URL}, "#alerts", nil, notifier.SlackModeAll, notifier.SlackFormatAttachment, nil, notifier.NewHTTPClient(time.Minute, nil))
+	notifiers := []notifier.Notifier{slack}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	done := make(chan bool, 1)
+	go func() {
+		sendText(ctx, notifiers, "12 OOM kills in the last hour")
+		done <- sendSummary(ctx, notifiers, notifier.NodeSummary{Hostname: "node-1", Events: []notifier.OOMEvent{testKill("a")}})
+	}()
+	select {
+	case delivered := <-done:
+		if delivered {
+			t.Error("summary delivered after the context was cancelled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("text and summary sends still running after cancellation")
+	}
+}
+
+// replayedKill is a kernel log capture with one OOM kill.
+const replayedKill = `6,100,5000000,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0
+`
+
+// replayedMemcgKill is a kernel log capture with one cgroup limit kill.
+const replayedMemcgKill = `6,100,5000000,-;Memory cgroup out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0
+`
+
+// override sets the flag variable at p to value for the duration of the
+// test.
+func override[T any](t *testing.T, p *T, value T) {
+	t.Helper()
+	previous := *p
+	*p = value
+	t.Cleanup(func() { *p = previous })
+}
+
+// runReplay runs oom-notifier replaying capture to a webhook answering with
+// status, calling whileRunning, when set, in its own goroutine, and returns
+// the requests the webhook received and the result of run.
+func runReplay(t *testing.T, capture string, status int, whileRunning func()) (int, error) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "kmsg.txt")
+	if err := os.WriteFile(path, []byte(capture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	override(t, &replayFile, path)
+	override(t, &webhookURL, server.URL)
+	t.Cleanup(func() { reportedEvents = nil })
+	if problems := validateConfig(); len(problems) > 0 {
+		t.Fatalf("invalid configuration: %v", problems)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- run() }()
+	if whileRunning != nil {
+		go whileRunning()
+	}
+	select {
+	case err := <-done:
+		mu.Lock()
+		defer mu.Unlock()
+		return requests, err
+	case <-time.After(10 * time.Second):
+		t.Fatal("main loop did not exit")
+		return 0, nil
+	}
+}
+
+func TestOnceExitsAfterFirstDeliveredKill(t *testing.T) {
+	override(t, &once, true)
+	requests, err := runReplay(t, replayedKill, http.StatusOK, nil)
+	if !errors.Is(err, errNotifiedOnce) {
+		t.Errorf("run = %v, want %v", err, errNotifiedOnce)
+	}
+	if requests != 1 {
+		t.Errorf("webhook received %d requests, want 1", requests)
+	}
+}
+
+func TestOnceKeepsWaitingAfterFailedDelivery(t *testing.T) {
+	// The replay ends the run, which --once alone would have ended sooner
+	override(t, &once, true)
+	requests, err := runReplay(t, replayedKill, http.StatusInternalServerError, nil)
+	if err != nil {
+		t.Errorf("run = %v, want the replay to finish without a delivered kill", err)
+	}
+	if requests != 1 {
+		t.Errorf("webhook received %d requests, want 1", requests)
+	}
+}
+
+func TestReplayFlushesQuietHours(t *testing.T) {
+	// Quiet hours around now hold back the cgroup limit kill
+	now := time.Now().UTC()
+	override(t, &timezone, "UTC")
+	override(t, &quietHours, now.Add(-time.Hour).Format("15:04")+"-"+now.Add(time.Hour).Format("15:04"))
+	override(t, &quietDigest, true)
+
+	requests, err := runReplay(t, replayedMemcgKill, http.StatusOK, nil)
+	if err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("webhook received %d requests, want the held kill", requests)
+	}
+}
+
+func TestShutdownFlushesOpenBatch(t *testing.T) {
+	// The batch window outlasts the test, only the shutdown closes it
+	override(t, &batchWindow, 3600)
+	before := deliveredEvents.Load()
+
+	requests, err := runReplay(t, replayedKill, http.StatusOK, func() {
+		for deliveredEvents.Load() == before {
+			time.Sleep(10 * time.Millisecond)
+		}
+		// Caught by the signal handler of run, which is registered by now
+		syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	})
+	if err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("webhook received %d requests, want the batched kill", requests)
+	}
+}
+
+func TestSendTestNotificationSendsOneTestEvent(t *testing.T) {
+	ok, failing := &fakeNotifier{name: "ok"}, &fakeNotifier{name: "failing", err: errors.New("invalid channel")}
+
+	if err := sendTestNotification(context.Background(), []notifier.Notifier{ok}); err != nil {
+		t.Fatalf("sendTestNotification = %v, want nil", err)
+	}
+	sent := ok.sent()
+	if len(sent) != 1 {
+		t.Fatalf("notifier received %d events, want 1", len(sent))
+	}
+	if !sent[0].Test || !strings.Contains(sent[0].Message, "test notification") {
+		t.Errorf("event %+v not labeled as a test", sent[0])
+	}
+
+	err := sendTestNotification(context.Background(), []notifier.Notifier{ok, failing})
+	if err == nil || !strings.Contains(err.Error(), "failing: invalid channel") {
+		t.Errorf("sendTestNotification = %v, want the failure of the failing notifier", err)
+	}
+	if n := len(ok.sent()); n != 2 {
+		t.Errorf("working notifier received %d events, want 2 despite the other failing", n)
+	}
+}
+
+func TestTestNotificationFailureEndsRun(t *testing.T) {
+	override(t, &testNotification, true)
+
+	requests, err := runReplay(t, replayedKill, http.StatusInternalServerError, nil)
+	if err == nil || !strings.Contains(err.Error(), "test notification failed") {
+		t.Errorf("run = %v, want the test notification failure", err)
+	}
+	if requests != 1 {
+		t.Errorf("webhook received %d requests, want only the test event", requests)
+	}
+
+	// Delivered, the test event is followed by the replayed kill
+	requests, err = runReplay(t, replayedKill, http.StatusOK, nil)
+	if err != nil {
+		t.Errorf("run = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("webhook received %d requests, want the test event and the kill", requests)
+	}
+}
+
+// logToFile sends the log to a file for the duration of the test and
+// returns a function reading it.
+func logToFile(t *testing.T) func() string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "oom-notifier.log")
+	if err := logger.Init(logger.Options{Level: logger.LevelInfo, File: path}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logger.Init(logger.Options{Level: logger.LevelInfo}) })
+	return func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+}
+
+func TestDryRunLogsInsteadOfNotifying(t *testing.T) {
+	readLog := logToFile(t)
+	override(t, &dryRun, true)
+
+	requests, err := runReplay(t, replayedKill, http.StatusOK, nil)
+	if err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("webhook received %d requests during a dry run, want none", requests)
+	}
+	log := readLog()
+	if !strings.Contains(log, "[dry run] webhook notification:") || !strings.Contains(log, "stress") {
+		t.Errorf("kill not logged by the dry run, log:\n%s", log)
+	}
+}
+
+// fakeDigestNotifier is a fakeNotifier that can render digests.
+type fakeDigestNotifier struct {
+	fakeNotifier
+	digests []notifier.Digest
+}
+
+func (f *fakeDigestNotifier) NotifyDigest(digest notifier.Digest) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.digests = append(f.digests, digest)
+	return nil
+}
+
+func TestSendBatchSendsBurstsAsOneDigest(t *testing.T) {
+	digesting := &fakeDigestNotifier{fakeNotifier: fakeNotifier{name: "digesting"}}
+	plain := &fakeNotifier{name: "plain"}
+	notifiers := []notifier.Notifier{digesting, plain}
+
+	// A lone event in a window is sent normally
+	sendBatch(context.Background(), notifiers, []notifier.OOMEvent{testKill("lone")})
+	if len(digesting.sent()) != 1 || len(digesting.digests) != 0 {
+		t.Errorf("lone event sent as %d events and %d digests, want one event", len(digesting.sent()), len(digesting.digests))
+	}
+
+	sendBatch(context.Background(), notifiers, []notifier.OOMEvent{testKill("a"), testKill("b"), testKill("c")})
+	if len(digesting.digests) != 1 || len(digesting.digests[0].Events) != 3 {
+		t.Fatalf("burst sent as %d digests, want one of 3 events", len(digesting.digests))
+	}
+	if n := len(digesting.sent()); n != 1 {
+		t.Errorf("burst also sent %d individual events", n-1)
+	}
+	// Notifiers without digests get each event
+	if n := len(plain.sent()); n != 4 {
+		t.Errorf("plain notifier received %d events, want 4", n)
+	}
+}
+
+func TestBatchWindowSendsBurstOnce(t *testing.T) {
+	// The finished replay waits for the window to close
+	override(t, &batchWindow, 1)
+	override(t, &webhookBatch, true)
+	burst := replayedKill +
+		"6,101,5000100,-;Out of memory: Killed process 4343 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n" +
+		"6,102,5000200,-;Out of memory: Killed process 4444 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n"
+
+	requests, err := runReplay(t, burst, http.StatusOK, nil)
+	if err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("webhook received %d requests for a burst of 3 kills, want one batch", requests)
+	}
+}
+
+func TestRunReturnsMonitorErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kmsg.txt")
+	if err := os.WriteFile(path, []byte(replayedKill), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	override(t, &replayFile, path)
+	override(t, &webhookURL, "http://127.0.0.1:9/oom")
+	// The monitor fails to start without a proc tree to read processes from
+	override(t, &procDirs, []string{filepath.Join(t.TempDir(), "missing")})
+	t.Cleanup(func() { reportedEvents = nil })
+
+	done := make(chan error, 1)
+	go func() { done <- run() }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "OOM monitor") {
+			t.Errorf("run = %v, want the monitor error", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not return the monitor error")
+	}
+}
+
+func TestShutdownLogsDeliveries(t *testing.T) {
+	readLog := logToFile(t)
+	override(t, &deliveries, notifier.NewDeliveries())
+
+	if _, err := runReplay(t, replayedKill, http.StatusInternalServerError, nil); err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	counts := deliveries.Counts()
+	if len(counts) != 1 || counts[0].Name != "webhook" || counts[0].Sent != 0 || counts[0].Failed == 0 {
+		t.Fatalf("deliveries = %+v, want failed webhook notifications", counts)
+	}
+	if log := readLog(); !strings.Contains(log, "Notifications sent: webhook: 0 sent") {
+		t.Errorf("shutdown log lacks the deliveries:\n%s", log)
+	}
+}
+
+func TestReplayFileEmitsEvents(t *testing.T) {
+	var mu sync.Mutex
+	var events []notifier.OOMEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event notifier.OOMEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("invalid webhook body: %v", err)
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	capture := "6,99,4000000,-;systemd[1]: Started Session 2 of user root.\n" +
+		"3,100,5000000,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:0kB oom_score_adj:0\n" +
+		"3,101,6000000,-;Memory cgroup out of memory: Killed process 4343 (java) total-vm:2048kB, anon-rss:1024kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n"
+	path := filepath.Join(t.TempDir(), "kmsg.txt")
+	if err := os.WriteFile(path, []byte(capture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	override(t, &replayFile, path)
+	override(t, &webhookURL, server.URL)
+	t.Cleanup(func() { reportedEvents = nil })
+	if problems := validateConfig(); len(problems) > 0 {
+		t.Fatalf("invalid configuration: %v", problems)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- run() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("replay did not finish")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 {
+		t.Fatalf("replay emitted %d events, want the two kills", len(events))
+	}
+	for i, want := range []struct{ pid, cmdline, oomType string }{
+		{"4242", "[stress]", "global"},
+		{"4343", "[java]", "memcg"},
+	} {
+		if got := events[i]; got.PID != want.pid || got.Cmdline != want.cmdline || got.OOMType != want.oomType {
+			t.Errorf("event %d = PID %s %q %s, want PID %s %q %s", i, got.PID, got.Cmdline, got.OOMType, want.pid, want.cmdline, want.oomType)
+		}
+	}
+}
+
+func TestReplayStartupFilterSkipsOldMessages(t *testing.T) {
+	override(t, &replayFilter, true)
+	// The kill was logged five seconds after boot, long before startup
+	// of the replaying process
+	requests, err := runReplay(t, replayedKill, http.StatusOK, nil)
+	if err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("webhook received %d requests for a kill from before startup", requests)
+	}
+}
+
+func TestDropStale(t *testing.T) {
+	override(t, &staleEvents, 0)
+	now := time.Now()
+	old, fresh, oldTest := testKill("old"), testKill("fresh"), testKill("test")
+	old.Time = now.Add(-10 * time.Minute).UnixMilli()
+	fresh.Time = now.Add(-10 * time.Second).UnixMilli()
+	oldTest.Time = old.Time
+	oldTest.Test = true
+
+	if !dropStale(old, time.Minute) {
+		t.Error("event from ten minutes ago kept")
+	}
+	if dropStale(fresh, time.Minute) {
+		t.Error("event from ten seconds ago dropped")
+	}
+	if dropStale(oldTest, time.Minute) {
+		t.Error("test notification dropped")
+	}
+	if staleEvents != 1 {
+		t.Errorf("%d stale events counted, want 1", staleEvents)
+	}
+}
+
+func TestMaxEventAgeDropsReplayedKill(t *testing.T) {
+	// The replayed kill was logged five seconds after boot
+	override(t, &maxEventAge, 60)
+	override(t, &staleEvents, 0)
+	requests, err := runReplay(t, replayedKill, http.StatusOK, nil)
+	if err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	if requests != 0 || staleEvents != 1 {
+		t.Errorf("webhook received %d requests and %d stale events were dropped, want the kill dropped", requests, staleEvents)
+	}
+}
+
+// contextNotifier is a fakeNotifier failing with the error of the context
+// its deliveries are given.
+type contextNotifier struct {
+	fakeNotifier
+}
+
+func (c *contextNotifier) NotifyContext(ctx context.Context, event notifier.OOMEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Notify(event)
+}
+
+func TestNotifyPassesContext(t *testing.T) {
+	n := &contextNotifier{fakeNotifier{name: "context"}}
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := notify(ctx, n, testKill("live")); err != nil {
+		t.Fatalf("notify = %v", err)
+	}
+	cancel()
+	if err := notify(ctx, n, testKill("cancelled")); !errors.Is(err, context.Canceled) {
+		t.Errorf("notify after shutdown = %v, want %v", err, context.Canceled)
+	}
+	// Notifiers without cancellation deliver regardless
+	plain := &fakeNotifier{name: "plain"}
+	if err := notify(ctx, plain, testKill("plain")); err != nil || len(plain.sent()) != 1 {
+		t.Errorf("notify = %v with %d events sent, want the event delivered", err, len(plain.sent()))
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// notifierBackend is a notifier that can be selected with --notifier.
+type notifierBackend struct {
+	name string
+	// flags configure the backend, the first one enables it. They can be
+	// set from the --notifier options.
+	flags []string
+	// configured reports whether the flags needed by the backend are set.
+	configured func() bool
+	build      func(ctx context.Context, client *http.Client) (notifier.Notifier, error)
+	// local backends deliver nothing and are kept in dry runs.
+	local bool
+}
+
+// notifierBackends are the supported notifiers, in the order they are sent
+// to.
+var notifierBackends = []notifierBackend{
+	{
+		name:       "slack",
+		flags:      []string{"slack-webhook", "slack-token", "slack-thread", "slack-channel", "channel-route", "slack-mode", "slack-format", "slack-username", "slack-icon-emoji", "message-template", "slack-retry-attempts", "slack-retry-backoff"},
+		configured: func() bool { return len(slackWebhooks) > 0 || slackToken != "" },
+		build:      buildSlack,
+	},
+	{
+		name:       "discord",
+		flags:      []string{"discord-webhook"},
+		configured: func() bool { return discordWebhook != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating Discord notifier")
+			return notifier.NewDiscordNotifier(discordWebhook, client), nil
+		},
+	},
+	{
+		name:       "teams",
+		flags:      []string{"teams-webhook"},
+		configured: func() bool { return teamsWebhook != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating Teams notifier")
+			teams := notifier.NewTeamsNotifier(teamsWebhook, client)
+			link, err := parseLinkTemplate()
+			if err != nil {
+				return nil, err
+			}
+			teams.Link = link
+			return teams, nil
+		},
+	},
+	{
+		name:       "mattermost",
+		flags:      []string{"mattermost-webhook", "mattermost-channel"},
+		configured: func() bool { return mattermostWebhook != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating Mattermost notifier")
+			return notifier.NewMattermostNotifier(mattermostWebhook, mattermostChannel, client), nil
+		},
+	},
+	{
+		name:       "telegram",
+		flags:      []string{"telegram-bot-token", "telegram-chat-id"},
+		configured: func() bool { return telegramToken != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating Telegram notifier for chat %s", telegramChatID)
+			return notifier.NewTelegramNotifier(telegramToken, telegramChatID, client), nil
+		},
+	},
+	{
+		name:       "pushover",
+		flags:      []string{"pushover-token", "pushover-user"},
+		configured: func() bool { return pushoverToken != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating Pushover notifier")
+			return notifier.NewPushoverNotifier(pushoverToken, pushoverUser, client), nil
+		},
+	},
+	{
+		name:       "webhook",
+		flags:      []string{"webhook-url", "webhook-secret", "webhook-gzip", "webhook-batch"},
+		configured: func() bool { return webhookURL != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating webhook notifier")
+			webhook := notifier.NewWebhookNotifier(webhookURL, webhookSecret, client)
+			webhook.Gzip = webhookGzip
+			webhook.Batch = webhookBatch
+			webhook.Encoding = eventEncoding()
+			return webhook, nil
+		},
+	},
+	{
+		name:       "email",
+		flags:      []string{"smtp-host", "smtp-port", "smtp-username", "smtp-password", "email-from", "email-to"},
+		configured: func() bool { return smtpHost != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating email notifier for %s:%d", smtpHost, smtpPort)
+			return notifier.NewEmailNotifier(notifier.EmailConfig{
+				Host:     smtpHost,
+				Port:     smtpPort,
+				Username: smtpUsername,
+				Password: smtpPassword,
+				From:     emailFrom,
+				To:       emailTo,
+			}), nil
+		},
+	},
+	{
+		name:       "sns",
+		flags:      []string{"sns-topic-arn", "sns-region"},
+		configured: func() bool { return snsTopicARN != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating SNS notifier for %s", snsTopicARN)
+			sns, err := notifier.NewSNSNotifier(snsTopicARN, snsRegion)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create SNS notifier: %v", err)
+			}
+			return sns, nil
+		},
+	},
+	{
+		name:       "kafka",
+		flags:      []string{"kafka-topic", "kafka-broker"},
+		configured: func() bool { return kafkaTopic != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating Kafka notifier for topic %s", kafkaTopic)
+			return notifier.NewKafkaNotifier(kafkaBrokers, kafkaTopic), nil
+		},
+	},
+	{
+		name:       "nats",
+		flags:      []string{"nats-url", "nats-subject"},
+		configured: func() bool { return natsURL != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating NATS notifier for subject %s on %s", natsSubject, natsURL)
+			return notifier.NewNATSNotifier(natsURL, natsSubject), nil
+		},
+	},
+	{
+		name:       "gelf",
+		flags:      []string{"gelf-addr"},
+		configured: func() bool { return gelfAddr != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating GELF notifier for %s", gelfAddr)
+			gelf, err := notifier.NewGelfNotifier(gelfAddr)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create GELF notifier: %v", err)
+			}
+			return gelf, nil
+		},
+	},
+	{
+		name:       "syslog",
+		flags:      []string{"syslog-addr", "syslog-network", "syslog-facility"},
+		configured: func() bool { return syslogAddr != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating syslog notifier for %s over %s", syslogAddr, syslogNetwork)
+			syslog, err := notifier.NewSyslogNotifier(syslogNetwork, syslogAddr, syslogFacility)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create syslog notifier: %v", err)
+			}
+			if syslog.TLSConfig, err = notifier.NewTLSConfig(tlsOptions()); err != nil {
+				return nil, fmt.Errorf("invalid TLS configuration: %v", err)
+			}
+			return syslog, nil
+		},
+	},
+	{
+		name:       "loki",
+		flags:      []string{"loki-url", "loki-label", "loki-gzip", "loki-batch"},
+		configured: func() bool { return lokiURL != "" },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Creating Loki notifier for %s", lokiURL)
+			labels, err := notifier.ParseLokiLabels(lokiLabels)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --loki-label: %v", err)
+			}
+			loki := notifier.NewLokiNotifier(lokiURL, labels, client)
+			loki.Gzip = lokiGzip
+			loki.Batch = lokiBatch
+			return loki, nil
+		},
+	},
+	{
+		name:       "stdout",
+		flags:      []string{"print-events"},
+		configured: func() bool { return printEvents },
+		build: func(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+			logger.Debug("Printing events to stdout")
+			stdout := notifier.NewStdoutNotifier(os.Stdout)
+			stdout.Encoding = eventEncoding()
+			return stdout, nil
+		},
+		local: true,
+	},
+}
+
+// eventEncoding is the JSON representation of the events written by the
+// webhook notifier, --print-events and --audit-file.
+func eventEncoding() notifier.EventEncoding {
+	return notifier.EventEncoding{Schema: outputSchema, Naming: jsonNaming, EmptyFields: jsonEmptyFields}
+}
+
+func buildSlack(ctx context.Context, client *http.Client) (notifier.Notifier, error) {
+	logger.Debug("Creating Slack notifier")
+	routes, err := notifier.ParseChannelRoutes(channelRoutes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --channel-route: %v", err)
+	}
+	retrier := notifier.NewRetrier(ctx, slackRetries, time.Duration(slackBackoff)*time.Second)
+	slack := notifier.NewSlackNotifier(slackWebhooks, slackChannel, routes, slackMode, slackFormat, retrier, client)
+	slack.Username = slackUsername
+	slack.IconEmoji = slackIconEmoji
+	if flapChannel != "" {
+		// Already validated by validateConfig
+		slack.EscalationChannel, _ = notifier.NormalizeSlackChannel(flapChannel)
+	}
+	slack.Token = slackToken
+	if slackThread > 0 {
+		slack.Threads = notifier.NewSlackThreads(time.Duration(slackThread) * time.Second)
+	}
+	if messageTemplate != "" {
+		tmpl, err := notifier.ParseMessageTemplate(messageTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --message-template: %v", err)
+		}
+		slack.Template = tmpl
+	}
+	if slack.Link, err = parseLinkTemplate(); err != nil {
+		return nil, err
+	}
+	return slack, nil
+}
+
+// parseLinkTemplate parses --link-template, returning nil when it is empty.
+func parseLinkTemplate() (*template.Template, error) {
+	if linkTemplate == "" {
+		return nil, nil
+	}
+	tmpl, err := notifier.ParseLinkTemplate(linkTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --link-template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// lookupBackend returns the backend called name.
+func lookupBackend(name string) (notifierBackend, bool) {
+	for _, backend := range notifierBackends {
+		if backend.name == name {
+			return backend, true
+		}
+	}
+	return notifierBackend{}, false
+}
+
+// backendNames lists the supported notifiers for error messages.
+func backendNames() string {
+	var names []string
+	for _, backend := range notifierBackends {
+		names = append(names, backend.name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// parseNotifierSpec parses a --notifier value, name[:key=value,...].
+func parseNotifierSpec(spec string) (string, map[string]string, error) {
+	name, list, hasOptions := strings.Cut(spec, ":")
+	name = strings.TrimSpace(name)
+	if _, found := lookupBackend(name); !found {
+		return "", nil, fmt.Errorf("unknown notifier %q, supported notifiers are %s", name, backendNames())
+	}
+
+	options := make(map[string]string)
+	if !hasOptions {
+		return name, options, nil
+	}
+	for _, option := range strings.Split(list, ",") {
+		key, value, ok := strings.Cut(option, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return "", nil, fmt.Errorf("invalid option %q of notifier %s, expected key=value", option, name)
+		}
+		options[key] = value
+	}
+	return name, options, nil
+}
+
+// optionFlag returns the flag of backend set by the option key: the flag
+// called key, or the only one ending in -key, e.g. "channel" for
+// --slack-channel.
+func optionFlag(backend notifierBackend, key string) (string, error) {
+	var matches []string
+	for _, name := range backend.flags {
+		if name == key {
+			return name, nil
+		}
+		if strings.HasSuffix(name, "-"+key) {
+			matches = append(matches, name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("unknown option %q of notifier %s, options are the flags --%s", key, backend.name, strings.Join(backend.flags, ", --"))
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous option %q of notifier %s, could be --%s", key, backend.name, strings.Join(matches, " or --"))
+	}
+}
+
+// applyNotifierOptions sets the flags given as options of the --notifier
+// values in fs. They are pinned like command line flags, so that reloading
+// the config file keeps them.
+func applyNotifierOptions(fs *flag.FlagSet) error {
+	for _, spec := range notifierSpecs {
+		name, options, err := parseNotifierSpec(spec)
+		if err != nil {
+			return err
+		}
+		backend, _ := lookupBackend(name)
+
+		keys := make([]string, 0, len(options))
+		for key := range options {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			flagName, err := optionFlag(backend, key)
+			if err != nil {
+				return err
+			}
+			if err := fs.Set(flagName, options[key]); err != nil {
+				return fmt.Errorf("invalid value %q for option %s of notifier %s: %v", options[key], key, name, err)
+			}
+			pinnedFlags[flagName] = true
+		}
+	}
+	return nil
+}
+
+// selectedBackends returns the backends to send to: those named by
+// --notifier, or every configured one when it is not given. Names were
+// checked by applyNotifierOptions.
+func selectedBackends() []notifierBackend {
+	if len(notifierSpecs) == 0 {
+		var backends []notifierBackend
+		for _, backend := range notifierBackends {
+			if backend.configured() {
+				backends = append(backends, backend)
+			}
+		}
+		return backends
+	}
+
+	selected := make(map[string]bool)
+	for _, spec := range notifierSpecs {
+		name, _, _ := strings.Cut(spec, ":")
+		selected[strings.TrimSpace(name)] = true
+	}
+	var backends []notifierBackend
+	for _, backend := range notifierBackends {
+		if selected[backend.name] {
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// validateNotifiers checks that the selected notifiers are configured.
+func validateNotifiers() []string {
+	var problems []string
+	if len(notifierSpecs) == 0 {
+		for _, backend := range notifierBackends {
+			if backend.configured() {
+				return nil
+			}
+		}
+		if !dryRun {
+			var flags []string
+			for _, backend := range notifierBackends {
+				flags = append(flags, "--"+backend.flags[0])
+			}
+			problems = append(problems, fmt.Sprintf("no notifier configured: set --notifier or one of %s", strings.Join(flags, ", ")))
+		}
+		return problems
+	}
+
+	for _, spec := range notifierSpecs {
+		name, _, _ := strings.Cut(spec, ":")
+		backend, found := lookupBackend(strings.TrimSpace(name))
+		if !found {
+			problems = append(problems, fmt.Sprintf("unknown --notifier %q, supported notifiers are %s", name, backendNames()))
+			continue
+		}
+		if !backend.configured() {
+			problems = append(problems, fmt.Sprintf("--notifier %s requires --%s", backend.name, backend.flags[0]))
+		}
+	}
+	return problems
+}
+
+// buildNotifiers creates the selected notifiers. In dry runs they are
+// replaced by log notifiers, keeping the local ones.
+func buildNotifiers(ctx context.Context, client *http.Client) ([]notifier.Notifier, error) {
+	var notifiers []notifier.Notifier
+	delivering := 0
+	for _, backend := range selectedBackends() {
+		n, err := backend.build(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		if !backend.local {
+			delivering++
+			if dryRun {
+				n = notifier.NewLogNotifier(n.Name())
+			}
+		}
+		notifiers = append(notifiers, n)
+	}
+	if dryRun && delivering == 0 {
+		notifiers = append([]notifier.Notifier{notifier.NewLogNotifier("log")}, notifiers...)
+	}
+	return notifiers, nil
+}
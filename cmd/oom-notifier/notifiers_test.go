@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+)
+
+func TestParseNotifierSpec(t *testing.T) {
+	for _, tt := range []struct {
+		spec    string
+		name    string
+		options map[string]string
+		err     string
+	}{
+		{spec: "slack", name: "slack", options: map[string]string{}},
+		{spec: " webhook ", name: "webhook", options: map[string]string{}},
+		{spec: "slack:webhook=https://hooks.slack.com/services/T/B/X,channel=#ops", name: "slack", options: map[string]string{
+			"webhook": "https://hooks.slack.com/services/T/B/X",
+			"channel": "#ops",
+		}},
+		{spec: "pagerduty", err: "unknown notifier \"pagerduty\", supported notifiers are "},
+		{spec: "slack:channel", err: "expected key=value"},
+		{spec: "slack:=#ops", err: "expected key=value"},
+	} {
+		t.Run(tt.spec, func(t *testing.T) {
+			name, options, err := parseNotifierSpec(tt.spec)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("parseNotifierSpec = %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseNotifierSpec: %v", err)
+			}
+			if name != tt.name || !reflect.DeepEqual(options, tt.options) {
+				t.Errorf("parseNotifierSpec = %q, %v, want %q, %v", name, options, tt.name, tt.options)
+			}
+		})
+	}
+}
+
+func TestUnknownNotifierListsSupportedOnes(t *testing.T) {
+	_, _, err := parseNotifierSpec("pagerduty")
+	if err == nil {
+		t.Fatal("unknown notifier accepted")
+	}
+	for _, backend := range notifierBackends {
+		if !strings.Contains(err.Error(), backend.name) {
+			t.Errorf("error %q does not list %s", err, backend.name)
+		}
+	}
+}
+
+func TestOptionFlag(t *testing.T) {
+	slack, _ := lookupBackend("slack")
+	for key, want := range map[string]string{
+		"slack-channel": "slack-channel",
+		"channel":       "slack-channel",
+		"webhook":       "slack-webhook",
+		"route":         "channel-route",
+	} {
+		if got, err := optionFlag(slack, key); err != nil || got != want {
+			t.Errorf("optionFlag(slack, %q) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+
+	if _, err := optionFlag(slack, "topic"); err == nil || !strings.Contains(err.Error(), "unknown option") {
+		t.Errorf("optionFlag(slack, \"topic\") = %v, want an unknown option error", err)
+	}
+	both := notifierBackend{name: "both", flags: []string{"primary-url", "backup-url"}}
+	if _, err := optionFlag(both, "url"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("optionFlag(both, \"url\") = %v, want an ambiguous option error", err)
+	}
+}
+
+func TestApplyNotifierOptionsSetsAndPinsFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var channel, url string
+	fs.StringVar(&channel, "slack-channel", "alerts", "")
+	fs.StringVar(&url, "webhook-url", "", "")
+	override(t, &pinnedFlags, map[string]bool{})
+	override(t, &notifierSpecs, []string{"slack:channel=#ops", "webhook:url=http://127.0.0.1:9/oom"})
+
+	if err := applyNotifierOptions(fs); err != nil {
+		t.Fatalf("applyNotifierOptions: %v", err)
+	}
+	if channel != "#ops" || url != "http://127.0.0.1:9/oom" {
+		t.Errorf("flags set to %q and %q, want the notifier options", channel, url)
+	}
+	if !pinnedFlags["slack-channel"] || !pinnedFlags["webhook-url"] {
+		t.Errorf("pinned flags %v, want the options pinned against reloads", pinnedFlags)
+	}
+
+	override(t, &notifierSpecs, []string{"slack:colour=red"})
+	if err := applyNotifierOptions(fs); err == nil {
+		t.Error("unknown option accepted")
+	}
+}
+
+// notifierNames returns the names of the notifiers built for the current
+// flags.
+func notifierNames(t *testing.T) []string {
+	t.Helper()
+	notifiers, err := buildNotifiers(context.Background(), http.DefaultClient)
+	if err != nil {
+		t.Fatalf("buildNotifiers: %v", err)
+	}
+	var names []string
+	for _, n := range notifiers {
+		names = append(names, n.Name())
+	}
+	return names
+}
+
+func TestBuildNotifiersAssemblesSelection(t *testing.T) {
+	override(t, &webhookURL, "http://127.0.0.1:9/oom")
+	override(t, &printEvents, true)
+	override(t, &discordWebhook, "https://discord.com/api/webhooks/1/x")
+
+	if got, want := notifierNames(t), []string{"discord", "webhook", "stdout"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("without --notifier built %v, want every configured one: %v", got, want)
+	}
+
+	override(t, &notifierSpecs, []string{"stdout", "webhook"})
+	if got, want := notifierNames(t), []string{"webhook", "stdout"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("--notifier stdout --notifier webhook built %v, want %v in sending order", got, want)
+	}
+}
+
+func TestValidateNotifiers(t *testing.T) {
+	override(t, &notifierSpecs, []string{"slack", "pagerduty"})
+	problems := validateNotifiers()
+	if len(problems) != 2 {
+		t.Fatalf("problems %v, want the unconfigured and the unknown notifier", problems)
+	}
+	if !strings.Contains(problems[0], "--notifier slack requires --slack-webhook") {
+		t.Errorf("problem %q, want the missing Slack webhook", problems[0])
+	}
+	if !strings.Contains(problems[1], "unknown --notifier \"pagerduty\"") {
+		t.Errorf("problem %q, want the unknown notifier", problems[1])
+	}
+}
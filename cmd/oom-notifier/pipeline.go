@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/oom-notifier/go/internal/audit"
+	"github.com/oom-notifier/go/internal/bus"
+	"github.com/oom-notifier/go/internal/docker"
+	"github.com/oom-notifier/go/internal/enrich"
+	"github.com/oom-notifier/go/internal/kube"
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/metrics"
+	"github.com/oom-notifier/go/internal/monitor"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// publishDetections converts monitor events, drops those of hosts muted by
+// mutes when it is set, names the pod of memcg kills when pods is set and
+// the Docker container of OOM kills when containers is set, adds the fields
+// printed by hook when it is set, and publishes them as raw detections.
+func publishDetections(eventChan <-chan monitor.OOMEventData, events *bus.Bus[notifier.OOMEvent], mutes *notifier.HostMutes, pods *kube.Resolver, containers *docker.Client, hook *enrich.Command) {
+	kills := notifier.NewKillCounter()
+	for event := range eventChan {
+		logger.Info("Kernel event received",
+			logger.F("kind", event.Kind), logger.F("pid", event.PID), logger.F("cmdline", event.Cmdline))
+		if event.Kind == monitor.KindOOM {
+			metrics.OOMEvents.Inc(event.Hostname, event.Cmdline)
+			reporter.OOMEvent(event.Hostname)
+		}
+		// Muted hosts are dropped before any lookup is spent on them
+		if dropMuted(mutes, event.Kind, event.Hostname) {
+			continue
+		}
+
+		notifierEvent := toNotifierEvent(event)
+		if pods != nil && event.OOMType == monitor.OOMTypeMemcg {
+			// The victim's own cgroup names the container, the limiting one
+			// may only name the pod
+			if pod, ok := pods.Lookup(event.TaskCgroup, event.Cgroup); ok {
+				notifierEvent.PodName = pod.PodName
+				notifierEvent.Namespace = pod.Namespace
+				notifierEvent.ContainerName = pod.ContainerName
+				notifierEvent.RestartCount = pod.RestartCount
+				notifierEvent = notifier.EscalateCrashLoop(notifierEvent)
+			}
+		}
+		if containers != nil && event.TaskCgroup != "" {
+			if container, ok := containers.Lookup(event.TaskCgroup); ok {
+				notifierEvent.ContainerName = container.Name
+				notifierEvent.ContainerImage = container.Image
+			}
+		}
+		if hook != nil {
+			if fields, ok := hook.Lookup(notifierEvent); ok && len(fields) > 0 {
+				merged := make(map[string]string, len(notifierEvent.Fields)+len(fields))
+				for key, value := range notifierEvent.Fields {
+					merged[key] = value
+				}
+				for key, value := range fields {
+					merged[key] = value
+				}
+				notifierEvent.Fields = merged
+			}
+		}
+		notifierEvent.GroupKey = notifierEvent.Fingerprint()
+		if event.KillCount > 0 {
+			notifierEvent.FingerprintKills = kills.Add(notifierEvent.GroupKey)
+		}
+		events.Publish(bus.TopicDetected, notifierEvent)
+	}
+	// The channel is only closed at the end of a replay
+	events.CloseTopic(bus.TopicDetected)
+}
+
+// dropMuted reports whether the event of kind from hostname is dropped by
+// mutes, which may be nil, counting and logging it when it is.
+func dropMuted(mutes *notifier.HostMutes, kind, hostname string) bool {
+	if mutes == nil || !mutes.Muted(hostname) {
+		return false
+	}
+	metrics.MutedEvents.Inc(hostname)
+	logger.Info("Dropping %s event for host %s muted by --mute-host (%d muted events dropped)", kind, hostname, mutes.Dropped())
+	return true
+}
+
+// filterSettings are the filters that can be changed by reloading the
+// config file.
+type filterSettings struct {
+	cmdline     *notifier.CmdlineFilter
+	uid         *notifier.UIDFilter
+	rss         *notifier.RSSFilter
+	dedupWindow time.Duration
+}
+
+// newFilterSettings builds the filter settings from the flags.
+func newFilterSettings() (filterSettings, error) {
+	settings := filterSettings{dedupWindow: time.Duration(dedupWindow) * time.Second}
+	if len(includeCmdlines) > 0 || len(excludeCmdlines) > 0 {
+		cmdlineFilter, err := notifier.NewCmdlineFilter(includeCmdlines, excludeCmdlines)
+		if err != nil {
+			return filterSettings{}, fmt.Errorf("failed to create command line filter: %v", err)
+		}
+		settings.cmdline = cmdlineFilter
+	}
+	if len(includeUIDs) > 0 || len(excludeUIDs) > 0 {
+		uidFilter, err := notifier.NewUIDFilter(includeUIDs, excludeUIDs)
+		if err != nil {
+			return filterSettings{}, fmt.Errorf("failed to create user filter: %v", err)
+		}
+		settings.uid = uidFilter
+	}
+	if minRSS != "" {
+		size, err := notifier.ParseSize(minRSS)
+		if err != nil {
+			return filterSettings{}, fmt.Errorf("invalid --min-rss: %v", err)
+		}
+		settings.rss = notifier.NewRSSFilter(size)
+	}
+	return settings, nil
+}
+
+// sendFilterSettings hands settings to the filter stage without blocking,
+// replacing settings it has not picked up yet. It must only be called from
+// one goroutine.
+func sendFilterSettings(updates chan filterSettings, settings filterSettings) {
+	select {
+	case <-updates:
+	default:
+	}
+	updates <- settings
+}
+
+// recoveryCheck is how often the flap detector is checked for escalated
+// events that stopped repeating.
+const recoveryCheck = time.Second
+
+// filterStage consumes raw detections, drops filtered, muted, duplicate,
+// cooling down, sampled-out and rate limited events, escalates flapping
+// ones, and republishes the rest for delivery, along with the recovery
+// events of flapping ones that went quiet. New settings received on
+// updates apply to the following events.
+func filterStage(events *bus.Bus[notifier.OOMEvent], detected <-chan notifier.OOMEvent, settings filterSettings, updates <-chan filterSettings, muteLists []*notifier.MuteList, flaps *notifier.FlapDetector, cooldown *notifier.Cooldown, expSampler *notifier.ExponentialSampler, sampler *notifier.Sampler, limiter *notifier.RateLimiter) {
+	stage := &filters{muteLists: muteLists, flaps: flaps, cooldown: cooldown, expSampler: expSampler, sampler: sampler, limiter: limiter}
+	if err := stage.apply(settings); err != nil {
+		logger.Error("Failed to create deduper: %v", err)
+	}
+	var recoveries <-chan time.Time
+	if flaps != nil && flaps.RecoveryWindow() > 0 {
+		ticker := time.NewTicker(recoveryCheck)
+		defer ticker.Stop()
+		recoveries = ticker.C
+	}
+
+	for {
+		select {
+		case event, ok := <-detected:
+			if !ok {
+				events.CloseTopic(bus.TopicEnriched)
+				return
+			}
+			if event, deliver := stage.filter(event); deliver {
+				events.Publish(bus.TopicEnriched, event)
+			}
+
+		case settings := <-updates:
+			if err := stage.apply(settings); err != nil {
+				logger.Error("Failed to create deduper: %v", err)
+			}
+
+		case <-recoveries:
+			// Recoveries skip the filters, they close an escalation
+			for _, event := range flaps.Recovered() {
+				logger.Info("%s on %s stopped repeating for %v, sending recovery",
+					event.Cmdline, event.Hostname, flaps.RecoveryWindow())
+				events.Publish(bus.TopicEnriched, event)
+			}
+		}
+	}
+}
+
+// filters holds the state of the filter stage. It is owned by filterStage.
+type filters struct {
+	cmdlineFilter *notifier.CmdlineFilter
+	uidFilter     *notifier.UIDFilter
+	rssFilter     *notifier.RSSFilter
+	muteLists     []*notifier.MuteList
+	deduper       *notifier.Deduper
+	flaps         *notifier.FlapDetector
+	cooldown      *notifier.Cooldown
+	expSampler    *notifier.ExponentialSampler
+	sampler       *notifier.Sampler
+	limiter       *notifier.RateLimiter
+}
+
+// apply switches to settings. The deduper keeps the fingerprints it has
+// seen when only its window changes.
+func (f *filters) apply(settings filterSettings) error {
+	f.cmdlineFilter = settings.cmdline
+	f.uidFilter = settings.uid
+	f.rssFilter = settings.rss
+
+	switch {
+	case settings.dedupWindow <= 0:
+		f.deduper = nil
+	case f.deduper != nil:
+		f.deduper.SetWindow(settings.dedupWindow)
+	default:
+		deduper, err := notifier.NewDeduper(settings.dedupWindow)
+		if err != nil {
+			return err
+		}
+		f.deduper = deduper
+		logger.Debug("Deduplicating events within %v", settings.dedupWindow)
+	}
+	return nil
+}
+
+// filter reports whether event should be delivered, and returns it updated
+// with the repeats it stands for.
+func (f *filters) filter(event notifier.OOMEvent) (notifier.OOMEvent, bool) {
+	if f.cmdlineFilter != nil && !f.cmdlineFilter.Allow(event.Cmdline) {
+		logger.Debug("Filtering out %s event for %s", event.Kind, event.Cmdline)
+		return event, false
+	}
+	if f.uidFilter != nil && !f.uidFilter.Allow(event) {
+		logger.Debug("Filtering out %s event for %s of UID %s", event.Kind, event.Cmdline, event.UID)
+		return event, false
+	}
+	if f.rssFilter != nil && !f.rssFilter.Allow(event) {
+		logger.Debug("Filtering out %s event for %s below the RSS threshold", event.Kind, event.Cmdline)
+		return event, false
+	}
+
+	if isMuted(f.muteLists, event) {
+		logger.Info("Suppressing muted event for %s on %s", event.Cmdline, event.Hostname)
+		return event, false
+	}
+
+	// Repeats are counted before deduplication drops any
+	var escalated bool
+	if f.flaps != nil {
+		if event, escalated = f.flaps.Observe(event); escalated {
+			logger.Warn("%s event for %s on %s repeated %d times within %v, escalating",
+				event.Kind, event.Cmdline, event.Hostname, event.Repeats, f.flaps.Window())
+		}
+	}
+
+	if f.deduper != nil {
+		var deliver bool
+		event, deliver = f.deduper.Check(event)
+		if !deliver {
+			logger.Debug("Suppressing duplicate %s event for %s (PID %s)", event.Kind, event.Cmdline, event.PID)
+			return event, false
+		}
+		if event.Suppressed > 0 {
+			logger.Info("Suppressed %d repeats of %s event for %s", event.Suppressed, event.Kind, event.Cmdline)
+		}
+	}
+
+	// The escalation itself is never held back by the cooldown
+	if f.cooldown != nil && !f.cooldown.Allow(event) && !escalated {
+		logger.Debug("Suppressing %s event for %s during the alert cooldown", event.Kind, event.Cmdline)
+		return event, false
+	}
+
+	// Like the cooldown, bursts never hold back the escalation
+	if f.expSampler != nil {
+		var deliver bool
+		if event, deliver = f.expSampler.Sample(event); !deliver && !escalated {
+			logger.Debug("Sampled out %s event for %s within its burst", event.Kind, event.Cmdline)
+			return event, false
+		}
+		if event.Occurrences > 1 {
+			logger.Info("Sampled %s event for %s represents %d occurrences", event.Kind, event.Cmdline, event.Occurrences)
+		}
+	}
+
+	if f.sampler != nil && event.Kind == monitor.KindOOM {
+		var deliver bool
+		event, deliver = f.sampler.Sample(event)
+		total, delivered := f.sampler.Stats()
+		metrics.SampleTotal.Inc()
+		if !deliver {
+			logger.Debug("Sampled out OOM event for %s (%d delivered of %d seen)", event.Cmdline, delivered, total)
+			return event, false
+		}
+		metrics.SampleDelivered.Inc()
+		logger.Info("Sampled OOM event for %s represents %d kills (%d delivered of %d seen)",
+			event.Cmdline, event.Occurrences, delivered, total)
+	}
+
+	if f.limiter != nil && !f.limiter.Allow() {
+		logger.Debug("Rate limit reached, dropping %s event for %s", event.Kind, event.Cmdline)
+		return event, false
+	}
+
+	return event, true
+}
+
+// recordAudit writes every raw detection to the audit log.
+func recordAudit(auditLog *audit.Log, detected <-chan notifier.OOMEvent) {
+	for event := range detected {
+		auditLog.Record(event)
+	}
+}
+
+// countKills counts every detected OOM kill, before any filtering, for the
+// periodic report.
+func countKills(tally *notifier.Tally, detected <-chan notifier.OOMEvent) {
+	for event := range detected {
+		if event.Kind == monitor.KindOOM {
+			tally.Add(event)
+		}
+	}
+}
+
+// handleMonitorError logs a non-fatal error of the monitor and counts it by
+// category.
+func handleMonitorError(err *monitor.MonitorError) {
+	metrics.MonitorErrors.Inc(string(err.Category))
+	logger.Error("Kernel monitor error", logger.F("category", err.Category), logger.F("error", err.Err))
+}
+
+// drainMonitorErrors handles the errors still queued in errs, without
+// waiting for more.
+func drainMonitorErrors(errs <-chan *monitor.MonitorError) {
+	for {
+		select {
+		case err := <-errs:
+			handleMonitorError(err)
+		default:
+			return
+		}
+	}
+}
+
+// reopenOnHangup reopens the audit log on SIGHUP, after logrotate moved it.
+func reopenOnHangup(auditLog *audit.Log) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		if err := auditLog.Reopen(); err != nil {
+			logger.Error("Failed to reopen audit log: %v", err)
+			continue
+		}
+		logger.Info("Reopened audit log")
+	}
+}
+
+// reportRateLimited periodically logs how many alerts the rate limiter
+// dropped since the previous report.
+func reportRateLimited(limiter *notifier.RateLimiter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var reported uint64
+	for range ticker.C {
+		dropped := limiter.Dropped()
+		if dropped > reported {
+			logger.Warn("Rate limit dropped %d alerts in the last %v (%d total)", dropped-reported, interval, dropped)
+			reported = dropped
+		}
+	}
+}
+
+func toNotifierEvent(event monitor.OOMEventData) notifier.OOMEvent {
+	var consumers []notifier.MemoryConsumer
+	for _, consumer := range event.TopConsumers {
+		consumers = append(consumers, notifier.MemoryConsumer{
+			PID:     strconv.Itoa(consumer.PID),
+			Cmdline: consumer.Cmdline,
+			RSS:     strconv.FormatInt(consumer.RSS, 10),
+		})
+	}
+
+	return notifier.OOMEvent{
+		ID:             event.ID,
+		Kind:           event.Kind,
+		Message:        event.Message,
+		Cmdline:        event.Cmdline,
+		Args:           event.Args,
+		PID:            event.PID,
+		Hostname:       event.Hostname,
+		Kernel:         event.Kernel,
+		Time:           event.Time,
+		Env:            event.Env,
+		Fields:         event.Fields,
+		Report:         event.Report,
+		Reaped:         event.Reaped,
+		Context:        event.Context,
+		UID:            event.UID,
+		User:           event.User,
+		ParentPID:      event.ParentPID,
+		ParentCmdline:  event.ParentCmdline,
+		Ancestry:       event.Ancestry,
+		TriggerPID:     event.TriggerPID,
+		TriggerCmdline: event.TriggerCmdline,
+		TopConsumers:   consumers,
+		AllocOrder:     event.AllocOrder,
+		GFPFlags:       event.GFPFlags,
+		TotalVM:        event.Memory.TotalVM,
+		AnonRSS:        event.Memory.AnonRSS,
+		FileRSS:        event.Memory.FileRSS,
+		ShmemRSS:       event.Memory.ShmemRSS,
+		OOMScoreAdj:    event.Memory.OOMScoreAdj,
+		OOMScore:       event.Memory.OOMScore,
+		FreeSwap:       event.Memory.FreeSwap,
+		TotalSwap:      event.Memory.TotalSwap,
+		OOMType:        event.OOMType,
+		Cgroup:         event.Cgroup,
+		TaskCgroup:     event.TaskCgroup,
+		Constraint:     event.Constraint,
+		Severity:       notifier.EventSeverity(event.Kind, event.OOMType),
+		KillCount:      event.KillCount,
+	}
+}
+
+func isMuted(muteLists []*notifier.MuteList, event notifier.OOMEvent) bool {
+	for _, muteList := range muteLists {
+		if muteList.IsMuted(event) {
+			logger.Debug("Event muted by %s, %d events suppressed so far", muteList.Source(), muteList.Suppressed())
+			return true
+		}
+	}
+	return false
+}
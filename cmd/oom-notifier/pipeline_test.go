@@ -0,0 +1,421 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oom-notifier/go/internal/bus"
+	"github.com/oom-notifier/go/internal/enrich"
+	"github.com/oom-notifier/go/internal/kube"
+	"github.com/oom-notifier/go/internal/metrics"
+	"github.com/oom-notifier/go/internal/monitor"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// collect reads the events of ch up to its close.
+func collect(t *testing.T, ch <-chan notifier.OOMEvent) []notifier.OOMEvent {
+	t.Helper()
+	var events []notifier.OOMEvent
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			t.Fatalf("channel not closed after %d events", len(events))
+		}
+	}
+}
+
+func TestPublishDetectionsStage(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+
+	eventChan := make(chan monitor.OOMEventData, 2)
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "42", Cmdline: "stress --vm 1", Hostname: "node-1", OOMType: monitor.OOMTypeMemcg, KillCount: 1}
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "43", Cmdline: "stress --vm 1", Hostname: "node-1", OOMType: monitor.OOMTypeMemcg, KillCount: 1}
+	close(eventChan)
+
+	publishDetections(eventChan, events, nil, nil, nil, nil)
+
+	got := collect(t, detected)
+	if len(got) != 2 {
+		t.Fatalf("published %d events, want 2", len(got))
+	}
+	if got[0].PID != "42" || got[0].Cmdline != "stress --vm 1" || got[0].Severity != notifier.EventSeverity(monitor.KindOOM, monitor.OOMTypeMemcg) {
+		t.Errorf("event not converted: %+v", got[0])
+	}
+	if got[0].GroupKey == "" || got[0].GroupKey != got[1].GroupKey {
+		t.Errorf("group keys %q and %q, want the same fingerprint", got[0].GroupKey, got[1].GroupKey)
+	}
+	if got[0].FingerprintKills != 1 || got[1].FingerprintKills != 2 {
+		t.Errorf("fingerprint kills %d and %d, want 1 and 2", got[0].FingerprintKills, got[1].FingerprintKills)
+	}
+}
+
+func TestUnknownVictimsShareFingerprint(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+
+	eventChan := make(chan monitor.OOMEventData, 2)
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "4242", Cmdline: "<unknown process>", Hostname: "node-1"}
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "4343", Cmdline: "<unknown process>", Hostname: "node-1"}
+	close(eventChan)
+
+	publishDetections(eventChan, events, nil, nil, nil, nil)
+
+	got := collect(t, detected)
+	if len(got) != 2 || got[0].GroupKey != got[1].GroupKey {
+		t.Errorf("published %+v, want the unknown victims grouped under one fingerprint", got)
+	}
+}
+
+func TestPublishDetectionsDropsMutedHosts(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	mutes, err := notifier.NewHostMutes([]string{"noisy-.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventChan := make(chan monitor.OOMEventData, 2)
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "1", Cmdline: "a", Hostname: "noisy-1"}
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "2", Cmdline: "b", Hostname: "quiet-1"}
+	close(eventChan)
+
+	publishDetections(eventChan, events, mutes, nil, nil, nil)
+
+	got := collect(t, detected)
+	if len(got) != 1 || got[0].Hostname != "quiet-1" {
+		t.Errorf("published %+v, want only the event of quiet-1", got)
+	}
+}
+
+func TestPublishDetectionsCountsMutedEvents(t *testing.T) {
+	readLog := logToFile(t)
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	mutes, err := notifier.NewHostMutes([]string{"muted-lab-1", "muted-ci-[0-9]+"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventChan := make(chan monitor.OOMEventData, 4)
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "1", Cmdline: "a", Hostname: "muted-lab-1"}
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "2", Cmdline: "b", Hostname: "muted-ci-7"}
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "3", Cmdline: "c", Hostname: "muted-lab-10"}
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "4", Cmdline: "d", Hostname: "muted-ci-7"}
+	close(eventChan)
+
+	// The hook records the events it is run for
+	looked := filepath.Join(t.TempDir(), "looked-up")
+	publishDetections(eventChan, events, mutes, nil, nil, enrich.NewCommand("cat >>"+looked, 5*time.Second))
+
+	got := collect(t, detected)
+	if len(got) != 1 || got[0].Hostname != "muted-lab-10" {
+		t.Errorf("published %+v, want only the event of muted-lab-10", got)
+	}
+	if input, _ := os.ReadFile(looked); strings.Count(string(input), `"hostname"`) != 1 || strings.Contains(string(input), "muted-ci-7") {
+		t.Errorf("enrich command run for %s, want it run for the unmuted event only", input)
+	}
+	if dropped := mutes.Dropped(); dropped != 3 {
+		t.Errorf("Dropped() = %d, want 3", dropped)
+	}
+	out := scrape(t, metrics.Handler())
+	for _, want := range []string{`oom_muted_events_total{hostname="muted-lab-1"} 1`, `oom_muted_events_total{hostname="muted-ci-7"} 2`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("scrape does not contain %s", want)
+		}
+	}
+	if log := readLog(); !strings.Contains(log, "muted-ci-7 muted by --mute-host (3 muted events dropped)") {
+		t.Errorf("log %q, want the running count of muted events", log)
+	}
+}
+
+func TestPublishDetectionsMergesEnrichedFields(t *testing.T) {
+	for name, tt := range map[string]struct {
+		command string
+		want    map[string]string
+	}{
+		"hook adding a field": {`cat >/dev/null; echo '{"owner": "payments"}'`, map[string]string{"rule": "stress", "owner": "payments"}},
+		"failing hook":        {`exit 1`, map[string]string{"rule": "stress"}},
+	} {
+		events := bus.New[notifier.OOMEvent](10)
+		detected := events.Subscribe(bus.TopicDetected)
+		eventChan := make(chan monitor.OOMEventData, 1)
+		eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "4242", Cmdline: "stress --vm 1", Hostname: "node-1", Fields: map[string]string{"rule": "stress"}}
+		close(eventChan)
+
+		publishDetections(eventChan, events, nil, nil, nil, enrich.NewCommand(tt.command, 5*time.Second))
+
+		got := collect(t, detected)
+		if len(got) != 1 || !reflect.DeepEqual(got[0].Fields, tt.want) {
+			t.Errorf("%s: published %+v, want fields %v", name, got, tt.want)
+		}
+	}
+}
+
+func TestPublishDetectionsCarriesContext(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	eventChan := make(chan monitor.OOMEventData, 1)
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "4242", Cmdline: "stress --vm 1", Context: "Free swap  = 0kB\nOut of memory: Killed process 4242 (stress)"}
+	close(eventChan)
+
+	publishDetections(eventChan, events, nil, nil, nil, nil)
+	if got := collect(t, detected); len(got) != 1 || got[0].Context != "Free swap  = 0kB\nOut of memory: Killed process 4242 (stress)" {
+		t.Errorf("published %+v, want the kernel log context of the kill", got)
+	}
+}
+
+func TestFilterStage(t *testing.T) {
+	cmdline, err := notifier.NewCmdlineFilter(nil, []string{"^ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := filterSettings{cmdline: cmdline, dedupWindow: time.Minute}
+
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	enriched := events.Subscribe(bus.TopicEnriched)
+	done := make(chan struct{})
+	go func() {
+		filterStage(events, detected, settings, nil, nil, nil, nil, nil, nil, nil)
+		close(done)
+	}()
+
+	events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: "1", Cmdline: "ignored-job", Hostname: "h"})
+	events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: "2", Cmdline: "java -jar app.jar", Hostname: "h"})
+	events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: "2", Cmdline: "java -jar app.jar", Hostname: "h"})
+	events.CloseTopic(bus.TopicDetected)
+
+	got := collect(t, enriched)
+	if len(got) != 1 || got[0].PID != "2" {
+		t.Errorf("delivered %+v, want PID 2 once", got)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("filter stage did not return once its topic closed")
+	}
+}
+
+func TestFilterStageFiltersByUID(t *testing.T) {
+	uid, err := notifier.NewUIDFilter(nil, []string{"0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	enriched := events.Subscribe(bus.TopicEnriched)
+	go filterStage(events, detected, filterSettings{uid: uid}, nil, nil, nil, nil, nil, nil, nil)
+
+	events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: "1", Cmdline: "systemd-journald", Hostname: "h", UID: "0"})
+	events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: "2", Cmdline: "java -jar app.jar", Hostname: "h", UID: "1000"})
+	events.CloseTopic(bus.TopicDetected)
+
+	if got := collect(t, enriched); len(got) != 1 || got[0].PID != "2" {
+		t.Errorf("delivered %+v, want only the kill of UID 1000", got)
+	}
+}
+
+func TestFilterStageAppliesUpdates(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	enriched := events.Subscribe(bus.TopicEnriched)
+	updates := make(chan filterSettings, 1)
+	go filterStage(events, detected, filterSettings{}, updates, nil, nil, nil, nil, nil, nil)
+
+	event := notifier.OOMEvent{Kind: monitor.KindOOM, PID: "1", Cmdline: "java", Hostname: "h"}
+	events.Publish(bus.TopicDetected, event)
+	if got := <-enriched; got.PID != "1" {
+		t.Fatalf("delivered PID %s, want 1", got.PID)
+	}
+
+	cmdline, err := notifier.NewCmdlineFilter(nil, []string{"java"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendFilterSettings(updates, filterSettings{cmdline: cmdline})
+	// The stage applies an update before it reads the next event, wait
+	// until it took it
+	for len(updates) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	events.Publish(bus.TopicDetected, event)
+	events.CloseTopic(bus.TopicDetected)
+	if got := collect(t, enriched); len(got) != 0 {
+		t.Errorf("delivered %+v after the filter was updated", got)
+	}
+}
+
+func TestFilterStageRateLimitsBurst(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](50)
+	detected := events.Subscribe(bus.TopicDetected)
+	enriched := events.Subscribe(bus.TopicEnriched)
+	limiter := notifier.NewRateLimiter(3)
+	go filterStage(events, detected, filterSettings{}, nil, nil, nil, nil, nil, nil, limiter)
+
+	for i := 0; i < 10; i++ {
+		events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: strconv.Itoa(i), Cmdline: "java", Hostname: "h"})
+	}
+	events.CloseTopic(bus.TopicDetected)
+
+	if got := collect(t, enriched); len(got) != 3 {
+		t.Errorf("%d of a burst of 10 events forwarded, want 3", len(got))
+	}
+	if dropped := limiter.Dropped(); dropped != 7 {
+		t.Errorf("Dropped() = %d, want 7", dropped)
+	}
+}
+
+func TestPublishDetectionsNamesPodOfMemcgKills(t *testing.T) {
+	const containerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	kubelet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items": [{"metadata": {"name": "api-7d9f", "namespace": "payments", "uid": "1a2b3c4d-0000-1111-2222-333344445555"},
+			"status": {"containerStatuses": [{"name": "api", "containerID": "containerd://` + containerID + `"}]}}]}`))
+	}))
+	defer kubelet.Close()
+
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	cgroup := "/kubepods/burstable/pod1a2b3c4d-0000-1111-2222-333344445555/" + containerID
+	eventChan := make(chan monitor.OOMEventData, 2)
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "1", Cmdline: "api", Hostname: "node-1", OOMType: monitor.OOMTypeMemcg, TaskCgroup: cgroup, Cgroup: cgroup}
+	// Global kills are not looked up, even from a pod
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "2", Cmdline: "api", Hostname: "node-1", OOMType: monitor.OOMTypeGlobal, TaskCgroup: cgroup}
+	close(eventChan)
+
+	publishDetections(eventChan, events, nil, kube.NewResolver(kubelet.URL), nil, nil)
+
+	got := collect(t, detected)
+	if len(got) != 2 {
+		t.Fatalf("published %d events, want 2", len(got))
+	}
+	if got[0].PodName != "api-7d9f" || got[0].Namespace != "payments" || got[0].ContainerName != "api" {
+		t.Errorf("memcg kill not enriched: %+v", got[0])
+	}
+	if got[1].PodName != "" {
+		t.Errorf("global kill enriched with pod %q", got[1].PodName)
+	}
+}
+
+func TestCountKillsCountsOnlyKills(t *testing.T) {
+	detected := make(chan notifier.OOMEvent, 3)
+	detected <- notifier.OOMEvent{Kind: monitor.KindOOM, Hostname: "node-1", Cmdline: "java"}
+	detected <- notifier.OOMEvent{Kind: monitor.KindSegfault, Hostname: "node-1", Cmdline: "java"}
+	detected <- notifier.OOMEvent{Kind: monitor.KindOOM, Hostname: "node-1", Cmdline: "java"}
+	close(detected)
+
+	tally := notifier.NewTally()
+	countKills(tally, detected)
+	if report := tally.Take(); report.Total != 2 {
+		t.Errorf("counted %d kills, want the 2 OOM kills", report.Total)
+	}
+}
+
+func TestFilterStageEscalatesThroughCooldown(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](50)
+	detected := events.Subscribe(bus.TopicDetected)
+	enriched := events.Subscribe(bus.TopicEnriched)
+	flaps := notifier.NewFlapDetector(3, time.Hour)
+	go filterStage(events, detected, filterSettings{}, nil, nil, flaps, notifier.NewCooldown(time.Hour), nil, nil, nil)
+
+	for i := 0; i < 4; i++ {
+		events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: strconv.Itoa(i), Cmdline: "java", Hostname: "h"})
+	}
+	events.CloseTopic(bus.TopicDetected)
+
+	got := collect(t, enriched)
+	if len(got) != 2 {
+		t.Fatalf("%d events forwarded, want the first and the escalation past the cooldown", len(got))
+	}
+	if got[1].Severity != notifier.SeverityHigh || got[1].Repeats != 3 {
+		t.Errorf("second event of severity %q with %d repeats, want the escalation", got[1].Severity, got[1].Repeats)
+	}
+}
+
+func TestFilterStageSendsRecoveries(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](50)
+	detected := events.Subscribe(bus.TopicDetected)
+	enriched := events.Subscribe(bus.TopicEnriched)
+	flaps := notifier.NewFlapDetector(2, time.Minute)
+	flaps.SetRecoveryWindow(10 * time.Millisecond)
+	go filterStage(events, detected, filterSettings{}, nil, nil, flaps, nil, nil, nil, nil)
+	defer events.CloseTopic(bus.TopicDetected)
+
+	for i := 0; i < 2; i++ {
+		events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: strconv.Itoa(i), Cmdline: "java", Hostname: "h"})
+	}
+	var got []notifier.OOMEvent
+	timeout := time.After(3 * recoveryCheck)
+	for len(got) < 3 {
+		select {
+		case event := <-enriched:
+			got = append(got, event)
+		case <-timeout:
+			t.Fatalf("forwarded %+v, want both kills and a recovery", got)
+		}
+	}
+	if recovery := got[2]; recovery.Kind != notifier.KindRecovery || recovery.Severity != notifier.SeverityRecovered || recovery.Repeats != 2 {
+		t.Errorf("third event %+v, want the recovery of the 2 kills", recovery)
+	}
+	select {
+	case event := <-enriched:
+		t.Errorf("forwarded %+v after the recovery", event)
+	case <-time.After(recoveryCheck + 100*time.Millisecond):
+	}
+}
+
+func TestFilterStageSamplesBursts(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](50)
+	detected := events.Subscribe(bus.TopicDetected)
+	enriched := events.Subscribe(bus.TopicEnriched)
+	go filterStage(events, detected, filterSettings{}, nil, nil, nil, nil, notifier.NewExponentialSampler(time.Hour), nil, nil)
+
+	for i := 0; i < 10; i++ {
+		events.Publish(bus.TopicDetected, notifier.OOMEvent{Kind: monitor.KindOOM, PID: strconv.Itoa(i), Cmdline: "java", Hostname: "h"})
+	}
+	events.CloseTopic(bus.TopicDetected)
+
+	var pids []string
+	for _, event := range collect(t, enriched) {
+		pids = append(pids, event.PID)
+	}
+	if got := strings.Join(pids, ","); got != "0,1,3,7" {
+		t.Errorf("forwarded PIDs %s of a burst of 10, want the 1st, 2nd, 4th and 8th", got)
+	}
+}
+
+func TestDrainMonitorErrorsCountsByCategory(t *testing.T) {
+	readLog := logToFile(t)
+	errs := make(chan *monitor.MonitorError, 3)
+	errs <- &monitor.MonitorError{Category: "test-read", Err: errors.New("kmsg gone")}
+	errs <- &monitor.MonitorError{Category: "test-read", Err: errors.New("kmsg gone again")}
+	errs <- &monitor.MonitorError{Category: "test-parse", Err: errors.New("no PID found")}
+
+	drainMonitorErrors(errs)
+	if len(errs) != 0 {
+		t.Errorf("%d errors left queued", len(errs))
+	}
+	out := scrape(t, metrics.Handler())
+	for _, want := range []string{`oom_monitor_errors_total{category="test-read"} 2`, `oom_monitor_errors_total{category="test-parse"} 1`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("scrape does not contain %s", want)
+		}
+	}
+	if log := readLog(); !strings.Contains(log, "test-parse") || !strings.Contains(log, "no PID found") {
+		t.Errorf("log %q, want the error with its category", log)
+	}
+}
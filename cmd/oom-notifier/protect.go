@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// selfOOMScoreAdj is the oom_score_adj file of this process, a variable so
+// that it can be pointed at a fake proc tree.
+var selfOOMScoreAdj = "/proc/self/oom_score_adj"
+
+// protectSelf writes score to the oom_score_adj of this process, so that
+// the OOM killer spares the notifier that would report its kills. Lowering
+// the score needs CAP_SYS_RESOURCE; a failure is logged and monitoring goes
+// on unprotected.
+func protectSelf(score int) {
+	if err := os.WriteFile(selfOOMScoreAdj, []byte(strconv.Itoa(score)), 0o644); err != nil {
+		logger.Warn("Failed to protect oom-notifier from the OOM killer, continuing without: %v", err)
+		return
+	}
+	logger.Info("Set oom_score_adj of oom-notifier to %d", score)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProtectSelfWritesScore(t *testing.T) {
+	readLog := logToFile(t)
+	path := filepath.Join(t.TempDir(), "oom_score_adj")
+	if err := os.WriteFile(path, []byte("0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	override(t, &selfOOMScoreAdj, path)
+
+	protectSelf(-900)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "-900" {
+		t.Errorf("oom_score_adj = %q, want -900", data)
+	}
+	if !strings.Contains(readLog(), "Set oom_score_adj of oom-notifier to -900") {
+		t.Errorf("log lacks the new score:\n%s", readLog())
+	}
+}
+
+func TestProtectSelfContinuesAfterFailedWrite(t *testing.T) {
+	readLog := logToFile(t)
+	// The parent directory is missing, as the write fails without privilege
+	override(t, &selfOOMScoreAdj, filepath.Join(t.TempDir(), "missing", "oom_score_adj"))
+
+	protectSelf(-1000)
+	if !strings.Contains(readLog(), "Failed to protect oom-notifier from the OOM killer, continuing without") {
+		t.Errorf("log lacks the failure:\n%s", readLog())
+	}
+}
+
+func TestRunProtectsSelf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oom_score_adj")
+	override(t, &selfOOMScoreAdj, path)
+	override(t, &protectSelfOOM, true)
+
+	if _, err := runReplay(t, replayedKill, http.StatusOK, nil); err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "-1000" {
+		t.Errorf("oom_score_adj = %q, %v, want the default -1000", data, err)
+	}
+}
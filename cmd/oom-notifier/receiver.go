@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/oom-notifier/go/internal/bus"
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/metrics"
+	"github.com/oom-notifier/go/internal/monitor"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// maxReceivedEvent bounds the body of a received event, or of a batch of
+// events, once decompressed.
+const maxReceivedEvent = 1 << 20
+
+// receiveHandler accepts events POSTed by the webhook notifier of other
+// hosts and publishes them as detections, so that they go through the same
+// filters and notifiers as local ones. Bodies may be gzip compressed and
+// hold a JSON array of events, as sent with --webhook-gzip and
+// --webhook-batch. When secret is set, requests must carry a valid
+// X-Signature of the uncompressed body. Events that name no host are tagged
+// with the address of the sender, and those of hosts muted by mutes, which
+// may be nil, are dropped.
+func receiveHandler(events *bus.Bus[notifier.OOMEvent], secret string, mutes *notifier.HostMutes) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		reader := io.Reader(http.MaxBytesReader(w, r.Body, maxReceivedEvent))
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(reader)
+			if err != nil {
+				http.Error(w, "invalid gzip body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			reader = zr
+		}
+		body, err := io.ReadAll(io.LimitReader(reader, maxReceivedEvent+1))
+		if err != nil || len(body) > maxReceivedEvent {
+			http.Error(w, "failed to read event", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if secret != "" && !notifier.VerifySignature([]byte(secret), body, r.Header.Get("X-Signature")) {
+			logger.Warn("Rejected event from %s with an invalid signature", r.RemoteAddr)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var received []notifier.OOMEvent
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(body, &received)
+		} else {
+			var event notifier.OOMEvent
+			err = json.Unmarshal(body, &event)
+			received = append(received, event)
+		}
+		if err != nil {
+			http.Error(w, "invalid event: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, event := range received {
+			publishReceived(events, event, r.RemoteAddr, mutes)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// publishReceived publishes an event received from the host at remoteAddr.
+func publishReceived(events *bus.Bus[notifier.OOMEvent], event notifier.OOMEvent, remoteAddr string, mutes *notifier.HostMutes) {
+	if event.Hostname == "" {
+		event.Hostname = remoteAddr
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			event.Hostname = host
+		}
+	}
+	if event.Kind == "" {
+		event.Kind = monitor.KindOOM
+	}
+	if event.GroupKey == "" {
+		event.GroupKey = event.Fingerprint()
+	}
+
+	logger.Info("Event received from another host",
+		logger.F("kind", event.Kind), logger.F("hostname", event.Hostname), logger.F("cmdline", event.Cmdline))
+	if event.Kind == monitor.KindOOM && !event.Test {
+		metrics.OOMEvents.Inc(event.Hostname, event.Cmdline)
+		reporter.OOMEvent(event.Hostname)
+	}
+	if dropMuted(mutes, event.Kind, event.Hostname) {
+		return
+	}
+	events.Publish(bus.TopicDetected, event)
+}
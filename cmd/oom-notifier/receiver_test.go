@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oom-notifier/go/internal/bus"
+	"github.com/oom-notifier/go/internal/monitor"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// receive serves req with a receiveHandler checking secret and mutes and
+// returns the response status and the events it published.
+func receive(t *testing.T, secret string, mutes *notifier.HostMutes, req *http.Request) (int, []notifier.OOMEvent) {
+	t.Helper()
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+
+	rec := httptest.NewRecorder()
+	receiveHandler(events, secret, mutes).ServeHTTP(rec, req)
+	events.CloseTopic(bus.TopicDetected)
+	return rec.Code, collect(t, detected)
+}
+
+// postEvents returns a POST of body to /events from 192.0.2.7.
+func postEvents(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewBufferString(body))
+	req.RemoteAddr = "192.0.2.7:41234"
+	return req
+}
+
+func TestReceiveHandlerPublishesEvents(t *testing.T) {
+	status, got := receive(t, "", nil, postEvents(`{"pid": "4242", "cmdline": "stress --vm 1", "hostname": "node-1"}`))
+	if status != http.StatusAccepted {
+		t.Fatalf("status %d, want %d", status, http.StatusAccepted)
+	}
+	if len(got) != 1 {
+		t.Fatalf("published %d events, want 1", len(got))
+	}
+	if event := got[0]; event.Hostname != "node-1" || event.Kind != monitor.KindOOM || event.GroupKey != event.Fingerprint() {
+		t.Errorf("published %+v, want an OOM kill of node-1 with its fingerprint", event)
+	}
+}
+
+func TestReceiveHandlerTagsSender(t *testing.T) {
+	_, got := receive(t, "", nil, postEvents(`{"pid": "4242", "cmdline": "stress --vm 1"}`))
+	if len(got) != 1 || got[0].Hostname != "192.0.2.7" {
+		t.Errorf("published %+v, want the event tagged with the sender's address", got)
+	}
+}
+
+func TestReceiveHandlerAcceptsGzipBatches(t *testing.T) {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	zw.Write([]byte(`[{"pid": "1", "cmdline": "java", "hostname": "node-1"}, {"pid": "2", "cmdline": "java", "hostname": "node-2"}]`))
+	zw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/events", &body)
+	req.Header.Set("Content-Encoding", "gzip")
+
+	status, got := receive(t, "", nil, req)
+	if status != http.StatusAccepted {
+		t.Fatalf("status %d, want %d", status, http.StatusAccepted)
+	}
+	if len(got) != 2 || got[0].Hostname != "node-1" || got[1].Hostname != "node-2" {
+		t.Errorf("published %+v, want both events of the batch", got)
+	}
+}
+
+func TestReceiveHandlerChecksSignature(t *testing.T) {
+	const body = `{"pid": "4242", "cmdline": "stress --vm 1", "hostname": "node-1"}`
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+
+	signed := postEvents(body)
+	signed.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+	if status, got := receive(t, "s3cret", nil, signed); status != http.StatusAccepted || len(got) != 1 {
+		t.Errorf("signed event: status %d, %d events published", status, len(got))
+	}
+
+	forged := postEvents(body)
+	forged.Header.Set("X-Signature", "0000")
+	for name, req := range map[string]*http.Request{"unsigned": postEvents(body), "forged": forged} {
+		if status, got := receive(t, "s3cret", nil, req); status != http.StatusUnauthorized || len(got) != 0 {
+			t.Errorf("%s event: status %d, %d events published, want it rejected", name, status, len(got))
+		}
+	}
+}
+
+func TestReceiveHandlerRejectsBadRequests(t *testing.T) {
+	for name, tt := range map[string]struct {
+		req  *http.Request
+		want int
+	}{
+		"GET":          {httptest.NewRequest(http.MethodGet, "/events", nil), http.StatusMethodNotAllowed},
+		"invalid JSON": {postEvents(`{"pid":`), http.StatusBadRequest},
+		"invalid gzip": {func() *http.Request {
+			req := postEvents("not gzip")
+			req.Header.Set("Content-Encoding", "gzip")
+			return req
+		}(), http.StatusBadRequest},
+	} {
+		if status, got := receive(t, "", nil, tt.req); status != tt.want || len(got) != 0 {
+			t.Errorf("%s: status %d, %d events published, want %d", name, status, len(got), tt.want)
+		}
+	}
+}
+
+func TestReceiveHandlerDropsMutedHosts(t *testing.T) {
+	mutes, err := notifier.NewHostMutes([]string{"noisy-.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, got := receive(t, "", mutes, postEvents(`[{"pid": "1", "cmdline": "a", "hostname": "noisy-1"}, {"pid": "2", "cmdline": "b", "hostname": "quiet-1"}]`))
+	if len(got) != 1 || got[0].Hostname != "quiet-1" {
+		t.Errorf("published %+v, want only the event of quiet-1", got)
+	}
+}
+
+func TestReceivedEventsReachNotifiers(t *testing.T) {
+	useLedger(t)
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	enriched := events.Subscribe(bus.TopicEnriched)
+	go filterStage(events, detected, filterSettings{}, nil, nil, nil, nil, nil, nil, nil)
+
+	rec := httptest.NewRecorder()
+	receiveHandler(events, "", nil).ServeHTTP(rec, postEvents(`{"id": "agent-1", "pid": "4242", "cmdline": "stress --vm 1", "hostname": "node-1"}`))
+	events.CloseTopic(bus.TopicDetected)
+
+	fake := &fakeNotifier{name: "fake"}
+	for _, event := range collect(t, enriched) {
+		sendNotification(context.Background(), []notifier.Notifier{fake}, event)
+	}
+	if sent := fake.sent(); len(sent) != 1 || sent[0].Hostname != "node-1" || sent[0].PID != "4242" {
+		t.Errorf("notifier sent %+v, want the received kill of node-1", sent)
+	}
+}
+
+func TestReceiveHandlerAcceptsWebhookBatches(t *testing.T) {
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	server := httptest.NewServer(receiveHandler(events, "s3cret", nil))
+	defer server.Close()
+
+	webhook := notifier.NewWebhookNotifier(server.URL+"/events", "s3cret", notifier.NewHTTPClient(5*time.Second, nil))
+	webhook.Gzip = true
+	webhook.Batch = true
+	batch := []notifier.OOMEvent{
+		{Kind: monitor.KindOOM, PID: "4242", Cmdline: "stress --vm 1", Hostname: "node-1"},
+		{Kind: monitor.KindOOM, PID: "4343", Cmdline: "java", Hostname: "node-2"},
+	}
+	if err := webhook.NotifyBatch(context.Background(), batch); err != nil {
+		t.Fatalf("NotifyBatch: %v", err)
+	}
+	events.CloseTopic(bus.TopicDetected)
+
+	got := collect(t, detected)
+	if len(got) != 2 || got[0].PID != "4242" || got[1].Hostname != "node-2" {
+		t.Errorf("published %+v, want both events of the signed gzip batch", got)
+	}
+}
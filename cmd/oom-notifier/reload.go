@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+
+	"github.com/oom-notifier/go/internal/config"
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// reloadableFlags can be changed by reloading the config file on SIGHUP. The
+// others are only read at startup.
+var reloadableFlags = map[string]bool{
+	"slack-channel":   true,
+	"channel-route":   true,
+	"include-cmdline": true,
+	"exclude-cmdline": true,
+	"include-uid":     true,
+	"exclude-uid":     true,
+	"min-rss":         true,
+	"timezone":        true,
+	"dedup-window":    true,
+}
+
+// pinnedFlags are the flags set on the command line or from the environment
+// at startup. They win over the config file, also when it is reloaded.
+var pinnedFlags = map[string]bool{}
+
+// pinFlags records the flags set so far in fs as pinned.
+func pinFlags(fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		pinnedFlags[f.Name] = true
+	})
+}
+
+// applyReload reloads the config file and applies the changes to the Slack
+// notifier, which may be nil, the timezone and the filter stage. It runs on
+// the main loop, the only goroutine using the notifiers.
+func applyReload(slack *notifier.SlackNotifier, filterUpdates chan filterSettings) {
+	logger.Info("Received SIGHUP, reloading config file %s", configFile)
+	changed, restart, err := reloadConfig(flag.CommandLine, configFile, validateConfig)
+	if err != nil {
+		logger.Error("Failed to reload config file, keeping the current configuration: %v", err)
+		return
+	}
+	for _, name := range restart {
+		logger.Warn("--%s changed in the config file but can only be changed by a restart", name)
+	}
+	if len(changed) == 0 {
+		logger.Info("Config file reloaded, no changes to apply")
+		return
+	}
+
+	if slack != nil {
+		// Already validated by reloadConfig
+		routes, _ := notifier.ParseChannelRoutes(channelRoutes)
+		slack.Channel, _ = notifier.NormalizeSlackChannel(slackChannel)
+		slack.Routes = routes
+	}
+	// Already validated by reloadConfig, a failure keeps the current zone
+	if err := notifier.SetTimezone(timezone); err != nil {
+		logger.Error("Failed to apply reloaded timezone: %v", err)
+	}
+	settings, err := newFilterSettings()
+	if err != nil {
+		logger.Error("Failed to apply reloaded filters: %v", err)
+	} else {
+		sendFilterSettings(filterUpdates, settings)
+	}
+	logger.Info("Config file reloaded, changed %s", "--"+strings.Join(changed, ", --"))
+}
+
+// reloadConfig reads the config file at path again and applies the changes
+// to reloadable flags, leaving the others as they were. Keys removed from
+// the file revert to their defaults. When the new values fail validation
+// nothing is changed. It returns the names of the flags that changed and of
+// those whose change needs a restart.
+func reloadConfig(fs *flag.FlagSet, path string, validate func() []string) (changed, restart []string, err error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := cfg.Values()
+
+	previous := make(map[string][]string)
+	var restore error
+	fs.VisitAll(func(f *flag.Flag) {
+		if pinnedFlags[f.Name] || restore != nil {
+			return
+		}
+
+		want, inFile := values[f.Name]
+		if !inFile {
+			want = defaultValues(f)
+		}
+		current := flagValues(f)
+		if equalValues(current, want) {
+			return
+		}
+		if !reloadableFlags[f.Name] {
+			restart = append(restart, f.Name)
+			return
+		}
+
+		previous[f.Name] = current
+		if err := setValues(f, want); err != nil {
+			restore = fmt.Errorf("invalid value %q for %s: %v", strings.Join(want, ","), f.Name, err)
+			return
+		}
+		changed = append(changed, f.Name)
+	})
+
+	if restore == nil {
+		if problems := validate(); len(problems) > 0 {
+			restore = fmt.Errorf("%s", strings.Join(problems, "; "))
+		}
+	}
+	if restore != nil {
+		for name, values := range previous {
+			setValues(fs.Lookup(name), values)
+		}
+		return nil, nil, restore
+	}
+	return changed, restart, nil
+}
+
+// flagValues returns the current values of f, one per value of a repeatable
+// flag.
+func flagValues(f *flag.Flag) []string {
+	if slice, ok := f.Value.(flag.SliceValue); ok {
+		return slice.GetSlice()
+	}
+	return []string{f.Value.String()}
+}
+
+// defaultValues returns the values f had before any was set.
+func defaultValues(f *flag.Flag) []string {
+	if _, ok := f.Value.(flag.SliceValue); ok {
+		return nil
+	}
+	return []string{f.DefValue}
+}
+
+func setValues(f *flag.Flag, values []string) error {
+	if slice, ok := f.Value.(flag.SliceValue); ok {
+		return slice.Replace(values)
+	}
+	return f.Value.Set(values[0])
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oom-notifier/go/internal/notifier"
+	flag "github.com/spf13/pflag"
+)
+
+// writeConfigFile writes content to a config file and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReloadConfigAppliesReloadableFlags(t *testing.T) {
+	override(t, &pinnedFlags, map[string]bool{})
+	override(t, &webhookURL, "http://127.0.0.1:9/oom")
+	override(t, &slackChannel, slackChannel)
+	override(t, &excludeCmdlines, nil)
+	override(t, &dedupWindow, dedupWindow)
+	override(t, &timezone, timezone)
+	override(t, &processRefresh, processRefresh)
+	path := writeConfigFile(t, `
+webhook:
+  url: http://127.0.0.1:9/oom
+slack:
+  channel: "#oom"
+alerts:
+  exclude_cmdlines: [chrome]
+  dedup_window: 120
+  timezone: Europe/Berlin
+monitor:
+  process_refresh: 30
+`)
+	refresh := processRefresh
+
+	changed, restart, err := reloadConfig(flag.CommandLine, path, validateConfig)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if want := []string{"dedup-window", "exclude-cmdline", "slack-channel", "timezone"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed %v, want %v", changed, want)
+	}
+	if slackChannel != "#oom" || dedupWindow != 120 || timezone != "Europe/Berlin" || !reflect.DeepEqual(excludeCmdlines, []string{"chrome"}) {
+		t.Errorf("reloaded channel %q, dedup window %d, timezone %q, excluded %v", slackChannel, dedupWindow, timezone, excludeCmdlines)
+	}
+	if !reflect.DeepEqual(restart, []string{"process-refresh"}) || processRefresh != refresh {
+		t.Errorf("restart %v with --process-refresh %d, want it left at %d until a restart", restart, processRefresh, refresh)
+	}
+
+	// Keys removed from the file revert to their defaults
+	changed, _, err = reloadConfig(flag.CommandLine, writeConfigFile(t, "webhook:\n  url: http://127.0.0.1:9/oom\n"), validateConfig)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if slackChannel != flag.Lookup("slack-channel").DefValue || len(excludeCmdlines) != 0 {
+		t.Errorf("changed %v to channel %q and excluded %v, want the defaults", changed, slackChannel, excludeCmdlines)
+	}
+}
+
+func TestReloadConfigRejectsInvalidValues(t *testing.T) {
+	override(t, &pinnedFlags, map[string]bool{})
+	override(t, &webhookURL, "http://127.0.0.1:9/oom")
+	override(t, &slackChannel, slackChannel)
+	override(t, &timezone, timezone)
+	channel, zone := slackChannel, timezone
+
+	for name, content := range map[string]string{
+		"failing validation": "webhook:\n  url: http://127.0.0.1:9/oom\nslack:\n  channel: \"#oom\"\nalerts:\n  timezone: Mars/Olympus_Mons\n",
+		"unknown key":        "webhook:\n  url: http://127.0.0.1:9/oom\nslack:\n  chanel: \"#oom\"\n",
+	} {
+		if _, _, err := reloadConfig(flag.CommandLine, writeConfigFile(t, content), validateConfig); err == nil {
+			t.Errorf("%s: reload succeeded", name)
+		}
+		if slackChannel != channel || timezone != zone {
+			t.Errorf("%s: channel %q and timezone %q, want %q and %q kept", name, slackChannel, timezone, channel, zone)
+		}
+	}
+}
+
+func TestReloadConfigKeepsPinnedFlags(t *testing.T) {
+	override(t, &pinnedFlags, map[string]bool{"slack-channel": true})
+	override(t, &webhookURL, "http://127.0.0.1:9/oom")
+	override(t, &slackChannel, "#from-command-line")
+
+	changed, _, err := reloadConfig(flag.CommandLine, writeConfigFile(t, "webhook:\n  url: http://127.0.0.1:9/oom\nslack:\n  channel: \"#oom\"\n"), validateConfig)
+	if err != nil {
+		t.Fatalf("reloadConfig: %v", err)
+	}
+	if len(changed) != 0 || slackChannel != "#from-command-line" {
+		t.Errorf("changed %v to channel %q, want the command line to win", changed, slackChannel)
+	}
+}
+
+func TestApplyReloadUpdatesSlackAndFilters(t *testing.T) {
+	override(t, &pinnedFlags, map[string]bool{"config": true})
+	override(t, &webhookURL, "http://127.0.0.1:9/oom")
+	override(t, &slackWebhooks, []string{"https://hooks.slack.com/services/T0/B0/x"})
+	override(t, &slackChannel, slackChannel)
+	override(t, &channelRoutes, nil)
+	override(t, &excludeCmdlines, nil)
+	override(t, &dedupWindow, dedupWindow)
+	override(t, &configFile, writeConfigFile(t, `
+webhook:
+  url: http://127.0.0.1:9/oom
+slack:
+  webhooks: [https://hooks.slack.com/services/T0/B0/x]
+  channel: oom
+  channel_routes: ["^postgres=#db-alerts"]
+alerts:
+  exclude_cmdlines: [chrome]
+  dedup_window: 120
+`))
+	slack := notifier.NewSlackNotifier(slackWebhooks, "#alerts", nil, notifier.SlackModeAll, notifier.SlackFormatAttachment, nil, notifier.NewHTTPClient(time.Second, nil))
+	updates := make(chan filterSettings, 1)
+
+	applyReload(slack, updates)
+	if slack.Channel != "#oom" || len(slack.Routes) != 1 {
+		t.Errorf("Slack channel %q with %d routes, want #oom and the route", slack.Channel, len(slack.Routes))
+	}
+	select {
+	case settings := <-updates:
+		if settings.cmdline == nil || settings.dedupWindow != 120*time.Second {
+			t.Errorf("filter settings %+v, want the command line filter and a 2m dedup window", settings)
+		}
+	default:
+		t.Error("no filter settings sent to the filter stage")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/metrics"
+	"github.com/oom-notifier/go/internal/monitor"
+)
+
+// startServers serves the metrics endpoint on metricsAddr, the health
+// endpoints on healthAddr, the runtime profiles and the process cache of
+// cache on pprofAddr and receiver at /events on receiveAddr in the
+// background; an empty address disables the endpoints. Endpoints configured
+// on the same address share a server. A failure to listen is logged but does
+// not stop monitoring.
+func startServers(metricsAddr, healthAddr, pprofAddr, receiveAddr string, ready func() error, cache processCacheSource, receiver http.Handler) []*http.Server {
+	muxes := make(map[string]*http.ServeMux)
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+
+	if metricsAddr != "" {
+		mux(metricsAddr).Handle("/metrics", metrics.Handler())
+	}
+	if healthAddr != "" {
+		mux(healthAddr).HandleFunc("/healthz", healthHandler)
+		mux(healthAddr).Handle("/readyz", readyHandler(ready))
+	}
+	if pprofAddr != "" {
+		// Registered explicitly, importing net/http/pprof also adds the
+		// handlers to http.DefaultServeMux which is never served
+		mux(pprofAddr).HandleFunc("/debug/pprof/", pprof.Index)
+		mux(pprofAddr).HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux(pprofAddr).HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux(pprofAddr).HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux(pprofAddr).HandleFunc("/debug/pprof/trace", pprof.Trace)
+		mux(pprofAddr).Handle("/debug/process-cache", processCacheHandler(cache))
+	}
+	if receiveAddr != "" {
+		mux(receiveAddr).Handle("/events", receiver)
+	}
+
+	var servers []*http.Server
+	for addr, handler := range muxes {
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		servers = append(servers, server)
+
+		go func() {
+			logger.Info("Serving HTTP endpoints on %s", server.Addr)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("HTTP server on %s failed: %v", server.Addr, err)
+			}
+		}()
+	}
+	return servers
+}
+
+// healthHandler answers liveness probes, the process is alive if it serves
+// the request at all.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readyHandler answers readiness probes with 503 and the reason while ready
+// returns an error.
+func readyHandler(ready func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := ready(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// processCacheSource is the process cache dumped by processCacheHandler,
+// implemented by monitor.OOMMonitor.
+type processCacheSource interface {
+	CachedEntries() [][]monitor.ProcessInfo
+	LastRefresh() time.Time
+}
+
+// cachedProcess is a process cache entry as dumped by processCacheHandler.
+// Tree is the index of the proc directory the process was read from, in
+// --proc-dir order. The environment is left out, it may carry secrets.
+type cachedProcess struct {
+	Tree     int    `json:"tree"`
+	PID      int    `json:"pid"`
+	PPID     int    `json:"ppid,omitempty"`
+	UID      string `json:"uid,omitempty"`
+	Cmdline  string `json:"cmdline"`
+	FromComm bool   `json:"from_comm,omitempty"`
+}
+
+// processCacheHandler dumps the process cache as JSON, to find out why
+// events name the wrong or an unknown process.
+func processCacheHandler(cache processCacheSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dump := struct {
+			Size        int             `json:"size"`
+			LastRefresh time.Time       `json:"last_refresh"`
+			Processes   []cachedProcess `json:"processes"`
+		}{LastRefresh: cache.LastRefresh(), Processes: []cachedProcess{}}
+		for tree, entries := range cache.CachedEntries() {
+			for _, proc := range entries {
+				dump.Processes = append(dump.Processes, cachedProcess{
+					Tree:     tree,
+					PID:      proc.PID,
+					PPID:     proc.PPID,
+					UID:      proc.UID,
+					Cmdline:  proc.Cmdline,
+					FromComm: proc.FromComm,
+				})
+			}
+		}
+		dump.Size = len(dump.Processes)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dump); err != nil {
+			logger.Debug("Failed to write process cache dump: %v", err)
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/oom-notifier/go/internal/bus"
+	"github.com/oom-notifier/go/internal/metrics"
+	"github.com/oom-notifier/go/internal/monitor"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// scrape returns the body served by handler at /metrics.
+func scrape(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics = %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetricsEndpointCountsEventsAndNotifications(t *testing.T) {
+	m, err := monitor.NewOOMMonitor(monitor.Options{
+		Source: monitor.NewLineSource(strings.NewReader("")),
+		ProcFS: []fs.FS{fstest.MapFS{
+			"sys/kernel/pid_max": {Data: []byte("32768\n")},
+			"100/cmdline":        {Data: []byte("nginx\x00-g\x00daemon off;\x00")},
+			"200/cmdline":        {Data: []byte("postgres\x00")},
+		}},
+		CheckInterval:   time.Second,
+		RefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+	registerMetrics(m, nil, nil)
+
+	eventChan := make(chan monitor.OOMEventData, 3)
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "1", Cmdline: "stress --vm 1", Hostname: "metrics-node"}
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "2", Cmdline: "stress --vm 1", Hostname: "metrics-node"}
+	eventChan <- monitor.OOMEventData{Kind: monitor.KindOOM, PID: "3", Cmdline: "java", Hostname: "metrics-node"}
+	close(eventChan)
+	events := bus.New[notifier.OOMEvent](10)
+	detected := events.Subscribe(bus.TopicDetected)
+	publishDetections(eventChan, events, nil, nil, nil, nil)
+	collect(t, detected)
+
+	ok := &fakeNotifier{name: "metrics-ok"}
+	failing := &fakeNotifier{name: "metrics-failing", err: errors.New("down")}
+	sendNotification(context.Background(), []notifier.Notifier{ok, failing}, testKill("a"))
+	sendNotification(context.Background(), []notifier.Notifier{ok}, testKill("b"))
+
+	out := scrape(t, metrics.Handler())
+	for _, want := range []string{
+		`oom_events_total{hostname="metrics-node",cmdline="java"} 1`,
+		`oom_events_total{hostname="metrics-node",cmdline="stress --vm 1"} 2`,
+		`oom_notifications_total{notifier="metrics-ok",result="success"} 2`,
+		`oom_notifications_total{notifier="metrics-failing",result="failure"} 1`,
+		"# TYPE oom_process_cache_size gauge\noom_process_cache_size 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("scrape does not contain %s, got\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `notifier="metrics-failing",result="success"`) {
+		t.Errorf("failed notifier counted a success:\n%s", out)
+	}
+}
+
+func TestMetricsEndpointCountsEachMuteList(t *testing.T) {
+	m, err := monitor.NewOOMMonitor(monitor.Options{
+		Source:          monitor.NewLineSource(strings.NewReader("")),
+		ProcFS:          []fs.FS{fstest.MapFS{"sys/kernel/pid_max": {Data: []byte("32768\n")}}},
+		CheckInterval:   time.Second,
+		RefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+
+	dir := t.TempDir()
+	var muteLists []*notifier.MuteList
+	for _, host := range []string{"muted-by-file-1", "muted-by-file-2"} {
+		path := filepath.Join(dir, host)
+		if err := os.WriteFile(path, []byte(host+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		muteList := notifier.NewMuteFile(path, time.Hour)
+		muteList.Start()
+		muteLists = append(muteLists, muteList)
+	}
+	registerMetrics(m, muteLists, nil)
+
+	// Two events muted by the first list, one by the second
+	for _, host := range []string{"muted-by-file-1", "muted-by-file-1", "muted-by-file-2"} {
+		for _, muteList := range muteLists {
+			muteList.IsMuted(notifier.OOMEvent{Hostname: host})
+		}
+	}
+
+	out := scrape(t, metrics.Handler())
+	for _, want := range []string{
+		`oom_mute_list_suppressed_total{source="` + muteLists[0].Source() + `"} 2`,
+		`oom_mute_list_suppressed_total{source="` + muteLists[1].Source() + `"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("scrape does not contain %s, got\n%s", want, out)
+		}
+	}
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	var notReady error
+	ready := func() error { return notReady }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthHandler)
+	mux.Handle("/readyz", readyHandler(ready))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+
+	if status, body := get("/healthz"); status != http.StatusOK || body != "ok" {
+		t.Errorf("/healthz = %d %q, want 200 ok", status, body)
+	}
+	if status, body := get("/readyz"); status != http.StatusOK || body != "ok" {
+		t.Errorf("healthy /readyz = %d %q, want 200 ok", status, body)
+	}
+
+	notReady = errors.New("process cache last refreshed 3m0s ago")
+	if status, body := get("/readyz"); status != http.StatusServiceUnavailable || body != notReady.Error() {
+		t.Errorf("stale /readyz = %d %q, want 503 with the reason", status, body)
+	}
+	// A stale monitor is still alive
+	if status, _ := get("/healthz"); status != http.StatusOK {
+		t.Errorf("/healthz of a stale monitor = %d, want 200", status)
+	}
+}
+
+// fakeProcessCache is a processCacheSource holding entries.
+type fakeProcessCache struct {
+	entries     [][]monitor.ProcessInfo
+	lastRefresh time.Time
+}
+
+func (c *fakeProcessCache) CachedEntries() [][]monitor.ProcessInfo { return c.entries }
+func (c *fakeProcessCache) LastRefresh() time.Time                 { return c.lastRefresh }
+
+func TestProcessCacheHandler(t *testing.T) {
+	refreshed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache := &fakeProcessCache{
+		entries: [][]monitor.ProcessInfo{
+			{
+				{PID: 1, Cmdline: "/sbin/init", UID: "0"},
+				{PID: 4242, Cmdline: "stress --vm 1", Env: map[string]string{"API_TOKEN": "s3cret"}, PPID: 1, UID: "1000"},
+			},
+			{{PID: 7, Cmdline: "[kworker/0:1]", FromComm: true}},
+		},
+		lastRefresh: refreshed,
+	}
+	rec := httptest.NewRecorder()
+	processCacheHandler(cache).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/process-cache", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	want := `{"size":3,"last_refresh":"2024-05-01T12:00:00Z","processes":[` +
+		`{"tree":0,"pid":1,"uid":"0","cmdline":"/sbin/init"},` +
+		`{"tree":0,"pid":4242,"ppid":1,"uid":"1000","cmdline":"stress --vm 1"},` +
+		`{"tree":1,"pid":7,"cmdline":"[kworker/0:1]","from_comm":true}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("dump =\n%s\nwant\n%s", got, want)
+	}
+
+	rec = httptest.NewRecorder()
+	processCacheHandler(&fakeProcessCache{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/process-cache", nil))
+	if got := rec.Body.String(); !strings.Contains(got, `"size":0`) || !strings.Contains(got, `"processes":[]`) {
+		t.Errorf("dump of an empty cache = %s, want no processes", got)
+	}
+}
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestPprofEndpoint(t *testing.T) {
+	if servers := startServers("", "", "", "", nil, &fakeProcessCache{}, nil); len(servers) != 0 {
+		t.Errorf("%d servers started without an address, want profiling off by default", len(servers))
+	}
+
+	addr := freeAddr(t)
+	servers := startServers("", "", addr, "", nil, &fakeProcessCache{}, nil)
+	defer func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}()
+	if len(servers) != 1 || servers[0].Addr != addr {
+		t.Fatalf("servers %v, want one on %s", servers, addr)
+	}
+
+	// The server starts listening in the background
+	var resp *http.Response
+	var err error
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err = http.Get("http://" + addr + "/debug/pprof/goroutine?debug=1")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET goroutine profile: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "goroutine profile:") {
+		t.Errorf("goroutine profile = %d %.100q, want 200 with the profile", resp.StatusCode, body)
+	}
+
+	resp, err = http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/metrics on the profiling address = %d, want 404", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + addr + "/debug/process-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("/debug/process-cache on the profiling address = %d %s, want the dump", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestProcessCacheOnlyOnProfilingAddress(t *testing.T) {
+	addr := freeAddr(t)
+	servers := startServers(addr, "", "", "", nil, &fakeProcessCache{}, nil)
+	defer func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}()
+
+	var resp *http.Response
+	var err error
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err = http.Get("http://" + addr + "/debug/process-cache")
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /debug/process-cache: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/debug/process-cache on the metrics address = %d, want 404", resp.StatusCode)
+	}
+}
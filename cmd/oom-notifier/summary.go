@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Formats of --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// deliveredEvents counts the events that reached delivery, before quiet
+// hours, summaries and batching, for the --output json summary.
+var deliveredEvents atomic.Int64
+
+// runSummary is the result of a --test-notification or --replay-file run
+// printed with --output json.
+type runSummary struct {
+	OK               bool              `json:"ok"`
+	Error            string            `json:"error,omitempty"`
+	TestNotification bool              `json:"test_notification"`
+	ReplayFile       string            `json:"replay_file,omitempty"`
+	Events           int64             `json:"events"`
+	Notifiers        []notifierSummary `json:"notifiers"`
+}
+
+// notifierSummary is the outcome of the notifications of one notifier.
+type notifierSummary struct {
+	Name      string `json:"name"`
+	Sent      int    `json:"sent"`
+	Failed    int    `json:"failed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// printSummary writes the summary of a run that ended with runErr to
+// stdout as JSON and returns the exit status: 0 when the run succeeded and
+// every notification was delivered, 1 otherwise.
+func printSummary(runErr error) int {
+	summary := runSummary{
+		OK:               runErr == nil,
+		TestNotification: testNotification,
+		ReplayFile:       replayFile,
+		Events:           deliveredEvents.Load(),
+		Notifiers:        []notifierSummary{},
+	}
+	if runErr != nil {
+		summary.Error = runErr.Error()
+	}
+	for _, count := range deliveries.Counts() {
+		summary.Notifiers = append(summary.Notifiers, notifierSummary(count))
+		if count.Failed > 0 {
+			summary.OK = false
+		}
+	}
+
+	output, err := json.Marshal(summary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to encode summary: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(output))
+	if !summary.OK {
+		return 1
+	}
+	return 0
+}
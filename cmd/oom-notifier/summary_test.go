@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// useSummary starts the counts of the --output json summary over for the
+// duration of the test.
+func useSummary(t *testing.T) {
+	t.Helper()
+	override(t, &deliveries, notifier.NewDeliveries())
+	previous := deliveredEvents.Swap(0)
+	t.Cleanup(func() { deliveredEvents.Store(previous) })
+}
+
+// summarize runs printSummary for runErr and returns the summary it
+// printed to stdout and its exit status.
+func summarize(t *testing.T, runErr error) (runSummary, int) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	status := printSummary(runErr)
+	os.Stdout = stdout
+	w.Close()
+
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary runSummary
+	if err := json.Unmarshal(output, &summary); err != nil {
+		t.Fatalf("invalid summary %q: %v", output, err)
+	}
+	return summary, status
+}
+
+func TestPrintSummaryOfMixedNotifiers(t *testing.T) {
+	useSummary(t)
+	useLedger(t)
+	override(t, &testNotification, true)
+	ok, failing := &fakeNotifier{name: "ok"}, &fakeNotifier{name: "failing", err: errors.New("invalid channel")}
+	sendTestNotification(context.Background(), []notifier.Notifier{ok, failing})
+
+	summary, status := summarize(t, nil)
+	want := runSummary{
+		TestNotification: true,
+		Notifiers: []notifierSummary{
+			{Name: "failing", Failed: 1, LastError: "invalid channel"},
+			{Name: "ok", Sent: 1},
+		},
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary %+v, want %+v", summary, want)
+	}
+	if status != 1 {
+		t.Errorf("exit status %d with a failed notification, want 1", status)
+	}
+}
+
+func TestPrintSummaryOfSuccessfulRun(t *testing.T) {
+	useSummary(t)
+	useLedger(t)
+	ok := &fakeNotifier{name: "ok"}
+	sendNotification(context.Background(), []notifier.Notifier{ok}, testKill("a"))
+	deliveredEvents.Add(1)
+
+	summary, status := summarize(t, nil)
+	if !summary.OK || summary.Events != 1 || len(summary.Notifiers) != 1 || summary.Notifiers[0].Sent != 1 {
+		t.Errorf("summary %+v, want one event sent", summary)
+	}
+	if status != 0 {
+		t.Errorf("exit status %d, want 0", status)
+	}
+
+	summary, status = summarize(t, errors.New("failed to read --replay-file"))
+	if summary.OK || summary.Error != "failed to read --replay-file" || status != 1 {
+		t.Errorf("summary %+v and exit status %d of a failed run, want the error and 1", summary, status)
+	}
+}
+
+func TestPrintSummaryWithoutNotifications(t *testing.T) {
+	useSummary(t)
+	summary, status := summarize(t, nil)
+	if !summary.OK || summary.Notifiers == nil || len(summary.Notifiers) != 0 || status != 0 {
+		t.Errorf("summary %+v and exit status %d, want success and an empty list of notifiers", summary, status)
+	}
+}
+
+func TestReplaySummary(t *testing.T) {
+	useSummary(t)
+	override(t, &outputFormat, outputJSON)
+
+	if _, err := runReplay(t, replayedKill, http.StatusInternalServerError, nil); err != nil {
+		t.Fatalf("run = %v", err)
+	}
+	summary, status := summarize(t, nil)
+	if summary.ReplayFile != replayFile || summary.Events != 1 {
+		t.Errorf("summary %+v, want the one kill of the replay file", summary)
+	}
+	if len(summary.Notifiers) != 1 || summary.Notifiers[0].Name != "webhook" || summary.Notifiers[0].Failed == 0 || summary.Notifiers[0].LastError == "" {
+		t.Errorf("notifiers %+v, want the failed webhook notifications", summary.Notifiers)
+	}
+	if summary.OK || status != 1 {
+		t.Errorf("ok %v and exit status %d with failed notifications, want false and 1", summary.OK, status)
+	}
+}
+
+func TestTestNotificationSummaryEndsRun(t *testing.T) {
+	useSummary(t)
+	override(t, &outputFormat, outputJSON)
+	override(t, &testNotification, true)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer webhook.Close()
+	override(t, &webhookURL, webhook.URL)
+	if problems := validateConfig(); len(problems) > 0 {
+		t.Fatalf("invalid configuration: %v", problems)
+	}
+
+	// Without --output json the run would go on monitoring /dev/kmsg
+	done := make(chan error, 1)
+	go func() { done <- run() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run did not end after the test notification")
+	}
+	summary, status := summarize(t, nil)
+	if !summary.OK || !summary.TestNotification || summary.Events != 0 || len(summary.Notifiers) != 1 || summary.Notifiers[0].Sent != 1 || status != 0 {
+		t.Errorf("summary %+v and exit status %d, want the delivered test notification", summary, status)
+	}
+}
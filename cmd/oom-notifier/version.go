@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	runtimedebug "runtime/debug"
+)
+
+// Build information, injected at build time with e.g.
+//
+//	go build -ldflags "-X main.version=1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to the VCS stamp recorded by the Go toolchain.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+func init() {
+	info, ok := runtimedebug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if commit == "" {
+				commit = setting.Value
+			}
+		case "vcs.time":
+			if date == "" {
+				date = setting.Value
+			}
+		}
+	}
+}
+
+// versionString describes the running build on one line.
+func versionString() string {
+	c, d := commit, date
+	if c == "" {
+		c = "unknown"
+	}
+	if d == "" {
+		d = "unknown"
+	}
+	return fmt.Sprintf("oom-notifier %s (commit %s, built %s, %s)", version, c, d, runtime.Version())
+}
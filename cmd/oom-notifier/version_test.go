@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestVersionString(t *testing.T) {
+	override(t, &version, "1.2.3")
+	override(t, &commit, "")
+	override(t, &date, "2024-05-01T10:00:00Z")
+
+	got := versionString()
+	for _, want := range []string{"oom-notifier 1.2.3", "commit unknown", "built 2024-05-01T10:00:00Z", "go1."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("versionString = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+// mainArgsEnv holds the arguments main is run with by the test binary
+// started in TestVersionExitsBeforeStarting.
+const mainArgsEnv = "OOM_NOTIFIER_TEST_MAIN_ARGS"
+
+func TestVersionExitsBeforeStarting(t *testing.T) {
+	if args := os.Getenv(mainArgsEnv); args != "" {
+		os.Args = append([]string{"oom-notifier"}, strings.Fields(args)...)
+		main()
+		t.Fatal("main returned")
+	}
+
+	// A missing config file and no notifier stop any run that gets past
+	// the version check
+	for _, args := range []string{"--version --config /nonexistent.yaml", "version --config /nonexistent.yaml"} {
+		t.Run(args, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestVersionExitsBeforeStarting$")
+			cmd.Env = append(os.Environ(), mainArgsEnv+"="+args)
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("exited with %v: %s", err, out)
+			}
+			if got := strings.TrimSpace(string(out)); got != versionString() {
+				t.Errorf("printed %q, want only %q", got, versionString())
+			}
+		})
+	}
+}
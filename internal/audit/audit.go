@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+const (
+	// flushInterval is how often buffered lines are written to the file.
+	flushInterval = time.Second
+	// queueSize is the number of events waiting to be written before new
+	// ones are dropped.
+	queueSize = 1024
+)
+
+var errClosed = errors.New("audit log is closed")
+
+// Log appends events to a file as JSON lines (NDJSON), independently of the
+// notifiers. Lines are written by a background goroutine through a buffer
+// that is flushed every second, so a slow disk never blocks the caller;
+// events arriving while the queue is full are dropped and counted.
+type Log struct {
+	path     string
+	encoding notifier.EventEncoding
+	events   chan notifier.OOMEvent
+	reopen   chan chan error
+	done     chan struct{}
+	stopped  chan struct{}
+	dropped  atomic.Uint64
+
+	// Owned by run
+	file     *os.File
+	w        *bufio.Writer
+	closeErr error
+}
+
+// Open opens path for appending, creating it if needed, and starts writing
+// recorded events to it in encoding.
+func Open(path string, encoding notifier.EventEncoding) (*Log, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{
+		path:     path,
+		encoding: encoding,
+		events:   make(chan notifier.OOMEvent, queueSize),
+		reopen:   make(chan chan error),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		file:     file,
+		w:        bufio.NewWriter(file),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Record queues event to be written. It never blocks.
+func (l *Log) Record(event notifier.OOMEvent) {
+	select {
+	case l.events <- event:
+	default:
+		dropped := l.dropped.Add(1)
+		logger.Warn("Audit log queue full, dropping %s event for PID %s (%d dropped in total)", event.Kind, event.PID, dropped)
+	}
+}
+
+// Dropped returns the number of events discarded because the queue was full.
+func (l *Log) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Reopen flushes and closes the file, then opens path again. Call it after
+// the file was rotated away, e.g. by logrotate followed by SIGHUP.
+func (l *Log) Reopen() error {
+	errc := make(chan error, 1)
+	select {
+	case l.reopen <- errc:
+		return <-errc
+	case <-l.stopped:
+		return errClosed
+	}
+}
+
+// Close writes the queued events, flushes and closes the file.
+func (l *Log) Close() error {
+	select {
+	case <-l.done:
+		return errClosed
+	default:
+	}
+	close(l.done)
+	<-l.stopped
+	return l.closeErr
+}
+
+func (l *Log) run() {
+	defer close(l.stopped)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-l.events:
+			l.write(event)
+
+		case <-ticker.C:
+			l.flush()
+
+		case errc := <-l.reopen:
+			errc <- l.reopenFile()
+
+		case <-l.done:
+			for {
+				select {
+				case event := <-l.events:
+					l.write(event)
+				default:
+					l.closeErr = l.closeFile()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (l *Log) write(event notifier.OOMEvent) {
+	line, err := l.encoding.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to encode audit event: %v", err)
+		return
+	}
+	line = append(line, '\n')
+	if _, err := l.w.Write(line); err != nil {
+		logger.Error("Failed to write audit log %s: %v", l.path, err)
+	}
+}
+
+func (l *Log) flush() {
+	if l.w.Buffered() == 0 {
+		return
+	}
+	if err := l.w.Flush(); err != nil {
+		logger.Error("Failed to write audit log %s: %v", l.path, err)
+	}
+}
+
+// reopenFile switches to a fresh file at path. The current file is kept when
+// the new one cannot be opened, so no events are lost.
+func (l *Log) reopenFile() error {
+	file, err := openFile(l.path)
+	if err != nil {
+		return err
+	}
+	if err := l.closeFile(); err != nil {
+		logger.Warn("Failed to close previous audit log: %v", err)
+	}
+	l.file = file
+	l.w = bufio.NewWriter(file)
+	return nil
+}
+
+func (l *Log) closeFile() error {
+	flushErr := l.w.Flush()
+	closeErr := l.file.Close()
+	if flushErr != nil {
+		return fmt.Errorf("failed to write audit log %s: %v", l.path, flushErr)
+	}
+	return closeErr
+}
+
+func openFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	return file, nil
+}
@@ -0,0 +1,167 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+func kill(pid string) notifier.OOMEvent {
+	return notifier.OOMEvent{Kind: "oom", PID: pid, Cmdline: "stress --vm 1", Hostname: "node-1"}
+}
+
+// readEvents decodes the NDJSON file at path.
+func readEvents(t *testing.T, path string) []map[string]any {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var events []map[string]any
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// drain waits until the events recorded so far were taken off the queue.
+func drain(t *testing.T, l *Log) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(l.events) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("audit log queue not drained")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestLogWritesNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	if err := os.WriteFile(path, []byte(`{"pid":"1"}`+"\n"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path, notifier.EventEncoding{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	l.Record(kill("4242"))
+	l.Record(kill("4343"))
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	events := readEvents(t, path)
+	if len(events) != 3 {
+		t.Fatalf("file holds %d events, want the previous one and 2 recorded", len(events))
+	}
+	for i, pid := range []string{"1", "4242", "4343"} {
+		if events[i]["pid"] != pid {
+			t.Errorf("event %d PID %v, want %s", i, events[i]["pid"], pid)
+		}
+	}
+	if events[1]["cmdline"] != "stress --vm 1" || events[1]["hostname"] != "node-1" {
+		t.Errorf("event %v lacks the command line or hostname", events[1])
+	}
+	if got := events[1]["schema_version"]; got != float64(notifier.EventSchemaVersion) {
+		t.Errorf("event schema_version %v, want %d as written by MarshalEvent", got, notifier.EventSchemaVersion)
+	}
+	if err := l.Close(); err == nil {
+		t.Error("second Close succeeded")
+	}
+}
+
+func TestLogFlushesPeriodically(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	l, err := Open(path, notifier.EventEncoding{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer l.Close()
+
+	l.Record(kill("4242"))
+	deadline := time.Now().Add(3 * flushInterval)
+	for len(readEvents(t, path)) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("recorded event not flushed while running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLogReopenAfterRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.ndjson")
+	l, err := Open(path, notifier.EventEncoding{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	l.Record(kill("1"))
+	drain(t, l)
+	// logrotate moves the file away, then signals a reopen
+	rotated := filepath.Join(dir, "audit.ndjson.1")
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reopen(); err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	l.Record(kill("2"))
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if events := readEvents(t, rotated); len(events) != 1 || events[0]["pid"] != "1" {
+		t.Errorf("rotated file holds %v, want the event before the rotation", events)
+	}
+	if events := readEvents(t, path); len(events) != 1 || events[0]["pid"] != "2" {
+		t.Errorf("new file holds %v, want the event after the rotation", events)
+	}
+	if err := l.Reopen(); err == nil {
+		t.Error("Reopen of a closed log succeeded")
+	}
+}
+
+func TestLogReopenKeepsFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.ndjson")
+	l, err := Open(path, notifier.EventEncoding{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	// A directory takes the place of the file, which cannot be opened again
+	if err := os.Rename(path, filepath.Join(dir, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reopen(); err == nil {
+		t.Error("Reopen succeeded without a file to open")
+	}
+	l.Record(kill("1"))
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if events := readEvents(t, filepath.Join(dir, "moved")); len(events) != 1 {
+		t.Errorf("previous file holds %d events, want the one recorded after the failed reopen", len(events))
+	}
+}
@@ -0,0 +1,134 @@
+package bus
+
+import (
+	"sync"
+)
+
+// Topics used by the event pipeline. The monitor publishes raw detections on
+// TopicDetected, enrichment and filtering stages republish the events they
+// keep on TopicEnriched, and notifiers consume TopicEnriched.
+const (
+	TopicDetected = "detected"
+	TopicEnriched = "enriched"
+)
+
+// Bus is a small in-process publish/subscribe event bus. Every subscriber of
+// a topic receives every event published to it, in publish order.
+type Bus[T any] struct {
+	mu          sync.RWMutex
+	buffer      int
+	subscribers map[string][]chan T
+	closed      bool
+	// closedTopics are the topics closed on their own by CloseTopic
+	closedTopics map[string]bool
+	// publishing counts the publishes in flight per topic, which deliver
+	// without holding mu and must end before the topic's channels close
+	publishing map[string]*sync.WaitGroup
+	// done is closed by Close to abort the publishes blocked on a full
+	// subscriber
+	done chan struct{}
+}
+
+// New creates a bus whose subscriber channels hold up to buffer events.
+func New[T any](buffer int) *Bus[T] {
+	return &Bus[T]{
+		buffer:       buffer,
+		subscribers:  make(map[string][]chan T),
+		closedTopics: make(map[string]bool),
+		publishing:   make(map[string]*sync.WaitGroup),
+		done:         make(chan struct{}),
+	}
+}
+
+// Subscribe returns a channel receiving events published to topic. The
+// channel is closed when the bus or the topic is closed.
+func (b *Bus[T]) Subscribe(topic string) <-chan T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan T, b.buffer)
+	if b.closed || b.closedTopics[topic] {
+		close(ch)
+		return ch
+	}
+	b.subscribers[topic] = append(b.subscribers[topic], ch)
+	return ch
+}
+
+// Publish delivers event to every subscriber of topic, blocking while a
+// subscriber's buffer is full. Events published after Close, or after the
+// topic was closed, are discarded, as are those still blocked when Close is
+// called. A blocked publish does not hold up publishes to other topics,
+// subscriptions or closing the bus.
+func (b *Bus[T]) Publish(topic string, event T) {
+	b.mu.Lock()
+	if b.closed || b.closedTopics[topic] {
+		b.mu.Unlock()
+		return
+	}
+	subscribers := b.subscribers[topic]
+	publishing := b.publishing[topic]
+	if publishing == nil {
+		publishing = &sync.WaitGroup{}
+		b.publishing[topic] = publishing
+	}
+	publishing.Add(1)
+	b.mu.Unlock()
+	defer publishing.Done()
+
+	for _, ch := range subscribers {
+		select {
+		case ch <- event:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// Close closes all subscriber channels, once the publishes in flight have
+// delivered or been aborted.
+func (b *Bus[T]) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	close(b.done)
+	subscribers := b.subscribers
+	b.subscribers = make(map[string][]chan T)
+	publishing := b.publishing
+	b.mu.Unlock()
+
+	for topic, chans := range subscribers {
+		if wg := publishing[topic]; wg != nil {
+			wg.Wait()
+		}
+		for _, ch := range chans {
+			close(ch)
+		}
+	}
+}
+
+// CloseTopic closes the subscriber channels of topic, once the stage
+// publishing to it is done. Events already published, including those of
+// publishes still in flight, are still received.
+func (b *Bus[T]) CloseTopic(topic string) {
+	b.mu.Lock()
+	if b.closed || b.closedTopics[topic] {
+		b.mu.Unlock()
+		return
+	}
+	b.closedTopics[topic] = true
+	subscribers := b.subscribers[topic]
+	delete(b.subscribers, topic)
+	publishing := b.publishing[topic]
+	b.mu.Unlock()
+
+	if publishing != nil {
+		publishing.Wait()
+	}
+	for _, ch := range subscribers {
+		close(ch)
+	}
+}
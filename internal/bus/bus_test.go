@@ -0,0 +1,185 @@
+package bus
+
+import (
+	"testing"
+	"time"
+)
+
+// receive reads the events left on ch up to its close.
+func receive(t *testing.T, ch <-chan int) []int {
+	t.Helper()
+	var events []int
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			t.Fatalf("channel not closed, received %v", events)
+		}
+	}
+}
+
+func TestPublishFansOutInOrder(t *testing.T) {
+	b := New[int](10)
+	first := b.Subscribe(TopicDetected)
+	second := b.Subscribe(TopicDetected)
+	other := b.Subscribe(TopicEnriched)
+
+	for i := 1; i <= 3; i++ {
+		b.Publish(TopicDetected, i)
+	}
+	b.Close()
+
+	for _, ch := range []<-chan int{first, second} {
+		if got := receive(t, ch); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+			t.Errorf("received %v, want [1 2 3]", got)
+		}
+	}
+	if got := receive(t, other); len(got) != 0 {
+		t.Errorf("other topic received %v", got)
+	}
+}
+
+func TestCloseTopicKeepsPublishedEvents(t *testing.T) {
+	b := New[int](10)
+	detected := b.Subscribe(TopicDetected)
+	enriched := b.Subscribe(TopicEnriched)
+
+	b.Publish(TopicDetected, 1)
+	b.CloseTopic(TopicDetected)
+	b.Publish(TopicDetected, 2)
+
+	if got := receive(t, detected); len(got) != 1 || got[0] != 1 {
+		t.Errorf("received %v, want [1]", got)
+	}
+	if late := b.Subscribe(TopicDetected); len(receive(t, late)) != 0 {
+		t.Error("subscription to a closed topic received events")
+	}
+
+	// The other topics stay open
+	b.Publish(TopicEnriched, 3)
+	select {
+	case got := <-enriched:
+		if got != 3 {
+			t.Errorf("received %d, want 3", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not received on an open topic")
+	}
+	b.Close()
+	b.CloseTopic(TopicEnriched)
+}
+
+func TestPublishAfterCloseIsDiscarded(t *testing.T) {
+	b := New[int](10)
+	ch := b.Subscribe(TopicDetected)
+	b.Close()
+	b.Close()
+	b.Publish(TopicDetected, 1)
+
+	if got := receive(t, ch); len(got) != 0 {
+		t.Errorf("received %v after close", got)
+	}
+	if got := receive(t, b.Subscribe(TopicDetected)); len(got) != 0 {
+		t.Errorf("subscription after close received %v", got)
+	}
+}
+
+func TestBlockedPublishDoesNotHoldTheBus(t *testing.T) {
+	b := New[int](1)
+	full := b.Subscribe(TopicDetected)
+	b.Publish(TopicDetected, 1)
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(TopicDetected, 2)
+		close(published)
+	}()
+
+	// Subscribing and publishing to other topics go on while a subscriber of
+	// TopicDetected is full
+	done := make(chan struct{})
+	go func() {
+		enriched := b.Subscribe(TopicEnriched)
+		b.Publish(TopicEnriched, 3)
+		<-enriched
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("bus held by a publish blocked on a full subscriber")
+	}
+
+	select {
+	case <-published:
+		t.Fatal("publish to a full subscriber did not block")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if got := <-full; got != 1 {
+		t.Errorf("received %d, want 1", got)
+	}
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("publish not unblocked once the subscriber read")
+	}
+	if got := <-full; got != 2 {
+		t.Errorf("received %d, want 2", got)
+	}
+	b.Close()
+}
+
+func TestCloseAbortsBlockedPublish(t *testing.T) {
+	b := New[int](0)
+	ch := b.Subscribe(TopicDetected)
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(TopicDetected, 1)
+		close(published)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+	for _, done := range []chan struct{}{published, closed} {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("close did not abort a blocked publish")
+		}
+	}
+	if got := receive(t, ch); len(got) != 0 {
+		t.Errorf("received %v from an aborted publish", got)
+	}
+}
+
+func TestCloseTopicWaitsForPublishInFlight(t *testing.T) {
+	b := New[int](0)
+	ch := b.Subscribe(TopicDetected)
+
+	go b.Publish(TopicDetected, 1)
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		b.CloseTopic(TopicDetected)
+		close(closed)
+	}()
+	if got := receive(t, ch); len(got) != 1 || got[0] != 1 {
+		t.Errorf("received %v, want [1]", got)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("CloseTopic did not return")
+	}
+}
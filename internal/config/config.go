@@ -0,0 +1,317 @@
+// Package config loads oom-notifier settings from a YAML file.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Config mirrors the command line flags. Every leaf field is tagged with the
+// flag it sets; fields left out of the file keep the flag's value.
+type Config struct {
+	Notifiers          []string         `yaml:"notifiers" flag:"notifier"`
+	Slack              SlackConfig      `yaml:"slack"`
+	Discord            DiscordConfig    `yaml:"discord"`
+	Teams              TeamsConfig      `yaml:"teams"`
+	Mattermost         MattermostConfig `yaml:"mattermost"`
+	Telegram           TelegramConfig   `yaml:"telegram"`
+	Pushover           PushoverConfig   `yaml:"pushover"`
+	Webhook            WebhookConfig    `yaml:"webhook"`
+	Email              EmailConfig      `yaml:"email"`
+	SNS                SNSConfig        `yaml:"sns"`
+	Kafka              KafkaConfig      `yaml:"kafka"`
+	NATS               NATSConfig       `yaml:"nats"`
+	Gelf               GelfConfig       `yaml:"gelf"`
+	SyslogNotifier     SyslogConfig     `yaml:"syslog_notifier"`
+	Loki               LokiConfig       `yaml:"loki"`
+	Monitor            MonitorConfig    `yaml:"monitor"`
+	Alerts             AlertsConfig     `yaml:"alerts"`
+	Metrics            MetricsConfig    `yaml:"metrics"`
+	Debug              *bool            `yaml:"debug" flag:"debug"`
+	LogLevel           *string          `yaml:"log_level" flag:"log-level"`
+	LogFormat          *string          `yaml:"log_format" flag:"log-format"`
+	LogFile            *string          `yaml:"log_file" flag:"log-file"`
+	LogMaxSize         *int             `yaml:"log_max_size" flag:"log-max-size"`
+	Syslog             *bool            `yaml:"syslog" flag:"syslog"`
+	TestNotification   *bool            `yaml:"test_notification" flag:"test-notification"`
+	DryRun             *bool            `yaml:"dry_run" flag:"dry-run"`
+	PrintEvents        *bool            `yaml:"print_events" flag:"print-events"`
+	Output             *string          `yaml:"output" flag:"output"`
+	Once               *bool            `yaml:"once" flag:"once"`
+	FingerprintStrip   *string          `yaml:"fingerprint_strip" flag:"fingerprint-strip"`
+	MaxCmdlineLen      *int             `yaml:"max_cmdline_len" flag:"max-cmdline-len"`
+	DeliveryInterval   *int             `yaml:"delivery_report_interval" flag:"delivery-report-interval"`
+	AuditFile          *string          `yaml:"audit_file" flag:"audit-file"`
+	OutputSchema       *string          `yaml:"output_schema" flag:"output-schema"`
+	JSONNaming         *string          `yaml:"json_naming" flag:"json-naming"`
+	JSONEmptyFields    *string          `yaml:"json_empty_fields" flag:"json-empty-fields"`
+	RetryQueueDir      *string          `yaml:"retry_queue_dir" flag:"retry-queue-dir"`
+	RetryQueueMaxAge   *int             `yaml:"retry_queue_max_age" flag:"retry-queue-max-age"`
+	ProtectSelf        *bool            `yaml:"protect_self" flag:"protect-self"`
+	ProtectSelfScore   *int             `yaml:"protect_self_score" flag:"protect-self-score"`
+	HTTPTimeout        *int             `yaml:"http_timeout" flag:"http-timeout"`
+	CAFile             *string          `yaml:"ca_file" flag:"ca-file"`
+	ClientCert         *string          `yaml:"client_cert" flag:"client-cert"`
+	ClientKey          *string          `yaml:"client_key" flag:"client-key"`
+	InsecureSkipVerify *bool            `yaml:"insecure_skip_verify" flag:"insecure-skip-verify"`
+}
+
+type SlackConfig struct {
+	Webhooks      []string `yaml:"webhooks" flag:"slack-webhook"`
+	Token         *string  `yaml:"token" flag:"slack-token"`
+	Thread        *int     `yaml:"thread" flag:"slack-thread"`
+	Channel       *string  `yaml:"channel" flag:"slack-channel"`
+	ChannelRoutes []string `yaml:"channel_routes" flag:"channel-route"`
+	Mode          *string  `yaml:"mode" flag:"slack-mode"`
+	Format        *string  `yaml:"format" flag:"slack-format"`
+	Username      *string  `yaml:"username" flag:"slack-username"`
+	IconEmoji     *string  `yaml:"icon_emoji" flag:"slack-icon-emoji"`
+	Template      *string  `yaml:"message_template" flag:"message-template"`
+	RetryAttempts *int     `yaml:"retry_attempts" flag:"slack-retry-attempts"`
+	RetryBackoff  *int     `yaml:"retry_backoff" flag:"slack-retry-backoff"`
+}
+
+type DiscordConfig struct {
+	Webhook *string `yaml:"webhook" flag:"discord-webhook"`
+}
+
+type TeamsConfig struct {
+	Webhook *string `yaml:"webhook" flag:"teams-webhook"`
+}
+
+type MattermostConfig struct {
+	Webhook *string `yaml:"webhook" flag:"mattermost-webhook"`
+	Channel *string `yaml:"channel" flag:"mattermost-channel"`
+}
+
+type TelegramConfig struct {
+	BotToken *string `yaml:"bot_token" flag:"telegram-bot-token"`
+	ChatID   *string `yaml:"chat_id" flag:"telegram-chat-id"`
+}
+
+type PushoverConfig struct {
+	Token *string `yaml:"token" flag:"pushover-token"`
+	User  *string `yaml:"user" flag:"pushover-user"`
+}
+
+type WebhookConfig struct {
+	URL    *string `yaml:"url" flag:"webhook-url"`
+	Secret *string `yaml:"secret" flag:"webhook-secret"`
+	Gzip   *bool   `yaml:"gzip" flag:"webhook-gzip"`
+	Batch  *bool   `yaml:"batch" flag:"webhook-batch"`
+}
+
+type EmailConfig struct {
+	SMTPHost     *string  `yaml:"smtp_host" flag:"smtp-host"`
+	SMTPPort     *int     `yaml:"smtp_port" flag:"smtp-port"`
+	SMTPUsername *string  `yaml:"smtp_username" flag:"smtp-username"`
+	SMTPPassword *string  `yaml:"smtp_password" flag:"smtp-password"`
+	From         *string  `yaml:"from" flag:"email-from"`
+	To           []string `yaml:"to" flag:"email-to"`
+}
+
+type SNSConfig struct {
+	TopicARN *string `yaml:"topic_arn" flag:"sns-topic-arn"`
+	Region   *string `yaml:"region" flag:"sns-region"`
+}
+
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers" flag:"kafka-broker"`
+	Topic   *string  `yaml:"topic" flag:"kafka-topic"`
+}
+
+type NATSConfig struct {
+	URL     *string `yaml:"url" flag:"nats-url"`
+	Subject *string `yaml:"subject" flag:"nats-subject"`
+}
+
+type GelfConfig struct {
+	Addr *string `yaml:"addr" flag:"gelf-addr"`
+}
+
+type SyslogConfig struct {
+	Addr     *string `yaml:"addr" flag:"syslog-addr"`
+	Network  *string `yaml:"network" flag:"syslog-network"`
+	Facility *int    `yaml:"facility" flag:"syslog-facility"`
+}
+
+type LokiConfig struct {
+	URL    *string  `yaml:"url" flag:"loki-url"`
+	Labels []string `yaml:"labels" flag:"loki-label"`
+	Gzip   *bool    `yaml:"gzip" flag:"loki-gzip"`
+	Batch  *bool    `yaml:"batch" flag:"loki-batch"`
+}
+
+type MonitorConfig struct {
+	ProcDirs             []string `yaml:"proc_dirs" flag:"proc-dir"`
+	LogSource            *string  `yaml:"log_source" flag:"log-source"`
+	DmesgFile            *string  `yaml:"dmesg_file" flag:"dmesg-file"`
+	ReplayFile           *string  `yaml:"replay_file" flag:"replay-file"`
+	ReplayStartupFilter  *bool    `yaml:"replay_startup_filter" flag:"replay-startup-filter"`
+	ProcessRefresh       *int     `yaml:"process_refresh" flag:"process-refresh"`
+	MinRefreshInterval   *int     `yaml:"min_refresh_interval" flag:"min-refresh-interval"`
+	ProcessScan          *int     `yaml:"process_scan" flag:"process-scan"`
+	KernelLogRefresh     *int     `yaml:"kernel_log_refresh" flag:"kernel-log-refresh"`
+	CaptureEnv           []string `yaml:"capture_env" flag:"capture-env"`
+	FlattenCmdlineSpaces *bool    `yaml:"flatten_cmdline_spaces" flag:"flatten-cmdline-spaces"`
+	WatchSegfaults       *bool    `yaml:"watch_segfaults" flag:"watch-segfaults"`
+	WatchHungTasks       *bool    `yaml:"watch_hung_tasks" flag:"watch-hung-tasks"`
+	MatchersFile         *string  `yaml:"matchers_file" flag:"matchers-file"`
+	OOMPattern           *string  `yaml:"oom_pattern" flag:"oom-pattern"`
+	PIDPattern           *string  `yaml:"pid_pattern" flag:"pid-pattern"`
+	AttachFullReport     *bool    `yaml:"attach_full_report" flag:"attach-full-report"`
+	ContextLines         *int     `yaml:"context_lines" flag:"context-lines"`
+	ReaperWait           *int     `yaml:"reaper_wait" flag:"reaper-wait"`
+	TopConsumers         *int     `yaml:"top_consumers" flag:"top-consumers"`
+	IncludeAncestry      *int     `yaml:"include_ancestry" flag:"include-ancestry"`
+	StateFile            *string  `yaml:"state_file" flag:"state-file"`
+	CgroupWatch          []string `yaml:"cgroup_watch" flag:"cgroup-watch"`
+	CgroupWatchInterval  *int     `yaml:"cgroup_watch_interval" flag:"cgroup-watch-interval"`
+	PSIThreshold         *float64 `yaml:"psi_threshold" flag:"psi-threshold"`
+	PSILine              *string  `yaml:"psi_line" flag:"psi-line"`
+	PSIDuration          *int     `yaml:"psi_duration" flag:"psi-duration"`
+	PSIFile              *string  `yaml:"psi_file" flag:"psi-file"`
+	ScanHistory          *bool    `yaml:"scan_history" flag:"scan-history"`
+	HistoryWindow        *int     `yaml:"history_window" flag:"history-window"`
+	StartupGrace         *int     `yaml:"startup_grace" flag:"startup-grace"`
+	EventBuffer          *int     `yaml:"event_buffer" flag:"event-buffer"`
+	KubeletURL           *string  `yaml:"kubelet_url" flag:"kubelet-url"`
+	DockerEnrich         *bool    `yaml:"docker_enrich" flag:"docker-enrich"`
+	DockerSocket         *string  `yaml:"docker_socket" flag:"docker-socket"`
+	EnrichCommand        *string  `yaml:"enrich_command" flag:"enrich-command"`
+	EnrichTimeout        *int     `yaml:"enrich_timeout" flag:"enrich-timeout"`
+}
+
+type MetricsConfig struct {
+	Addr          *string `yaml:"addr" flag:"metrics-addr"`
+	HealthAddr    *string `yaml:"health_addr" flag:"health-addr"`
+	PprofAddr     *string `yaml:"pprof_addr" flag:"pprof-addr"`
+	StatsdAddr    *string `yaml:"statsd_addr" flag:"statsd-addr"`
+	ReceiveAddr   *string `yaml:"receive_addr" flag:"receive-addr"`
+	ReceiveSecret *string `yaml:"receive_secret" flag:"receive-secret"`
+}
+
+type AlertsConfig struct {
+	SummarizeContainers *bool    `yaml:"summarize_containers" flag:"summarize-containers"`
+	SummarizeWindow     *int     `yaml:"summarize_window" flag:"summarize-window"`
+	SummarizeThreshold  *int     `yaml:"summarize_threshold" flag:"summarize-threshold"`
+	BatchWindow         *int     `yaml:"batch_window" flag:"batch-window"`
+	QuietHours          *string  `yaml:"quiet_hours" flag:"quiet-hours"`
+	QuietHoursSeverity  *string  `yaml:"quiet_hours_severity" flag:"quiet-hours-severity"`
+	QuietHoursDigest    *bool    `yaml:"quiet_hours_digest" flag:"quiet-hours-digest"`
+	SummaryInterval     *int     `yaml:"summary_interval" flag:"summary-interval"`
+	AlertOnDropped      *bool    `yaml:"alert_on_dropped" flag:"alert-on-dropped"`
+	MuteFile            *string  `yaml:"mute_file" flag:"mute-file"`
+	MuteURL             *string  `yaml:"mute_url" flag:"mute-url"`
+	MuteRefresh         *int     `yaml:"mute_refresh" flag:"mute-refresh"`
+	MuteHosts           []string `yaml:"mute_hosts" flag:"mute-host"`
+	IncludeCmdlines     []string `yaml:"include_cmdlines" flag:"include-cmdline"`
+	ExcludeCmdlines     []string `yaml:"exclude_cmdlines" flag:"exclude-cmdline"`
+	IncludeUIDs         []string `yaml:"include_uids" flag:"include-uid"`
+	ExcludeUIDs         []string `yaml:"exclude_uids" flag:"exclude-uid"`
+	MinRSS              *string  `yaml:"min_rss" flag:"min-rss"`
+	SampleRate          *float64 `yaml:"sample_rate" flag:"sample-rate"`
+	Sampling            *bool    `yaml:"sampling" flag:"sampling"`
+	SamplingWindow      *int     `yaml:"sampling_window" flag:"sampling-window"`
+	DedupWindow         *int     `yaml:"dedup_window" flag:"dedup-window"`
+	DedupNormalizeRegex *string  `yaml:"dedup_normalize_regex" flag:"dedup-normalize-regex"`
+	AlertCooldown       *int     `yaml:"alert_cooldown" flag:"alert-cooldown"`
+	FlapThreshold       *int     `yaml:"flap_threshold" flag:"flap-threshold"`
+	FlapWindow          *int     `yaml:"flap_window" flag:"flap-window"`
+	FlapChannel         *string  `yaml:"flap_channel" flag:"flap-channel"`
+	RecoveryWindow      *int     `yaml:"recovery_window" flag:"recovery-window"`
+	MaxAlertsPerMinute  *int     `yaml:"max_alerts_per_minute" flag:"max-alerts-per-minute"`
+	MaxEventAge         *int     `yaml:"max_event_age" flag:"max-event-age"`
+	Timezone            *string  `yaml:"timezone" flag:"timezone"`
+	SeverityColors      []string `yaml:"severity_colors" flag:"severity-color"`
+	SeverityEmojis      []string `yaml:"severity_emojis" flag:"severity-emoji"`
+	SeverityMap         *string  `yaml:"severity_map" flag:"severity-map"`
+	Fields              *string  `yaml:"fields" flag:"fields"`
+	LinkTemplate        *string  `yaml:"link_template" flag:"link-template"`
+}
+
+// Load parses the YAML file at path. Unknown keys are rejected so typos
+// don't silently fall back to defaults.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	var cfg Config
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// An empty file decodes to io.EOF and simply sets nothing
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Apply copies the values set in the file onto the flags in fs. Flags given
+// on the command line take precedence and are left untouched.
+func (c *Config) Apply(fs *flag.FlagSet) error {
+	values := c.Values()
+	for name := range values {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("config field for unknown flag --%s", name)
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Changed {
+			return
+		}
+		for _, value := range values[f.Name] {
+			if setErr := fs.Set(f.Name, value); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %v", value, f.Name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// Values returns the values set in the file, keyed by flag name, in the form
+// accepted by the flag. Repeatable flags may have several values.
+func (c *Config) Values() map[string][]string {
+	values := make(map[string][]string)
+	collect(reflect.ValueOf(c).Elem(), values)
+	return values
+}
+
+func collect(v reflect.Value, values map[string][]string) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		name := v.Type().Field(i).Tag.Get("flag")
+
+		if name == "" {
+			if field.Kind() == reflect.Struct {
+				collect(field, values)
+			}
+			continue
+		}
+		if field.IsNil() {
+			continue
+		}
+
+		if field.Kind() == reflect.Slice {
+			list := []string{}
+			for j := 0; j < field.Len(); j++ {
+				list = append(list, field.Index(j).String())
+			}
+			values[name] = list
+		} else {
+			values[name] = []string{fmt.Sprint(field.Elem().Interface())}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	flag "github.com/spf13/pflag"
+)
+
+// testFlags registers a few flags of each kind oom-notifier has.
+func testFlags() *flag.FlagSet {
+	fs := flag.NewFlagSet("oom-notifier", flag.ContinueOnError)
+	fs.StringArray("slack-webhook", nil, "")
+	fs.String("slack-channel", "", "")
+	fs.Int("process-refresh", 1, "")
+	fs.StringArray("proc-dir", []string{"/proc"}, "")
+	fs.Bool("debug", false, "")
+	return fs
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadAndApply(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+slack:
+  webhooks:
+    - https://hooks.slack.com/a
+    - https://hooks.slack.com/b
+  channel: "#oom"
+monitor:
+  process_refresh: 5
+  proc_dirs: [/host/proc]
+debug: true
+`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	fs := testFlags()
+	if err := cfg.Apply(fs); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	webhooks, _ := fs.GetStringArray("slack-webhook")
+	if !reflect.DeepEqual(webhooks, []string{"https://hooks.slack.com/a", "https://hooks.slack.com/b"}) {
+		t.Errorf("slack-webhook = %q", webhooks)
+	}
+	if channel, _ := fs.GetString("slack-channel"); channel != "#oom" {
+		t.Errorf("slack-channel = %q", channel)
+	}
+	if refresh, _ := fs.GetInt("process-refresh"); refresh != 5 {
+		t.Errorf("process-refresh = %d", refresh)
+	}
+	// A list in the file replaces the default of the flag
+	if dirs, _ := fs.GetStringArray("proc-dir"); !reflect.DeepEqual(dirs, []string{"/host/proc"}) {
+		t.Errorf("proc-dir = %q", dirs)
+	}
+	if debug, _ := fs.GetBool("debug"); !debug {
+		t.Error("debug not set")
+	}
+}
+
+func TestFlagsOverrideFile(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "slack:\n  channel: \"#file\"\nmonitor:\n  process_refresh: 5\n"))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	fs := testFlags()
+	if err := fs.Parse([]string{"--slack-channel", "#flag"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Apply(fs); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if channel, _ := fs.GetString("slack-channel"); channel != "#flag" {
+		t.Errorf("slack-channel = %q, want the flag's #flag", channel)
+	}
+	if refresh, _ := fs.GetInt("process-refresh"); refresh != 5 {
+		t.Errorf("process-refresh = %d, want the file's 5", refresh)
+	}
+}
+
+func TestFieldsLeftOutKeepDefaults(t *testing.T) {
+	cfg, err := Load(writeConfig(t, ""))
+	if err != nil {
+		t.Fatalf("Load of an empty file: %v", err)
+	}
+	if values := cfg.Values(); len(values) != 0 {
+		t.Errorf("empty file sets %v", values)
+	}
+
+	fs := testFlags()
+	if err := cfg.Apply(fs); err != nil {
+		t.Fatal(err)
+	}
+	if dirs, _ := fs.GetStringArray("proc-dir"); !reflect.DeepEqual(dirs, []string{"/proc"}) {
+		t.Errorf("proc-dir = %q, want the default", dirs)
+	}
+}
+
+func TestLoadRejectsMalformedFiles(t *testing.T) {
+	for name, content := range map[string]string{
+		"syntax":      "slack:\n  channel: [unclosed\n",
+		"unknown key": "slack:\n  chanel: \"#typo\"\n",
+		"wrong type":  "monitor:\n  process_refresh: often\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfig(t, content)
+			_, err := Load(path)
+			if err == nil {
+				t.Fatal("Load accepted a malformed file")
+			}
+			if !strings.Contains(err.Error(), path) {
+				t.Errorf("error %q does not name the file", err)
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load accepted a missing file")
+	}
+}
+
+func TestApplyRejectsInvalidValues(t *testing.T) {
+	cfg := &Config{Debug: new(bool)}
+	if err := cfg.Apply(flag.NewFlagSet("empty", flag.ContinueOnError)); err == nil {
+		t.Error("Apply accepted a field for an unregistered flag")
+	}
+
+	fs := flag.NewFlagSet("oom-notifier", flag.ContinueOnError)
+	fs.Uint("debug", 0, "")
+	if err := cfg.Apply(fs); err == nil {
+		t.Error("Apply accepted false for an unsigned integer flag")
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// EnvPrefix is prepended to flag names to form environment variable names.
+const EnvPrefix = "OOM_"
+
+// EnvName returns the environment variable bound to a flag, e.g.
+// OOM_SLACK_WEBHOOK for --slack-webhook.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv sets every flag not given on the command line from its
+// environment variable. Repeatable flags take a comma separated list and
+// empty variables are ignored.
+func ApplyEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || f.Changed {
+			return
+		}
+
+		name := EnvName(f.Name)
+		value := os.Getenv(name)
+		if value == "" {
+			return
+		}
+
+		values := []string{value}
+		if f.Value.Type() == "stringArray" {
+			values = strings.Split(value, ",")
+		}
+
+		for _, v := range values {
+			if setErr := fs.Set(f.Name, strings.TrimSpace(v)); setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %v", v, name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	for flagName, want := range map[string]string{
+		"slack-webhook":   "OOM_SLACK_WEBHOOK",
+		"slack-channel":   "OOM_SLACK_CHANNEL",
+		"process-refresh": "OOM_PROCESS_REFRESH",
+		"proc-dir":        "OOM_PROC_DIR",
+	} {
+		if got := EnvName(flagName); got != want {
+			t.Errorf("EnvName(%s) = %s, want %s", flagName, got, want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	t.Setenv("OOM_SLACK_WEBHOOK", "https://hooks.slack.com/a, https://hooks.slack.com/b")
+	t.Setenv("OOM_SLACK_CHANNEL", "#oom")
+	t.Setenv("OOM_PROCESS_REFRESH", "5")
+	t.Setenv("OOM_PROC_DIR", "")
+
+	fs := testFlags()
+	if err := ApplyEnv(fs); err != nil {
+		t.Fatalf("ApplyEnv: %v", err)
+	}
+	webhooks, _ := fs.GetStringArray("slack-webhook")
+	if !reflect.DeepEqual(webhooks, []string{"https://hooks.slack.com/a", "https://hooks.slack.com/b"}) {
+		t.Errorf("slack-webhook = %q", webhooks)
+	}
+	if channel, _ := fs.GetString("slack-channel"); channel != "#oom" {
+		t.Errorf("slack-channel = %q", channel)
+	}
+	if refresh, _ := fs.GetInt("process-refresh"); refresh != 5 {
+		t.Errorf("process-refresh = %d", refresh)
+	}
+	// Empty variables are ignored
+	if dirs, _ := fs.GetStringArray("proc-dir"); !reflect.DeepEqual(dirs, []string{"/proc"}) {
+		t.Errorf("proc-dir = %q, want the default", dirs)
+	}
+}
+
+func TestFlagsOverrideEnv(t *testing.T) {
+	t.Setenv("OOM_SLACK_CHANNEL", "#env")
+	t.Setenv("OOM_PROCESS_REFRESH", "5")
+
+	fs := testFlags()
+	if err := fs.Parse([]string{"--slack-channel", "#flag"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyEnv(fs); err != nil {
+		t.Fatalf("ApplyEnv: %v", err)
+	}
+	if channel, _ := fs.GetString("slack-channel"); channel != "#flag" {
+		t.Errorf("slack-channel = %q, want the flag's #flag", channel)
+	}
+	if refresh, _ := fs.GetInt("process-refresh"); refresh != 5 {
+		t.Errorf("process-refresh = %d, want the environment's 5", refresh)
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	t.Setenv("OOM_SLACK_CHANNEL", "#env")
+	cfg, err := Load(writeConfig(t, "slack:\n  channel: \"#file\"\nmonitor:\n  process_refresh: 5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As main does: the environment is applied first and the file only sets
+	// the flags still unchanged
+	fs := testFlags()
+	if err := ApplyEnv(fs); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Apply(fs); err != nil {
+		t.Fatal(err)
+	}
+	if channel, _ := fs.GetString("slack-channel"); channel != "#env" {
+		t.Errorf("slack-channel = %q, want the environment's #env", channel)
+	}
+	if refresh, _ := fs.GetInt("process-refresh"); refresh != 5 {
+		t.Errorf("process-refresh = %d, want the file's 5", refresh)
+	}
+}
+
+func TestApplyEnvRejectsInvalidValues(t *testing.T) {
+	t.Setenv("OOM_PROCESS_REFRESH", "often")
+	if err := ApplyEnv(testFlags()); err == nil {
+		t.Error("ApplyEnv accepted a non-numeric OOM_PROCESS_REFRESH")
+	}
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// DefaultSocket is where the Docker Engine API listens by default.
+const DefaultSocket = "/var/run/docker.sock"
+
+// Docker container cgroups are "docker-<id>.scope" under the systemd driver
+// and "/docker/<id>" under cgroupfs.
+var containerIDPattern = regexp.MustCompile(`(?:docker-|/docker/)([0-9a-f]{64})(?:\.scope)?(?:/|$)`)
+
+// Container is what the alert shows about a Docker container.
+type Container struct {
+	Name  string
+	Image string
+}
+
+// Client looks up containers through the Docker Engine API on a unix socket.
+type Client struct {
+	client *http.Client
+}
+
+func NewClient(socket string) *Client {
+	dialer := &net.Dialer{Timeout: 2 * time.Second}
+	return &Client{
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// ContainerID returns the ID of the Docker container owning cgroup, or "".
+func ContainerID(cgroup string) string {
+	matches := containerIDPattern.FindStringSubmatch(cgroup)
+	if matches == nil {
+		return ""
+	}
+	return matches[1]
+}
+
+// Lookup returns the container owning cgroup. Cgroups outside Docker, and
+// any failure to reach the daemon, return false: enrichment is best-effort.
+func (c *Client) Lookup(cgroup string) (Container, bool) {
+	id := ContainerID(cgroup)
+	if id == "" {
+		return Container{}, false
+	}
+
+	container, err := c.inspect(id)
+	if err != nil {
+		logger.Warn("Failed to look up Docker container %.12s: %v", id, err)
+		return Container{}, false
+	}
+	return container, true
+}
+
+// inspectResponse is the part of GET /containers/{id}/json used here.
+type inspectResponse struct {
+	Name   string `json:"Name"`
+	Config struct {
+		Image string `json:"Image"`
+	} `json:"Config"`
+}
+
+func (c *Client) inspect(id string) (Container, error) {
+	// The host is ignored, requests go to the socket
+	resp, err := c.client.Get("http://docker/containers/" + id + "/json")
+	if err != nil {
+		return Container{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Container{}, fmt.Errorf("docker API returned non-200 status: %d", resp.StatusCode)
+	}
+
+	var inspect inspectResponse
+	if err := json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return Container{}, fmt.Errorf("failed to parse docker API response: %v", err)
+	}
+	return Container{
+		// Names are reported with a leading slash
+		Name:  strings.TrimPrefix(inspect.Name, "/"),
+		Image: inspect.Config.Image,
+	}, nil
+}
@@ -0,0 +1,104 @@
+package docker
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const containerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// newTestDocker serves handler on a unix socket, like the Docker daemon, and
+// returns the socket path.
+func newTestDocker(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return socket
+}
+
+func TestContainerID(t *testing.T) {
+	for cgroup, want := range map[string]string{
+		"/system.slice/docker-" + containerID + ".scope": containerID,
+		"/docker/" + containerID:                         containerID,
+		"/docker/" + containerID + "/init":               containerID,
+		"/system.slice/sshd.service":                     "",
+		"/kubepods/burstable/pod1a2b/" + containerID:     "",
+		"/docker/0123abcd":                               "",
+	} {
+		if got := ContainerID(cgroup); got != want {
+			t.Errorf("ContainerID(%q) = %q, want %q", cgroup, got, want)
+		}
+	}
+}
+
+func TestLookupInspectsContainer(t *testing.T) {
+	socket := newTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/"+containerID+"/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"Id": "` + containerID + `", "Name": "/billing-worker", "Config": {"Image": "registry.example.com/billing:1.4"}}`))
+	}))
+
+	container, ok := NewClient(socket).Lookup("/system.slice/docker-" + containerID + ".scope")
+	if !ok {
+		t.Fatal("container not found")
+	}
+	want := Container{Name: "billing-worker", Image: "registry.example.com/billing:1.4"}
+	if container != want {
+		t.Errorf("Lookup = %+v, want %+v", container, want)
+	}
+}
+
+func TestLookupDegradesGracefully(t *testing.T) {
+	unknown := newTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "No such container"}`, http.StatusNotFound)
+	}))
+	garbage := newTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>"))
+	}))
+
+	for name, socket := range map[string]string{
+		"unknown container": unknown,
+		"invalid response":  garbage,
+		"no daemon":         filepath.Join(t.TempDir(), "missing.sock"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if container, ok := NewClient(socket).Lookup("/docker/" + containerID); ok {
+				t.Errorf("Lookup = %+v, want nothing", container)
+			}
+		})
+	}
+}
+
+func TestLookupIgnoresOtherCgroups(t *testing.T) {
+	requests := 0
+	socket := newTestDocker(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+
+	if _, ok := NewClient(socket).Lookup("/system.slice/sshd.service"); ok {
+		t.Error("host cgroup resolved to a container")
+	}
+	if requests != 0 {
+		t.Errorf("daemon received %d requests for a cgroup outside Docker", requests)
+	}
+}
@@ -0,0 +1,127 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// maxOutput bounds the output of a hook read into an event.
+const maxOutput = 64 * 1024
+
+// Command runs an external program for every event to add
+// environment-specific fields, such as the owner of a service from a CMDB.
+// The program gets the event as JSON on stdin, as written by
+// notifier.MarshalEvent, and prints a JSON object whose keys and values are
+// added to the fields of the event.
+type Command struct {
+	command string
+	timeout time.Duration
+}
+
+// NewCommand creates a hook running command with /bin/sh -c, so that it may
+// carry arguments, and killing it after timeout.
+func NewCommand(command string, timeout time.Duration) *Command {
+	return &Command{command: command, timeout: timeout}
+}
+
+// Lookup runs the hook for event and returns the fields it printed. Any
+// failure of the hook is logged and returns false: enrichment is
+// best-effort, the event is delivered without the fields.
+func (c *Command) Lookup(event notifier.OOMEvent) (map[string]string, bool) {
+	fields, err := c.run(event)
+	if err != nil {
+		logger.Warn("Enrich command failed for PID %s, delivering the event without its fields: %v", event.PID, err)
+		return nil, false
+	}
+	return fields, true
+}
+
+func (c *Command) run(event notifier.OOMEvent) (map[string]string, error) {
+	input, err := notifier.MarshalEvent(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var stdout, stderr limitedBuffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", c.command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Children left holding stdout must not outlive the timeout either
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out after %v", c.timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("output exceeds %d bytes", maxOutput)
+	}
+	return parseFields(stdout.Bytes())
+}
+
+// parseFields decodes the JSON object printed by a hook. String values are
+// taken as is, other values as their JSON text. No output adds no fields.
+func parseFields(output []byte) (map[string]string, error) {
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil, nil
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(output, &values); err != nil {
+		return nil, fmt.Errorf("output is not a JSON object: %v", err)
+	}
+	fields := make(map[string]string, len(values))
+	for key, raw := range values {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			fields[key] = s
+			continue
+		}
+		fields[key] = string(raw)
+	}
+	return fields, nil
+}
+
+// limitedBuffer keeps the first maxOutput bytes written to it and discards
+// the rest, so that a runaway hook cannot exhaust memory. The buffer is not
+// embedded: its ReadFrom would let io.Copy bypass Write and the limit.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	kept := p
+	if room := maxOutput - b.buf.Len(); len(kept) > room {
+		b.truncated = true
+		kept = kept[:room]
+	}
+	b.buf.Write(kept)
+	// Report everything as written, the hook must not fail on a full pipe
+	return len(p), nil
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
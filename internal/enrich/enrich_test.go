@@ -0,0 +1,82 @@
+package enrich
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// stubHook writes script to an executable file and returns its path.
+func stubHook(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func kill() notifier.OOMEvent {
+	return notifier.OOMEvent{Kind: "oom", PID: "4242", Cmdline: "stress --vm 1", Hostname: "node-1"}
+}
+
+func TestCommandAddsFields(t *testing.T) {
+	// The stub answers only for the event it is given on stdin
+	hook := stubHook(t, `input=$(cat)
+case "$input" in
+*'"schema_version":'*'"pid":"4242"'*) echo '{"owner": "payments", "tier": 1, "oncall": ["alice"]}' ;;
+*) echo "unexpected input $input" >&2; exit 1 ;;
+esac`)
+
+	fields, ok := NewCommand(hook+" --team", 5*time.Second).Lookup(kill())
+	if !ok {
+		t.Fatal("Lookup failed")
+	}
+	if want := map[string]string{"owner": "payments", "tier": "1", "oncall": `["alice"]`}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+}
+
+func TestCommandWithoutOutputAddsNothing(t *testing.T) {
+	fields, ok := NewCommand("cat >/dev/null", 5*time.Second).Lookup(kill())
+	if !ok || len(fields) != 0 {
+		t.Errorf("Lookup = %v, %v, want no fields", fields, ok)
+	}
+}
+
+func TestCommandTimesOut(t *testing.T) {
+	hook := stubHook(t, `exec sleep 10`)
+
+	start := time.Now()
+	_, err := NewCommand(hook, 100*time.Millisecond).run(kill())
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("run = %v, want a timeout", err)
+	}
+	if took := time.Since(start); took > 3*time.Second {
+		t.Errorf("hook killed after %v, want about the 100ms timeout", took)
+	}
+}
+
+func TestCommandFailures(t *testing.T) {
+	for name, tt := range map[string]struct {
+		script, want string
+	}{
+		"exit status":     {`echo "no CMDB entry" >&2; exit 3`, "no CMDB entry"},
+		"not an object":   {`echo '["owner"]'`, "not a JSON object"},
+		"invalid JSON":    {`echo '{"owner":'`, "not a JSON object"},
+		"too much output": {`head -c 100000 /dev/zero | tr '\0' ' '; echo '{}'`, "exceeds"},
+	} {
+		c := NewCommand(stubHook(t, tt.script), 5*time.Second)
+		if _, err := c.run(kill()); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: run = %v, want an error containing %q", name, err, tt.want)
+		}
+		if fields, ok := c.Lookup(kill()); ok || fields != nil {
+			t.Errorf("%s: Lookup = %v, %v, want the event left as is", name, fields, ok)
+		}
+	}
+}
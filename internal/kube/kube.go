@@ -0,0 +1,157 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+var (
+	// Container cgroups end in the 64 hex digit container ID, optionally
+	// with a runtime prefix and a systemd scope suffix, e.g.
+	// "cri-containerd-<id>.scope", "docker-<id>.scope" or "<id>".
+	containerIDPattern = regexp.MustCompile(`(?:^|[-:])([0-9a-f]{64})(?:\.scope)?$`)
+
+	// Pod cgroups carry the pod UID, with underscores instead of dashes
+	// under the systemd driver, e.g. "kubepods-burstable-pod1a2b_..._.slice".
+	podUIDPattern = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})`)
+)
+
+// PodInfo names the Kubernetes container a cgroup belongs to. ContainerName is
+// empty when only the pod could be identified, e.g. for a pod-level limit,
+// and RestartCount is then 0.
+type PodInfo struct {
+	PodName       string
+	Namespace     string
+	ContainerName string
+	// RestartCount is the number of times the kubelet restarted the
+	// container, as reported in its status.
+	RestartCount int
+}
+
+// Resolver maps cgroup paths to pods using the kubelet read-only API, usually
+// served on port 10255 of the node.
+type Resolver struct {
+	url    string
+	client *http.Client
+}
+
+func NewResolver(kubeletURL string) *Resolver {
+	return &Resolver{
+		url: strings.TrimSuffix(kubeletURL, "/") + "/pods",
+		client: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+	}
+}
+
+// ParseCgroup extracts the container ID and the pod UID from a cgroup path.
+// Either is empty when the path does not contain it.
+func ParseCgroup(cgroup string) (containerID, podUID string) {
+	if matches := containerIDPattern.FindStringSubmatch(path.Base(cgroup)); matches != nil {
+		containerID = matches[1]
+	}
+	if matches := podUIDPattern.FindAllStringSubmatch(cgroup, -1); matches != nil {
+		podUID = strings.ReplaceAll(matches[len(matches)-1][1], "_", "-")
+	}
+	return containerID, podUID
+}
+
+// Lookup returns the pod of the first cgroup among cgroups that belongs to
+// one. Cgroups outside Kubernetes, and any failure to reach the kubelet,
+// return false: enrichment is best-effort.
+func (r *Resolver) Lookup(cgroups ...string) (PodInfo, bool) {
+	type key struct{ containerID, podUID string }
+	var keys []key
+	for _, cgroup := range cgroups {
+		if containerID, podUID := ParseCgroup(cgroup); containerID != "" || podUID != "" {
+			keys = append(keys, key{containerID, podUID})
+		}
+	}
+	if len(keys) == 0 {
+		return PodInfo{}, false
+	}
+
+	pods, err := r.pods()
+	if err != nil {
+		logger.Warn("Failed to look up pods from the kubelet: %v", err)
+		return PodInfo{}, false
+	}
+
+	for _, k := range keys {
+		for _, pod := range pods.Items {
+			info := PodInfo{PodName: pod.Metadata.Name, Namespace: pod.Metadata.Namespace}
+			if k.containerID != "" {
+				if status, ok := pod.container(k.containerID); ok {
+					info.ContainerName = status.Name
+					info.RestartCount = status.RestartCount
+					return info, true
+				}
+			}
+			if k.podUID != "" && pod.Metadata.UID == k.podUID {
+				return info, true
+			}
+		}
+	}
+	return PodInfo{}, false
+}
+
+// podList is the part of the kubelet's /pods response used by Lookup.
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+type pod struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+		UID       string `json:"uid"`
+	} `json:"metadata"`
+	Status struct {
+		ContainerStatuses     []containerStatus `json:"containerStatuses"`
+		InitContainerStatuses []containerStatus `json:"initContainerStatuses"`
+	} `json:"status"`
+}
+
+type containerStatus struct {
+	Name string `json:"name"`
+	// ContainerID is prefixed with the runtime, e.g. "containerd://<id>".
+	ContainerID  string `json:"containerID"`
+	RestartCount int    `json:"restartCount"`
+}
+
+// container returns the status of the container with the given ID.
+func (p pod) container(id string) (containerStatus, bool) {
+	for _, statuses := range [][]containerStatus{p.Status.ContainerStatuses, p.Status.InitContainerStatuses} {
+		for _, status := range statuses {
+			if strings.HasSuffix(status.ContainerID, "://"+id) {
+				return status, true
+			}
+		}
+	}
+	return containerStatus{}, false
+}
+
+func (r *Resolver) pods() (*podList, error) {
+	resp, err := r.client.Get(r.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("kubelet returned non-200 status: %d", resp.StatusCode)
+	}
+
+	var pods podList
+	if err := json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, fmt.Errorf("failed to parse kubelet pod list: %v", err)
+	}
+	return &pods, nil
+}
@@ -0,0 +1,150 @@
+package kube
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	containerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	podUID      = "1a2b3c4d-0000-1111-2222-333344445555"
+)
+
+// kubeletPods is a /pods response with one pod of two containers.
+const kubeletPods = `{"items": [{
+	"metadata": {"name": "api-7d9f", "namespace": "payments", "uid": "` + podUID + `"},
+	"status": {"containerStatuses": [
+		{"name": "sidecar", "containerID": "containerd://ffff", "restartCount": 0},
+		{"name": "api", "containerID": "containerd://` + containerID + `", "restartCount": 7}
+	]}
+}]}`
+
+func newTestKubelet(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pods" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(kubeletPods))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLookupReportsContainerRestartCount(t *testing.T) {
+	r := NewResolver(newTestKubelet(t).URL)
+
+	cgroup := "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b3c4d_0000_1111_2222_333344445555.slice/cri-containerd-" + containerID + ".scope"
+	info, ok := r.Lookup(cgroup)
+	if !ok {
+		t.Fatal("container not found")
+	}
+	want := PodInfo{PodName: "api-7d9f", Namespace: "payments", ContainerName: "api", RestartCount: 7}
+	if info != want {
+		t.Errorf("Lookup = %+v, want %+v", info, want)
+	}
+}
+
+func TestLookupOfPodLeavesRestartCountUnknown(t *testing.T) {
+	r := NewResolver(newTestKubelet(t).URL)
+
+	info, ok := r.Lookup("/kubepods/burstable/pod" + podUID)
+	if !ok {
+		t.Fatal("pod not found")
+	}
+	if info.ContainerName != "" || info.RestartCount != 0 {
+		t.Errorf("Lookup of a pod cgroup = %+v, want no container or restart count", info)
+	}
+}
+
+func TestLookupDegradesWhenKubeletUnreachable(t *testing.T) {
+	server := newTestKubelet(t)
+	r := NewResolver(server.URL)
+	server.Close()
+
+	if info, ok := r.Lookup("/kubepods/burstable/pod" + podUID + "/" + containerID); ok {
+		t.Errorf("Lookup with the kubelet down = %+v, want nothing", info)
+	}
+}
+
+func TestLookupIgnoresHostCgroups(t *testing.T) {
+	// No request is made for cgroups outside Kubernetes
+	r := NewResolver("http://127.0.0.1:1")
+	if _, ok := r.Lookup("/system.slice/sshd.service"); ok {
+		t.Error("host cgroup resolved to a pod")
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	for _, tt := range []struct {
+		name, cgroup        string
+		containerID, podUID string
+	}{
+		{
+			"cgroupfs driver",
+			"/kubepods/burstable/pod" + podUID + "/" + containerID,
+			containerID, podUID,
+		},
+		{
+			"systemd driver, containerd",
+			"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b3c4d_0000_1111_2222_333344445555.slice/cri-containerd-" + containerID + ".scope",
+			containerID, podUID,
+		},
+		{
+			"systemd driver, CRI-O",
+			"/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1a2b3c4d_0000_1111_2222_333344445555.slice/crio-" + containerID + ".scope",
+			containerID, podUID,
+		},
+		{
+			"pod-level limit",
+			"/kubepods.slice/kubepods-pod1a2b3c4d_0000_1111_2222_333344445555.slice",
+			"", podUID,
+		},
+		{
+			"plain Docker",
+			"/system.slice/docker-" + containerID + ".scope",
+			containerID, "",
+		},
+		{"host service", "/system.slice/sshd.service", "", ""},
+		{"root", "/", "", ""},
+		{"short ID", "/kubepods/burstable/pod" + podUID + "/0123abcd", "", podUID},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			gotContainer, gotPod := ParseCgroup(tt.cgroup)
+			if gotContainer != tt.containerID || gotPod != tt.podUID {
+				t.Errorf("ParseCgroup = %q, %q, want %q, %q", gotContainer, gotPod, tt.containerID, tt.podUID)
+			}
+		})
+	}
+}
+
+func TestLookupFallsBackToLimitingCgroup(t *testing.T) {
+	r := NewResolver(newTestKubelet(t).URL + "/")
+
+	// The victim's cgroup is unknown to the kubelet, the limiting one names
+	// the pod
+	info, ok := r.Lookup("/kubepods/burstable/pod"+podUID+"/"+"abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789", "/kubepods/burstable/pod"+podUID)
+	if !ok {
+		t.Fatal("pod not found from the limiting cgroup")
+	}
+	if info.PodName != "api-7d9f" || info.Namespace != "payments" {
+		t.Errorf("Lookup = %+v, want pod api-7d9f in payments", info)
+	}
+}
+
+func TestLookupDegradesOnKubeletErrors(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"status":  func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) },
+		"garbage": func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html>")) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			if info, ok := NewResolver(server.URL).Lookup("/kubepods/burstable/pod" + podUID); ok {
+				t.Errorf("Lookup = %+v, want nothing", info)
+			}
+		})
+	}
+}
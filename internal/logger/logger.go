@@ -1,38 +1,246 @@
 package logger
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
+// Level is the minimum severity of messages that are logged.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[string]Level{
+	"debug":   LevelDebug,
+	"info":    LevelInfo,
+	"warn":    LevelWarn,
+	"warning": LevelWarn,
+	"error":   LevelError,
+}
+
+// Output formats selectable with Options.Format.
+const (
+	// FormatText writes "[LEVEL] message key=value" lines.
+	FormatText = "text"
+	// FormatJSON writes one JSON object per line with level, ts, msg and
+	// the message's fields.
+	FormatJSON = "json"
+)
+
+// Options configures the logger.
+type Options struct {
+	// Level is the minimum level logged. Errors are always logged.
+	Level Level
+	// Format is FormatText or FormatJSON; empty means FormatText.
+	Format string
+
+	// File writes logs to this path instead of stdout. The file is rotated
+	// once it reaches MaxSize bytes, keeping one previous file with a ".1"
+	// suffix. A MaxSize of 0 disables rotation.
+	File    string
+	MaxSize int64
+
+	// Syslog sends logs to the local syslog daemon instead of stdout.
+	Syslog bool
+
+	// Stderr logs to stderr instead of stdout when neither File nor Syslog
+	// is set, leaving stdout to other output.
+	Stderr bool
+}
+
 var (
-	debugEnabled bool
-	infoLogger   *log.Logger
-	debugLogger  *log.Logger
+	level      = LevelInfo
+	jsonFormat bool
+	output     = log.New(os.Stdout, "", log.LstdFlags)
+
+	// syslogOutput replaces output when logging to syslog, which needs the
+	// level of each line.
+	syslogOutput func(l Level, line string)
 )
 
-func Init(debug bool) {
-	debugEnabled = debug
+// Field is a key/value pair attached to a log message. Fields may be passed
+// anywhere among the arguments of the logging functions and are left out of
+// the printf formatting.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a Field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// ParseLevel returns the level named by name: debug, info, warn or error.
+func ParseLevel(name string) (Level, error) {
+	l, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return LevelInfo, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+	}
+	return l, nil
+}
+
+// Init configures the logger. Messages are logged as text to stdout at info
+// level until Init is called. A log file or syslog that cannot be opened
+// falls back to stdout with a warning.
+func Init(opts Options) error {
+	var flags int
+	switch opts.Format {
+	case "", FormatText:
+		jsonFormat = false
+		flags = log.LstdFlags
+	case FormatJSON:
+		// Timestamps are part of the JSON object
+		jsonFormat = true
+	default:
+		return fmt.Errorf("unknown log format %q, expected text or json", opts.Format)
+	}
+
+	console, consoleName := os.Stdout, "stdout"
+	if opts.Stderr {
+		console, consoleName = os.Stderr, "stderr"
+	}
+
+	level = opts.Level
+	output = log.New(console, "", flags)
+	syslogOutput = nil
 
-	// Set up loggers to write to stdout
-	infoLogger = log.New(os.Stdout, "", log.LstdFlags)
-	debugLogger = log.New(os.Stdout, "", log.LstdFlags)
+	switch {
+	case opts.Syslog:
+		sink, err := openSyslog()
+		if err != nil {
+			Warn("Failed to open syslog, logging to %s: %v", consoleName, err)
+			return nil
+		}
+		syslogOutput = sink
+	case opts.File != "":
+		file, err := openRotatingFile(opts.File, opts.MaxSize)
+		if err != nil {
+			Warn("Failed to open log file, logging to %s: %v", consoleName, err)
+			return nil
+		}
+		output = log.New(file, "", flags)
+	}
+	return nil
 }
 
 func Info(format string, args ...interface{}) {
-	infoLogger.Printf("[INFO] "+format, args...)
+	if level <= LevelInfo {
+		write(LevelInfo, format, args)
+	}
 }
 
 func Error(format string, args ...interface{}) {
-	infoLogger.Printf("[ERROR] "+format, args...)
+	write(LevelError, format, args)
 }
 
 func Warn(format string, args ...interface{}) {
-	infoLogger.Printf("[WARN] "+format, args...)
+	if level <= LevelWarn {
+		write(LevelWarn, format, args)
+	}
 }
 
 func Debug(format string, args ...interface{}) {
-	if debugEnabled {
-		debugLogger.Printf("[DEBUG] "+format, args...)
+	if level <= LevelDebug {
+		write(LevelDebug, format, args)
+	}
+}
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// write formats the message with the non-Field arguments and emits it in
+// the configured format.
+func write(l Level, format string, args []interface{}) {
+	var fields []Field
+	formatArgs := args[:0:0]
+	for _, arg := range args {
+		if field, ok := arg.(Field); ok {
+			fields = append(fields, field)
+			continue
+		}
+		formatArgs = append(formatArgs, arg)
+	}
+	msg := format
+	if len(formatArgs) > 0 {
+		msg = fmt.Sprintf(format, formatArgs...)
+	}
+
+	var line string
+	if jsonFormat {
+		line = jsonLine(l.String(), msg, fields)
+	} else {
+		var b strings.Builder
+		b.WriteString("[" + strings.ToUpper(l.String()) + "] " + msg)
+		for _, field := range fields {
+			fmt.Fprintf(&b, " %s=%v", field.Key, field.Value)
+		}
+		line = b.String()
+	}
+
+	if syslogOutput != nil {
+		syslogOutput(l, line)
+		return
+	}
+	output.Print(line)
+}
+
+// jsonLine renders a message as a JSON object. level, ts and msg come first;
+// fields reusing those keys are dropped.
+func jsonLine(levelName, msg string, fields []Field) string {
+	var b strings.Builder
+	b.WriteString(`{"level":`)
+	b.Write(marshal(levelName))
+	b.WriteString(`,"ts":`)
+	b.Write(marshal(time.Now().UTC().Format(time.RFC3339Nano)))
+	b.WriteString(`,"msg":`)
+	b.Write(marshal(msg))
+	for _, field := range fields {
+		switch field.Key {
+		case "level", "ts", "msg":
+			continue
+		}
+		b.WriteString(",")
+		b.Write(marshal(field.Key))
+		b.WriteString(":")
+		b.Write(marshal(field.Value))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// marshal encodes value as JSON. Errors and Stringers are encoded as their
+// text, values that cannot be encoded fall back to their %v form.
+func marshal(value interface{}) []byte {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case fmt.Stringer:
+		value = v.String()
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%v", value))
 	}
+	return data
 }
@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keepLogger restores the logger configuration at the end of the test.
+func keepLogger(t *testing.T) {
+	t.Helper()
+	savedLevel, savedJSON, savedOutput, savedSyslog := level, jsonFormat, output, syslogOutput
+	t.Cleanup(func() {
+		level, jsonFormat, output, syslogOutput = savedLevel, savedJSON, savedOutput, savedSyslog
+	})
+}
+
+// capture logs at l to the returned buffer, as JSON when asJSON is set,
+// until the end of the test.
+func capture(t *testing.T, l Level, asJSON bool) *bytes.Buffer {
+	t.Helper()
+	keepLogger(t)
+
+	var buf bytes.Buffer
+	level, jsonFormat, output = l, asJSON, log.New(&buf, "", 0)
+	return &buf
+}
+
+func TestDebugGatedByLevel(t *testing.T) {
+	for _, tt := range []struct {
+		level Level
+		want  []string
+	}{
+		{LevelDebug, []string{"[DEBUG] d", "[INFO] i", "[WARN] w", "[ERROR] e"}},
+		{LevelInfo, []string{"[INFO] i", "[WARN] w", "[ERROR] e"}},
+		{LevelWarn, []string{"[WARN] w", "[ERROR] e"}},
+		// Errors are always logged
+		{LevelError, []string{"[ERROR] e"}},
+	} {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			buf := capture(t, tt.level, false)
+			Debug("d")
+			Info("i")
+			Warn("w")
+			Error("e")
+
+			got := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("logged %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]Level{
+		"debug":   LevelDebug,
+		"INFO":    LevelInfo,
+		" warn ":  LevelWarn,
+		"warning": LevelWarn,
+		"error":   LevelError,
+	} {
+		if got, err := ParseLevel(name); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel accepted verbose")
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	buf := capture(t, LevelInfo, true)
+	Info("Kernel event received for %s", "stress", F("pid", "4242"), F("cmdline", "stress --vm 1"), F("err", errors.New("boom")))
+	Info("reserved keys", F("msg", "dropped"), F("level", "dropped"), F("count", 3))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2: %q", len(lines), lines)
+	}
+
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("line %q is not valid JSON: %v", lines[0], err)
+	}
+	for key, want := range map[string]any{
+		"level":   "info",
+		"msg":     "Kernel event received for stress",
+		"pid":     "4242",
+		"cmdline": "stress --vm 1",
+		"err":     "boom",
+	} {
+		if first[key] != want {
+			t.Errorf("%s = %v, want %v", key, first[key], want)
+		}
+	}
+	if ts, _ := first["ts"].(string); ts == "" {
+		t.Errorf("ts missing from %s", lines[0])
+	} else if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		t.Errorf("ts %q is not RFC 3339: %v", ts, err)
+	}
+
+	var second map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("line %q is not valid JSON: %v", lines[1], err)
+	}
+	if second["msg"] != "reserved keys" || second["level"] != "info" || second["count"] != float64(3) {
+		t.Errorf("fields reusing level or msg overrode them: %s", lines[1])
+	}
+}
+
+func TestTextOutputAppendsFields(t *testing.T) {
+	buf := capture(t, LevelInfo, false)
+	Info("Sent %d notifications", 2, F("notifier", "slack"))
+
+	if got, want := strings.TrimSpace(buf.String()), "[INFO] Sent 2 notifications notifier=slack"; got != want {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
+
+func TestInitRejectsUnknownFormat(t *testing.T) {
+	if err := Init(Options{Format: "xml"}); err == nil {
+		t.Error("Init accepted the xml format")
+	}
+}
@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileRotatesAtSizeThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oom-notifier.log")
+	r, err := openRotatingFile(path, 20)
+	if err != nil {
+		t.Fatalf("openRotatingFile: %v", err)
+	}
+	defer func() { r.file.Close() }()
+
+	for _, line := range []string{"first line\n", "second\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 18 bytes, still below the threshold
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatalf("rotated below the size threshold: %v", err)
+	}
+
+	if _, err := r.Write([]byte("third\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path+".1"); got != "first line\nsecond\n" {
+		t.Errorf("backup = %q, want the lines written before the threshold", got)
+	}
+	if got := readFile(t, path); got != "third\n" {
+		t.Errorf("log file = %q, want the line that crossed the threshold", got)
+	}
+
+	// Rotating again replaces the previous backup
+	if _, err := r.Write([]byte(strings.Repeat("x", 19) + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path+".1"); got != "third\n" {
+		t.Errorf("backup after a second rotation = %q, want \"third\\n\"", got)
+	}
+}
+
+func TestRotatingFileNeverSplitsLongLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oom-notifier.log")
+	r, err := openRotatingFile(path, 10)
+	if err != nil {
+		t.Fatalf("openRotatingFile: %v", err)
+	}
+	defer func() { r.file.Close() }()
+
+	long := strings.Repeat("y", 30) + "\n"
+	if _, err := r.Write([]byte(long)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != long {
+		t.Errorf("log file = %q, want the whole line", got)
+	}
+}
+
+func TestRotatingFileAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oom-notifier.log")
+	if err := os.WriteFile(path, []byte("before restart\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := openRotatingFile(path, 20)
+	if err != nil {
+		t.Fatalf("openRotatingFile: %v", err)
+	}
+	defer func() { r.file.Close() }()
+
+	// The existing 15 bytes count toward the threshold
+	if _, err := r.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path+".1"); got != "before restart\n" {
+		t.Errorf("backup = %q, want the file of the previous run", got)
+	}
+}
+
+func TestInitFallsBackToConsoleWhenFileCannotBeOpened(t *testing.T) {
+	keepLogger(t)
+
+	path := filepath.Join(t.TempDir(), "missing", "oom-notifier.log")
+	if err := Init(Options{Level: LevelInfo, File: path, Stderr: true}); err != nil {
+		t.Fatalf("Init = %v, want the console fallback", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("log file in a missing directory created: %v", err)
+	}
+	if output.Writer() != os.Stderr {
+		t.Error("logger does not fall back to the console")
+	}
+}
+
+func TestInitLogsToFile(t *testing.T) {
+	keepLogger(t)
+
+	path := filepath.Join(t.TempDir(), "oom-notifier.log")
+	if err := Init(Options{Level: LevelInfo, File: path, MaxSize: 1024}); err != nil {
+		t.Fatal(err)
+	}
+	Info("written to the file")
+	if r, ok := output.Writer().(*rotatingFile); ok {
+		defer r.file.Close()
+	}
+
+	if got := readFile(t, path); !strings.Contains(got, "[INFO] written to the file") {
+		t.Errorf("log file = %q, want the message", got)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"log/syslog"
+)
+
+// openSyslog connects to the local syslog daemon. Lines are sent with the
+// priority matching their level.
+func openSyslog() (func(l Level, line string), error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "oom-notifier")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(l Level, line string) {
+		switch l {
+		case LevelDebug:
+			w.Debug(line)
+		case LevelInfo:
+			w.Info(line)
+		case LevelWarn:
+			w.Warning(line)
+		default:
+			w.Err(line)
+		}
+	}, nil
+}
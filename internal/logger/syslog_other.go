@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package logger
+
+import (
+	"fmt"
+)
+
+func openSyslog() (func(l Level, line string), error) {
+	return nil, fmt.Errorf("syslog is not supported on this platform")
+}
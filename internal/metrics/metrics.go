@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics exported in the Prometheus text format.
+var (
+	// OOMEvents counts detected OOM kills, before muting, deduplication and
+	// sampling.
+	OOMEvents = NewCounter("oom_events_total", "OOM kills detected.", "hostname", "cmdline")
+
+	// Notifications counts notification deliveries by notifier and result,
+	// either "success" or "failure".
+	Notifications = NewCounter("oom_notifications_total", "Notifications sent, by notifier and result.", "notifier", "result")
+
+	// StaleEvents counts events dropped for being older than
+	// --max-event-age when they were about to be delivered.
+	StaleEvents = NewCounter("oom_stale_events_total", "Events dropped for being older than the maximum event age.")
+
+	// MutedEvents counts events dropped for coming from a host muted by
+	// --mute-host, by hostname.
+	MutedEvents = NewCounter("oom_muted_events_total", "Events dropped for coming from a muted host.", "hostname")
+
+	// MonitorErrors counts the errors the monitor kept running after, by
+	// category: source-read, parse or enrichment.
+	MonitorErrors = NewCounter("oom_monitor_errors_total", "Non-fatal errors of the kernel monitor, by category.", "category")
+
+	// SampleTotal counts the OOM kills considered by --sample-rate, and
+	// SampleDelivered those of them delivered.
+	SampleTotal     = NewCounter("oom_sample_events_total", "OOM kills considered for sampling.")
+	SampleDelivered = NewCounter("oom_sampled_events_total", "OOM kills delivered by sampling.")
+)
+
+var (
+	mu       sync.Mutex
+	counters []*Counter
+	funcs    []funcMetric
+)
+
+// Counter is a monotonically increasing value per combination of labels.
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*sample
+}
+
+type sample struct {
+	labels []string
+	value  float64
+}
+
+// funcMetric is a metric whose value is read from fn, with fixed labels.
+type funcMetric struct {
+	name   string
+	help   string
+	kind   string
+	labels string
+	fn     func() float64
+}
+
+// NewCounter creates and registers a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*sample),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	counters = append(counters, c)
+	return c
+}
+
+// Inc adds one to the counter for the given label values, which must match
+// the label names in number and order.
+func (c *Counter) Inc(labels ...string) {
+	if len(labels) != len(c.labels) {
+		panic(fmt.Sprintf("metric %s: got %d label values, want %d", c.name, len(labels), len(c.labels)))
+	}
+
+	key := strings.Join(labels, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.values[key]
+	if !ok {
+		s = &sample{labels: labels}
+		c.values[key] = s
+	}
+	s.value++
+}
+
+// RegisterGauge registers a gauge whose value is read from fn at every
+// scrape. labels are label name and value pairs, for registering the same
+// gauge once per instance of what it measures.
+func RegisterGauge(name, help string, fn func() float64, labels ...string) {
+	registerFunc(name, help, "gauge", fn, labels...)
+}
+
+// RegisterCounterFunc registers a counter whose value is read from fn at
+// every scrape, for counts kept elsewhere. fn must never decrease. labels
+// are label name and value pairs, as for RegisterGauge.
+func RegisterCounterFunc(name, help string, fn func() float64, labels ...string) {
+	registerFunc(name, help, "counter", fn, labels...)
+}
+
+func registerFunc(name, help, kind string, fn func() float64, labels ...string) {
+	if len(labels)%2 != 0 {
+		panic(fmt.Sprintf("metric %s: labels must be name and value pairs", name))
+	}
+	var rendered string
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], escapeLabel(labels[i+1])))
+		}
+		rendered = "{" + strings.Join(pairs, ",") + "}"
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	funcs = append(funcs, funcMetric{name: name, help: help, kind: kind, labels: rendered, fn: fn})
+}
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		fmt.Fprint(w, render())
+	})
+}
+
+func render() string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var b strings.Builder
+	for _, c := range counters {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for _, line := range c.samples() {
+			b.WriteString(line)
+		}
+	}
+	// Samples of the same metric are grouped under one description, in
+	// registration order
+	described := make(map[string]bool)
+	for i, f := range funcs {
+		if described[f.name] {
+			continue
+		}
+		described[f.name] = true
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, g := range funcs[i:] {
+			if g.name == f.name {
+				fmt.Fprintf(&b, "%s%s %v\n", g.name, g.labels, g.fn())
+			}
+		}
+	}
+	return b.String()
+}
+
+// samples renders the counter's values sorted by labels, so scrapes are
+// stable.
+func (c *Counter) samples() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lines := make([]string, 0, len(c.values))
+	for _, s := range c.values {
+		pairs := make([]string, len(c.labels))
+		for i, name := range c.labels {
+			pairs[i] = fmt.Sprintf("%s=\"%s\"", name, escapeLabel(s.labels[i]))
+		}
+		lines = append(lines, fmt.Sprintf("%s{%s} %v\n", c.name, strings.Join(pairs, ","), s.value))
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderCounterFunc(t *testing.T) {
+	var dropped float64
+	RegisterCounterFunc("test_dropped_total", "Test drops.", func() float64 { return dropped })
+	dropped = 7
+
+	want := "# HELP test_dropped_total Test drops.\n# TYPE test_dropped_total counter\ntest_dropped_total 7\n"
+	if out := render(); !strings.Contains(out, want) {
+		t.Errorf("render() does not contain\n%s\ngot\n%s", want, out)
+	}
+}
+
+func TestRenderCounterLabels(t *testing.T) {
+	c := NewCounter("test_events_total", "Test events.", "hostname")
+	c.Inc("b")
+	c.Inc("a\"1")
+	c.Inc("b")
+
+	want := "test_events_total{hostname=\"a\\\"1\"} 1\ntest_events_total{hostname=\"b\"} 2\n"
+	if out := render(); !strings.Contains(out, want) {
+		t.Errorf("render() does not contain\n%s\ngot\n%s", want, out)
+	}
+}
+
+func TestRenderLabeledGauges(t *testing.T) {
+	RegisterGauge("test_connected", "Test connections.", func() float64 { return 1 }, "notifier", "kafka")
+	RegisterGauge("test_other", "Another gauge.", func() float64 { return 3 })
+	RegisterGauge("test_connected", "Test connections.", func() float64 { return 0 }, "notifier", "nats")
+
+	want := "# HELP test_connected Test connections.\n# TYPE test_connected gauge\n" +
+		"test_connected{notifier=\"kafka\"} 1\ntest_connected{notifier=\"nats\"} 0\n"
+	out := render()
+	if !strings.Contains(out, want) {
+		t.Errorf("render() does not contain\n%s\ngot\n%s", want, out)
+	}
+	if n := strings.Count(out, "# HELP test_connected "); n != 1 {
+		t.Errorf("test_connected described %d times, want once", n)
+	}
+}
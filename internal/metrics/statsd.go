@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// Reporter pushes measurements to an external metrics system as they
+// happen, next to the Prometheus counters that are scraped.
+type Reporter interface {
+	// OOMEvent records a detected OOM kill on hostname.
+	OOMEvent(hostname string)
+	// Notification records a delivery by notifier that took duration and
+	// ended in result, either "success" or "failure".
+	Notification(notifier, result string, duration time.Duration)
+}
+
+// NopReporter discards all measurements. It is used when no external
+// metrics system is configured.
+type NopReporter struct{}
+
+func (NopReporter) OOMEvent(hostname string)                                     {}
+func (NopReporter) Notification(notifier, result string, duration time.Duration) {}
+
+// statsdPrefix is prepended to every StatsD metric name.
+const statsdPrefix = "oom_notifier."
+
+// StatsdReporter sends metrics to a StatsD server over UDP, with tags in the
+// DogStatsD "|#key:value" format. Sends are fire-and-forget: a server that is
+// down loses metrics but never slows the pipeline.
+type StatsdReporter struct {
+	conn net.Conn
+}
+
+// NewStatsdReporter creates a reporter sending to addr, a host:port UDP
+// address.
+func NewStatsdReporter(addr string) (*StatsdReporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd at %s: %v", addr, err)
+	}
+	return &StatsdReporter{conn: conn}, nil
+}
+
+func (s *StatsdReporter) OOMEvent(hostname string) {
+	s.send("oom_events:1|c", "hostname", hostname)
+}
+
+func (s *StatsdReporter) Notification(notifier, result string, duration time.Duration) {
+	s.send("notifications:1|c", "notifier", notifier, "result", result)
+	s.send(fmt.Sprintf("notification_duration:%d|ms", duration.Milliseconds()), "notifier", notifier, "result", result)
+}
+
+// Close closes the UDP socket.
+func (s *StatsdReporter) Close() error {
+	return s.conn.Close()
+}
+
+// send writes one metric line, tagged with the given key/value pairs.
+func (s *StatsdReporter) send(metric string, tags ...string) {
+	var b strings.Builder
+	b.WriteString(statsdPrefix + metric)
+	for i := 0; i+1 < len(tags); i += 2 {
+		if i == 0 {
+			b.WriteString("|#")
+		} else {
+			b.WriteString(",")
+		}
+		b.WriteString(tags[i] + ":" + statsdTagEscaper.Replace(tags[i+1]))
+	}
+
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		logger.Debug("Failed to send statsd metric: %v", err)
+	}
+}
+
+// statsdTagEscaper replaces the characters that delimit tags and fields.
+var statsdTagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// listenUDP returns a UDP listener on a free local port.
+func listenUDP(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// receive reads n datagrams from conn.
+func receive(t *testing.T, conn *net.UDPConn, n int) []string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1500)
+	lines := make([]string, 0, n)
+	for len(lines) < n {
+		size, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("received %q, then: %v", lines, err)
+		}
+		lines = append(lines, string(buf[:size]))
+	}
+	return lines
+}
+
+func TestStatsdReporterSendsTaggedMetrics(t *testing.T) {
+	server := listenUDP(t)
+	reporter, err := NewStatsdReporter(server.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewStatsdReporter: %v", err)
+	}
+	defer reporter.Close()
+
+	reporter.OOMEvent("node-1")
+	reporter.Notification("slack", "failure", 1500*time.Millisecond)
+
+	want := []string{
+		"oom_notifier.oom_events:1|c|#hostname:node-1",
+		"oom_notifier.notifications:1|c|#notifier:slack,result:failure",
+		"oom_notifier.notification_duration:1500|ms|#notifier:slack,result:failure",
+	}
+	got := receive(t, server, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("metric %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStatsdReporterEscapesTags(t *testing.T) {
+	server := listenUDP(t)
+	reporter, err := NewStatsdReporter(server.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("NewStatsdReporter: %v", err)
+	}
+	defer reporter.Close()
+
+	reporter.OOMEvent("node,1|#a\nb")
+	if got, want := receive(t, server, 1)[0], "oom_notifier.oom_events:1|c|#hostname:node_1__a_b"; got != want {
+		t.Errorf("metric = %q, want %q", got, want)
+	}
+}
+
+func TestNewStatsdReporterRejectsInvalidAddress(t *testing.T) {
+	if _, err := NewStatsdReporter("no-port"); err == nil {
+		t.Error("NewStatsdReporter accepted an address without a port")
+	}
+}
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"regexp"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// allocFailureWindow is how long, in kernel microseconds, a page allocation
+// failure is considered part of the OOM that follows it.
+const allocFailureWindow = 10 * 1000 * 1000
+
+// Some kernels log the failed allocation ahead of the OOM report, e.g.
+// "kworker/u16:3: page allocation failure: order:4, mode:0x40cc0(GFP_KERNEL|__GFP_COMP), ...".
+var allocFailurePattern = regexp.MustCompile(`page allocation failure: order:(\d+), mode:(0x[0-9a-fA-F]+)(?:\(([^)]*)\))?`)
+
+type allocFailure struct {
+	order     string
+	gfpFlags  string
+	timestamp uint64
+}
+
+// recordAllocFailure remembers a page allocation failure so it can be
+// attached to the next OOM event.
+func (m *OOMMonitor) recordAllocFailure(entry KmsgEntry) {
+	matches := allocFailurePattern.FindStringSubmatch(entry.Message)
+	if matches == nil {
+		return
+	}
+
+	failure := &allocFailure{
+		order:     matches[1],
+		gfpFlags:  matches[2],
+		timestamp: entry.Timestamp,
+	}
+	if matches[3] != "" {
+		failure.gfpFlags = matches[3]
+	}
+
+	logger.Debug("Page allocation failure: order=%s, gfp=%s", failure.order, failure.gfpFlags)
+	m.allocFailure = failure
+}
+
+// takeAllocFailure returns the allocation failure preceding an OOM logged at
+// timestamp, if any, and forgets it.
+func (m *OOMMonitor) takeAllocFailure(timestamp uint64) *allocFailure {
+	failure := m.allocFailure
+	m.allocFailure = nil
+
+	if failure == nil || timestamp < failure.timestamp || timestamp-failure.timestamp > allocFailureWindow {
+		return nil
+	}
+	return failure
+}
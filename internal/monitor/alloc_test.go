@@ -0,0 +1,51 @@
+package monitor
+
+import "testing"
+
+const killLine = "Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0"
+
+func TestAllocFailureIsAttachedToFollowingKill(t *testing.T) {
+	events := detect(t, Options{}, `4,100,5000000,-;kworker/u16:3: page allocation failure: order:4, mode:0x40cc0(GFP_KERNEL|__GFP_COMP), nodemask=(null),cpuset=/,mems_allowed=0
+3,101,5000100,-;`+killLine+`
+`)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].AllocOrder != "4" || events[0].GFPFlags != "GFP_KERNEL|__GFP_COMP" {
+		t.Errorf("allocation = order %q, flags %q, want order 4, GFP_KERNEL|__GFP_COMP", events[0].AllocOrder, events[0].GFPFlags)
+	}
+}
+
+func TestAllocFailureWithoutFlagNames(t *testing.T) {
+	events := detect(t, Options{}, `4,100,5000000,-;java: page allocation failure: order:0, mode:0x1100cca
+3,101,5000100,-;`+killLine+`
+`)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].AllocOrder != "0" || events[0].GFPFlags != "0x1100cca" {
+		t.Errorf("allocation = order %q, flags %q, want order 0, 0x1100cca", events[0].AllocOrder, events[0].GFPFlags)
+	}
+}
+
+func TestAllocFailureIsForgotten(t *testing.T) {
+	// Logged more than allocFailureWindow before the kill
+	events := detect(t, Options{}, `4,100,1000000,-;java: page allocation failure: order:2, mode:0x40cc0(GFP_KERNEL)
+3,101,20000000,-;`+killLine+`
+`)
+	if len(events) != 1 || events[0].AllocOrder != "" {
+		t.Errorf("events = %+v, want one kill without the unrelated allocation failure", events)
+	}
+
+	// and used by one kill only
+	events = detect(t, Options{}, `4,100,5000000,-;java: page allocation failure: order:2, mode:0x40cc0(GFP_KERNEL)
+3,101,5000100,-;`+killLine+`
+3,102,5000200,-;Out of memory: Killed process 4343 (java) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0
+`)
+	if len(events) != 2 {
+		t.Fatalf("detected %d events, want 2", len(events))
+	}
+	if events[0].AllocOrder != "2" || events[1].AllocOrder != "" {
+		t.Errorf("allocation orders %q and %q, want 2 for the first kill only", events[0].AllocOrder, events[1].AllocOrder)
+	}
+}
@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// CgroupRoot is where the cgroup v2 hierarchy is mounted.
+const CgroupRoot = "/sys/fs/cgroup"
+
+// CgroupWatcher watches the oom_kill counter in the memory.events file of
+// cgroup v2 groups, reporting kills in a targeted container without going
+// through the kernel log. The counter includes kills in descendant groups.
+type CgroupWatcher struct {
+	cgroupFS fs.FS
+	paths    []string
+	interval time.Duration
+	counts   map[string]uint64
+}
+
+// NewCgroupWatcher creates a watcher polling the cgroups at paths every
+// interval. Paths are cgroup paths as in /proc/<pid>/cgroup, e.g.
+// "/kubepods/pod1", or directories under CgroupRoot.
+func NewCgroupWatcher(paths []string, interval time.Duration) (*CgroupWatcher, error) {
+	return NewCgroupWatcherFS(os.DirFS(CgroupRoot), paths, interval)
+}
+
+// NewCgroupWatcherFS creates a watcher reading from cgroupFS, a tree laid
+// out like CgroupRoot. Kills counted before it was created are not
+// reported.
+func NewCgroupWatcherFS(cgroupFS fs.FS, paths []string, interval time.Duration) (*CgroupWatcher, error) {
+	w := &CgroupWatcher{
+		cgroupFS: cgroupFS,
+		interval: interval,
+		counts:   make(map[string]uint64),
+	}
+	for _, p := range paths {
+		p = "/" + strings.Trim(strings.TrimPrefix(p, CgroupRoot), "/")
+		count, err := w.readOOMKills(p)
+		if err != nil {
+			return nil, err
+		}
+		w.paths = append(w.paths, p)
+		w.counts[p] = count
+		logger.Debug("Watching cgroup %s, %d OOM kills so far", p, count)
+	}
+	return w, nil
+}
+
+// Start polls the cgroups until ctx is cancelled, sending an event on
+// eventChan whenever the OOM kill counter of one of them increases.
+func (w *CgroupWatcher) Start(ctx context.Context, eventChan chan<- OOMEventData) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Debug("Stopping cgroup watcher")
+			return
+		}
+
+		for _, event := range w.check() {
+			select {
+			case eventChan <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// check reads the counters and returns an event for each cgroup with new
+// kills. A cgroup that cannot be read, e.g. because it was removed, keeps its
+// last count.
+func (w *CgroupWatcher) check() []OOMEventData {
+	var events []OOMEventData
+	for _, p := range w.paths {
+		count, err := w.readOOMKills(p)
+		if err != nil {
+			logger.Debug("Failed to read OOM kill counter: %v", err)
+			continue
+		}
+		previous := w.counts[p]
+		w.counts[p] = count
+		if count <= previous {
+			continue
+		}
+
+		logger.Info("Cgroup %s OOM kill counter increased from %d to %d", p, previous, count)
+		events = append(events, w.newEvent(p, previous, count))
+	}
+	return events
+}
+
+func (w *CgroupWatcher) newEvent(cgroup string, previous, count uint64) OOMEventData {
+	hostname, _ := os.Hostname()
+	return OOMEventData{
+		Kind:     KindCgroupOOM,
+		Message:  fmt.Sprintf("memory.events oom_kill of %s increased from %d to %d", cgroup, previous, count),
+		Hostname: hostname,
+		Kernel:   KernelVersion(),
+		Time:     time.Now().UnixMilli(),
+		Fields: map[string]string{
+			"kills":    strconv.FormatUint(count-previous, 10),
+			"oom_kill": strconv.FormatUint(count, 10),
+		},
+		OOMType:    OOMTypeMemcg,
+		Cgroup:     cgroup,
+		TaskCgroup: cgroup,
+	}
+}
+
+// readOOMKills returns the oom_kill counter from the memory.events file of
+// cgroup.
+func (w *CgroupWatcher) readOOMKills(cgroup string) (uint64, error) {
+	file, err := w.cgroupFS.Open(path.Join(strings.TrimPrefix(cgroup, "/"), "memory.events"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open memory.events of cgroup %s, cgroup v2 is required: %v", cgroup, err)
+	}
+	defer file.Close()
+
+	// Lines are "key value", e.g. "oom_kill 3"
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || key != "oom_kill" {
+			continue
+		}
+		count, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid oom_kill counter of cgroup %s: %v", cgroup, err)
+		}
+		return count, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read memory.events of cgroup %s: %v", cgroup, err)
+	}
+	return 0, fmt.Errorf("no oom_kill counter in memory.events of cgroup %s", cgroup)
+}
@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// setOOMKills writes the memory.events of cgroup in cgroupFS with count
+// OOM kills.
+func setOOMKills(cgroupFS fstest.MapFS, cgroup string, count int) {
+	events := fmt.Sprintf("low 0\nhigh 0\nmax 12\noom %d\noom_kill %d\noom_group_kill 0\n", count, count)
+	cgroupFS[cgroup+"/memory.events"] = &fstest.MapFile{Data: []byte(events)}
+}
+
+func TestCgroupWatcherReportsNewKills(t *testing.T) {
+	cgroupFS := fstest.MapFS{}
+	setOOMKills(cgroupFS, "kubepods/pod1", 2)
+	setOOMKills(cgroupFS, "system.slice/db.service", 0)
+
+	w, err := NewCgroupWatcherFS(cgroupFS, []string{"/kubepods/pod1", CgroupRoot + "/system.slice/db.service/"}, time.Second)
+	if err != nil {
+		t.Fatalf("NewCgroupWatcherFS: %v", err)
+	}
+	if events := w.check(); len(events) != 0 {
+		t.Errorf("%d events for the kills counted before watching, want none", len(events))
+	}
+
+	setOOMKills(cgroupFS, "kubepods/pod1", 5)
+	events := w.check()
+	if len(events) != 1 {
+		t.Fatalf("%d events, want one for the increased counter", len(events))
+	}
+	event := events[0]
+	if event.Kind != KindCgroupOOM || event.Cgroup != "/kubepods/pod1" || event.OOMType != OOMTypeMemcg {
+		t.Errorf("event %+v, want a cgroup OOM of /kubepods/pod1", event)
+	}
+	if event.Fields["kills"] != "3" || event.Fields["oom_kill"] != "5" {
+		t.Errorf("fields %v, want the 3 new kills of 5", event.Fields)
+	}
+	if events := w.check(); len(events) != 0 {
+		t.Errorf("%d events without new kills, want none", len(events))
+	}
+
+	setOOMKills(cgroupFS, "system.slice/db.service", 1)
+	if events := w.check(); len(events) != 1 || events[0].Cgroup != "/system.slice/db.service" {
+		t.Errorf("events %+v, want the kill in the second cgroup", events)
+	}
+}
+
+func TestCgroupWatcherKeepsCountOfRemovedCgroup(t *testing.T) {
+	cgroupFS := fstest.MapFS{}
+	setOOMKills(cgroupFS, "kubepods/pod1", 2)
+	w, err := NewCgroupWatcherFS(cgroupFS, []string{"/kubepods/pod1"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delete(cgroupFS, "kubepods/pod1/memory.events")
+	if events := w.check(); len(events) != 0 {
+		t.Errorf("%d events for a removed cgroup, want none", len(events))
+	}
+	setOOMKills(cgroupFS, "kubepods/pod1", 2)
+	if events := w.check(); len(events) != 0 {
+		t.Errorf("%d events once the cgroup is back unchanged, want none", len(events))
+	}
+}
+
+func TestNewCgroupWatcherRequiresCgroupV2(t *testing.T) {
+	cgroupFS := fstest.MapFS{
+		"v1/memory.oom_control": {Data: []byte("oom_kill_disable 0\n")},
+		"broken/memory.events":  {Data: []byte("oom_kill many\n")},
+	}
+	for _, cgroup := range []string{"/missing", "/v1", "/broken"} {
+		if _, err := NewCgroupWatcherFS(cgroupFS, []string{cgroup}, time.Second); err == nil {
+			t.Errorf("watching %s succeeded", cgroup)
+		}
+	}
+}
+
+func TestCgroupWatcherStartSendsEvents(t *testing.T) {
+	cgroupFS := fstest.MapFS{}
+	setOOMKills(cgroupFS, "kubepods/pod1", 0)
+	w, err := NewCgroupWatcherFS(cgroupFS, []string{"/kubepods/pod1"}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changed before Start, a MapFS must not change while it is read
+	setOOMKills(cgroupFS, "kubepods/pod1", 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	events := make(chan OOMEventData, 1)
+	go func() {
+		w.Start(ctx, events)
+		close(stopped)
+	}()
+	select {
+	case event := <-events:
+		if event.Cgroup != "/kubepods/pod1" {
+			t.Errorf("event for %s, want /kubepods/pod1", event.Cgroup)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event for the kill")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watcher still running after cancellation")
+	}
+}
@@ -0,0 +1,174 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// Kinds of kernel events reported by the monitor.
+const (
+	KindOOM      = "oom"
+	KindSegfault = "segfault"
+	KindTrap     = "trap"
+	KindHungTask = "hung_task"
+
+	// KindCgroupOOM is raised by a CgroupWatcher.
+	KindCgroupOOM = "cgroup_oom"
+	// KindMemoryPressure is raised by a PressureWatcher, before any process
+	// was killed.
+	KindMemoryPressure = "memory_pressure"
+)
+
+// Matcher is a user-defined rule mapping a kernel message pattern to an
+// event kind. Fields maps capture groups, by name or index, to event fields:
+// "pid" and "name" identify the process, any other field is attached to the
+// event as-is.
+type Matcher struct {
+	Kind    string            `json:"kind"`
+	Pattern string            `json:"pattern"`
+	Fields  map[string]string `json:"fields"`
+}
+
+// eventMatcher recognises one kind of kernel message. fields maps capture
+// group indexes to the event field they populate.
+type eventMatcher struct {
+	kind    string
+	pattern *regexp.Regexp
+	fields  map[int]string
+}
+
+// kernelMatch is the result of matching a kernel message.
+type kernelMatch struct {
+	kind   string
+	pid    int
+	name   string
+	fields map[string]string
+}
+
+var (
+	segfaultPattern = regexp.MustCompile(`(?P<name>\S+)\[(?P<pid>\d+)\]: segfault at `)
+	trapPattern     = regexp.MustCompile(`traps: (?P<name>\S+)\[(?P<pid>\d+)\] `)
+	hungTaskPattern = regexp.MustCompile(`task (?P<name>\S+):(?P<pid>\d+) blocked for more than \d+ seconds`)
+)
+
+// newBuiltinMatcher builds a matcher whose named groups map directly to
+// event fields.
+func newBuiltinMatcher(kind string, pattern *regexp.Regexp) eventMatcher {
+	fields := make(map[int]string)
+	for i, group := range pattern.SubexpNames() {
+		if group != "" {
+			fields[i] = group
+		}
+	}
+	return eventMatcher{kind: kind, pattern: pattern, fields: fields}
+}
+
+// newSignalMatchers returns the built-in matchers for non-OOM process
+// terminations that the user opted into.
+func newSignalMatchers(watchSegfaults, watchHungTasks bool) []eventMatcher {
+	var matchers []eventMatcher
+	if watchSegfaults {
+		matchers = append(matchers,
+			newBuiltinMatcher(KindSegfault, segfaultPattern),
+			newBuiltinMatcher(KindTrap, trapPattern),
+		)
+	}
+	if watchHungTasks {
+		matchers = append(matchers, newBuiltinMatcher(KindHungTask, hungTaskPattern))
+	}
+	return matchers
+}
+
+// compileMatcher validates a user-defined matcher and resolves its capture
+// groups.
+func compileMatcher(m Matcher) (eventMatcher, error) {
+	if m.Kind == "" {
+		return eventMatcher{}, fmt.Errorf("kind is required")
+	}
+	if m.Kind == KindOOM {
+		return eventMatcher{}, fmt.Errorf("kind %q is reserved", KindOOM)
+	}
+
+	pattern, err := regexp.Compile(m.Pattern)
+	if err != nil {
+		return eventMatcher{}, fmt.Errorf("invalid pattern: %v", err)
+	}
+
+	fields := make(map[int]string, len(m.Fields))
+	for group, field := range m.Fields {
+		index, err := strconv.Atoi(group)
+		if err != nil {
+			index = pattern.SubexpIndex(group)
+		}
+		if index < 1 || index > pattern.NumSubexp() {
+			return eventMatcher{}, fmt.Errorf("capture group %q not found in pattern", group)
+		}
+		fields[index] = field
+	}
+
+	return eventMatcher{kind: m.Kind, pattern: pattern, fields: fields}, nil
+}
+
+// LoadMatchers reads a JSON array of matchers from path and validates every
+// entry.
+func LoadMatchers(path string) ([]Matcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read matchers file: %v", err)
+	}
+
+	var matchers []Matcher
+	if err := json.Unmarshal(data, &matchers); err != nil {
+		return nil, fmt.Errorf("failed to parse matchers file: %v", err)
+	}
+
+	for i, m := range matchers {
+		if _, err := compileMatcher(m); err != nil {
+			return nil, fmt.Errorf("matcher %d (%s): %v", i, m.Kind, err)
+		}
+	}
+
+	return matchers, nil
+}
+
+// match returns the fields captured from message.
+func (em eventMatcher) match(message string) (kernelMatch, bool) {
+	matches := em.pattern.FindStringSubmatch(message)
+	if matches == nil {
+		return kernelMatch{}, false
+	}
+
+	result := kernelMatch{kind: em.kind}
+	for i, field := range em.fields {
+		switch field {
+		case "pid":
+			pid, err := strconv.Atoi(matches[i])
+			if err != nil {
+				return kernelMatch{}, false
+			}
+			result.pid = pid
+		case "name":
+			result.name = matches[i]
+		default:
+			if result.fields == nil {
+				result.fields = make(map[string]string)
+			}
+			result.fields[field] = matches[i]
+		}
+	}
+	return result, true
+}
+
+// classify runs the matchers against an entry in order and returns the first
+// match.
+func classify(matchers []eventMatcher, entry KmsgEntry) (kernelMatch, bool) {
+	for _, em := range matchers {
+		if result, ok := em.match(entry.Message); ok {
+			return result, true
+		}
+	}
+	return kernelMatch{}, false
+}
@@ -0,0 +1,62 @@
+package monitor
+
+import "testing"
+
+func TestSignalMatchers(t *testing.T) {
+	matchers := newSignalMatchers(true, true)
+	for _, tt := range []struct {
+		message string
+		kind    string
+		name    string
+		pid     int
+	}{
+		{"nginx[1234]: segfault at 0 ip 00007f1c2b3a4d5e sp 00007ffd1e2f3a40 error 4 in libc.so.6[7f1c2b300000+195000]", KindSegfault, "nginx", 1234},
+		{"traps: node[5678] general protection fault ip:55d1 sp:7ffc error:0 in node[55d1+1f00000]", KindTrap, "node", 5678},
+		{"INFO: task jbd2/sda1-8:321 blocked for more than 120 seconds.", KindHungTask, "jbd2/sda1-8", 321},
+	} {
+		match, ok := classify(matchers, KmsgEntry{Message: tt.message})
+		if !ok {
+			t.Errorf("%q not classified", tt.message)
+			continue
+		}
+		if match.kind != tt.kind || match.name != tt.name || match.pid != tt.pid {
+			t.Errorf("%q = %s %s[%d], want %s %s[%d]", tt.message, match.kind, match.name, match.pid, tt.kind, tt.name, tt.pid)
+		}
+	}
+
+	if _, ok := classify(matchers, KmsgEntry{Message: "Out of memory: Killed process 4242 (stress)"}); ok {
+		t.Error("OOM kill classified as another kernel event")
+	}
+}
+
+func TestSignalMatchersAreToggledSeparately(t *testing.T) {
+	segfault := KmsgEntry{Message: "nginx[1234]: segfault at 0 ip 00007f1c2b3a4d5e sp 00007ffd1e2f3a40 error 4"}
+	hung := KmsgEntry{Message: "INFO: task java:321 blocked for more than 120 seconds."}
+
+	if _, ok := classify(newSignalMatchers(false, true), segfault); ok {
+		t.Error("segfault classified without --watch-segfaults")
+	}
+	if _, ok := classify(newSignalMatchers(true, false), hung); ok {
+		t.Error("hung task classified without --watch-hung-tasks")
+	}
+	if len(newSignalMatchers(false, false)) != 0 {
+		t.Error("matchers enabled by default")
+	}
+}
+
+func TestDetectsWatchedKernelEvents(t *testing.T) {
+	recording := `3,200,6000000,-;nginx[1234]: segfault at 0 ip 00007f1c2b3a4d5e sp 00007ffd1e2f3a40 error 4 in libc.so.6[7f1c2b300000+195000]
+3,201,6000100,-;INFO: task java:321 blocked for more than 120 seconds.
+`
+	events := detect(t, Options{WatchSegfaults: true}, recording)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want the segfault only", len(events))
+	}
+	if events[0].Kind != KindSegfault || events[0].PID != "1234" || events[0].Cmdline != "[nginx]" {
+		t.Errorf("event = %s PID %s %s, want segfault PID 1234 [nginx]", events[0].Kind, events[0].PID, events[0].Cmdline)
+	}
+
+	if events := detect(t, Options{}, recording); len(events) != 0 {
+		t.Errorf("detected %d events with no kernel events watched", len(events))
+	}
+}
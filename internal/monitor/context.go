@@ -0,0 +1,154 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+const (
+	// MaxContextLines bounds Options.ContextLines.
+	MaxContextLines = 50
+	// maxContextBytes bounds the rendered context of an event, lines
+	// farthest from the kill are left out first.
+	maxContextBytes = 4000
+	// contextWait is how long an OOM event waits for the messages following
+	// its kill before it is sent with those logged so far.
+	contextWait = time.Second
+)
+
+// contextCapture is an OOM event waiting for the kernel messages logged
+// after its kill line.
+type contextCapture struct {
+	event   OOMEventData
+	pid     int
+	killSeq uint64
+	before  []string
+	kill    string
+	after   []string
+}
+
+// captureContext parks event, ended by the kill line in entry, until the
+// ContextLines messages after it are logged or contextWait expires. The
+// messages logged before the kill are taken from the recent ones.
+func (m *OOMMonitor) captureContext(event OOMEventData, pid int, entry KmsgEntry) {
+	capture := &contextCapture{
+		event:   event,
+		pid:     pid,
+		killSeq: entry.SequenceNum,
+		before:  append([]string(nil), m.recent...),
+		kill:    entry.Message,
+	}
+	logger.Debug("Holding OOM event for PID %d up to %v for the %d kernel messages after the kill", pid, contextWait, m.contextLines)
+	m.capturing = append(m.capturing, capture)
+	stop := m.stop
+	time.AfterFunc(contextWait, func() {
+		select {
+		case m.contextExpired <- capture:
+		case <-stop:
+		}
+	})
+}
+
+// recordContext keeps entry as a recent message and adds it to the events
+// waiting for the messages after their kill, sending those it completes.
+func (m *OOMMonitor) recordContext(entry KmsgEntry, eventChan chan<- OOMEventData) {
+	if m.contextLines == 0 {
+		return
+	}
+	if len(m.recent) == m.contextLines {
+		m.recent = append(m.recent[:0], m.recent[1:]...)
+	}
+	m.recent = append(m.recent, entry.Message)
+
+	for _, capture := range append([]*contextCapture(nil), m.capturing...) {
+		if capture.killSeq == entry.SequenceNum {
+			continue
+		}
+		capture.after = append(capture.after, entry.Message)
+		if len(capture.after) == m.contextLines {
+			m.releaseContext(capture, eventChan)
+		}
+	}
+}
+
+// capturedEvent returns the event held for its context whose victim is pid,
+// nil when there is none.
+func (m *OOMMonitor) capturedEvent(pid int) *OOMEventData {
+	for _, capture := range m.capturing {
+		if capture.pid == pid {
+			return &capture.event
+		}
+	}
+	return nil
+}
+
+// releaseContext attaches the context collected so far to a held event and
+// passes it on, to the oom_reaper wait when it is enabled and the kill was
+// not confirmed while the context was collected.
+func (m *OOMMonitor) releaseContext(capture *contextCapture, eventChan chan<- OOMEventData) {
+	found := false
+	for i, c := range m.capturing {
+		if c == capture {
+			m.capturing = append(m.capturing[:i], m.capturing[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	event := capture.event
+	event.Context = contextText(capture.before, capture.kill, capture.after)
+	if m.reaperWait > 0 && !event.Reaped {
+		m.holdForReaper(event, capture.pid)
+		return
+	}
+	logger.Info("Sending OOM event", logger.F("pid", capture.pid), logger.F("cmdline", event.Cmdline))
+	m.emit(eventChan, event)
+}
+
+// contextText renders the messages around a kill line, leaving out those
+// farthest from it, alternately before and after, until they fit in
+// maxContextBytes. The kill line is always kept.
+func contextText(before []string, kill string, after []string) string {
+	size := len(kill)
+	for _, line := range before {
+		size += len(line) + 1
+	}
+	for _, line := range after {
+		size += len(line) + 1
+	}
+
+	var omittedBefore, omittedAfter int
+	for size > maxContextBytes && len(before)+len(after) > 0 {
+		if len(before) >= len(after) {
+			size -= len(before[0]) + 1
+			before = before[1:]
+			omittedBefore++
+		} else {
+			size -= len(after[len(after)-1]) + 1
+			after = after[:len(after)-1]
+			omittedAfter++
+		}
+	}
+
+	var b strings.Builder
+	if omittedBefore > 0 {
+		fmt.Fprintf(&b, "... %d earlier lines omitted ...\n", omittedBefore)
+	}
+	for _, line := range before {
+		b.WriteString(line + "\n")
+	}
+	b.WriteString(kill)
+	for _, line := range after {
+		b.WriteString("\n" + line)
+	}
+	if omittedAfter > 0 {
+		fmt.Fprintf(&b, "\n... %d later lines omitted ...", omittedAfter)
+	}
+	return b.String()
+}
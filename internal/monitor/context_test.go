@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contextRecording is a kill line between numbered kernel messages, before
+// it messages 1 to before and after it the following ones up to after.
+func contextRecording(before, after int) string {
+	var b strings.Builder
+	seq := 100
+	for i := 1; i <= before+after; i++ {
+		if i == before+1 {
+			fmt.Fprintf(&b, "3,%d,5000000,-;%s\n", seq, killLine)
+			seq++
+		}
+		fmt.Fprintf(&b, "4,%d,5000000,-;message %d\n", seq, i)
+		seq++
+	}
+	if after == 0 {
+		fmt.Fprintf(&b, "3,%d,5000000,-;%s\n", seq, killLine)
+	}
+	return b.String()
+}
+
+func TestContextLinesSurroundKill(t *testing.T) {
+	events := detect(t, Options{ContextLines: 2}, contextRecording(4, 3))
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	want := "message 3\nmessage 4\n" + killLine + "\nmessage 5\nmessage 6"
+	if events[0].Context != want {
+		t.Errorf("Context = %q, want %q", events[0].Context, want)
+	}
+}
+
+func TestContextLinesAtEndOfSource(t *testing.T) {
+	events := detect(t, Options{ContextLines: 5}, contextRecording(2, 0))
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want the event held for its context", len(events))
+	}
+	if want := "message 1\nmessage 2\n" + killLine; events[0].Context != want {
+		t.Errorf("Context = %q, want the messages logged so far", events[0].Context)
+	}
+}
+
+func TestNoContextLinesByDefault(t *testing.T) {
+	events := detect(t, Options{}, contextRecording(2, 2))
+	if len(events) != 1 || events[0].Context != "" {
+		t.Errorf("detected %+v, want one event without context", events)
+	}
+}
+
+func TestContextLinesOfFixture(t *testing.T) {
+	fixture, err := os.Open("testdata/global-oom.kmsg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.Close()
+
+	events := detect(t, Options{
+		Source:       NewLineSource(fixture),
+		ProcFS:       []fs.FS{fakeProc(map[string]string{"4242": "stress\x00--vm\x001\x00"})},
+		ContextLines: 3,
+		ReaperWait:   time.Second,
+	}, "")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	lines := strings.Split(events[0].Context, "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Context of %d lines, want 3 before the kill, the kill and the reaper line:\n%s", len(lines), events[0].Context)
+	}
+	for i, prefix := range []string{"Free swap", "Total swap", "oom-kill:", "Out of memory: Killed process 4242", "oom_reaper: reaped process 4242"} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want it to start with %q", i, lines[i], prefix)
+		}
+	}
+	if !events[0].Reaped {
+		t.Error("kill not confirmed by the oom_reaper line logged while collecting the context")
+	}
+}
+
+func TestContextLinesWaitBounded(t *testing.T) {
+	reader, w := newPipeKmsgReader(t)
+	defer w.Close()
+	m, err := NewOOMMonitor(Options{
+		Source:          reader,
+		ProcFS:          []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval:   time.Second,
+		RefreshInterval: time.Hour,
+		ContextLines:    3,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+	events := make(chan OOMEventData, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Start(ctx, events)
+
+	// The 2 messages after the kill line never come
+	start := time.Now()
+	fmt.Fprintf(w, "3,100,5000000,-;%s\n", killLine)
+	fmt.Fprintf(w, "4,101,5000000,-;message 1\n")
+	select {
+	case event := <-events:
+		if waited := time.Since(start); waited < contextWait/2 {
+			t.Errorf("event sent after %v, want it held for the messages after the kill", waited)
+		}
+		if want := killLine + "\nmessage 1"; event.Context != want {
+			t.Errorf("Context = %q, want the kill and the one message after it", event.Context)
+		}
+	case <-time.After(contextWait + 2*time.Second):
+		t.Fatal("event held past the context wait")
+	}
+}
+
+func TestContextTextFitsLimit(t *testing.T) {
+	line := strings.Repeat("x", 99)
+	var before, after []string
+	for i := 0; i < MaxContextLines; i++ {
+		before = append(before, line)
+		after = append(after, line)
+	}
+	text := contextText(before, killLine, after)
+	if len(text) > maxContextBytes+100 {
+		t.Errorf("context of %d bytes, want about %d at most", len(text), maxContextBytes)
+	}
+	if !strings.Contains(text, "\n"+killLine+"\n") {
+		t.Error("kill line left out of a long context")
+	}
+	if !strings.HasPrefix(text, "... 31 earlier lines omitted ...\n") || !strings.HasSuffix(text, "\n... 31 later lines omitted ...") {
+		t.Errorf("context %q..., want the lines farthest from the kill omitted evenly", text[:40])
+	}
+
+	if got := contextText(nil, killLine, nil); got != killLine {
+		t.Errorf("contextText without messages = %q, want the kill line", got)
+	}
+}
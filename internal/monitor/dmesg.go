@@ -0,0 +1,275 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// dmesgPollInterval is how often a dmesg file is checked for new lines once
+// it has been read to the end.
+const dmesgPollInterval = time.Second
+
+// dmesgLine matches a kernel message in the human-readable dmesg format,
+// "[   12.345678] message", optionally prefixed with the <priority> printed
+// by dmesg --raw.
+var dmesgLine = regexp.MustCompile(`^(?:<(\d+)>)?\[\s*(\d+)\.(\d+)\] ?(.*)$`)
+
+// DmesgReader reads kernel messages in the dmesg output format, either by
+// following the dmesg command or by tailing a file such as a kernel log
+// mounted into a container, for hosts where neither /dev/kmsg nor the
+// journal is readable.
+type DmesgReader struct {
+	cmd         *exec.Cmd
+	scanner     *bufio.Scanner
+	name        string
+	sequence    uint64
+	entryBuffer chan KmsgEntry
+	done        chan struct{}
+	stopped     chan struct{}
+	dropped     atomic.Uint64
+	sourceErrors
+}
+
+// NewDmesgReader follows the kernel log with dmesg. readHistory also
+// delivers the messages logged before it started.
+func NewDmesgReader(readHistory bool) (*DmesgReader, error) {
+	// --follow-new skips historical messages and only follows new ones
+	follow := "--follow-new"
+	if readHistory {
+		follow = "--follow"
+	}
+	logger.Debug("Starting dmesg to follow kernel messages")
+	cmd := exec.Command("dmesg", "--raw", follow)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dmesg pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start dmesg: %v", err)
+	}
+
+	reader := newDmesgReader("dmesg")
+	reader.cmd = cmd
+	reader.follow(stdout)
+
+	logger.Debug("DmesgReader initialized successfully")
+	return reader, nil
+}
+
+// NewDmesgFileReader tails path, a file of dmesg output. Unless readHistory
+// is set the lines already in it are skipped. A file that is truncated or
+// replaced, e.g. by log rotation, is read again from the start.
+func NewDmesgFileReader(path string, readHistory bool) (*DmesgReader, error) {
+	logger.Debug("Opening %s for reading", path)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dmesg file: %v", err)
+	}
+	if !readHistory {
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			logger.Warn("Failed to seek to end of %s, will process historical messages: %v", path, err)
+		}
+	}
+
+	reader := newDmesgReader(path)
+	reader.follow(&tailReader{path: path, file: file, done: reader.done})
+
+	logger.Debug("DmesgReader initialized successfully")
+	return reader, nil
+}
+
+func newDmesgReader(name string) *DmesgReader {
+	return &DmesgReader{
+		name:        name,
+		entryBuffer: make(chan KmsgEntry, 100),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+}
+
+// follow starts reading dmesg output from r in the background.
+func (d *DmesgReader) follow(r io.Reader) {
+	d.scanner = bufio.NewScanner(r)
+	d.scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	go d.readLoop()
+}
+
+func (d *DmesgReader) Close() error {
+	close(d.done)
+	if d.cmd == nil {
+		return nil
+	}
+	if err := d.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	// dmesg exits because it was killed, that is not an error here
+	d.cmd.Wait()
+	return nil
+}
+
+func (d *DmesgReader) readLoop() {
+	defer close(d.stopped)
+
+	logger.Debug("Starting dmesg read loop for %s", d.name)
+	for d.scanner.Scan() {
+		entry, err := d.parseDmesgLine(d.scanner.Text())
+		if err != nil {
+			logger.Debug("Failed to parse dmesg line: %v", err)
+			continue
+		}
+
+		if !push(d.entryBuffer, d.done, &d.dropped, *entry) {
+			return
+		}
+	}
+
+	select {
+	case <-d.done:
+		logger.Debug("Stopping dmesg read loop")
+	default:
+		d.readError(fmt.Errorf("reading kernel messages from %s stopped unexpectedly: %v", d.name, d.scanner.Err()))
+	}
+}
+
+// Entries returns the channel parsed kernel messages are delivered on as soon
+// as they are read.
+func (d *DmesgReader) Entries() <-chan KmsgEntry {
+	return d.entryBuffer
+}
+
+// DroppedEntries returns the number of kernel messages discarded because the
+// entry buffer was full.
+func (d *DmesgReader) DroppedEntries() uint64 {
+	return d.dropped.Load()
+}
+
+// Running reports whether dmesg or the file is still being followed.
+func (d *DmesgReader) Running() bool {
+	return !isClosed(d.stopped)
+}
+
+// parseDmesgLine converts a line of dmesg output into a KmsgEntry. The
+// bracketed timestamp is the seconds since boot, converted to microseconds
+// like /dev/kmsg timestamps. dmesg prints no sequence numbers, entries are
+// numbered consecutively as they are read instead, and the priority is only
+// known from --raw output.
+func (d *DmesgReader) parseDmesgLine(line string) (*KmsgEntry, error) {
+	match := dmesgLine.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("no timestamp in %q", line)
+	}
+
+	var priority int
+	if match[1] != "" {
+		var err error
+		if priority, err = strconv.Atoi(match[1]); err != nil {
+			return nil, fmt.Errorf("invalid priority %q", match[1])
+		}
+	}
+
+	timestamp, err := dmesgTimestamp(match[2], match[3])
+	if err != nil {
+		return nil, err
+	}
+
+	d.sequence++
+	return &KmsgEntry{
+		Priority:    priority,
+		SequenceNum: d.sequence,
+		Timestamp:   timestamp,
+		Message:     match[4],
+	}, nil
+}
+
+// dmesgTimestamp returns the microseconds of a timestamp printed as
+// seconds.fraction.
+func dmesgTimestamp(seconds, fraction string) (uint64, error) {
+	secs, err := strconv.ParseUint(seconds, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %s.%s", seconds, fraction)
+	}
+	// dmesg prints microseconds, scale other precisions to them
+	for len(fraction) < 6 {
+		fraction += "0"
+	}
+	micros, err := strconv.ParseUint(fraction[:6], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %s.%s", seconds, fraction)
+	}
+	return secs*1000000 + micros, nil
+}
+
+// tailReader reads a file like tail -F: at the end of the file it waits for
+// more data instead of returning io.EOF, and reopens the file when it is
+// truncated or replaced. It returns io.EOF once done is closed.
+type tailReader struct {
+	path string
+	file *os.File
+	done <-chan struct{}
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.file.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		select {
+		case <-t.done:
+			t.file.Close()
+			return 0, io.EOF
+		case <-time.After(dmesgPollInterval):
+		}
+		if err := t.reopenIfRotated(); err != nil {
+			logger.Debug("Failed to check %s for rotation: %v", t.path, err)
+		}
+	}
+}
+
+// reopenIfRotated starts over at the beginning of the file when it was
+// truncated, and opens the file now at path when it was replaced.
+func (t *tailReader) reopenIfRotated() error {
+	current, err := os.Stat(t.path)
+	if err != nil {
+		// Between rotation steps the file may be missing for a moment
+		return err
+	}
+	opened, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !os.SameFile(current, opened) {
+		file, err := os.Open(t.path)
+		if err != nil {
+			return err
+		}
+		logger.Info("%s was replaced, reading it from the start", t.path)
+		t.file.Close()
+		t.file = file
+		return nil
+	}
+
+	offset, err := t.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if current.Size() < offset {
+		logger.Info("%s was truncated, reading it from the start", t.path)
+		_, err = t.file.Seek(0, io.SeekStart)
+	}
+	return err
+}
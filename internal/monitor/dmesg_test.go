@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDmesgLine(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		want KmsgEntry
+	}{
+		{
+			line: "[   12.345678] Out of memory: Killed process 4242 (stress)",
+			want: KmsgEntry{Timestamp: 12345678, Message: "Out of memory: Killed process 4242 (stress)"},
+		},
+		{
+			line: "<3>[86401.000060] Out of memory: Killed process 4242 (stress)",
+			want: KmsgEntry{Priority: 3, Timestamp: 86401000060, Message: "Out of memory: Killed process 4242 (stress)"},
+		},
+		{
+			// Some kernels print milliseconds
+			line: "[    5.123] oom_reaper: reaped process 4242 (stress)",
+			want: KmsgEntry{Timestamp: 5123000, Message: "oom_reaper: reaped process 4242 (stress)"},
+		},
+		{
+			line: "[    0.000000]",
+			want: KmsgEntry{},
+		},
+	} {
+		d := newDmesgReader("test")
+		entry, err := d.parseDmesgLine(tt.line)
+		if err != nil {
+			t.Errorf("parseDmesgLine(%q): %v", tt.line, err)
+			continue
+		}
+		tt.want.SequenceNum = 1
+		if entry.Priority != tt.want.Priority || entry.Timestamp != tt.want.Timestamp || entry.Message != tt.want.Message || entry.SequenceNum != 1 {
+			t.Errorf("parseDmesgLine(%q) = %+v, want %+v", tt.line, *entry, tt.want)
+		}
+	}
+}
+
+func TestParseDmesgLineRejectsOtherFormats(t *testing.T) {
+	d := newDmesgReader("test")
+	for _, line := range []string{
+		"",
+		"Out of memory: Killed process 4242 (stress)",
+		"6,100,5000000,-;Out of memory: Killed process 4242 (stress)",
+		"[Wed May  1 12:00:00 2024] Out of memory: Killed process 4242 (stress)",
+	} {
+		if entry, err := d.parseDmesgLine(line); err == nil {
+			t.Errorf("parseDmesgLine(%q) = %+v, want an error", line, *entry)
+		}
+	}
+	if d.sequence != 0 {
+		t.Errorf("rejected lines numbered up to %d", d.sequence)
+	}
+}
+
+// readEntries returns the next n entries of source.
+func readEntries(t *testing.T, source KernelLogSource, n int) []KmsgEntry {
+	t.Helper()
+	var entries []KmsgEntry
+	timeout := time.After(5 * time.Second)
+	for len(entries) < n {
+		select {
+		case entry := <-source.Entries():
+			entries = append(entries, entry)
+		case <-timeout:
+			t.Fatalf("read %d entries, want %d", len(entries), n)
+		}
+	}
+	return entries
+}
+
+func TestDmesgFileReaderReadsFixture(t *testing.T) {
+	reader, err := NewDmesgFileReader("testdata/global-oom.dmesg", true)
+	if err != nil {
+		t.Fatalf("NewDmesgFileReader: %v", err)
+	}
+	defer reader.Close()
+
+	entries := readEntries(t, reader, 9)
+	for i, entry := range entries {
+		if entry.SequenceNum != uint64(i+1) {
+			t.Errorf("entry %d numbered %d", i, entry.SequenceNum)
+		}
+	}
+	if kill := entries[7]; kill.Timestamp != 86401000060 || !strings.HasPrefix(kill.Message, "Out of memory: Killed process 4242 ") {
+		t.Errorf("kill entry = %+v", kill)
+	}
+	if !reader.Running() {
+		t.Error("reader stopped at the end of the file instead of following it")
+	}
+}
+
+func TestDmesgFileReaderFollowsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kern.log")
+	if err := os.WriteFile(path, []byte("[    1.000000] old message\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewDmesgFileReader(path, false)
+	if err != nil {
+		t.Fatalf("NewDmesgFileReader: %v", err)
+	}
+	defer reader.Close()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("[    2.000000] new message\n")
+	file.Close()
+	if entry := readEntries(t, reader, 1)[0]; entry.Message != "new message" {
+		t.Errorf("read %q, want only the message appended after opening", entry.Message)
+	}
+
+	// Rotation replaces the file, which is then read from the start
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("[    3.000000] rotated message\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if entry := readEntries(t, reader, 1)[0]; entry.Message != "rotated message" {
+		t.Errorf("read %q after rotation, want the new file's message", entry.Message)
+	}
+}
+
+func TestDmesgFileKillIsDetected(t *testing.T) {
+	reader, err := NewDmesgFileReader("testdata/global-oom.dmesg", true)
+	if err != nil {
+		t.Fatalf("NewDmesgFileReader: %v", err)
+	}
+	m, err := NewOOMMonitor(Options{
+		Source:          reader,
+		ProcFS:          []fs.FS{fakeProc(map[string]string{"4242": "stress\x00--vm\x001\x00"})},
+		CheckInterval:   10 * time.Millisecond,
+		RefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan OOMEventData, 10)
+	go m.Start(ctx, events)
+
+	select {
+	case event := <-events:
+		if event.Kind != KindOOM || event.PID != "4242" || event.Cmdline != "stress --vm 1" || event.UID != "1000" {
+			t.Errorf("detected %+v, want the kill of PID 4242", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("kill in the dmesg file not detected")
+	}
+}
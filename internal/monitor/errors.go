@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// ErrorCategory classifies the non-fatal errors of the monitor.
+type ErrorCategory string
+
+// Categories of MonitorError.
+const (
+	// ErrorSourceRead marks failures reading the kernel log, such as a
+	// failed read of /dev/kmsg or journalctl exiting.
+	ErrorSourceRead ErrorCategory = "source-read"
+	// ErrorParse marks kernel messages that could not be understood, such
+	// as an OOM kill whose PID cannot be extracted.
+	ErrorParse ErrorCategory = "parse"
+	// ErrorEnrichment marks failures gathering the process details added to
+	// events, such as a failed process cache refresh.
+	ErrorEnrichment ErrorCategory = "enrichment"
+)
+
+// MonitorError is a non-fatal error of the monitor, which keeps running
+// after it. They are sent on Options.Errors when it is set.
+type MonitorError struct {
+	Category ErrorCategory
+	Err      error
+}
+
+func (e *MonitorError) Error() string {
+	return fmt.Sprintf("%s error: %v", e.Category, e.Err)
+}
+
+func (e *MonitorError) Unwrap() error {
+	return e.Err
+}
+
+// errorReporter hands MonitorErrors to the channel of Options.Errors without
+// blocking. A nil reporter, or one whose channel is full, logs them instead.
+type errorReporter struct {
+	errs chan<- *MonitorError
+}
+
+// report reports err in category.
+func (r *errorReporter) report(category ErrorCategory, err error) {
+	merr := &MonitorError{Category: category, Err: err}
+	if r != nil && r.errs != nil {
+		select {
+		case r.errs <- merr:
+			return
+		default:
+			// Never block on a slow consumer, the kernel keeps writing
+		}
+	}
+	logger.Error("Monitor %v", merr)
+}
+
+// errorSource is implemented by the sources embedding sourceErrors.
+type errorSource interface {
+	reportErrorsTo(r *errorReporter)
+}
+
+// sourceErrors is embedded by the kernel log sources to report their read
+// errors to the monitor using them. Errors raised before the monitor hooks
+// in are logged.
+type sourceErrors struct {
+	reporter atomic.Pointer[errorReporter]
+}
+
+// reportErrorsTo sends the read errors of the source to r from now on.
+func (s *sourceErrors) reportErrorsTo(r *errorReporter) {
+	s.reporter.Store(r)
+}
+
+// readError reports a failure reading the kernel log.
+func (s *sourceErrors) readError(err error) {
+	s.reporter.Load().report(ErrorSourceRead, err)
+}
@@ -0,0 +1,119 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// waitForError returns the first error received on errs in category.
+func waitForError(t *testing.T, errs <-chan *MonitorError, category ErrorCategory) *MonitorError {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case err := <-errs:
+			if err.Category == category {
+				return err
+			}
+		case <-timeout:
+			t.Fatalf("no %s error received", category)
+		}
+	}
+}
+
+// failingScanFS fails every listing of its root after the first, which
+// builds the process cache.
+type failingScanFS struct {
+	fs.FS
+	scans atomic.Int32
+}
+
+func (f *failingScanFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "." && f.scans.Add(1) > 1 {
+		return nil, errors.New("proc unmounted")
+	}
+	return fs.ReadDir(f.FS, name)
+}
+
+func TestMonitorErrorWrapsCause(t *testing.T) {
+	cause := errors.New("device gone")
+	var err error = &MonitorError{Category: ErrorSourceRead, Err: cause}
+	if got := err.Error(); got != "source-read error: device gone" {
+		t.Errorf("Error() = %q", got)
+	}
+	var merr *MonitorError
+	if !errors.Is(err, cause) || !errors.As(err, &merr) || merr.Category != ErrorSourceRead {
+		t.Errorf("%v does not unwrap to its cause and category", err)
+	}
+}
+
+func TestSourceReadErrorsAreReported(t *testing.T) {
+	errs := make(chan *MonitorError, 10)
+	failing := io.MultiReader(strings.NewReader("6,100,5000000,-;systemd[1]: Started Session 2 of user root.\n"), iotest.ErrReader(errors.New("disk read failed")))
+	detect(t, Options{Source: NewLineSource(failing), Errors: errs}, "")
+
+	err := waitForError(t, errs, ErrorSourceRead)
+	if !strings.Contains(err.Error(), "disk read failed") {
+		t.Errorf("error %v, want the read failure", err)
+	}
+}
+
+func TestParseErrorsAreReported(t *testing.T) {
+	errs := make(chan *MonitorError, 10)
+	events := detect(t, Options{Errors: errs}, "3,100,5000000,-;Out of memory: Kill some task to free memory\n3,101,5000100,-;"+killLine+"\n")
+	if len(events) != 1 || events[0].PID != "4242" {
+		t.Errorf("events %+v, want the monitor to go on with the next kill", events)
+	}
+
+	err := waitForError(t, errs, ErrorParse)
+	if !strings.Contains(err.Error(), "no PID found") {
+		t.Errorf("error %v, want the PID extraction failure", err)
+	}
+}
+
+func TestEnrichmentErrorsAreReported(t *testing.T) {
+	errs := make(chan *MonitorError, 10)
+	reader, _ := newPipeKmsgReader(t)
+	m, err := NewOOMMonitor(Options{
+		Source:          reader,
+		ProcFS:          []fs.FS{&failingScanFS{FS: fakeProc(map[string]string{"1": "init\x00"})}},
+		CheckInterval:   time.Second,
+		RefreshInterval: 10 * time.Millisecond,
+		Errors:          errs,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Start(ctx, make(chan OOMEventData, 1))
+
+	if err := waitForError(t, errs, ErrorEnrichment); !strings.Contains(err.Error(), "proc unmounted") {
+		t.Errorf("error %v, want the failed refresh", err)
+	}
+}
+
+func TestErrorReporterNeverBlocks(t *testing.T) {
+	full := make(chan *MonitorError)
+	reported := make(chan struct{})
+	go func() {
+		(&errorReporter{errs: full}).report(ErrorParse, errors.New("unread"))
+		// and without a channel or a reporter at all
+		(&errorReporter{}).report(ErrorParse, errors.New("logged"))
+		(*errorReporter)(nil).report(ErrorParse, errors.New("logged"))
+		close(reported)
+	}()
+	select {
+	case <-reported:
+	case <-time.After(time.Second):
+		t.Fatal("report blocked on a channel nobody reads")
+	}
+}
@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// historyRecording returns kills of PID 1111 right after boot and of PID
+// 2222 a second before now, as a kernel log read from its oldest message.
+func historyRecording(t *testing.T) string {
+	t.Helper()
+	bootTime, err := getBootTime()
+	if err != nil {
+		t.Skipf("boot time unknown: %v", err)
+	}
+	uptime := time.Since(bootTime)
+	if uptime < 2*historyTestWindow {
+		t.Skipf("uptime %v too short to place a kill outside the window", uptime)
+	}
+
+	kill := func(seq int, timestamp time.Duration, pid int) string {
+		return fmt.Sprintf("6,%d,%d,-;Out of memory: Killed process %d (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n",
+			seq, timestamp.Microseconds(), pid)
+	}
+	return kill(1, time.Second, 1111) + kill(2, uptime-time.Second, 2222)
+}
+
+// historyTestWindow is the --history-window of the tests.
+const historyTestWindow = time.Minute
+
+func TestScanHistoryReportsKillsWithinWindow(t *testing.T) {
+	events := detect(t, Options{HistoryWindow: historyTestWindow}, historyRecording(t))
+	if len(events) != 1 || events[0].PID != "2222" {
+		t.Fatalf("detected %+v, want only the kill a second ago", events)
+	}
+}
+
+func TestStartupFilterSkipsHistoryWithoutScan(t *testing.T) {
+	events := detect(t, Options{FilterSource: true, StartupGrace: time.Second}, historyRecording(t))
+	if len(events) != 0 {
+		t.Fatalf("detected %d events logged before startup without --scan-history", len(events))
+	}
+}
+
+func TestStartupCutoff(t *testing.T) {
+	if got := startupCutoff(time.Hour, 2*time.Hour); got != 0 {
+		t.Errorf("cutoff with a window longer than the uptime = %d, want 0", got)
+	}
+	if got := startupCutoff(3*time.Hour, time.Hour); got != uint64((2 * time.Hour).Microseconds()) {
+		t.Errorf("cutoff = %d, want two hours after boot", got)
+	}
+	if got := startupCutoff(time.Hour, time.Hour); got != 0 {
+		t.Errorf("cutoff with a grace of the whole uptime = %d, want 0", got)
+	}
+}
+
+// bootKills returns kills of PID 1111 a second after boot and of PID 2222
+// at uptime, as a kernel log read from its oldest message.
+func bootKills(uptime time.Duration) string {
+	kill := func(seq int, timestamp time.Duration, pid int) string {
+		return fmt.Sprintf("6,%d,%d,-;Out of memory: Killed process %d (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n",
+			seq, timestamp.Microseconds(), pid)
+	}
+	return kill(1, time.Second, 1111) + kill(2, uptime, 2222)
+}
+
+func TestKnownBootTimePlacesEvents(t *testing.T) {
+	boot := time.Now().Add(-time.Hour).Truncate(time.Second)
+	opts := Options{
+		FilterSource: true,
+		StartupGrace: time.Minute,
+		bootTime:     func() (time.Time, error) { return boot, nil },
+	}
+	events := detect(t, opts, bootKills(time.Hour-time.Second))
+	if len(events) != 1 || events[0].PID != "2222" {
+		t.Fatalf("detected %+v, want only the kill within the startup grace", events)
+	}
+	if want := boot.Add(time.Hour - time.Second).UnixMilli(); events[0].Time != want {
+		t.Errorf("event time %d, want %d, the boot time plus the kernel timestamp", events[0].Time, want)
+	}
+}
+
+func TestUnknownBootTimeStampsReadTime(t *testing.T) {
+	opts := Options{
+		FilterSource: true,
+		StartupGrace: time.Minute,
+		bootTime:     func() (time.Time, error) { return time.Time{}, fmt.Errorf("btime not found in /proc/stat") },
+	}
+	before := time.Now()
+	events := detect(t, opts, bootKills(time.Hour))
+	after := time.Now()
+
+	// Without a boot time no message can be told to be from before startup
+	if len(events) != 2 {
+		t.Fatalf("detected %d events, want both kills", len(events))
+	}
+	for _, event := range events {
+		if event.Time < before.UnixMilli() || event.Time > after.UnixMilli() {
+			t.Errorf("event of PID %s at %d, want the time it was read, between %d and %d", event.PID, event.Time, before.UnixMilli(), after.UnixMilli())
+		}
+	}
+}
+
+func TestStartupGraceBoundary(t *testing.T) {
+	const grace = 5 * time.Second
+	boot := time.Now().Add(-time.Hour)
+	startup := time.Since(boot)
+
+	for _, tt := range []struct {
+		name     string
+		grace    time.Duration
+		loggedAt time.Duration
+		kept     bool
+	}{
+		{"long before startup", grace, startup - time.Minute, false},
+		{"just before the grace", grace, startup - grace - time.Second, false},
+		{"within the grace", grace, startup - grace + time.Second, true},
+		{"around startup", grace, startup - 10*time.Millisecond, true},
+		{"after startup", grace, startup + time.Second, true},
+		{"no grace", 0, startup - time.Second, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{
+				FilterSource: true,
+				StartupGrace: tt.grace,
+				bootTime:     func() (time.Time, error) { return boot, nil },
+			}
+			recording := fmt.Sprintf("6,1,%d,-;Out of memory: Killed process 4242 (stress)\n", tt.loggedAt.Microseconds())
+			if kept := len(detect(t, opts, recording)) == 1; kept != tt.kept {
+				t.Errorf("kill logged %v after boot kept %v, want %v", tt.loggedAt, kept, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// JournalReader reads kernel messages from the systemd journal by following
+// journalctl, for hosts where /dev/kmsg is not readable.
+type JournalReader struct {
+	cmd         *exec.Cmd
+	scanner     *bufio.Scanner
+	sequence    uint64
+	entryBuffer chan KmsgEntry
+	done        chan struct{}
+	stopped     chan struct{}
+	dropped     atomic.Uint64
+	sourceErrors
+}
+
+// journalRecord holds the fields of a journalctl -o json record used to
+// build a KmsgEntry. Values are strings in journal JSON output, MESSAGE is an
+// array of bytes when it is not valid UTF-8.
+type journalRecord struct {
+	Message                  json.RawMessage `json:"MESSAGE"`
+	Priority                 string          `json:"PRIORITY"`
+	SourceMonotonicTimestamp string          `json:"_SOURCE_MONOTONIC_TIMESTAMP"`
+	MonotonicTimestamp       string          `json:"__MONOTONIC_TIMESTAMP"`
+}
+
+// NewJournalReader follows kernel messages in the journal. readHistory also
+// delivers the messages of the current boot logged before it started.
+func NewJournalReader(readHistory bool) (*JournalReader, error) {
+	// --lines=0 skips historical messages and only follows new ones
+	lines := "--lines=0"
+	if readHistory {
+		lines = "--lines=all"
+	}
+	logger.Debug("Starting journalctl to follow kernel messages")
+	cmd := exec.Command("journalctl", "--dmesg", "--follow", lines, "--output=json")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journalctl pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start journalctl: %v", err)
+	}
+
+	reader := &JournalReader{
+		cmd:         cmd,
+		scanner:     bufio.NewScanner(stdout),
+		entryBuffer: make(chan KmsgEntry, 100),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	reader.scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	go reader.readLoop()
+
+	logger.Debug("JournalReader initialized successfully")
+	return reader, nil
+}
+
+func (j *JournalReader) Close() error {
+	close(j.done)
+	if err := j.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	// journalctl exits because it was killed, that is not an error here
+	j.cmd.Wait()
+	return nil
+}
+
+func (j *JournalReader) readLoop() {
+	defer close(j.stopped)
+
+	logger.Debug("Starting journal read loop")
+	for j.scanner.Scan() {
+		entry, err := j.parseJournalLine(j.scanner.Bytes())
+		if err != nil {
+			logger.Debug("Failed to parse journal record: %v", err)
+			continue
+		}
+
+		if !push(j.entryBuffer, j.done, &j.dropped, *entry) {
+			return
+		}
+	}
+
+	select {
+	case <-j.done:
+		logger.Debug("Stopping journal read loop")
+	default:
+		j.readError(fmt.Errorf("journalctl stopped unexpectedly: %v", j.scanner.Err()))
+	}
+}
+
+// Entries returns the channel parsed kernel messages are delivered on as soon
+// as they are read.
+func (j *JournalReader) Entries() <-chan KmsgEntry {
+	return j.entryBuffer
+}
+
+// DroppedEntries returns the number of kernel messages discarded because the
+// entry buffer was full.
+func (j *JournalReader) DroppedEntries() uint64 {
+	return j.dropped.Load()
+}
+
+// Running reports whether journalctl is still being followed.
+func (j *JournalReader) Running() bool {
+	return !isClosed(j.stopped)
+}
+
+// parseJournalLine converts a journal JSON record into a KmsgEntry. The
+// journal's own sequence numbers count every journal entry, not only kernel
+// messages, so entries are numbered consecutively as they are read instead.
+func (j *JournalReader) parseJournalLine(line []byte) (*KmsgEntry, error) {
+	var record journalRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return nil, err
+	}
+
+	message, err := journalMessage(record.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	priority, err := strconv.Atoi(record.Priority)
+	if err != nil {
+		return nil, fmt.Errorf("invalid priority %q", record.Priority)
+	}
+
+	// The source timestamp is the kernel's own, in microseconds since boot
+	// like /dev/kmsg timestamps
+	timestampStr := record.SourceMonotonicTimestamp
+	if timestampStr == "" {
+		timestampStr = record.MonotonicTimestamp
+	}
+	timestamp, err := strconv.ParseUint(timestampStr, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q", timestampStr)
+	}
+
+	j.sequence++
+	return &KmsgEntry{
+		Priority:    priority,
+		SequenceNum: j.sequence,
+		Timestamp:   timestamp,
+		Message:     message,
+	}, nil
+}
+
+// journalMessage decodes a MESSAGE field given either as a string or as an
+// array of bytes.
+func journalMessage(raw json.RawMessage) (string, error) {
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		return message, nil
+	}
+
+	var data []byte
+	var values []int
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return "", fmt.Errorf("invalid MESSAGE field")
+	}
+	for _, v := range values {
+		data = append(data, byte(v))
+	}
+	return string(data), nil
+}
@@ -0,0 +1,57 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJournalLine(t *testing.T) {
+	var j JournalReader
+	for _, tt := range []struct {
+		name, record string
+		want         KmsgEntry
+	}{
+		{
+			"kill line",
+			`{"__CURSOR":"s=1;i=2","__REALTIME_TIMESTAMP":"1714564800000000","__MONOTONIC_TIMESTAMP":"5000123","_BOOT_ID":"b1","_TRANSPORT":"kernel","PRIORITY":"3","SYSLOG_FACILITY":"0","SYSLOG_IDENTIFIER":"kernel","_SOURCE_MONOTONIC_TIMESTAMP":"5000100","MESSAGE":"Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0"}`,
+			KmsgEntry{Priority: 3, SequenceNum: 1, Timestamp: 5000100, Message: "Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0"},
+		},
+		{
+			"record without a source timestamp",
+			`{"__MONOTONIC_TIMESTAMP":"6000000","PRIORITY":"6","MESSAGE":"systemd[1]: Started Session 2 of user root."}`,
+			KmsgEntry{Priority: 6, SequenceNum: 2, Timestamp: 6000000, Message: "systemd[1]: Started Session 2 of user root."},
+		},
+		{
+			"message as an array of bytes",
+			`{"__MONOTONIC_TIMESTAMP":"7000000","PRIORITY":"4","MESSAGE":[115,116,114,101,115,115,32,255]}`,
+			KmsgEntry{Priority: 4, SequenceNum: 3, Timestamp: 7000000, Message: "stress \xff"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := j.parseJournalLine([]byte(tt.record))
+			if err != nil {
+				t.Fatalf("parseJournalLine: %v", err)
+			}
+			if !reflect.DeepEqual(*entry, tt.want) {
+				t.Errorf("entry = %+v, want %+v", *entry, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJournalLineRejectsInvalidRecords(t *testing.T) {
+	var j JournalReader
+	for _, record := range []string{
+		`not json`,
+		`{"__MONOTONIC_TIMESTAMP":"5000000","MESSAGE":"no priority"}`,
+		`{"PRIORITY":"3","MESSAGE":"no timestamp"}`,
+		`{"__MONOTONIC_TIMESTAMP":"5000000","PRIORITY":"3","MESSAGE":{"not":"a message"}}`,
+	} {
+		if entry, err := j.parseJournalLine([]byte(record)); err == nil {
+			t.Errorf("parseJournalLine(%s) = %+v, want an error", record, *entry)
+		}
+	}
+	if j.sequence != 0 {
+		t.Errorf("invalid records numbered, sequence %d", j.sequence)
+	}
+}
@@ -1,25 +1,60 @@
 package monitor
 
 import (
-	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/oom-notifier/go/internal/logger"
 )
 
+// kmsgRecordSize fits the largest record /dev/kmsg returns from one read.
+const kmsgRecordSize = 8192
+
+const (
+	// kmsgReopenDelay is the delay before reopening /dev/kmsg after a read
+	// error, doubled after each failed attempt up to kmsgMaxReopenDelay.
+	kmsgReopenDelay    = time.Second
+	kmsgMaxReopenDelay = 30 * time.Second
+)
+
+const (
+	// refreshSlowFraction makes a process cache refresh slow when it takes
+	// longer than this fraction of the refresh interval. The delay before
+	// the next refresh is then doubled, up to refreshMaxBackoff times the
+	// interval, and halved back once refreshes are fast again.
+	refreshSlowFraction = 4
+	refreshMaxBackoff   = 8
+)
+
+// orderedReportWait bounds how long ReadOrderedEntries waits for the rest of
+// an OOM report the kernel is still writing.
+const orderedReportWait = 500 * time.Millisecond
+
 type KmsgReader struct {
-	file          *os.File
-	scanner       *bufio.Scanner
-	oomPattern    *regexp.Regexp
-	pidPattern    *regexp.Regexp
-	lastTimestamp uint64
-	entryBuffer   chan KmsgEntry
-	done          chan struct{}
+	// open opens the kernel log, /dev/kmsg outside of tests.
+	open        func() (io.ReadSeekCloser, error)
+	fileMu      sync.Mutex
+	file        io.ReadSeekCloser
+	entryBuffer chan KmsgEntry
+	done        chan struct{}
+	stopped     chan struct{}
+	dropped     atomic.Uint64
+	readHistory bool
+	sourceErrors
 }
 
 type KmsgEntry struct {
@@ -27,28 +62,53 @@ type KmsgEntry struct {
 	SequenceNum uint64
 	Timestamp   uint64
 	Message     string
+	// Dict holds the KEY=value dictionary lines following the message,
+	// e.g. SUBSYSTEM and DEVICE for driver messages.
+	Dict map[string]string
+
+	// flag is the record's continuation flag: 'c' opens a message split
+	// over several records, '+' continues it, '-' is a whole message.
+	flag byte
+}
+
+// NewKmsgReader opens /dev/kmsg. Unless readHistory is set, messages already
+// in the ring buffer are skipped and only new ones are read.
+func NewKmsgReader(readHistory bool) (*KmsgReader, error) {
+	return newKmsgReader(openKmsg, readHistory)
 }
 
-func NewKmsgReader() (*KmsgReader, error) {
+func openKmsg() (io.ReadSeekCloser, error) {
 	logger.Debug("Opening /dev/kmsg for reading")
 	file, err := os.Open("/dev/kmsg")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open /dev/kmsg: %v", err)
 	}
+	return file, nil
+}
+
+func newKmsgReader(open func() (io.ReadSeekCloser, error), readHistory bool) (*KmsgReader, error) {
+	file, err := open()
+	if err != nil {
+		return nil, err
+	}
 
-	// Seek to end to skip historical messages and only read new ones
-	logger.Debug("Seeking to end of /dev/kmsg to skip historical messages")
-	if _, err := file.Seek(0, 2); err != nil {
-		logger.Warn("Failed to seek to end of kmsg, will process historical messages: %v", err)
+	if readHistory {
+		logger.Debug("Reading /dev/kmsg from the oldest buffered message")
+	} else {
+		// Seek to end to skip historical messages and only read new ones
+		logger.Debug("Seeking to end of /dev/kmsg to skip historical messages")
+		if _, err := file.Seek(0, io.SeekEnd); err != nil {
+			logger.Warn("Failed to seek to end of kmsg, will process historical messages: %v", err)
+		}
 	}
 
 	reader := &KmsgReader{
+		open:        open,
 		file:        file,
-		scanner:     bufio.NewScanner(file),
-		oomPattern:  regexp.MustCompile(`(?i)out of memory:`),
-		pidPattern:  regexp.MustCompile(`\bkilled process (\d+)\b`),
+		readHistory: readHistory,
 		entryBuffer: make(chan KmsgEntry, 100),
 		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
 	}
 
 	// Start background goroutine to read kmsg
@@ -58,37 +118,131 @@ func NewKmsgReader() (*KmsgReader, error) {
 	return reader, nil
 }
 
+// Close stops the read loop and waits for it to exit. Closing the file
+// unblocks the pending read.
 func (k *KmsgReader) Close() error {
 	close(k.done)
-	return k.file.Close()
+	k.fileMu.Lock()
+	err := k.file.Close()
+	k.fileMu.Unlock()
+	<-k.stopped
+	return err
 }
 
+// readLoop blocks on reads from /dev/kmsg, each of which returns exactly one
+// record, and queues parsed entries as soon as they arrive. After a read
+// error /dev/kmsg is reopened, skipping the records read before.
 func (k *KmsgReader) readLoop() {
+	defer close(k.stopped)
+
 	logger.Debug("Starting kmsg read loop")
+	buf := make([]byte, kmsgRecordSize)
+	var assembler kmsgAssembler
+	var lastSequence uint64
+	seen, resuming := false, false
+	for {
+		k.fileMu.Lock()
+		file := k.file
+		k.fileMu.Unlock()
+
+		n, err := file.Read(buf)
+		if err != nil {
+			select {
+			case <-k.done:
+				logger.Debug("Stopping kmsg read loop")
+				return
+			default:
+			}
+
+			if errors.Is(err, syscall.EPIPE) {
+				// The ring buffer overwrote records before we read them,
+				// the next read resumes at the oldest available record
+				logger.Warn("Kernel messages were overwritten before they could be read, OOM events may have been missed")
+				continue
+			}
+			k.readError(fmt.Errorf("failed to read /dev/kmsg, reopening it: %v", err))
+			if !k.reopen(seen || k.readHistory) {
+				return
+			}
+			resuming = seen
+			continue
+		}
+
+		// Each read returns one record, the message line followed by its
+		// dictionary lines
+		entry, err := parseKmsgRecord(string(buf[:n]))
+		if err != nil {
+			logger.Debug("Failed to parse kmsg record: %v", err)
+			continue
+		}
+		if resuming && entry.SequenceNum <= lastSequence {
+			continue
+		}
+		seen, resuming = true, false
+		lastSequence = entry.SequenceNum
+
+		for _, entry := range assembler.add(*entry) {
+			if !push(k.entryBuffer, k.done, &k.dropped, entry) {
+				return
+			}
+		}
+	}
+}
+
+// reopen opens the kernel log again, retrying with backoff until it
+// succeeds, and replaces the failed file with it. The new file starts at the
+// oldest buffered record when fromStart is set, the read loop then skips
+// the records it already read, and at the end otherwise. It returns false
+// when the reader is closed meanwhile.
+func (k *KmsgReader) reopen(fromStart bool) bool {
+	delay := kmsgReopenDelay
 	for {
 		select {
+		case <-time.After(delay):
 		case <-k.done:
-			logger.Debug("Stopping kmsg read loop")
-			return
-		default:
-			if k.scanner.Scan() {
-				line := k.scanner.Text()
-				entry, err := k.parseKmsgLine(line)
-				if err != nil {
-					logger.Debug("Failed to parse kmsg line: %v", err)
-					continue
-				}
+			return false
+		}
 
-				select {
-				case k.entryBuffer <- *entry:
-				case <-k.done:
-					return
-				}
+		file, err := k.open()
+		if err != nil {
+			delay *= 2
+			if delay > kmsgMaxReopenDelay {
+				delay = kmsgMaxReopenDelay
+			}
+			k.readError(fmt.Errorf("failed to reopen /dev/kmsg, retrying in %v: %v", delay, err))
+			continue
+		}
+		if !fromStart {
+			if _, err := file.Seek(0, io.SeekEnd); err != nil {
+				logger.Warn("Failed to seek to end of kmsg, will process historical messages: %v", err)
 			}
 		}
+
+		k.fileMu.Lock()
+		defer k.fileMu.Unlock()
+		if isClosed(k.done) {
+			// Close closed the failed file, the new one is not needed
+			file.Close()
+			return false
+		}
+		k.file.Close()
+		k.file = file
+		logger.Info("Reopened /dev/kmsg")
+		return true
 	}
 }
 
+// Entries returns the channel parsed kernel messages are delivered on as soon
+// as they are read.
+func (k *KmsgReader) Entries() <-chan KmsgEntry {
+	return k.entryBuffer
+}
+
+// Running reports whether /dev/kmsg is still being read.
+func (k *KmsgReader) Running() bool {
+	return !isClosed(k.stopped)
+}
+
 func (k *KmsgReader) ReadEntries() ([]KmsgEntry, error) {
 	var entries []KmsgEntry
 
@@ -107,8 +261,107 @@ func (k *KmsgReader) ReadEntries() ([]KmsgEntry, error) {
 	}
 }
 
-func (k *KmsgReader) parseKmsgLine(line string) (*KmsgEntry, error) {
-	// kmsg format: priority,sequence,timestamp[,flag];message
+// ReadOrderedEntries is ReadEntries with the entries sorted by sequence
+// number and OOM reports never split between calls: when the buffered
+// entries end inside a report, opened by an "invoked oom-killer" line and
+// not yet ended by its kill line, it waits up to orderedReportWait for the
+// rest. A report still incomplete by then is returned as far as it got.
+func (k *KmsgReader) ReadOrderedEntries() ([]KmsgEntry, error) {
+	entries, err := k.ReadEntries()
+	if err != nil {
+		return nil, err
+	}
+	sortEntries(entries)
+
+	deadline := time.NewTimer(orderedReportWait)
+	defer deadline.Stop()
+	for inReport(entries) {
+		select {
+		case entry := <-k.entryBuffer:
+			more, _ := k.ReadEntries()
+			entries = append(append(entries, entry), more...)
+			sortEntries(entries)
+		case <-deadline.C:
+			logger.Debug("OOM report still incomplete after %v, returning it as is", orderedReportWait)
+			return entries, nil
+		case <-k.done:
+			return entries, nil
+		}
+	}
+	return entries, nil
+}
+
+// sortEntries sorts entries by sequence number.
+func sortEntries(entries []KmsgEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].SequenceNum < entries[j].SequenceNum
+	})
+}
+
+// inReport reports whether entries, sorted by sequence number, end inside an
+// OOM report whose kill line is yet to come.
+func inReport(entries []KmsgEntry) bool {
+	open := false
+	for _, entry := range entries {
+		if reportStartPattern.MatchString(entry.Message) {
+			open = true
+		} else if IsOOMMessage(entry) {
+			open = false
+		}
+	}
+	return open
+}
+
+// DroppedEntries returns the number of kernel messages discarded because the
+// entry buffer was full.
+func (k *KmsgReader) DroppedEntries() uint64 {
+	return k.dropped.Load()
+}
+
+// parseKmsgRecord parses one /dev/kmsg record: the message line, optionally
+// followed by continuation lines starting with a space. Continuation lines
+// of the KEY=value form are dictionary entries, any other is message text
+// and appended to the message.
+func parseKmsgRecord(record string) (*KmsgEntry, error) {
+	lines := strings.Split(strings.TrimRight(record, "\n"), "\n")
+	entry, err := parseKmsgLine(lines[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines[1:] {
+		if !strings.HasPrefix(line, " ") {
+			return nil, fmt.Errorf("invalid kmsg continuation line %q", line)
+		}
+		line = line[1:]
+		if key, value, ok := strings.Cut(line, "="); ok && isDictKey(key) {
+			if entry.Dict == nil {
+				entry.Dict = make(map[string]string)
+			}
+			entry.Dict[key] = value
+			continue
+		}
+		entry.Message += " " + strings.TrimSpace(line)
+	}
+	return entry, nil
+}
+
+// isDictKey reports whether key looks like a kmsg dictionary key, e.g.
+// SUBSYSTEM or DEVICE.
+func isDictKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func parseKmsgLine(line string) (*KmsgEntry, error) {
+	// kmsg format: priority,sequence,timestamp,flag[,caller=...];message
 	parts := strings.SplitN(line, ";", 2)
 	if len(parts) != 2 {
 		return nil, fmt.Errorf("invalid kmsg format")
@@ -119,6 +372,11 @@ func (k *KmsgReader) parseKmsgLine(line string) (*KmsgEntry, error) {
 		return nil, fmt.Errorf("invalid kmsg metadata")
 	}
 
+	flag := byte('-')
+	if len(metadata) > 3 && len(metadata[3]) == 1 {
+		flag = metadata[3][0]
+	}
+
 	priority, err := strconv.Atoi(metadata[0])
 	if err != nil {
 		return nil, err
@@ -129,9 +387,7 @@ func (k *KmsgReader) parseKmsgLine(line string) (*KmsgEntry, error) {
 		return nil, err
 	}
 
-	// Timestamp might have flags after it
-	timestampStr := strings.Split(metadata[2], ",")[0]
-	timestamp, err := strconv.ParseUint(timestampStr, 10, 64)
+	timestamp, err := strconv.ParseUint(metadata[2], 10, 64)
 	if err != nil {
 		return nil, err
 	}
@@ -141,19 +397,101 @@ func (k *KmsgReader) parseKmsgLine(line string) (*KmsgEntry, error) {
 		SequenceNum: sequence,
 		Timestamp:   timestamp,
 		Message:     parts[1],
+		flag:        flag,
 	}, nil
 }
 
-func (k *KmsgReader) IsOOMMessage(entry KmsgEntry) bool {
-	isOOM := k.oomPattern.MatchString(entry.Message)
+// kmsgAssembler joins messages that kernels before 4.9 split over several
+// records, a 'c' record followed by '+' records, e.g. lines printed with
+// pr_cont. The joined entry carries the sequence number of its last record.
+// A split message is only complete once the next message arrives.
+type kmsgAssembler struct {
+	pending *KmsgEntry
+}
+
+// add takes the next record and returns the entries it completes.
+func (a *kmsgAssembler) add(entry KmsgEntry) []KmsgEntry {
+	switch entry.flag {
+	case '+':
+		if a.pending == nil {
+			// The start of the message was missed
+			return []KmsgEntry{entry}
+		}
+		a.pending.Message += entry.Message
+		a.pending.SequenceNum = entry.SequenceNum
+		for key, value := range entry.Dict {
+			if a.pending.Dict == nil {
+				a.pending.Dict = make(map[string]string)
+			}
+			a.pending.Dict[key] = value
+		}
+		return nil
+
+	case 'c':
+		completed := a.flush()
+		a.pending = &entry
+		return completed
+
+	default:
+		return append(a.flush(), entry)
+	}
+}
+
+// flush returns the message being assembled, if any.
+func (a *kmsgAssembler) flush() []KmsgEntry {
+	if a.pending == nil {
+		return nil
+	}
+	entry := *a.pending
+	a.pending = nil
+	return []KmsgEntry{entry}
+}
+
+// DefaultOOMPattern matches the kernel messages reporting an OOM kill.
+const DefaultOOMPattern = `(?i)out of memory:`
+
+// DefaultPIDPattern captures the PID of the victim in an OOM kill message.
+const DefaultPIDPattern = `(?i)\bkill(?:ed)? process (\d+)\b`
+
+var (
+	oomPattern    = regexp.MustCompile(DefaultOOMPattern)
+	pidPattern    = regexp.MustCompile(DefaultPIDPattern)
+	memoryPattern = regexp.MustCompile(`\b(total-vm|anon-rss|file-rss|shmem-rss|oom_score_adj):(-?\d+)`)
+	uidPattern    = regexp.MustCompile(`\bUID:(\d+)`)
+	scorePattern  = regexp.MustCompile(`\b(?:oom_)?score[: ](\d+)\b`)
+	namePattern   = regexp.MustCompile(`(?i)\bkill(?:ed)? process \d+ \((.*?)\)(?:[\s,]|$)`)
+)
+
+// SetDetectionPatterns replaces the regular expressions recognizing OOM kill
+// messages and capturing the victim's PID in them, in the first group of
+// pid, for kernels wording them differently. It must be called before
+// kernel messages are read.
+func SetDetectionPatterns(oom, pid string) error {
+	oomRe, err := regexp.Compile(oom)
+	if err != nil {
+		return fmt.Errorf("invalid OOM pattern: %v", err)
+	}
+	pidRe, err := regexp.Compile(pid)
+	if err != nil {
+		return fmt.Errorf("invalid PID pattern: %v", err)
+	}
+	if pidRe.NumSubexp() == 0 {
+		return fmt.Errorf("PID pattern %q has no capture group", pid)
+	}
+	oomPattern, pidPattern = oomRe, pidRe
+	return nil
+}
+
+func IsOOMMessage(entry KmsgEntry) bool {
+	isOOM := oomPattern.MatchString(entry.Message)
 	if isOOM {
 		logger.Debug("Detected OOM message: %s", entry.Message)
 	}
 	return isOOM
 }
 
-func (k *KmsgReader) ExtractPID(message string) (int, error) {
-	matches := k.pidPattern.FindStringSubmatch(strings.ToLower(message))
+func ExtractPID(message string) (int, error) {
+	matches := pidPattern.FindStringSubmatch(message)
 	if len(matches) < 2 {
 		logger.Debug("No PID pattern found in message: %s", message)
 		return 0, fmt.Errorf("no PID found in OOM message")
@@ -168,131 +506,861 @@ func (k *KmsgReader) ExtractPID(message string) (int, error) {
 	return pid, nil
 }
 
+// MemoryUsage holds the victim's memory figures from the OOM kill line and
+// the swap state from the surrounding report. Sizes are in kB. Fields the
+// kernel did not log are left empty.
+type MemoryUsage struct {
+	TotalVM     string
+	AnonRSS     string
+	FileRSS     string
+	ShmemRSS    string
+	OOMScoreAdj string
+	FreeSwap    string
+	TotalSwap   string
+	// OOMScore is the badness the victim was selected by, logged by older
+	// kernels as "Kill process 1234 (java) score 912 or sacrifice child" and
+	// otherwise read from /proc while the victim still exists.
+	OOMScore string
+}
+
+// ExtractMemoryUsage parses the memory accounting fields of an OOM kill line,
+// e.g. "total-vm:1050000kB, anon-rss:1000000kB, ... oom_score_adj:0".
+func ExtractMemoryUsage(message string) MemoryUsage {
+	var usage MemoryUsage
+	for _, match := range memoryPattern.FindAllStringSubmatch(message, -1) {
+		switch match[1] {
+		case "total-vm":
+			usage.TotalVM = match[2]
+		case "anon-rss":
+			usage.AnonRSS = match[2]
+		case "file-rss":
+			usage.FileRSS = match[2]
+		case "shmem-rss":
+			usage.ShmemRSS = match[2]
+		case "oom_score_adj":
+			usage.OOMScoreAdj = match[2]
+		}
+	}
+	if match := scorePattern.FindStringSubmatch(message); match != nil {
+		usage.OOMScore = match[1]
+	}
+	return usage
+}
+
+// ExtractUID returns the victim's UID from an OOM kill line, or "" on kernels
+// that do not log it.
+func ExtractUID(message string) string {
+	matches := uidPattern.FindStringSubmatch(message)
+	if len(matches) < 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+// ExtractProcessName returns the victim's comm name, in parentheses after the
+// PID in an OOM kill line, or "" when it is missing.
+func ExtractProcessName(message string) string {
+	matches := namePattern.FindStringSubmatch(message)
+	if len(matches) < 2 {
+		return ""
+	}
+	return matches[1]
+}
+
 type OOMMonitor struct {
-	kmsgReader       *KmsgReader
+	source           KernelLogSource
 	processCache     *ProcessCache
 	checkInterval    time.Duration
 	refreshInterval  time.Duration
+	scanInterval     time.Duration
+	ancestry         int
 	startupTimestamp uint64
 	bootTime         time.Time
+	bootID           string
+	reportedDrops    uint64
+	matchers         []eventMatcher
+	attachReport     bool
+	report           *oomReport
+	reaperWait       time.Duration
+	pending          map[int]OOMEventData
+	expired          chan int
+
+	// recent holds the last contextLines messages, capturing the OOM events
+	// waiting for the messages after their kill, see captureContext.
+	contextLines   int
+	recent         []string
+	capturing      []*contextCapture
+	contextExpired chan *contextCapture
+
+	// stop is closed when Start returns, releasing pending reaper timers.
+	stop         <-chan struct{}
+	allocFailure *allocFailure
+	trigger      *oomTrigger
+
+	// droppedEvents counts events discarded because eventChan was full.
+	droppedEvents atomic.Uint64
+	// oomKills counts the OOM kills emitted since startup.
+	oomKills atomic.Uint64
+
+	// state persists the last processed sequence number. While resuming,
+	// entries up to resumeAfter were handled by the previous run.
+	state       *stateFile
+	resumeAfter uint64
+	resuming    bool
+
+	// lastRefresh is the time of the last successful process cache
+	// refresh in Unix nanoseconds, read by Ready.
+	lastRefresh atomic.Int64
+	// refreshDelay is the current delay between refreshes, the refresh
+	// interval backed off while refreshes are slow.
+	refreshDelay atomic.Int64
+	constraint   *oomConstraint
+	errors       *errorReporter
+
+	// closing is closed by Close to stop Start, which running waits for.
+	closeMu sync.Mutex
+	closed  bool
+	closing chan struct{}
+	running sync.WaitGroup
 }
 
-func NewOOMMonitor(procDir string, checkInterval, refreshInterval time.Duration) (*OOMMonitor, error) {
-	kmsgReader, err := NewKmsgReader()
-	if err != nil {
-		return nil, err
+// Options configures an OOMMonitor.
+type Options struct {
+	// ProcDirs are the proc directories processes are read from, consulted
+	// in order, e.g. /proc and the proc mounts of other PID namespaces.
+	// Defaults to /proc.
+	ProcDirs []string
+	// LogSources are the kernel log sources in order of preference, the
+	// first that can be opened is used. Defaults to SourceKmsg.
+	LogSources []string
+	// DmesgFile is tailed by the dmesg source instead of running dmesg.
+	DmesgFile string
+
+	// ProcFS overrides ProcDirs with trees laid out like /proc.
+	ProcFS []fs.FS
+
+	// Source overrides LogSources with a caller-provided kernel log, e.g. a
+	// recorded fixture. Its entries are not filtered by startup time unless
+	// FilterSource is set.
+	Source       KernelLogSource
+	FilterSource bool
+
+	CheckInterval   time.Duration
+	RefreshInterval time.Duration
+	// MinRefreshInterval is the least time between the starts of two full
+	// process cache refreshes, however they are triggered, see
+	// ProcessCache.SetMinRefreshInterval.
+	MinRefreshInterval time.Duration
+	// ScanInterval is the interval of the lightweight scan adding new
+	// processes to the cache between refreshes, 0 disables it.
+	ScanInterval time.Duration
+	CaptureEnv   []string
+	KeepArgs     bool
+	TopConsumers int
+	// Ancestry is the number of ancestors of the victim listed in events,
+	// see ProcessCache.GetAncestry, 0 disables the chain.
+	Ancestry       int
+	WatchSegfaults bool
+	WatchHungTasks bool
+	Matchers       []Matcher
+
+	// AttachFullReport collects the complete kernel OOM report, from the
+	// "invoked oom-killer" line through the kill, and attaches it to events.
+	AttachFullReport bool
+
+	// ContextLines attaches up to this many kernel messages logged before
+	// and after the kill line to OOM events, e.g. memory zone and swap state,
+	// waiting up to a second for those after it. Zero attaches none, and it
+	// is capped at MaxContextLines.
+	ContextLines int
+
+	// ReaperWait holds OOM events up to this long for the oom_reaper line
+	// confirming the kill. Zero sends events immediately.
+	ReaperWait time.Duration
+
+	// HistoryWindow reads the messages already in the kernel log and reports
+	// events logged up to this long before startup. Zero only reports events
+	// logged after startup. A resumed state file takes precedence.
+	HistoryWindow time.Duration
+
+	// StartupGrace moves the cutoff of events from before startup back, so
+	// that events logged while the monitor was starting, e.g. populating the
+	// process cache, or around the startup snapshot are not skipped.
+	StartupGrace time.Duration
+
+	// StateFile records the last processed kmsg sequence number. When it
+	// holds state from the current boot, the monitor resumes after that
+	// message instead of skipping everything logged before startup.
+	StateFile string
+
+	// Errors receives the non-fatal errors of the monitor, such as failed
+	// kernel log reads, without blocking, so that the caller decides how to
+	// handle them. Errors are logged when it is nil or full.
+	Errors chan<- *MonitorError
+
+	// bootTime replaces getBootTime in tests.
+	bootTime func() (time.Time, error)
+}
+
+func NewOOMMonitor(opts Options) (*OOMMonitor, error) {
+	matchers := newSignalMatchers(opts.WatchSegfaults, opts.WatchHungTasks)
+	for _, m := range opts.Matchers {
+		em, err := compileMatcher(m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher %s: %v", m.Kind, err)
+		}
+		matchers = append(matchers, em)
 	}
+	logger.Debug("Loaded %d kernel message matchers besides OOM detection", len(matchers))
 
-	processCache, err := NewProcessCache(procDir)
+	// Get boot time to convert kmsg timestamps (which are since boot) to Unix
+	// epoch. Without it kernel timestamps cannot be placed in time: events
+	// are stamped when they are read and none are filtered as older than
+	// startup.
+	readBootTime := opts.bootTime
+	if readBootTime == nil {
+		readBootTime = getBootTime
+	}
+	bootTime, err := readBootTime()
 	if err != nil {
-		kmsgReader.Close()
-		return nil, err
+		logger.Warn("Failed to get boot time, events are stamped with the time they are read and messages from before startup are not skipped: %v", err)
+	} else {
+		logger.Debug("System boot time: %s", bootTime.Format("2006-01-02 15:04:05"))
 	}
 
-	// Get boot time to convert kmsg timestamps (which are since boot) to Unix epoch
-	bootTime, err := getBootTime()
+	var state *stateFile
+	var resumeAfter uint64
+	var resuming bool
+	if opts.StateFile != "" {
+		state = newStateFile(opts.StateFile, bootTime)
+		if resumeAfter, resuming = state.load(); resuming {
+			logger.Info("Resuming after kernel message %d from %s", resumeAfter, opts.StateFile)
+		}
+	}
+
+	source := opts.Source
+	if source == nil {
+		var name string
+		source, name, err = openKernelLogSource(opts.LogSources, opts.DmesgFile, resuming || opts.HistoryWindow > 0)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("Reading kernel messages from %s", name)
+	}
+
+	procFSs := opts.ProcFS
+	if procFSs == nil {
+		procDirs := opts.ProcDirs
+		if len(procDirs) == 0 {
+			procDirs = []string{"/proc"}
+		}
+		for _, procDir := range procDirs {
+			procFSs = append(procFSs, os.DirFS(procDir))
+		}
+	}
+	processCache, err := NewProcessCacheFS(procFSs, opts.CaptureEnv, opts.KeepArgs, opts.TopConsumers)
 	if err != nil {
-		logger.Warn("Failed to get boot time, using current time as baseline: %v", err)
-		bootTime = time.Now()
+		source.Close()
+		return nil, err
 	}
-	logger.Debug("System boot time: %s", bootTime.Format("2006-01-02 15:04:05"))
+	processCache.SetMinRefreshInterval(opts.MinRefreshInterval)
 
-	// Store startup time as microseconds since boot (same as kmsg timestamps)
-	startupTimestamp := uint64(time.Since(bootTime).Microseconds())
+	// Store startup time as microseconds since boot (same as kmsg timestamps).
+	// A resumed run wants the messages logged while it was down, a history
+	// scan moves the cutoff back by the window.
+	var startupTimestamp uint64
+	switch {
+	case resuming:
+	case bootTime.IsZero():
+		if opts.HistoryWindow > 0 {
+			logger.Warn("Boot time unknown, scanning the whole kernel log history instead of the last %v", opts.HistoryWindow)
+		}
+	case opts.HistoryWindow > 0:
+		startupTimestamp = startupCutoff(time.Since(bootTime), opts.HistoryWindow)
+		logger.Info("Scanning kernel log history for events in the last %v", opts.HistoryWindow)
+	case opts.Source == nil || opts.FilterSource:
+		startupTimestamp = startupCutoff(time.Since(bootTime), opts.StartupGrace)
+	}
 	logger.Debug("OOMMonitor startup timestamp (since boot): %d microseconds", startupTimestamp)
 
-	return &OOMMonitor{
-		kmsgReader:       kmsgReader,
+	contextLines := opts.ContextLines
+	if contextLines > MaxContextLines {
+		contextLines = MaxContextLines
+	}
+
+	m := &OOMMonitor{
+		source:           source,
 		processCache:     processCache,
-		checkInterval:    checkInterval,
-		refreshInterval:  refreshInterval,
+		checkInterval:    opts.CheckInterval,
+		refreshInterval:  opts.RefreshInterval,
+		scanInterval:     opts.ScanInterval,
+		ancestry:         opts.Ancestry,
 		startupTimestamp: startupTimestamp,
 		bootTime:         bootTime,
-	}, nil
+		bootID:           bootIdentity(bootTime),
+		matchers:         matchers,
+		attachReport:     opts.AttachFullReport,
+		reaperWait:       opts.ReaperWait,
+		pending:          make(map[int]OOMEventData),
+		expired:          make(chan int),
+		contextLines:     contextLines,
+		contextExpired:   make(chan *contextCapture),
+		state:            state,
+		resumeAfter:      resumeAfter,
+		resuming:         resuming,
+		closing:          make(chan struct{}),
+	}
+	m.errors = &errorReporter{errs: opts.Errors}
+	if source, ok := source.(errorSource); ok {
+		source.reportErrorsTo(m.errors)
+	}
+	m.lastRefresh.Store(time.Now().UnixNano())
+	m.refreshDelay.Store(int64(m.refreshInterval))
+	return m, nil
 }
 
+// Close stops Start and the goroutines it started, waits for them to exit,
+// then stops the kernel log source and writes the state file.
 func (m *OOMMonitor) Close() error {
-	return m.kmsgReader.Close()
+	m.closeMu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.closing)
+	}
+	m.closeMu.Unlock()
+	m.running.Wait()
+
+	err := m.source.Close()
+	m.saveState()
+	return err
+}
+
+// saveState writes the last processed sequence number when a state file is
+// configured.
+func (m *OOMMonitor) saveState() {
+	if m.state == nil {
+		return
+	}
+	if err := m.state.save(); err != nil {
+		logger.Error("Failed to save state: %v", err)
+	}
+}
+
+// Ready returns nil when the kernel log source is still reading and the
+// process cache was refreshed successfully within two refresh intervals,
+// backed off while refreshes are slow.
+func (m *OOMMonitor) Ready() error {
+	if !m.source.Running() {
+		return fmt.Errorf("kernel log source stopped")
+	}
+	age := time.Since(time.Unix(0, m.lastRefresh.Load()))
+	if age > 2*time.Duration(m.refreshDelay.Load()) {
+		return fmt.Errorf("process cache last refreshed %v ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// CachedProcesses returns the number of processes in the process cache.
+func (m *OOMMonitor) CachedProcesses() int {
+	return m.processCache.Len()
+}
+
+// CachedEntries returns the processes in the process cache, see
+// ProcessCache.Entries.
+func (m *OOMMonitor) CachedEntries() [][]ProcessInfo {
+	return m.processCache.Entries()
 }
 
-func (m *OOMMonitor) Start(eventChan chan<- OOMEventData) error {
+// LastRefresh returns the time of the last successful process cache
+// refresh, the creation of the monitor until the first one.
+func (m *OOMMonitor) LastRefresh() time.Time {
+	return time.Unix(0, m.lastRefresh.Load())
+}
+
+// DroppedEntries returns the number of kernel messages the reader had to
+// discard because the monitor did not drain them fast enough.
+func (m *OOMMonitor) DroppedEntries() uint64 {
+	return m.source.DroppedEntries()
+}
+
+// DroppedEvents returns the number of events discarded because the event
+// channel passed to Start was full.
+func (m *OOMMonitor) DroppedEvents() uint64 {
+	return m.droppedEvents.Load()
+}
+
+// OOMKills returns the number of OOM kills detected since startup,
+// including those dropped because the event channel was full.
+func (m *OOMMonitor) OOMKills() uint64 {
+	return m.oomKills.Load()
+}
+
+// Start processes kernel messages until ctx is cancelled, Close is called or
+// a replayed source runs out, sending events on eventChan. Goroutines started
+// by Start have exited when it returns; the kernel log source keeps running
+// until Close.
+func (m *OOMMonitor) Start(ctx context.Context, eventChan chan<- OOMEventData) error {
+	m.closeMu.Lock()
+	if m.closed {
+		m.closeMu.Unlock()
+		return fmt.Errorf("monitor is closed")
+	}
+	m.running.Add(1)
+	m.closeMu.Unlock()
+	defer m.running.Done()
+
 	logger.Debug("Starting OOM monitor with check interval: %v, refresh interval: %v", m.checkInterval, m.refreshInterval)
 
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	m.stop = ctx.Done()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-m.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	// Start process cache refresh routine
-	go m.refreshProcessCache()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.refreshProcessCache(ctx)
+	}()
+	if m.scanInterval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.scanProcesses(ctx)
+		}()
+	}
 
-	// Monitor kernel messages
+	// Housekeeping timer
 	ticker := time.NewTicker(m.checkInterval)
 	defer ticker.Stop()
 
 	logger.Debug("Starting kernel message monitoring loop")
-	for range ticker.C {
-		logger.Debug("Checking for new kernel messages")
-		entries, err := m.kmsgReader.ReadEntries()
-		if err != nil {
-			logger.Error("Error reading kmsg entries: %v", err)
-			continue
+	entries := m.source.Entries()
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				// Only replayed sources run out, deliver what is still held
+				logger.Info("Kernel log source exhausted, stopping monitor")
+				for len(m.capturing) > 0 {
+					m.releaseContext(m.capturing[0], eventChan)
+				}
+				for pid := range m.pending {
+					m.releaseExpired(pid, eventChan)
+				}
+				return nil
+			}
+			if m.resuming {
+				if entry.SequenceNum <= m.resumeAfter {
+					continue
+				}
+				if entry.SequenceNum > m.resumeAfter+1 {
+					logger.Warn("Kernel messages %d to %d were overwritten while stopped, OOM events may have been missed",
+						m.resumeAfter+1, entry.SequenceNum-1)
+				}
+				m.resuming = false
+			}
+			oom := m.handleEntry(entry, eventChan)
+			m.recordContext(entry, eventChan)
+			if m.state != nil {
+				m.state.record(entry.SequenceNum)
+				if oom {
+					// Save right away so a crash does not alert twice
+					m.saveState()
+				}
+			}
+
+		case pid := <-m.expired:
+			m.releaseExpired(pid, eventChan)
+
+		case capture := <-m.contextExpired:
+			m.releaseContext(capture, eventChan)
+
+		case <-ctx.Done():
+			logger.Debug("Stopping kernel message monitoring loop")
+			return nil
+
+		case <-ticker.C:
+			// Entries are handled as soon as they are parsed, the ticker only
+			// drives periodic housekeeping.
+			if dropped := m.source.DroppedEntries(); dropped > m.reportedDrops {
+				logger.Warn("Dropped %d kernel messages since last check (%d total), OOM events may have been missed",
+					dropped-m.reportedDrops, dropped)
+				m.reportedDrops = dropped
+			}
+			m.saveState()
 		}
+	}
+}
 
-		for _, entry := range entries {
-			if m.kmsgReader.IsOOMMessage(entry) {
-				logger.Info("OOM message detected! Processing...")
+// handleEntry processes entry, sending the event it reports on eventChan.
+// It reports whether entry was an OOM kill line.
+func (m *OOMMonitor) handleEntry(entry KmsgEntry, eventChan chan<- OOMEventData) bool {
+	m.collectReport(entry)
 
-				// Filter out events that occurred before process startup
-				if entry.Timestamp < m.startupTimestamp {
-					logger.Debug("Skipping OOM event from before startup: timestamp=%d, startup=%d",
-						entry.Timestamp, m.startupTimestamp)
-					continue
-				}
+	if m.reaperWait > 0 && m.handleReaper(entry, eventChan) {
+		return false
+	}
 
-				pid, err := m.kmsgReader.ExtractPID(entry.Message)
-				if err != nil {
-					logger.Error("Failed to extract PID from OOM message: %v", err)
-					continue
-				}
+	m.recordAllocFailure(entry)
+	m.recordOOMConstraint(entry)
+	m.recordOOMTrigger(entry)
+
+	if IsOOMMessage(entry) {
+		logger.Info("OOM message detected! Processing...")
+		report := m.takeReport(entry)
+		failure := m.takeAllocFailure(entry.Timestamp)
+		constraint := m.takeOOMConstraint(entry.Timestamp)
+		trigger := m.takeOOMTrigger(entry.Timestamp)
 
-				event := m.createOOMEvent(pid, entry.Timestamp)
-				logger.Info("Sending OOM event: PID=%d, Process=%s, Timestamp=%d",
-					pid, event.Cmdline, entry.Timestamp)
-				eventChan <- event
+		// Filter out events that occurred before process startup
+		if entry.Timestamp < m.startupTimestamp {
+			logger.Debug("Skipping OOM event from before startup: timestamp=%d, startup=%d",
+				entry.Timestamp, m.startupTimestamp)
+			return true
+		}
+
+		// The structured oom-kill line of newer kernels is preferred over the
+		// free-text kill line, whose wording changed across versions
+		match := kernelMatch{kind: KindOOM}
+		if constraint != nil && constraint.pid > 0 {
+			match.pid, match.name = constraint.pid, constraint.task
+		} else {
+			pid, err := ExtractPID(entry.Message)
+			if err != nil {
+				m.errors.report(ErrorParse, fmt.Errorf("failed to extract PID from OOM message: %v", err))
+				return true
+			}
+			match.pid = pid
+		}
+		if match.name == "" {
+			// Names the victim when it is gone before the cache saw it
+			match.name = ExtractProcessName(entry.Message)
+		}
+		pid := match.pid
+
+		event := m.createOOMEvent(match, entry)
+		event.Memory = ExtractMemoryUsage(entry.Message)
+		if event.Memory.OOMScore == "" {
+			// Only readable while the victim has not exited yet
+			event.Memory.OOMScore = m.processCache.GetOOMScore(pid)
+		}
+		if event.UID == "" {
+			// The victim is often gone by now, but newer kernels log its UID
+			if constraint != nil {
+				event.UID = constraint.uid
+			}
+			if event.UID == "" {
+				event.UID = ExtractUID(entry.Message)
+			}
+			if event.UID != "" {
+				event.User = lookupUsername(event.UID)
+			}
+		}
+		if report != nil {
+			if m.attachReport {
+				event.Report = report.text()
 			}
+			event.Memory.FreeSwap = report.freeSwap
+			event.Memory.TotalSwap = report.totalSwap
 		}
+		event.OOMType = OOMType(entry.Message)
+		if constraint != nil {
+			if constraint.memcg {
+				event.OOMType = OOMTypeMemcg
+			}
+			event.Constraint = constraint.constraint
+			event.Cgroup = constraint.cgroup
+			event.TaskCgroup = constraint.taskCgroup
+		}
+		if event.TaskCgroup == "" {
+			event.TaskCgroup = m.processCache.GetCgroup(pid)
+		}
+		if event.OOMType == OOMTypeGlobal {
+			// Host-wide consumers say nothing about a cgroup limit kill
+			event.TopConsumers = m.topConsumers(pid)
+		}
+		if failure != nil {
+			event.AllocOrder = failure.order
+			event.GFPFlags = failure.gfpFlags
+		}
+		if trigger != nil {
+			event.TriggerPID, event.TriggerCmdline = m.triggerProcess(trigger)
+		}
+		if m.contextLines > 0 {
+			m.captureContext(event, pid, entry)
+			return true
+		}
+		if m.reaperWait > 0 {
+			m.holdForReaper(event, pid)
+			return true
+		}
+		logger.Info("Sending OOM event",
+			logger.F("pid", pid), logger.F("cmdline", event.Cmdline), logger.F("timestamp", entry.Timestamp))
+		m.emit(eventChan, event)
+		return true
 	}
 
-	return nil
+	match, ok := classify(m.matchers, entry)
+	if !ok {
+		return false
+	}
+	logger.Info("Kernel %s message detected! Processing...", match.kind)
+
+	if entry.Timestamp < m.startupTimestamp {
+		logger.Debug("Skipping %s event from before startup: timestamp=%d, startup=%d",
+			match.kind, entry.Timestamp, m.startupTimestamp)
+		return false
+	}
+
+	event := m.createOOMEvent(match, entry)
+	logger.Info("Sending %s event", match.kind,
+		logger.F("pid", match.pid), logger.F("cmdline", event.Cmdline), logger.F("timestamp", entry.Timestamp))
+	m.emit(eventChan, event)
+	return false
+}
+
+// refreshProcessCache refreshes the process cache every refresh interval.
+// On hosts with many processes a full scan of /proc can take a good part of
+// the interval, so slow refreshes back off, see refreshSlowFraction; misses
+// in between are read directly by GetCommandLine.
+func (m *OOMMonitor) refreshProcessCache(ctx context.Context) {
+	delay := m.refreshInterval
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			logger.Debug("Stopping process cache refresh")
+			return
+		}
+
+		started := time.Now()
+		err := m.processCache.Refresh()
+		took := time.Since(started)
+		logger.Debug("Process cache refresh took %v", took)
+
+		next := nextRefreshDelay(delay, m.refreshInterval, took)
+		if next > delay {
+			logger.Warn("Process cache refresh took %v, delaying the next one to %v", took.Round(time.Millisecond), next)
+		} else if next < delay {
+			logger.Debug("Process cache refresh is fast again, next one in %v", next)
+		}
+		delay = next
+		m.refreshDelay.Store(int64(delay))
+		timer.Reset(delay)
+
+		if err != nil {
+			m.errors.report(ErrorEnrichment, fmt.Errorf("failed to refresh process cache: %v", err))
+			continue
+		}
+		m.lastRefresh.Store(time.Now().UnixNano())
+	}
+}
+
+// nextRefreshDelay returns the delay before the next refresh after one that
+// took took with the current delay, backing off from interval while
+// refreshes are slow.
+func nextRefreshDelay(delay, interval, took time.Duration) time.Duration {
+	if took > interval/refreshSlowFraction {
+		if delay *= 2; delay > refreshMaxBackoff*interval {
+			delay = refreshMaxBackoff * interval
+		}
+		return delay
+	}
+	if delay /= 2; delay < interval {
+		delay = interval
+	}
+	return delay
 }
 
-func (m *OOMMonitor) refreshProcessCache() {
-	ticker := time.NewTicker(m.refreshInterval)
+// scanProcesses adds new processes to the cache between refreshes, so that
+// processes living less than a refresh interval can still be named when
+// they are killed.
+func (m *OOMMonitor) scanProcesses(ctx context.Context) {
+	ticker := time.NewTicker(m.scanInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if err := m.processCache.Refresh(); err != nil {
-			logger.Error("Failed to refresh process cache: %v", err)
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Debug("Stopping process scan")
+			return
 		}
+
+		if _, err := m.processCache.ScanNew(); err != nil {
+			m.errors.report(ErrorEnrichment, fmt.Errorf("failed to scan for new processes: %v", err))
+		}
+	}
+}
+
+// emit sends an event without blocking. When eventChan is full the event is
+// dropped and counted, so a slow consumer never stalls kernel log processing.
+func (m *OOMMonitor) emit(eventChan chan<- OOMEventData, event OOMEventData) {
+	if event.Kind == KindOOM {
+		event.KillCount = m.oomKills.Add(1)
+	}
+
+	select {
+	case eventChan <- event:
+	default:
+		dropped := m.droppedEvents.Add(1)
+		logger.Warn("Event buffer full, dropping %s event for PID %s (%d dropped in total)", event.Kind, event.PID, dropped)
+	}
+}
+
+// topConsumers returns the largest processes from the last process scan,
+// leaving out the victim itself.
+func (m *OOMMonitor) topConsumers(victim int) []MemoryConsumer {
+	var consumers []MemoryConsumer
+	for _, proc := range m.processCache.TopConsumers(victim) {
+		consumers = append(consumers, MemoryConsumer{
+			PID:     proc.PID,
+			Cmdline: proc.Cmdline,
+			RSS:     proc.RSS,
+		})
+	}
+	return consumers
+}
+
+// eventID returns the ID of the event of kind for pid detected in entry, a
+// hash of the boot and the sequence number of the message, which identify
+// a kernel message until the next boot.
+func (m *OOMMonitor) eventID(entry KmsgEntry, kind string, pid int) string {
+	if m.bootID == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s\x00%d", m.bootID, entry.SequenceNum, kind, pid)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// bootIdentity identifies the current boot: the kernel's boot ID, or the
+// boot time when there is none, and empty when neither is known.
+func bootIdentity(bootTime time.Time) string {
+	if id := getBootID(); id != "" {
+		return id
 	}
+	if bootTime.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(bootTime.Unix(), 10)
+}
+
+// Reported reports whether the event with id was already reported during
+// this boot, as recorded by MarkReported in the state file. It is always
+// false without a state file or an ID.
+func (m *OOMMonitor) Reported(id string) bool {
+	if m.state == nil || id == "" {
+		return false
+	}
+	return m.state.isReported(id)
 }
 
-func (m *OOMMonitor) createOOMEvent(pid int, timestamp uint64) OOMEventData {
-	logger.Debug("Creating OOM event for PID %d", pid)
-	cmdline := m.processCache.GetCommandLine(pid)
-	if cmdline == "" {
-		cmdline = fmt.Sprintf("<unknown process %d>", pid)
+// MarkReported records the event with id as reported and saves the state
+// file right away, so that a restart reading its kernel message again
+// skips it. It does nothing without a state file or an ID.
+func (m *OOMMonitor) MarkReported(id string) {
+	if m.state == nil || id == "" {
+		return
+	}
+	m.state.markReported(id, time.Now())
+	m.saveState()
+}
+
+// Delivered reports whether the event with id was already delivered by the
+// notifier named name during this boot, as recorded by MarkDelivered. It is
+// always false without a state file or an ID.
+func (m *OOMMonitor) Delivered(id, name string) bool {
+	if m.state == nil || id == "" {
+		return false
+	}
+	return m.state.isDelivered(id, name)
+}
+
+// MarkDelivered records the event with id as delivered by the notifier
+// named name and saves the state file right away, so that neither a retry
+// nor a restart sends it to that notifier again. It does nothing without a
+// state file or an ID.
+func (m *OOMMonitor) MarkDelivered(id, name string) {
+	if m.state == nil || id == "" {
+		return
+	}
+	m.state.markDelivered(id, name, time.Now())
+	m.saveState()
+}
+
+func (m *OOMMonitor) createOOMEvent(match kernelMatch, entry KmsgEntry) OOMEventData {
+	pid, timestamp := match.pid, entry.Timestamp
+	logger.Debug("Creating %s event for PID %d", match.kind, pid)
+	var cmdline string
+	if pid > 0 {
+		cmdline = m.processCache.GetCommandLine(pid)
+	}
+	if cmdline == "" && match.name != "" {
+		cmdline = fmt.Sprintf("[%s]", match.name)
+		logger.Debug("Process not found in cache, using name from kernel message: %s", cmdline)
+	}
+	if cmdline == "" && pid > 0 {
+		cmdline = unknownProcess
 		logger.Debug("Process not found in cache, using fallback name: %s", cmdline)
 	}
 
+	// Custom matchers may describe kernel events without a process
+	var pidStr string
+	if pid > 0 {
+		pidStr = strconv.Itoa(pid)
+	}
+
+	var uid, username, parentPID, parentCmdline string
+	var ancestry []string
+	if pid > 0 {
+		uid, username = m.processCache.GetUser(pid)
+		var ppid int
+		if ppid, parentCmdline = m.processCache.GetParent(pid); ppid > 0 {
+			parentPID = strconv.Itoa(ppid)
+		}
+		if m.ancestry > 0 {
+			ancestry = m.processCache.GetAncestry(pid, m.ancestry)
+		}
+	}
+
 	hostname, _ := os.Hostname()
 
-	// Convert kernel timestamp (microseconds since boot) to Unix epoch time (milliseconds)
-	eventTime := m.bootTime.Add(time.Duration(timestamp) * time.Microsecond)
+	eventTime := m.eventTime(timestamp)
 	eventTimeMillis := eventTime.UnixNano() / int64(time.Millisecond)
 
 	event := OOMEventData{
+		ID:       m.eventID(entry, match.kind, pid),
+		Kind:     match.kind,
+		Message:  entry.Message,
 		Cmdline:  cmdline,
-		PID:      strconv.Itoa(pid),
+		PID:      pidStr,
+		Fields:   match.fields,
 		Hostname: hostname,
-		Kernel:   getKernelVersion(),
+		Kernel:   KernelVersion(),
 		Time:     eventTimeMillis,
+		Env:      m.processCache.GetEnv(pid),
+		Args:     m.processCache.GetArgs(pid),
+		UID:      uid,
+		User:     username,
+
+		ParentPID:     parentPID,
+		ParentCmdline: parentCmdline,
+		Ancestry:      ancestry,
 	}
 
 	logger.Debug("Created OOM event: %+v (kernel timestamp: %d, converted time: %s)",
@@ -300,6 +1368,25 @@ func (m *OOMMonitor) createOOMEvent(pid int, timestamp uint64) OOMEventData {
 	return event
 }
 
+// startupCutoff returns the kernel timestamp, in microseconds since boot,
+// before which events are skipped: uptime at startup less grace, and 0 when
+// grace reaches back to boot.
+func startupCutoff(uptime, grace time.Duration) uint64 {
+	if uptime <= grace {
+		return 0
+	}
+	return uint64((uptime - grace).Microseconds())
+}
+
+// eventTime converts a kernel timestamp, in microseconds since boot, to the
+// time of the event. It is the current time when the boot time is unknown.
+func (m *OOMMonitor) eventTime(timestamp uint64) time.Time {
+	if m.bootTime.IsZero() {
+		return time.Now()
+	}
+	return m.bootTime.Add(time.Duration(timestamp) * time.Microsecond)
+}
+
 func getBootTime() (time.Time, error) {
 	// Read /proc/stat to get boot time
 	data, err := os.ReadFile("/proc/stat")
@@ -316,6 +1403,9 @@ func getBootTime() (time.Time, error) {
 				if err != nil {
 					return time.Time{}, err
 				}
+				if bootTimeUnix <= 0 {
+					return time.Time{}, fmt.Errorf("invalid btime %d in /proc/stat", bootTimeUnix)
+				}
 				return time.Unix(bootTimeUnix, 0), nil
 			}
 		}
@@ -324,7 +1414,7 @@ func getBootTime() (time.Time, error) {
 	return time.Time{}, fmt.Errorf("btime not found in /proc/stat")
 }
 
-func getKernelVersion() string {
+func KernelVersion() string {
 	data, err := os.ReadFile("/proc/version")
 	if err != nil {
 		return "unknown"
@@ -336,10 +1426,85 @@ func getKernelVersion() string {
 	return "unknown"
 }
 
+// OOMEventData describes a kernel event affecting a process. Kind is KindOOM
+// for OOM kills and one of the other Kind constants for opt-in event types.
 type OOMEventData struct {
+	// ID identifies the event across restarts: the same kernel message
+	// read again, e.g. by a history scan, gives the same ID. It is empty
+	// for the events not read from the kernel log and when the boot cannot
+	// be identified.
+	ID       string
+	Kind     string
+	Message  string
 	Cmdline  string
+	Args     []string
 	PID      string
 	Hostname string
 	Kernel   string
 	Time     int64
+	Env      map[string]string
+	Fields   map[string]string
+	Report   string
+	Reaped   bool
+
+	// Context holds the kernel messages around the kill line, one per line,
+	// when Options.ContextLines is set.
+	Context string
+
+	// UID and User identify the owner of the process. They are empty when
+	// the process exited before it could be read and the kernel did not log
+	// the UID; User is also empty when the UID has no passwd entry.
+	UID  string
+	User string
+
+	// ParentPID and ParentCmdline describe the process that spawned the
+	// victim. ParentCmdline is empty when the parent has already exited.
+	ParentPID     string
+	ParentCmdline string
+
+	// Ancestry names the victim's ancestors, outermost first and ending
+	// with the victim, when Options.Ancestry is set.
+	Ancestry []string
+
+	// TriggerPID and TriggerCmdline describe the task whose allocation
+	// invoked the OOM killer, which may differ from the victim. TriggerPID
+	// is empty when the kernel did not log it.
+	TriggerPID     string
+	TriggerCmdline string
+
+	// AllocOrder and GFPFlags describe the failed page allocation logged
+	// before the OOM, when the kernel reports one.
+	AllocOrder string
+	GFPFlags   string
+
+	// Memory holds the victim's memory usage from the OOM kill line.
+	Memory MemoryUsage
+
+	// OOMType is OOMTypeMemcg when a cgroup limit was hit and OOMTypeGlobal
+	// otherwise. Cgroup names the limiting cgroup when the kernel logs it.
+	// TaskCgroup is the victim's own cgroup, from the kernel log or, while
+	// the process still exists, from /proc.
+	OOMType    string
+	Cgroup     string
+	TaskCgroup string
+
+	// Constraint is what limited the memory available to the victim, from
+	// the kernel's oom-kill line: "none", "cpuset", "memory_policy" or
+	// "memcg". It is empty on kernels that do not log it.
+	Constraint string
+
+	// TopConsumers lists the largest other processes by RSS as of the last
+	// process scan. It is only set for global OOM kills.
+	TopConsumers []MemoryConsumer
+
+	// KillCount numbers OOM kills since the monitor started, from 1. It
+	// starts over on restart and is zero for other kinds.
+	KillCount uint64
+}
+
+// MemoryConsumer is a process and its last-known RSS in kB.
+type MemoryConsumer struct {
+	PID     int
+	Cmdline string
+	RSS     int64
 }
@@ -0,0 +1,759 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// detect runs recording, kernel log records in the /dev/kmsg format,
+// through a monitor with opts and returns the events it detected. Source,
+// ProcFS and the intervals default to a replay of recording over an empty
+// proc tree.
+func detect(t *testing.T, opts Options, recording string) []OOMEventData {
+	t.Helper()
+	if opts.Source == nil {
+		opts.Source = NewLineSource(strings.NewReader(recording))
+	}
+	if opts.ProcFS == nil {
+		opts.ProcFS = []fs.FS{fakeProc(map[string]string{})}
+	}
+	if opts.CheckInterval == 0 {
+		opts.CheckInterval = time.Second
+	}
+	if opts.RefreshInterval == 0 {
+		opts.RefreshInterval = time.Hour
+	}
+	m, err := NewOOMMonitor(opts)
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+
+	events := make(chan OOMEventData, 100)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Start(ctx, events); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	close(events)
+
+	var out []OOMEventData
+	for event := range events {
+		out = append(out, event)
+	}
+	return out
+}
+
+func TestExtractMemoryUsage(t *testing.T) {
+	for _, tt := range []struct {
+		name, message string
+		want          MemoryUsage
+	}{
+		{
+			"5.x kill line",
+			"Out of memory: Killed process 1234 (stress) total-vm:1050000kB, anon-rss:1000000kB, file-rss:4kB, shmem-rss:0kB, UID:0 pgtables:2100kB oom_score_adj:0",
+			MemoryUsage{TotalVM: "1050000", AnonRSS: "1000000", FileRSS: "4", ShmemRSS: "0", OOMScoreAdj: "0"},
+		},
+		{
+			"memcg kill line with negative adjustment",
+			"Memory cgroup out of memory: Killed process 26576 (python3) total-vm:524880kB, anon-rss:261700kB, file-rss:9216kB, shmem-rss:0kB, UID:1000 pgtables:688kB oom_score_adj:-998",
+			MemoryUsage{TotalVM: "524880", AnonRSS: "261700", FileRSS: "9216", ShmemRSS: "0", OOMScoreAdj: "-998"},
+		},
+		{
+			"4.x kill line without shmem or adjustment",
+			"Killed process 2582 (mysqld) total-vm:2498600kB, anon-rss:1193812kB, file-rss:0kB",
+			MemoryUsage{TotalVM: "2498600", AnonRSS: "1193812", FileRSS: "0"},
+		},
+		{
+			"old kernel logging the score",
+			"Out of memory: Kill process 1234 (java) score 912 or sacrifice child",
+			MemoryUsage{OOMScore: "912"},
+		},
+		{
+			"old kernel without figures",
+			"Out of memory: Killed process 1234 (java).",
+			MemoryUsage{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExtractMemoryUsage(tt.message); got != tt.want {
+				t.Errorf("ExtractMemoryUsage = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectedKillCarriesMemoryUsage(t *testing.T) {
+	events := detect(t, Options{}, "6,100,5000000,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:8kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:500\n")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	memory := events[0].Memory
+	if memory.TotalVM != "1024" || memory.AnonRSS != "512" || memory.FileRSS != "8" || memory.OOMScoreAdj != "500" {
+		t.Errorf("Memory = %+v", memory)
+	}
+}
+
+func TestOOMKillsAreNumbered(t *testing.T) {
+	events := detect(t, Options{}, "6,100,5000000,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n"+
+		"6,101,6000000,-;Memory cgroup out of memory: Killed process 4343 (java) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n"+
+		"6,102,7000000,-;Out of memory: Killed process 4444 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n")
+	if len(events) != 3 {
+		t.Fatalf("detected %d events, want 3", len(events))
+	}
+	for i, event := range events {
+		if event.KillCount != uint64(i+1) {
+			t.Errorf("kill of PID %s numbered %d, want %d", event.PID, event.KillCount, i+1)
+		}
+	}
+}
+
+// pipeKmsg is a fake /dev/kmsg backed by a pipe: every write is one record
+// and reads block until the next one.
+type pipeKmsg struct {
+	*io.PipeReader
+}
+
+func (pipeKmsg) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+
+func newPipeKmsgReader(t *testing.T) (*KmsgReader, *io.PipeWriter) {
+	t.Helper()
+	r, w := io.Pipe()
+	reader, err := newKmsgReader(func() (io.ReadSeekCloser, error) { return pipeKmsg{r}, nil }, false)
+	if err != nil {
+		t.Fatalf("newKmsgReader: %v", err)
+	}
+	return reader, w
+}
+
+func TestKmsgReaderDeliversRecordsAsRead(t *testing.T) {
+	reader, w := newPipeKmsgReader(t)
+	defer reader.Close()
+
+	for seq, message := range []string{"systemd[1]: Started Session 2 of user root.", "Out of memory: Killed process 4242 (stress)"} {
+		if _, err := fmt.Fprintf(w, "6,%d,5000000,-;%s\n", seq+1, message); err != nil {
+			t.Fatal(err)
+		}
+		// The entry arrives without waiting for a poll interval or more
+		// records
+		select {
+		case entry := <-reader.Entries():
+			if entry.SequenceNum != uint64(seq+1) || entry.Message != message {
+				t.Errorf("entry %d %q, want %d %q", entry.SequenceNum, entry.Message, seq+1, message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("record %d not delivered while the reader blocks for the next", seq+1)
+		}
+	}
+}
+
+func TestKmsgReaderCloseUnblocksRead(t *testing.T) {
+	reader, _ := newPipeKmsgReader(t)
+	if !reader.Running() {
+		t.Fatal("reader not running")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		reader.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on the pending read")
+	}
+	if reader.Running() {
+		t.Error("read loop still running after Close")
+	}
+}
+
+func TestMonitorReadiness(t *testing.T) {
+	reader, _ := newPipeKmsgReader(t)
+	m, err := NewOOMMonitor(Options{
+		Source:          reader,
+		ProcFS:          []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval:   time.Second,
+		RefreshInterval: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+
+	if err := m.Ready(); err != nil {
+		t.Errorf("Ready of a fresh monitor = %v, want nil", err)
+	}
+
+	// Refreshed longer ago than twice the refresh interval
+	m.lastRefresh.Store(time.Now().Add(-3 * time.Minute).UnixNano())
+	if err := m.Ready(); err == nil || !strings.Contains(err.Error(), "process cache last refreshed") {
+		t.Errorf("Ready with a stale process cache = %v, want the refresh age", err)
+	}
+	m.lastRefresh.Store(time.Now().Add(-90 * time.Second).UnixNano())
+	if err := m.Ready(); err != nil {
+		t.Errorf("Ready within two refresh intervals = %v, want nil", err)
+	}
+
+	// Close stops the kmsg reader
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := m.Ready(); err == nil || !strings.Contains(err.Error(), "kernel log source stopped") {
+		t.Errorf("Ready with a closed kmsg reader = %v, want the stopped source", err)
+	}
+}
+
+// waitForGoroutines waits up to a second for the number of goroutines to
+// drop to at most n and returns the last count.
+func waitForGoroutines(n int) int {
+	deadline := time.Now().Add(time.Second)
+	for {
+		count := runtime.NumGoroutine()
+		if count <= n || time.Now().After(deadline) {
+			return count
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCancelStopsMonitorGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	reader, _ := newPipeKmsgReader(t)
+	m, err := NewOOMMonitor(Options{
+		Source:          reader,
+		ProcFS:          []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval:   10 * time.Millisecond,
+		RefreshInterval: 10 * time.Millisecond,
+		ScanInterval:    10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Start(ctx, make(chan OOMEventData, 1)) }()
+	// Let the refresh and scan loops tick
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Start = %v, want nil after cancellation", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start still running after cancellation")
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if count := waitForGoroutines(before); count > before {
+		t.Errorf("%d goroutines after Close, want at most the %d before Start", count, before)
+	}
+}
+
+func TestCloseStopsStart(t *testing.T) {
+	reader, _ := newPipeKmsgReader(t)
+	m, err := NewOOMMonitor(Options{
+		Source:          reader,
+		ProcFS:          []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval:   time.Second,
+		RefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- m.Start(context.Background(), make(chan OOMEventData, 1)) }()
+	time.Sleep(20 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start still running after Close")
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	if err := m.Start(context.Background(), make(chan OOMEventData, 1)); err == nil {
+		t.Error("Start of a closed monitor succeeded")
+	}
+}
+
+func TestCloseStopsMonitorGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	reader, _ := newPipeKmsgReader(t)
+	m, err := NewOOMMonitor(Options{
+		Source:          reader,
+		ProcFS:          []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval:   10 * time.Millisecond,
+		RefreshInterval: 10 * time.Millisecond,
+		ScanInterval:    10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- m.Start(context.Background(), make(chan OOMEventData, 1)) }()
+	// Let the refresh and scan loops tick
+	time.Sleep(50 * time.Millisecond)
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Start still running after Close")
+	}
+	if count := waitForGoroutines(before); count > before {
+		t.Errorf("%d goroutines after Close, want at most the %d before Start", count, before)
+	}
+}
+
+func TestFullEventBufferDropsInsteadOfBlocking(t *testing.T) {
+	var recording strings.Builder
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(&recording, "6,%d,5000000,-;Out of memory: Killed process %d (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n", 100+i, 4000+i)
+	}
+	m, err := NewOOMMonitor(Options{
+		Source:          NewLineSource(strings.NewReader(recording.String())),
+		ProcFS:          []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval:   time.Second,
+		RefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+
+	// Nothing reads the buffer while the monitor runs
+	events := make(chan OOMEventData, 2)
+	done := make(chan error, 1)
+	go func() { done <- m.Start(context.Background(), events) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitor blocked on the full event buffer")
+	}
+
+	if got := m.DroppedEvents(); got != 3 {
+		t.Errorf("DroppedEvents = %d, want 3", got)
+	}
+	if got := m.OOMKills(); got != 5 {
+		t.Errorf("OOMKills = %d, want 5 including the dropped kills", got)
+	}
+	if len(events) != 2 || (<-events).PID != "4000" {
+		t.Errorf("buffer does not hold the first kills")
+	}
+}
+
+func TestParseKmsgRecord(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		record  string
+		message string
+		dict    map[string]string
+		flag    byte
+	}{
+		{
+			name:    "plain message",
+			record:  "6,1024,5000000,-;Out of memory: Killed process 4242 (stress)\n",
+			message: "Out of memory: Killed process 4242 (stress)",
+			flag:    '-',
+		},
+		{
+			name:    "caller id",
+			record:  "3,1025,5000001,-,caller=T4242;oom-kill:constraint=CONSTRAINT_NONE",
+			message: "oom-kill:constraint=CONSTRAINT_NONE",
+			flag:    '-',
+		},
+		{
+			name:    "dictionary",
+			record:  "3,1026,5000002,-;usb 1-1: device descriptor read/64, error -71\n SUBSYSTEM=usb\n DEVICE=c189:1\n",
+			message: "usb 1-1: device descriptor read/64, error -71",
+			dict:    map[string]string{"SUBSYSTEM": "usb", "DEVICE": "c189:1"},
+			flag:    '-',
+		},
+		{
+			name:    "continued text",
+			record:  "3,1027,5000003,-;Memory cgroup out of memory:\n Killed process 4242 (stress)\n",
+			message: "Memory cgroup out of memory: Killed process 4242 (stress)",
+			flag:    '-',
+		},
+		{
+			name:    "fragment",
+			record:  "4,1028,5000004,c;Out of memory: ",
+			message: "Out of memory: ",
+			flag:    'c',
+		},
+		{
+			name:    "kernel without flag",
+			record:  "6,1029,5000005;message",
+			message: "message",
+			flag:    '-',
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := parseKmsgRecord(tt.record)
+			if err != nil {
+				t.Fatalf("parseKmsgRecord: %v", err)
+			}
+			if entry.Message != tt.message || entry.flag != tt.flag {
+				t.Errorf("message %q flag %q, want %q and %q", entry.Message, entry.flag, tt.message, tt.flag)
+			}
+			if !reflect.DeepEqual(entry.Dict, tt.dict) {
+				t.Errorf("dictionary %v, want %v", entry.Dict, tt.dict)
+			}
+		})
+	}
+
+	for _, record := range []string{"no separator", "6,1;message", "x,1,100,-;message", "6,1,100,-;message\nunindented"} {
+		if entry, err := parseKmsgRecord(record); err == nil {
+			t.Errorf("parseKmsgRecord(%q) = %+v, want an error", record, entry)
+		}
+	}
+}
+
+func TestKmsgAssemblerJoinsFragments(t *testing.T) {
+	var a kmsgAssembler
+	var out []KmsgEntry
+	for _, record := range []string{
+		"4,10,100,c;Out of memory: ",
+		"4,11,101,+;Killed process 4242 ",
+		"4,12,102,+;(stress)",
+		"6,13,103,-;whole message",
+		"6,14,104,+;orphaned continuation",
+		"4,15,105,c;open fragment",
+	} {
+		entry, err := parseKmsgRecord(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, a.add(*entry)...)
+	}
+	out = append(out, a.flush()...)
+
+	want := []struct {
+		seq     uint64
+		message string
+	}{
+		{12, "Out of memory: Killed process 4242 (stress)"},
+		{13, "whole message"},
+		{14, "orphaned continuation"},
+		{15, "open fragment"},
+	}
+	if len(out) != len(want) {
+		t.Fatalf("assembled %d entries, want %d: %+v", len(out), len(want), out)
+	}
+	for i, w := range want {
+		if out[i].SequenceNum != w.seq || out[i].Message != w.message {
+			t.Errorf("entry %d = %d %q, want %d %q", i, out[i].SequenceNum, out[i].Message, w.seq, w.message)
+		}
+	}
+}
+
+func TestExtractProcessName(t *testing.T) {
+	for message, want := range map[string]string{
+		killLine: "stress",
+		"Memory cgroup out of memory: Killed process 4242 (Web Content) total-vm:2048kB": "Web Content",
+		"Out of memory: Killed process 4242 (kworker/u8:2), UID 0":                       "kworker/u8:2",
+		"Out of memory: Killed process 4242 (python3)":                                   "python3",
+		"Out of memory: Killed process 4242 total-vm:1024kB":                             "",
+	} {
+		if got := ExtractProcessName(message); got != want {
+			t.Errorf("ExtractProcessName(%q) = %q, want %q", message, got, want)
+		}
+	}
+}
+
+func TestVictimNameFallbacks(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		proc map[string]string
+		line string
+		want string
+	}{
+		{"cached command line", map[string]string{"4242": "python3\x00train.py\x00"}, "Out of memory: Killed process 4242 (python3) total-vm:1024kB", "python3 train.py"},
+		{"name in kill line", nil, "Out of memory: Killed process 4242 (python3) total-vm:1024kB", "[python3]"},
+		{"placeholder", nil, "Out of memory: Killed process 4242 total-vm:1024kB", unknownProcess},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			events := detect(t, Options{ProcFS: []fs.FS{fakeProc(tt.proc)}}, "3,100,5000000,-;"+tt.line+"\n")
+			if len(events) != 1 {
+				t.Fatalf("detected %d events, want 1", len(events))
+			}
+			if events[0].Cmdline != tt.want || events[0].PID != "4242" {
+				t.Errorf("victim %s %q, want 4242 %q", events[0].PID, events[0].Cmdline, tt.want)
+			}
+		})
+	}
+}
+
+func TestKmsgReaderReopensAfterReadError(t *testing.T) {
+	r1, w1 := io.Pipe()
+	r2, w2 := io.Pipe()
+	files := make(chan io.ReadSeekCloser, 2)
+	files <- pipeKmsg{r1}
+	files <- pipeKmsg{r2}
+	reader, err := newKmsgReader(func() (io.ReadSeekCloser, error) {
+		select {
+		case file := <-files:
+			return file, nil
+		default:
+			return nil, errors.New("no kmsg left")
+		}
+	}, false)
+	if err != nil {
+		t.Fatalf("newKmsgReader: %v", err)
+	}
+	defer reader.Close()
+
+	next := func() KmsgEntry {
+		t.Helper()
+		select {
+		case entry := <-reader.Entries():
+			return entry
+		case <-time.After(3 * kmsgReopenDelay):
+			t.Fatal("no entry delivered")
+			return KmsgEntry{}
+		}
+	}
+
+	fmt.Fprintf(w1, "6,1,5000000,-;before the error\n")
+	if entry := next(); entry.SequenceNum != 1 {
+		t.Fatalf("first entry %d, want 1", entry.SequenceNum)
+	}
+	w1.CloseWithError(errors.New("read error"))
+
+	// The reopened log starts at the oldest buffered record, the ones
+	// already read are skipped
+	go func() {
+		fmt.Fprintf(w2, "6,1,5000000,-;before the error\n")
+		fmt.Fprintf(w2, "6,2,5000100,-;after reopening\n")
+	}()
+	if entry := next(); entry.SequenceNum != 2 || entry.Message != "after reopening" {
+		t.Errorf("entry %d %q after reopening, want only the new record", entry.SequenceNum, entry.Message)
+	}
+}
+
+// useDetectionPatterns sets the detection patterns for the duration of the
+// test.
+func useDetectionPatterns(t *testing.T, oom, pid string) {
+	t.Helper()
+	if err := SetDetectionPatterns(oom, pid); err != nil {
+		t.Fatalf("SetDetectionPatterns: %v", err)
+	}
+	t.Cleanup(func() { SetDetectionPatterns(DefaultOOMPattern, DefaultPIDPattern) })
+}
+
+func TestCustomDetectionPatterns(t *testing.T) {
+	useDetectionPatterns(t, `(?i)oom killer terminated`, `terminated task (\d+)`)
+	events := detect(t, Options{ProcFS: []fs.FS{fakeProc(map[string]string{"4242": "java\x00-jar\x00app.jar\x00"})}},
+		"3,100,5000000,-;OOM killer terminated task 4242 in /kubepods/pod1\n"+
+			"3,101,6000000,-;Out of memory: Killed process 4343 (stress) total-vm:1024kB\n")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want only the custom wording", len(events))
+	}
+	if events[0].PID != "4242" || events[0].Cmdline != "java -jar app.jar" {
+		t.Errorf("victim %s %q, want 4242 java -jar app.jar", events[0].PID, events[0].Cmdline)
+	}
+}
+
+func TestDefaultDetectionPatterns(t *testing.T) {
+	for _, line := range []string{
+		"Out of memory: Killed process 4242 (stress) total-vm:1024kB",
+		"Memory cgroup out of memory: Killed process 4242 (stress) total-vm:1024kB",
+		"Out of memory: Kill process 4242 (stress) score 912 or sacrifice child",
+	} {
+		events := detect(t, Options{}, "3,100,5000000,-;"+line+"\n")
+		if len(events) != 1 || events[0].PID != "4242" {
+			t.Errorf("%q detected as %+v, want the kill of PID 4242", line, events)
+		}
+	}
+}
+
+func TestSetDetectionPatternsRejectsInvalidPatterns(t *testing.T) {
+	for _, tt := range []struct{ oom, pid, want string }{
+		{"[", DefaultPIDPattern, "invalid OOM pattern"},
+		{DefaultOOMPattern, "(", "invalid PID pattern"},
+		{DefaultOOMPattern, `killed process \d+`, "has no capture group"},
+	} {
+		err := SetDetectionPatterns(tt.oom, tt.pid)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("SetDetectionPatterns(%q, %q) = %v, want %q", tt.oom, tt.pid, err, tt.want)
+		}
+	}
+	if oomPattern.String() != DefaultOOMPattern || pidPattern.String() != DefaultPIDPattern {
+		t.Errorf("patterns %q and %q after failed updates, want the defaults kept", oomPattern, pidPattern)
+	}
+}
+
+func TestNextRefreshDelay(t *testing.T) {
+	const interval = 10 * time.Second
+	for _, tt := range []struct {
+		delay, took, want time.Duration
+	}{
+		{interval, time.Second, interval},
+		{interval, 3 * time.Second, 2 * interval},
+		{2 * interval, 3 * time.Second, 4 * interval},
+		{8 * interval, 5 * time.Second, 8 * interval},
+		{8 * interval, time.Second, 4 * interval},
+		{interval, interval / refreshSlowFraction, interval},
+	} {
+		if got := nextRefreshDelay(tt.delay, interval, tt.took); got != tt.want {
+			t.Errorf("nextRefreshDelay(%v, %v, %v) = %v, want %v", tt.delay, interval, tt.took, got, tt.want)
+		}
+	}
+}
+
+func TestSlowRefreshesBackOff(t *testing.T) {
+	// Each scan takes longer than a quarter of the 20ms interval
+	procFS := &scanCountFS{FS: fakeProc(map[string]string{"1": "init\x00"}), delay: 10 * time.Millisecond}
+	reader, _ := newPipeKmsgReader(t)
+	m, err := NewOOMMonitor(Options{
+		Source:          reader,
+		ProcFS:          []fs.FS{procFS},
+		CheckInterval:   time.Second,
+		RefreshInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Start(ctx, make(chan OOMEventData, 1))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Duration(m.refreshDelay.Load()) < refreshMaxBackoff*20*time.Millisecond {
+		if time.Now().After(deadline) {
+			t.Fatalf("refresh delay %v, want it backed off to %v", time.Duration(m.refreshDelay.Load()), refreshMaxBackoff*20*time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := m.Ready(); err != nil {
+		t.Errorf("Ready = %v while refreshes are backed off", err)
+	}
+}
+
+// bufferedReader returns a reader whose buffer holds entries, numbered by
+// seqs, as if read from the kernel log in that order.
+func bufferedReader(seqs []uint64, messages []string) *KmsgReader {
+	k := &KmsgReader{entryBuffer: make(chan KmsgEntry, 100), done: make(chan struct{})}
+	for i, seq := range seqs {
+		k.entryBuffer <- KmsgEntry{SequenceNum: seq, Timestamp: 5000000 + seq, Message: messages[i]}
+	}
+	return k
+}
+
+// sequence returns the sequence numbers of entries.
+func sequence(entries []KmsgEntry) []uint64 {
+	var seqs []uint64
+	for _, entry := range entries {
+		seqs = append(seqs, entry.SequenceNum)
+	}
+	return seqs
+}
+
+func TestReadOrderedEntriesSortsBySequence(t *testing.T) {
+	k := bufferedReader([]uint64{3, 1, 4, 2}, []string{"c", "a", "d", "b"})
+	entries, err := k.ReadOrderedEntries()
+	if err != nil {
+		t.Fatalf("ReadOrderedEntries: %v", err)
+	}
+	if got := sequence(entries); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4}) {
+		t.Errorf("sequence %v, want 1 to 4", got)
+	}
+	if entries[0].Message != "a" || entries[3].Message != "d" {
+		t.Errorf("entries %+v, want the messages kept with their numbers", entries)
+	}
+}
+
+func TestReadOrderedEntriesWaitsForKillLine(t *testing.T) {
+	// The report's kill line is still to come, behind an entry read late
+	k := bufferedReader([]uint64{11, 10}, []string{"Mem-Info:", "stress invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0"})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		k.entryBuffer <- KmsgEntry{SequenceNum: 12, Message: "Free swap  = 0kB"}
+		time.Sleep(50 * time.Millisecond)
+		k.entryBuffer <- KmsgEntry{SequenceNum: 13, Message: killLine}
+	}()
+
+	entries, err := k.ReadOrderedEntries()
+	if err != nil {
+		t.Fatalf("ReadOrderedEntries: %v", err)
+	}
+	if got := sequence(entries); !reflect.DeepEqual(got, []uint64{10, 11, 12, 13}) {
+		t.Errorf("sequence %v, want the whole report in order", got)
+	}
+}
+
+func TestReadOrderedEntriesReturnsCompleteReports(t *testing.T) {
+	k := bufferedReader([]uint64{22, 20, 21, 23}, []string{
+		killLine,
+		"stress invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0",
+		"Mem-Info:",
+		"oom_reaper: reaped process 4242 (stress), now anon-rss:0kB, file-rss:0kB, shmem-rss:0kB",
+	})
+	start := time.Now()
+	entries, err := k.ReadOrderedEntries()
+	if err != nil {
+		t.Fatalf("ReadOrderedEntries: %v", err)
+	}
+	if got := sequence(entries); !reflect.DeepEqual(got, []uint64{20, 21, 22, 23}) {
+		t.Errorf("sequence %v, want 20 to 23", got)
+	}
+	if took := time.Since(start); took >= orderedReportWait {
+		t.Errorf("waited %v for a report already complete", took)
+	}
+}
+
+func TestReadOrderedEntriesGivesUpOnIncompleteReport(t *testing.T) {
+	report := []string{"stress invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0", "Mem-Info:"}
+
+	start := time.Now()
+	entries, err := bufferedReader([]uint64{30, 31}, report).ReadOrderedEntries()
+	if err != nil {
+		t.Fatalf("ReadOrderedEntries: %v", err)
+	}
+	if got := sequence(entries); !reflect.DeepEqual(got, []uint64{30, 31}) {
+		t.Errorf("sequence %v, want the report as far as it got", got)
+	}
+	if took := time.Since(start); took < orderedReportWait || took > 2*time.Second {
+		t.Errorf("returned after %v, want after %v", took, orderedReportWait)
+	}
+
+	// Closing the reader ends the wait
+	closed := bufferedReader([]uint64{30, 31}, report)
+	close(closed.done)
+	start = time.Now()
+	if entries, _ := closed.ReadOrderedEntries(); len(entries) != 2 || time.Since(start) >= orderedReportWait {
+		t.Errorf("closed reader returned %d entries after %v, want 2 at once", len(entries), time.Since(start))
+	}
+}
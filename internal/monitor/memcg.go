@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// OOM types distinguishing cgroup limit kills from system-wide ones.
+const (
+	OOMTypeGlobal = "global"
+	OOMTypeMemcg  = "memcg"
+)
+
+// constraintWindow is how long, in kernel microseconds, an OOM constraint
+// line is considered part of the kill that follows it.
+const constraintWindow = 10 * 1000 * 1000
+
+var (
+	// Kill line of a cgroup OOM, e.g. "Memory cgroup out of memory: Killed process 1234 (java) ..."
+	memcgKillPattern = regexp.MustCompile(`(?i)memory cgroup out of memory`)
+
+	// Older kernels name the cgroup whose limit was hit in
+	// "Task in /kubepods/pod1/c1 killed as a result of limit of /kubepods/pod1".
+	memcgLimitPattern = regexp.MustCompile(`(?:Task in (/\S*) )?killed as a result of limit of (/\S*)`)
+
+	// Newer kernels log "oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,
+	// oom_memcg=/kubepods/pod1,task_memcg=/kubepods/pod1/c1,task=java,pid=1234,uid=1000".
+	oomKillPattern = regexp.MustCompile(`oom-kill:(constraint=\S+)`)
+)
+
+type oomConstraint struct {
+	// constraint is the kernel's CONSTRAINT_* value without its prefix,
+	// lowercased, e.g. "memcg" or "cpuset". It is empty on older kernels.
+	constraint string
+	memcg      bool
+	cgroup     string
+	taskCgroup string
+
+	// task, pid and uid describe the victim, from the oom-kill line.
+	task string
+	pid  int
+	uid  string
+
+	timestamp uint64
+}
+
+// OOMType classifies an OOM kill line as a cgroup limit or a global OOM.
+func OOMType(message string) string {
+	if memcgKillPattern.MatchString(message) {
+		return OOMTypeMemcg
+	}
+	return OOMTypeGlobal
+}
+
+// recordOOMConstraint remembers the constraint and limiting cgroup logged in
+// an OOM report so they can be attached to the kill that ends it.
+func (m *OOMMonitor) recordOOMConstraint(entry KmsgEntry) {
+	var constraint *oomConstraint
+
+	if fields := ParseOOMKill(entry.Message); fields != nil {
+		constraint = &oomConstraint{
+			constraint: strings.ToLower(strings.TrimPrefix(fields["constraint"], "CONSTRAINT_")),
+			cgroup:     fields["oom_memcg"],
+			taskCgroup: fields["task_memcg"],
+			task:       fields["task"],
+			uid:        fields["uid"],
+		}
+		constraint.memcg = constraint.constraint == "memcg"
+		constraint.pid, _ = strconv.Atoi(fields["pid"])
+	} else if matches := memcgLimitPattern.FindStringSubmatch(entry.Message); matches != nil {
+		constraint = &oomConstraint{memcg: true, cgroup: matches[2], taskCgroup: matches[1]}
+	} else {
+		return
+	}
+
+	constraint.timestamp = entry.Timestamp
+	logger.Debug("OOM constraint: constraint=%s, memcg=%t, cgroup=%s, task cgroup=%s, pid=%d",
+		constraint.constraint, constraint.memcg, constraint.cgroup, constraint.taskCgroup, constraint.pid)
+	m.constraint = constraint
+}
+
+// takeOOMConstraint returns the constraint preceding an OOM kill logged at
+// timestamp, if any, and forgets it.
+func (m *OOMMonitor) takeOOMConstraint(timestamp uint64) *oomConstraint {
+	constraint := m.constraint
+	m.constraint = nil
+
+	if constraint == nil || timestamp < constraint.timestamp || timestamp-constraint.timestamp > constraintWindow {
+		return nil
+	}
+	return constraint
+}
+
+// ParseOOMKill returns the key=value fields of the structured
+// "oom-kill:constraint=...,task=foo,pid=1234,uid=0" line logged by newer
+// kernels before the kill, or nil for any other message. Values cannot
+// contain commas, except nodemask which may list node ranges.
+func ParseOOMKill(message string) map[string]string {
+	matches := oomKillPattern.FindStringSubmatch(message)
+	if matches == nil {
+		return nil
+	}
+
+	fields := make(map[string]string)
+	var last string
+	for _, part := range strings.Split(matches[1], ",") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			// A nodemask such as "0-1,3" continues the previous value
+			if last != "" {
+				fields[last] += "," + part
+			}
+			continue
+		}
+		fields[key] = value
+		last = key
+	}
+	return fields
+}
@@ -0,0 +1,119 @@
+package monitor
+
+import "testing"
+
+func TestOOMType(t *testing.T) {
+	for message, want := range map[string]string{
+		"Memory cgroup out of memory: Killed process 4242 (java) total-vm:2048kB, anon-rss:1024kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:0kB oom_score_adj:999": OOMTypeMemcg,
+		"Out of memory: Killed process 4242 (java) total-vm:2048kB, anon-rss:1024kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:0kB oom_score_adj:0":                 OOMTypeGlobal,
+	} {
+		if got := OOMType(message); got != want {
+			t.Errorf("OOMType(%q) = %s, want %s", message, got, want)
+		}
+	}
+}
+
+func TestDetectGlobalAndMemcgKills(t *testing.T) {
+	for _, tt := range []struct {
+		name, recording             string
+		oomType, cgroup, taskCgroup string
+	}{
+		{
+			"global",
+			`6,100,5000000,-;stress invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0
+6,101,5000100,-;oom-kill:constraint=CONSTRAINT_NONE,nodemask=(null),cpuset=/,mems_allowed=0,global_oom,task_memcg=/user.slice,task=stress,pid=4242,uid=0
+3,102,5000200,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0
+`,
+			OOMTypeGlobal, "", "/user.slice",
+		},
+		{
+			"memcg with oom-kill line",
+			`6,100,5000000,-;java invoked oom-killer: gfp_mask=0xcc0(GFP_KERNEL), order=0, oom_score_adj=999
+6,101,5000100,-;oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=abcd,mems_allowed=0,oom_memcg=/kubepods/burstable/pod1234,task_memcg=/kubepods/burstable/pod1234/abcd,task=java,pid=4242,uid=1000
+3,102,5000200,-;Memory cgroup out of memory: Killed process 4242 (java) total-vm:2048kB, anon-rss:1024kB, file-rss:0kB, shmem-rss:0kB, UID:1000 pgtables:0kB oom_score_adj:999
+`,
+			OOMTypeMemcg, "/kubepods/burstable/pod1234", "/kubepods/burstable/pod1234/abcd",
+		},
+		{
+			"memcg with limit wording of older kernels",
+			`6,100,5000000,-;java invoked oom-killer: gfp_mask=0x24000c0, order=0, oom_score_adj=999
+6,101,5000100,-;Task in /kubepods/burstable/pod1234/abcd killed as a result of limit of /kubepods/burstable/pod1234
+6,102,5000200,-;memory: usage 524288kB, limit 524288kB, failcnt 42
+3,103,5000300,-;Memory cgroup out of memory: Killed process 4242 (java) total-vm:2048kB, anon-rss:1024kB, file-rss:0kB, shmem-rss:0kB
+`,
+			OOMTypeMemcg, "/kubepods/burstable/pod1234", "/kubepods/burstable/pod1234/abcd",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			events := detect(t, Options{}, tt.recording)
+			if len(events) != 1 {
+				t.Fatalf("detected %d events, want 1", len(events))
+			}
+			event := events[0]
+			if event.OOMType != tt.oomType || event.Cgroup != tt.cgroup || event.TaskCgroup != tt.taskCgroup {
+				t.Errorf("OOMType %q, Cgroup %q, TaskCgroup %q, want %q, %q, %q",
+					event.OOMType, event.Cgroup, event.TaskCgroup, tt.oomType, tt.cgroup, tt.taskCgroup)
+			}
+		})
+	}
+}
+
+func TestParseOOMKill(t *testing.T) {
+	fields := ParseOOMKill("oom-kill:constraint=CONSTRAINT_CPUSET,nodemask=0-1,3,cpuset=/batch,mems_allowed=0-3,global_oom,task_memcg=/batch/job,task=worker,pid=4242,uid=1000")
+	for key, want := range map[string]string{
+		"constraint": "CONSTRAINT_CPUSET",
+		"nodemask":   "0-1,3",
+		"cpuset":     "/batch",
+		"task_memcg": "/batch/job",
+		"task":       "worker",
+		"pid":        "4242",
+		"uid":        "1000",
+	} {
+		if fields[key] != want {
+			t.Errorf("%s = %q, want %q", key, fields[key], want)
+		}
+	}
+
+	if fields := ParseOOMKill("Out of memory: Killed process 4242 (stress)"); fields != nil {
+		t.Errorf("ParseOOMKill of a kill line = %v, want nil", fields)
+	}
+}
+
+func TestDetectVictimFromOOMKillLine(t *testing.T) {
+	for _, tt := range []struct {
+		name, recording      string
+		pid, uid, constraint string
+	}{
+		{
+			"structured line",
+			`6,101,5000100,-;oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=/,mems_allowed=0,oom_memcg=/kubepods/pod1,task_memcg=/kubepods/pod1/c1,task=java,pid=4242,uid=1000
+3,102,5000200,-;Memory cgroup out of memory: Killed process 4242 (java) total-vm:2048kB, anon-rss:1024kB, file-rss:0kB, shmem-rss:0kB
+`,
+			"4242", "1000", "memcg",
+		},
+		{
+			// The kill line names another PID than the structured line
+			"structured line preferred over free text",
+			`6,101,5000100,-;oom-kill:constraint=CONSTRAINT_NONE,nodemask=(null),cpuset=/,mems_allowed=0,global_oom,task_memcg=/,task=stress,pid=4343,uid=0
+3,102,5000200,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB
+`,
+			"4343", "0", "none",
+		},
+		{
+			"free text of older kernels",
+			"3,102,5000200,-;" + killLine + "\n",
+			"4242", "0", "",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			events := detect(t, Options{}, tt.recording)
+			if len(events) != 1 {
+				t.Fatalf("detected %d events, want 1", len(events))
+			}
+			event := events[0]
+			if event.PID != tt.pid || event.UID != tt.uid || event.Constraint != tt.constraint {
+				t.Errorf("PID %q, UID %q, Constraint %q, want %q, %q, %q", event.PID, event.UID, event.Constraint, tt.pid, tt.uid, tt.constraint)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// PressureFile reports the memory pressure stall information (PSI) of the
+// whole system.
+const PressureFile = "/proc/pressure/memory"
+
+// pressurePollInterval is how often the pressure is read. The kernel
+// updates the averages every two seconds.
+const pressurePollInterval = 2 * time.Second
+
+// PSI lines of PressureFile: some counts the time at least one task was
+// stalled on memory, full the time all of them were.
+const (
+	PressureSome = "some"
+	PressureFull = "full"
+)
+
+// PressureWatcher warns of memory pressure before the OOM killer fires: it
+// raises an event when the avg10 of a PSI line stays at or above a
+// threshold for a sustained period. It warns again only once the pressure
+// dropped below the threshold in between.
+type PressureWatcher struct {
+	path      string
+	line      string
+	threshold float64
+	duration  time.Duration
+	// above is when the pressure last rose to the threshold, zero while it
+	// is below; alerted is set once it was reported.
+	above   time.Time
+	alerted bool
+	now     func() time.Time
+}
+
+// NewPressureWatcher creates a watcher of the PSI line, PressureSome or
+// PressureFull, of path, normally PressureFile. threshold is a percentage
+// of the time stalled, compared with the avg10 of the line, which must stay
+// at or above it for duration.
+func NewPressureWatcher(path, line string, threshold float64, duration time.Duration) (*PressureWatcher, error) {
+	w := &PressureWatcher{
+		path:      path,
+		line:      line,
+		threshold: threshold,
+		duration:  duration,
+		now:       time.Now,
+	}
+	if _, err := w.readPressure(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Start polls the pressure until ctx is cancelled, sending an event on
+// eventChan when it stayed above the threshold for the duration.
+func (w *PressureWatcher) Start(ctx context.Context, eventChan chan<- OOMEventData) {
+	ticker := time.NewTicker(pressurePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Debug("Stopping memory pressure watcher")
+			return
+		}
+
+		event, found := w.check()
+		if !found {
+			continue
+		}
+		select {
+		case eventChan <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check reads the pressure and returns an event when it has been above the
+// threshold for the duration and was not reported yet. A failed read keeps
+// the state of the last one.
+func (w *PressureWatcher) check() (OOMEventData, bool) {
+	avg10, err := w.readPressure()
+	if err != nil {
+		logger.Debug("Failed to read memory pressure: %v", err)
+		return OOMEventData{}, false
+	}
+	now := w.now()
+
+	if avg10[w.line] < w.threshold {
+		if w.alerted {
+			logger.Info("Memory pressure %s avg10 dropped to %.2f%%, below %g%%", w.line, avg10[w.line], w.threshold)
+		}
+		w.above = time.Time{}
+		w.alerted = false
+		return OOMEventData{}, false
+	}
+
+	if w.above.IsZero() {
+		w.above = now
+	}
+	if w.alerted || now.Sub(w.above) < w.duration {
+		return OOMEventData{}, false
+	}
+	w.alerted = true
+	logger.Warn("Memory pressure %s avg10 at %.2f%% for %v, threshold %g%%", w.line, avg10[w.line], now.Sub(w.above).Round(time.Second), w.threshold)
+	return w.newEvent(avg10, now.Sub(w.above)), true
+}
+
+func (w *PressureWatcher) newEvent(avg10 map[string]float64, sustained time.Duration) OOMEventData {
+	hostname, _ := os.Hostname()
+	fields := map[string]string{
+		"threshold": strconv.FormatFloat(w.threshold, 'f', -1, 64) + "%",
+		"sustained": sustained.Round(time.Second).String(),
+	}
+	for line, value := range avg10 {
+		fields[line+"_avg10"] = strconv.FormatFloat(value, 'f', 2, 64) + "%"
+	}
+	return OOMEventData{
+		Kind:     KindMemoryPressure,
+		Message:  fmt.Sprintf("memory pressure %s avg10 of %.2f%% at or above %g%% for %v", w.line, avg10[w.line], w.threshold, sustained.Round(time.Second)),
+		Hostname: hostname,
+		Kernel:   KernelVersion(),
+		Time:     time.Now().UnixMilli(),
+		Fields:   fields,
+	}
+}
+
+// readPressure returns the avg10 of each line of the PSI file.
+func (w *PressureWatcher) readPressure() (map[string]float64, error) {
+	file, err := os.Open(w.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s, PSI requires Linux 4.20 with CONFIG_PSI: %v", w.path, err)
+	}
+	defer file.Close()
+
+	// Lines are "some avg10=1.23 avg60=0.50 avg300=0.10 total=12345"
+	avg10 := make(map[string]float64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		for _, field := range fields[1:] {
+			value, found := strings.CutPrefix(field, "avg10=")
+			if !found {
+				continue
+			}
+			percent, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s avg10 in %s: %v", fields[0], w.path, err)
+			}
+			avg10[fields[0]] = percent
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", w.path, err)
+	}
+	if _, found := avg10[w.line]; !found {
+		return nil, fmt.Errorf("no %s line in %s", w.line, w.path)
+	}
+	return avg10, nil
+}
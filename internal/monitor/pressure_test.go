@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// psi returns the content of a PSI file with the avg10 of some and full.
+func psi(some, full string) string {
+	return "some avg10=" + some + " avg60=1.00 avg300=0.50 total=123456\n" +
+		"full avg10=" + full + " avg60=0.50 avg300=0.10 total=65432\n"
+}
+
+func TestPressureWatcherWarnsOfSustainedPressure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory")
+	if err := os.WriteFile(path, []byte(psi("0.00", "0.00")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewPressureWatcher(path, PressureSome, 10, 30*time.Second)
+	if err != nil {
+		t.Fatalf("NewPressureWatcher: %v", err)
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, step := range []struct {
+		after      time.Duration
+		some, full string
+		warns      bool
+	}{
+		{0, "5.00", "1.00", false},
+		{2 * time.Second, "20.00", "1.00", false},
+		{20 * time.Second, "25.00", "2.00", false},
+		// Sustained for 30s, full staying low does not matter for some
+		{32 * time.Second, "15.00", "2.00", true},
+		{40 * time.Second, "30.00", "5.00", false},
+		{50 * time.Second, "3.00", "0.00", false},
+		{60 * time.Second, "20.00", "0.00", false},
+		{90 * time.Second, "20.00", "0.00", true},
+	} {
+		if err := os.WriteFile(path, []byte(psi(step.some, step.full)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		w.now = func() time.Time { return start.Add(step.after) }
+		event, warns := w.check()
+		if warns != step.warns {
+			t.Errorf("at %v with some avg10 %s: warned %v, want %v", step.after, step.some, warns, step.warns)
+		}
+		if warns && event.Kind != KindMemoryPressure {
+			t.Errorf("at %v: event of kind %q, want %q", step.after, event.Kind, KindMemoryPressure)
+		}
+	}
+}
+
+func TestPressureEventFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory")
+	if err := os.WriteFile(path, []byte(psi("42.50", "12.25")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Without a duration the first reading at the threshold warns
+	w, err := NewPressureWatcher(path, PressureFull, 10, 0)
+	if err != nil {
+		t.Fatalf("NewPressureWatcher: %v", err)
+	}
+	event, warns := w.check()
+	if !warns {
+		t.Fatal("no warning for full avg10 above the threshold")
+	}
+	for name, want := range map[string]string{
+		"threshold":  "10%",
+		"sustained":  "0s",
+		"some_avg10": "42.50%",
+		"full_avg10": "12.25%",
+	} {
+		if got := event.Fields[name]; got != want {
+			t.Errorf("field %s = %q, want %q", name, got, want)
+		}
+	}
+	if !strings.Contains(event.Message, "memory pressure full avg10 of 12.25% at or above 10%") {
+		t.Errorf("Message = %q", event.Message)
+	}
+}
+
+func TestPressureWatcherRejectsUnreadablePressure(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"no full line":  "some avg10=1.00 avg60=1.00 avg300=0.50 total=123456\n",
+		"invalid avg10": "some avg10=lots avg60=1.00 avg300=0.50 total=1\nfull avg10=x avg60=0.50 avg300=0.10 total=1\n",
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-"))
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewPressureWatcher(path, PressureFull, 10, time.Minute); err == nil {
+			t.Errorf("%s: watcher created", name)
+		}
+	}
+	if _, err := NewPressureWatcher(filepath.Join(dir, "missing"), PressureSome, 10, time.Minute); err == nil || !strings.Contains(err.Error(), "CONFIG_PSI") {
+		t.Errorf("missing PSI file: %v, want an error naming the requirement", err)
+	}
+}
+
+func TestPressureWatcherKeepsStateOnFailedRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory")
+	if err := os.WriteFile(path, []byte(psi("50.00", "0.00")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewPressureWatcher(path, PressureSome, 10, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	w.now = func() time.Time { return start }
+	w.check()
+
+	os.Remove(path)
+	w.now = func() time.Time { return start.Add(5 * time.Second) }
+	if _, warns := w.check(); warns {
+		t.Error("warned without a reading")
+	}
+	if err := os.WriteFile(path, []byte(psi("50.00", "0.00")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	w.now = func() time.Time { return start.Add(10 * time.Second) }
+	if _, warns := w.check(); !warns {
+		t.Error("pressure sustained across a failed read did not warn")
+	}
+}
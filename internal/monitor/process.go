@@ -1,42 +1,122 @@
 package monitor
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
-	"path/filepath"
+	"os/user"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/oom-notifier/go/internal/logger"
 )
 
 type ProcessInfo struct {
-	PID     int
+	PID int
+	// Cmdline is the argv joined with spaces, arguments containing spaces
+	// quoted, or the comm name in brackets when FromComm is set.
 	Cmdline string
+	// Args is the argv, only kept when the cache keeps argument boundaries.
+	Args []string
+	// Name is the basename of the executable, or the comm name.
+	Name string
+	// FromComm is set for processes without a command line, kernel threads
+	// and exiting processes, which are named after their comm.
+	FromComm bool
+	Env      map[string]string
+	PPID     int
+	RSS      int64 // resident set size in kB
+	// UID is the real UID of the owner, empty when the status could not
+	// be read.
+	UID string
 }
 
+// ErrProcessNotFound is returned by ResolveProcess and ReadProcess for a
+// process that is neither cached nor readable from /proc.
+var ErrProcessNotFound = errors.New("process not found")
+
+// ProcessCache caches the processes of one or more trees laid out like
+// /proc, e.g. the host's and those of other PID namespaces. The trees are
+// consulted in order and a PID is resolved in the first tree knowing it.
 type ProcessCache struct {
-	cache   *lru.Cache[int, string]
-	mu      sync.RWMutex
-	procDir string
+	trees []procTree
+	// pidMaxes are the pid_max the cache of each tree is sized for, grown
+	// by Refresh when pid_max is raised at runtime.
+	pidMaxes   []int
+	mu         sync.RWMutex
+	captureEnv []string
+	keepArgs   bool
+
+	// topN processes by RSS from the last refresh are kept in top, plus
+	// one so that leaving out the victim still reports topN.
+	topN int
+	top  []ProcessInfo
+
+	// refreshMu guards the scan in flight and the start of the last one,
+	// see Refresh.
+	refreshMu   sync.Mutex
+	inflight    *refreshCall
+	lastScan    time.Time
+	minInterval time.Duration
+}
+
+// refreshCall is a full scan in flight, whose result is shared by the
+// Refresh calls made while it runs.
+type refreshCall struct {
+	done chan struct{}
+	err  error
 }
 
-func NewProcessCache(procDir string) (*ProcessCache, error) {
-	// Get system's pid_max
-	pidMax := getPIDMax()
-	logger.Debug("Creating ProcessCache with pid_max=%d, procDir=%s", pidMax, procDir)
+// procTree is a proc tree and the processes cached from it. PIDs are only
+// unique within a tree, so each tree has its own cache.
+type procTree struct {
+	procFS fs.FS
+	cache  *lru.Cache[int, ProcessInfo]
+}
 
-	cache, err := lru.New[int, string](pidMax)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create LRU cache: %v", err)
+// NewProcessCache creates a cache of running processes read from procDirs,
+// consulted in order. captureEnv lists the environment variables to record
+// for each process; all others are ignored. keepArgs also stores each
+// process's argv with its argument boundaries. topN is the number of largest
+// processes by RSS reported by TopConsumers, 0 disables the snapshot.
+func NewProcessCache(procDirs []string, captureEnv []string, keepArgs bool, topN int) (*ProcessCache, error) {
+	logger.Debug("Creating ProcessCache with procDirs=%v", procDirs)
+	var procFSs []fs.FS
+	for _, procDir := range procDirs {
+		procFSs = append(procFSs, os.DirFS(procDir))
+	}
+	return NewProcessCacheFS(procFSs, captureEnv, keepArgs, topN)
+}
+
+// NewProcessCacheFS creates a process cache reading from procFSs, trees laid
+// out like /proc. Tests use it with in-memory trees.
+func NewProcessCacheFS(procFSs []fs.FS, captureEnv []string, keepArgs bool, topN int) (*ProcessCache, error) {
+	if len(procFSs) == 0 {
+		return nil, fmt.Errorf("no proc directory to read processes from")
 	}
 
 	pc := &ProcessCache{
-		cache:   cache,
-		procDir: procDir,
+		captureEnv: captureEnv,
+		keepArgs:   keepArgs,
+		topN:       topN,
+	}
+	for _, procFS := range procFSs {
+		// One slot per possible PID of each tree, see add
+		pidMax := getPIDMax(procFS)
+		logger.Debug("Creating ProcessCache with pid_max=%d, captureEnv=%v", pidMax, captureEnv)
+
+		cache, err := lru.New[int, ProcessInfo](pidMax)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create LRU cache: %v", err)
+		}
+		pc.trees = append(pc.trees, procTree{procFS: procFS, cache: cache})
+		pc.pidMaxes = append(pc.pidMaxes, pidMax)
 	}
 
 	// Initial population
@@ -48,43 +128,503 @@ func NewProcessCache(procDir string) (*ProcessCache, error) {
 	return pc, nil
 }
 
+// SetMinRefreshInterval makes Refresh skip the scans started less than d
+// after the previous one, 0 scans every time.
+func (pc *ProcessCache) SetMinRefreshInterval(d time.Duration) {
+	pc.refreshMu.Lock()
+	defer pc.refreshMu.Unlock()
+	pc.minInterval = d
+}
+
+// Refresh reads the processes of every tree, so that a burst of refreshes
+// does not hammer /proc. Calls made while a scan runs wait for it and share
+// its result instead of starting another one, and calls within the minimum
+// interval of the previous scan, see SetMinRefreshInterval, return nil
+// right away.
 func (pc *ProcessCache) Refresh() error {
+	pc.refreshMu.Lock()
+	if call := pc.inflight; call != nil {
+		pc.refreshMu.Unlock()
+		logger.Debug("Process cache refresh already running, waiting for it")
+		<-call.done
+		return call.err
+	}
+	if since := time.Since(pc.lastScan); !pc.lastScan.IsZero() && since < pc.minInterval {
+		pc.refreshMu.Unlock()
+		logger.Debug("Skipping process cache refresh, the last one started %v ago", since.Round(time.Millisecond))
+		return nil
+	}
+	call := &refreshCall{done: make(chan struct{})}
+	pc.inflight = call
+	pc.lastScan = time.Now()
+	pc.refreshMu.Unlock()
+
+	call.err = pc.scan()
+
+	pc.refreshMu.Lock()
+	pc.inflight = nil
+	pc.refreshMu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+// scan reads the processes of every tree. The top consumers are taken from
+// the first tree, which usually sees every process, so that a process
+// visible in several namespaces is not listed twice.
+func (pc *ProcessCache) scan() error {
 	logger.Debug("Starting process cache refresh")
-	processes, err := getAllProcesses(pc.procDir)
-	if err != nil {
-		logger.Error("Failed to get processes: %v", err)
-		return err
+	all := make([][]ProcessInfo, len(pc.trees))
+	for i, tree := range pc.trees {
+		processes, err := getAllProcesses(tree.procFS, pc.captureEnv, pc.keepArgs)
+		if err != nil {
+			return err
+		}
+		all[i] = processes
 	}
 
 	pc.mu.Lock()
 	defer pc.mu.Unlock()
 
-	for _, proc := range processes {
-		pc.cache.Add(proc.PID, proc.Cmdline)
+	count := 0
+	for i, processes := range all {
+		pc.growToPIDMax(i)
+		for _, proc := range processes {
+			pc.trees[i].add(proc)
+		}
+		count += len(processes)
+	}
+	if pc.topN > 0 {
+		pc.top = topConsumers(all[0], pc.topN+1)
 	}
 
-	logger.Debug("Process cache refreshed with %d processes", len(processes))
+	logger.Debug("Process cache refreshed with %d processes", count)
 	return nil
 }
 
+// growToPIDMax grows the cache of tree i when its pid_max was raised since
+// the cache was sized, so that every PID keeps its slot, see add. A lowered
+// pid_max keeps the size, processes above it may still be running. The
+// caller must hold mu.
+func (pc *ProcessCache) growToPIDMax(i int) {
+	pidMax := getPIDMax(pc.trees[i].procFS)
+	if pidMax <= pc.pidMaxes[i] {
+		return
+	}
+	logger.Info("pid_max raised from %d to %d, growing the process cache", pc.pidMaxes[i], pidMax)
+	pc.trees[i].cache.Resize(pidMax)
+	pc.pidMaxes[i] = pidMax
+}
+
+// ScanNew adds the processes started since the last scan, reading only
+// their command line, so that short-lived processes are known before they
+// are killed. Processes already cached are skipped; Refresh fills in the
+// rest of their details. It returns the number of processes added.
+func (pc *ProcessCache) ScanNew() (int, error) {
+	added := 0
+	for _, tree := range pc.trees {
+		n, err := pc.scanTree(tree)
+		if err != nil {
+			return added, err
+		}
+		added += n
+	}
+
+	if added > 0 {
+		logger.Debug("Process scan added %d new processes", added)
+	}
+	return added, nil
+}
+
+func (pc *ProcessCache) scanTree(tree procTree) (int, error) {
+	entries, err := fs.ReadDir(tree.procFS, ".")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read proc directory: %v", err)
+	}
+
+	var pids []int
+	pc.mu.RLock()
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if !tree.cache.Contains(pid) {
+			pids = append(pids, pid)
+		}
+	}
+	pc.mu.RUnlock()
+
+	added := 0
+	for _, pid := range pids {
+		info, found := pc.readCmdline(pid, tree)
+		if !found {
+			continue
+		}
+
+		pc.mu.Lock()
+		// A refresh may have cached it in the meantime, with more details
+		if ok, _ := tree.cache.ContainsOrAdd(pid, info); !ok {
+			added++
+		}
+		pc.mu.Unlock()
+	}
+	return added, nil
+}
+
+// readCmdline reads only the command line of pid from tree, found is false
+// when the process is not in it.
+func (pc *ProcessCache) readCmdline(pid int, tree procTree) (ProcessInfo, bool) {
+	cmd := getProcessCmdline(pid, tree.procFS)
+	if cmd.cmdline == "" {
+		return ProcessInfo{}, false
+	}
+	info := ProcessInfo{
+		PID:      pid,
+		Cmdline:  cmd.cmdline,
+		Name:     cmd.name,
+		FromComm: cmd.fromComm,
+	}
+	if pc.keepArgs {
+		info.Args = cmd.args
+	}
+	return info, true
+}
+
+// add caches proc, replacing the entry for its PID. Entries of processes
+// that have exited are never removed: with one slot per possible PID the
+// cache only forgets a process when its PID is reused, so the victim of a
+// kill is still known after it is gone. The command line of a process is
+// kept when it is exiting, since the kernel has then released its argv and
+// only its comm name can be read.
+func (t procTree) add(proc ProcessInfo) {
+	if proc.FromComm {
+		if cached, found := t.cache.Peek(proc.PID); found && !cached.FromComm && sameComm(cached.Name, proc.Name) {
+			proc.Cmdline = cached.Cmdline
+			proc.Args = cached.Args
+			proc.Name = cached.Name
+			proc.FromComm = false
+		}
+	}
+	t.cache.Add(proc.PID, proc)
+}
+
+// sameComm reports whether comm, the kernel's name of a process truncated
+// to 15 bytes, matches the executable name.
+func sameComm(name, comm string) bool {
+	const maxComm = 15
+	if len(name) > maxComm {
+		name = name[:maxComm]
+	}
+	return name == comm
+}
+
+// Len returns the number of cached processes, over all trees.
+func (pc *ProcessCache) Len() int {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	n := 0
+	for _, tree := range pc.trees {
+		n += tree.cache.Len()
+	}
+	return n
+}
+
+// Entries returns the cached processes of each tree, in the order of the
+// trees and by PID within each. Looking them up does not count as a use of
+// the entries.
+func (pc *ProcessCache) Entries() [][]ProcessInfo {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	entries := make([][]ProcessInfo, len(pc.trees))
+	for i, tree := range pc.trees {
+		for _, pid := range tree.cache.Keys() {
+			if info, found := tree.cache.Peek(pid); found {
+				entries[i] = append(entries[i], info)
+			}
+		}
+		sort.Slice(entries[i], func(a, b int) bool { return entries[i][a].PID < entries[i][b].PID })
+	}
+	return entries
+}
+
+// TopConsumers returns the largest processes by RSS as of the last refresh,
+// largest first, leaving out the process exclude.
+func (pc *ProcessCache) TopConsumers(exclude int) []ProcessInfo {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	var top []ProcessInfo
+	for _, proc := range pc.top {
+		if proc.PID != exclude && len(top) < pc.topN {
+			top = append(top, proc)
+		}
+	}
+	return top
+}
+
+// lookup returns the cached process pid from the first tree knowing it.
+// The caller holds pc.mu.
+func (pc *ProcessCache) lookup(pid int) (ProcessInfo, bool) {
+	for _, tree := range pc.trees {
+		if info, found := tree.cache.Get(pid); found {
+			return info, true
+		}
+	}
+	return ProcessInfo{}, false
+}
+
+// ResolveProcess returns what is known about a process. Cached entries
+// are completed with the owner, parent PID and RSS read directly while the
+// process still exists, since the lightweight scan caches only the command
+// line. On a cache miss the process is read directly from /proc as a last
+// chance and cached. The error wraps ErrProcessNotFound when the process is
+// gone.
+func (pc *ProcessCache) ResolveProcess(pid int) (ProcessInfo, error) {
+	pc.mu.RLock()
+	for _, tree := range pc.trees {
+		if info, found := tree.cache.Get(pid); found {
+			pc.mu.RUnlock()
+			if status := getProcessStatus(pid, tree.procFS); status.uid != "" {
+				info.UID, info.PPID, info.RSS = status.uid, status.ppid, status.rss
+			}
+			logger.Debug("Found process PID %d: %s", pid, info.Cmdline)
+			return info, nil
+		}
+	}
+	pc.mu.RUnlock()
+
+	// A process started since the last scan may still be exiting, its
+	// comm is readable until it is reaped
+	for _, tree := range pc.trees {
+		if info, found := readProcess(pid, tree.procFS, pc.captureEnv, pc.keepArgs); found {
+			pc.mu.Lock()
+			tree.add(info)
+			pc.mu.Unlock()
+			logger.Debug("Process PID %d not found in cache, read it directly: %s", pid, info.Cmdline)
+			return info, nil
+		}
+	}
+
+	logger.Debug("Process PID %d not found in cache", pid)
+	return ProcessInfo{}, fmt.Errorf("PID %d: %w", pid, ErrProcessNotFound)
+}
+
+// GetCommandLine returns the command line of a process, see
+// ResolveProcess, or "" when the process is gone.
 func (pc *ProcessCache) GetCommandLine(pid int) string {
+	info, err := pc.ResolveProcess(pid)
+	if err != nil {
+		return ""
+	}
+	return info.Cmdline
+}
+
+// GetArgs returns the argv of a process, or nil when argument boundaries are
+// not kept or the process is unknown.
+func (pc *ProcessCache) GetArgs(pid int) []string {
+	if !pc.keepArgs {
+		return nil
+	}
+
 	pc.mu.RLock()
 	defer pc.mu.RUnlock()
 
-	cmdline, found := pc.cache.Get(pid)
+	info, found := pc.lookup(pid)
 	if !found {
-		logger.Debug("Process PID %d not found in cache", pid)
+		return nil
+	}
+	return info.Args
+}
+
+// GetEnv returns the captured environment variables for a process. The
+// process is read directly first since it may still be exiting, falling back
+// to the values recorded at the last refresh.
+func (pc *ProcessCache) GetEnv(pid int) map[string]string {
+	if len(pc.captureEnv) == 0 {
+		return nil
+	}
+
+	for _, tree := range pc.trees {
+		if env := getProcessEnv(pid, tree.procFS, pc.captureEnv); len(env) > 0 {
+			return env
+		}
+	}
+
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	info, found := pc.lookup(pid)
+	if !found {
+		return nil
+	}
+	return info.Env
+}
+
+// GetUser returns the real UID of a process and the matching username. The
+// process is read directly, so both are empty once it has exited. The
+// username is empty when the UID has no passwd entry.
+func (pc *ProcessCache) GetUser(pid int) (string, string) {
+	for _, tree := range pc.trees {
+		if uid := getProcessStatus(pid, tree.procFS).uid; uid != "" {
+			return uid, lookupUsername(uid)
+		}
+	}
+	return "", ""
+}
+
+// GetParent returns the parent PID of a process and the parent's command
+// line. The parent PID is read directly, falling back to the value recorded
+// at the last refresh; the command line is empty when the parent is unknown
+// to the cache. Parent PIDs are resolved in the tree the process was found
+// in. The PID is 0 when neither is available.
+func (pc *ProcessCache) GetParent(pid int) (int, string) {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	for _, tree := range pc.trees {
+		ppid := getProcessStatus(pid, tree.procFS).ppid
+		if ppid == 0 {
+			if info, found := tree.cache.Get(pid); found {
+				ppid = info.PPID
+			}
+		}
+		if ppid == 0 {
+			continue
+		}
+
+		parent, found := tree.cache.Get(ppid)
+		if !found {
+			return ppid, ""
+		}
+		return ppid, parent.Cmdline
+	}
+	return 0, ""
+}
+
+// GetAncestry returns the names of a process and its ancestors up to depth
+// levels, outermost first and ending with the process itself, e.g.
+// systemd, supervisord, gunicorn, worker. Like GetParent, parent PIDs are
+// read directly with the value recorded at the last refresh as fallback,
+// and resolved in the tree the process was found in. An ancestor whose
+// name is unknown to the cache and /proc is listed as "PID N" and ends the
+// chain, as does a PID seen before, so that stale parent PIDs cannot loop.
+// The result is nil when the process itself is unknown.
+func (pc *ProcessCache) GetAncestry(pid, depth int) []string {
+	pc.mu.RLock()
+	defer pc.mu.RUnlock()
+
+	for _, tree := range pc.trees {
+		name, ppid, found := tree.lookupAncestor(pid)
+		if !found {
+			continue
+		}
+
+		chain := []string{name}
+		seen := map[int]bool{pid: true}
+		for len(chain) <= depth && ppid > 0 && !seen[ppid] {
+			seen[ppid] = true
+			parent := ppid
+			if name, ppid, found = tree.lookupAncestor(parent); !found {
+				chain = append(chain, fmt.Sprintf("PID %d", parent))
+				break
+			}
+			chain = append(chain, name)
+		}
+
+		for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+			chain[i], chain[j] = chain[j], chain[i]
+		}
+		return chain
+	}
+	return nil
+}
+
+// lookupAncestor returns the name and parent PID of pid for GetAncestry,
+// found is false when the process is neither cached nor in the tree.
+func (t procTree) lookupAncestor(pid int) (string, int, bool) {
+	ppid := getProcessStatus(pid, t.procFS).ppid
+	if info, found := t.cache.Get(pid); found {
+		if ppid == 0 {
+			ppid = info.PPID
+		}
+		return info.Name, ppid, true
+	}
+	cmd := getProcessCmdline(pid, t.procFS)
+	return cmd.name, ppid, cmd.cmdline != ""
+}
+
+// GetOOMScore returns the badness score of a process from
+// /proc/<pid>/oom_score, read directly like GetCgroup, or "" once the process
+// has exited.
+func (pc *ProcessCache) GetOOMScore(pid int) string {
+	for _, tree := range pc.trees {
+		if data, err := fs.ReadFile(tree.procFS, path.Join(strconv.Itoa(pid), "oom_score")); err == nil {
+			return strings.TrimSpace(string(data))
+		}
+	}
+	return ""
+}
+
+// GetCgroup returns the cgroup of a process from /proc/<pid>/cgroup: the
+// cgroup v2 path, or the memory controller's path on cgroup v1. It is read
+// directly from the first tree with the process, so it is empty once the
+// process has exited.
+func (pc *ProcessCache) GetCgroup(pid int) string {
+	var data []byte
+	for _, tree := range pc.trees {
+		var err error
+		if data, err = fs.ReadFile(tree.procFS, path.Join(strconv.Itoa(pid), "cgroup")); err == nil {
+			break
+		}
+	}
+	if data == nil {
 		return ""
 	}
 
-	logger.Debug("Found process PID %d: %s", pid, cmdline)
-	return cmdline
+	// Lines are "hierarchy-ID:controllers:path"; v2 has ID 0 and no controllers
+	var cgroup string
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" && cgroup == "" {
+			cgroup = parts[2]
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			if controller == "memory" {
+				return parts[2]
+			}
+		}
+	}
+	return cgroup
 }
 
-func getAllProcesses(procDir string) ([]ProcessInfo, error) {
-	entries, err := os.ReadDir(procDir)
+// topConsumers returns up to n processes with the largest RSS. Processes
+// without resident memory, such as kernel threads, are left out.
+func topConsumers(processes []ProcessInfo, n int) []ProcessInfo {
+	var top []ProcessInfo
+	for _, proc := range processes {
+		if proc.RSS > 0 {
+			top = append(top, proc)
+		}
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		return top[i].RSS > top[j].RSS
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+func getAllProcesses(procFS fs.FS, captureEnv []string, keepArgs bool) ([]ProcessInfo, error) {
+	entries, err := fs.ReadDir(procFS, ".")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read %s: %v", procDir, err)
+		return nil, fmt.Errorf("failed to read proc directory: %v", err)
 	}
 
 	var processes []ProcessInfo
@@ -101,53 +641,212 @@ func getAllProcesses(procDir string) ([]ProcessInfo, error) {
 			continue // Not a PID directory
 		}
 
-		cmdline := getProcessCmdline(pid, procDir)
-		if cmdline != "" {
-			processes = append(processes, ProcessInfo{
-				PID:     pid,
-				Cmdline: cmdline,
-			})
+		if info, found := readProcess(pid, procFS, captureEnv, keepArgs); found {
+			processes = append(processes, info)
 			processCount++
 		}
 	}
 
-	logger.Debug("Found %d valid processes in %s", processCount, procDir)
+	logger.Debug("Found %d valid processes", processCount)
 	return processes, nil
 }
 
-func getProcessCmdline(pid int, procDir string) string {
-	cmdlinePath := filepath.Join(procDir, strconv.Itoa(pid), "cmdline")
-	data, err := ioutil.ReadFile(cmdlinePath)
+// ReadProcess reads a process from procDir, a directory laid out like
+// /proc, without a cache, for tools that only need to resolve the odd PID.
+// Args are kept and no environment variables are captured. The error wraps
+// ErrProcessNotFound when the process does not exist.
+func ReadProcess(procDir string, pid int) (ProcessInfo, error) {
+	info, found := readProcess(pid, os.DirFS(procDir), nil, true)
+	if !found {
+		return ProcessInfo{}, fmt.Errorf("PID %d: %w", pid, ErrProcessNotFound)
+	}
+	return info, nil
+}
+
+// readProcess reads the command line, status and captured environment of
+// pid from procFS, found is false when the process does not exist.
+func readProcess(pid int, procFS fs.FS, captureEnv []string, keepArgs bool) (ProcessInfo, bool) {
+	cmd := getProcessCmdline(pid, procFS)
+	if cmd.cmdline == "" {
+		return ProcessInfo{}, false
+	}
+	status := getProcessStatus(pid, procFS)
+	info := ProcessInfo{
+		PID:      pid,
+		Cmdline:  cmd.cmdline,
+		Name:     cmd.name,
+		FromComm: cmd.fromComm,
+		Env:      getProcessEnv(pid, procFS, captureEnv),
+		PPID:     status.ppid,
+		RSS:      status.rss,
+		UID:      status.uid,
+	}
+	if keepArgs {
+		info.Args = cmd.args
+	}
+	return info, true
+}
+
+// processCmdline is what getProcessCmdline reads about a process.
+type processCmdline struct {
+	cmdline  string
+	args     []string
+	name     string
+	fromComm bool
+}
+
+// getProcessCmdline reads the argv of a process and joins it into a command
+// line. Kernel threads have an empty cmdline and are reported by their comm
+// name in brackets, with no argv. cmdline is empty when the process is gone.
+func getProcessCmdline(pid int, procFS fs.FS) processCmdline {
+	cmdlinePath := path.Join(strconv.Itoa(pid), "cmdline")
+	data, err := fs.ReadFile(procFS, cmdlinePath)
 	if err != nil {
-		return ""
+		return processCmdline{}
+	}
+
+	// Arguments are terminated by null bytes. Processes rewriting their
+	// title, e.g. "nginx: worker process", pad it with more nulls.
+	if trimmed := strings.TrimRight(string(data), "\x00"); strings.TrimSpace(trimmed) != "" {
+		args := strings.Split(trimmed, "\x00")
+		return processCmdline{
+			cmdline: joinArgs(args),
+			args:    args,
+			name:    path.Base(args[0]),
+		}
+	}
+
+	commData, err := fs.ReadFile(procFS, path.Join(strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return processCmdline{}
+	}
+	comm := strings.TrimSpace(string(commData))
+	return processCmdline{
+		cmdline:  fmt.Sprintf("[%s]", comm),
+		name:     comm,
+		fromComm: true,
+	}
+}
+
+// joinArgs joins argv with spaces, single-quoting the arguments that would
+// otherwise be ambiguous. A lone argument is kept as is, it is usually a
+// rewritten process title.
+func joinArgs(args []string) string {
+	if len(args) == 1 {
+		return strings.TrimSpace(args[0])
+	}
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// getProcessEnv reads the requested variables from /proc/<pid>/environ. This
+// is best-effort: the file is only readable with sufficient privileges, and
+// every variable not listed in keys is discarded.
+func getProcessEnv(pid int, procFS fs.FS, keys []string) map[string]string {
+	if len(keys) == 0 {
+		return nil
 	}
 
-	// cmdline uses null bytes as separators
-	cmdline := strings.ReplaceAll(string(data), "\x00", " ")
-	cmdline = strings.TrimSpace(cmdline)
+	environPath := path.Join(strconv.Itoa(pid), "environ")
+	data, err := fs.ReadFile(procFS, environPath)
+	if err != nil {
+		return nil
+	}
 
-	if cmdline == "" {
-		// Try to get process name from comm file
-		commPath := filepath.Join(procDir, strconv.Itoa(pid), "comm")
-		commData, err := ioutil.ReadFile(commPath)
-		if err == nil {
-			cmdline = fmt.Sprintf("[%s]", strings.TrimSpace(string(commData)))
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+
+	var env map[string]string
+	for _, entry := range strings.Split(string(data), "\x00") {
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || !wanted[name] {
+			continue
 		}
+		if env == nil {
+			env = make(map[string]string)
+		}
+		env[name] = value
 	}
 
-	return cmdline
+	return env
 }
 
-func getPIDMax() int {
-	data, err := ioutil.ReadFile("/proc/sys/kernel/pid_max")
+// pidMaxLimit is PID_MAX_LIMIT, the highest pid_max of 64-bit kernels. It
+// sizes the caches of trees whose pid_max cannot be read, e.g. a proc tree
+// mounted without sys, since pid_max may be raised to it at any time. The
+// caches only grow to that size with the processes they hold.
+const pidMaxLimit = 4 * 1024 * 1024
+
+// getPIDMax returns the pid_max of procFS, read from its own sys/kernel
+// rather than the host's so that it matches the tree the PIDs come from.
+func getPIDMax(procFS fs.FS) int {
+	data, err := fs.ReadFile(procFS, "sys/kernel/pid_max")
 	if err != nil {
-		return 32768 // Default value
+		return pidMaxLimit
 	}
 
 	pidMax, err := strconv.Atoi(strings.TrimSpace(string(data)))
-	if err != nil {
-		return 32768
+	if err != nil || pidMax <= 0 {
+		return pidMaxLimit
 	}
 
 	return pidMax
 }
+
+// processStatus holds the fields used from /proc/<pid>/status.
+type processStatus struct {
+	uid  string
+	ppid int
+	rss  int64
+}
+
+// getProcessStatus reads the real UID, parent PID and RSS in kB of a process.
+// All are zero values when the process is gone.
+func getProcessStatus(pid int, procFS fs.FS) processStatus {
+	var status processStatus
+	data, err := fs.ReadFile(procFS, path.Join(strconv.Itoa(pid), "status"))
+	if err != nil {
+		return status
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		switch name {
+		case "Uid":
+			// Real, effective, saved and filesystem UIDs
+			status.uid = fields[0]
+		case "PPid":
+			status.ppid, _ = strconv.Atoi(fields[0])
+		case "VmRSS":
+			status.rss, _ = strconv.ParseInt(fields[0], 10, 64)
+		}
+	}
+	return status
+}
+
+// lookupUsername resolves a UID through /etc/passwd (or NSS when built with
+// cgo), returning "" when the UID is unknown.
+func lookupUsername(uid string) string {
+	u, err := user.LookupId(uid)
+	if err != nil {
+		logger.Debug("Failed to resolve UID %s: %v", uid, err)
+		return ""
+	}
+	return u.Username
+}
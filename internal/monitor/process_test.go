@@ -0,0 +1,918 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeProc is a proc tree holding one process per PID with a command line,
+// a status and a comm.
+func fakeProc(cmdlines map[string]string) fstest.MapFS {
+	proc := fstest.MapFS{
+		"sys/kernel/pid_max": {Data: []byte("32768\n")},
+	}
+	for pid, cmdline := range cmdlines {
+		proc[pid+"/cmdline"] = &fstest.MapFile{Data: []byte(cmdline)}
+		proc[pid+"/status"] = &fstest.MapFile{Data: []byte("Name:\tproc\nPPid:\t1\nUid:\t1000\t1000\t1000\t1000\nVmRSS:\t2048 kB\n")}
+		proc[pid+"/comm"] = &fstest.MapFile{Data: []byte("proc\n")}
+	}
+	return proc
+}
+
+// scanCountFS counts the full scans of a proc tree, the listings of its
+// root, and holds each one until gate is closed when it is set, or for
+// delay.
+type scanCountFS struct {
+	fs.FS
+	scans atomic.Int32
+	gate  chan struct{}
+	delay time.Duration
+}
+
+func (c *scanCountFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == "." {
+		c.scans.Add(1)
+		if c.gate != nil {
+			<-c.gate
+		}
+		time.Sleep(c.delay)
+	}
+	return fs.ReadDir(c.FS, name)
+}
+
+func TestRefreshCoalescesConcurrentCalls(t *testing.T) {
+	procFS := &scanCountFS{FS: fakeProc(map[string]string{"1": "init\x00"})}
+	pc, err := NewProcessCacheFS([]fs.FS{procFS}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	procFS.scans.Store(0)
+	procFS.gate = make(chan struct{})
+
+	const callers = 8
+	var started, wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		started.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			errs <- pc.Refresh()
+		}()
+	}
+
+	// Every caller is either running the scan or waiting for it once they
+	// all started and the scan is held
+	started.Wait()
+	deadline := time.Now().Add(time.Second)
+	for procFS.scans.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(procFS.gate)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Refresh: %v", err)
+		}
+	}
+	if got := procFS.scans.Load(); got != 1 {
+		t.Errorf("%d concurrent refreshes made %d scans, want 1", callers, got)
+	}
+	if got := pc.GetCommandLine(1); got != "init" {
+		t.Errorf("PID 1 cached as %q, want init", got)
+	}
+}
+
+func TestRefreshRespectsMinInterval(t *testing.T) {
+	procFS := &scanCountFS{FS: fakeProc(map[string]string{"1": "init\x00"})}
+	pc, err := NewProcessCacheFS([]fs.FS{procFS}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc.SetMinRefreshInterval(50 * time.Millisecond)
+
+	// The initial population counts as the previous scan
+	for i := 0; i < 3; i++ {
+		if err := pc.Refresh(); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+	}
+	if got := procFS.scans.Load(); got != 1 {
+		t.Fatalf("refreshes within the interval made %d scans, want only the initial one", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := pc.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got := procFS.scans.Load(); got != 2 {
+		t.Errorf("refresh after the interval made %d scans in total, want 2", got)
+	}
+}
+
+func TestRefreshWithoutMinIntervalScansEveryTime(t *testing.T) {
+	procFS := &scanCountFS{FS: fakeProc(map[string]string{"1": "init\x00"})}
+	pc, err := NewProcessCacheFS([]fs.FS{procFS}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := pc.Refresh(); err != nil {
+			t.Fatalf("Refresh: %v", err)
+		}
+	}
+	if got := procFS.scans.Load(); got != 4 {
+		t.Errorf("made %d scans, want 4", got)
+	}
+}
+
+func TestProcessCacheReadsFakeProc(t *testing.T) {
+	proc := fakeProc(map[string]string{
+		"1":    "/sbin/init\x00splash\x00",
+		"4242": "stress\x00--vm\x001\x00",
+		// A rewritten process title padded with nulls
+		"4343": "nginx: worker process\x00\x00\x00\x00",
+	})
+	// A kernel thread has an empty cmdline and is named by its comm
+	proc["2/cmdline"] = &fstest.MapFile{}
+	proc["2/comm"] = &fstest.MapFile{Data: []byte("kthreadd\n")}
+	// Entries of /proc that are not processes
+	proc["self/cmdline"] = &fstest.MapFile{Data: []byte("oom-notifier\x00")}
+	proc["meminfo"] = &fstest.MapFile{Data: []byte("MemTotal: 1024 kB\n")}
+
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatalf("NewProcessCacheFS: %v", err)
+	}
+	if n := pc.Len(); n != 4 {
+		t.Errorf("Len() = %d, want the 4 processes", n)
+	}
+	for pid, want := range map[int]string{
+		1:    "/sbin/init splash",
+		2:    "[kthreadd]",
+		4242: "stress --vm 1",
+		4343: "nginx: worker process",
+		9999: "",
+	} {
+		if got := pc.GetCommandLine(pid); got != want {
+			t.Errorf("GetCommandLine(%d) = %q, want %q", pid, got, want)
+		}
+	}
+}
+
+func TestProcessCacheReadsProcessStartedSinceScan(t *testing.T) {
+	proc := fakeProc(map[string]string{"1": "/sbin/init\x00"})
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proc["4242/cmdline"] = &fstest.MapFile{Data: []byte("stress\x00--vm\x001\x00")}
+	if got := pc.GetCommandLine(4242); got != "stress --vm 1" {
+		t.Errorf("GetCommandLine = %q, want the process read directly", got)
+	}
+	if n := pc.Len(); n != 2 {
+		t.Errorf("Len() = %d, want the process read directly cached", n)
+	}
+}
+
+func TestProcessCacheServesVictimAfterExit(t *testing.T) {
+	proc := fakeProc(map[string]string{"4242": "stress\x00--vm\x001\x00"})
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The victim is gone by the time the kill is read
+	for name := range proc {
+		if strings.HasPrefix(name, "4242/") {
+			delete(proc, name)
+		}
+	}
+	if got := pc.GetCommandLine(4242); got != "stress --vm 1" {
+		t.Errorf("GetCommandLine = %q, want the cached command line", got)
+	}
+}
+
+func TestProcessCacheReadsDyingProcessByComm(t *testing.T) {
+	proc := fakeProc(map[string]string{"1": "/sbin/init\x00"})
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An exiting process has released its memory and cmdline, its comm
+	// stays readable until it is reaped
+	proc["4242/cmdline"] = &fstest.MapFile{}
+	proc["4242/comm"] = &fstest.MapFile{Data: []byte("stress\n")}
+	if got := pc.GetCommandLine(4242); got != "[stress]" {
+		t.Errorf("GetCommandLine = %q, want the comm read directly", got)
+	}
+
+	delete(proc, "4242/cmdline")
+	delete(proc, "4242/comm")
+	if got := pc.GetCommandLine(4242); got != "[stress]" {
+		t.Errorf("GetCommandLine after exit = %q, want the cached comm", got)
+	}
+}
+
+func TestUnknownVictimsShareCommandLine(t *testing.T) {
+	events := detect(t, Options{}, "3,100,5000000,-;Out of memory: Killed process 4242 total-vm:1024kB\n"+
+		"3,101,6000000,-;Out of memory: Killed process 4343 total-vm:1024kB\n")
+	if len(events) != 2 {
+		t.Fatalf("detected %d events, want 2", len(events))
+	}
+	if events[0].Cmdline != unknownProcess || events[1].Cmdline != unknownProcess {
+		t.Errorf("victims %q and %q, want both %q", events[0].Cmdline, events[1].Cmdline, unknownProcess)
+	}
+	if events[0].PID != "4242" || events[1].PID != "4343" {
+		t.Errorf("PIDs %s and %s, want them reported on their own", events[0].PID, events[1].PID)
+	}
+}
+
+func TestLargeProcessCacheReadsMissesWithoutScanning(t *testing.T) {
+	cmdlines := make(map[string]string, 20000)
+	for pid := 1; pid <= 20000; pid++ {
+		cmdlines[strconv.Itoa(pid)] = "worker\x00--id\x00" + strconv.Itoa(pid) + "\x00"
+	}
+	proc := fakeProc(cmdlines)
+	procFS := &scanCountFS{FS: proc}
+	pc, err := NewProcessCacheFS([]fs.FS{procFS}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := pc.Len(); n != 20000 {
+		t.Fatalf("Len() = %d, want 20000", n)
+	}
+
+	proc["25000/cmdline"] = &fstest.MapFile{Data: []byte("stress\x00--vm\x001\x00")}
+	if got := pc.GetCommandLine(25000); got != "stress --vm 1" {
+		t.Errorf("GetCommandLine = %q, want the miss read directly", got)
+	}
+	if got := procFS.scans.Load(); got != 1 {
+		t.Errorf("%d scans of /proc, want only the initial one", got)
+	}
+}
+
+func TestNewProcessCacheReadsProcDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "4242"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "4242", "cmdline"), []byte("stress\x00--vm\x001\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := NewProcessCache([]string{dir}, nil, false, 0)
+	if err != nil {
+		t.Fatalf("NewProcessCache: %v", err)
+	}
+	if got := pc.GetCommandLine(4242); got != "stress --vm 1" {
+		t.Errorf("GetCommandLine = %q, want the command line under --proc-dir", got)
+	}
+}
+
+// withStatus sets the status file of pid in proc.
+func withStatus(proc fstest.MapFS, pid, uid, ppid string) {
+	proc[pid+"/status"] = &fstest.MapFile{Data: []byte("Name:\tproc\nPPid:\t" + ppid + "\nUid:\t" + uid + "\t" + uid + "\t" + uid + "\t" + uid + "\nVmRSS:\t2048 kB\n")}
+}
+
+func TestGetUser(t *testing.T) {
+	proc := fakeProc(map[string]string{"4242": "stress\x00", "4343": "java\x00"})
+	withStatus(proc, "4242", "0", "1")
+	// No passwd entry has this UID
+	withStatus(proc, "4343", "3999999", "1")
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		pid       int
+		uid, user string
+	}{
+		{4242, "0", "root"},
+		{4343, "3999999", ""},
+		{9999, "", ""},
+	} {
+		if uid, user := pc.GetUser(tt.pid); uid != tt.uid || user != tt.user {
+			t.Errorf("GetUser(%d) = %q, %q, want %q, %q", tt.pid, uid, user, tt.uid, tt.user)
+		}
+	}
+}
+
+func TestDetectedKillCarriesUser(t *testing.T) {
+	proc := fakeProc(map[string]string{"4242": "stress\x00"})
+	withStatus(proc, "4242", "0", "1")
+	// Older kernels do not log the UID, it is read from the status file
+	events := detect(t, Options{ProcFS: []fs.FS{proc}}, "6,100,5000000,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB\n")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].UID != "0" || events[0].User != "root" {
+		t.Errorf("UID %q, User %q, want 0 and root", events[0].UID, events[0].User)
+	}
+
+	// Once the process is gone both stay empty
+	events = detect(t, Options{}, "6,100,5000000,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB\n")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].UID != "" || events[0].User != "" {
+		t.Errorf("UID %q, User %q of an exited process, want both empty", events[0].UID, events[0].User)
+	}
+}
+
+func TestGetParent(t *testing.T) {
+	proc := fakeProc(map[string]string{
+		"100":  "supervisord\x00-c\x00/etc/supervisord.conf\x00",
+		"4242": "worker\x00--queue\x00jobs\x00",
+		"4343": "orphan\x00",
+	})
+	withStatus(proc, "4242", "0", "100")
+	// The parent of 4343 exited before the scan
+	withStatus(proc, "4343", "0", "200")
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ppid, cmdline := pc.GetParent(4242); ppid != 100 || cmdline != "supervisord -c /etc/supervisord.conf" {
+		t.Errorf("GetParent(4242) = %d, %q, want the supervisor", ppid, cmdline)
+	}
+	if ppid, cmdline := pc.GetParent(4343); ppid != 200 || cmdline != "" {
+		t.Errorf("GetParent(4343) = %d, %q, want 200 without a command line", ppid, cmdline)
+	}
+	if ppid, cmdline := pc.GetParent(9999); ppid != 0 || cmdline != "" {
+		t.Errorf("GetParent of an unknown process = %d, %q", ppid, cmdline)
+	}
+
+	// The child exited too, its parent PID recorded at the scan is used
+	delete(proc, "4242/status")
+	if ppid, cmdline := pc.GetParent(4242); ppid != 100 || cmdline != "supervisord -c /etc/supervisord.conf" {
+		t.Errorf("GetParent(4242) after exit = %d, %q, want the supervisor from the cache", ppid, cmdline)
+	}
+}
+
+func TestDetectedKillCarriesParent(t *testing.T) {
+	proc := fakeProc(map[string]string{"100": "supervisord\x00", "4242": "worker\x00"})
+	withStatus(proc, "4242", "0", "100")
+	events := detect(t, Options{ProcFS: []fs.FS{proc}}, "6,100,5000000,-;"+killLine+"\n")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].ParentPID != "100" || events[0].ParentCmdline != "supervisord" {
+		t.Errorf("parent %q %q, want supervisord, PID 100", events[0].ParentPID, events[0].ParentCmdline)
+	}
+}
+
+func TestResolveProcess(t *testing.T) {
+	proc := fakeProc(map[string]string{"4242": "/usr/bin/stress\x00--vm\x001\x00", "2": "\x00"})
+	withStatus(proc, "4242", "1000", "100")
+	// A kernel thread has neither a command line nor a status to read
+	proc["2/comm"] = &fstest.MapFile{Data: []byte("kthreadd\n")}
+	delete(proc, "2/status")
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc["4343/cmdline"] = &fstest.MapFile{Data: []byte("java\x00-jar\x00app.jar\x00")}
+	withStatus(proc, "4343", "0", "1")
+
+	for _, tt := range []struct {
+		name string
+		pid  int
+		want ProcessInfo
+	}{
+		{"full info", 4242, ProcessInfo{PID: 4242, Cmdline: "/usr/bin/stress --vm 1", Name: "stress", UID: "1000", PPID: 100, RSS: 2048}},
+		{"comm only", 2, ProcessInfo{PID: 2, Cmdline: "[kthreadd]", Name: "kthreadd", FromComm: true}},
+		{"started after the scan", 4343, ProcessInfo{PID: 4343, Cmdline: "java -jar app.jar", Name: "java", UID: "0", PPID: 1, RSS: 2048}},
+	} {
+		got, err := pc.ResolveProcess(tt.pid)
+		if err != nil {
+			t.Errorf("%s: ResolveProcess(%d): %v", tt.name, tt.pid, err)
+			continue
+		}
+		got.Env = nil
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ResolveProcess(%d) = %+v, want %+v", tt.name, tt.pid, got, tt.want)
+		}
+		if cmdline := pc.GetCommandLine(tt.pid); cmdline != tt.want.Cmdline {
+			t.Errorf("%s: GetCommandLine(%d) = %q, want %q", tt.name, tt.pid, cmdline, tt.want.Cmdline)
+		}
+	}
+
+	if _, err := pc.ResolveProcess(9999); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("ResolveProcess of an unknown process = %v, want ErrProcessNotFound", err)
+	}
+	if cmdline := pc.GetCommandLine(9999); cmdline != "" {
+		t.Errorf("GetCommandLine of an unknown process = %q", cmdline)
+	}
+}
+
+func TestReadProcess(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "4242"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"cmdline": "stress\x00--vm\x001\x00",
+		"status":  "Name:\tstress\nPPid:\t100\nUid:\t1000\t1000\t1000\t1000\nVmRSS:\t512 kB\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "4242", name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := ReadProcess(dir, 4242)
+	if err != nil {
+		t.Fatalf("ReadProcess: %v", err)
+	}
+	if info.Cmdline != "stress --vm 1" || !reflect.DeepEqual(info.Args, []string{"stress", "--vm", "1"}) || info.UID != "1000" || info.PPID != 100 || info.RSS != 512 {
+		t.Errorf("ReadProcess = %+v, want stress of UID 1000 under PID 100", info)
+	}
+	if _, err := ReadProcess(dir, 4343); !errors.Is(err, ErrProcessNotFound) {
+		t.Errorf("ReadProcess of a missing process = %v, want ErrProcessNotFound", err)
+	}
+}
+
+// ancestryProc is a proc tree of a worker started by gunicorn under
+// supervisord and systemd, an orphan whose parent is gone and two
+// processes naming each other as parent.
+func ancestryProc() fstest.MapFS {
+	proc := fakeProc(map[string]string{
+		"1":    "/usr/lib/systemd/systemd\x00--system\x00",
+		"100":  "/usr/bin/supervisord\x00",
+		"200":  "/usr/bin/gunicorn\x00app:wsgi\x00",
+		"4242": "worker\x00",
+		"4343": "orphan\x00",
+		"500":  "ping\x00",
+		"501":  "pong\x00",
+	})
+	withStatus(proc, "1", "0", "0")
+	withStatus(proc, "100", "0", "1")
+	withStatus(proc, "200", "0", "100")
+	withStatus(proc, "4242", "0", "200")
+	withStatus(proc, "4343", "0", "300")
+	withStatus(proc, "500", "0", "501")
+	withStatus(proc, "501", "0", "500")
+	return proc
+}
+
+func TestGetAncestry(t *testing.T) {
+	pc, err := NewProcessCacheFS([]fs.FS{ancestryProc()}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name       string
+		pid, depth int
+		want       []string
+	}{
+		{"full chain", 4242, 10, []string{"systemd", "supervisord", "gunicorn", "worker"}},
+		{"cut at depth", 4242, 2, []string{"supervisord", "gunicorn", "worker"}},
+		{"broken link", 4343, 10, []string{"PID 300", "orphan"}},
+		{"cycle", 500, 10, []string{"pong", "ping"}},
+		{"unknown process", 9999, 10, nil},
+	} {
+		if got := pc.GetAncestry(tt.pid, tt.depth); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: GetAncestry(%d, %d) = %q, want %q", tt.name, tt.pid, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestDetectedKillCarriesAncestry(t *testing.T) {
+	proc := ancestryProc()
+	events := detect(t, Options{ProcFS: []fs.FS{proc}, Ancestry: 3}, "6,100,5000000,-;"+killLine+"\n")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if want := []string{"systemd", "supervisord", "gunicorn", "worker"}; !reflect.DeepEqual(events[0].Ancestry, want) {
+		t.Errorf("Ancestry = %q, want %q", events[0].Ancestry, want)
+	}
+
+	events = detect(t, Options{ProcFS: []fs.FS{proc}}, "6,100,5000000,-;"+killLine+"\n")
+	if len(events) != 1 || events[0].Ancestry != nil {
+		t.Errorf("events %+v, want no ancestry without Options.Ancestry", events)
+	}
+}
+
+// consumersProc is a proc tree of processes using rss kB each, by PID, and
+// a kernel thread without resident memory.
+func consumersProc(rss map[string]string) fstest.MapFS {
+	proc := fakeProc(map[string]string{"2": "\x00"})
+	proc["2/comm"] = &fstest.MapFile{Data: []byte("kthreadd\n")}
+	proc["2/status"] = &fstest.MapFile{Data: []byte("Name:\tkthreadd\nPPid:\t0\nUid:\t0\t0\t0\t0\n")}
+	for pid, kb := range rss {
+		proc[pid+"/cmdline"] = &fstest.MapFile{Data: []byte("proc-" + pid + "\x00")}
+		proc[pid+"/status"] = &fstest.MapFile{Data: []byte("Name:\tproc\nPPid:\t1\nUid:\t0\t0\t0\t0\nVmRSS:\t" + kb + " kB\n")}
+	}
+	return proc
+}
+
+func TestTopConsumers(t *testing.T) {
+	proc := consumersProc(map[string]string{"10": "512", "11": "4096", "12": "1024", "13": "8192", "14": "256"})
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pids := func(processes []ProcessInfo) []int {
+		var out []int
+		for _, proc := range processes {
+			out = append(out, proc.PID)
+		}
+		return out
+	}
+	if got := pids(pc.TopConsumers(0)); !reflect.DeepEqual(got, []int{13, 11, 12}) {
+		t.Errorf("TopConsumers = %v, want 13, 11, 12 by RSS", got)
+	}
+	// The victim is left out and the next largest takes its place
+	if got := pids(pc.TopConsumers(13)); !reflect.DeepEqual(got, []int{11, 12, 10}) {
+		t.Errorf("TopConsumers without 13 = %v, want 11, 12, 10", got)
+	}
+
+	disabled, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := disabled.TopConsumers(0); len(got) != 0 {
+		t.Errorf("TopConsumers with 0 = %v, want none", got)
+	}
+}
+
+func TestGlobalKillListsTopConsumers(t *testing.T) {
+	proc := consumersProc(map[string]string{"4242": "8192", "10": "512", "11": "4096"})
+	events := detect(t, Options{ProcFS: []fs.FS{proc}, TopConsumers: 5}, "6,100,5000000,-;"+killLine+"\n")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	want := []MemoryConsumer{{PID: 11, Cmdline: "proc-11", RSS: 4096}, {PID: 10, Cmdline: "proc-10", RSS: 512}}
+	if !reflect.DeepEqual(events[0].TopConsumers, want) {
+		t.Errorf("TopConsumers = %+v, want %+v", events[0].TopConsumers, want)
+	}
+
+	memcg := "6,100,5000000,-;Memory cgroup out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0\n"
+	if events := detect(t, Options{ProcFS: []fs.FS{proc}, TopConsumers: 5}, memcg); len(events) != 1 || len(events[0].TopConsumers) != 0 {
+		t.Errorf("memcg kill lists top consumers: %+v", events)
+	}
+}
+
+func TestGetCgroup(t *testing.T) {
+	const dockerCgroup = "/system.slice/docker-0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.scope"
+	proc := fakeProc(map[string]string{"100": "v2\x00", "200": "v1\x00", "300": "hybrid\x00"})
+	proc["100/cgroup"] = &fstest.MapFile{Data: []byte("0::" + dockerCgroup + "\n")}
+	proc["200/cgroup"] = &fstest.MapFile{Data: []byte("12:pids:/docker/abc\n4:cpu,cpuacct:/docker/abc\n9:memory:/docker/def\n")}
+	// The memory controller on v1 wins over the unified hierarchy
+	proc["300/cgroup"] = &fstest.MapFile{Data: []byte("0::/init.scope\n9:memory:/docker/def\n")}
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for pid, want := range map[int]string{
+		100: dockerCgroup,
+		200: "/docker/def",
+		300: "/docker/def",
+		// Gone, or never had a cgroup file
+		400: "",
+	} {
+		if got := pc.GetCgroup(pid); got != want {
+			t.Errorf("GetCgroup(%d) = %q, want %q", pid, got, want)
+		}
+	}
+}
+
+func TestGetOOMScore(t *testing.T) {
+	proc := fakeProc(map[string]string{"100": "java\x00"})
+	proc["100/oom_score"] = &fstest.MapFile{Data: []byte("912\n")}
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pc.GetOOMScore(100); got != "912" {
+		t.Errorf("GetOOMScore(100) = %q, want 912", got)
+	}
+	if got := pc.GetOOMScore(200); got != "" {
+		t.Errorf("GetOOMScore of an exited process = %q, want none", got)
+	}
+}
+
+func TestKillReportsOOMScore(t *testing.T) {
+	proc := fakeProc(map[string]string{"4242": "stress\x00"})
+	proc["4242/oom_score"] = &fstest.MapFile{Data: []byte("650\n")}
+
+	for name, tt := range map[string]struct {
+		line string
+		proc fs.FS
+		want string
+	}{
+		"logged by the kernel": {"Out of memory: Kill process 4242 (stress) score 912 or sacrifice child", proc, "912"},
+		"read from /proc":      {"Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0", proc, "650"},
+		"victim gone":          {"Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0", fakeProc(map[string]string{}), ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			events := detect(t, Options{ProcFS: []fs.FS{tt.proc}}, "6,100,5000000,-;"+tt.line+"\n")
+			if len(events) != 1 {
+				t.Fatalf("detected %d events, want 1", len(events))
+			}
+			if got := events[0].Memory.OOMScore; got != tt.want {
+				t.Errorf("OOMScore = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetProcessCmdline(t *testing.T) {
+	for name, tt := range map[string]struct {
+		cmdline, comm string
+		want          processCmdline
+	}{
+		"trailing null": {
+			cmdline: "stress\x00--vm\x001\x00",
+			want:    processCmdline{cmdline: "stress --vm 1", args: []string{"stress", "--vm", "1"}, name: "stress"},
+		},
+		"no trailing null": {
+			cmdline: "/usr/bin/python3\x00job.py",
+			want:    processCmdline{cmdline: "/usr/bin/python3 job.py", args: []string{"/usr/bin/python3", "job.py"}, name: "python3"},
+		},
+		"arguments with spaces": {
+			cmdline: "sh\x00-c\x00sleep 10; echo 'done'\x00\x00",
+			want:    processCmdline{cmdline: `sh -c 'sleep 10; echo '\''done'\'''`, args: []string{"sh", "-c", "sleep 10; echo 'done'"}, name: "sh"},
+		},
+		"empty argument": {
+			cmdline: "grep\x00\x00file\x00",
+			want:    processCmdline{cmdline: "grep '' file", args: []string{"grep", "", "file"}, name: "grep"},
+		},
+		"rewritten title": {
+			cmdline: "postgres: checkpointer \x00\x00\x00",
+			want:    processCmdline{cmdline: "postgres: checkpointer", args: []string{"postgres: checkpointer "}, name: "postgres: checkpointer "},
+		},
+		"kernel thread": {
+			cmdline: "",
+			comm:    "kworker/0:1\n",
+			want:    processCmdline{cmdline: "[kworker/0:1]", name: "kworker/0:1", fromComm: true},
+		},
+		"only nulls": {
+			cmdline: "\x00\x00",
+			comm:    "zombie\n",
+			want:    processCmdline{cmdline: "[zombie]", name: "zombie", fromComm: true},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			proc := fstest.MapFS{"4242/cmdline": {Data: []byte(tt.cmdline)}}
+			if tt.comm != "" {
+				proc["4242/comm"] = &fstest.MapFile{Data: []byte(tt.comm)}
+			}
+			if got := getProcessCmdline(4242, proc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getProcessCmdline = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := getProcessCmdline(9999, fstest.MapFS{}); got.cmdline != "" {
+		t.Errorf("getProcessCmdline of a missing process = %+v, want nothing", got)
+	}
+}
+
+func TestProcessCacheKeepsArgv(t *testing.T) {
+	proc := fakeProc(map[string]string{"4242": "/usr/bin/stress\x00--vm\x001\x00"})
+	proc["2/cmdline"] = &fstest.MapFile{}
+	proc["2/comm"] = &fstest.MapFile{Data: []byte("kthreadd\n")}
+
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, true, 0)
+	if err != nil {
+		t.Fatalf("NewProcessCacheFS: %v", err)
+	}
+	info, err := pc.ResolveProcess(4242)
+	if err != nil {
+		t.Fatalf("ResolveProcess: %v", err)
+	}
+	if !reflect.DeepEqual(info.Args, []string{"/usr/bin/stress", "--vm", "1"}) || info.Name != "stress" || info.FromComm {
+		t.Errorf("process %+v, want its argv and executable name", info)
+	}
+	if got := pc.GetArgs(4242); len(got) != 3 {
+		t.Errorf("GetArgs = %q, want the argv", got)
+	}
+	if info, _ := pc.ResolveProcess(2); !info.FromComm || info.Args != nil || info.Name != "kthreadd" {
+		t.Errorf("kernel thread %+v, want it named by its comm without argv", info)
+	}
+}
+
+func TestScanNewCachesShortLivedProcess(t *testing.T) {
+	proc := fakeProc(map[string]string{"1": "/sbin/init\x00"})
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The process starts after the refresh and exits before the kill is read
+	proc["4242/cmdline"] = &fstest.MapFile{Data: []byte("stress\x00--vm\x001\x00")}
+	if added, err := pc.ScanNew(); err != nil || added != 1 {
+		t.Fatalf("ScanNew = %d, %v, want the new process added", added, err)
+	}
+	if added, _ := pc.ScanNew(); added != 0 {
+		t.Errorf("second ScanNew added %d processes, want the cached ones skipped", added)
+	}
+	delete(proc, "4242/cmdline")
+	if got := pc.GetCommandLine(4242); got != "stress --vm 1" {
+		t.Errorf("GetCommandLine = %q after the process vanished, want the scanned command line", got)
+	}
+}
+
+func TestRefreshKeepsVanishedProcess(t *testing.T) {
+	proc := fakeProc(map[string]string{"1": "/sbin/init\x00", "4242": "stress\x00--vm\x001\x00"})
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"4242/cmdline", "4242/status", "4242/comm"} {
+		delete(proc, name)
+	}
+	if err := pc.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if got := pc.GetCommandLine(4242); got != "stress --vm 1" {
+		t.Errorf("GetCommandLine = %q, want the process kept until its PID is reused", got)
+	}
+}
+
+func TestRefreshKeepsCmdlineOfExitingProcess(t *testing.T) {
+	proc := fakeProc(map[string]string{"4242": "/usr/bin/stress\x00--vm\x001\x00", "4343": "java\x00-jar\x00app.jar\x00"})
+	proc["4242/comm"] = &fstest.MapFile{Data: []byte("stress\n")}
+	proc["4343/comm"] = &fstest.MapFile{Data: []byte("java\n")}
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An exiting process has released its argv, only its comm is left
+	proc["4242/cmdline"] = &fstest.MapFile{}
+	// The PID of the other was reused by a kernel thread
+	proc["4343/cmdline"] = &fstest.MapFile{}
+	proc["4343/comm"] = &fstest.MapFile{Data: []byte("kworker/1:0\n")}
+	if err := pc.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if info, _ := pc.ResolveProcess(4242); info.Cmdline != "/usr/bin/stress --vm 1" || info.FromComm {
+		t.Errorf("exiting process %+v, want its cached command line", info)
+	}
+	if info, _ := pc.ResolveProcess(4343); info.Cmdline != "[kworker/1:0]" || !info.FromComm {
+		t.Errorf("reused PID %+v, want the new process", info)
+	}
+}
+
+func TestProcessCacheConsultsTreesInOrder(t *testing.T) {
+	host := fakeProc(map[string]string{
+		"1":   "/sbin/init\x00",
+		"100": "host-daemon\x00",
+	})
+	container := fakeProc(map[string]string{
+		"1":   "/pause\x00",
+		"300": "container-worker\x00",
+	})
+	container["sys/kernel/pid_max"] = &fstest.MapFile{Data: []byte("4096\n")}
+
+	pc, err := NewProcessCacheFS([]fs.FS{host, container}, nil, false, 0)
+	if err != nil {
+		t.Fatalf("NewProcessCacheFS: %v", err)
+	}
+	if n := pc.Len(); n != 4 {
+		t.Errorf("Len() = %d, want the 4 processes of both trees", n)
+	}
+	if !reflect.DeepEqual(pc.pidMaxes, []int{32768, 4096}) {
+		t.Errorf("caches sized for pid_max %v, want the pid_max of each tree", pc.pidMaxes)
+	}
+	for pid, want := range map[int]string{
+		1:   "/sbin/init",
+		100: "host-daemon",
+		300: "container-worker",
+		999: "",
+	} {
+		if got := pc.GetCommandLine(pid); got != want {
+			t.Errorf("GetCommandLine(%d) = %q, want %q", pid, got, want)
+		}
+	}
+}
+
+func TestGetPIDMax(t *testing.T) {
+	for name, tt := range map[string]struct {
+		pidMax string
+		want   int
+	}{
+		"set":        {"4096\n", 4096},
+		"unparsable": {"many\n", pidMaxLimit},
+		"zero":       {"0\n", pidMaxLimit},
+		"missing":    {"", pidMaxLimit},
+	} {
+		proc := fstest.MapFS{}
+		if tt.pidMax != "" {
+			proc["sys/kernel/pid_max"] = &fstest.MapFile{Data: []byte(tt.pidMax)}
+		}
+		if got := getPIDMax(proc); got != tt.want {
+			t.Errorf("%s: getPIDMax = %d, want %d", name, got, tt.want)
+		}
+	}
+}
+
+func TestRefreshFollowsPIDMax(t *testing.T) {
+	cmdlines := map[string]string{}
+	for pid := 1; pid <= 15; pid++ {
+		cmdlines[strconv.Itoa(pid)] = "worker\x00"
+	}
+	proc := fakeProc(cmdlines)
+	proc["sys/kernel/pid_max"] = &fstest.MapFile{Data: []byte("10\n")}
+	pc, err := NewProcessCacheFS([]fs.FS{proc}, nil, false, 0)
+	if err != nil {
+		t.Fatalf("NewProcessCacheFS: %v", err)
+	}
+	if n := pc.Len(); n != 10 {
+		t.Fatalf("Len() = %d with pid_max 10, want 10", n)
+	}
+
+	proc["sys/kernel/pid_max"] = &fstest.MapFile{Data: []byte("100\n")}
+	if err := pc.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if n := pc.Len(); n != 15 || pc.pidMaxes[0] != 100 {
+		t.Fatalf("Len() = %d sized for pid_max %d after raising it to 100, want all 15", n, pc.pidMaxes[0])
+	}
+
+	proc["sys/kernel/pid_max"] = &fstest.MapFile{Data: []byte("5\n")}
+	if err := pc.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if n := pc.Len(); n != 15 || pc.pidMaxes[0] != 100 {
+		t.Errorf("Len() = %d sized for pid_max %d after lowering it to 5, want the size kept", n, pc.pidMaxes[0])
+	}
+}
+
+func TestProcessCacheEntries(t *testing.T) {
+	host := fakeProc(map[string]string{"300": "postgres\x00", "1": "/sbin/init\x00", "20": "sshd\x00"})
+	container := fakeProc(map[string]string{"5": "java\x00"})
+	pc, err := NewProcessCacheFS([]fs.FS{host, container}, nil, false, 0)
+	if err != nil {
+		t.Fatalf("NewProcessCacheFS: %v", err)
+	}
+
+	var got [][]string
+	for _, entries := range pc.Entries() {
+		var tree []string
+		for _, proc := range entries {
+			tree = append(tree, fmt.Sprintf("%d %s", proc.PID, proc.Cmdline))
+		}
+		got = append(got, tree)
+	}
+	want := [][]string{{"1 /sbin/init", "20 sshd", "300 postgres"}, {"5 java"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries = %v, want the processes of each tree by PID", got)
+	}
+}
+
+func TestRefreshScansEveryTree(t *testing.T) {
+	host := fakeProc(map[string]string{"1": "/sbin/init\x00"})
+	container := fakeProc(map[string]string{"1": "/pause\x00"})
+	pc, err := NewProcessCacheFS([]fs.FS{host, container}, nil, false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host["200/cmdline"] = &fstest.MapFile{Data: []byte("cron\x00")}
+	container["300/cmdline"] = &fstest.MapFile{Data: []byte("container-worker\x00")}
+	if err := pc.Refresh(); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	entries := pc.Entries()
+	if len(entries) != 2 || len(entries[0]) != 2 || len(entries[1]) != 2 {
+		t.Fatalf("Entries = %+v, want two processes in each tree", entries)
+	}
+	if entries[0][1].Cmdline != "cron" || entries[1][1].Cmdline != "container-worker" {
+		t.Errorf("Entries = %+v, want each new process cached with its own tree", entries)
+	}
+}
+
+func TestNewProcessCacheRequiresAProcTree(t *testing.T) {
+	if _, err := NewProcessCacheFS(nil, nil, false, 0); err == nil {
+		t.Error("NewProcessCacheFS without a proc tree succeeded")
+	}
+}
@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// After a kill completes the kernel logs
+// "oom_reaper: reaped process 1234 (name), now anon-rss:0kB, ...".
+var reaperPattern = regexp.MustCompile(`oom_reaper: reaped process (\d+) \(([^)]*)\)`)
+
+// holdForReaper parks an OOM event until the matching oom_reaper line arrives
+// or the wait expires, whichever happens first.
+func (m *OOMMonitor) holdForReaper(event OOMEventData, pid int) {
+	logger.Debug("Holding OOM event for PID %d up to %v for oom_reaper confirmation", pid, m.reaperWait)
+	m.pending[pid] = event
+	stop := m.stop
+	time.AfterFunc(m.reaperWait, func() {
+		select {
+		case m.expired <- pid:
+		case <-stop:
+		}
+	})
+}
+
+// handleReaper correlates an oom_reaper line with a held event. It returns
+// false when the entry is not a reaper line.
+func (m *OOMMonitor) handleReaper(entry KmsgEntry, eventChan chan<- OOMEventData) bool {
+	matches := reaperPattern.FindStringSubmatch(entry.Message)
+	if len(matches) < 3 {
+		return false
+	}
+
+	pid, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return true
+	}
+
+	if event := m.capturedEvent(pid); event != nil {
+		// Still collecting the messages after the kill, sent once done
+		confirmReaped(event, pid, matches[2])
+		return true
+	}
+
+	event, ok := m.pending[pid]
+	if !ok {
+		logger.Debug("oom_reaper line for PID %d has no pending OOM event", pid)
+		return true
+	}
+	delete(m.pending, pid)
+	confirmReaped(&event, pid, matches[2])
+
+	logger.Info("Sending OOM event confirmed by oom_reaper", logger.F("pid", pid), logger.F("cmdline", event.Cmdline))
+	m.emit(eventChan, event)
+	return true
+}
+
+// confirmReaped marks the event of pid as confirmed by an oom_reaper line
+// naming the process name, which names the victim when it was unknown.
+func confirmReaped(event *OOMEventData, pid int, name string) {
+	event.Reaped = true
+	if event.Cmdline == unknownProcess && name != "" {
+		event.Cmdline = fmt.Sprintf("[%s]", name)
+		logger.Debug("Resolved process name for PID %d from oom_reaper: %s", pid, event.Cmdline)
+	}
+}
+
+// releaseExpired sends a held event whose oom_reaper line never arrived.
+func (m *OOMMonitor) releaseExpired(pid int, eventChan chan<- OOMEventData) {
+	event, ok := m.pending[pid]
+	if !ok {
+		return
+	}
+	delete(m.pending, pid)
+
+	logger.Debug("No oom_reaper line for PID %d within %v, sending unconfirmed", pid, m.reaperWait)
+	m.emit(eventChan, event)
+}
+
+// unknownProcess is the command line of a victim whose name is unknown. It
+// leaves out the PID, reported on its own, so that the events of unknown
+// processes share a fingerprint instead of each starting a new one.
+const unknownProcess = "<unknown process>"
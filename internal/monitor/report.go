@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+const (
+	maxReportLines = 1000
+	maxReportBytes = 6000
+
+	// reportWindow is how long, in kernel microseconds, a report may stay
+	// open waiting for its kill line before it is considered abandoned.
+	reportWindow = 30 * 1000 * 1000
+)
+
+var (
+	reportStartPattern = regexp.MustCompile(`invoked oom-killer:`)
+
+	// Swap state from the Mem-Info section, e.g. "Free swap  = 0kB".
+	freeSwapPattern  = regexp.MustCompile(`^Free swap\s*=\s*(\d+)kB`)
+	totalSwapPattern = regexp.MustCompile(`^Total swap\s*=\s*(\d+)kB`)
+)
+
+// oomReport is a multi-line kernel OOM report being reassembled. It opens on
+// the "invoked oom-killer" line and is taken by the kill line that ends it.
+type oomReport struct {
+	start     uint64
+	lastSeq   uint64
+	lines     []string
+	omitted   int
+	freeSwap  string
+	totalSwap string
+}
+
+// collectReport adds entry to the open report. Messages that other matchers
+// report as their own events are interleaved rather than part of the dump
+// and are left out. Gaps in the sequence numbers, from messages lost by the
+// reader or overwritten in the ring buffer, are marked in the report.
+func (m *OOMMonitor) collectReport(entry KmsgEntry) {
+	if reportStartPattern.MatchString(entry.Message) {
+		if m.report != nil {
+			logger.Debug("Discarding incomplete OOM report with %d lines", len(m.report.lines))
+		}
+		m.report = &oomReport{start: entry.Timestamp, lastSeq: entry.SequenceNum}
+		m.report.add(entry.Message)
+		return
+	}
+
+	report := m.report
+	if report == nil {
+		return
+	}
+	if entry.SequenceNum > report.lastSeq+1 {
+		report.add(fmt.Sprintf("... %d kernel messages missing ...", entry.SequenceNum-report.lastSeq-1))
+	}
+	report.lastSeq = entry.SequenceNum
+
+	if _, ok := classify(m.matchers, entry); ok {
+		return
+	}
+	report.add(entry.Message)
+
+	if matches := freeSwapPattern.FindStringSubmatch(entry.Message); matches != nil {
+		report.freeSwap = matches[1]
+	}
+	if matches := totalSwapPattern.FindStringSubmatch(entry.Message); matches != nil {
+		report.totalSwap = matches[1]
+	}
+}
+
+func (r *oomReport) add(line string) {
+	if len(r.lines) >= maxReportLines {
+		r.omitted++
+		return
+	}
+	r.lines = append(r.lines, line)
+}
+
+// takeReport returns the report ended by the kill line in entry and closes
+// it. Reports opened too long before the kill belong to an earlier OOM whose
+// kill line was lost and are dropped.
+func (m *OOMMonitor) takeReport(entry KmsgEntry) *oomReport {
+	report := m.report
+	m.report = nil
+
+	if report == nil {
+		return nil
+	}
+	if entry.Timestamp < report.start || entry.Timestamp-report.start > reportWindow {
+		logger.Debug("Discarding stale OOM report with %d lines", len(report.lines))
+		return nil
+	}
+	if report.omitted > 0 {
+		// The kill line did not fit, keep it as the last line anyway
+		report.omitted--
+		report.lines = append(report.lines, entry.Message)
+	}
+	return report
+}
+
+// text renders the report, truncated to fit in a notification. The kill line
+// is always kept.
+func (r *oomReport) text() string {
+	var b strings.Builder
+	for i, line := range r.lines {
+		if b.Len()+len(line) > maxReportBytes {
+			fmt.Fprintf(&b, "... %d more lines omitted ...\n", len(r.lines)-i-1+r.omitted)
+			b.WriteString(r.lines[len(r.lines)-1])
+			break
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
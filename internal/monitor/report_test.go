@@ -0,0 +1,90 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+)
+
+// oomDump is a global OOM report as captured from /dev/kmsg on a 5.15
+// kernel, trimmed to a few lines of each section, with a segfault and an
+// unrelated message interleaved.
+const oomDump = `4,300,7000000,-;stress invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0
+4,301,7000010,-;CPU: 1 PID: 4242 Comm: stress Not tainted 5.15.0-91-generic #101-Ubuntu
+4,302,7000020,-;Mem-Info:
+4,303,7000030,-;active_anon:1950847 inactive_anon:2460 isolated_anon:0
+3,304,7000040,-;nginx[1234]: segfault at 0 ip 00007f1c2b3a4d5e sp 00007ffd1e2f3a40 error 4 in libc.so.6[7f1c2b300000+195000]
+4,305,7000050,-;Free swap  = 0kB
+4,306,7000060,-;Total swap = 2097148kB
+6,307,7000070,-;[  pid  ]   uid  tgid total_vm      rss pgtables_bytes swapents oom_score_adj name
+6,308,7000080,-;[   4242]     0  4242  2000000  1950000 15760000        0             0 stress
+6,309,7000090,-;oom-kill:constraint=CONSTRAINT_NONE,nodemask=(null),cpuset=/,mems_allowed=0,global_oom,task_memcg=/user.slice,task=stress,pid=4242,uid=0
+3,310,7000100,-;Out of memory: Killed process 4242 (stress) total-vm:8000000kB, anon-rss:7800000kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:15390kB oom_score_adj:0
+`
+
+func TestReassemblesMultiLineReport(t *testing.T) {
+	events := detect(t, Options{AttachFullReport: true, WatchSegfaults: true}, oomDump)
+	if len(events) != 2 {
+		t.Fatalf("detected %d events, want the segfault and the kill", len(events))
+	}
+	segfault, kill := events[0], events[1]
+	if segfault.Kind != KindSegfault || kill.Kind != KindOOM || kill.PID != "4242" {
+		t.Fatalf("events %s and %s PID %s, want a segfault and the kill of 4242", segfault.Kind, kill.Kind, kill.PID)
+	}
+
+	lines := strings.Split(kill.Report, "\n")
+	if len(lines) != 10 {
+		t.Errorf("report of %d lines, want the dump but the segfault, 10 lines:\n%s", len(lines), kill.Report)
+	}
+	if !strings.HasPrefix(lines[0], "stress invoked oom-killer:") || !strings.HasPrefix(lines[len(lines)-1], "Out of memory: Killed process 4242") {
+		t.Errorf("report does not run from the oom-killer line to the kill line:\n%s", kill.Report)
+	}
+	if strings.Contains(kill.Report, "segfault") {
+		t.Errorf("interleaved segfault in the report:\n%s", kill.Report)
+	}
+	if kill.Memory.FreeSwap != "0" || kill.Memory.TotalSwap != "2097148" {
+		t.Errorf("swap %s free of %s, want 0 of 2097148", kill.Memory.FreeSwap, kill.Memory.TotalSwap)
+	}
+}
+
+func TestReportMarksMissingMessages(t *testing.T) {
+	recording := `4,300,7000000,-;stress invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0
+4,301,7000010,-;Mem-Info:
+4,318,7000020,-;Free swap  = 0kB
+3,319,7000100,-;Out of memory: Killed process 4242 (stress) total-vm:8000000kB, anon-rss:7800000kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:15390kB oom_score_adj:0
+`
+	events := detect(t, Options{AttachFullReport: true}, recording)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if !strings.Contains(events[0].Report, "Mem-Info:\n... 16 kernel messages missing ...\nFree swap") {
+		t.Errorf("gap in the sequence numbers not marked:\n%s", events[0].Report)
+	}
+}
+
+func TestReportLeftOutWithoutAttachFullReport(t *testing.T) {
+	events := detect(t, Options{}, oomDump)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].Report != "" {
+		t.Errorf("report attached without --attach-full-report:\n%s", events[0].Report)
+	}
+	// Swap figures come from the report either way
+	if events[0].Memory.TotalSwap != "2097148" {
+		t.Errorf("TotalSwap = %q, want 2097148", events[0].Memory.TotalSwap)
+	}
+}
+
+func TestStaleReportDropped(t *testing.T) {
+	recording := `4,300,7000000,-;stress invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0
+4,301,7000010,-;Mem-Info:
+3,302,47000000,-;Out of memory: Killed process 4242 (stress) total-vm:8000000kB, anon-rss:7800000kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:15390kB oom_score_adj:0
+`
+	events := detect(t, Options{AttachFullReport: true}, recording)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].Report != "" {
+		t.Errorf("report opened 40s before the kill attached:\n%s", events[0].Report)
+	}
+}
@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// Kernel log sources selectable with Options.LogSources.
+const (
+	SourceKmsg    = "kmsg"
+	SourceJournal = "journal"
+	SourceDmesg   = "dmesg"
+)
+
+// KernelLogSource delivers parsed kernel log entries to the monitor.
+type KernelLogSource interface {
+	// Entries returns the channel entries are delivered on as they are read.
+	Entries() <-chan KmsgEntry
+	// DroppedEntries returns the number of entries discarded because the
+	// channel was full.
+	DroppedEntries() uint64
+	// Running reports whether the source is still reading.
+	Running() bool
+	Close() error
+}
+
+// newKernelLogSource opens the named source. readHistory also delivers the
+// messages logged before it was opened. The dmesg source tails dmesgFile
+// when it is set instead of running dmesg.
+func newKernelLogSource(name, dmesgFile string, readHistory bool) (KernelLogSource, error) {
+	switch name {
+	case "", SourceKmsg:
+		return NewKmsgReader(readHistory)
+	case SourceJournal:
+		return NewJournalReader(readHistory)
+	case SourceDmesg:
+		if dmesgFile != "" {
+			return NewDmesgFileReader(dmesgFile, readHistory)
+		}
+		return NewDmesgReader(readHistory)
+	default:
+		return nil, fmt.Errorf("unknown kernel log source %q", name)
+	}
+}
+
+// openKernelLogSource opens the first of the named sources that can be
+// opened, trying them in order, and returns it with its name. It fails only
+// when none can.
+func openKernelLogSource(names []string, dmesgFile string, readHistory bool) (KernelLogSource, string, error) {
+	if len(names) == 0 {
+		names = []string{SourceKmsg}
+	}
+	var failures []string
+	for i, name := range names {
+		source, err := newKernelLogSource(name, dmesgFile, readHistory)
+		if err == nil {
+			return source, name, nil
+		}
+		if i < len(names)-1 {
+			logger.Warn("Kernel log source %s unavailable, trying %s: %v", name, names[i+1], err)
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+	}
+	return nil, "", fmt.Errorf("no kernel log source available (%s)", strings.Join(failures, "; "))
+}
+
+// push queues entry without blocking, counting it as dropped when buffer is
+// full. It returns false once done is closed.
+func push(buffer chan<- KmsgEntry, done <-chan struct{}, dropped *atomic.Uint64, entry KmsgEntry) bool {
+	select {
+	case buffer <- entry:
+	case <-done:
+		return false
+	default:
+		// Never block on a full buffer, the kernel keeps writing
+		if dropped.Add(1) == 1 {
+			logger.Warn("Kernel log entry buffer full, dropping kernel messages")
+		}
+	}
+	return true
+}
+
+// isClosed reports whether ch has been closed, without blocking.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// LineSource replays kernel messages in /dev/kmsg format, one per line, from
+// a reader such as a recorded fixture or the output of "cat /dev/kmsg".
+// Lines starting with a space continue the record above them. The entry
+// channel is closed once the reader is exhausted.
+type LineSource struct {
+	entries chan KmsgEntry
+	done    chan struct{}
+	stopped chan struct{}
+	sourceErrors
+}
+
+func NewLineSource(r io.Reader) *LineSource {
+	source := &LineSource{
+		entries: make(chan KmsgEntry, 100),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(source.stopped)
+		defer close(source.entries)
+
+		var assembler kmsgAssembler
+		var record []string
+		// deliver parses the buffered record, nil flushes the assembler
+		deliver := func(record []string) bool {
+			var completed []KmsgEntry
+			if record == nil {
+				completed = assembler.flush()
+			} else {
+				entry, err := parseKmsgRecord(strings.Join(record, "\n"))
+				if err != nil {
+					logger.Debug("Failed to parse kmsg record: %v", err)
+					return true
+				}
+				completed = assembler.add(*entry)
+			}
+
+			// Replays wait for the monitor instead of dropping entries
+			for _, entry := range completed {
+				select {
+				case source.entries <- entry:
+				case <-source.done:
+					return false
+				}
+			}
+			return true
+		}
+
+		// Records of a process table dump can be long, allow up to 1 MiB
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, " ") && record != nil {
+				record = append(record, line)
+				continue
+			}
+			if record != nil && !deliver(record) {
+				return
+			}
+			record = []string{line}
+		}
+		if err := scanner.Err(); err != nil {
+			source.readError(fmt.Errorf("failed to read kernel messages, replay stopped: %v", err))
+		}
+		if record != nil && !deliver(record) {
+			return
+		}
+		deliver(nil)
+	}()
+
+	return source
+}
+
+func (l *LineSource) Entries() <-chan KmsgEntry {
+	return l.entries
+}
+
+// DroppedEntries always returns zero, replays never drop entries.
+func (l *LineSource) DroppedEntries() uint64 {
+	return 0
+}
+
+// Running reports whether the reader still has lines to replay.
+func (l *LineSource) Running() bool {
+	return !isClosed(l.stopped)
+}
+
+func (l *LineSource) Close() error {
+	close(l.done)
+	return nil
+}
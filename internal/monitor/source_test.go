@@ -0,0 +1,175 @@
+package monitor
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPushCountsEntriesDroppedOnFullBuffer(t *testing.T) {
+	buffer := make(chan KmsgEntry, 2)
+	done := make(chan struct{})
+	var dropped atomic.Uint64
+
+	for seq := uint64(1); seq <= 5; seq++ {
+		if !push(buffer, done, &dropped, KmsgEntry{SequenceNum: seq}) {
+			t.Fatalf("push returned false for entry %d before done was closed", seq)
+		}
+	}
+	if got := dropped.Load(); got != 3 {
+		t.Errorf("dropped = %d, want 3", got)
+	}
+	if got := len(buffer); got != 2 {
+		t.Errorf("buffered = %d, want 2", got)
+	}
+	if first := <-buffer; first.SequenceNum != 1 {
+		t.Errorf("first buffered entry = %d, want 1, the oldest entries are kept", first.SequenceNum)
+	}
+}
+
+func TestPushStopsOnceDone(t *testing.T) {
+	buffer := make(chan KmsgEntry)
+	done := make(chan struct{})
+	close(done)
+	var dropped atomic.Uint64
+
+	if push(buffer, done, &dropped, KmsgEntry{}) {
+		t.Error("push returned true after done was closed")
+	}
+}
+
+func TestLineSourceReplaysFixture(t *testing.T) {
+	fixture, err := os.Open("testdata/global-oom.kmsg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fixture.Close()
+
+	events := detect(t, Options{
+		Source: NewLineSource(fixture),
+		ProcFS: []fs.FS{fakeProc(map[string]string{"4242": "stress\x00--vm\x001\x00"})},
+	}, "")
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	event := events[0]
+	for field, tt := range map[string]struct{ got, want string }{
+		"Kind":       {event.Kind, KindOOM},
+		"PID":        {event.PID, "4242"},
+		"Cmdline":    {event.Cmdline, "stress --vm 1"},
+		"UID":        {event.UID, "1000"},
+		"OOMType":    {event.OOMType, OOMTypeGlobal},
+		"TaskCgroup": {event.TaskCgroup, "/user.slice/user-1000.slice/session-2.scope"},
+		"TriggerPID": {event.TriggerPID, "4242"},
+		"AnonRSS":    {event.Memory.AnonRSS, "7800000"},
+		"TotalSwap":  {event.Memory.TotalSwap, "0"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", field, tt.got, tt.want)
+		}
+	}
+	if !strings.HasPrefix(event.Message, "Out of memory: Killed process 4242 (stress)") {
+		t.Errorf("Message = %q, want the kill line", event.Message)
+	}
+	if event.ID == "" {
+		t.Error("event without an ID")
+	}
+}
+
+func TestLineSourceSkipsMalformedLines(t *testing.T) {
+	source := NewLineSource(strings.NewReader("not a kmsg record\n6,1,100,-;first\n\n6,2,200,-;second\n"))
+	var messages []string
+	for entry := range source.Entries() {
+		messages = append(messages, entry.Message)
+	}
+	if strings.Join(messages, ",") != "first,second" {
+		t.Errorf("replayed %q, want first and second", messages)
+	}
+	if source.Running() {
+		t.Error("source running once its reader is exhausted")
+	}
+}
+
+func TestLineSourceJoinsContinuationLines(t *testing.T) {
+	recording := "3,1,100,-;usb 1-1: device descriptor read/64, error -71\n" +
+		" SUBSYSTEM=usb\n" +
+		" DEVICE=c189:1\n" +
+		"4,2,200,c;Out of memory: \n" +
+		"4,3,201,+;Killed process 4242 (stress)\n" +
+		"6,4,300,-;done\n"
+
+	source := NewLineSource(strings.NewReader(recording))
+	var entries []KmsgEntry
+	for entry := range source.Entries() {
+		entries = append(entries, entry)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("replayed %d entries, want 3: %+v", len(entries), entries)
+	}
+	if entries[0].Dict["SUBSYSTEM"] != "usb" || entries[0].Dict["DEVICE"] != "c189:1" {
+		t.Errorf("dictionary %v, want SUBSYSTEM and DEVICE", entries[0].Dict)
+	}
+	if entries[1].Message != "Out of memory: Killed process 4242 (stress)" || entries[1].SequenceNum != 3 {
+		t.Errorf("joined entry %d %q, want the kill line as sequence 3", entries[1].SequenceNum, entries[1].Message)
+	}
+}
+
+func TestFragmentedKillIsDetected(t *testing.T) {
+	events := detect(t, Options{}, "4,2,200,c;Out of memory: \n4,3,201,+;Killed process 4242 (stress) total-vm:1000kB\n")
+	if len(events) != 1 || events[0].PID != "4242" {
+		t.Errorf("detected %+v, want the kill of 4242", events)
+	}
+}
+
+func TestLineSourceReadsOversizedRecords(t *testing.T) {
+	// A process table dump line well past the 64 KiB scanner default
+	long := "6,1,100,-;" + strings.Repeat("x", 200*1024)
+	source := NewLineSource(strings.NewReader(long + "\n6,2,200,-;Out of memory: Killed process 4242 (stress)\n"))
+
+	var entries []KmsgEntry
+	for entry := range source.Entries() {
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("replayed %d entries, want the long record and the kill", len(entries))
+	}
+	if len(entries[0].Message) != 200*1024 || entries[1].SequenceNum != 2 {
+		t.Errorf("entries of %d bytes and sequence %d, want the whole long record and the kill after it", len(entries[0].Message), entries[1].SequenceNum)
+	}
+}
+
+func TestOpenKernelLogSourceFallsBack(t *testing.T) {
+	dmesg := filepath.Join(t.TempDir(), "dmesg.log")
+	if err := os.WriteFile(dmesg, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unknown source stands in for a /dev/kmsg that cannot be opened
+	source, name, err := openKernelLogSource([]string{"unavailable", SourceDmesg}, dmesg, false)
+	if err != nil {
+		t.Fatalf("openKernelLogSource: %v", err)
+	}
+	defer source.Close()
+	if name != SourceDmesg {
+		t.Errorf("opened %s, want the fallback %s", name, SourceDmesg)
+	}
+	if _, ok := source.(*DmesgReader); !ok {
+		t.Errorf("opened %T, want a *DmesgReader", source)
+	}
+}
+
+func TestOpenKernelLogSourceFailsWhenNoneOpens(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.log")
+	_, _, err := openKernelLogSource([]string{"unavailable", SourceDmesg}, missing, false)
+	if err == nil {
+		t.Fatal("opened a source although none is available")
+	}
+	for _, want := range []string{"unavailable: ", "dmesg: failed to open dmesg file"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not report %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+const (
+	// bootTimeTolerance absorbs the jitter in the boot time derived from
+	// /proc/stat, which moves with clock adjustments.
+	bootTimeTolerance = 10 * time.Second
+	// maxReported bounds the IDs of reported events kept in the state file,
+	// the oldest are forgotten first.
+	maxReported = 1024
+)
+
+// savedState is the on-disk form of the state file.
+type savedState struct {
+	BootID   string `json:"boot_id,omitempty"`
+	BootTime int64  `json:"boot_time"`
+	Sequence uint64 `json:"sequence"`
+	// Reported maps the IDs of the events delivered during this boot to
+	// when they were, in Unix seconds.
+	Reported map[string]int64 `json:"reported,omitempty"`
+	// Delivered maps the IDs of events to the notifiers that delivered
+	// them and when, in Unix seconds, so that no notifier gets an event
+	// twice however often it is retried.
+	Delivered map[string]map[string]int64 `json:"delivered,omitempty"`
+}
+
+// stateFile persists the sequence number of the last processed kernel
+// message so that a restart resumes where the previous run stopped instead of
+// skipping messages logged while it was down, and the IDs of the events
+// already reported so that a restart reading the same messages again, such
+// as with a history scan, never reports them twice.
+type stateFile struct {
+	path     string
+	bootID   string
+	bootTime time.Time
+
+	last  atomic.Uint64
+	mu    sync.Mutex
+	saved uint64
+
+	// reported and delivered are guarded by mu, dirty is set when either
+	// changed since the last save.
+	reported  map[string]int64
+	delivered map[string]map[string]int64
+	dirty     bool
+}
+
+func newStateFile(path string, bootTime time.Time) *stateFile {
+	return &stateFile{
+		path:     path,
+		bootID:   getBootID(),
+		bootTime: bootTime,
+	}
+}
+
+// load returns the sequence number to resume after. ok is false when there is
+// no usable state: the file does not exist, cannot be parsed, or was written
+// during a previous boot, whose sequence numbers mean nothing now.
+func (s *stateFile) load() (uint64, bool) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Info("No state file at %s, starting with new kernel messages", s.path)
+		return 0, false
+	}
+	if err != nil {
+		logger.Warn("Failed to read state file %s, starting with new kernel messages: %v", s.path, err)
+		return 0, false
+	}
+
+	var state savedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		logger.Warn("Failed to parse state file %s, starting with new kernel messages: %v", s.path, err)
+		return 0, false
+	}
+
+	if !s.sameBoot(state) {
+		logger.Info("State file %s is from a previous boot, starting with new kernel messages", s.path)
+		return 0, false
+	}
+
+	s.last.Store(state.Sequence)
+	s.mu.Lock()
+	s.saved = state.Sequence
+	s.reported = state.Reported
+	s.delivered = state.Delivered
+	s.mu.Unlock()
+	return state.Sequence, true
+}
+
+// isReported reports whether the event with id was reported during this
+// boot, by this run or a previous one.
+func (s *stateFile) isReported(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.reported[id]
+	return found
+}
+
+// markReported notes the event with id as reported at now, forgetting the
+// oldest IDs beyond maxReported. It is written out by the next save.
+func (s *stateFile) markReported(id string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.reported == nil {
+		s.reported = make(map[string]int64)
+	}
+	s.reported[id] = now.Unix()
+	s.dirty = true
+	for len(s.reported) > maxReported {
+		oldest, oldestAt := "", int64(0)
+		for id, at := range s.reported {
+			if oldest == "" || at < oldestAt || (at == oldestAt && id < oldest) {
+				oldest, oldestAt = id, at
+			}
+		}
+		delete(s.reported, oldest)
+	}
+}
+
+// isDelivered reports whether the event with id was delivered by the
+// notifier named name during this boot.
+func (s *stateFile) isDelivered(id, name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.delivered[id][name]
+	return found
+}
+
+// markDelivered notes the event with id as delivered by the notifier named
+// name at now, forgetting the events last delivered longest ago beyond
+// maxReported. It is written out by the next save.
+func (s *stateFile) markDelivered(id, name string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.delivered == nil {
+		s.delivered = make(map[string]map[string]int64)
+	}
+	if s.delivered[id] == nil {
+		s.delivered[id] = make(map[string]int64)
+	}
+	s.delivered[id][name] = now.Unix()
+	s.dirty = true
+	for len(s.delivered) > maxReported {
+		oldest, oldestAt := "", int64(0)
+		for id, notifiers := range s.delivered {
+			at := int64(0)
+			for _, t := range notifiers {
+				if t > at {
+					at = t
+				}
+			}
+			if oldest == "" || at < oldestAt || (at == oldestAt && id < oldest) {
+				oldest, oldestAt = id, at
+			}
+		}
+		delete(s.delivered, oldest)
+	}
+}
+
+// sameBoot reports whether state was written during the current boot. The
+// kernel's boot ID is exact; the boot time is only compared when either
+// side lacks one, and never matches when unknown.
+func (s *stateFile) sameBoot(state savedState) bool {
+	if s.bootID != "" && state.BootID != "" {
+		return s.bootID == state.BootID
+	}
+	if s.bootTime.IsZero() {
+		return false
+	}
+	diff := s.bootTime.Sub(time.Unix(state.BootTime, 0))
+	return diff > -bootTimeTolerance && diff < bootTimeTolerance
+}
+
+// record notes seq as processed. It is written out by the next save.
+func (s *stateFile) record(seq uint64) {
+	s.last.Store(seq)
+}
+
+// save writes the last recorded sequence number and the reported and
+// delivered events if any changed since the previous save. The file is replaced atomically
+// so a crash never leaves a truncated state behind.
+func (s *stateFile) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := s.last.Load()
+	if seq == s.saved && !s.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(savedState{
+		BootID:    s.bootID,
+		BootTime:  s.bootTime.Unix(),
+		Sequence:  seq,
+		Reported:  s.reported,
+		Delivered: s.delivered,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+
+	s.saved = seq
+	s.dirty = false
+	return nil
+}
+
+func getBootID() string {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,365 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+func TestStateFileKeepsReportedEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	bootTime := time.Unix(1700000000, 0)
+
+	state := newStateFile(path, bootTime)
+	state.load()
+	state.record(7)
+	state.markReported("a", time.Unix(1700000100, 0))
+	if err := state.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	restarted := newStateFile(path, bootTime)
+	if seq, ok := restarted.load(); !ok || seq != 7 {
+		t.Fatalf("load = %d, %v, want 7, true", seq, ok)
+	}
+	if !restarted.isReported("a") {
+		t.Error("reported event forgotten across restarts")
+	}
+	if restarted.isReported("b") {
+		t.Error("event never reported is reported")
+	}
+
+	// Reporting alone is saved, even without new kernel messages
+	restarted.markReported("b", time.Unix(1700000200, 0))
+	if err := restarted.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	again := newStateFile(path, bootTime)
+	again.load()
+	if !again.isReported("b") {
+		t.Error("event reported without a new sequence number was not saved")
+	}
+}
+
+func TestStateFileForgetsReportedEventsOfPreviousBoot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := newStateFile(path, time.Unix(1700000000, 0))
+	state.bootID = "boot-1"
+	state.markReported("a", time.Now())
+	if err := state.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	rebooted := newStateFile(path, time.Unix(1700090000, 0))
+	rebooted.bootID = "boot-2"
+	if _, ok := rebooted.load(); ok {
+		t.Fatal("state of a previous boot loaded")
+	}
+	if rebooted.isReported("a") {
+		t.Error("event reported during a previous boot still reported")
+	}
+}
+
+func TestStateFileBoundsReportedEvents(t *testing.T) {
+	state := newStateFile(filepath.Join(t.TempDir(), "state.json"), time.Time{})
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < maxReported+10; i++ {
+		state.markReported(fmt.Sprintf("event-%d", i), start.Add(time.Duration(i)*time.Second))
+	}
+
+	if n := len(state.reported); n != maxReported {
+		t.Errorf("%d reported events kept, want %d", n, maxReported)
+	}
+	if state.isReported("event-0") || state.isReported("event-9") {
+		t.Error("oldest reported events kept")
+	}
+	if !state.isReported(fmt.Sprintf("event-%d", maxReported+9)) {
+		t.Error("newest reported event forgotten")
+	}
+}
+
+func TestStateFileKeepsDeliveriesPerNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	bootTime := time.Unix(1700000000, 0)
+
+	state := newStateFile(path, bootTime)
+	state.markDelivered("a", "slack", time.Unix(1700000100, 0))
+	if err := state.save(); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	restarted := newStateFile(path, bootTime)
+	restarted.load()
+	if !restarted.isDelivered("a", "slack") {
+		t.Error("delivery forgotten across restarts")
+	}
+	if restarted.isDelivered("a", "webhook") || restarted.isDelivered("b", "slack") {
+		t.Error("delivery recorded for another notifier or event")
+	}
+	if restarted.isReported("a") {
+		t.Error("event delivered by one notifier reported")
+	}
+}
+
+func TestStateFileBoundsDeliveries(t *testing.T) {
+	state := newStateFile(filepath.Join(t.TempDir(), "state.json"), time.Time{})
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < maxReported+10; i++ {
+		at := start.Add(time.Duration(i) * time.Second)
+		state.markDelivered(fmt.Sprintf("event-%d", i), "slack", at)
+		state.markDelivered(fmt.Sprintf("event-%d", i), "webhook", at)
+	}
+
+	if n := len(state.delivered); n != maxReported {
+		t.Errorf("deliveries of %d events kept, want %d", n, maxReported)
+	}
+	if state.isDelivered("event-0", "slack") {
+		t.Error("oldest delivery kept")
+	}
+	if !state.isDelivered(fmt.Sprintf("event-%d", maxReported+9), "webhook") {
+		t.Error("newest delivery forgotten")
+	}
+}
+
+// kmsgRecording is the kernel log read again by every restart.
+const kmsgRecording = `6,100,5000000,-;Out of memory: Killed process 4242 (stress) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0
+6,101,5000100,-;systemd[1]: Started Session 2 of user root.
+6,102,5000200,-;Out of memory: Killed process 4343 (java) total-vm:2048kB, anon-rss:1024kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0
+`
+
+// runMonitor replays kmsgRecording through a monitor with the state file
+// at path, as one run of oom-notifier, and returns its events.
+func runMonitor(t *testing.T, path string) []OOMEventData {
+	t.Helper()
+	m, err := NewOOMMonitor(Options{
+		Source:          NewLineSource(strings.NewReader(kmsgRecording)),
+		ProcFS:          []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval:   time.Second,
+		RefreshInterval: time.Hour,
+		StateFile:       path,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+
+	events := make(chan OOMEventData, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Start(ctx, events); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	close(events)
+
+	var out []OOMEventData
+	for event := range events {
+		out = append(out, event)
+	}
+	return out
+}
+
+// forgetPosition rewrites the state file at path as if the run had crashed
+// before recording the last kernel message it processed, so that the next
+// run reads the whole recording again.
+func forgetPosition(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state savedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	state.Sequence = 0
+	if data, err = json.Marshal(state); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestartsNeverReportEventsTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	first := runMonitor(t, path)
+	if len(first) != 2 {
+		t.Fatalf("first run detected %d events, want 2", len(first))
+	}
+	if first[0].ID == "" || first[0].ID == first[1].ID {
+		t.Fatalf("event IDs %q and %q, want distinct IDs", first[0].ID, first[1].ID)
+	}
+
+	// The first run delivers the first kill only, then crashes
+	m, err := NewOOMMonitor(Options{
+		Source:        NewLineSource(strings.NewReader("")),
+		ProcFS:        []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval: time.Second,
+		StateFile:     path,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	m.MarkReported(first[0].ID)
+	m.Close()
+
+	for restart := 1; restart <= 3; restart++ {
+		forgetPosition(t, path)
+		events := runMonitor(t, path)
+		if len(events) != 2 {
+			t.Fatalf("restart %d detected %d events, want 2", restart, len(events))
+		}
+
+		m, err := NewOOMMonitor(Options{
+			Source:        NewLineSource(strings.NewReader("")),
+			ProcFS:        []fs.FS{fakeProc(map[string]string{})},
+			CheckInterval: time.Second,
+			StateFile:     path,
+		})
+		if err != nil {
+			t.Fatalf("NewOOMMonitor: %v", err)
+		}
+		for i, event := range events {
+			if event.ID != first[i].ID {
+				t.Errorf("restart %d: event %d ID %q, want %q as in the first run", restart, i, event.ID, first[i].ID)
+			}
+		}
+		if !m.Reported(events[0].ID) {
+			t.Errorf("restart %d: delivered kill not reported", restart)
+		}
+		if restart == 1 {
+			if m.Reported(events[1].ID) {
+				t.Errorf("restart %d: undelivered kill reported", restart)
+			}
+			// This run delivers the second kill
+			m.MarkReported(events[1].ID)
+		} else if !m.Reported(events[1].ID) {
+			t.Errorf("restart %d: kill delivered by a previous restart not reported", restart)
+		}
+		m.Close()
+	}
+}
+
+func TestReportedWithoutStateFile(t *testing.T) {
+	m, err := NewOOMMonitor(Options{
+		Source:        NewLineSource(strings.NewReader("")),
+		ProcFS:        []fs.FS{fakeProc(map[string]string{})},
+		CheckInterval: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewOOMMonitor: %v", err)
+	}
+	defer m.Close()
+
+	m.MarkReported("a")
+	if m.Reported("a") {
+		t.Error("event reported without a state file")
+	}
+}
+
+// resumeRecording is kmsgRecording with a kill logged while oom-notifier
+// was stopped.
+const resumeRecording = kmsgRecording + `6,103,5000300,-;Out of memory: Killed process 4444 (python3) total-vm:4096kB, anon-rss:2048kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0
+`
+
+func TestStateFileResumesAfterLastMessage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if events := detect(t, Options{StateFile: path}, kmsgRecording); len(events) != 2 {
+		t.Fatalf("first run detected %d events, want 2", len(events))
+	}
+
+	events := detect(t, Options{StateFile: path}, resumeRecording)
+	if len(events) != 1 || events[0].PID != "4444" {
+		t.Fatalf("resumed run detected %+v, want only the kill logged while stopped", events)
+	}
+}
+
+func TestStateFileFreshStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if events := detect(t, Options{StateFile: path}, resumeRecording); len(events) != 3 {
+		t.Fatalf("run without a state file detected %d events, want 3", len(events))
+	}
+
+	var state savedState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("state file not written: %v", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Sequence != 103 {
+		t.Errorf("saved sequence %d, want the last message, 103", state.Sequence)
+	}
+}
+
+func TestStateFileResetAfterReboot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	// Written during another boot, its sequence numbers mean nothing now
+	if err := os.WriteFile(path, []byte(`{"boot_id":"previous-boot","boot_time":1,"sequence":102}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := detect(t, Options{StateFile: path}, resumeRecording); len(events) != 3 {
+		t.Fatalf("run after a reboot detected %d events, want all 3", len(events))
+	}
+}
+
+func TestStateFileDetectsRebootByBootTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	bootTime := time.Unix(1700000000, 0)
+	state := newStateFile(path, bootTime)
+	state.bootID = ""
+	state.record(42)
+	if err := state.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a boot ID, boot times within the tolerance are the same boot
+	jittered := newStateFile(path, bootTime.Add(bootTimeTolerance/2))
+	jittered.bootID = ""
+	if seq, ok := jittered.load(); !ok || seq != 42 {
+		t.Errorf("load with a jittered boot time = %d, %v, want 42, true", seq, ok)
+	}
+
+	rebooted := newStateFile(path, bootTime.Add(time.Hour))
+	rebooted.bootID = ""
+	if _, ok := rebooted.load(); ok {
+		t.Error("state of a previous boot loaded")
+	}
+
+	unknown := newStateFile(path, time.Time{})
+	unknown.bootID = ""
+	if _, ok := unknown.load(); ok {
+		t.Error("state loaded without a boot time to match it")
+	}
+}
+
+func TestStateFileClassifiesKillLinesOnce(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "oom-notifier.log")
+	if err := logger.Init(logger.Options{Level: logger.LevelDebug, File: log}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logger.Init(logger.Options{Level: logger.LevelInfo}) })
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if events := detect(t, Options{StateFile: path}, kmsgRecording); len(events) != 2 {
+		t.Fatalf("detected %d events, want 2", len(events))
+	}
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "Detected OOM message"); n != 2 {
+		t.Errorf("kill lines classified %d times, want once each:\n%s", n, data)
+	}
+}
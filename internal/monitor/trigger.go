@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+var (
+	// The OOM report opens with the allocating task, which may differ from
+	// the victim, e.g. "stress invoked oom-killer: gfp_mask=0x100cca(GFP_HIGHUSER_MOVABLE), order=0, oom_score_adj=0".
+	oomInvokedPattern = regexp.MustCompile(`^(.+?) invoked oom-killer:`)
+
+	// The stack dump after it names the task's PID, e.g.
+	// "CPU: 1 PID: 4242 Comm: stress Not tainted 6.1.0 #1", with the UID
+	// before the PID on newer kernels.
+	oomTriggerCPUPattern = regexp.MustCompile(`^CPU: \d+ (?:UID: \d+ )?PID: (\d+) Comm: (.+?) (?:Not tainted|Tainted)`)
+)
+
+// oomTrigger is the task whose allocation invoked the OOM killer.
+type oomTrigger struct {
+	task      string
+	pid       int
+	timestamp uint64
+}
+
+// recordOOMTrigger remembers the task invoking the OOM killer so it can be
+// attached to the kill that ends the report, and takes its PID from the
+// CPU line of the stack dump that follows.
+func (m *OOMMonitor) recordOOMTrigger(entry KmsgEntry) {
+	if matches := oomInvokedPattern.FindStringSubmatch(entry.Message); matches != nil {
+		m.trigger = &oomTrigger{task: matches[1], timestamp: entry.Timestamp}
+		logger.Debug("OOM killer invoked by %s", m.trigger.task)
+		return
+	}
+
+	trigger := m.trigger
+	if trigger == nil || trigger.pid > 0 {
+		return
+	}
+	matches := oomTriggerCPUPattern.FindStringSubmatch(entry.Message)
+	if matches == nil || matches[2] != trigger.task {
+		return
+	}
+	trigger.pid, _ = strconv.Atoi(matches[1])
+	logger.Debug("OOM killer invoked by %s, pid=%d", trigger.task, trigger.pid)
+}
+
+// triggerProcess returns the PID and command line of the task invoking the
+// OOM killer. The command line is the task name in brackets when the PID is
+// unknown or the process is gone, and the PID is empty when the kernel did
+// not log it.
+func (m *OOMMonitor) triggerProcess(trigger *oomTrigger) (string, string) {
+	if trigger.pid == 0 {
+		return "", "[" + trigger.task + "]"
+	}
+	cmdline := m.processCache.GetCommandLine(trigger.pid)
+	if cmdline == "" {
+		cmdline = "[" + trigger.task + "]"
+	}
+	return strconv.Itoa(trigger.pid), cmdline
+}
+
+// takeOOMTrigger returns the task invoking the OOM killer for the kill
+// logged at timestamp, if any, and forgets it. Like reports, triggers
+// logged more than reportWindow before the kill belong to an earlier OOM.
+func (m *OOMMonitor) takeOOMTrigger(timestamp uint64) *oomTrigger {
+	trigger := m.trigger
+	m.trigger = nil
+
+	if trigger == nil || timestamp < trigger.timestamp || timestamp-trigger.timestamp > reportWindow {
+		return nil
+	}
+	return trigger
+}
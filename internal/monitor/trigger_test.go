@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"io/fs"
+	"testing"
+)
+
+// triggerReport is an OOM report captured on a host where a java
+// allocation invoked the OOM killer, which picked stress as its victim.
+const triggerReport = `4,200,5000000,-;java invoked oom-killer: gfp_mask=0x140cca(GFP_HIGHUSER_MOVABLE|__GFP_COMP), order=0, oom_score_adj=0
+4,201,5000010,-;CPU: 3 UID: 1000 PID: 5151 Comm: java Not tainted 6.12.9-200.fc41.x86_64 #1
+4,202,5000020,-;Call Trace:
+4,203,5000030,-;Mem-Info:
+6,204,5000040,-;oom-kill:constraint=CONSTRAINT_NONE,nodemask=(null),cpuset=/,mems_allowed=0,global_oom,task_memcg=/user.slice,task=stress,pid=4242,uid=0
+3,205,5000050,-;` + killLine + `
+`
+
+func TestTriggerIsAttachedToKill(t *testing.T) {
+	proc := fakeProc(map[string]string{
+		"4242": "stress\x00--vm\x001\x00",
+		"5151": "java\x00-jar\x00app.jar\x00",
+	})
+	events := detect(t, Options{ProcFS: []fs.FS{proc}}, triggerReport)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].PID != "4242" || events[0].TriggerPID != "5151" || events[0].TriggerCmdline != "java -jar app.jar" {
+		t.Errorf("victim %s, trigger %q %q, want stress killed for java, PID 5151", events[0].PID, events[0].TriggerPID, events[0].TriggerCmdline)
+	}
+}
+
+func TestTriggerOfExitedProcessIsNamed(t *testing.T) {
+	events := detect(t, Options{}, triggerReport)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].TriggerPID != "5151" || events[0].TriggerCmdline != "[java]" {
+		t.Errorf("trigger %q %q, want PID 5151 named by its task", events[0].TriggerPID, events[0].TriggerCmdline)
+	}
+}
+
+func TestTriggerWithoutStackDump(t *testing.T) {
+	// Another task's CPU line leaves the trigger's PID unknown
+	events := detect(t, Options{}, `4,200,5000000,-;java invoked oom-killer: gfp_mask=0x140cca(GFP_HIGHUSER_MOVABLE|__GFP_COMP), order=0, oom_score_adj=0
+4,201,5000010,-;CPU: 3 PID: 6000 Comm: kswapd0 Not tainted 5.15.0-91-generic #101-Ubuntu
+3,202,5000050,-;`+killLine+`
+`)
+	if len(events) != 1 {
+		t.Fatalf("detected %d events, want 1", len(events))
+	}
+	if events[0].TriggerPID != "" || events[0].TriggerCmdline != "[java]" {
+		t.Errorf("trigger %q %q, want java without a PID", events[0].TriggerPID, events[0].TriggerCmdline)
+	}
+}
+
+func TestTriggerIsForgotten(t *testing.T) {
+	// Logged more than reportWindow before the kill
+	events := detect(t, Options{}, `4,200,1000000,-;java invoked oom-killer: gfp_mask=0x140cca(GFP_HIGHUSER_MOVABLE|__GFP_COMP), order=0, oom_score_adj=0
+3,201,40000000,-;`+killLine+`
+`)
+	if len(events) != 1 || events[0].TriggerCmdline != "" {
+		t.Errorf("events = %+v, want one kill without the unrelated trigger", events)
+	}
+
+	// and used by one kill only
+	events = detect(t, Options{}, triggerReport+`3,206,5000100,-;Out of memory: Killed process 4343 (java) total-vm:1024kB, anon-rss:512kB, file-rss:0kB, shmem-rss:0kB, UID:0 pgtables:0kB oom_score_adj:0
+`)
+	if len(events) != 2 {
+		t.Fatalf("detected %d events, want 2", len(events))
+	}
+	if events[0].TriggerPID != "5151" || events[1].TriggerCmdline != "" {
+		t.Errorf("triggers %q and %q, want java for the first kill only", events[0].TriggerCmdline, events[1].TriggerCmdline)
+	}
+}
@@ -0,0 +1,56 @@
+package notifier
+
+import "time"
+
+// Cooldown lets an alert for the same service through at most once per
+// interval, however often it repeats. Unlike a Deduper it ignores the PID,
+// so a service killed and restarted under a new PID stays in cooldown, and
+// the interval is measured from the last alert sent.
+type Cooldown struct {
+	interval  time.Duration
+	lastSent  map[string]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+func NewCooldown(interval time.Duration) *Cooldown {
+	return &Cooldown{
+		interval: interval,
+		lastSent: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Allow reports whether an alert for event may be sent, and records it as
+// sent when it may.
+func (c *Cooldown) Allow(event OOMEvent) bool {
+	now := c.now()
+	c.prune(now)
+
+	key := serviceFingerprint(event)
+	if last, found := c.lastSent[key]; found && now.Sub(last) < c.interval {
+		return false
+	}
+	c.lastSent[key] = now
+	return true
+}
+
+// prune forgets the services out of cooldown, at most once per interval, so
+// that only services alerted on within the last two intervals are tracked.
+func (c *Cooldown) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < c.interval {
+		return
+	}
+	for key, last := range c.lastSent {
+		if now.Sub(last) >= c.interval {
+			delete(c.lastSent, key)
+		}
+	}
+	c.lastPrune = now
+}
+
+// serviceFingerprint identifies events of the same service, whatever its
+// PID.
+func serviceFingerprint(event OOMEvent) string {
+	return event.Kind + "\x00" + event.Hostname + "\x00" + dedupCmdline(event)
+}
@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestCooldown(interval time.Duration) (*Cooldown, *fakeClock) {
+	c := NewCooldown(interval)
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestCooldownSuppressesWithinInterval(t *testing.T) {
+	c, clock := newTestCooldown(5 * time.Minute)
+	event := testEvent()
+
+	if !c.Allow(event) {
+		t.Fatal("first alert suppressed")
+	}
+	// A restarted service is killed again under a new PID
+	event.PID = "5151"
+	clock.Advance(4 * time.Minute)
+	if c.Allow(event) {
+		t.Error("alert allowed within the cooldown")
+	}
+	clock.Advance(time.Minute)
+	if !c.Allow(event) {
+		t.Error("alert suppressed once the cooldown is over")
+	}
+	// The cooldown starts again from the last alert sent
+	clock.Advance(4 * time.Minute)
+	if c.Allow(event) {
+		t.Error("alert allowed within the cooldown of the second alert")
+	}
+}
+
+func TestCooldownKeepsServicesApart(t *testing.T) {
+	c, _ := newTestCooldown(5 * time.Minute)
+	other := testEvent()
+	other.Cmdline = "postgres"
+	otherHost := testEvent()
+	otherHost.Hostname = "node-2"
+
+	for _, event := range []OOMEvent{testEvent(), other, otherHost} {
+		if !c.Allow(event) {
+			t.Errorf("first alert for %s on %s suppressed", event.Cmdline, event.Hostname)
+		}
+	}
+}
+
+func TestCooldownPrunesExpiredServices(t *testing.T) {
+	c, clock := newTestCooldown(time.Minute)
+	for _, cmdline := range []string{"a", "b", "c"} {
+		event := testEvent()
+		event.Cmdline = cmdline
+		c.Allow(event)
+	}
+
+	clock.Advance(2 * time.Minute)
+	c.Allow(testEvent())
+	if len(c.lastSent) != 1 {
+		t.Errorf("tracking %d services, want only the one alerted on since", len(c.lastSent))
+	}
+}
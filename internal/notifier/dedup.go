@@ -0,0 +1,103 @@
+package notifier
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// dedupKeys bounds the number of fingerprints tracked by a Deduper.
+const dedupKeys = 1024
+
+// DedupPlaceholder replaces the matches of the dedup normalization regex in
+// the command lines of dedup and cooldown keys.
+const DedupPlaceholder = "<*>"
+
+// dedupNormalize is replaced by DedupPlaceholder in command lines before
+// keying, nil keeps them whole.
+var dedupNormalize *regexp.Regexp
+
+// SetDedupNormalize sets the regular expression whose matches, such as
+// temporary paths or request IDs, are replaced by DedupPlaceholder in
+// command lines before the Deduper and Cooldown key events, so that
+// otherwise identical processes collapse. An empty pattern keeps command
+// lines whole. It must be called before events are checked.
+func SetDedupNormalize(pattern string) error {
+	if pattern == "" {
+		dedupNormalize = nil
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid dedup normalization pattern: %v", err)
+	}
+	dedupNormalize = re
+	return nil
+}
+
+// dedupCmdline returns the command line of event as keyed by the Deduper
+// and Cooldown.
+func dedupCmdline(event OOMEvent) string {
+	if dedupNormalize == nil {
+		return event.Cmdline
+	}
+	return dedupNormalize.ReplaceAllLiteralString(event.Cmdline, DedupPlaceholder)
+}
+
+// dedupEntry tracks one fingerprint within its window.
+type dedupEntry struct {
+	first      time.Time
+	suppressed int
+}
+
+// Deduper suppresses repeats of the same event within a window. The first
+// event delivered after the window closes carries the number of repeats that
+// were suppressed.
+type Deduper struct {
+	window time.Duration
+	seen   *lru.Cache[string, dedupEntry]
+	now    func() time.Time
+}
+
+func NewDeduper(window time.Duration) (*Deduper, error) {
+	seen, err := lru.New[string, dedupEntry](dedupKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dedup cache: %v", err)
+	}
+
+	return &Deduper{window: window, seen: seen, now: time.Now}, nil
+}
+
+// SetWindow changes the window. Fingerprints already seen are kept and
+// measured against the new window.
+func (d *Deduper) SetWindow(window time.Duration) {
+	d.window = window
+}
+
+// Check reports whether event should be delivered. When it should, the
+// returned event has Suppressed set to the repeats dropped since the
+// previous delivery.
+func (d *Deduper) Check(event OOMEvent) (OOMEvent, bool) {
+	key := fingerprint(event)
+	now := d.now()
+
+	entry, found := d.seen.Get(key)
+	if found && now.Sub(entry.first) < d.window {
+		entry.suppressed++
+		d.seen.Add(key, entry)
+		return event, false
+	}
+
+	if found {
+		event.Suppressed = entry.suppressed
+	}
+	d.seen.Add(key, dedupEntry{first: now})
+	return event, true
+}
+
+// fingerprint identifies repeats of the same event.
+func fingerprint(event OOMEvent) string {
+	return event.Kind + "\x00" + event.Hostname + "\x00" + dedupCmdline(event) + "\x00" + event.PID
+}
@@ -0,0 +1,156 @@
+package notifier
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable time source for the Deduper and Cooldown.
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// useDedupNormalize sets the dedup normalization pattern for the duration
+// of the test.
+func useDedupNormalize(t *testing.T, pattern string) {
+	t.Helper()
+	if err := SetDedupNormalize(pattern); err != nil {
+		t.Fatalf("SetDedupNormalize(%q): %v", pattern, err)
+	}
+	t.Cleanup(func() { SetDedupNormalize("") })
+}
+
+func newTestDeduper(t *testing.T, window time.Duration) (*Deduper, *fakeClock) {
+	t.Helper()
+	d, err := NewDeduper(window)
+	if err != nil {
+		t.Fatalf("NewDeduper: %v", err)
+	}
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	d.now = clock.Now
+	return d, clock
+}
+
+func withCmdline(event OOMEvent, cmdline string) OOMEvent {
+	event.Cmdline = cmdline
+	return event
+}
+
+func TestDeduperSuppressesRepeatsWithinWindow(t *testing.T) {
+	d, clock := newTestDeduper(t, time.Minute)
+	event := testEvent()
+
+	if _, ok := d.Check(event); !ok {
+		t.Fatal("first event suppressed")
+	}
+	clock.Advance(10 * time.Second)
+	if _, ok := d.Check(event); ok {
+		t.Fatal("repeat within the window delivered")
+	}
+	clock.Advance(10 * time.Second)
+	d.Check(event)
+
+	clock.Advance(time.Minute)
+	delivered, ok := d.Check(event)
+	if !ok {
+		t.Fatal("event after the window suppressed")
+	}
+	if delivered.Suppressed != 2 {
+		t.Errorf("Suppressed = %d, want 2", delivered.Suppressed)
+	}
+}
+
+func TestDeduperKeysOnHostCmdlineAndPID(t *testing.T) {
+	d, _ := newTestDeduper(t, time.Minute)
+	event := testEvent()
+	d.Check(event)
+
+	otherHost, otherPID := testEvent(), testEvent()
+	otherHost.Hostname = "node-2"
+	otherPID.PID = "4343"
+	for _, other := range []OOMEvent{otherHost, otherPID, withCmdline(event, "java -jar app.jar")} {
+		if _, ok := d.Check(other); !ok {
+			t.Errorf("event %s on %s (PID %s) suppressed as a repeat of another", other.Cmdline, other.Hostname, other.PID)
+		}
+	}
+}
+
+func TestDeduperSetWindow(t *testing.T) {
+	d, clock := newTestDeduper(t, time.Minute)
+	event := testEvent()
+	d.Check(event)
+
+	clock.Advance(30 * time.Second)
+	d.SetWindow(10 * time.Second)
+	if _, ok := d.Check(event); !ok {
+		t.Error("repeat outside the shortened window suppressed")
+	}
+}
+
+func TestSuppressedRepeatsField(t *testing.T) {
+	event := testEvent()
+	if i := fieldIndex(eventFields(event), "Suppressed Repeats"); i >= 0 {
+		t.Error("event without suppressed repeats lists them")
+	}
+	event.Suppressed = 37
+	fields := eventFields(event)
+	i := fieldIndex(fields, "Suppressed Repeats")
+	if i < 0 || fields[i].Value != "suppressed 37 repeats since last alert" {
+		t.Errorf("fields = %+v, want the suppressed repeats", fields)
+	}
+}
+
+func TestDeduperKeepsDistinctCmdlinesWithoutNormalization(t *testing.T) {
+	d, _ := newTestDeduper(t, time.Minute)
+	event := testEvent()
+
+	d.Check(withCmdline(event, "worker --job /tmp/job-1a2b"))
+	if _, ok := d.Check(withCmdline(event, "worker --job /tmp/job-3c4d")); !ok {
+		t.Error("different command line suppressed without --dedup-normalize-regex")
+	}
+}
+
+func TestDeduperNormalizesCmdlines(t *testing.T) {
+	useDedupNormalize(t, `/tmp/[^ ]+|req-[0-9a-f]+`)
+	d, _ := newTestDeduper(t, time.Minute)
+	event := testEvent()
+
+	first, ok := d.Check(withCmdline(event, "worker --job /tmp/job-1a2b --id req-00ff"))
+	if !ok {
+		t.Fatal("first event suppressed")
+	}
+	if first.Cmdline != "worker --job /tmp/job-1a2b --id req-00ff" {
+		t.Errorf("Cmdline = %q, want the original command line", first.Cmdline)
+	}
+	if _, ok := d.Check(withCmdline(event, "worker --job /tmp/job-3c4d --id req-abcd")); ok {
+		t.Error("command line differing only by normalized parts delivered")
+	}
+	if _, ok := d.Check(withCmdline(event, "worker --job /tmp/job-3c4d --id other")); !ok {
+		t.Error("command line differing outside the normalized parts suppressed")
+	}
+}
+
+func TestCooldownNormalizesCmdlines(t *testing.T) {
+	useDedupNormalize(t, `/tmp/[^ ]+`)
+	c := NewCooldown(time.Minute)
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	c.now = clock.Now
+	event := testEvent()
+
+	if !c.Allow(withCmdline(event, "worker /tmp/a")) {
+		t.Fatal("first event held back")
+	}
+	second := withCmdline(event, "worker /tmp/b")
+	second.PID = "5000"
+	if c.Allow(second) {
+		t.Error("command line differing only by normalized parts allowed during the cooldown")
+	}
+}
+
+func TestSetDedupNormalizeRejectsInvalidPattern(t *testing.T) {
+	if err := SetDedupNormalize("("); err == nil {
+		t.Fatal("SetDedupNormalize accepted an invalid pattern")
+	}
+}
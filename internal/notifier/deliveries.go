@@ -0,0 +1,77 @@
+package notifier
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DeliveryCount is the number of notifications a notifier sent and failed
+// to send. LastError is the error of the last failed one.
+type DeliveryCount struct {
+	Name      string
+	Sent      int
+	Failed    int
+	LastError string
+}
+
+// Deliveries counts notification outcomes per notifier name, for a summary
+// in the logs where metrics are not collected. It is safe for concurrent
+// use.
+type Deliveries struct {
+	mu     sync.Mutex
+	counts map[string]*DeliveryCount
+}
+
+func NewDeliveries() *Deliveries {
+	return &Deliveries{counts: make(map[string]*DeliveryCount)}
+}
+
+// Record counts a notification sent by the notifier name, failed when err
+// is not nil.
+func (d *Deliveries) Record(name string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	count := d.counts[name]
+	if count == nil {
+		count = &DeliveryCount{Name: name}
+		d.counts[name] = count
+	}
+	if err != nil {
+		count.Failed++
+		count.LastError = err.Error()
+	} else {
+		count.Sent++
+	}
+}
+
+// Counts returns the counts so far, by notifier name.
+func (d *Deliveries) Counts() []DeliveryCount {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	counts := make([]DeliveryCount, 0, len(d.counts))
+	for _, count := range d.counts {
+		counts = append(counts, *count)
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
+
+// String summarizes the counts as "slack: 10 sent, 1 failed; webhook: ...".
+func (d *Deliveries) String() string {
+	counts := d.Counts()
+	if len(counts) == 0 {
+		return "none"
+	}
+
+	parts := make([]string, len(counts))
+	for i, count := range counts {
+		parts[i] = fmt.Sprintf("%s: %d sent, %d failed", count.Name, count.Sent, count.Failed)
+	}
+	return strings.Join(parts, "; ")
+}
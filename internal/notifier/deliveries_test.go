@@ -0,0 +1,55 @@
+package notifier
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestDeliveriesCountPerNotifier(t *testing.T) {
+	d := NewDeliveries()
+	if got := d.String(); got != "none" {
+		t.Errorf("String = %q before any notification, want none", got)
+	}
+
+	for _, err := range []error{nil, errors.New("timeout"), nil, errors.New("status 500")} {
+		d.Record("webhook", err)
+	}
+	d.Record("slack", nil)
+
+	want := []DeliveryCount{
+		{Name: "slack", Sent: 1},
+		{Name: "webhook", Sent: 2, Failed: 2, LastError: "status 500"},
+	}
+	if got := d.Counts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Counts = %+v, want %+v", got, want)
+	}
+	if got, want := d.String(), "slack: 1 sent, 0 failed; webhook: 2 sent, 2 failed"; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestDeliveriesConcurrentRecord(t *testing.T) {
+	d := NewDeliveries()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var err error
+				if i%2 == 1 {
+					err = errors.New("down")
+				}
+				d.Record("webhook", err)
+				_ = d.String()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := d.Counts(); len(got) != 1 || got[0].Sent != 500 || got[0].Failed != 500 {
+		t.Errorf("Counts = %+v, want 500 sent and 500 failed", got)
+	}
+}
@@ -0,0 +1,189 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxDigestEntries bounds the process lines listed in a digest message.
+const maxDigestEntries = 20
+
+// Digest rolls up the OOM kills of one batch window into a single message.
+type Digest struct {
+	Events []OOMEvent
+	Start  int64
+	End    int64
+}
+
+// DigestEntry counts the kills of one process on one host.
+type DigestEntry struct {
+	Hostname string
+	Cmdline  string
+	Count    int
+}
+
+// DigestNotifier is implemented by notifiers that can render digests.
+type DigestNotifier interface {
+	NotifyDigest(digest Digest) error
+}
+
+// DigestContextNotifier is implemented by digest notifiers whose deliveries
+// can be cancelled. Their NotifyDigest delivers with context.Background().
+type DigestContextNotifier interface {
+	NotifyDigestContext(ctx context.Context, digest Digest) error
+}
+
+// NewDigest builds a digest from the events of a window.
+func NewDigest(events []OOMEvent) Digest {
+	digest := Digest{Events: events}
+	for _, event := range events {
+		if digest.Start == 0 || event.Time < digest.Start {
+			digest.Start = event.Time
+		}
+		if event.Time > digest.End {
+			digest.End = event.Time
+		}
+	}
+	return digest
+}
+
+// Entries counts the kills per host and command line, most frequent first.
+func (d Digest) Entries() []DigestEntry {
+	counts := make(map[[2]string]int)
+	for _, event := range d.Events {
+		counts[[2]string{event.Hostname, event.Cmdline}]++
+	}
+	return digestEntries(counts)
+}
+
+// digestEntries turns kill counts keyed by host and command line into
+// entries, most frequent first.
+func digestEntries(counts map[[2]string]int) []DigestEntry {
+	entries := make([]DigestEntry, 0, len(counts))
+	for key, count := range counts {
+		entries = append(entries, DigestEntry{Hostname: key[0], Cmdline: key[1], Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		if entries[i].Hostname != entries[j].Hostname {
+			return entries[i].Hostname < entries[j].Hostname
+		}
+		return entries[i].Cmdline < entries[j].Cmdline
+	})
+	return entries
+}
+
+// Hosts returns the number of distinct hosts in the digest.
+func (d Digest) Hosts() int {
+	hosts := make(map[string]bool)
+	for _, event := range d.Events {
+		hosts[event.Hostname] = true
+	}
+	return len(hosts)
+}
+
+// digestTitle returns the headline of a digest.
+func digestTitle(d Digest) string {
+	return fmt.Sprintf("🚨 %d OOM kills on %d host(s)", len(d.Events), d.Hosts())
+}
+
+// digestLines renders the entries as "3× java on node1" lines, truncated to
+// maxDigestEntries.
+func digestLines(d Digest) string {
+	return entryLines(d.Entries())
+}
+
+func entryLines(entries []DigestEntry) string {
+	var lines []string
+	for i, entry := range entries {
+		if i == maxDigestEntries {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(entries)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%d× %s on %s", entry.Count, truncate(entry.Cmdline, maxConsumerCmdline), entry.Hostname))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DigestText renders a digest as plain text, for notifiers that only
+// support text messages.
+func DigestText(d Digest) string {
+	return fmt.Sprintf("%s between %s and %s:\n%s",
+		digestTitle(d), formatEventTime(d.Start), formatEventTime(d.End), digestLines(d))
+}
+
+func (s *SlackNotifier) NotifyDigest(digest Digest) error {
+	return s.NotifyDigestContext(context.Background(), digest)
+}
+
+// NotifyDigestContext is NotifyDigest with the request cancelled once ctx is
+// done.
+func (s *SlackNotifier) NotifyDigestContext(ctx context.Context, digest Digest) error {
+	attachment := SlackAttachment{
+		Color: "danger",
+		Title: digestTitle(digest),
+		Fields: []SlackField{
+			{
+				Title: "Killed Processes",
+				Value: digestLines(digest),
+				Short: false,
+			},
+			{
+				Title: "First Kill",
+				Value: formatEventTime(digest.Start),
+				Short: true,
+			},
+			{
+				Title: "Last Kill",
+				Value: formatEventTime(digest.End),
+				Short: true,
+			},
+		},
+	}
+
+	payload := SlackPayload{
+		Channel:     s.Channel,
+		Text:        "OOM Killer Alert",
+		Username:    s.Username,
+		IconEmoji:   s.IconEmoji,
+		Attachments: []SlackAttachment{attachment},
+	}
+
+	return s.post(ctx, payload)
+}
+
+// Batcher collects OOM events over a window so that a burst is sent as one
+// Digest instead of one message per kill.
+type Batcher struct {
+	window  time.Duration
+	pending []OOMEvent
+}
+
+func NewBatcher(window time.Duration) *Batcher {
+	return &Batcher{window: window}
+}
+
+// Window returns the batch window length.
+func (b *Batcher) Window() time.Duration {
+	return b.window
+}
+
+// Add buffers an event. It returns true when the event opened a new window,
+// in which case the caller is responsible for calling Flush once the window
+// has elapsed.
+func (b *Batcher) Add(event OOMEvent) bool {
+	b.pending = append(b.pending, event)
+	return len(b.pending) == 1
+}
+
+// Flush empties the window and returns its events in arrival order.
+func (b *Batcher) Flush() []OOMEvent {
+	events := b.pending
+	b.pending = nil
+	return events
+}
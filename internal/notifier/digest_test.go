@@ -0,0 +1,110 @@
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// killBurst returns kills of cmdlines on hostname, a second apart.
+func killBurst(hostname string, cmdlines ...string) []OOMEvent {
+	var events []OOMEvent
+	for i, cmdline := range cmdlines {
+		event := testEvent()
+		event.Hostname = hostname
+		event.Cmdline = cmdline
+		event.PID = fmt.Sprint(5000 + i)
+		event.Time += int64(i) * 1000
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestDigestCountsKillsPerProcessAndHost(t *testing.T) {
+	events := append(killBurst("node-1", "java", "java", "postgres", "java"), killBurst("node-2", "java")...)
+	digest := NewDigest(events)
+
+	want := []DigestEntry{
+		{Hostname: "node-1", Cmdline: "java", Count: 3},
+		{Hostname: "node-1", Cmdline: "postgres", Count: 1},
+		{Hostname: "node-2", Cmdline: "java", Count: 1},
+	}
+	if got := digest.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Entries = %+v, want %+v", got, want)
+	}
+	if got := digest.Hosts(); got != 2 {
+		t.Errorf("Hosts = %d, want 2", got)
+	}
+	start := testEvent().Time
+	if digest.Start != start || digest.End != start+3000 {
+		t.Errorf("window %d-%d, want %d-%d", digest.Start, digest.End, start, start+3000)
+	}
+}
+
+func TestDigestText(t *testing.T) {
+	text := DigestText(NewDigest(killBurst("node-1", "java", "java", "postgres")))
+	for _, want := range []string{"3 OOM kills on 1 host(s)", "2× java on node-1\n1× postgres on node-1"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("DigestText = %q, want it to contain %q", text, want)
+		}
+	}
+}
+
+func TestDigestLinesAreBounded(t *testing.T) {
+	var cmdlines []string
+	for i := 0; i < maxDigestEntries+5; i++ {
+		cmdlines = append(cmdlines, fmt.Sprintf("job-%02d", i))
+	}
+	lines := strings.Split(digestLines(NewDigest(killBurst("node-1", cmdlines...))), "\n")
+	if len(lines) != maxDigestEntries+1 || lines[maxDigestEntries] != "... and 5 more" {
+		t.Errorf("%d lines ending in %q, want %d and the count of the rest", len(lines), lines[len(lines)-1], maxDigestEntries+1)
+	}
+}
+
+func TestBatcherCollectsWindow(t *testing.T) {
+	b := NewBatcher(30 * time.Second)
+	events := killBurst("node-1", "a", "b", "c")
+
+	if !b.Add(events[0]) {
+		t.Error("first event did not open a window")
+	}
+	if b.Add(events[1]) || b.Add(events[2]) {
+		t.Error("later event opened another window")
+	}
+	if got := b.Flush(); !reflect.DeepEqual(got, events) {
+		t.Errorf("Flush = %+v, want the events in arrival order", got)
+	}
+	if got := b.Flush(); len(got) != 0 {
+		t.Errorf("second Flush = %+v, want nothing", got)
+	}
+	if !b.Add(events[0]) {
+		t.Error("event after a flush did not open a window")
+	}
+}
+
+func TestSlackDigest(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+
+	if err := s.NotifyDigest(NewDigest(killBurst("node-1", "java", "java", "postgres"))); err != nil {
+		t.Fatalf("NotifyDigest: %v", err)
+	}
+	if webhook.received() != 1 {
+		t.Fatalf("webhook received %d messages, want one digest", webhook.received())
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	if len(payload.Attachments) != 1 {
+		t.Fatalf("%d attachments, want 1", len(payload.Attachments))
+	}
+	attachment := payload.Attachments[0]
+	if attachment.Title != "🚨 3 OOM kills on 1 host(s)" {
+		t.Errorf("title = %q", attachment.Title)
+	}
+	if len(attachment.Fields) == 0 || attachment.Fields[0].Value != "2× java on node-1\n1× postgres on node-1" {
+		t.Errorf("fields = %+v, want the kills per process first", attachment.Fields)
+	}
+}
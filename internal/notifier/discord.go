@@ -0,0 +1,124 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Discord limits embed field values to 1024 characters and rejects empty ones.
+const discordFieldLimit = 1024
+
+// discordRed is the embed color used for OOM events.
+const discordRed = 0xE01E5A
+
+type DiscordNotifier struct {
+	WebhookURL string
+	client     *http.Client
+}
+
+type DiscordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type DiscordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []DiscordField `json:"fields"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type DiscordPayload struct {
+	Username string         `json:"username"`
+	Content  string         `json:"content"`
+	Embeds   []DiscordEmbed `json:"embeds"`
+}
+
+func NewDiscordNotifier(webhookURL string, client *http.Client) *DiscordNotifier {
+	return &DiscordNotifier{
+		WebhookURL: webhookURL,
+		client:     client,
+	}
+}
+
+func (d *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func (d *DiscordNotifier) Notify(event OOMEvent) error {
+	return d.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (d *DiscordNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	title, text := eventTitle(event)
+
+	embed := DiscordEmbed{
+		Title:     title,
+		Color:     discordRed,
+		Timestamp: time.UnixMilli(event.Time).UTC().Format(time.RFC3339),
+	}
+	for _, field := range eventFields(event) {
+		embed.Fields = append(embed.Fields, DiscordField{
+			Name:   field.Title,
+			Value:  discordValue(field.Value),
+			Inline: field.Short,
+		})
+	}
+
+	embeds := []DiscordEmbed{embed}
+	if event.Report != "" {
+		embeds = append(embeds, DiscordEmbed{
+			Title:       "Kernel OOM Report",
+			Description: "```" + event.Report + "```",
+			Color:       discordRed,
+		})
+	}
+	if event.Context != "" {
+		embeds = append(embeds, DiscordEmbed{
+			Title:       "Kernel Log Context",
+			Description: "```" + event.Context + "```",
+			Color:       discordRed,
+		})
+	}
+
+	payload := DiscordPayload{
+		Username: "oom-notifier",
+		Content:  text,
+		Embeds:   embeds,
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal discord payload: %v", err)
+	}
+
+	req, err := newJSONRequest(ctx, d.WebhookURL, jsonPayload)
+	if err != nil {
+		return err
+	}
+
+	resp, _, err := doRequest(d.client, req)
+	if err != nil {
+		return fmt.Errorf("failed to send discord notification: %v", err)
+	}
+
+	// Discord answers 204 No Content, or 200 when ?wait=true is set
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discord API returned unexpected status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func discordValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return truncate(value, discordFieldLimit)
+}
@@ -0,0 +1,87 @@
+package notifier
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDiscordEmbed(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusNoContent)
+	d := NewDiscordNotifier(webhook.URL, NewHTTPClient(5*time.Second, nil))
+
+	if err := d.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify with 204 No Content: %v", err)
+	}
+
+	var payload DiscordPayload
+	webhook.last(t, &payload)
+	if len(payload.Embeds) != 1 {
+		t.Fatalf("%d embeds, want 1", len(payload.Embeds))
+	}
+	embed := payload.Embeds[0]
+	if embed.Title == "" || embed.Color != discordRed || embed.Timestamp != "2024-05-01T12:00:00Z" {
+		t.Errorf("embed = %+v, want a title, the OOM color and the kill time", embed)
+	}
+	values := make(map[string]string)
+	for _, field := range embed.Fields {
+		values[field.Name] = field.Value
+	}
+	for name, want := range map[string]string{
+		"Process Command": "stress --vm 1",
+		"Process ID":      "4242",
+		"Hostname":        "node-1",
+		"Kernel Version":  "-",
+	} {
+		if values[name] != want {
+			t.Errorf("field %s = %q, want %q", name, values[name], want)
+		}
+	}
+	if _, ok := values["Time"]; !ok {
+		t.Error("embed lacks the time")
+	}
+}
+
+func TestDiscordStatus(t *testing.T) {
+	for status, ok := range map[int]bool{
+		http.StatusNoContent:  true,
+		http.StatusOK:         true,
+		http.StatusBadRequest: false,
+	} {
+		webhook := newTestWebhook(t, status)
+		err := NewDiscordNotifier(webhook.URL, NewHTTPClient(5*time.Second, nil)).Notify(testEvent())
+		if (err == nil) != ok {
+			t.Errorf("status %d: Notify = %v, want success %v", status, err, ok)
+		}
+	}
+}
+
+func TestDiscordReportEmbed(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusNoContent)
+	event := testEvent()
+	event.Report = "Mem-Info:\nactive_anon:1024"
+	if err := NewDiscordNotifier(webhook.URL, NewHTTPClient(5*time.Second, nil)).Notify(event); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload DiscordPayload
+	webhook.last(t, &payload)
+	if len(payload.Embeds) != 2 || payload.Embeds[1].Description != "```"+event.Report+"```" {
+		t.Errorf("embeds = %+v, want the report in a second embed", payload.Embeds)
+	}
+}
+
+func TestDiscordContextEmbed(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusNoContent)
+	event := testEvent()
+	event.Context = "Free swap  = 0kB\nOut of memory: Killed process 4242 (stress)\noom_reaper: reaped process 4242 (stress)"
+	if err := NewDiscordNotifier(webhook.URL, NewHTTPClient(5*time.Second, nil)).Notify(event); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload DiscordPayload
+	webhook.last(t, &payload)
+	if len(payload.Embeds) != 2 || payload.Embeds[1].Title != "Kernel Log Context" || payload.Embeds[1].Description != "```"+event.Context+"```" {
+		t.Errorf("embeds = %+v, want the context in a second embed", payload.Embeds)
+	}
+}
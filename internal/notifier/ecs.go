@@ -0,0 +1,335 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/kube"
+)
+
+// Schemas of the JSON events written by the webhook notifier,
+// --print-events and --audit-file, see EventEncoding.
+const (
+	// SchemaNative is the format of MarshalEvent.
+	SchemaNative = "native"
+	// SchemaECS is an Elastic Common Schema document, see MarshalECS.
+	SchemaECS = "ecs"
+)
+
+// ECSVersion is the version of the Elastic Common Schema MarshalECS follows.
+const ECSVersion = "8.11.0"
+
+// EventEncoding is how an output writes events as JSON. The zero value is
+// MarshalEvent.
+type EventEncoding struct {
+	// Schema is SchemaNative or SchemaECS, empty for SchemaNative.
+	Schema string
+	// Naming is the naming convention of the keys of native events,
+	// NamingSnake or NamingCamel, empty for NamingSnake.
+	Naming string
+	// EmptyFields is how native events handle empty fields, EmptyDefault,
+	// EmptyOmit or EmptyKeep, empty for EmptyDefault.
+	EmptyFields string
+}
+
+// ParseSchema validates an output schema name.
+func ParseSchema(schema string) (string, error) {
+	switch schema {
+	case SchemaNative, SchemaECS:
+		return schema, nil
+	}
+	return "", fmt.Errorf("invalid output schema %q, expected %s or %s", schema, SchemaNative, SchemaECS)
+}
+
+// Marshal returns the JSON representation of event in the schema of e.
+func (e EventEncoding) Marshal(event OOMEvent) ([]byte, error) {
+	if e.Schema == SchemaECS {
+		return MarshalECS(event)
+	}
+	if e.styled() {
+		return e.marshalStyled(event)
+	}
+	return MarshalEvent(event)
+}
+
+// ecsDocument is an event in the Elastic Common Schema. The details ECS has
+// no field for are kept under oom_notifier, custom fields being allowed
+// outside the ECS field sets.
+type ecsDocument struct {
+	Timestamp    string             `json:"@timestamp"`
+	ECS          ecsVersion         `json:"ecs"`
+	Message      string             `json:"message,omitempty"`
+	Event        ecsEvent           `json:"event"`
+	Host         ecsHost            `json:"host"`
+	Process      *ecsProcess        `json:"process,omitempty"`
+	User         *ecsUser           `json:"user,omitempty"`
+	Container    *ecsContainer      `json:"container,omitempty"`
+	Orchestrator *ecsOrchestrator   `json:"orchestrator,omitempty"`
+	Labels       map[string]string  `json:"labels,omitempty"`
+	OOMNotifier  ecsOOMNotifierData `json:"oom_notifier"`
+}
+
+type ecsVersion struct {
+	Version string `json:"version"`
+}
+
+type ecsEvent struct {
+	ID       string   `json:"id,omitempty"`
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Type     []string `json:"type"`
+	Action   string   `json:"action"`
+	Dataset  string   `json:"dataset"`
+	Severity int      `json:"severity"`
+	Original string   `json:"original,omitempty"`
+}
+
+type ecsHost struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	OS       *struct {
+		Kernel string `json:"kernel"`
+	} `json:"os,omitempty"`
+}
+
+type ecsProcess struct {
+	PID         int               `json:"pid,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	CommandLine string            `json:"command_line,omitempty"`
+	Args        []string          `json:"args,omitempty"`
+	ArgsCount   int               `json:"args_count,omitempty"`
+	EnvVars     []string          `json:"env_vars,omitempty"`
+	Parent      *ecsParentProcess `json:"parent,omitempty"`
+}
+
+type ecsParentProcess struct {
+	PID         int    `json:"pid,omitempty"`
+	CommandLine string `json:"command_line,omitempty"`
+}
+
+type ecsUser struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type ecsContainer struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name,omitempty"`
+	Image *struct {
+		Name string `json:"name"`
+	} `json:"image,omitempty"`
+}
+
+type ecsOrchestrator struct {
+	Type      string `json:"type"`
+	Namespace string `json:"namespace,omitempty"`
+	Resource  struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	} `json:"resource"`
+}
+
+// ecsOOMNotifierData are the fields of the event without an ECS equivalent,
+// named as in MarshalEvent.
+type ecsOOMNotifierData struct {
+	SchemaVersion    int              `json:"schema_version"`
+	Kind             string           `json:"kind"`
+	Severity         string           `json:"severity,omitempty"`
+	Fingerprint      string           `json:"fingerprint,omitempty"`
+	Test             bool             `json:"test,omitempty"`
+	Reaped           bool             `json:"reaped,omitempty"`
+	Repeats          int              `json:"repeats,omitempty"`
+	Occurrences      int              `json:"occurrences,omitempty"`
+	Suppressed       int              `json:"suppressed,omitempty"`
+	RestartCount     int              `json:"restart_count,omitempty"`
+	KillCount        uint64           `json:"kill_count,omitempty"`
+	FingerprintKills int              `json:"fingerprint_kill_count,omitempty"`
+	OOMType          string           `json:"oom_type,omitempty"`
+	Constraint       string           `json:"constraint,omitempty"`
+	Cgroup           string           `json:"cgroup,omitempty"`
+	TaskCgroup       string           `json:"task_cgroup,omitempty"`
+	TriggerPID       string           `json:"trigger_pid,omitempty"`
+	TriggerCmdline   string           `json:"trigger_cmdline,omitempty"`
+	Ancestry         []string         `json:"ancestry,omitempty"`
+	AllocOrder       string           `json:"alloc_order,omitempty"`
+	GFPFlags         string           `json:"gfp_flags,omitempty"`
+	TotalVM          string           `json:"total_vm_kb,omitempty"`
+	AnonRSS          string           `json:"anon_rss_kb,omitempty"`
+	FileRSS          string           `json:"file_rss_kb,omitempty"`
+	ShmemRSS         string           `json:"shmem_rss_kb,omitempty"`
+	OOMScoreAdj      string           `json:"oom_score_adj,omitempty"`
+	OOMScore         string           `json:"oom_score,omitempty"`
+	FreeSwap         string           `json:"free_swap_kb,omitempty"`
+	TotalSwap        string           `json:"total_swap_kb,omitempty"`
+	TopConsumers     []MemoryConsumer `json:"top_consumers,omitempty"`
+	Report           string           `json:"report,omitempty"`
+	Context          string           `json:"context,omitempty"`
+}
+
+// MarshalECS returns event as an Elastic Common Schema document, ready to
+// be indexed by Elasticsearch: the kill time as @timestamp, the victim
+// under process, its owner under user, its container and pod under
+// container and orchestrator, and the action as event.action, oom_kill for
+// OOM kills and the event kind otherwise. Event fields added by enrichment
+// are labels.
+func MarshalECS(event OOMEvent) ([]byte, error) {
+	return json.Marshal(ecsDocumentOf(event))
+}
+
+func ecsDocumentOf(event OOMEvent) ecsDocument {
+	timestamp := time.Now()
+	if event.Time != 0 {
+		timestamp = time.UnixMilli(event.Time)
+	}
+	kind := event.Kind
+	if kind == "" {
+		kind = "oom"
+	}
+
+	doc := ecsDocument{
+		Timestamp: timestamp.UTC().Format(time.RFC3339Nano),
+		ECS:       ecsVersion{Version: ECSVersion},
+		Message:   eventSubject(event),
+		Event:     ecsEventOf(event, kind),
+		Host:      ecsHost{Name: event.Hostname, Hostname: event.Hostname},
+		Labels:    event.Fields,
+		OOMNotifier: ecsOOMNotifierData{
+			SchemaVersion:    EventSchemaVersion,
+			Kind:             kind,
+			Severity:         event.Severity,
+			Fingerprint:      event.GroupKey,
+			Test:             event.Test,
+			Reaped:           event.Reaped,
+			Repeats:          event.Repeats,
+			Occurrences:      event.Occurrences,
+			Suppressed:       event.Suppressed,
+			RestartCount:     event.RestartCount,
+			KillCount:        event.KillCount,
+			FingerprintKills: event.FingerprintKills,
+			OOMType:          event.OOMType,
+			Constraint:       event.Constraint,
+			Cgroup:           event.Cgroup,
+			TaskCgroup:       event.TaskCgroup,
+			TriggerPID:       event.TriggerPID,
+			TriggerCmdline:   event.TriggerCmdline,
+			Ancestry:         event.Ancestry,
+			AllocOrder:       event.AllocOrder,
+			GFPFlags:         event.GFPFlags,
+			TotalVM:          event.TotalVM,
+			AnonRSS:          event.AnonRSS,
+			FileRSS:          event.FileRSS,
+			ShmemRSS:         event.ShmemRSS,
+			OOMScoreAdj:      event.OOMScoreAdj,
+			OOMScore:         event.OOMScore,
+			FreeSwap:         event.FreeSwap,
+			TotalSwap:        event.TotalSwap,
+			TopConsumers:     event.TopConsumers,
+			Report:           event.Report,
+			Context:          event.Context,
+		},
+	}
+	if event.Kernel != "" {
+		doc.Host.OS = &struct {
+			Kernel string `json:"kernel"`
+		}{event.Kernel}
+	}
+	doc.Process = ecsProcessOf(event)
+	if event.UID != "" || event.User != "" {
+		doc.User = &ecsUser{ID: event.UID, Name: event.User}
+	}
+	doc.Container = ecsContainerOf(event)
+	if event.PodName != "" {
+		doc.Orchestrator = &ecsOrchestrator{Type: "kubernetes", Namespace: event.Namespace}
+		doc.Orchestrator.Resource.Type = "pod"
+		doc.Orchestrator.Resource.Name = event.PodName
+	}
+	return doc
+}
+
+// ecsEventOf fills the event field set: OOM kills end a process, memory
+// pressure is about the host, and events are alerts but for recoveries,
+// which report a state.
+func ecsEventOf(event OOMEvent, kind string) ecsEvent {
+	ecs := ecsEvent{
+		ID:       event.ID,
+		Kind:     "alert",
+		Category: []string{"process"},
+		Type:     []string{"info"},
+		Action:   kind,
+		Dataset:  "oom_notifier.events",
+		Severity: 3,
+		Original: event.Message,
+	}
+	if severity, known := syslogSeverities[event.Severity]; known {
+		ecs.Severity = severity
+	}
+	switch kind {
+	case "oom", "cgroup_oom":
+		ecs.Action = "oom_kill"
+		ecs.Type = []string{"end"}
+	case "memory_pressure":
+		ecs.Category = []string{"host"}
+	case KindRecovery:
+		ecs.Kind = "state"
+	}
+	return ecs
+}
+
+// ecsProcessOf fills the process field set, nil for events without one.
+func ecsProcessOf(event OOMEvent) *ecsProcess {
+	if event.PID == "" && event.Cmdline == "" {
+		return nil
+	}
+	process := &ecsProcess{
+		CommandLine: event.Cmdline,
+		Args:        event.Args,
+		ArgsCount:   len(event.Args),
+	}
+	process.PID, _ = strconv.Atoi(event.PID)
+	switch {
+	case len(event.Args) > 0:
+		process.Name = path.Base(event.Args[0])
+	case strings.HasPrefix(event.Cmdline, "[") && strings.HasSuffix(event.Cmdline, "]"):
+		// Kernel threads and exiting processes are named after their comm
+		process.Name = strings.Trim(event.Cmdline, "[]")
+	default:
+		if fields := strings.Fields(event.Cmdline); len(fields) > 0 {
+			process.Name = path.Base(fields[0])
+		}
+	}
+	for key, value := range event.Env {
+		process.EnvVars = append(process.EnvVars, key+"="+value)
+	}
+	sort.Strings(process.EnvVars)
+	if event.ParentPID != "" || event.ParentCmdline != "" {
+		process.Parent = &ecsParentProcess{CommandLine: event.ParentCmdline}
+		process.Parent.PID, _ = strconv.Atoi(event.ParentPID)
+	}
+	return process
+}
+
+// ecsContainerOf fills the container field set from the container named by
+// enrichment and the ID in the victim's cgroup, nil outside containers.
+func ecsContainerOf(event OOMEvent) *ecsContainer {
+	container := &ecsContainer{Name: event.ContainerName}
+	for _, cgroup := range []string{event.TaskCgroup, event.Cgroup} {
+		if id, _ := kube.ParseCgroup(cgroup); id != "" {
+			container.ID = id
+			break
+		}
+	}
+	if event.ContainerImage != "" {
+		container.Image = &struct {
+			Name string `json:"name"`
+		}{event.ContainerImage}
+	}
+	if container.ID == "" && container.Name == "" && container.Image == nil {
+		return nil
+	}
+	return container
+}
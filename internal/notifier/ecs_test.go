@@ -0,0 +1,202 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testContainerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// decodeJSON decodes data into a generic JSON object.
+func decodeJSON(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	return doc
+}
+
+// lookup returns the value at the dotted path in doc, nil when missing.
+func lookup(doc map[string]any, path string) any {
+	var value any = doc
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+func TestMarshalECS(t *testing.T) {
+	event := testEvent()
+	event.Kernel = "6.1.0"
+	event.Args = []string{"/usr/bin/stress", "--vm", "1"}
+	event.Env = map[string]string{"POD_NAME": "stress-1", "APP": "load"}
+	event.UID = "1000"
+	event.User = "app"
+	event.ParentPID = "4200"
+	event.ParentCmdline = "bash"
+	event.Cgroup = "/kubepods/burstable/pod1234"
+	event.TaskCgroup = "/kubepods/burstable/pod1234/cri-containerd-" + testContainerID + ".scope"
+	event.PodName = "stress-1"
+	event.Namespace = "load"
+	event.ContainerName = "stress"
+	event.ContainerImage = "polinux/stress:1.0"
+	event.Fields = map[string]string{"team": "platform"}
+	event.GroupKey = "0011223344556677"
+	event.AnonRSS = "1048576"
+
+	data, err := MarshalECS(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := decodeJSON(t, data)
+
+	for path, want := range map[string]any{
+		"@timestamp":                  "2024-05-01T12:00:00Z",
+		"ecs.version":                 ECSVersion,
+		"event.action":                "oom_kill",
+		"event.kind":                  "alert",
+		"event.category":              []any{"process"},
+		"event.type":                  []any{"end"},
+		"event.severity":              float64(2),
+		"event.original":              event.Message,
+		"host.name":                   "node-1",
+		"host.os.kernel":              "6.1.0",
+		"process.pid":                 float64(4242),
+		"process.name":                "stress",
+		"process.command_line":        "stress --vm 1",
+		"process.args":                []any{"/usr/bin/stress", "--vm", "1"},
+		"process.args_count":          float64(3),
+		"process.env_vars":            []any{"APP=load", "POD_NAME=stress-1"},
+		"process.parent.pid":          float64(4200),
+		"process.parent.command_line": "bash",
+		"user.id":                     "1000",
+		"user.name":                   "app",
+		"container.id":                testContainerID,
+		"container.name":              "stress",
+		"container.image.name":        "polinux/stress:1.0",
+		"orchestrator.type":           "kubernetes",
+		"orchestrator.namespace":      "load",
+		"orchestrator.resource.type":  "pod",
+		"orchestrator.resource.name":  "stress-1",
+		"labels.team":                 "platform",
+		"oom_notifier.schema_version": float64(EventSchemaVersion),
+		"oom_notifier.kind":           "oom",
+		"oom_notifier.oom_type":       "memcg",
+		"oom_notifier.cgroup":         "/kubepods/burstable/pod1234",
+		"oom_notifier.fingerprint":    "0011223344556677",
+		"oom_notifier.anon_rss_kb":    "1048576",
+	} {
+		if got := lookup(doc, path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", path, got, want)
+		}
+	}
+	if message, _ := doc["message"].(string); !strings.Contains(message, "stress") {
+		t.Errorf("message %q, want the event summary", message)
+	}
+}
+
+func TestMarshalECSOmitsMissingFieldSets(t *testing.T) {
+	data, err := MarshalECS(OOMEvent{Kind: "memory_pressure", Hostname: "node-1", Time: 1, Severity: SeverityPressure})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := decodeJSON(t, data)
+	for _, set := range []string{"process", "user", "container", "orchestrator", "labels"} {
+		if _, found := doc[set]; found {
+			t.Errorf("%s set for an event without one: %s", set, data)
+		}
+	}
+	for path, want := range map[string]any{
+		"event.action":   "memory_pressure",
+		"event.category": []any{"host"},
+		"event.type":     []any{"info"},
+		"event.severity": float64(5),
+	} {
+		if got := lookup(doc, path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", path, got, want)
+		}
+	}
+}
+
+func TestECSEventKinds(t *testing.T) {
+	for _, tc := range []struct {
+		event  OOMEvent
+		action string
+		kind   string
+	}{
+		{OOMEvent{Kind: ""}, "oom_kill", "alert"},
+		{OOMEvent{Kind: "cgroup_oom"}, "oom_kill", "alert"},
+		{OOMEvent{Kind: "segfault"}, "segfault", "alert"},
+		{OOMEvent{Kind: KindRecovery, Severity: SeverityRecovered}, KindRecovery, "state"},
+	} {
+		doc := ecsDocumentOf(tc.event)
+		if doc.Event.Action != tc.action || doc.Event.Kind != tc.kind {
+			t.Errorf("%q: action %q kind %q, want %q and %q", tc.event.Kind, doc.Event.Action, doc.Event.Kind, tc.action, tc.kind)
+		}
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	for _, schema := range []string{SchemaNative, SchemaECS} {
+		if _, err := ParseSchema(schema); err != nil {
+			t.Errorf("ParseSchema(%q): %v", schema, err)
+		}
+	}
+	if _, err := ParseSchema("otel"); err == nil {
+		t.Error("ParseSchema accepted an unknown schema")
+	}
+}
+
+func TestEventEncodingSchemas(t *testing.T) {
+	event := testEvent()
+	native, err := EventEncoding{}.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := MarshalEvent(event); !bytes.Equal(native, want) {
+		t.Errorf("zero encoding wrote %s, want MarshalEvent", native)
+	}
+	ecs, err := EventEncoding{Schema: SchemaECS}.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lookup(decodeJSON(t, ecs), "process.pid") != float64(4242) {
+		t.Errorf("ECS encoding wrote %s", ecs)
+	}
+}
+
+func TestWebhookECSOutput(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	w := NewWebhookNotifier(webhook.URL, "", NewHTTPClient(0, nil))
+	w.Encoding = EventEncoding{Schema: SchemaECS}
+
+	if err := w.Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	webhook.last(t, &doc)
+	if lookup(doc, "event.action") != "oom_kill" || lookup(doc, "host.name") != "node-1" {
+		t.Errorf("posted %v, want an ECS document", doc)
+	}
+}
+
+func TestStdoutECSOutput(t *testing.T) {
+	var out bytes.Buffer
+	s := NewStdoutNotifier(&out)
+	s.Encoding = EventEncoding{Schema: SchemaECS}
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if lookup(decodeJSON(t, out.Bytes()), "process.command_line") != "stress --vm 1" {
+		t.Errorf("wrote %s, want an ECS document", out.Bytes())
+	}
+}
@@ -0,0 +1,134 @@
+package notifier
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EmailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+type EmailNotifier struct {
+	config  EmailConfig
+	timeout time.Duration
+}
+
+func NewEmailNotifier(cfg EmailConfig) *EmailNotifier {
+	return &EmailNotifier{
+		config:  cfg,
+		timeout: 10 * time.Second,
+	}
+}
+
+func (e *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (e *EmailNotifier) Notify(event OOMEvent) error {
+	return e.send(eventSubject(event), emailBody(event))
+}
+
+func (e *EmailNotifier) NotifyText(text string) error {
+	return e.send(text, text+"\r\n")
+}
+
+func (e *EmailNotifier) send(subject, body string) error {
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	conn, err := net.DialTimeout("tcp", addr, e.timeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(e.timeout))
+
+	client, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %v", err)
+	}
+	defer client.Close()
+
+	// Submission port requires STARTTLS before credentials are sent
+	if e.config.Port == 587 {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: e.config.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %v", err)
+		}
+	}
+
+	if e.config.Username != "" {
+		auth := smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %v", err)
+		}
+	}
+
+	if err := client.Mail(e.config.From); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %v", err)
+	}
+	for _, rcpt := range e.config.To {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %v", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %v", err)
+	}
+	if _, err := w.Write([]byte(e.message(subject, body))); err != nil {
+		return fmt.Errorf("failed to write email: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return client.Quit()
+}
+
+func (e *EmailNotifier) message(subject, body string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	return b.String()
+}
+
+func emailBody(event OOMEvent) string {
+	title, _ := eventTitle(event)
+
+	var b strings.Builder
+	b.WriteString(title + "\r\n\r\n")
+	for _, field := range eventFields(event) {
+		fmt.Fprintf(&b, "%s: %s\r\n", field.Title, field.Value)
+	}
+	if event.Report != "" {
+		b.WriteString("\r\nKernel OOM Report:\r\n")
+		b.WriteString(strings.ReplaceAll(event.Report, "\n", "\r\n"))
+		b.WriteString("\r\n")
+	}
+	if event.Context != "" {
+		b.WriteString("\r\nKernel Log Context:\r\n")
+		b.WriteString(strings.ReplaceAll(event.Context, "\n", "\r\n"))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
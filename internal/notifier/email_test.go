@@ -0,0 +1,151 @@
+package notifier
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpStub is an SMTP server accepting every message and recording its
+// envelope and data.
+type smtpStub struct {
+	net.Listener
+	mu   sync.Mutex
+	from string
+	to   []string
+	// data is the message as read by textproto, with LF line endings
+	data string
+	done chan struct{}
+}
+
+func newSMTPStub(t *testing.T) *smtpStub {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStub{Listener: l, done: make(chan struct{})}
+	t.Cleanup(func() { l.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpStub) serve() {
+	conn, err := s.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	defer close(s.done)
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 stub ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 stub")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.TrimPrefix(arg, "FROM:")
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "RCPT":
+			s.mu.Lock()
+			s.to = append(s.to, strings.TrimPrefix(arg, "TO:"))
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpStub) config() EmailConfig {
+	host, port, _ := net.SplitHostPort(s.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return EmailConfig{
+		Host: host,
+		Port: n,
+		From: "oom@example.com",
+		To:   []string{"ops@example.com", "oncall@example.com"},
+	}
+}
+
+func TestEmailEnvelopeAndBody(t *testing.T) {
+	stub := newSMTPStub(t)
+	event := testEvent()
+	event.Report = "Mem-Info:\nactive_anon:1024"
+	event.Context = "Free swap  = 0kB\nOut of memory: Killed process 4242 (stress)"
+
+	if err := NewEmailNotifier(stub.config()).Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	<-stub.done
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.from != "<oom@example.com>" {
+		t.Errorf("MAIL FROM %s, want <oom@example.com>", stub.from)
+	}
+	if strings.Join(stub.to, " ") != "<ops@example.com> <oncall@example.com>" {
+		t.Errorf("RCPT TO %v, want both recipients", stub.to)
+	}
+
+	header, body, ok := strings.Cut(stub.data, "\n\n")
+	if !ok {
+		t.Fatalf("message without a body:\n%s", stub.data)
+	}
+	msg, err := textproto.NewReader(bufio.NewReader(strings.NewReader(header + "\n\n"))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("invalid header: %v", err)
+	}
+	if got := msg.Get("Subject"); got != "OOM killed stress --vm 1 on node-1" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got := msg.Get("To"); got != "ops@example.com, oncall@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	for _, want := range []string{
+		"Process Command: stress --vm 1\n",
+		"Process ID: 4242\n",
+		"Hostname: node-1\n",
+		"Kernel OOM Report:\nMem-Info:\nactive_anon:1024\n",
+		"Kernel Log Context:\nFree swap  = 0kB\nOut of memory: Killed process 4242 (stress)\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body lacks %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestEmailFailsWithoutServer(t *testing.T) {
+	stub := newSMTPStub(t)
+	cfg := stub.config()
+	stub.Close()
+
+	if err := NewEmailNotifier(cfg).Notify(testEvent()); err == nil {
+		t.Error("Notify succeeded without an SMTP server")
+	}
+}
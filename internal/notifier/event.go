@@ -0,0 +1,606 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// costlyAllocOrder mirrors the kernel's PAGE_ALLOC_COSTLY_ORDER: allocations
+// above it fail on fragmentation rather than plain exhaustion.
+const costlyAllocOrder = 3
+
+// maxConsumerCmdline caps each command line in the top consumers list.
+const maxConsumerCmdline = 80
+
+// Notifier delivers OOM events to a backend.
+type Notifier interface {
+	Name() string
+	Notify(event OOMEvent) error
+}
+
+// ContextNotifier is implemented by notifiers whose deliveries can be
+// cancelled, such as those making HTTP requests. Their Notify delivers with
+// context.Background().
+type ContextNotifier interface {
+	NotifyContext(ctx context.Context, event OOMEvent) error
+}
+
+// BatchNotifier is implemented by notifiers that can deliver the events
+// flushed together, e.g. at the end of a batch window, in one request.
+type BatchNotifier interface {
+	NotifyBatch(ctx context.Context, events []OOMEvent) error
+}
+
+// TextNotifier is implemented by notifiers that can deliver plain text
+// messages about the notifier itself.
+type TextNotifier interface {
+	NotifyText(text string) error
+}
+
+// TextContextNotifier is implemented by text notifiers whose deliveries can
+// be cancelled. Their NotifyText delivers with context.Background().
+type TextContextNotifier interface {
+	NotifyTextContext(ctx context.Context, text string) error
+}
+
+type OOMEvent struct {
+	// ID identifies a kernel event across restarts of the monitor that
+	// detected it, empty when it cannot be identified.
+	ID       string            `json:"id,omitempty"`
+	Kind     string            `json:"kind"`
+	Message  string            `json:"message"`
+	Cmdline  string            `json:"cmdline"`
+	Args     []string          `json:"args,omitempty"`
+	PID      string            `json:"pid"`
+	Hostname string            `json:"hostname"`
+	Kernel   string            `json:"kernel"`
+	Time     int64             `json:"time"`
+	Env      map[string]string `json:"env,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Report   string            `json:"report,omitempty"`
+	Reaped   bool              `json:"reaped,omitempty"`
+
+	// Context holds the kernel messages logged around the kill line.
+	Context string `json:"context,omitempty"`
+
+	// Test marks a synthetic event sent to check the configuration.
+	Test bool `json:"test,omitempty"`
+
+	// GroupKey is the Fingerprint of the event, set once it is enriched.
+	GroupKey string `json:"fingerprint,omitempty"`
+
+	// Severity is SeverityWarning, SeverityCritical or SeverityPressure,
+	// see EventSeverity, or SeverityHigh when the event keeps repeating,
+	// Repeats being its occurrences within the flap window, or
+	// SeverityRecovered once it stopped, see FlapDetector.Recovered.
+	Severity string `json:"severity,omitempty"`
+	Repeats  int    `json:"repeats,omitempty"`
+
+	// UID and User identify the owner of the killed process.
+	UID  string `json:"uid,omitempty"`
+	User string `json:"user,omitempty"`
+
+	ParentPID     string `json:"parent_pid,omitempty"`
+	ParentCmdline string `json:"parent_cmdline,omitempty"`
+
+	// Ancestry names the victim's ancestors, outermost first and ending
+	// with the victim, when --include-ancestry is set.
+	Ancestry []string `json:"ancestry,omitempty"`
+
+	// TriggerPID and TriggerCmdline describe the task whose allocation
+	// invoked the OOM killer, which may differ from the victim.
+	TriggerPID     string `json:"trigger_pid,omitempty"`
+	TriggerCmdline string `json:"trigger_cmdline,omitempty"`
+
+	// Occurrences is the number of kills this event stands for when
+	// sampling folded repeats into it.
+	Occurrences int `json:"occurrences,omitempty"`
+
+	// Suppressed is the number of duplicates dropped by deduplication since
+	// the previous alert for the same event.
+	Suppressed int `json:"suppressed,omitempty"`
+
+	// KillCount numbers the OOM kills since oom-notifier started and
+	// FingerprintKills those of the same fingerprint, this one included.
+	// Both start over on restart.
+	KillCount        uint64 `json:"kill_count,omitempty"`
+	FingerprintKills int    `json:"fingerprint_kill_count,omitempty"`
+
+	AllocOrder string `json:"alloc_order,omitempty"`
+	GFPFlags   string `json:"gfp_flags,omitempty"`
+
+	// Memory figures of the victim from the kill line, sizes in kB.
+	TotalVM     string `json:"total_vm_kb,omitempty"`
+	AnonRSS     string `json:"anon_rss_kb,omitempty"`
+	FileRSS     string `json:"file_rss_kb,omitempty"`
+	ShmemRSS    string `json:"shmem_rss_kb,omitempty"`
+	OOMScoreAdj string `json:"oom_score_adj,omitempty"`
+	OOMScore    string `json:"oom_score,omitempty"`
+	FreeSwap    string `json:"free_swap_kb,omitempty"`
+	TotalSwap   string `json:"total_swap_kb,omitempty"`
+
+	// OOMType is "memcg" for cgroup limit kills and "global" otherwise.
+	OOMType    string `json:"oom_type,omitempty"`
+	Cgroup     string `json:"cgroup,omitempty"`
+	TaskCgroup string `json:"task_cgroup,omitempty"`
+
+	// Constraint is the kernel's OOM constraint, e.g. "memcg" or "cpuset".
+	Constraint string `json:"constraint,omitempty"`
+
+	// Kubernetes pod the victim ran in, resolved from its cgroup.
+	// ContainerName is empty when only the pod is known; on plain Docker
+	// hosts it names the Docker container, with its ContainerImage.
+	PodName        string `json:"pod,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+	ContainerName  string `json:"container,omitempty"`
+	ContainerImage string `json:"image,omitempty"`
+	// RestartCount is the number of restarts of the Kubernetes container,
+	// a climbing count hinting at an OOM crash loop, see CrashLooping.
+	RestartCount int `json:"restart_count,omitempty"`
+
+	// TopConsumers are the largest other processes by RSS before a global
+	// OOM kill.
+	TopConsumers []MemoryConsumer `json:"top_consumers,omitempty"`
+}
+
+// EventSchemaVersion is the schema_version of the JSON written by
+// MarshalEvent. Bump it whenever a JSON field of OOMEvent or MemoryConsumer
+// is added, removed, renamed or changes meaning.
+const EventSchemaVersion = 6
+
+// MarshalEvent returns the JSON representation of event shared by every
+// notifier and output emitting events as JSON, the fields of OOMEvent led
+// by schema_version, so that external consumers can depend on one
+// versioned format.
+func MarshalEvent(event OOMEvent) ([]byte, error) {
+	return json.Marshal(struct {
+		SchemaVersion int `json:"schema_version"`
+		OOMEvent
+	}{EventSchemaVersion, event})
+}
+
+// MemoryConsumer is a process and its last-known RSS.
+type MemoryConsumer struct {
+	PID     string `json:"pid"`
+	Cmdline string `json:"cmdline"`
+	RSS     string `json:"rss_kb"`
+}
+
+// Field is a titled value rendered by the chat notifiers.
+type Field struct {
+	Title string
+	Value string
+	Short bool
+}
+
+// eventTitle returns the headline and summary text for an event.
+func eventTitle(event OOMEvent) (string, string) {
+	if event.Test {
+		return "🧪 Test Notification: no OOM occurred", "oom-notifier Test Alert"
+	}
+
+	switch event.Kind {
+	case "", "oom":
+		return "🚨 Out of Memory (OOM) Event Detected", "OOM Killer Alert"
+	case "segfault":
+		return "💥 Segmentation Fault Detected", "Kernel Event Alert"
+	case "trap":
+		return "💥 Process Trap Detected", "Kernel Event Alert"
+	case "hung_task":
+		return "⏳ Hung Task Detected", "Kernel Event Alert"
+	case "cgroup_oom":
+		return "🚨 Cgroup OOM Kill Detected", "OOM Killer Alert"
+	case "memory_pressure":
+		return "📈 Memory Pressure Warning", "Memory Pressure Warning"
+	case KindRecovery:
+		return "✅ Recovered: Event Stopped Repeating", "OOM Recovery"
+	default:
+		return fmt.Sprintf("⚠️ Kernel Event Detected: %s", event.Kind), "Kernel Event Alert"
+	}
+}
+
+// maxSubjectCmdline bounds the command line quoted in a subject line.
+const maxSubjectCmdline = 100
+
+// eventSubject returns a one-line plain text summary of an event, used as the
+// subject of emails and SNS messages.
+func eventSubject(event OOMEvent) string {
+	subject := fmt.Sprintf("OOM killed %s on %s", truncate(displayCmdline(event.Cmdline), maxSubjectCmdline), event.Hostname)
+	switch event.Kind {
+	case "", "oom":
+	case "memory_pressure":
+		subject = fmt.Sprintf("Memory pressure on %s", event.Hostname)
+	case KindRecovery:
+		subject = fmt.Sprintf("Recovered: %s on %s stopped repeating", truncate(displayCmdline(event.Cmdline), maxSubjectCmdline), event.Hostname)
+	default:
+		subject = fmt.Sprintf("Kernel %s: %s on %s", event.Kind, truncate(displayCmdline(event.Cmdline), maxSubjectCmdline), event.Hostname)
+	}
+	if CrashLooping(event) {
+		subject += fmt.Sprintf(", crash looping after %d restarts", event.RestartCount)
+	}
+	if event.Test {
+		subject = "[TEST] " + subject
+	}
+	return subject
+}
+
+// eventFields returns the fields describing an event, in display order,
+// limited to those selected with SetFields.
+func eventFields(event OOMEvent) []Field {
+	fields := []Field{
+		{
+			Title: "Process Command",
+			Value: displayCmdline(event.Cmdline),
+			Short: false,
+		},
+		{
+			Title: "Process ID",
+			Value: event.PID,
+			Short: true,
+		},
+		{
+			Title: "Hostname",
+			Value: event.Hostname,
+			Short: true,
+		},
+		{
+			Title: "Kernel Version",
+			Value: event.Kernel,
+			Short: true,
+		},
+		{
+			Title: "Time",
+			Value: formatEventTime(event.Time),
+			Short: true,
+		},
+	}
+
+	if event.Severity != "" {
+		value := event.Severity
+		if event.Repeats > 0 {
+			value = flapText(event)
+		}
+		fields = append(fields, Field{
+			Title: "Severity",
+			Value: value,
+			Short: true,
+		})
+	}
+	// A crash loop is the first thing to know about the kill
+	if CrashLooping(event) {
+		fields = append(fields, Field{
+			Title: "Restarts",
+			Value: restartText(event),
+			Short: true,
+		})
+	}
+
+	if event.UID != "" {
+		owner := event.UID
+		if event.User != "" {
+			owner = fmt.Sprintf("%s (%s)", event.User, event.UID)
+		}
+		fields = append(fields, Field{
+			Title: "User",
+			Value: owner,
+			Short: true,
+		})
+	}
+
+	if event.ParentPID != "" {
+		parent := fmt.Sprintf("PID %s (exited)", event.ParentPID)
+		if event.ParentCmdline != "" {
+			parent = fmt.Sprintf("%s (PID %s)", displayCmdline(event.ParentCmdline), event.ParentPID)
+		}
+		fields = append(fields, Field{
+			Title: "Parent Process",
+			Value: parent,
+			Short: false,
+		})
+	}
+
+	// A victim that triggered the OOM itself needs no second mention
+	if event.TriggerCmdline != "" && (event.TriggerPID == "" || event.TriggerPID != event.PID) {
+		trigger := displayCmdline(event.TriggerCmdline)
+		if event.TriggerPID != "" {
+			trigger = fmt.Sprintf("%s (PID %s)", trigger, event.TriggerPID)
+		}
+		fields = append(fields, Field{
+			Title: "Triggered By",
+			Value: trigger,
+			Short: false,
+		})
+	}
+
+	if len(event.Ancestry) > 1 {
+		fields = append(fields, Field{
+			Title: "Process Ancestry",
+			Value: strings.Join(event.Ancestry, " → "),
+			Short: false,
+		})
+	}
+
+	if event.OOMType != "" {
+		oomType := event.OOMType
+		switch oomType {
+		case "memcg":
+			oomType += " (cgroup limit)"
+		case "global":
+			oomType += " (system out of memory)"
+		}
+		fields = append(fields, Field{
+			Title: "OOM Type",
+			Value: oomType,
+			Short: true,
+		})
+	}
+	if event.Constraint == "cpuset" || event.Constraint == "memory_policy" {
+		// memcg and none are already told apart by the OOM type
+		fields = append(fields, Field{
+			Title: "Constraint",
+			Value: event.Constraint,
+			Short: true,
+		})
+	}
+	if event.Cgroup != "" {
+		fields = append(fields, Field{
+			Title: "Cgroup",
+			Value: event.Cgroup,
+			Short: false,
+		})
+	}
+	if event.PodName != "" {
+		fields = append(fields, Field{
+			Title: "Pod",
+			Value: event.Namespace + "/" + event.PodName,
+			Short: true,
+		})
+	}
+	if event.ContainerName != "" {
+		fields = append(fields, Field{
+			Title: "Container",
+			Value: event.ContainerName,
+			Short: true,
+		})
+	}
+	if event.ContainerImage != "" {
+		fields = append(fields, Field{
+			Title: "Image",
+			Value: event.ContainerImage,
+			Short: true,
+		})
+	}
+	if event.RestartCount > 0 && !CrashLooping(event) {
+		fields = append(fields, Field{
+			Title: "Restarts",
+			Value: restartText(event),
+			Short: true,
+		})
+	}
+
+	for _, memory := range []struct{ title, kb string }{
+		{"Anon RSS", event.AnonRSS},
+		{"File RSS", event.FileRSS},
+		{"Shmem RSS", event.ShmemRSS},
+		{"Total VM", event.TotalVM},
+	} {
+		if memory.kb != "" {
+			fields = append(fields, Field{
+				Title: memory.title,
+				Value: formatKB(memory.kb),
+				Short: true,
+			})
+		}
+	}
+	if event.TotalSwap != "" {
+		swap := "none"
+		if event.TotalSwap != "0" {
+			swap = fmt.Sprintf("%s free of %s", formatKB(event.FreeSwap), formatKB(event.TotalSwap))
+		}
+		fields = append(fields, Field{
+			Title: "Swap",
+			Value: swap,
+			Short: true,
+		})
+	}
+	if event.OOMScoreAdj != "" {
+		fields = append(fields, Field{
+			Title: "OOM Score Adj",
+			Value: event.OOMScoreAdj,
+			Short: true,
+		})
+	}
+	if event.OOMScore != "" {
+		fields = append(fields, Field{
+			Title: "OOM Score",
+			Value: event.OOMScore,
+			Short: true,
+		})
+	}
+
+	if len(event.TopConsumers) > 0 {
+		lines := make([]string, 0, len(event.TopConsumers))
+		for _, consumer := range event.TopConsumers {
+			lines = append(lines, fmt.Sprintf("%s  %s (PID %s)",
+				formatKB(consumer.RSS), truncate(consumer.Cmdline, maxConsumerCmdline), consumer.PID))
+		}
+		fields = append(fields, Field{
+			Title: "Top Memory Consumers",
+			Value: strings.Join(lines, "\n"),
+			Short: false,
+		})
+	}
+
+	if event.AllocOrder != "" {
+		order := event.AllocOrder
+		if n, err := strconv.Atoi(order); err == nil && n > costlyAllocOrder {
+			order += " (high-order, fragmentation likely)"
+		}
+		fields = append(fields,
+			Field{
+				Title: "Failed Allocation Order",
+				Value: order,
+				Short: true,
+			},
+			Field{
+				Title: "GFP Flags",
+				Value: event.GFPFlags,
+				Short: true,
+			},
+		)
+	}
+
+	if event.Occurrences > 1 {
+		fields = append(fields, Field{
+			Title: "Occurrences",
+			Value: fmt.Sprintf("%d kills since last alert (sampled)", event.Occurrences),
+			Short: true,
+		})
+	}
+
+	if event.KillCount > 0 {
+		fields = append(fields, Field{
+			Title: "Kills Since Start",
+			Value: fmt.Sprintf("%d, %d of this process", event.KillCount, event.FingerprintKills),
+			Short: true,
+		})
+	}
+
+	if event.Suppressed > 0 {
+		fields = append(fields, Field{
+			Title: "Suppressed Repeats",
+			Value: fmt.Sprintf("suppressed %d repeats since last alert", event.Suppressed),
+			Short: true,
+		})
+	}
+
+	if event.Reaped {
+		fields = append(fields, Field{
+			Title: "Kill Confirmed",
+			Value: "Memory reclaimed by oom_reaper",
+			Short: true,
+		})
+	}
+
+	if event.Kind != "" && event.Kind != "oom" {
+		fields = append(fields, Field{
+			Title: "Kernel Message",
+			Value: event.Message,
+			Short: false,
+		})
+	}
+
+	// Extra fields and variables may have any name, select them before
+	// they are added
+	fields = selectFields(fields)
+
+	if fieldSelected("fields") {
+		for _, name := range sortedKeys(event.Fields) {
+			fields = append(fields, Field{
+				Title: name,
+				Value: event.Fields[name],
+				Short: true,
+			})
+		}
+	}
+
+	if fieldSelected("env") {
+		for _, name := range sortedKeys(event.Env) {
+			fields = append(fields, Field{
+				Title: name,
+				Value: event.Env[name],
+				Short: true,
+			})
+		}
+	}
+
+	return fields
+}
+
+// location is the time zone event times are rendered in.
+var location = time.UTC
+
+// SetTimezone sets the IANA time zone used to render event times, UTC
+// until set. An unknown zone is reported as an error and leaves the zone in
+// use unchanged.
+func SetTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("failed to load timezone %q: %v", name, err)
+	}
+	location = loc
+	return nil
+}
+
+// formatEventTime renders a millisecond timestamp with the zone abbreviation.
+func formatEventTime(millis int64) string {
+	return time.UnixMilli(millis).In(location).Format("2006-01-02 15:04:05 MST")
+}
+
+// formatKB renders a size in kB as a human readable value.
+func formatKB(kb string) string {
+	n, err := strconv.ParseFloat(kb, 64)
+	if err != nil {
+		return kb + " kB"
+	}
+
+	units := []string{"kB", "MB", "GB", "TB"}
+	unit := 0
+	for n >= 1024 && unit < len(units)-1 {
+		n /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[unit])
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// maxCmdlineLen bounds the command lines shown in notifications, 0 shows
+// them whole.
+var maxCmdlineLen int
+
+// SetMaxCmdlineLen sets the length in bytes that command lines are
+// truncated to in notifications, and beyond which they are fingerprinted by
+// their normalized form. The events themselves keep the whole command line.
+// 0 disables both. It must be called before events are sent.
+func SetMaxCmdlineLen(n int) {
+	maxCmdlineLen = n
+}
+
+// displayCmdline returns cmdline as shown in notifications.
+func displayCmdline(cmdline string) string {
+	if maxCmdlineLen <= 0 {
+		return cmdline
+	}
+	return truncate(cmdline, maxCmdlineLen)
+}
+
+// truncate shortens s to at most max bytes, ending with "..." when cut, and
+// never splits a multi-byte character.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	cut := max - 3
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
@@ -0,0 +1,371 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestSetTimezone(t *testing.T) {
+	t.Cleanup(func() { location = time.UTC })
+	// 2024-01-15 12:00:00 UTC, outside daylight saving time in the north
+	millis := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC).UnixMilli()
+
+	for _, tt := range []struct {
+		zone, want string
+	}{
+		{"UTC", "2024-01-15 12:00:00 UTC"},
+		{"America/New_York", "2024-01-15 07:00:00 EST"},
+		{"America/Los_Angeles", "2024-01-15 04:00:00 PST"},
+		{"Asia/Kolkata", "2024-01-15 17:30:00 IST"},
+	} {
+		if err := SetTimezone(tt.zone); err != nil {
+			t.Fatalf("SetTimezone(%q): %v", tt.zone, err)
+		}
+		if got := formatEventTime(millis); got != tt.want {
+			t.Errorf("%s: formatEventTime = %q, want %q", tt.zone, got, tt.want)
+		}
+	}
+
+	// An unknown zone keeps the one in use
+	if err := SetTimezone("Mars/Olympus_Mons"); err == nil {
+		t.Fatal("SetTimezone accepted an unknown zone")
+	}
+	if got, want := formatEventTime(millis), "2024-01-15 17:30:00 IST"; got != want {
+		t.Errorf("after an unknown zone, formatEventTime = %q, want %q", got, want)
+	}
+}
+
+func TestMemoryFields(t *testing.T) {
+	event := testEvent()
+	for _, title := range []string{"Anon RSS", "Total VM", "OOM Score Adj"} {
+		if fieldIndex(eventFields(event), title) >= 0 {
+			t.Errorf("event without memory figures lists %s", title)
+		}
+	}
+
+	event.AnonRSS, event.TotalVM, event.FileRSS, event.OOMScoreAdj = "1000000", "1050000", "4", "-998"
+	fields := eventFields(event)
+	for title, want := range map[string]string{
+		"Anon RSS":      "976.6 MB",
+		"Total VM":      "1.0 GB",
+		"File RSS":      "4 kB",
+		"OOM Score Adj": "-998",
+	} {
+		if i := fieldIndex(fields, title); i < 0 || fields[i].Value != want {
+			t.Errorf("%s field of %+v, want %s", title, fields, want)
+		}
+	}
+	if fieldIndex(fields, "Shmem RSS") >= 0 {
+		t.Error("Shmem RSS listed although the kernel did not log it")
+	}
+}
+
+func TestOOMScoreField(t *testing.T) {
+	event := testEvent()
+	if fieldIndex(eventFields(event), "OOM Score") >= 0 {
+		t.Error("event without an OOM score lists one")
+	}
+	event.OOMScore = "912"
+	fields := eventFields(event)
+	if i := fieldIndex(fields, "OOM Score"); i < 0 || fields[i].Value != "912" {
+		t.Errorf("fields = %+v, want the OOM score", fields)
+	}
+}
+
+func TestAncestryField(t *testing.T) {
+	event := testEvent()
+	event.Ancestry = []string{"stress"}
+	if fieldIndex(eventFields(event), "Process Ancestry") >= 0 {
+		t.Error("ancestry of only the victim listed")
+	}
+	event.Ancestry = []string{"systemd", "supervisord", "gunicorn", "worker"}
+	fields := eventFields(event)
+	if i := fieldIndex(fields, "Process Ancestry"); i < 0 || fields[i].Value != "systemd → supervisord → gunicorn → worker" {
+		t.Errorf("fields = %+v, want the ancestry chain", fields)
+	}
+}
+
+func TestTriggeredByField(t *testing.T) {
+	victim := testEvent()
+	victim.TriggerPID, victim.TriggerCmdline = "4242", "stress --vm 1"
+	exited := testEvent()
+	exited.TriggerCmdline = "[java]"
+	other := testEvent()
+	other.TriggerPID, other.TriggerCmdline = "5151", "java -jar app.jar"
+
+	for _, tt := range []struct {
+		name  string
+		event OOMEvent
+		want  string
+	}{
+		{"no trigger", testEvent(), ""},
+		{"victim triggered", victim, ""},
+		{"PID unknown", exited, "[java]"},
+		{"other process", other, "java -jar app.jar (PID 5151)"},
+	} {
+		var got string
+		fields := eventFields(tt.event)
+		if i := fieldIndex(fields, "Triggered By"); i >= 0 {
+			got = fields[i].Value
+		}
+		if got != tt.want {
+			t.Errorf("%s: Triggered By %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOOMTypeFields(t *testing.T) {
+	memcg := testEvent()
+	memcg.Cgroup = "/kubepods/burstable/pod1234"
+	global := testEvent()
+	global.OOMType = "global"
+
+	for _, tt := range []struct {
+		event   OOMEvent
+		oomType string
+	}{
+		{memcg, "memcg (cgroup limit)"},
+		{global, "global (system out of memory)"},
+	} {
+		fields := eventFields(tt.event)
+		if i := fieldIndex(fields, "OOM Type"); i < 0 || fields[i].Value != tt.oomType {
+			t.Errorf("OOM Type field of %+v, want %s", fields, tt.oomType)
+		}
+	}
+
+	fields := eventFields(memcg)
+	if i := fieldIndex(fields, "Cgroup"); i < 0 || fields[i].Value != memcg.Cgroup {
+		t.Errorf("fields = %+v, want the limiting cgroup", fields)
+	}
+	if fieldIndex(eventFields(global), "Cgroup") >= 0 {
+		t.Error("global OOM lists a cgroup")
+	}
+}
+
+func TestUserField(t *testing.T) {
+	event := testEvent()
+	if fieldIndex(eventFields(event), "User") >= 0 {
+		t.Error("event without a UID lists a user")
+	}
+
+	event.UID = "3999999"
+	fields := eventFields(event)
+	if i := fieldIndex(fields, "User"); i < 0 || fields[i].Value != "3999999" {
+		t.Errorf("fields = %+v, want the UID alone", fields)
+	}
+	event.User = "deploy"
+	fields = eventFields(event)
+	if i := fieldIndex(fields, "User"); i < 0 || fields[i].Value != "deploy (3999999)" {
+		t.Errorf("fields = %+v, want the username and UID", fields)
+	}
+}
+
+func TestKillCountField(t *testing.T) {
+	event := testEvent()
+	if fieldIndex(eventFields(event), "Kills Since Start") >= 0 {
+		t.Error("event without a kill count lists one")
+	}
+
+	for i, fingerprintKills := range []int{1, 2, 1} {
+		event.KillCount = uint64(10 + i)
+		event.FingerprintKills = fingerprintKills
+		fields := eventFields(event)
+		want := fmt.Sprintf("%d, %d of this process", 10+i, fingerprintKills)
+		if j := fieldIndex(fields, "Kills Since Start"); j < 0 || fields[j].Value != want {
+			t.Errorf("fields = %+v, want %q", fields, want)
+		}
+	}
+}
+
+func TestParentProcessField(t *testing.T) {
+	event := testEvent()
+	event.ParentPID = "100"
+	fields := eventFields(event)
+	if i := fieldIndex(fields, "Parent Process"); i < 0 || fields[i].Value != "PID 100 (exited)" {
+		t.Errorf("fields = %+v, want the exited parent", fields)
+	}
+
+	event.ParentCmdline = "supervisord -c /etc/supervisord.conf"
+	fields = eventFields(event)
+	if i := fieldIndex(fields, "Parent Process"); i < 0 || fields[i].Value != "supervisord -c /etc/supervisord.conf (PID 100)" {
+		t.Errorf("fields = %+v, want the parent's command line", fields)
+	}
+}
+
+func TestTopConsumersField(t *testing.T) {
+	event := testEvent()
+	if fieldIndex(eventFields(event), "Top Memory Consumers") >= 0 {
+		t.Error("event without consumers lists them")
+	}
+
+	event.TopConsumers = []MemoryConsumer{
+		{PID: "11", Cmdline: "java -jar app.jar", RSS: "4194304"},
+		{PID: "10", Cmdline: "postgres", RSS: "512"},
+	}
+	fields := eventFields(event)
+	i := fieldIndex(fields, "Top Memory Consumers")
+	if want := "4.0 GB  java -jar app.jar (PID 11)\n512 kB  postgres (PID 10)"; i < 0 || fields[i].Value != want {
+		t.Errorf("fields = %+v, want\n%s", fields, want)
+	}
+}
+
+func TestDisplayCmdlineTruncates(t *testing.T) {
+	t.Cleanup(func() { SetMaxCmdlineLen(0) })
+	long := "java -Xmx4g -XX:+UseG1GC -jar billing.jar"
+
+	SetMaxCmdlineLen(0)
+	if got := displayCmdline(long); got != long {
+		t.Errorf("displayCmdline without a limit = %q, want it whole", got)
+	}
+
+	SetMaxCmdlineLen(len(long))
+	if got := displayCmdline(long); got != long {
+		t.Errorf("displayCmdline at the limit = %q, want it whole", got)
+	}
+	SetMaxCmdlineLen(len(long) - 1)
+	if got, want := displayCmdline(long), long[:len(long)-4]+"..."; got != want {
+		t.Errorf("displayCmdline one byte over the limit = %q, want %q", got, want)
+	}
+}
+
+func TestDisplayCmdlineKeepsRunesWhole(t *testing.T) {
+	t.Cleanup(func() { SetMaxCmdlineLen(0) })
+	SetMaxCmdlineLen(16)
+	// Each ü is two bytes; the limit would cut the fourth in half
+	cmdline := "python3 üüüüüüüü.py"
+	got := displayCmdline(cmdline)
+	if !utf8.ValidString(got) || len(got) > 16 || !strings.HasSuffix(got, "...") {
+		t.Errorf("displayCmdline = %q (%d bytes), want valid UTF-8 of at most 16 bytes ending in ...", got, len(got))
+	}
+	if want := "python3 üü..."; got != want {
+		t.Errorf("displayCmdline = %q, want %q", got, want)
+	}
+}
+
+func TestCommandFieldTruncatedEventKept(t *testing.T) {
+	t.Cleanup(func() { SetMaxCmdlineLen(0) })
+	SetMaxCmdlineLen(16)
+	event := testEvent()
+	event.Cmdline = "java -Xmx4g -XX:+UseG1GC -jar billing.jar"
+	event.ParentPID = "1"
+	event.ParentCmdline = "/usr/lib/systemd/systemd --switched-root"
+
+	fields := eventFields(event)
+	if i := fieldIndex(fields, "Process Command"); i < 0 || fields[i].Value != "java -Xmx4g -..." {
+		t.Errorf("fields = %+v, want the command truncated", fields)
+	}
+	if i := fieldIndex(fields, "Parent Process"); i < 0 || fields[i].Value != "/usr/lib/syst... (PID 1)" {
+		t.Errorf("fields = %+v, want the parent truncated", fields)
+	}
+	if event.Cmdline != "java -Xmx4g -XX:+UseG1GC -jar billing.jar" {
+		t.Errorf("event command line changed to %q", event.Cmdline)
+	}
+}
+
+func TestMarshalEventShape(t *testing.T) {
+	event := testEvent()
+	event.TopConsumers = []MemoryConsumer{{PID: "4343", Cmdline: "java", RSS: "1024"}}
+	data, err := MarshalEvent(event)
+	if err != nil {
+		t.Fatalf("MarshalEvent: %v", err)
+	}
+	if want := fmt.Sprintf(`{"schema_version":%d,`, EventSchemaVersion); !bytes.HasPrefix(data, []byte(want)) {
+		t.Errorf("MarshalEvent = %s, want it led by %s", data, want)
+	}
+
+	doc := decodeJSON(t, data)
+	for key, want := range map[string]any{
+		"schema_version": float64(EventSchemaVersion),
+		"kind":           "oom",
+		"pid":            "4242",
+		"cmdline":        "stress --vm 1",
+		"hostname":       "node-1",
+		"time":           float64(event.Time),
+		"severity":       "critical",
+		"oom_type":       "memcg",
+		"top_consumers":  []any{map[string]any{"pid": "4343", "cmdline": "java", "rss_kb": "1024"}},
+	} {
+		if got := doc[key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+
+	var decoded OOMEvent
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, event) {
+		t.Errorf("decoded %+v (%v), want the event back", decoded, err)
+	}
+}
+
+func TestJSONNotifiersUseMarshalEvent(t *testing.T) {
+	want, err := MarshalEvent(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, written := range map[string]func(t *testing.T) []byte{
+		"webhook": func(t *testing.T) []byte {
+			url, requests := newSigningWebhook(t, http.StatusOK)
+			if err := NewWebhookNotifier(url, "", NewHTTPClient(5*time.Second, nil)).Notify(testEvent()); err != nil {
+				t.Fatal(err)
+			}
+			return (*requests)[0].body
+		},
+		"stdout": func(t *testing.T) []byte {
+			var out bytes.Buffer
+			if err := NewStdoutNotifier(&out).Notify(testEvent()); err != nil {
+				t.Fatal(err)
+			}
+			return bytes.TrimSuffix(out.Bytes(), []byte("\n"))
+		},
+		"sns": func(t *testing.T) []byte {
+			client := &fakeSNS{}
+			if err := (&SNSNotifier{TopicARN: testTopicARN, client: client}).Notify(testEvent()); err != nil {
+				t.Fatal(err)
+			}
+			return []byte(aws.ToString(client.inputs[0].Message))
+		},
+		"kafka": func(t *testing.T) []byte {
+			producer := &fakeProducer{}
+			k := newTestKafka(t, producer)
+			defer k.Close()
+			if err := k.Notify(testEvent()); err != nil {
+				t.Fatal(err)
+			}
+			return producer.produced()[0].Value
+		},
+		"nats": func(t *testing.T) []byte {
+			publisher := &fakePublisher{}
+			n := newTestNATS(t, publisher)
+			defer n.Close()
+			if err := n.Notify(testEvent()); err != nil {
+				t.Fatal(err)
+			}
+			_, data, _ := strings.Cut(publisher.messages()[0], " ")
+			return []byte(data)
+		},
+		"loki": func(t *testing.T) []byte {
+			webhook := newTestWebhook(t, http.StatusNoContent)
+			if err := newTestLoki(webhook).Notify(testEvent()); err != nil {
+				t.Fatal(err)
+			}
+			var payload LokiPayload
+			webhook.last(t, &payload)
+			return []byte(payload.Streams[0].Values[0][1])
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := written(t); !bytes.Equal(got, want) {
+				t.Errorf("wrote %s, want MarshalEvent\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package notifier
+
+import "time"
+
+// ExponentialSampler thins out bursts of the same event: within a burst
+// only the 1st, 2nd, 4th, 8th... occurrence of a fingerprint is delivered.
+// A burst ends when the fingerprint has not been seen for the window, and
+// the next occurrence is delivered as a 1st again. Delivered events carry
+// the number of occurrences they stand for.
+type ExponentialSampler struct {
+	window    time.Duration
+	bursts    map[string]*burst
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// burst tracks the occurrences of a fingerprint since the last quiet period.
+type burst struct {
+	count     int
+	delivered int
+	last      time.Time
+}
+
+func NewExponentialSampler(window time.Duration) *ExponentialSampler {
+	return &ExponentialSampler{
+		window: window,
+		bursts: make(map[string]*burst),
+		now:    time.Now,
+	}
+}
+
+// Sample counts event and reports whether it should be delivered. When it
+// should, the returned event has Occurrences set to the occurrences since
+// the previous delivery, this one included.
+func (s *ExponentialSampler) Sample(event OOMEvent) (OOMEvent, bool) {
+	now := s.now()
+	s.prune(now)
+
+	key := event.GroupKey
+	if key == "" {
+		key = event.Fingerprint()
+	}
+	b, found := s.bursts[key]
+	if !found || now.Sub(b.last) >= s.window {
+		b = &burst{}
+		s.bursts[key] = b
+	}
+	b.count++
+	b.last = now
+
+	// count is a power of two
+	if b.count&(b.count-1) != 0 {
+		return event, false
+	}
+	event.Occurrences = b.count - b.delivered
+	b.delivered = b.count
+	return event, true
+}
+
+// prune forgets the bursts that ended, at most once per window.
+func (s *ExponentialSampler) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < s.window {
+		return
+	}
+	for key, b := range s.bursts {
+		if now.Sub(b.last) >= s.window {
+			delete(s.bursts, key)
+		}
+	}
+	s.lastPrune = now
+}
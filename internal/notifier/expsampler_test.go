@@ -0,0 +1,65 @@
+package notifier
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestExponentialSampler(window time.Duration) (*ExponentialSampler, *fakeClock) {
+	s := NewExponentialSampler(window)
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	s.now = clock.Now
+	return s, clock
+}
+
+func TestExponentialSamplerForwardsPowersOfTwo(t *testing.T) {
+	s, clock := newTestExponentialSampler(time.Hour)
+
+	var delivered, occurrences []int
+	for i := 1; i <= 100; i++ {
+		if event, ok := s.Sample(testEvent()); ok {
+			delivered = append(delivered, i)
+			occurrences = append(occurrences, event.Occurrences)
+		}
+		clock.Advance(time.Second)
+	}
+	if want := []int{1, 2, 4, 8, 16, 32, 64}; !reflect.DeepEqual(delivered, want) {
+		t.Errorf("delivered occurrences %v of a burst of 100, want %v", delivered, want)
+	}
+	if want := []int{1, 1, 2, 4, 8, 16, 32}; !reflect.DeepEqual(occurrences, want) {
+		t.Errorf("Occurrences %v, want the occurrences since the previous delivery %v", occurrences, want)
+	}
+}
+
+func TestExponentialSamplerResetsAfterQuietPeriod(t *testing.T) {
+	s, clock := newTestExponentialSampler(time.Hour)
+	for i := 0; i < 5; i++ {
+		s.Sample(testEvent())
+	}
+
+	clock.Advance(time.Hour)
+	event, ok := s.Sample(testEvent())
+	if !ok || event.Occurrences != 1 {
+		t.Errorf("Sample after a quiet window = %v with %d occurrences, want a new burst", ok, event.Occurrences)
+	}
+	if _, ok := s.Sample(testEvent()); !ok {
+		t.Error("2nd occurrence of the new burst not delivered")
+	}
+}
+
+func TestExponentialSamplerKeysOnFingerprint(t *testing.T) {
+	s, _ := newTestExponentialSampler(time.Hour)
+	s.Sample(testEvent())
+	s.Sample(testEvent())
+	s.Sample(testEvent())
+
+	other := testEvent()
+	other.Hostname = "node-2"
+	if _, ok := s.Sample(other); !ok {
+		t.Error("1st occurrence on another host held back by the burst on node-1")
+	}
+	if _, ok := s.Sample(testEvent()); !ok {
+		t.Error("4th occurrence on node-1 not delivered")
+	}
+}
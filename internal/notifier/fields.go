@@ -0,0 +1,106 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+)
+
+// fieldTitles maps the names accepted by ParseFields to the titles of the
+// fields rendered by eventFields. The fields and env names stand for the
+// extra fields and captured environment variables of an event.
+var fieldTitles = map[string]string{
+	"cmdline":       "Process Command",
+	"pid":           "Process ID",
+	"hostname":      "Hostname",
+	"kernel":        "Kernel Version",
+	"time":          "Time",
+	"severity":      "Severity",
+	"user":          "User",
+	"parent":        "Parent Process",
+	"ancestry":      "Process Ancestry",
+	"trigger":       "Triggered By",
+	"oom_type":      "OOM Type",
+	"constraint":    "Constraint",
+	"cgroup":        "Cgroup",
+	"pod":           "Pod",
+	"container":     "Container",
+	"image":         "Image",
+	"restarts":      "Restarts",
+	"anon_rss":      "Anon RSS",
+	"file_rss":      "File RSS",
+	"shmem_rss":     "Shmem RSS",
+	"total_vm":      "Total VM",
+	"swap":          "Swap",
+	"oom_score_adj": "OOM Score Adj",
+	"oom_score":     "OOM Score",
+	"top_consumers": "Top Memory Consumers",
+	"alloc_order":   "Failed Allocation Order",
+	"gfp_flags":     "GFP Flags",
+	"occurrences":   "Occurrences",
+	"kill_count":    "Kills Since Start",
+	"suppressed":    "Suppressed Repeats",
+	"reaped":        "Kill Confirmed",
+	"message":       "Kernel Message",
+	"fields":        "",
+	"env":           "",
+}
+
+// selectedFields are the names of the fields rendered, nil renders all of
+// them. Set by SetFields.
+var selectedFields map[string]bool
+
+// FieldNames returns the names accepted by ParseFields, sorted.
+func FieldNames() []string {
+	return sortedKeys(fieldTitles)
+}
+
+// ParseFields returns the set of field names in a comma separated list, e.g.
+// "pid,cmdline,hostname,time". An empty list selects every field.
+func ParseFields(list string) (map[string]bool, error) {
+	var selected map[string]bool
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, known := fieldTitles[name]; !known {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", name, strings.Join(FieldNames(), ", "))
+		}
+		if selected == nil {
+			selected = make(map[string]bool)
+		}
+		selected[name] = true
+	}
+	return selected, nil
+}
+
+// SetFields limits the fields rendered by the chat and email notifiers to
+// selected, see ParseFields. It must be called before events are sent.
+func SetFields(selected map[string]bool) {
+	selectedFields = selected
+}
+
+// fieldSelected reports whether the field named name is rendered.
+func fieldSelected(name string) bool {
+	return selectedFields == nil || selectedFields[name]
+}
+
+// selectFields drops the fields whose name is not selected.
+func selectFields(fields []Field) []Field {
+	if selectedFields == nil {
+		return fields
+	}
+	titles := make(map[string]bool, len(selectedFields))
+	for name := range selectedFields {
+		if title := fieldTitles[name]; title != "" {
+			titles[title] = true
+		}
+	}
+	kept := fields[:0]
+	for _, field := range fields {
+		if titles[field.Title] {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
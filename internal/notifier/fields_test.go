@@ -0,0 +1,128 @@
+package notifier
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useFields selects the fields named in list for the duration of the test.
+func useFields(t *testing.T, list string) {
+	t.Helper()
+	selected, err := ParseFields(list)
+	if err != nil {
+		t.Fatalf("ParseFields: %v", err)
+	}
+	SetFields(selected)
+	t.Cleanup(func() { SetFields(nil) })
+}
+
+// titles returns the titles of fields in order.
+func titles(fields []Field) []string {
+	var out []string
+	for _, field := range fields {
+		out = append(out, field.Title)
+	}
+	return out
+}
+
+func TestParseFields(t *testing.T) {
+	selected, err := ParseFields(" pid, cmdline,hostname ,,time")
+	if err != nil {
+		t.Fatalf("ParseFields: %v", err)
+	}
+	if want := map[string]bool{"pid": true, "cmdline": true, "hostname": true, "time": true}; !reflect.DeepEqual(selected, want) {
+		t.Errorf("ParseFields = %v, want %v", selected, want)
+	}
+	if selected, err := ParseFields(""); err != nil || selected != nil {
+		t.Errorf("ParseFields(\"\") = %v, %v, want every field", selected, err)
+	}
+}
+
+func TestParseFieldsRejectsUnknownField(t *testing.T) {
+	_, err := ParseFields("pid,kernel_version")
+	if err == nil {
+		t.Fatal("unknown field accepted")
+	}
+	if !strings.Contains(err.Error(), `"kernel_version"`) || !strings.Contains(err.Error(), "cmdline, constraint") {
+		t.Errorf("error %q, want the unknown field and the known ones", err)
+	}
+}
+
+func TestSelectedFieldsOnly(t *testing.T) {
+	useFields(t, "hostname,pid,env")
+	event := testEvent()
+	event.Env = map[string]string{"APP_ENV": "production"}
+	event.Fields = map[string]string{"team": "payments"}
+
+	// Fields keep their display order, not the order they were listed in
+	want := []string{"Process ID", "Hostname", "APP_ENV"}
+	if got := titles(eventFields(event)); !reflect.DeepEqual(got, want) {
+		t.Errorf("fields %v, want %v", got, want)
+	}
+}
+
+func TestAllFieldsWithoutSelection(t *testing.T) {
+	SetFields(nil)
+	event := testEvent()
+	event.Fields = map[string]string{"team": "payments"}
+	got := make(map[string]bool)
+	for _, title := range titles(eventFields(event)) {
+		got[title] = true
+	}
+	for _, want := range []string{"Process Command", "Process ID", "Hostname", "OOM Type", "team"} {
+		if !got[want] {
+			t.Errorf("fields %v lack %q", got, want)
+		}
+	}
+}
+
+func TestChatNotifiersRenderSelectedFields(t *testing.T) {
+	useFields(t, "cmdline,hostname")
+	want := []string{"Process Command", "Hostname"}
+
+	webhook := newTestWebhook(t, http.StatusOK)
+	if err := newTestSlack(SlackModeAll, webhook).Notify(testEvent()); err != nil {
+		t.Fatalf("Slack Notify: %v", err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	var slack []string
+	for _, field := range payload.Attachments[0].Fields {
+		slack = append(slack, field.Title)
+	}
+	if !reflect.DeepEqual(slack, want) {
+		t.Errorf("Slack fields %v, want %v", slack, want)
+	}
+
+	teams, cards := newTestTeams(t, "1")
+	if err := teams.Notify(testEvent()); err != nil {
+		t.Fatalf("Teams Notify: %v", err)
+	}
+	var facts []string
+	for _, fact := range (*cards)[0].Sections[0].Facts {
+		facts = append(facts, fact.Name)
+	}
+	if !reflect.DeepEqual(facts, want) {
+		t.Errorf("Teams facts %v, want %v", facts, want)
+	}
+}
+
+func TestEmailRendersSelectedFields(t *testing.T) {
+	useFields(t, "cmdline")
+	stub := newSMTPStub(t)
+	if err := NewEmailNotifier(stub.config()).Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	<-stub.done
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if !strings.Contains(stub.data, "Process Command: stress --vm 1\n") {
+		t.Errorf("message lacks the command line:\n%s", stub.data)
+	}
+	if strings.Contains(stub.data, "Process ID: ") || strings.Contains(stub.data, "Hostname: ") {
+		t.Errorf("message shows fields not selected:\n%s", stub.data)
+	}
+}
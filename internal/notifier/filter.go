@@ -0,0 +1,153 @@
+package notifier
+
+import (
+	"fmt"
+	"os/user"
+	"regexp"
+	"strconv"
+)
+
+// CmdlineFilter decides from the command line which events are delivered.
+// An event matching any exclude pattern is dropped; otherwise it is kept when
+// there are no include patterns or it matches one of them.
+type CmdlineFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func NewCmdlineFilter(include, exclude []string) (*CmdlineFilter, error) {
+	f := &CmdlineFilter{}
+	var err error
+	if f.include, err = compilePatterns(include); err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %v", err)
+	}
+	if f.exclude, err = compilePatterns(exclude); err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %v", err)
+	}
+	return f, nil
+}
+
+// Allow reports whether an event for cmdline should be delivered.
+func (f *CmdlineFilter) Allow(cmdline string) bool {
+	for _, pattern := range f.exclude {
+		if pattern.MatchString(cmdline) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if pattern.MatchString(cmdline) {
+			return true
+		}
+	}
+	return false
+}
+
+// UIDFilter decides from the owner of the killed process which events are
+// delivered. An event of an excluded UID is dropped; otherwise it is kept
+// when there are no included UIDs or its UID is one of them. Events that
+// report no UID, such as kills of unknown processes, are always kept.
+type UIDFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// NewUIDFilter creates a filter from numeric UIDs and user names, which are
+// resolved to their UID now.
+func NewUIDFilter(include, exclude []string) (*UIDFilter, error) {
+	f := &UIDFilter{}
+	var err error
+	if f.include, err = resolveUIDs(include); err != nil {
+		return nil, fmt.Errorf("invalid included user: %v", err)
+	}
+	if f.exclude, err = resolveUIDs(exclude); err != nil {
+		return nil, fmt.Errorf("invalid excluded user: %v", err)
+	}
+	return f, nil
+}
+
+// Allow reports whether event should be delivered.
+func (f *UIDFilter) Allow(event OOMEvent) bool {
+	if event.UID == "" {
+		return true
+	}
+	if f.exclude[event.UID] {
+		return false
+	}
+	return len(f.include) == 0 || f.include[event.UID]
+}
+
+// resolveUIDs returns the set of UIDs of users, each a numeric UID or a
+// user name.
+func resolveUIDs(users []string) (map[string]bool, error) {
+	uids := make(map[string]bool, len(users))
+	for _, name := range users {
+		if _, err := strconv.ParseUint(name, 10, 32); err == nil {
+			uids[name] = true
+			continue
+		}
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		uids[u.Uid] = true
+	}
+	return uids, nil
+}
+
+// RSSFilter drops events for processes whose memory at the time of the kill
+// was below a threshold. Events that report no memory usage, such as
+// segfaults, are always kept.
+type RSSFilter struct {
+	min int64
+}
+
+// NewRSSFilter creates a filter keeping events for processes of at least min
+// bytes.
+func NewRSSFilter(min int64) *RSSFilter {
+	return &RSSFilter{min: min}
+}
+
+// Allow reports whether event should be delivered. The resident size is the
+// sum of the anon, file and shmem RSS from the kill line. When none of them
+// was logged the total VM is used instead, an upper bound on the resident
+// size.
+func (f *RSSFilter) Allow(event OOMEvent) bool {
+	size, ok := sumKB(event.AnonRSS, event.FileRSS, event.ShmemRSS)
+	if !ok {
+		size, ok = sumKB(event.TotalVM)
+	}
+	if !ok {
+		return true
+	}
+	return size*1024 >= f.min
+}
+
+// sumKB adds up the kB values that parse; ok is false when none does.
+func sumKB(values ...string) (int64, bool) {
+	var sum int64
+	var ok bool
+	for _, value := range values {
+		kb, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		sum += kb
+		ok = true
+	}
+	return sum, ok
+}
+
+func compilePatterns(exprs []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
@@ -0,0 +1,158 @@
+package notifier
+
+import "testing"
+
+func TestCmdlineFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		include, exclude []string
+		allowed, dropped []string
+	}{
+		{
+			name:    "no patterns",
+			allowed: []string{"java -jar app.jar", ""},
+		},
+		{
+			name:    "include only",
+			include: []string{"^java ", "^postgres"},
+			allowed: []string{"java -jar app.jar", "postgres: checkpointer"},
+			dropped: []string{"batch-job --date 2024-05-01", ""},
+		},
+		{
+			name:    "exclude only",
+			exclude: []string{"^batch-", "cron"},
+			allowed: []string{"java -jar app.jar"},
+			dropped: []string{"batch-job --date 2024-05-01", "/usr/sbin/cron -f"},
+		},
+		{
+			name:    "exclude wins over include",
+			include: []string{"^java "},
+			exclude: []string{"-Dbatch=true"},
+			allowed: []string{"java -jar app.jar"},
+			dropped: []string{"java -Dbatch=true -jar report.jar", "postgres"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewCmdlineFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("NewCmdlineFilter: %v", err)
+			}
+			for _, cmdline := range tt.allowed {
+				if !f.Allow(cmdline) {
+					t.Errorf("%q dropped", cmdline)
+				}
+			}
+			for _, cmdline := range tt.dropped {
+				if f.Allow(cmdline) {
+					t.Errorf("%q allowed", cmdline)
+				}
+			}
+		})
+	}
+}
+
+func TestCmdlineFilterRejectsInvalidPatterns(t *testing.T) {
+	if _, err := NewCmdlineFilter([]string{"("}, nil); err == nil {
+		t.Error("invalid include pattern accepted")
+	}
+	if _, err := NewCmdlineFilter(nil, []string{"[a-"}); err == nil {
+		t.Error("invalid exclude pattern accepted")
+	}
+}
+
+func TestUIDFilter(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		include, exclude []string
+		allowed, dropped []string
+	}{
+		{
+			name:    "include only",
+			include: []string{"1000", "1001"},
+			allowed: []string{"1000", "1001", ""},
+			dropped: []string{"0", "33"},
+		},
+		{
+			name:    "exclude only",
+			exclude: []string{"0"},
+			allowed: []string{"1000", "65534", ""},
+			dropped: []string{"0"},
+		},
+		{
+			name:    "exclude wins over include",
+			include: []string{"0", "1000"},
+			exclude: []string{"0"},
+			allowed: []string{"1000"},
+			dropped: []string{"0", "1001"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewUIDFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("NewUIDFilter: %v", err)
+			}
+			for _, uid := range tt.allowed {
+				event := testEvent()
+				event.UID = uid
+				if !f.Allow(event) {
+					t.Errorf("UID %q dropped", uid)
+				}
+			}
+			for _, uid := range tt.dropped {
+				event := testEvent()
+				event.UID = uid
+				if f.Allow(event) {
+					t.Errorf("UID %q allowed", uid)
+				}
+			}
+		})
+	}
+}
+
+func TestUIDFilterResolvesUserNames(t *testing.T) {
+	// root is UID 0 wherever the tests run
+	f, err := NewUIDFilter(nil, []string{"root"})
+	if err != nil {
+		t.Fatalf("NewUIDFilter: %v", err)
+	}
+	event := testEvent()
+	event.UID = "0"
+	if f.Allow(event) {
+		t.Error("kill of an excluded user name allowed")
+	}
+
+	if _, err := NewUIDFilter([]string{"no-such-user-oom"}, nil); err == nil {
+		t.Error("unknown user name accepted")
+	}
+}
+
+func TestRSSFilter(t *testing.T) {
+	f := NewRSSFilter(256 << 20)
+	kill := func(anon, file, shmem, totalVM string) OOMEvent {
+		event := testEvent()
+		event.AnonRSS, event.FileRSS, event.ShmemRSS, event.TotalVM = anon, file, shmem, totalVM
+		return event
+	}
+
+	for _, tt := range []struct {
+		name  string
+		event OOMEvent
+		allow bool
+	}{
+		{"above", kill("300000", "0", "0", "400000"), true},
+		{"at the threshold", kill("262144", "", "", ""), true},
+		{"below", kill("1024", "0", "0", "2000000"), false},
+		// anon, file and shmem RSS add up
+		{"sum above", kill("131072", "131072", "0", ""), true},
+		{"total VM without RSS", kill("", "", "", "300000"), true},
+		{"small total VM without RSS", kill("", "", "", "1024"), false},
+		{"unknown size", kill("", "", "", ""), true},
+		{"unparsable size", kill("n/a", "", "", ""), true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.Allow(tt.event); got != tt.allow {
+				t.Errorf("Allow = %v, want %v", got, tt.allow)
+			}
+		})
+	}
+}
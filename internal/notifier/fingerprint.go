@@ -0,0 +1,72 @@
+package notifier
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultFingerprintStrip matches the volatile parts of a command line left
+// out of fingerprints: numbers of five or more digits, such as PIDs and Unix
+// timestamps, and ISO 8601 dates and times.
+const DefaultFingerprintStrip = `\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?)?|\b\d{5,}\b`
+
+// fingerprintStrip is removed from command lines before fingerprinting,
+// nil keeps them whole.
+var fingerprintStrip = regexp.MustCompile(DefaultFingerprintStrip)
+
+// SetFingerprintStrip sets the regular expression whose matches are removed
+// from command lines before fingerprinting. An empty pattern keeps command
+// lines whole. It must be called before events are fingerprinted.
+func SetFingerprintStrip(pattern string) error {
+	if pattern == "" {
+		fingerprintStrip = nil
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid fingerprint pattern: %v", err)
+	}
+	fingerprintStrip = re
+	return nil
+}
+
+// Fingerprint returns a stable key grouping the events of the same process
+// on the same host and of the same OOM type, for alert routing tools to
+// correlate. Volatile arguments are left out of the command line, so a
+// restarted process keeps its fingerprint. Command lines longer than
+// SetMaxCmdlineLen allows are reduced to their normalized form.
+func (e OOMEvent) Fingerprint() string {
+	cmdline := e.Cmdline
+	if fingerprintStrip != nil {
+		cmdline = fingerprintStrip.ReplaceAllString(cmdline, "")
+	}
+	if maxCmdlineLen > 0 && len(cmdline) > maxCmdlineLen {
+		cmdline = normalizeCmdline(cmdline)
+	}
+	cmdline = strings.Join(strings.Fields(cmdline), " ")
+
+	sum := sha256.Sum256([]byte(e.Kind + "\x00" + e.Hostname + "\x00" + cmdline + "\x00" + e.OOMType))
+	return hex.EncodeToString(sum[:8])
+}
+
+// normalizeCmdline reduces a command line to the program name and the
+// arguments that are not options, e.g. the main class or script. Options of
+// long command lines, such as the hundreds of flags of a JVM, tend to change
+// between deployments without changing what runs.
+func normalizeCmdline(cmdline string) string {
+	args := strings.Fields(cmdline)
+	if len(args) == 0 {
+		return cmdline
+	}
+	kept := []string{path.Base(args[0])}
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			kept = append(kept, arg)
+		}
+	}
+	return strings.Join(kept, " ")
+}
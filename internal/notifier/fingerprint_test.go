@@ -0,0 +1,119 @@
+package notifier
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintIsStableAcrossEquivalentEvents(t *testing.T) {
+	base := testEvent()
+	base.Cmdline = "worker --job 18234 --since 2024-05-01T10:00:00Z"
+
+	restarted := base
+	restarted.PID = "5151"
+	restarted.Time += 60000
+	restarted.Cmdline = "worker  --job 99120 --since 2024-05-01T10:05:00Z"
+
+	if base.Fingerprint() != restarted.Fingerprint() {
+		t.Errorf("fingerprints %s and %s differ for the same process restarted", base.Fingerprint(), restarted.Fingerprint())
+	}
+	if got := base.Fingerprint(); len(got) != 16 {
+		t.Errorf("fingerprint %q, want 16 hex digits", got)
+	}
+}
+
+func TestFingerprintDiffersAcrossEvents(t *testing.T) {
+	base := testEvent()
+	for name, change := range map[string]func(*OOMEvent){
+		"hostname": func(e *OOMEvent) { e.Hostname = "node-2" },
+		"command":  func(e *OOMEvent) { e.Cmdline = "postgres" },
+		"oom type": func(e *OOMEvent) { e.OOMType = "global" },
+		"kind":     func(e *OOMEvent) { e.Kind = "memory_pressure" },
+	} {
+		other := base
+		change(&other)
+		if other.Fingerprint() == base.Fingerprint() {
+			t.Errorf("events differing in %s share the fingerprint %s", name, base.Fingerprint())
+		}
+	}
+}
+
+func TestSetFingerprintStrip(t *testing.T) {
+	t.Cleanup(func() { SetFingerprintStrip(DefaultFingerprintStrip) })
+	a, b := testEvent(), testEvent()
+	a.Cmdline, b.Cmdline = "worker --shard=a1", "worker --shard=b7"
+
+	if err := SetFingerprintStrip(`--shard=\w+`); err != nil {
+		t.Fatal(err)
+	}
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Error("custom pattern did not strip the shard")
+	}
+
+	if err := SetFingerprintStrip(""); err != nil {
+		t.Fatal(err)
+	}
+	a.Cmdline, b.Cmdline = "worker 18234", "worker 99120"
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("empty pattern still strips numbers")
+	}
+
+	if err := SetFingerprintStrip("("); err == nil || !strings.Contains(err.Error(), "invalid fingerprint pattern") {
+		t.Errorf("SetFingerprintStrip(\"(\") = %v, want an invalid pattern error", err)
+	}
+}
+
+func TestFingerprintNormalizesLongCommandLines(t *testing.T) {
+	t.Cleanup(func() { SetMaxCmdlineLen(0) })
+	SetMaxCmdlineLen(40)
+	a, b := testEvent(), testEvent()
+	a.Cmdline = "/usr/bin/java -Xmx4g -XX:+UseG1GC -Dapp.env=prod com.example.Billing"
+	b.Cmdline = "/opt/jdk/bin/java -Xmx8g -XX:+UseZGC com.example.Billing"
+
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Error("long command lines differing in options have different fingerprints")
+	}
+}
+
+func TestNormalizeCmdline(t *testing.T) {
+	for cmdline, want := range map[string]string{
+		"/usr/bin/java -Xmx4g -XX:+UseG1GC -Dapp.env=prod com.example.Billing": "java com.example.Billing",
+		"python3 -u /srv/app/worker.py --queue high":                           "python3 /srv/app/worker.py high",
+		"stress": "stress",
+		"":       "",
+		"   ":    "   ",
+	} {
+		if got := normalizeCmdline(cmdline); got != want {
+			t.Errorf("normalizeCmdline(%q) = %q, want %q", cmdline, got, want)
+		}
+	}
+}
+
+func TestFingerprintKeepsShortCommandLines(t *testing.T) {
+	t.Cleanup(func() { SetMaxCmdlineLen(0) })
+	SetMaxCmdlineLen(40)
+	a, b := testEvent(), testEvent()
+	a.Cmdline = "java -Xmx4g com.example.Billing"
+	b.Cmdline = "java -Xmx8g com.example.Billing"
+
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("command lines within the limit are normalized")
+	}
+}
+
+func TestFingerprintInJSON(t *testing.T) {
+	event := testEvent()
+	event.GroupKey = event.Fingerprint()
+	data, err := EventEncoding{}.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["fingerprint"] != event.Fingerprint() {
+		t.Errorf("fingerprint = %v, want %s", fields["fingerprint"], event.Fingerprint())
+	}
+}
@@ -0,0 +1,176 @@
+package notifier
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SeverityHigh marks events escalated by a FlapDetector.
+const SeverityHigh = "high"
+
+// SeverityRecovered marks the recovery events of a FlapDetector, sent once
+// an escalated event stopped repeating.
+const SeverityRecovered = "recovered"
+
+// KindRecovery is the kind of the recovery events of a FlapDetector.
+const KindRecovery = "recovery"
+
+// FlapDetector escalates events that keep repeating: once the same
+// fingerprint is seen threshold times within the sliding window, it and
+// its further repeats are marked SeverityHigh.
+type FlapDetector struct {
+	window    time.Duration
+	threshold int
+	seen      map[string][]time.Time
+	lastPrune time.Time
+	now       func() time.Time
+
+	// recovery is the quiet period after which an escalated fingerprint has
+	// recovered, 0 disables recovery events. flapping holds the escalated
+	// fingerprints until then.
+	recovery time.Duration
+	flapping map[string]*flapState
+}
+
+// flapState is an escalated fingerprint awaiting its recovery.
+type flapState struct {
+	// event is the last event of the fingerprint, lastSeen its time.
+	event    OOMEvent
+	lastSeen time.Time
+	// peak is the most repeats seen within the window.
+	peak int
+}
+
+func NewFlapDetector(threshold int, window time.Duration) *FlapDetector {
+	return &FlapDetector{
+		window:    window,
+		threshold: threshold,
+		seen:      make(map[string][]time.Time),
+		now:       time.Now,
+		flapping:  make(map[string]*flapState),
+	}
+}
+
+// SetRecoveryWindow enables recovery events: an escalated fingerprint not
+// seen again for window is returned once by Recovered. 0 disables them.
+func (f *FlapDetector) SetRecoveryWindow(window time.Duration) {
+	f.recovery = window
+}
+
+// Window returns the sliding window length.
+func (f *FlapDetector) Window() time.Duration {
+	return f.window
+}
+
+// Observe counts event and returns it with Severity and Repeats set when it
+// is flapping. escalated is true for the event reaching the threshold.
+func (f *FlapDetector) Observe(event OOMEvent) (OOMEvent, bool) {
+	now := f.now()
+	f.prune(now)
+
+	key := event.GroupKey
+	if key == "" {
+		key = event.Fingerprint()
+	}
+	times := append(recent(f.seen[key], now, f.window), now)
+	f.seen[key] = times
+
+	// Any repeat of an escalated fingerprint postpones its recovery
+	state := f.flapping[key]
+	if state != nil {
+		state.lastSeen = now
+	}
+
+	if len(times) < f.threshold {
+		return event, false
+	}
+	event.Severity = SeverityHigh
+	event.Repeats = len(times)
+	if f.recovery > 0 {
+		if state == nil {
+			state = &flapState{}
+			f.flapping[key] = state
+		}
+		state.event, state.lastSeen = event, now
+		if event.Repeats > state.peak {
+			state.peak = event.Repeats
+		}
+	}
+	return event, len(times) == f.threshold
+}
+
+// Recovered returns a recovery event for every escalated fingerprint not
+// seen for the recovery window, oldest first, and forgets them: each
+// escalation recovers once. The events are copies of the last escalated
+// event with Kind KindRecovery, Severity SeverityRecovered, Repeats the
+// most repeats seen within the window and Time the time of the recovery.
+func (f *FlapDetector) Recovered() []OOMEvent {
+	if len(f.flapping) == 0 {
+		return nil
+	}
+	now := f.now()
+	var recovered []*flapState
+	for key, state := range f.flapping {
+		if now.Sub(state.lastSeen) >= f.recovery {
+			recovered = append(recovered, state)
+			delete(f.flapping, key)
+		}
+	}
+	sort.Slice(recovered, func(i, j int) bool {
+		return recovered[i].lastSeen.Before(recovered[j].lastSeen)
+	})
+
+	events := make([]OOMEvent, 0, len(recovered))
+	for _, state := range recovered {
+		event := state.event
+		event.Kind = KindRecovery
+		event.Severity = SeverityRecovered
+		event.Repeats = state.peak
+		event.Time = now.UnixMilli()
+		event.Suppressed, event.Occurrences = 0, 0
+		events = append(events, event)
+	}
+	return events
+}
+
+// RecoveryWindow returns the quiet period after which escalated
+// fingerprints recover, 0 when recovery events are disabled.
+func (f *FlapDetector) RecoveryWindow() time.Duration {
+	return f.recovery
+}
+
+// prune forgets the fingerprints not seen within the window, at most once
+// per window.
+func (f *FlapDetector) prune(now time.Time) {
+	if now.Sub(f.lastPrune) < f.window {
+		return
+	}
+	for key, times := range f.seen {
+		if times = recent(times, now, f.window); len(times) == 0 {
+			delete(f.seen, key)
+		} else {
+			f.seen[key] = times
+		}
+	}
+	f.lastPrune = now
+}
+
+// recent returns the times within window before now. times are in
+// ascending order.
+func recent(times []time.Time, now time.Time, window time.Duration) []time.Time {
+	for i, t := range times {
+		if now.Sub(t) < window {
+			return times[i:]
+		}
+	}
+	return nil
+}
+
+// flapText describes the repeats of an escalated or recovered event.
+func flapText(event OOMEvent) string {
+	if event.Severity == SeverityRecovered {
+		return fmt.Sprintf("%s after up to %d occurrences within the flap window", event.Severity, event.Repeats)
+	}
+	return fmt.Sprintf("%s, %d occurrences within the flap window", event.Severity, event.Repeats)
+}
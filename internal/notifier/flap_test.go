@@ -0,0 +1,193 @@
+package notifier
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestFlaps(threshold int, window time.Duration) (*FlapDetector, *fakeClock) {
+	f := NewFlapDetector(threshold, window)
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	f.now = clock.Now
+	return f, clock
+}
+
+func TestFlapDetectorEscalatesAtThreshold(t *testing.T) {
+	f, clock := newTestFlaps(3, 10*time.Minute)
+
+	for i := 1; i <= 5; i++ {
+		event, escalated := f.Observe(testEvent())
+		if escalated != (i == 3) {
+			t.Errorf("occurrence %d: escalated %v, want true only at the threshold", i, escalated)
+		}
+		if i < 3 && event.Severity == SeverityHigh {
+			t.Errorf("occurrence %d below the threshold has severity %q", i, event.Severity)
+		}
+		if i >= 3 && (event.Severity != SeverityHigh || event.Repeats != i) {
+			t.Errorf("occurrence %d: severity %q with %d repeats, want %q with %d", i, event.Severity, event.Repeats, SeverityHigh, i)
+		}
+		clock.Advance(time.Minute)
+	}
+}
+
+func TestFlapDetectorSlidingWindow(t *testing.T) {
+	f, clock := newTestFlaps(3, 10*time.Minute)
+
+	// Kills 6 minutes apart never reach 3 within 10 minutes
+	for i := 0; i < 5; i++ {
+		if event, escalated := f.Observe(testEvent()); escalated || event.Severity == SeverityHigh {
+			t.Fatalf("occurrence %d escalated with two within the window", i+1)
+		}
+		clock.Advance(6 * time.Minute)
+	}
+
+	f.Observe(testEvent())
+	clock.Advance(time.Minute)
+	if _, escalated := f.Observe(testEvent()); !escalated {
+		t.Error("third occurrence within the window not escalated")
+	}
+}
+
+func TestFlapDetectorTracksFingerprintsSeparately(t *testing.T) {
+	f, _ := newTestFlaps(2, 10*time.Minute)
+	other := testEvent()
+	other.Hostname = "node-2"
+
+	f.Observe(testEvent())
+	if _, escalated := f.Observe(other); escalated {
+		t.Error("kills of the same process on different hosts escalated together")
+	}
+	if _, escalated := f.Observe(testEvent()); !escalated {
+		t.Error("second kill on node-1 not escalated")
+	}
+}
+
+func TestSlackSendsEscalationsToEscalationChannel(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+	s.EscalationChannel = "#oncall"
+
+	escalated := testEvent()
+	escalated.Severity, escalated.Repeats = SeverityHigh, 3
+	for channel, event := range map[string]OOMEvent{"#alerts": testEvent(), "#oncall": escalated} {
+		if err := s.Notify(event); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+		var payload SlackPayload
+		webhook.last(t, &payload)
+		if payload.Channel != channel {
+			t.Errorf("event of severity %q sent to %q, want %q", event.Severity, payload.Channel, channel)
+		}
+	}
+}
+
+func TestFlapDetectorRecoversOnce(t *testing.T) {
+	f, clock := newTestFlaps(3, 10*time.Minute)
+	f.SetRecoveryWindow(5 * time.Minute)
+
+	for i := 1; i <= 4; i++ {
+		f.Observe(testEvent())
+		if recovered := f.Recovered(); len(recovered) != 0 {
+			t.Fatalf("occurrence %d: recovered %+v while flapping", i, recovered)
+		}
+		clock.Advance(time.Minute)
+	}
+
+	// The last kill was a minute ago, the recovery comes 5 minutes after it
+	clock.Advance(3 * time.Minute)
+	if recovered := f.Recovered(); len(recovered) != 0 {
+		t.Fatalf("recovered %+v after 4 quiet minutes", recovered)
+	}
+	clock.Advance(time.Minute)
+	recovered := f.Recovered()
+	if len(recovered) != 1 {
+		t.Fatalf("%d recoveries after 5 quiet minutes, want 1", len(recovered))
+	}
+	event := recovered[0]
+	if event.Kind != KindRecovery || event.Severity != SeverityRecovered || event.Repeats != 4 || event.Time != clock.Now().UnixMilli() {
+		t.Errorf("recovery %+v, want kind %q, severity %q, the peak of 4 repeats and the time of the recovery", event, KindRecovery, SeverityRecovered)
+	}
+	if event.Cmdline != "stress --vm 1" || event.Hostname != "node-1" {
+		t.Errorf("recovery of %q on %q, want the escalated event", event.Cmdline, event.Hostname)
+	}
+
+	for i := 0; i < 3; i++ {
+		clock.Advance(10 * time.Minute)
+		if again := f.Recovered(); len(again) != 0 {
+			t.Errorf("recovered again %+v, want one recovery per escalation", again)
+		}
+	}
+}
+
+func TestFlapDetectorRepeatPostponesRecovery(t *testing.T) {
+	f, clock := newTestFlaps(2, 10*time.Minute)
+	f.SetRecoveryWindow(5 * time.Minute)
+	f.Observe(testEvent())
+	f.Observe(testEvent())
+
+	clock.Advance(4 * time.Minute)
+	f.Observe(testEvent())
+	clock.Advance(4 * time.Minute)
+	if recovered := f.Recovered(); len(recovered) != 0 {
+		t.Fatalf("recovered %+v 4 minutes after a repeat", recovered)
+	}
+	clock.Advance(time.Minute)
+	if recovered := f.Recovered(); len(recovered) != 1 || recovered[0].Repeats != 3 {
+		t.Errorf("recovered %+v, want one recovery with 3 repeats", recovered)
+	}
+}
+
+func TestFlapDetectorRecoversOldestFirst(t *testing.T) {
+	f, clock := newTestFlaps(2, 10*time.Minute)
+	f.SetRecoveryWindow(time.Minute)
+	other := testEvent()
+	other.Hostname = "node-2"
+
+	f.Observe(other)
+	f.Observe(other)
+	clock.Advance(time.Second)
+	f.Observe(testEvent())
+	f.Observe(testEvent())
+	// Below the threshold, never escalated
+	third := testEvent()
+	third.Hostname = "node-3"
+	f.Observe(third)
+
+	clock.Advance(time.Hour)
+	recovered := f.Recovered()
+	if len(recovered) != 2 || recovered[0].Hostname != "node-2" || recovered[1].Hostname != "node-1" {
+		t.Errorf("recovered %+v, want node-2 then node-1", recovered)
+	}
+}
+
+func TestFlapDetectorWithoutRecoveryWindow(t *testing.T) {
+	f, clock := newTestFlaps(2, 10*time.Minute)
+	f.Observe(testEvent())
+	f.Observe(testEvent())
+	clock.Advance(time.Hour)
+	if recovered := f.Recovered(); len(recovered) != 0 {
+		t.Errorf("recovered %+v without a recovery window", recovered)
+	}
+}
+
+func TestSlackSendsRecoveriesToEscalationChannel(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+	s.EscalationChannel = "#oncall"
+
+	recovery := testEvent()
+	recovery.Kind, recovery.Severity, recovery.Repeats = KindRecovery, SeverityRecovered, 4
+	if err := s.Notify(recovery); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	attachment := payload.Attachments[0]
+	if payload.Channel != "#oncall" || attachment.Color != "good" || attachment.Title != "✅ Recovered: Event Stopped Repeating" {
+		t.Errorf("recovery sent to %q colored %q titled %q, want #oncall, good and the recovery title", payload.Channel, attachment.Color, attachment.Title)
+	}
+	if got := eventSubject(recovery); got != "Recovered: stress --vm 1 on node-1 stopped repeating" {
+		t.Errorf("subject %q, want the recovery of the event", got)
+	}
+}
@@ -0,0 +1,156 @@
+package notifier
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// gelfChunkSize is the largest datagram sent, staying under the MTU of
+	// most networks as recommended by Graylog.
+	gelfChunkSize = 1420
+	// gelfChunkHeader is the size of the chunk header: magic bytes, message
+	// ID, sequence number and count.
+	gelfChunkHeader = 12
+	// maxGelfChunks is the most chunks a message may be split into.
+	maxGelfChunks = 128
+	// maxGelfMessage is the largest message that can be chunked.
+	maxGelfMessage = maxGelfChunks * (gelfChunkSize - gelfChunkHeader)
+)
+
+// gelfMagic starts every chunk of a chunked message.
+var gelfMagic = [2]byte{0x1e, 0x0f}
+
+// GelfNotifier sends every event to Graylog as a GELF message over UDP.
+// Messages larger than a datagram are chunked.
+type GelfNotifier struct {
+	Addr string
+	conn net.Conn
+}
+
+// NewGelfNotifier creates a notifier sending to the GELF UDP input at addr,
+// host:port. The socket is reused for every event.
+func NewGelfNotifier(addr string) (*GelfNotifier, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gelf socket: %v", err)
+	}
+	return &GelfNotifier{
+		Addr: addr,
+		conn: conn,
+	}, nil
+}
+
+func (g *GelfNotifier) Name() string {
+	return "gelf"
+}
+
+func (g *GelfNotifier) Notify(event OOMEvent) error {
+	payload, err := gelfPayload(event)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxGelfMessage && event.Report != "" {
+		// Leave out the kernel report rather than the whole message
+		event.Report = ""
+		if payload, err = gelfPayload(event); err != nil {
+			return err
+		}
+	}
+	if len(payload) > maxGelfMessage {
+		return fmt.Errorf("gelf message of %d bytes exceeds the %d bytes limit", len(payload), maxGelfMessage)
+	}
+
+	for _, datagram := range gelfChunks(payload) {
+		if _, err := g.conn.Write(datagram); err != nil {
+			return fmt.Errorf("failed to send gelf message: %v", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the socket.
+func (g *GelfNotifier) Close() error {
+	return g.conn.Close()
+}
+
+// gelfPayload encodes event as a GELF message, with the victim's details as
+// additional fields.
+func gelfPayload(event OOMEvent) ([]byte, error) {
+	timestamp := time.UnixMilli(event.Time)
+	if event.Time == 0 {
+		timestamp = time.Now()
+	}
+
+	// Syslog levels: 2 critical, 3 error
+	level := 3
+	if event.Severity == SeverityHigh {
+		level = 2
+	}
+
+	// GELF 1.1, additional fields have a leading underscore
+	message := map[string]interface{}{
+		"version":       "1.1",
+		"host":          event.Hostname,
+		"short_message": eventSubject(event),
+		"timestamp":     float64(timestamp.UnixMilli()) / 1000,
+		"level":         level,
+	}
+	if event.Report != "" {
+		message["full_message"] = event.Report
+	}
+	for name, value := range map[string]string{
+		"kind":        event.Kind,
+		"pid":         event.PID,
+		"cmdline":     event.Cmdline,
+		"kernel":      event.Kernel,
+		"oom_type":    event.OOMType,
+		"cgroup":      event.Cgroup,
+		"fingerprint": event.GroupKey,
+		"message":     event.Message,
+	} {
+		if value != "" {
+			message["_"+name] = value
+		}
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal gelf message: %v", err)
+	}
+	return payload, nil
+}
+
+// gelfChunks splits payload into datagrams of at most gelfChunkSize bytes.
+// A payload that fits is sent as is; the others are chunked, each chunk
+// carrying the message ID and its sequence number so that the server can
+// reassemble them. payload is at most maxGelfMessage bytes.
+func gelfChunks(payload []byte) [][]byte {
+	if len(payload) <= gelfChunkSize {
+		return [][]byte{payload}
+	}
+
+	var id [8]byte
+	rand.Read(id[:])
+
+	size := gelfChunkSize - gelfChunkHeader
+	count := (len(payload) + size - 1) / size
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		chunk := make([]byte, 0, gelfChunkHeader+end-i*size)
+		chunk = append(chunk, gelfMagic[:]...)
+		chunk = append(chunk, id[:]...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, payload[i*size:end]...)
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
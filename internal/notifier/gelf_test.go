@@ -0,0 +1,163 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gelfListener is a GELF UDP input reassembling chunked messages.
+type gelfListener struct {
+	t    *testing.T
+	conn net.PacketConn
+}
+
+func newGelfListener(t *testing.T) *gelfListener {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &gelfListener{t: t, conn: conn}
+}
+
+func (l *gelfListener) notifier() *GelfNotifier {
+	l.t.Helper()
+	g, err := NewGelfNotifier(l.conn.LocalAddr().String())
+	if err != nil {
+		l.t.Fatalf("NewGelfNotifier: %v", err)
+	}
+	l.t.Cleanup(func() { g.Close() })
+	return g
+}
+
+// receive returns the next message and the number of datagrams it came in.
+func (l *gelfListener) receive() (map[string]any, int) {
+	l.t.Helper()
+	l.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var chunks [][]byte
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			l.t.Fatalf("no gelf message received: %v", err)
+		}
+		datagram := append([]byte(nil), buf[:n]...)
+		if !bytes.HasPrefix(datagram, gelfMagic[:]) {
+			return l.decode(datagram), 1
+		}
+		if len(datagram) > gelfChunkSize {
+			l.t.Errorf("chunk of %d bytes, want at most %d", len(datagram), gelfChunkSize)
+		}
+		if len(chunks) > 0 && !bytes.Equal(datagram[2:10], chunks[0][2:10]) {
+			l.t.Fatal("chunks of different message IDs")
+		}
+		if seq := int(datagram[10]); seq != len(chunks) {
+			l.t.Fatalf("chunk %d received as number %d", seq, len(chunks))
+		}
+		chunks = append(chunks, datagram)
+		if count := int(datagram[11]); len(chunks) == count {
+			var payload []byte
+			for _, chunk := range chunks {
+				payload = append(payload, chunk[gelfChunkHeader:]...)
+			}
+			return l.decode(payload), count
+		}
+	}
+}
+
+func (l *gelfListener) decode(payload []byte) map[string]any {
+	l.t.Helper()
+	var message map[string]any
+	if err := json.Unmarshal(payload, &message); err != nil {
+		l.t.Fatalf("invalid gelf message: %v: %s", err, payload)
+	}
+	return message
+}
+
+func TestGelfSendsMessage(t *testing.T) {
+	listener := newGelfListener(t)
+	event := testEvent()
+	event.Kernel = "6.1.0"
+
+	if err := listener.notifier().Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	message, datagrams := listener.receive()
+	if datagrams != 1 {
+		t.Errorf("small message sent in %d chunks", datagrams)
+	}
+	for field, want := range map[string]any{
+		"version":   "1.1",
+		"host":      "node-1",
+		"_pid":      "4242",
+		"_cmdline":  "stress --vm 1",
+		"_kernel":   "6.1.0",
+		"_oom_type": "memcg",
+		"level":     float64(3),
+	} {
+		if message[field] != want {
+			t.Errorf("%s = %v, want %v", field, message[field], want)
+		}
+	}
+	if short, _ := message["short_message"].(string); short == "" {
+		t.Error("short_message is empty")
+	}
+	if timestamp, _ := message["timestamp"].(float64); timestamp != float64(event.Time)/1000 {
+		t.Errorf("timestamp = %v, want the event time in seconds", message["timestamp"])
+	}
+}
+
+func TestGelfChunksLargeMessages(t *testing.T) {
+	listener := newGelfListener(t)
+	event := testEvent()
+	event.Report = strings.Repeat("oom-kill report line\n", 300)
+
+	if err := listener.notifier().Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	message, datagrams := listener.receive()
+	if datagrams < 2 {
+		t.Errorf("message of a %d bytes report sent in %d datagram", len(event.Report), datagrams)
+	}
+	if message["full_message"] != event.Report {
+		t.Error("reassembled message lacks the report")
+	}
+}
+
+func TestGelfLeavesOutOversizedReport(t *testing.T) {
+	listener := newGelfListener(t)
+	event := testEvent()
+	event.Report = strings.Repeat("x", maxGelfMessage)
+
+	if err := listener.notifier().Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	message, _ := listener.receive()
+	if _, ok := message["full_message"]; ok || message["_pid"] != "4242" {
+		t.Errorf("message %v, want the event without its report", message)
+	}
+
+	event.Report, event.Cmdline = "", strings.Repeat("x", maxGelfMessage)
+	if err := listener.notifier().Notify(event); err == nil {
+		t.Error("Notify of a message over the chunking limit succeeded")
+	}
+}
+
+func TestGelfEscalationIsCritical(t *testing.T) {
+	listener := newGelfListener(t)
+	event := testEvent()
+	event.Severity = SeverityHigh
+
+	if err := listener.notifier().Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if message, _ := listener.receive(); message["level"] != float64(2) {
+		t.Errorf("level = %v, want 2 for an escalated event", message["level"])
+	}
+}
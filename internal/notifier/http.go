@@ -0,0 +1,270 @@
+package notifier
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// maxResponseBody bounds how much of a response body is read for status
+// validation.
+const maxResponseBody = 64 * 1024
+
+const (
+	// idleConnTimeout closes idle keep-alive connections before the idle
+	// timeout of common load balancers, often 60 seconds, resets them.
+	idleConnTimeout = 30 * time.Second
+	// maxIdleConns bounds the idle connections kept across all servers,
+	// maxIdleConnsPerHost those kept to one.
+	maxIdleConns        = 16
+	maxIdleConnsPerHost = 4
+)
+
+// TLSOptions configures how HTTP notifiers verify servers and authenticate to
+// them.
+type TLSOptions struct {
+	// CAFile holds PEM certificates trusted in addition to the system pool.
+	CAFile string
+	// CertFile and KeyFile hold a PEM client certificate and its key.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool
+}
+
+// NewTLSConfig builds the TLS configuration described by opts. It returns nil
+// when opts is empty, keeping Go's defaults.
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if opts == (TLSOptions{}) {
+		return nil, nil
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		return nil, fmt.Errorf("a client certificate and key must be given together")
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// NewHTTPClient returns the client shared by the HTTP based notifiers. Each
+// request, including reading the response, is bounded by timeout, and goes
+// through the proxy set in HTTP_PROXY, HTTPS_PROXY and NO_PROXY. tlsConfig may
+// be nil for Go's defaults. Requests to unix socket URLs, see ParseUnixURL,
+// dial the socket and never use a proxy. Idle connections are closed after
+// idleConnTimeout.
+func NewHTTPClient(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if socket, ok := ctx.Value(unixSocketKey{}).(string); ok {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if req.Context().Value(unixSocketKey{}) != nil {
+			return nil, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}
+	transport.IdleConnTimeout = idleConnTimeout
+	transport.MaxIdleConns = maxIdleConns
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// unixSocketKey is the request context key of the unix socket a request is
+// sent to.
+type unixSocketKey struct{}
+
+// ParseUnixURL splits a URL of an HTTP server on a unix socket,
+// unix:///path/to.sock, into the socket path and the request path. The
+// request path follows the socket after a colon, as in
+// unix:///run/hook.sock:/events, and defaults to /. ok is false for other
+// URLs.
+func ParseUnixURL(rawURL string) (socket, path string, ok bool) {
+	rest, found := strings.CutPrefix(rawURL, "unix://")
+	if !found || !strings.HasPrefix(rest, "/") {
+		return "", "", false
+	}
+	socket, path, found = strings.Cut(rest, ":")
+	if !found {
+		path = "/"
+	}
+	if socket == "/" || !strings.HasPrefix(path, "/") {
+		return "", "", false
+	}
+	return socket, path, true
+}
+
+// newJSONRequest builds a POST request carrying a JSON body, cancelled once
+// ctx is done. rawURL may be a unix socket URL, see ParseUnixURL.
+func newJSONRequest(ctx context.Context, rawURL string, body []byte) (*http.Request, error) {
+	target := rawURL
+	socket, path, isUnix := ParseUnixURL(rawURL)
+	if isUnix {
+		// The host is never resolved, it keeps the connections to different
+		// sockets apart
+		hash := fnv.New32a()
+		hash.Write([]byte(socket))
+		target = fmt.Sprintf("http://unix-%x%s", hash.Sum32(), path)
+		ctx = context.WithValue(ctx, unixSocketKey{}, socket)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	if isUnix {
+		req.Host = "localhost"
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// newPushRequest is newJSONRequest with the body compressed with gzip and
+// sent with Content-Encoding: gzip when compress is set.
+func newPushRequest(ctx context.Context, rawURL string, body []byte, compress bool) (*http.Request, error) {
+	if !compress {
+		return newJSONRequest(ctx, rawURL, body)
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return nil, fmt.Errorf("failed to compress request: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress request: %v", err)
+	}
+
+	req, err := newJSONRequest(ctx, rawURL, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	return req, nil
+}
+
+// doRequest sends req and returns the response along with its body. The
+// response body is already closed. A request failing on a connection the
+// server or a load balancer closed, see connectionClosed, before it was
+// fully written is sent again once right away, on a new connection, before
+// the failure is handed to the Retrier. A request that was fully written is
+// never sent again here, the server may have acted on it before the
+// connection was lost.
+func doRequest(client *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	resp, written, err := sendTraced(client, req)
+	if err != nil && !written && connectionClosed(err) && req.GetBody != nil && req.Context().Err() == nil {
+		logger.Debug("Connection to %s was closed before the request was sent, sending again: %v", req.URL.Host, err)
+		retry := req.Clone(req.Context())
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, nil, fmt.Errorf("failed to rewind request: %v", err)
+		}
+		resp, _, err = sendTraced(client, retry)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return resp, nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	return resp, body, nil
+}
+
+// sendTraced sends req and reports whether the transport finished writing
+// it, headers and body, to the connection.
+func sendTraced(client *http.Client, req *http.Request) (*http.Response, bool, error) {
+	var written atomic.Bool
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err == nil {
+				written.Store(true)
+			}
+		},
+	}
+	resp, err := client.Do(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	return resp, written.Load(), err
+}
+
+// connectionClosed reports whether err is a connection closed or reset by
+// the other end, as happens to pooled keep-alive connections that sat idle
+// longer than a load balancer allows.
+func connectionClosed(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// retryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date. It returns fallback when the header is missing or invalid and
+// never more than limit.
+func retryAfter(header http.Header, fallback, limit time.Duration) time.Duration {
+	delay := fallback
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+	}
+
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
@@ -0,0 +1,481 @@
+package notifier
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyTransport fails the first request with err, after reporting it
+// written when written is set, and answers the following ones with 200.
+type flakyTransport struct {
+	err     error
+	written bool
+	calls   atomic.Int32
+	bodies  []string
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	f.bodies = append(f.bodies, string(body))
+	if f.calls.Add(1) == 1 {
+		if trace := httptrace.ContextClientTrace(req.Context()); trace != nil && trace.WroteRequest != nil && f.written {
+			trace.WroteRequest(httptrace.WroteRequestInfo{})
+		}
+		return nil, f.err
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("ok")), Request: req}, nil
+}
+
+func TestDoRequestResendsUnwrittenRequest(t *testing.T) {
+	transport := &flakyTransport{err: syscall.ECONNRESET}
+	client := &http.Client{Transport: transport}
+	req, err := newJSONRequest(context.Background(), "http://hooks.example/alert", []byte(`{"text":"oom"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body, err := doRequest(client, req)
+	if err != nil {
+		t.Fatalf("doRequest: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("got %d %q, want 200 ok", resp.StatusCode, body)
+	}
+	if transport.calls.Load() != 2 {
+		t.Fatalf("sent %d times, want 2", transport.calls.Load())
+	}
+	if transport.bodies[1] != `{"text":"oom"}` {
+		t.Errorf("resent body %q, want the original one", transport.bodies[1])
+	}
+}
+
+func TestDoRequestDoesNotResendWrittenRequest(t *testing.T) {
+	transport := &flakyTransport{err: io.EOF, written: true}
+	client := &http.Client{Transport: transport}
+	req, err := newJSONRequest(context.Background(), "http://hooks.example/alert", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := doRequest(client, req); err == nil {
+		t.Fatal("doRequest succeeded, want the connection error")
+	}
+	if transport.calls.Load() != 1 {
+		t.Errorf("sent %d times, want 1", transport.calls.Load())
+	}
+}
+
+func TestDoRequestDoesNotResendOtherErrors(t *testing.T) {
+	transport := &flakyTransport{err: syscall.ECONNREFUSED}
+	client := &http.Client{Transport: transport}
+	req, err := newJSONRequest(context.Background(), "http://hooks.example/alert", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := doRequest(client, req); err == nil {
+		t.Fatal("doRequest succeeded, want the connection error")
+	}
+	if transport.calls.Load() != 1 {
+		t.Errorf("sent %d times, want 1", transport.calls.Load())
+	}
+}
+
+// TestDoRequestAfterServerClosedConnection closes the keep-alive connection
+// of the first request once it is idle, as a load balancer does, and checks
+// the next request still goes through and reaches the server once.
+func TestDoRequestAfterServerClosedConnection(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	}))
+	var closed atomic.Bool
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateIdle && closed.CompareAndSwap(false, true) {
+			conn.Close()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewHTTPClient(5*time.Second, nil)
+	for i := 0; i < 2; i++ {
+		req, err := newJSONRequest(context.Background(), server.URL, []byte(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, body, err := doRequest(client, req)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+			t.Errorf("request %d: got %d %q, want 200 ok", i+1, resp.StatusCode, body)
+		}
+		// Let the server close the idle connection before the next request
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !closed.Load() {
+		t.Error("server never closed the connection")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("server received %d requests, want 2", got)
+	}
+}
+
+// TestDoRequestWrittenBeforeClose closes the connection once the server
+// read a request, without answering. The request may have been acted on,
+// so it must reach the server only once.
+func TestDoRequestWrittenBeforeClose(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if requests.Add(1) == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("hijack: %v", err)
+				return
+			}
+			conn.Close()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := NewHTTPClient(5*time.Second, nil)
+	req, err := newJSONRequest(context.Background(), server.URL, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := doRequest(client, req); err == nil {
+		t.Fatal("doRequest succeeded, want the connection error")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("server received %d requests, want 1", got)
+	}
+}
+
+func TestConnectionClosed(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{io.EOF, true},
+		{io.ErrUnexpectedEOF, true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{&net.OpError{Op: "write", Err: syscall.EPIPE}, true},
+		{syscall.ECONNREFUSED, false},
+		{context.DeadlineExceeded, false},
+	} {
+		if got := connectionClosed(tc.err); got != tc.want {
+			t.Errorf("connectionClosed(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 5 * time.Second},
+		{"soon", 5 * time.Second},
+		{"2", 2 * time.Second},
+		{"0", 0},
+		{"3600", time.Minute},
+		{"Mon, 01 Jan 2001 00:00:00 GMT", 0},
+	} {
+		header := http.Header{}
+		if tt.value != "" {
+			header.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(header, 5*time.Second, time.Minute); got != tt.want {
+			t.Errorf("Retry-After %q: %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewHTTPClient(50*time.Millisecond, nil)
+	if client.Timeout != 50*time.Millisecond {
+		t.Errorf("Timeout = %v, want 50ms", client.Timeout)
+	}
+	req, err := newJSONRequest(context.Background(), server.URL, []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, _, err := doRequest(client, req); err == nil || !strings.Contains(err.Error(), "Timeout") {
+		t.Errorf("doRequest = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request gave up after %v, want about the 50ms timeout", elapsed)
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	transport := NewHTTPClient(time.Second, nil).Transport.(*http.Transport)
+	if transport.Proxy == nil {
+		t.Fatal("transport ignores the proxy environment variables")
+	}
+
+	req, err := newJSONRequest(context.Background(), "https://hooks.example/alert", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, gotErr := transport.Proxy(req)
+	want, wantErr := http.ProxyFromEnvironment(req)
+	if !reflect.DeepEqual(got, want) || (gotErr == nil) != (wantErr == nil) {
+		t.Errorf("Proxy = %v, %v, want the proxy from the environment %v, %v", got, gotErr, want, wantErr)
+	}
+
+	req, err = newJSONRequest(context.Background(), "unix:///run/hook.sock:/events", []byte(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy, err := transport.Proxy(req); proxy != nil || err != nil {
+		t.Errorf("unix socket request proxied through %v, %v", proxy, err)
+	}
+}
+
+func TestParseUnixURL(t *testing.T) {
+	for _, tt := range []struct {
+		url, socket, path string
+		ok                bool
+	}{
+		{"unix:///run/hook.sock", "/run/hook.sock", "/", true},
+		{"unix:///run/hook.sock:/events?source=oom", "/run/hook.sock", "/events?source=oom", true},
+		{"unix://run/hook.sock", "", "", false},
+		{"unix:///run/hook.sock:events", "", "", false},
+		{"unix:///", "", "", false},
+		{"http://[::1]:8080/events", "", "", false},
+	} {
+		socket, path, ok := ParseUnixURL(tt.url)
+		if socket != tt.socket || path != tt.path || ok != tt.ok {
+			t.Errorf("ParseUnixURL(%q) = %q, %q, %v, want %q, %q, %v", tt.url, socket, path, ok, tt.socket, tt.path, tt.ok)
+		}
+	}
+}
+
+// newUnixServer serves handler on a unix socket and returns its unix:// URL.
+func newUnixServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir
+	dir, err := os.MkdirTemp("", "hook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "hook.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(handler)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return "unix://" + socket
+}
+
+func TestNotifiersPostToUnixSocket(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	url := newUnixServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.Host+r.URL.Path)
+		mu.Unlock()
+		// Teams checks for the body it answers with
+		w.Write([]byte("1"))
+	}))
+	client := NewHTTPClient(5*time.Second, nil)
+
+	for name, n := range map[string]Notifier{
+		"webhook": NewWebhookNotifier(url+":/events", "", client),
+		"slack":   NewSlackNotifier([]string{url + ":/slack"}, "alerts", nil, SlackModeAll, SlackFormatAttachment, nil, client),
+		"teams":   NewTeamsNotifier(url+":/teams", client),
+	} {
+		if err := n.Notify(testEvent()); err != nil {
+			t.Errorf("%s Notify: %v", name, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(paths)
+	if want := []string{"localhost/events", "localhost/slack", "localhost/teams"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("socket received %v, want %v", paths, want)
+	}
+}
+
+func TestNotifierPostsToIPv6Literal(t *testing.T) {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %v", err)
+	}
+	var received atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	if !strings.HasPrefix(server.URL, "http://[::1]:") {
+		t.Fatalf("server at %s, want an IPv6 literal URL", server.URL)
+	}
+	if err := NewWebhookNotifier(server.URL+"/events", "", NewHTTPClient(5*time.Second, nil)).Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if received.Load() != 1 {
+		t.Errorf("server received %d requests, want 1", received.Load())
+	}
+}
+
+// newHangingServer returns the URL of a server that answers no request,
+// and a channel receiving a value as each request arrives.
+func newHangingServer(t *testing.T) (string, <-chan struct{}) {
+	t.Helper()
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		server.Close()
+	})
+	return server.URL, arrived
+}
+
+func TestNotifyContextCancelsInFlightRequest(t *testing.T) {
+	url, arrived := newHangingServer(t)
+	// The client timeout would end the requests long after the test
+	client := NewHTTPClient(time.Minute, nil)
+	telegram := NewTelegramNotifier("token", "42", client)
+	telegram.apiURL = url
+	pushover := NewPushoverNotifier("app-token", "user-key", client)
+	pushover.apiURL = url
+
+	for name, n := range map[string]ContextNotifier{
+		"webhook":    NewWebhookNotifier(url, "", client),
+		"slack":      NewSlackNotifier([]string{url}, "alerts", nil, SlackModeAll, SlackFormatAttachment, nil, client),
+		"teams":      NewTeamsNotifier(url, client),
+		"discord":    NewDiscordNotifier(url, client),
+		"mattermost": NewMattermostNotifier(url, "", client),
+		"telegram":   telegram,
+		"pushover":   pushover,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- n.NotifyContext(ctx, testEvent()) }()
+
+			select {
+			case <-arrived:
+			case <-time.After(5 * time.Second):
+				t.Fatal("request never arrived")
+			}
+			cancel()
+			select {
+			case err := <-done:
+				if err == nil || !strings.Contains(err.Error(), "context canceled") {
+					t.Errorf("NotifyContext = %v, want the request cancelled", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("NotifyContext still running after cancellation")
+			}
+		})
+	}
+}
+
+func TestTextSendsCancelInFlightRequest(t *testing.T) {
+	url, arrived := newHangingServer(t)
+	client := NewHTTPClient(time.Minute, nil)
+	telegram := NewTelegramNotifier("token", "42", client)
+	telegram.apiURL = url
+	pushover := NewPushoverNotifier("app-token", "user-key", client)
+	pushover.apiURL = url
+	slack := NewSlackNotifier([]string{url}, "alerts", nil, SlackModeAll, SlackFormatAttachment, nil, client)
+	events := []OOMEvent{testEvent()}
+
+	for name, send := range map[string]func(ctx context.Context) error{
+		"slack text": func(ctx context.Context) error { return slack.NotifyTextContext(ctx, "12 OOM kills") },
+		"slack summary": func(ctx context.Context) error {
+			return slack.NotifySummaryContext(ctx, NodeSummary{Hostname: "node-1", Events: events})
+		},
+		"slack digest": func(ctx context.Context) error {
+			return slack.NotifyDigestContext(ctx, Digest{Events: events})
+		},
+		"teams": func(ctx context.Context) error {
+			return NewTeamsNotifier(url, client).NotifyTextContext(ctx, "12 OOM kills")
+		},
+		"mattermost": func(ctx context.Context) error {
+			return NewMattermostNotifier(url, "", client).NotifyTextContext(ctx, "12 OOM kills")
+		},
+		"telegram": func(ctx context.Context) error { return telegram.NotifyTextContext(ctx, "12 OOM kills") },
+		"pushover": func(ctx context.Context) error { return pushover.NotifyTextContext(ctx, "12 OOM kills") },
+	} {
+		send := send
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- send(ctx) }()
+
+			select {
+			case <-arrived:
+			case <-time.After(5 * time.Second):
+				t.Fatal("request never arrived")
+			}
+			cancel()
+			select {
+			case err := <-done:
+				if err == nil || !strings.Contains(err.Error(), "context canceled") {
+					t.Errorf("send = %v, want the request cancelled", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("send still running after cancellation")
+			}
+		})
+	}
+}
+
+func TestNotifyDeliversWithoutContext(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	if err := NewWebhookNotifier(webhook.URL, "", NewHTTPClient(5*time.Second, nil)).Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if webhook.received() != 1 {
+		t.Errorf("webhook received %d requests, want 1", webhook.received())
+	}
+}
@@ -0,0 +1,210 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Naming conventions of the keys of native JSON events, see
+// EventEncoding.Naming.
+const (
+	// NamingSnake is the snake_case keys of MarshalEvent.
+	NamingSnake = "snake"
+	// NamingCamel turns keys into camelCase, oom_type into oomType.
+	NamingCamel = "camel"
+)
+
+// Handling of the empty fields of native JSON events, see
+// EventEncoding.EmptyFields.
+const (
+	// EmptyDefault leaves out the optional fields when empty, as
+	// MarshalEvent does.
+	EmptyDefault = "default"
+	// EmptyOmit leaves out every empty field, including the kind, PID or
+	// kernel that MarshalEvent always writes.
+	EmptyOmit = "omit"
+	// EmptyKeep writes every field, empty lists and maps as [] and {}.
+	EmptyKeep = "keep"
+)
+
+// ParseNaming validates a naming convention.
+func ParseNaming(naming string) (string, error) {
+	switch naming {
+	case NamingSnake, NamingCamel:
+		return naming, nil
+	}
+	return "", fmt.Errorf("invalid naming %q, expected %s or %s", naming, NamingSnake, NamingCamel)
+}
+
+// ParseEmptyFields validates a handling of empty fields.
+func ParseEmptyFields(mode string) (string, error) {
+	switch mode {
+	case EmptyDefault, EmptyOmit, EmptyKeep:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid empty fields handling %q, expected %s, %s or %s", mode, EmptyDefault, EmptyOmit, EmptyKeep)
+}
+
+// styled reports whether e departs from the keys or empty fields of
+// MarshalEvent.
+func (e EventEncoding) styled() bool {
+	return (e.Naming != "" && e.Naming != NamingSnake) || (e.EmptyFields != "" && e.EmptyFields != EmptyDefault)
+}
+
+// marshalStyled returns the native JSON representation of event with the
+// naming and empty fields of e. It walks the fields of OOMEvent by their
+// json tags, so the keys stay those of MarshalEvent, only renamed; the keys
+// of Env and Fields are data and kept as they are.
+func (e EventEncoding) marshalStyled(event OOMEvent) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{")
+	writeKey(&b, e.key("schema_version"))
+	b.WriteString(strconv.Itoa(EventSchemaVersion))
+	first := false
+	if err := e.writeFields(&b, reflect.ValueOf(event), &first); err != nil {
+		return nil, err
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+// writeFields writes the fields of the struct v as object members, those
+// of embedded structs inline. first is whether no member was written yet.
+func (e EventEncoding) writeFields(b *bytes.Buffer, v reflect.Value, first *bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := e.writeFields(b, v.Field(i), first); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value := v.Field(i)
+		if e.omitted(value, strings.Contains(","+options+",", ",omitempty,")) {
+			continue
+		}
+
+		if !*first {
+			b.WriteString(",")
+		}
+		*first = false
+		writeKey(b, e.key(name))
+		if err := e.writeValue(b, value); err != nil {
+			return fmt.Errorf("failed to marshal %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// writeValue writes v, recursing into structs so that their keys are
+// renamed too.
+func (e EventEncoding) writeValue(b *bytes.Buffer, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		b.WriteString("{")
+		first := true
+		if err := e.writeFields(b, v, &first); err != nil {
+			return err
+		}
+		b.WriteString("}")
+		return nil
+	case reflect.Slice:
+		if v.IsNil() && e.EmptyFields == EmptyKeep {
+			b.WriteString("[]")
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Struct {
+			b.WriteString("[")
+			for i := 0; i < v.Len(); i++ {
+				if i > 0 {
+					b.WriteString(",")
+				}
+				if err := e.writeValue(b, v.Index(i)); err != nil {
+					return err
+				}
+			}
+			b.WriteString("]")
+			return nil
+		}
+	case reflect.Map:
+		if v.IsNil() && e.EmptyFields == EmptyKeep {
+			b.WriteString("{}")
+			return nil
+		}
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return err
+	}
+	b.Write(data)
+	return nil
+}
+
+// omitted reports whether the field holding v is left out, omitempty being
+// whether its json tag has that option.
+func (e EventEncoding) omitted(v reflect.Value, omitempty bool) bool {
+	switch e.EmptyFields {
+	case EmptyOmit:
+		return isEmptyValue(v)
+	case EmptyKeep:
+		return false
+	}
+	return omitempty && isEmptyValue(v)
+}
+
+// key returns the JSON key name in the naming convention of e.
+func (e EventEncoding) key(name string) string {
+	if e.Naming != NamingCamel {
+		return name
+	}
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// isEmptyValue reports whether v is empty as understood by the omitempty
+// option of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+func writeKey(b *bytes.Buffer, key string) {
+	data, _ := json.Marshal(key)
+	b.Write(data)
+	b.WriteString(":")
+}
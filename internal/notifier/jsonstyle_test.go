@@ -0,0 +1,148 @@
+package notifier
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// styledEvent is testEvent with a memory consumer and custom fields, whose
+// keys are renamed and kept respectively, and no kernel, a field always
+// written by MarshalEvent.
+func styledEvent() OOMEvent {
+	event := testEvent()
+	event.TopConsumers = []MemoryConsumer{{PID: "4242", Cmdline: "stress --vm 1", RSS: "1024"}}
+	event.Fields = map[string]string{"team_name": "data"}
+	return event
+}
+
+func TestEventEncodingStyles(t *testing.T) {
+	for _, tt := range []struct {
+		naming, empty string
+		// present and absent are keys expected in and missing from the
+		// document
+		present, absent []string
+	}{
+		{
+			NamingSnake, EmptyDefault,
+			[]string{"schema_version", "oom_type", "kernel", "top_consumers", "fields"},
+			[]string{"oomType", "report", "env"},
+		},
+		{
+			NamingSnake, EmptyOmit,
+			[]string{"schema_version", "oom_type", "top_consumers"},
+			[]string{"kernel", "report", "env"},
+		},
+		{
+			NamingSnake, EmptyKeep,
+			[]string{"schema_version", "oom_type", "kernel", "report", "env", "args"},
+			[]string{"oomType"},
+		},
+		{
+			NamingCamel, EmptyDefault,
+			[]string{"schemaVersion", "oomType", "kernel", "topConsumers"},
+			[]string{"oom_type", "report", "schema_version"},
+		},
+		{
+			NamingCamel, EmptyOmit,
+			[]string{"schemaVersion", "oomType"},
+			[]string{"kernel", "report", "oom_type"},
+		},
+		{
+			NamingCamel, EmptyKeep,
+			[]string{"schemaVersion", "oomType", "kernel", "report", "fingerprintKillCount", "env"},
+			[]string{"oom_type", "fingerprint_kill_count"},
+		},
+	} {
+		t.Run(tt.naming+"/"+tt.empty, func(t *testing.T) {
+			encoding := EventEncoding{Naming: tt.naming, EmptyFields: tt.empty}
+			data, err := encoding.marshalStyled(styledEvent())
+			if err != nil {
+				t.Fatalf("marshalStyled: %v", err)
+			}
+			doc := decodeJSON(t, data)
+			for _, key := range tt.present {
+				if _, ok := doc[key]; !ok {
+					t.Errorf("%s missing from %s", key, data)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := doc[key]; ok {
+					t.Errorf("%s present in %s", key, data)
+				}
+			}
+
+			// Keys of custom fields are data, not renamed
+			if got := lookup(doc, "fields.team_name"); got != "data" {
+				t.Errorf("fields.team_name = %v, want data", got)
+			}
+			consumers, _ := doc[encoding.key("top_consumers")].([]any)
+			if len(consumers) != 1 {
+				t.Fatalf("%s = %v, want one consumer", encoding.key("top_consumers"), doc[encoding.key("top_consumers")])
+			}
+			if _, ok := consumers[0].(map[string]any)[encoding.key("rss_kb")]; !ok {
+				t.Errorf("consumer %v lacks %s", consumers[0], encoding.key("rss_kb"))
+			}
+		})
+	}
+}
+
+func TestEventEncodingDefaultStyleMatchesMarshalEvent(t *testing.T) {
+	want, err := MarshalEvent(styledEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EventEncoding{Naming: NamingSnake, EmptyFields: EmptyDefault}.marshalStyled(styledEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("marshalStyled =\n%s\nwant MarshalEvent\n%s", got, want)
+	}
+}
+
+func TestEventEncodingKeepWritesEmptyCollections(t *testing.T) {
+	data, err := EventEncoding{EmptyFields: EmptyKeep}.Marshal(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := decodeJSON(t, data)
+	for key, want := range map[string]any{
+		"args":          []any{},
+		"env":           map[string]any{},
+		"top_consumers": []any{},
+		"report":        "",
+		"reaped":        false,
+		"repeats":       float64(0),
+	} {
+		if got := doc[key]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %#v, want %#v", key, got, want)
+		}
+	}
+}
+
+func TestEventEncodingECSIgnoresStyle(t *testing.T) {
+	want, err := MarshalECS(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := EventEncoding{Schema: SchemaECS, Naming: NamingCamel, EmptyFields: EmptyKeep}.Marshal(testEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("styled ECS document differs from MarshalECS")
+	}
+}
+
+func TestParseNamingAndEmptyFields(t *testing.T) {
+	if _, err := ParseNaming("kebab"); err == nil {
+		t.Error("ParseNaming accepted kebab")
+	}
+	if _, err := ParseEmptyFields("drop"); err == nil {
+		t.Error("ParseEmptyFields accepted drop")
+	}
+	if naming, err := ParseNaming(NamingCamel); err != nil || naming != NamingCamel {
+		t.Errorf("ParseNaming(camel) = %q, %v", naming, err)
+	}
+}
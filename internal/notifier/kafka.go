@@ -0,0 +1,129 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaTimeout bounds producing a single message, including the broker's
+// acknowledgement.
+const kafkaTimeout = 10 * time.Second
+
+// kafkaProducer is the part of the Kafka writer used by KafkaNotifier.
+type kafkaProducer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaNotifier produces every event to a Kafka topic as JSON, keyed by
+// hostname so that the events of a host stay ordered within one partition.
+// Events produced while no broker is reachable are held by its stream and
+// produced once one is back.
+type KafkaNotifier struct {
+	Topic  string
+	stream *stream
+}
+
+// NewKafkaNotifier creates a Kafka notifier. Brokers are connected to in
+// the background, and again whenever producing fails for a lost connection.
+func NewKafkaNotifier(brokers []string, topic string) *KafkaNotifier {
+	return &KafkaNotifier{
+		Topic: topic,
+		stream: newStream("kafka", func(ctx context.Context) (streamConn, error) {
+			return dialKafka(ctx, brokers, topic)
+		}),
+	}
+}
+
+func (k *KafkaNotifier) Name() string {
+	return "kafka"
+}
+
+func (k *KafkaNotifier) Notify(event OOMEvent) error {
+	return k.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with producing the message cancelled once ctx is
+// done.
+func (k *KafkaNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	value, err := MarshalEvent(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal kafka message: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, kafkaTimeout)
+	defer cancel()
+
+	if err := k.stream.Write(ctx, streamMessage{Key: []byte(event.Hostname), Value: value}); err != nil {
+		return fmt.Errorf("failed to produce kafka message: %v", err)
+	}
+	return nil
+}
+
+// Connected reports whether a broker is reachable.
+func (k *KafkaNotifier) Connected() bool {
+	return k.stream.Connected()
+}
+
+// Close produces the messages held while disconnected and closes the broker
+// connections.
+func (k *KafkaNotifier) Close() error {
+	return k.stream.Close()
+}
+
+// kafkaConn produces stream messages through a Kafka writer.
+type kafkaConn struct {
+	producer kafkaProducer
+}
+
+// dialKafka checks that one of brokers is reachable and returns a writer
+// producing to topic through them.
+func dialKafka(ctx context.Context, brokers []string, topic string) (*kafkaConn, error) {
+	var err error
+	for _, broker := range brokers {
+		var conn *kafka.Conn
+		if conn, err = kafka.DialContext(ctx, "tcp", broker); err == nil {
+			conn.Close()
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no kafka broker reachable: %v", err)
+	}
+
+	return &kafkaConn{producer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		WriteTimeout: kafkaTimeout,
+	}}, nil
+}
+
+func (c *kafkaConn) Write(ctx context.Context, msg streamMessage) error {
+	err := c.producer.WriteMessages(ctx, kafka.Message{Key: msg.Key, Value: msg.Value})
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) && len(writeErrors) == 1 {
+		err = writeErrors[0]
+	}
+	// Errors returned by a broker are net.Errors too, but came through
+	var brokerErr kafka.Error
+	if errors.As(err, &brokerErr) {
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || connectionClosed(err) || errors.Is(err, syscall.ECONNREFUSED) {
+		return lostConnection(err)
+	}
+	return err
+}
+
+func (c *kafkaConn) Close() error {
+	return c.producer.Close()
+}
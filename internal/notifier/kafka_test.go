@@ -0,0 +1,75 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// newTestKafka creates a Kafka notifier producing through producer.
+func newTestKafka(t *testing.T, producer *fakeProducer) *KafkaNotifier {
+	t.Helper()
+	k := &KafkaNotifier{
+		Topic: "oom-events",
+		stream: newDialStream(t, func(ctx context.Context) (streamConn, error) {
+			return &kafkaConn{producer: producer}, nil
+		}, time.Millisecond),
+	}
+	waitFor(t, "connection", k.Connected)
+	return k
+}
+
+func TestKafkaProducesEventKeyedByHostname(t *testing.T) {
+	producer := &fakeProducer{}
+	k := newTestKafka(t, producer)
+	defer k.Close()
+
+	if err := k.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	messages := producer.produced()
+	if len(messages) != 1 {
+		t.Fatalf("produced %d messages, want 1", len(messages))
+	}
+	if key := string(messages[0].Key); key != "node-1" {
+		t.Errorf("key = %q, want the hostname", key)
+	}
+	doc := decodeJSON(t, messages[0].Value)
+	if doc["pid"] != "4242" || doc["cmdline"] != "stress --vm 1" || doc["hostname"] != "node-1" {
+		t.Errorf("value %s is not the event", messages[0].Value)
+	}
+}
+
+func TestKafkaCloseClosesProducer(t *testing.T) {
+	producer := &fakeProducer{}
+	k := newTestKafka(t, producer)
+	if err := k.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	// Closing the writer flushes the messages it still batches
+	if err := k.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	producer.mu.Lock()
+	closed := producer.closed
+	producer.mu.Unlock()
+	if !closed {
+		t.Error("Close did not close the producer")
+	}
+	if err := k.Notify(testEvent()); err == nil {
+		t.Error("Notify after Close succeeded")
+	}
+}
+
+func TestKafkaReportsRejectedMessages(t *testing.T) {
+	producer := &fakeProducer{err: kafka.MessageSizeTooLarge}
+	k := newTestKafka(t, producer)
+	defer k.Close()
+
+	if err := k.Notify(testEvent()); err == nil {
+		t.Error("Notify succeeded with the message rejected by the broker")
+	}
+}
@@ -0,0 +1,26 @@
+package notifier
+
+import lru "github.com/hashicorp/golang-lru/v2"
+
+// killCounterKeys bounds the number of fingerprints tracked by a
+// KillCounter; the least recently killed are forgotten first.
+const killCounterKeys = 1024
+
+// KillCounter counts OOM kills per fingerprint since startup.
+type KillCounter struct {
+	counts *lru.Cache[string, int]
+}
+
+func NewKillCounter() *KillCounter {
+	// lru.New only fails for a size below one
+	counts, _ := lru.New[string, int](killCounterKeys)
+	return &KillCounter{counts: counts}
+}
+
+// Add counts a kill of fingerprint and returns the kills counted for it.
+func (c *KillCounter) Add(fingerprint string) int {
+	count, _ := c.counts.Get(fingerprint)
+	count++
+	c.counts.Add(fingerprint, count)
+	return count
+}
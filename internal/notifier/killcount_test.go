@@ -0,0 +1,35 @@
+package notifier
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKillCounterCountsPerFingerprint(t *testing.T) {
+	c := NewKillCounter()
+	for i, tt := range []struct {
+		fingerprint string
+		want        int
+	}{
+		{"java", 1},
+		{"java", 2},
+		{"postgres", 1},
+		{"java", 3},
+		{"postgres", 2},
+	} {
+		if got := c.Add(tt.fingerprint); got != tt.want {
+			t.Errorf("kill %d of %s counted as %d, want %d", i, tt.fingerprint, got, tt.want)
+		}
+	}
+}
+
+func TestKillCounterForgetsLeastRecentlyKilled(t *testing.T) {
+	c := NewKillCounter()
+	c.Add("first")
+	for i := 0; i < killCounterKeys; i++ {
+		c.Add(fmt.Sprint("job-", i))
+	}
+	if got := c.Add("first"); got != 1 {
+		t.Errorf("forgotten fingerprint counted as %d, want it to start over", got)
+	}
+}
@@ -0,0 +1,53 @@
+package notifier
+
+import (
+	"strings"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// LogNotifier logs notifications at info level instead of delivering them.
+// It stands in for a real notifier in dry-run mode and reports that
+// notifier's name, so logs and metrics read the same as a live run.
+type LogNotifier struct {
+	name string
+}
+
+func NewLogNotifier(name string) *LogNotifier {
+	return &LogNotifier{name: name}
+}
+
+func (l *LogNotifier) Name() string {
+	return l.name
+}
+
+func (l *LogNotifier) Notify(event OOMEvent) error {
+	title, _ := eventTitle(event)
+
+	var parts []string
+	for _, field := range eventFields(event) {
+		parts = append(parts, field.Title+": "+strings.ReplaceAll(field.Value, "\n", " | "))
+	}
+	logger.Info("[dry run] %s notification: %s; %s", l.name, title, strings.Join(parts, "; "),
+		logger.F("notifier", l.name), logger.F("dry_run", true))
+	return nil
+}
+
+func (l *LogNotifier) NotifySummary(summary NodeSummary) error {
+	logger.Info("[dry run] %s summary notification: node %s under memory pressure, %d OOM kills of %s",
+		l.name, summary.Hostname, len(summary.Events), strings.Join(summary.Victims, ", "),
+		logger.F("notifier", l.name), logger.F("dry_run", true))
+	return nil
+}
+
+func (l *LogNotifier) NotifyText(text string) error {
+	logger.Info("[dry run] %s text notification: %s", l.name, text,
+		logger.F("notifier", l.name), logger.F("dry_run", true))
+	return nil
+}
+
+func (l *LogNotifier) NotifyDigest(digest Digest) error {
+	logger.Info("[dry run] %s digest notification: %s", l.name, strings.ReplaceAll(DigestText(digest), "\n", " | "),
+		logger.F("notifier", l.name), logger.F("dry_run", true))
+	return nil
+}
@@ -0,0 +1,169 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lokiPushPath is the Loki HTTP push endpoint.
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiNotifier pushes every event to Grafana Loki as a JSON log line, in a
+// stream labelled with the hostname and app="oom-notifier".
+type LokiNotifier struct {
+	URL string
+	// Gzip compresses pushes.
+	Gzip bool
+	// Batch makes NotifyBatch push the events in one request instead of
+	// one request per event.
+	Batch bool
+
+	labels map[string]string
+	client *http.Client
+}
+
+type LokiStream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are [timestamp in nanoseconds, line] pairs.
+	Values [][2]string `json:"values"`
+}
+
+type LokiPayload struct {
+	Streams []LokiStream `json:"streams"`
+}
+
+// NewLokiNotifier creates a Loki notifier pushing to the server at url, with
+// or without the push path. labels are added to the stream labels of every
+// entry.
+func NewLokiNotifier(url string, labels map[string]string, client *http.Client) *LokiNotifier {
+	url = strings.TrimSuffix(url, "/")
+	if !strings.HasSuffix(url, lokiPushPath) {
+		url += lokiPushPath
+	}
+	return &LokiNotifier{
+		URL:    url,
+		labels: labels,
+		client: client,
+	}
+}
+
+func (l *LokiNotifier) Name() string {
+	return "loki"
+}
+
+func (l *LokiNotifier) Notify(event OOMEvent) error {
+	return l.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (l *LokiNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	return l.NotifyBatch(ctx, []OOMEvent{event})
+}
+
+// NotifyBatch delivers events in one push, one stream per set of labels,
+// when Batch is set or there is a single event, and one push per event
+// otherwise.
+func (l *LokiNotifier) NotifyBatch(ctx context.Context, events []OOMEvent) error {
+	if !l.Batch && len(events) > 1 {
+		var errs []error
+		for _, event := range events {
+			errs = append(errs, l.NotifyContext(ctx, event))
+		}
+		return errors.Join(errs...)
+	}
+
+	var payload LokiPayload
+	streams := make(map[string]int)
+	for _, event := range events {
+		line, err := MarshalEvent(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal loki log line: %v", err)
+		}
+
+		timestamp := time.UnixMilli(event.Time)
+		if event.Time == 0 {
+			timestamp = time.Now()
+		}
+		value := [2]string{strconv.FormatInt(timestamp.UnixNano(), 10), string(line)}
+
+		// The hostname is the only label that differs between events
+		i, found := streams[event.Hostname]
+		if !found {
+			i = len(payload.Streams)
+			streams[event.Hostname] = i
+			payload.Streams = append(payload.Streams, LokiStream{Stream: l.streamLabels(event.Hostname)})
+		}
+		payload.Streams[i].Values = append(payload.Streams[i].Values, value)
+	}
+	return l.post(ctx, payload)
+}
+
+// streamLabels returns the labels of the stream of events from hostname.
+func (l *LokiNotifier) streamLabels(hostname string) map[string]string {
+	stream := map[string]string{"app": "oom-notifier"}
+	for name, value := range l.labels {
+		stream[name] = value
+	}
+	stream["hostname"] = hostname
+	return stream
+}
+
+func (l *LokiNotifier) post(ctx context.Context, payload LokiPayload) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal loki payload: %v", err)
+	}
+
+	req, err := newPushRequest(ctx, l.URL, jsonPayload, l.Gzip)
+	if err != nil {
+		return err
+	}
+
+	resp, body, err := doRequest(l.client, req)
+	if err != nil {
+		return fmt.Errorf("failed to send loki notification: %v", err)
+	}
+
+	// Loki answers 204 No Content once the entries are accepted
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("loki API returned status %d: %s", resp.StatusCode, truncate(strings.TrimSpace(string(body)), 200))
+	}
+
+	return nil
+}
+
+// ParseLokiLabels parses name=value label specs. Names follow the Prometheus
+// label syntax.
+func ParseLokiLabels(specs []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok || !validLabelName(name) {
+			return nil, fmt.Errorf("invalid label %q, expected name=value", spec)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// validLabelName reports whether name matches [a-zA-Z_][a-zA-Z0-9_]*.
+func validLabelName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
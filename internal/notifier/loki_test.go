@@ -0,0 +1,121 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLoki(webhook *testWebhook) *LokiNotifier {
+	return NewLokiNotifier(webhook.URL, map[string]string{"env": "prod"}, NewHTTPClient(5*time.Second, nil))
+}
+
+func TestLokiPushPayload(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusNoContent)
+	if err := newTestLoki(webhook).Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var payload LokiPayload
+	webhook.last(t, &payload)
+	if len(payload.Streams) != 1 || len(payload.Streams[0].Values) != 1 {
+		t.Fatalf("payload %+v, want one stream with one entry", payload)
+	}
+	stream := payload.Streams[0]
+	if want := map[string]string{"app": "oom-notifier", "hostname": "node-1", "env": "prod"}; !reflect.DeepEqual(stream.Stream, want) {
+		t.Errorf("labels %v, want %v", stream.Stream, want)
+	}
+	if want := strconv.FormatInt(time.UnixMilli(testEvent().Time).UnixNano(), 10); stream.Values[0][0] != want {
+		t.Errorf("timestamp %s, want %s nanoseconds", stream.Values[0][0], want)
+	}
+	line := decodeJSON(t, []byte(stream.Values[0][1]))
+	if line["pid"] != "4242" || line["cmdline"] != "stress --vm 1" {
+		t.Errorf("line %v, want the JSON encoded event", line)
+	}
+}
+
+func TestLokiPushURL(t *testing.T) {
+	for _, url := range []string{"http://loki:3100", "http://loki:3100/", "http://loki:3100/loki/api/v1/push"} {
+		if got := NewLokiNotifier(url, nil, nil).URL; got != "http://loki:3100/loki/api/v1/push" {
+			t.Errorf("NewLokiNotifier(%q) pushes to %s", url, got)
+		}
+	}
+}
+
+func TestLokiBatchGroupsStreamsByHost(t *testing.T) {
+	events := append(killBurst("node-1", "java", "postgres"), killBurst("node-2", "java")...)
+
+	webhook := newTestWebhook(t, http.StatusNoContent)
+	loki := newTestLoki(webhook)
+	loki.Batch = true
+	if err := loki.NotifyBatch(context.Background(), events); err != nil {
+		t.Fatalf("NotifyBatch: %v", err)
+	}
+	var payload LokiPayload
+	webhook.last(t, &payload)
+	if webhook.received() != 1 || len(payload.Streams) != 2 {
+		t.Fatalf("%d pushes of %d streams, want one push with a stream per host", webhook.received(), len(payload.Streams))
+	}
+	if len(payload.Streams[0].Values) != 2 || len(payload.Streams[1].Values) != 1 {
+		t.Errorf("streams of %d and %d entries, want 2 and 1", len(payload.Streams[0].Values), len(payload.Streams[1].Values))
+	}
+
+	unbatched := newTestWebhook(t, http.StatusNoContent)
+	if err := newTestLoki(unbatched).NotifyBatch(context.Background(), events); err != nil {
+		t.Fatalf("NotifyBatch: %v", err)
+	}
+	if unbatched.received() != 3 {
+		t.Errorf("%d pushes without Batch, want one per event", unbatched.received())
+	}
+}
+
+func TestLokiGzip(t *testing.T) {
+	url, requests := newSigningWebhook(t, http.StatusNoContent)
+	loki := NewLokiNotifier(url, nil, NewHTTPClient(5*time.Second, nil))
+	loki.Gzip = true
+	loki.Batch = true
+	if err := loki.NotifyBatch(context.Background(), killBurst("node-1", "java", "postgres")); err != nil {
+		t.Fatalf("NotifyBatch: %v", err)
+	}
+
+	if len(*requests) != 1 || (*requests)[0].encoding != "gzip" {
+		t.Fatalf("requests %+v, want one push with Content-Encoding gzip", *requests)
+	}
+	var payload LokiPayload
+	if err := json.Unmarshal(gunzip(t, (*requests)[0].body), &payload); err != nil {
+		t.Fatalf("decompressed push is not JSON: %v", err)
+	}
+	if len(payload.Streams) != 1 || len(payload.Streams[0].Values) != 2 {
+		t.Errorf("payload %+v, want one stream with both kills", payload)
+	}
+}
+
+func TestLokiReportsRejectedPushes(t *testing.T) {
+	if err := newTestLoki(newTestWebhook(t, http.StatusOK)).Notify(testEvent()); err != nil {
+		t.Errorf("Notify = %v for 200, want success", err)
+	}
+	err := newTestLoki(newTestWebhook(t, http.StatusBadRequest)).Notify(testEvent())
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Notify = %v, want the 400 status", err)
+	}
+}
+
+func TestParseLokiLabels(t *testing.T) {
+	labels, err := ParseLokiLabels([]string{"env=prod", "cluster_name=eu-1", "empty="})
+	if err != nil {
+		t.Fatalf("ParseLokiLabels: %v", err)
+	}
+	if want := map[string]string{"env": "prod", "cluster_name": "eu-1", "empty": ""}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels %v, want %v", labels, want)
+	}
+	for _, spec := range []string{"env", "=prod", "1env=prod", "env-name=prod"} {
+		if _, err := ParseLokiLabels([]string{spec}); err == nil {
+			t.Errorf("ParseLokiLabels accepted %q", spec)
+		}
+	}
+}
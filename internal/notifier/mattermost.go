@@ -0,0 +1,103 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MattermostNotifier posts to a Mattermost incoming webhook. Mattermost
+// accepts Slack's attachments, which are rendered the same way.
+type MattermostNotifier struct {
+	WebhookURL string
+	// Channel overrides the webhook's channel when set, as a channel name
+	// such as "town-square".
+	Channel string
+	// Username overrides the webhook's username when the server allows it.
+	Username string
+	client   *http.Client
+}
+
+type MattermostPayload struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+// NewMattermostNotifier creates a notifier posting to webhookURL. channel may
+// be empty to post to the webhook's channel.
+func NewMattermostNotifier(webhookURL, channel string, client *http.Client) *MattermostNotifier {
+	return &MattermostNotifier{
+		WebhookURL: webhookURL,
+		Channel:    channel,
+		Username:   SlackDefaultUsername,
+		client:     client,
+	}
+}
+
+func (m *MattermostNotifier) Name() string {
+	return "mattermost"
+}
+
+func (m *MattermostNotifier) Notify(event OOMEvent) error {
+	return m.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (m *MattermostNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	title, text := eventTitle(event)
+	return m.post(ctx, MattermostPayload{
+		Channel:     m.Channel,
+		Username:    m.Username,
+		Text:        text,
+		Attachments: eventAttachments(title, event),
+	})
+}
+
+func (m *MattermostNotifier) NotifyText(text string) error {
+	return m.NotifyTextContext(context.Background(), text)
+}
+
+// NotifyTextContext is NotifyText with the request cancelled once ctx is
+// done.
+func (m *MattermostNotifier) NotifyTextContext(ctx context.Context, text string) error {
+	return m.post(ctx, MattermostPayload{
+		Channel:  m.Channel,
+		Username: m.Username,
+		Text:     text,
+	})
+}
+
+func (m *MattermostNotifier) post(ctx context.Context, payload MattermostPayload) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal mattermost payload: %v", err)
+	}
+
+	req, err := newJSONRequest(ctx, m.WebhookURL, jsonPayload)
+	if err != nil {
+		return err
+	}
+
+	resp, body, err := doRequest(m.client, req)
+	if err != nil {
+		return fmt.Errorf("failed to send mattermost notification: %v", err)
+	}
+
+	// Success is a 200 with the plain text body "ok", errors carry a JSON
+	// body with a message
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("mattermost API returned status %d: %s", resp.StatusCode, apiErr.Message)
+		}
+		return fmt.Errorf("mattermost API returned status %d: %s", resp.StatusCode, truncate(strings.TrimSpace(string(body)), 200))
+	}
+
+	return nil
+}
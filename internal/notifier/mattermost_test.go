@@ -0,0 +1,96 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestMattermost returns a notifier posting to an incoming webhook
+// answering with status and body, and records the payloads it gets.
+func newTestMattermost(t *testing.T, channel string, status int, body string) (*MattermostNotifier, *[]map[string]any) {
+	t.Helper()
+	var payloads []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return NewMattermostNotifier(server.URL, channel, NewHTTPClient(5*time.Second, nil)), &payloads
+}
+
+func TestMattermostPostsAttachments(t *testing.T) {
+	mattermost, payloads := newTestMattermost(t, "town-square", http.StatusOK, "ok")
+
+	if err := mattermost.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify with a plain ok response: %v", err)
+	}
+	if len(*payloads) != 1 {
+		t.Fatalf("%d requests, want 1", len(*payloads))
+	}
+	payload := (*payloads)[0]
+	if payload["channel"] != "town-square" || payload["username"] != SlackDefaultUsername {
+		t.Errorf("posted to %v as %v, want town-square as %s", payload["channel"], payload["username"], SlackDefaultUsername)
+	}
+	if _, ok := payload["icon_emoji"]; ok {
+		t.Error("payload carries the Slack icon emoji")
+	}
+	if text, _ := payload["text"].(string); text == "" {
+		t.Error("payload lacks the notification text")
+	}
+
+	var attachments []SlackAttachment
+	data, _ := json.Marshal(payload["attachments"])
+	json.Unmarshal(data, &attachments)
+	if len(attachments) == 0 {
+		t.Fatal("payload lacks the event attachment")
+	}
+	fields := map[string]string{}
+	for _, field := range attachments[0].Fields {
+		fields[field.Title] = field.Value
+	}
+	if fields["Process ID"] != "4242" || fields["Hostname"] != "node-1" {
+		t.Errorf("attachment fields %v, want the event rendered like Slack", fields)
+	}
+}
+
+func TestMattermostOmitsEmptyChannel(t *testing.T) {
+	mattermost, payloads := newTestMattermost(t, "", http.StatusOK, "ok")
+
+	if err := mattermost.NotifyText("3 OOM kills since midnight"); err != nil {
+		t.Fatalf("NotifyText: %v", err)
+	}
+	payload := (*payloads)[0]
+	if _, ok := payload["channel"]; ok {
+		t.Errorf("payload %v sets a channel, want the webhook's own", payload)
+	}
+	if payload["text"] != "3 OOM kills since midnight" {
+		t.Errorf("text = %v", payload["text"])
+	}
+}
+
+func TestMattermostReportsErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"json message", http.StatusBadRequest, `{"id": "web.incoming_webhook.channel.app_error", "message": "Couldn't find the channel."}`, "status 400: Couldn't find the channel."},
+		{"plain text", http.StatusForbidden, "Forbidden", "status 403: Forbidden"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mattermost, _ := newTestMattermost(t, "", tt.status, tt.body)
+			if err := mattermost.Notify(testEvent()); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Notify = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// MuteList suppresses alerts for hosts or workloads listed in an external
+// source. The source holds one entry per line, either a hostname or a label
+// selector of comma separated key=value pairs, such as
+// namespace=payments,container=api, muting the events matching every pair.
+// Blank lines and lines starting with # are ignored. It is re-read
+// periodically so alerts can be muted and unmuted without a restart.
+type MuteList struct {
+	source     string
+	interval   time.Duration
+	load       func() ([]byte, bool, error)
+	mu         sync.RWMutex
+	entries    muteEntries
+	suppressed atomic.Uint64
+}
+
+// muteEntries is a parsed mute list.
+type muteEntries struct {
+	hosts     map[string]bool
+	selectors []map[string]string
+}
+
+// NewMuteFile creates a mute list backed by a local file. The file is only
+// re-parsed when its modification time changes, and a missing file mutes
+// nothing.
+func NewMuteFile(path string, interval time.Duration) *MuteList {
+	var lastMod time.Time
+	load := func() ([]byte, bool, error) {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			// A removed file unmutes every host
+			changed := !lastMod.IsZero()
+			lastMod = time.Time{}
+			return nil, changed, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if info.ModTime().Equal(lastMod) {
+			return nil, false, nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, false, err
+		}
+		lastMod = info.ModTime()
+		return data, true, nil
+	}
+
+	return &MuteList{source: path, interval: interval, load: load}
+}
+
+// NewMuteURL creates a mute list backed by an HTTP endpoint that is polled
+// every interval with client.
+func NewMuteURL(url string, interval time.Duration, client *http.Client) *MuteList {
+	load := func() ([]byte, bool, error) {
+		resp, err := client.Get(url)
+		if err != nil {
+			return nil, false, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, false, fmt.Errorf("mute endpoint returned non-200 status: %d", resp.StatusCode)
+		}
+
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		return data, true, nil
+	}
+
+	return &MuteList{source: url, interval: interval, load: load}
+}
+
+// Source returns the file or URL the list is loaded from.
+func (m *MuteList) Source() string {
+	return m.source
+}
+
+// Start loads the list once and then keeps it up to date in the background.
+// Errors keep the previously loaded list in place.
+func (m *MuteList) Start() {
+	m.reload()
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			m.reload()
+		}
+	}()
+}
+
+func (m *MuteList) reload() {
+	data, changed, err := m.load()
+	if err != nil {
+		logger.Warn("Failed to load mute list from %s: %v", m.source, err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	entries, invalid := parseMuteList(data)
+	for _, line := range invalid {
+		logger.Warn("Ignoring invalid mute list entry %q from %s, expected a hostname or key=value pairs", line, m.source)
+	}
+
+	m.mu.Lock()
+	m.entries = entries
+	m.mu.Unlock()
+
+	logger.Info("Loaded mute list from %s with %d hosts and %d label selectors", m.source, len(entries.hosts), len(entries.selectors))
+}
+
+// IsMuted reports whether alerts for event are suppressed, by its hostname
+// or labels, counting every suppressed event.
+func (m *MuteList) IsMuted(event OOMEvent) bool {
+	m.mu.RLock()
+	muted := m.entries.match(event)
+	m.mu.RUnlock()
+
+	if muted {
+		m.suppressed.Add(1)
+	}
+	return muted
+}
+
+// Suppressed returns the number of events suppressed so far.
+func (m *MuteList) Suppressed() uint64 {
+	return m.suppressed.Load()
+}
+
+func (e muteEntries) match(event OOMEvent) bool {
+	if e.hosts[event.Hostname] {
+		return true
+	}
+	for _, selector := range e.selectors {
+		matched := true
+		for key, value := range selector {
+			if label, ok := muteLabel(event, key); !ok || label != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// muteLabel returns the label key of event for mute list selectors: hostname,
+// kind, oom_type, cgroup, namespace, pod, container and image, or else the
+// custom field of that name.
+func muteLabel(event OOMEvent, key string) (string, bool) {
+	switch key {
+	case "hostname":
+		return event.Hostname, true
+	case "kind":
+		return event.Kind, true
+	case "oom_type":
+		return event.OOMType, true
+	case "cgroup":
+		return event.Cgroup, true
+	case "namespace":
+		return event.Namespace, true
+	case "pod":
+		return event.PodName, true
+	case "container":
+		return event.ContainerName, true
+	case "image":
+		return event.ContainerImage, true
+	}
+	value, ok := event.Fields[key]
+	return value, ok
+}
+
+// parseMuteList parses the entries of a mute list, returning the lines
+// that are neither a hostname nor a label selector apart.
+func parseMuteList(data []byte) (muteEntries, []string) {
+	entries := muteEntries{hosts: make(map[string]bool)}
+	var invalid []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.Contains(line, "=") {
+			entries.hosts[line] = true
+			continue
+		}
+
+		selector := make(map[string]string)
+		for _, pair := range strings.Split(line, ",") {
+			key, value, found := strings.Cut(pair, "=")
+			key = strings.TrimSpace(key)
+			if !found || key == "" {
+				selector = nil
+				break
+			}
+			selector[key] = strings.TrimSpace(value)
+		}
+		if selector == nil {
+			invalid = append(invalid, line)
+			continue
+		}
+		entries.selectors = append(entries.selectors, selector)
+	}
+	return entries, invalid
+}
+
+// HostMutes drops the events of hosts muted by name or regular expression,
+// such as lab hosts that run out of memory by design. Unlike MuteList it is
+// fixed at startup, and it is checked before events are enriched. It is
+// safe for concurrent use.
+type HostMutes struct {
+	patterns []*regexp.Regexp
+	dropped  atomic.Uint64
+}
+
+// NewHostMutes creates mutes from hostnames and regular expressions, which
+// must match the whole hostname: lab-.* mutes lab-1 but not my-lab-1, and a
+// plain hostname mutes that host only.
+func NewHostMutes(hosts []string) (*HostMutes, error) {
+	m := &HostMutes{}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			return nil, fmt.Errorf("muted host is empty")
+		}
+		pattern, err := regexp.Compile("^(?:" + host + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid muted host %q: %v", host, err)
+		}
+		m.patterns = append(m.patterns, pattern)
+	}
+	return m, nil
+}
+
+// Muted reports whether the events of hostname are dropped, counting every
+// dropped event.
+func (m *HostMutes) Muted(hostname string) bool {
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(hostname) {
+			m.dropped.Add(1)
+			return true
+		}
+	}
+	return false
+}
+
+// Dropped returns the number of events dropped so far.
+func (m *HostMutes) Dropped() uint64 {
+	return m.dropped.Load()
+}
@@ -0,0 +1,194 @@
+package notifier
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseMuteList(t *testing.T) {
+	entries, invalid := parseMuteList([]byte(`
+# maintenance
+node-1
+  node-2
+namespace=payments
+namespace = batch , container = worker
+=broken
+`))
+
+	if !reflect.DeepEqual(entries.hosts, map[string]bool{"node-1": true, "node-2": true}) {
+		t.Errorf("hosts = %v", entries.hosts)
+	}
+	wantSelectors := []map[string]string{
+		{"namespace": "payments"},
+		{"namespace": "batch", "container": "worker"},
+	}
+	if !reflect.DeepEqual(entries.selectors, wantSelectors) {
+		t.Errorf("selectors = %v, want %v", entries.selectors, wantSelectors)
+	}
+	if !reflect.DeepEqual(invalid, []string{"=broken"}) {
+		t.Errorf("invalid = %q, want [=broken]", invalid)
+	}
+}
+
+func TestMuteListMatchesHostsAndLabels(t *testing.T) {
+	m := &MuteList{}
+	m.entries, _ = parseMuteList([]byte("node-9\nnamespace=batch,container=worker\nteam=data\n"))
+
+	pod := func(namespace, container string) OOMEvent {
+		event := testEvent()
+		event.Namespace = namespace
+		event.ContainerName = container
+		return event
+	}
+	field := testEvent()
+	field.Fields = map[string]string{"team": "data"}
+	host := testEvent()
+	host.Hostname = "node-9"
+
+	for _, tt := range []struct {
+		name  string
+		event OOMEvent
+		muted bool
+	}{
+		{"unlisted", testEvent(), false},
+		{"hostname", host, true},
+		{"every label", pod("batch", "worker"), true},
+		{"some labels", pod("batch", "api"), false},
+		{"custom field", field, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.IsMuted(tt.event); got != tt.muted {
+				t.Errorf("IsMuted = %v, want %v", got, tt.muted)
+			}
+		})
+	}
+	if got := m.Suppressed(); got != 3 {
+		t.Errorf("Suppressed() = %d, want 3", got)
+	}
+}
+
+func TestMuteFileReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mutes")
+	m := NewMuteFile(path, time.Hour)
+	event := testEvent()
+
+	m.reload()
+	if m.IsMuted(event) {
+		t.Fatal("event muted without a mute file")
+	}
+
+	if err := os.WriteFile(path, []byte(event.Hostname+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m.reload()
+	if !m.IsMuted(event) {
+		t.Fatal("host not muted once listed")
+	}
+
+	// Make the change visible even on filesystems with coarse timestamps
+	if err := os.WriteFile(path, []byte("namespace=other\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	m.reload()
+	if m.IsMuted(event) {
+		t.Fatal("host still muted once unlisted")
+	}
+
+	if err := os.WriteFile(path, []byte(event.Hostname+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, later.Add(time.Minute), later.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	m.reload()
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	m.reload()
+	if m.IsMuted(event) {
+		t.Error("host still muted once the mute file was removed")
+	}
+}
+
+func TestMuteURLKeepsListOnError(t *testing.T) {
+	var mu sync.Mutex
+	body, status := "node-1\n", http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	m := NewMuteURL(server.URL, time.Hour, server.Client())
+	event := testEvent()
+	m.reload()
+	if !m.IsMuted(event) {
+		t.Fatal("host listed by the mute URL not muted")
+	}
+
+	mu.Lock()
+	body, status = "", http.StatusInternalServerError
+	mu.Unlock()
+	m.reload()
+	if !m.IsMuted(event) {
+		t.Error("failed reload unmuted the host")
+	}
+
+	mu.Lock()
+	body, status = "", http.StatusOK
+	mu.Unlock()
+	m.reload()
+	if m.IsMuted(event) {
+		t.Error("host still muted once the mute URL returned an empty list")
+	}
+}
+
+func TestHostMutes(t *testing.T) {
+	mutes, err := NewHostMutes([]string{"lab-7", "ci-[0-9]+", " bench-.* "})
+	if err != nil {
+		t.Fatalf("NewHostMutes: %v", err)
+	}
+	for hostname, want := range map[string]bool{
+		"lab-7":     true,
+		"lab-70":    false,
+		"my-lab-7":  false,
+		"ci-1":      true,
+		"ci-42":     true,
+		"ci-x":      false,
+		"bench-gpu": true,
+		"node-1":    false,
+		"":          false,
+	} {
+		if got := mutes.Muted(hostname); got != want {
+			t.Errorf("Muted(%q) = %v, want %v", hostname, got, want)
+		}
+	}
+	if got := mutes.Dropped(); got != 4 {
+		t.Errorf("Dropped() = %d, want the 4 muted events", got)
+	}
+
+	none, err := NewHostMutes(nil)
+	if err != nil || none.Muted("lab-7") {
+		t.Errorf("empty mutes muted lab-7 (%v)", err)
+	}
+}
+
+func TestNewHostMutesRejectsInvalidHosts(t *testing.T) {
+	for _, host := range []string{"", "  ", "lab-(7"} {
+		if _, err := NewHostMutes([]string{"node-1", host}); err == nil {
+			t.Errorf("NewHostMutes accepted %q", host)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsTimeout bounds waiting for the server to acknowledge a flush.
+const natsTimeout = 10 * time.Second
+
+// natsPublisher is the part of the NATS connection used by NATSNotifier.
+type natsPublisher interface {
+	Publish(subject string, data []byte) error
+	FlushTimeout(timeout time.Duration) error
+	Close()
+}
+
+// NATSNotifier publishes every event to a NATS subject as JSON. Events
+// published while no server is reachable are held by its stream and
+// published once one is back.
+type NATSNotifier struct {
+	Subject string
+	stream  *stream
+}
+
+// NewNATSNotifier creates a NATS notifier publishing to subject on the
+// server at url, or a comma separated list of servers. The connection is
+// made in the background and made again whenever it is lost, including when
+// no server is reachable at startup.
+func NewNATSNotifier(url, subject string) *NATSNotifier {
+	return &NATSNotifier{
+		Subject: subject,
+		stream: newStream("nats", func(ctx context.Context) (streamConn, error) {
+			return dialNATS(ctx, url, subject)
+		}),
+	}
+}
+
+func (n *NATSNotifier) Name() string {
+	return "nats"
+}
+
+// Notify publishes event and waits for the server to have received it.
+func (n *NATSNotifier) Notify(event OOMEvent) error {
+	data, err := MarshalEvent(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal nats message: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	if err := n.stream.Write(ctx, streamMessage{Value: data}); err != nil {
+		return fmt.Errorf("failed to publish nats message: %v", err)
+	}
+	return nil
+}
+
+// Connected reports whether the server is reachable.
+func (n *NATSNotifier) Connected() bool {
+	return n.stream.Connected()
+}
+
+// Close publishes the messages held while disconnected and closes the
+// connection.
+func (n *NATSNotifier) Close() error {
+	return n.stream.Close()
+}
+
+// natsConn publishes stream messages on a NATS subject.
+type natsConn struct {
+	subject   string
+	publisher natsPublisher
+}
+
+// dialNATS connects to the server at url. The client's own reconnection is
+// disabled, the stream reconnects instead, so that a lost connection fails
+// publishing rather than buffering it out of sight.
+func dialNATS(ctx context.Context, url, subject string) (*natsConn, error) {
+	timeout := natsTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	conn, err := nats.Connect(url,
+		nats.Name("oom-notifier"),
+		nats.Timeout(timeout),
+		nats.NoReconnect(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to nats: %v", err)
+	}
+	return &natsConn{subject: subject, publisher: conn}, nil
+}
+
+func (c *natsConn) Write(ctx context.Context, msg streamMessage) error {
+	timeout := natsTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	err := c.publisher.Publish(c.subject, msg.Value)
+	if err == nil {
+		err = c.publisher.FlushTimeout(timeout)
+	}
+	if errors.Is(err, nats.ErrConnectionClosed) || errors.Is(err, nats.ErrConnectionReconnecting) ||
+		errors.Is(err, nats.ErrTimeout) || errors.Is(err, nats.ErrNoServers) || connectionClosed(err) {
+		return lostConnection(err)
+	}
+	return err
+}
+
+func (c *natsConn) Close() error {
+	c.publisher.Close()
+	return nil
+}
@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// newTestNATS creates a NATS notifier publishing through publisher.
+func newTestNATS(t *testing.T, publisher *fakePublisher) *NATSNotifier {
+	t.Helper()
+	n := &NATSNotifier{
+		Subject: "oom.events",
+		stream: newDialStream(t, func(ctx context.Context) (streamConn, error) {
+			return &natsConn{subject: "oom.events", publisher: publisher}, nil
+		}, time.Millisecond),
+	}
+	waitFor(t, "connection", n.Connected)
+	return n
+}
+
+func TestNATSPublishesEventToSubject(t *testing.T) {
+	publisher := &fakePublisher{}
+	n := newTestNATS(t, publisher)
+	defer n.Close()
+
+	for _, event := range killBurst("node-1", "java", "postgres") {
+		if err := n.Notify(event); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+	messages := publisher.messages()
+	if len(messages) != 2 {
+		t.Fatalf("published %d messages, want one per event", len(messages))
+	}
+	for i, cmdline := range []string{"java", "postgres"} {
+		subject, data, _ := strings.Cut(messages[i], " ")
+		if subject != "oom.events" {
+			t.Errorf("message %d published to %q, want oom.events", i, subject)
+		}
+		if doc := decodeJSON(t, []byte(data)); doc["cmdline"] != cmdline || doc["hostname"] != "node-1" {
+			t.Errorf("message %d %s is not the event of %s", i, data, cmdline)
+		}
+	}
+}
+
+func TestNATSCloseClosesConnection(t *testing.T) {
+	publisher := &fakePublisher{}
+	n := newTestNATS(t, publisher)
+	if err := n.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	if err := n.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	publisher.mu.Lock()
+	closed := publisher.closed
+	publisher.mu.Unlock()
+	if !closed {
+		t.Error("Close did not close the connection")
+	}
+	if err := n.Notify(testEvent()); err == nil {
+		t.Error("Notify after Close succeeded")
+	}
+}
+
+func TestNATSReportsRejectedMessages(t *testing.T) {
+	n := newTestNATS(t, &fakePublisher{publishErr: nats.ErrMaxPayload})
+	defer n.Close()
+
+	if err := n.Notify(testEvent()); err == nil {
+		t.Error("Notify succeeded with the message rejected by the server")
+	}
+}
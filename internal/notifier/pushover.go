@@ -0,0 +1,145 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// pushoverAPI is the Pushover messages endpoint.
+	pushoverAPI = "https://api.pushover.net/1/messages.json"
+	// maxPushoverTitle and maxPushoverMessage are the longest title and
+	// message accepted by the API.
+	maxPushoverTitle   = 250
+	maxPushoverMessage = 1024
+	// maxPushoverField bounds each field value so that a long command line
+	// leaves room for the others.
+	maxPushoverField = 200
+)
+
+// Pushover priorities: high priority bypasses quiet hours.
+const (
+	pushoverNormal = 0
+	pushoverHigh   = 1
+)
+
+// PushoverNotifier sends push notifications to a Pushover user or group.
+type PushoverNotifier struct {
+	UserKey string
+	token   string
+	apiURL  string
+	client  *http.Client
+}
+
+type PushoverPayload struct {
+	Token    string `json:"token"`
+	User     string `json:"user"`
+	Title    string `json:"title,omitempty"`
+	Message  string `json:"message"`
+	Priority int    `json:"priority"`
+}
+
+// pushoverResponse is the body of every messages API response.
+type pushoverResponse struct {
+	Status int      `json:"status"`
+	Errors []string `json:"errors"`
+}
+
+// NewPushoverNotifier creates a notifier sending as the application
+// identified by token to userKey, a user or group key.
+func NewPushoverNotifier(token, userKey string, client *http.Client) *PushoverNotifier {
+	return &PushoverNotifier{
+		UserKey: userKey,
+		token:   token,
+		apiURL:  pushoverAPI,
+		client:  client,
+	}
+}
+
+func (p *PushoverNotifier) Name() string {
+	return "pushover"
+}
+
+// Notify sends event with its fields as the message. Events escalated by
+// flap detection are sent with high priority.
+func (p *PushoverNotifier) Notify(event OOMEvent) error {
+	return p.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (p *PushoverNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	title, _ := eventTitle(event)
+
+	var lines []string
+	for _, field := range eventFields(event) {
+		lines = append(lines, field.Title+": "+truncate(field.Value, maxPushoverField))
+	}
+
+	priority := pushoverNormal
+	if event.Severity == SeverityHigh {
+		priority = pushoverHigh
+	}
+
+	return p.post(ctx, PushoverPayload{
+		Token:    p.token,
+		User:     p.UserKey,
+		Title:    truncate(title, maxPushoverTitle),
+		Message:  truncate(strings.Join(lines, "\n"), maxPushoverMessage),
+		Priority: priority,
+	})
+}
+
+func (p *PushoverNotifier) NotifyText(text string) error {
+	return p.NotifyTextContext(context.Background(), text)
+}
+
+// NotifyTextContext is NotifyText with the request cancelled once ctx is
+// done.
+func (p *PushoverNotifier) NotifyTextContext(ctx context.Context, text string) error {
+	return p.post(ctx, PushoverPayload{
+		Token:   p.token,
+		User:    p.UserKey,
+		Message: truncate(text, maxPushoverMessage),
+	})
+}
+
+func (p *PushoverNotifier) post(ctx context.Context, payload PushoverPayload) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pushover payload: %v", err)
+	}
+
+	req, err := newJSONRequest(ctx, p.apiURL, jsonPayload)
+	if err != nil {
+		return err
+	}
+
+	resp, body, err := doRequest(p.client, req)
+	if err != nil {
+		return fmt.Errorf("failed to send pushover notification: %v", err)
+	}
+
+	// Failures come back as {"status": 0, "errors": [...]}, with a 4xx
+	// status when the request was invalid
+	var result pushoverResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("pushover API returned non-200 status: %d", resp.StatusCode)
+		}
+		return fmt.Errorf("failed to parse pushover API response: %v", err)
+	}
+	if result.Status != 1 {
+		if len(result.Errors) == 0 {
+			return fmt.Errorf("pushover API returned status %d", resp.StatusCode)
+		}
+		return fmt.Errorf("pushover API returned error: %s", strings.Join(result.Errors, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("pushover API returned non-200 status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package notifier
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestPushover returns a notifier sending to a messages API answering
+// with status and body, and records the payloads it gets.
+func newTestPushover(t *testing.T, status int, body string) (*PushoverNotifier, *[]PushoverPayload) {
+	t.Helper()
+	var payloads []PushoverPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload PushoverPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	pushover := NewPushoverNotifier("app-token", "user-key", NewHTTPClient(5*time.Second, nil))
+	pushover.apiURL = server.URL
+	return pushover, &payloads
+}
+
+func TestPushoverSendsMessage(t *testing.T) {
+	pushover, payloads := newTestPushover(t, http.StatusOK, `{"status": 1, "request": "1a2b"}`)
+
+	if err := pushover.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(*payloads) != 1 {
+		t.Fatalf("%d requests, want 1", len(*payloads))
+	}
+	payload := (*payloads)[0]
+	if payload.Token != "app-token" || payload.User != "user-key" {
+		t.Errorf("sent as %q to %q, want app-token to user-key", payload.Token, payload.User)
+	}
+	if payload.Title != "🚨 Out of Memory (OOM) Event Detected" {
+		t.Errorf("title = %q", payload.Title)
+	}
+	for _, want := range []string{"Process ID: 4242", "Process Command: stress --vm 1", "Hostname: node-1"} {
+		if !strings.Contains(payload.Message, want) {
+			t.Errorf("message %q lacks %q", payload.Message, want)
+		}
+	}
+	if payload.Priority != pushoverNormal {
+		t.Errorf("priority = %d, want normal", payload.Priority)
+	}
+}
+
+func TestPushoverEscalationIsHighPriority(t *testing.T) {
+	pushover, payloads := newTestPushover(t, http.StatusOK, `{"status": 1}`)
+	event := testEvent()
+	event.Severity, event.Repeats = SeverityHigh, 3
+
+	if err := pushover.Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if got := (*payloads)[0].Priority; got != pushoverHigh {
+		t.Errorf("priority = %d, want high for an escalated event", got)
+	}
+}
+
+func TestPushoverBoundsMessage(t *testing.T) {
+	pushover, payloads := newTestPushover(t, http.StatusOK, `{"status": 1}`)
+	event := testEvent()
+	event.Cmdline = strings.Repeat("x", 2*maxPushoverMessage)
+
+	if err := pushover.Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	payload := (*payloads)[0]
+	if len(payload.Message) > maxPushoverMessage || !strings.Contains(payload.Message, "Hostname: node-1") {
+		t.Errorf("message of %d bytes, want at most %d with every field", len(payload.Message), maxPushoverMessage)
+	}
+}
+
+func TestPushoverReportsAPIErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		status int
+		body   string
+		want   string
+	}{
+		{"errors", http.StatusBadRequest, `{"status": 0, "errors": ["user identifier is invalid"]}`, "user identifier is invalid"},
+		{"status 0", http.StatusOK, `{"status": 0}`, "status 200"},
+		{"not json", http.StatusBadGateway, `<html>`, "non-200 status: 502"},
+		{"server error", http.StatusInternalServerError, `{"status": 1}`, "non-200 status: 500"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			pushover, _ := newTestPushover(t, tt.status, tt.body)
+			err := pushover.Notify(testEvent())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Notify = %v, want an error mentioning %q", err, tt.want)
+			}
+			if err != nil && strings.Contains(err.Error(), "app-token") {
+				t.Errorf("error %q reveals the application token", err)
+			}
+		})
+	}
+}
+
+func TestPushoverNotifyText(t *testing.T) {
+	pushover, payloads := newTestPushover(t, http.StatusOK, `{"status": 1}`)
+
+	if err := pushover.NotifyText("3 OOM kills since midnight"); err != nil {
+		t.Fatalf("NotifyText: %v", err)
+	}
+	if payload := (*payloads)[0]; payload.Message != "3 OOM kills since midnight" || payload.Title != "" {
+		t.Errorf("payload = %+v, want the text as the message", payload)
+	}
+}
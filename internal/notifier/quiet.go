@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// severityRanks orders the severities from least to most urgent.
+var severityRanks = map[string]int{
+	SeverityPressure: 0,
+	SeverityWarning:  1,
+	SeverityCritical: 2,
+	SeverityHigh:     3,
+}
+
+// QuietHours suppresses the events below a severity during a daily window,
+// e.g. 22:00-07:00, in the time zone set by SetTimezone. Suppressed events
+// may be held with Add and flushed into a digest once the window ends.
+// Critical and escalated events are never suppressed.
+type QuietHours struct {
+	// start and end are minutes after midnight, the window wraps around
+	// midnight when end is before start.
+	start, end  int
+	minSeverity string
+	pending     []OOMEvent
+	now         func() time.Time
+}
+
+// NewQuietHours creates quiet hours from spec, HH:MM-HH:MM, suppressing the
+// events below minSeverity, SeverityWarning or SeverityCritical.
+func NewQuietHours(spec, minSeverity string) (*QuietHours, error) {
+	from, to, found := strings.Cut(spec, "-")
+	if !found {
+		return nil, fmt.Errorf("invalid quiet hours %q, expected HH:MM-HH:MM", spec)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %v", spec, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quiet hours %q: %v", spec, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid quiet hours %q, the window is empty", spec)
+	}
+	if minSeverity != SeverityWarning && minSeverity != SeverityCritical {
+		return nil, fmt.Errorf("invalid quiet hours severity %q, expected %s or %s", minSeverity, SeverityWarning, SeverityCritical)
+	}
+	return &QuietHours{start: start, end: end, minSeverity: minSeverity, now: time.Now}, nil
+}
+
+// parseClock returns the minutes after midnight of a HH:MM time.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a HH:MM time", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Active reports whether the window is open now.
+func (q *QuietHours) Active() bool {
+	now := q.now().In(location)
+	minute := now.Hour()*60 + now.Minute()
+	if q.start < q.end {
+		return minute >= q.start && minute < q.end
+	}
+	return minute >= q.start || minute < q.end
+}
+
+// Suppresses reports whether event is to be held back now: the window is
+// open and the event is below the severity. Test events are never
+// suppressed, and neither are events of an unknown severity.
+func (q *QuietHours) Suppresses(event OOMEvent) bool {
+	if event.Test || !q.Active() {
+		return false
+	}
+	rank, known := severityRanks[event.Severity]
+	return known && rank < severityRanks[q.minSeverity]
+}
+
+// Remaining returns the time until the window closes.
+func (q *QuietHours) Remaining() time.Duration {
+	now := q.now().In(location)
+	end := time.Date(now.Year(), now.Month(), now.Day(), q.end/60, q.end%60, 0, 0, location)
+	if !end.After(now) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end.Sub(now)
+}
+
+// Add holds a suppressed event. It returns true for the first event held
+// during the window, in which case the caller is responsible for calling
+// Flush once the window has closed, see Remaining.
+func (q *QuietHours) Add(event OOMEvent) bool {
+	q.pending = append(q.pending, event)
+	return len(q.pending) == 1
+}
+
+// Flush empties the held events and returns them in arrival order.
+func (q *QuietHours) Flush() []OOMEvent {
+	events := q.pending
+	q.pending = nil
+	return events
+}
@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestQuietHours(t *testing.T, spec string, clock *fakeClock) *QuietHours {
+	t.Helper()
+	q, err := NewQuietHours(spec, SeverityCritical)
+	if err != nil {
+		t.Fatalf("NewQuietHours: %v", err)
+	}
+	q.now = clock.Now
+	return q
+}
+
+func TestQuietHoursSuppressesBelowSeverityInsideWindow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 15, 23, 30, 0, 0, time.UTC)}
+	q := newTestQuietHours(t, "22:00-07:00", clock)
+
+	for _, tt := range []struct {
+		name       string
+		at         time.Time
+		severity   string
+		suppressed bool
+	}{
+		{"warning at night", time.Date(2024, 1, 15, 23, 30, 0, 0, time.UTC), SeverityWarning, true},
+		{"critical at night", time.Date(2024, 1, 15, 23, 30, 0, 0, time.UTC), SeverityCritical, false},
+		{"escalated at night", time.Date(2024, 1, 16, 3, 0, 0, 0, time.UTC), SeverityHigh, false},
+		{"warning after midnight", time.Date(2024, 1, 16, 6, 59, 0, 0, time.UTC), SeverityWarning, true},
+		{"warning in the morning", time.Date(2024, 1, 16, 7, 0, 0, 0, time.UTC), SeverityWarning, false},
+		{"critical during the day", time.Date(2024, 1, 16, 12, 0, 0, 0, time.UTC), SeverityCritical, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.now = tt.at
+			event := testEvent()
+			event.Severity = tt.severity
+			if got := q.Suppresses(event); got != tt.suppressed {
+				t.Errorf("Suppresses = %v, want %v", got, tt.suppressed)
+			}
+		})
+	}
+}
+
+func TestQuietHoursHoldsEventsForDigest(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 15, 23, 0, 0, 0, time.UTC)}
+	q := newTestQuietHours(t, "22:00-07:00", clock)
+
+	if got, want := q.Remaining(), 8*time.Hour; got != want {
+		t.Errorf("Remaining = %v, want %v", got, want)
+	}
+	first, second := testEvent(), testEvent()
+	second.PID = "4343"
+	if !q.Add(first) {
+		t.Error("first held event did not open the digest")
+	}
+	if q.Add(second) {
+		t.Error("second held event opened another digest")
+	}
+	if events := q.Flush(); len(events) != 2 || events[0].PID != first.PID {
+		t.Errorf("Flush = %v, want both events in arrival order", events)
+	}
+	if events := q.Flush(); len(events) != 0 {
+		t.Errorf("second Flush = %v, want nothing", events)
+	}
+}
+
+func TestNewQuietHoursRejectsInvalidWindows(t *testing.T) {
+	for _, spec := range []string{"22:00", "25:00-07:00", "07:00-07:00"} {
+		if _, err := NewQuietHours(spec, SeverityCritical); err == nil {
+			t.Errorf("NewQuietHours(%q) accepted", spec)
+		}
+	}
+	if _, err := NewQuietHours("22:00-07:00", SeverityHigh); err == nil {
+		t.Error("NewQuietHours accepted severity high")
+	}
+}
@@ -0,0 +1,36 @@
+package notifier
+
+import (
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter caps the number of alerts delivered per minute with a token
+// bucket that allows the full minute's budget as a burst.
+type RateLimiter struct {
+	limiter *rate.Limiter
+	dropped atomic.Uint64
+}
+
+func NewRateLimiter(perMinute int) *RateLimiter {
+	return &RateLimiter{
+		limiter: rate.NewLimiter(rate.Every(time.Minute/time.Duration(perMinute)), perMinute),
+	}
+}
+
+// Allow reports whether an alert may be delivered now, counting the ones
+// that may not.
+func (r *RateLimiter) Allow() bool {
+	if r.limiter.Allow() {
+		return true
+	}
+	r.dropped.Add(1)
+	return false
+}
+
+// Dropped returns the number of alerts dropped so far.
+func (r *RateLimiter) Dropped() uint64 {
+	return r.dropped.Load()
+}
@@ -0,0 +1,19 @@
+package notifier
+
+import "testing"
+
+func TestRateLimiterAllowsOneMinuteBurst(t *testing.T) {
+	r := NewRateLimiter(5)
+	forwarded := 0
+	for i := 0; i < 20; i++ {
+		if r.Allow() {
+			forwarded++
+		}
+	}
+	if forwarded != 5 {
+		t.Errorf("%d of a burst of 20 forwarded, want 5", forwarded)
+	}
+	if dropped := r.Dropped(); dropped != 15 {
+		t.Errorf("Dropped() = %d, want 15", dropped)
+	}
+}
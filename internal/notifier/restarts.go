@@ -0,0 +1,32 @@
+package notifier
+
+import "fmt"
+
+// CrashLoopRestarts is the restart count from which the container of an OOM
+// kill is considered crash looping: its events are escalated to
+// SeverityHigh and their restart count is rendered up front.
+const CrashLoopRestarts = 3
+
+// CrashLooping reports whether the container of event restarted at least
+// CrashLoopRestarts times.
+func CrashLooping(event OOMEvent) bool {
+	return event.RestartCount >= CrashLoopRestarts
+}
+
+// EscalateCrashLoop raises the severity of the OOM kills of crash looping
+// containers to SeverityHigh, the restart count standing for the repeats
+// the kubelet already saw.
+func EscalateCrashLoop(event OOMEvent) OOMEvent {
+	if CrashLooping(event) && event.Severity != SeverityRecovered {
+		event.Severity = SeverityHigh
+	}
+	return event
+}
+
+// restartText describes the restart count of event.
+func restartText(event OOMEvent) string {
+	if CrashLooping(event) {
+		return fmt.Sprintf("%d (crash loop)", event.RestartCount)
+	}
+	return fmt.Sprintf("%d", event.RestartCount)
+}
@@ -0,0 +1,64 @@
+package notifier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscalateCrashLoop(t *testing.T) {
+	for _, tt := range []struct {
+		restarts int
+		severity string
+		want     string
+	}{
+		{0, SeverityWarning, SeverityWarning},
+		{CrashLoopRestarts - 1, SeverityWarning, SeverityWarning},
+		{CrashLoopRestarts, SeverityWarning, SeverityHigh},
+		{20, SeverityCritical, SeverityHigh},
+		{20, SeverityRecovered, SeverityRecovered},
+	} {
+		event := testEvent()
+		event.RestartCount, event.Severity = tt.restarts, tt.severity
+		if got := EscalateCrashLoop(event).Severity; got != tt.want {
+			t.Errorf("%d restarts, %s: severity %s, want %s", tt.restarts, tt.severity, got, tt.want)
+		}
+	}
+}
+
+// fieldIndex returns the position of the field titled title, or -1.
+func fieldIndex(fields []Field, title string) int {
+	for i, field := range fields {
+		if field.Title == title {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRestartCountRendering(t *testing.T) {
+	event := testEvent()
+	event.Severity = SeverityWarning
+	if i := fieldIndex(eventFields(event), "Restarts"); i != -1 {
+		t.Error("restarts rendered for an event without any")
+	}
+
+	event.RestartCount = 1
+	fields := eventFields(event)
+	if i := fieldIndex(fields, "Restarts"); i == -1 || fields[i].Value != "1" {
+		t.Errorf("fields = %+v, want Restarts 1", fields)
+	}
+	if strings.Contains(eventSubject(event), "crash") {
+		t.Errorf("subject %q mentions a crash loop after one restart", eventSubject(event))
+	}
+
+	// Crash loops lead, right after the severity
+	event.RestartCount = 9
+	fields = eventFields(event)
+	i := fieldIndex(fields, "Restarts")
+	if i != fieldIndex(fields, "Severity")+1 || fields[i].Value != "9 (crash loop)" {
+		t.Errorf("fields = %+v, want Restarts 9 (crash loop) after Severity", fields)
+	}
+	if !strings.Contains(eventSubject(event), "crash looping after 9 restarts") {
+		t.Errorf("subject %q does not mention the crash loop", eventSubject(event))
+	}
+}
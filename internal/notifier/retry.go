@@ -0,0 +1,85 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// retryableError marks a delivery failure that is worth retrying, such as a
+// network error or a 5xx response.
+type retryableError struct {
+	error
+}
+
+func retryable(err error) error {
+	return retryableError{err}
+}
+
+// Retrier re-runs failed deliveries with exponential backoff and jitter. A
+// nil Retrier makes a single attempt.
+type Retrier struct {
+	ctx      context.Context
+	attempts int
+	backoff  time.Duration
+}
+
+// NewRetrier creates a retrier making up to attempts tries, waiting backoff
+// before the second one and doubling the wait after each failure. Waiting
+// stops early once ctx is cancelled.
+func NewRetrier(ctx context.Context, attempts int, backoff time.Duration) *Retrier {
+	return &Retrier{ctx: ctx, attempts: attempts, backoff: backoff}
+}
+
+// Do calls send until it succeeds, returns a non-retryable error or the
+// attempts are used up, and returns the last error. Waiting between attempts
+// also stops once ctx, that of the delivery, is cancelled.
+func (r *Retrier) Do(ctx context.Context, send func() error) error {
+	if r == nil {
+		return send()
+	}
+
+	delay := r.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = send()
+		var retry retryableError
+		if err == nil || !errors.As(err, &retry) || attempt >= r.attempts {
+			return err
+		}
+
+		// Sleep between half and the full delay so notifiers on many hosts
+		// don't retry in lockstep
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		logger.Debug("Attempt %d failed, retrying in %v: %v", attempt, wait, err)
+
+		if !r.wait(ctx, wait) {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// wait sleeps for d and reports false if ctx or the retrier was cancelled
+// first.
+func (r *Retrier) wait(ctx context.Context, d time.Duration) bool {
+	var stopped <-chan struct{}
+	if r != nil {
+		stopped = r.ctx.Done()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-stopped:
+		return false
+	}
+}
@@ -0,0 +1,149 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer returns a server answering the first failures requests with
+// status and every later one with 200, and its request counter.
+func newFlakyServer(t *testing.T, failures int, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(requests.Add(1)) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newRetryingSlack(url string, retrier *Retrier) *SlackNotifier {
+	return NewSlackNotifier([]string{url}, "alerts", nil, "", SlackFormatAttachment, retrier, NewHTTPClient(5*time.Second, nil))
+}
+
+func TestSlackRetriesServerErrors(t *testing.T) {
+	server, requests := newFlakyServer(t, 2, http.StatusServiceUnavailable)
+	slack := newRetryingSlack(server.URL, NewRetrier(context.Background(), 3, time.Millisecond))
+
+	if err := slack.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+}
+
+func TestSlackGivesUpAfterAttempts(t *testing.T) {
+	server, requests := newFlakyServer(t, 5, http.StatusBadGateway)
+	slack := newRetryingSlack(server.URL, NewRetrier(context.Background(), 3, time.Millisecond))
+
+	if err := slack.Notify(testEvent()); err == nil {
+		t.Fatal("Notify succeeded although every attempt failed")
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+}
+
+func TestSlackDoesNotRetryClientErrors(t *testing.T) {
+	server, requests := newFlakyServer(t, 1, http.StatusBadRequest)
+	slack := newRetryingSlack(server.URL, NewRetrier(context.Background(), 3, time.Millisecond))
+
+	if err := slack.Notify(testEvent()); err == nil {
+		t.Fatal("Notify succeeded with 400 Bad Request")
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+}
+
+func TestRetrierRetriesOnlyRetryableErrors(t *testing.T) {
+	r := NewRetrier(context.Background(), 4, time.Millisecond)
+	attempts := 0
+	err := r.Do(context.Background(), func() error {
+		attempts++
+		return errors.New("bad request")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Do = %v after %d attempts, want the error after 1", err, attempts)
+	}
+
+	attempts = 0
+	err = r.Do(context.Background(), func() error {
+		attempts++
+		if attempts < 3 {
+			return retryable(errors.New("connection refused"))
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Errorf("Do = %v after %d attempts, want success after 3", err, attempts)
+	}
+}
+
+func TestRetrierStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewRetrier(ctx, 5, time.Hour)
+	attempts := 0
+	done := make(chan error)
+	go func() {
+		done <- r.Do(context.Background(), func() error {
+			attempts++
+			return retryable(errors.New("connection refused"))
+		})
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil || attempts != 1 {
+			t.Errorf("Do = %v after %d attempts, want the error after 1", err, attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled retrier kept waiting")
+	}
+}
+
+func TestRetrierStopsWhenDeliveryCancelled(t *testing.T) {
+	r := NewRetrier(context.Background(), 5, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	done := make(chan error)
+	go func() {
+		done <- r.Do(ctx, func() error {
+			attempts++
+			return retryable(errors.New("connection refused"))
+		})
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil || attempts != 1 {
+			t.Errorf("Do = %v after %d attempts, want the error after 1", err, attempts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("retrier kept waiting after the delivery was cancelled")
+	}
+}
+
+func TestNilRetrierMakesOneAttempt(t *testing.T) {
+	var r *Retrier
+	attempts := 0
+	r.Do(context.Background(), func() error {
+		attempts++
+		return retryable(errors.New("connection refused"))
+	})
+	if attempts != 1 {
+		t.Errorf("%d attempts, want 1", attempts)
+	}
+}
@@ -0,0 +1,63 @@
+package notifier
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ChannelRoute sends events whose command line or hostname matches Pattern to
+// Channel.
+type ChannelRoute struct {
+	Pattern *regexp.Regexp
+	Channel string
+}
+
+// ParseChannelRoute parses a route of the form pattern=channel. The pattern is
+// split off at the last "=", so it may itself contain one. The channel is
+// normalized with NormalizeSlackChannel.
+func ParseChannelRoute(spec string) (ChannelRoute, error) {
+	i := strings.LastIndex(spec, "=")
+	if i < 0 {
+		return ChannelRoute{}, fmt.Errorf("route %q is not of the form pattern=channel", spec)
+	}
+	expr, channel := spec[:i], strings.TrimSpace(spec[i+1:])
+	if expr == "" || channel == "" {
+		return ChannelRoute{}, fmt.Errorf("route %q is not of the form pattern=channel", spec)
+	}
+
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return ChannelRoute{}, fmt.Errorf("route %q has an invalid pattern: %v", spec, err)
+	}
+	if channel, err = NormalizeSlackChannel(channel); err != nil {
+		return ChannelRoute{}, fmt.Errorf("route %q: %v", spec, err)
+	}
+	return ChannelRoute{Pattern: pattern, Channel: channel}, nil
+}
+
+// ParseChannelRoutes parses every route in specs, keeping their order.
+func ParseChannelRoutes(specs []string) ([]ChannelRoute, error) {
+	routes := make([]ChannelRoute, 0, len(specs))
+	for _, spec := range specs {
+		route, err := ParseChannelRoute(spec)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// routeChannel returns the channel of the first route matching any of
+// values, or fallback when none does.
+func routeChannel(routes []ChannelRoute, fallback string, values ...string) string {
+	for _, route := range routes {
+		for _, value := range values {
+			if value != "" && route.Pattern.MatchString(value) {
+				return route.Channel
+			}
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,103 @@
+package notifier
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseChannelRoute(t *testing.T) {
+	route, err := ParseChannelRoute("^java .*-Denv=prod= payments ")
+	if err != nil {
+		t.Fatalf("ParseChannelRoute: %v", err)
+	}
+	// Split at the last "=", the pattern keeps the others
+	if route.Pattern.String() != "^java .*-Denv=prod" || route.Channel != "#payments" {
+		t.Errorf("route = %q -> %q, want ^java .*-Denv=prod -> #payments", route.Pattern, route.Channel)
+	}
+
+	for _, spec := range []string{"no-channel", "=payments", "postgres=", "([=db", "^java=db team", "^java=#db#team"} {
+		if _, err := ParseChannelRoute(spec); err == nil {
+			t.Errorf("ParseChannelRoute(%q) succeeded", spec)
+		}
+	}
+	if _, err := ParseChannelRoutes([]string{"^nginx=web", "([=db"}); err == nil {
+		t.Error("ParseChannelRoutes accepted an invalid route")
+	}
+}
+
+func TestRouteChannel(t *testing.T) {
+	routes, err := ParseChannelRoutes([]string{
+		"^postgres=db",
+		"^java=jvm",
+		// Matches the first two too, but comes after them
+		"^(postgres|java)=catch-all",
+		"^db-[0-9]+$=db-hosts",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name              string
+		cmdline, hostname string
+		want              string
+	}{
+		{"first route", "postgres: checkpointer", "node-1", "#db"},
+		{"second route", "java -jar app.jar", "node-1", "#jvm"},
+		{"first match wins", "postgres", "db-1", "#db"},
+		{"hostname", "stress --vm 1", "db-1", "#db-hosts"},
+		{"default", "stress --vm 1", "node-1", "#alerts"},
+		{"empty values", "", "", "#alerts"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := routeChannel(routes, "#alerts", tt.cmdline, tt.hostname); got != tt.want {
+				t.Errorf("routeChannel(%q, %q) = %q, want %q", tt.cmdline, tt.hostname, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseChannelRouteNormalizesChannel(t *testing.T) {
+	for spec, want := range map[string]string{
+		"^java=jvm":        "#jvm",
+		"^java=#jvm":       "#jvm",
+		"^java=@oncall":    "@oncall",
+		"^java=C024BE91L":  "C024BE91L",
+		"^java= jvm-team ": "#jvm-team",
+	} {
+		route, err := ParseChannelRoute(spec)
+		if err != nil || route.Channel != want {
+			t.Errorf("ParseChannelRoute(%q) = %q, %v, want %q", spec, route.Channel, err, want)
+		}
+	}
+}
+
+func TestSlackRoutesChannelPerEvent(t *testing.T) {
+	routes, err := ParseChannelRoutes([]string{"^java=#jvm", "^stress=load-tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := NewSlackNotifier([]string{webhook.URL}, "#alerts", routes, SlackModeAll, SlackFormatAttachment, nil, NewHTTPClient(5*time.Second, nil))
+
+	routed := testEvent()
+	if err := s.Notify(routed); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	if payload.Channel != "#load-tests" {
+		t.Errorf("routed event sent to %q, want #load-tests", payload.Channel)
+	}
+
+	unrouted := testEvent()
+	unrouted.Cmdline = "nginx: worker process"
+	if err := s.Notify(unrouted); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	webhook.last(t, &payload)
+	if payload.Channel != "#alerts" {
+		t.Errorf("unrouted event sent to %q, want the default #alerts", payload.Channel)
+	}
+}
@@ -0,0 +1,79 @@
+package notifier
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// samplerKeys bounds the number of distinct processes tracked by a Sampler.
+const samplerKeys = 1024
+
+// samplerEpsilon absorbs the rounding of accumulated credit, ten repeats at
+// a rate of 0.1 adding up to slightly less than 1.
+const samplerEpsilon = 1e-9
+
+// Sampler delivers a fraction of OOM events without losing diversity: the
+// first kill of every distinct process is always delivered, and repeats of
+// the same process earn credit of rate each and are delivered whenever a
+// whole kill's worth of credit has accumulated, so that a rate of 0.3
+// delivers 3 of every 10 repeats rather than 1 of every 3. Delivered events
+// carry the number of kills they stand for.
+type Sampler struct {
+	rate      float64
+	seen      *lru.Cache[string, samplerKey]
+	total     atomic.Uint64
+	delivered atomic.Uint64
+}
+
+func NewSampler(rate float64) (*Sampler, error) {
+	if rate <= 0 || rate > 1 {
+		return nil, fmt.Errorf("sample rate must be in (0, 1], got %v", rate)
+	}
+
+	seen, err := lru.New[string, samplerKey](samplerKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sampler cache: %v", err)
+	}
+
+	return &Sampler{
+		rate: rate,
+		seen: seen,
+	}, nil
+}
+
+// samplerKey is the sampling state of one distinct process.
+type samplerKey struct {
+	// skipped counts the repeats sampled out since the last delivery
+	skipped int
+	credit  float64
+}
+
+// Sample reports whether event should be delivered. When it should, the
+// returned event has Occurrences set to the kills it represents.
+func (s *Sampler) Sample(event OOMEvent) (OOMEvent, bool) {
+	s.total.Add(1)
+
+	key, found := s.seen.Get(event.Cmdline)
+	if found {
+		key.credit += s.rate
+		if key.credit < 1-samplerEpsilon {
+			key.skipped++
+			s.seen.Add(event.Cmdline, key)
+			return event, false
+		}
+		key.credit--
+	}
+
+	event.Occurrences = 1 + key.skipped
+	key.skipped = 0
+	s.seen.Add(event.Cmdline, key)
+	s.delivered.Add(1)
+	return event, true
+}
+
+// Stats returns the number of events seen and delivered.
+func (s *Sampler) Stats() (total, delivered uint64) {
+	return s.total.Load(), s.delivered.Load()
+}
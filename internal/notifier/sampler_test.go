@@ -0,0 +1,73 @@
+package notifier
+
+import "testing"
+
+func TestSamplerDeliversFractionOfRepeats(t *testing.T) {
+	for _, tt := range []struct {
+		rate float64
+		// want is the number of deliveries of 1 + 100 kills of a process
+		want int
+	}{
+		{1, 101},
+		{0.5, 51},
+		{0.3, 31},
+		{0.1, 11},
+		{0.01, 2},
+	} {
+		s, err := NewSampler(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		delivered, represented := 0, 0
+		for i := 0; i < 101; i++ {
+			if event, ok := s.Sample(testEvent()); ok {
+				delivered++
+				represented += event.Occurrences
+			}
+		}
+		if delivered != tt.want {
+			t.Errorf("rate %v: %d of 101 kills delivered, want %d", tt.rate, delivered, tt.want)
+		}
+		// Kills sampled out after the last delivery are not represented yet
+		if represented > 101 || represented < 101-int(1/tt.rate) {
+			t.Errorf("rate %v: deliveries represent %d kills of 101", tt.rate, represented)
+		}
+		if total, n := s.Stats(); total != 101 || n != uint64(delivered) {
+			t.Errorf("rate %v: Stats() = %d, %d, want 101, %d", tt.rate, total, n, delivered)
+		}
+	}
+}
+
+func TestSamplerAlwaysDeliversDistinctProcesses(t *testing.T) {
+	s, err := NewSampler(0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cmdline := range []string{"java", "stress", "postgres"} {
+		event := testEvent()
+		event.Cmdline = cmdline
+		if _, ok := s.Sample(event); !ok {
+			t.Errorf("first kill of %s sampled out", cmdline)
+		}
+	}
+
+	repeat := testEvent()
+	repeat.Cmdline = "java"
+	for i := 1; i < 10; i++ {
+		if _, ok := s.Sample(repeat); ok {
+			t.Fatalf("repeat %d of java delivered at rate 0.1", i)
+		}
+	}
+	event, ok := s.Sample(repeat)
+	if !ok || event.Occurrences != 10 {
+		t.Errorf("tenth repeat = %v, Occurrences %d, want delivered for 10 kills", ok, event.Occurrences)
+	}
+}
+
+func TestNewSamplerRejectsInvalidRates(t *testing.T) {
+	for _, rate := range []float64{0, -0.5, 1.5} {
+		if _, err := NewSampler(rate); err == nil {
+			t.Errorf("NewSampler(%v) accepted", rate)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package notifier
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Severities of events before escalation, see EventSeverity.
+const (
+	// SeverityWarning marks events that are often expected, such as kills
+	// of a cgroup reaching its own limit.
+	SeverityWarning = "warning"
+	// SeverityCritical marks global OOM kills, where the whole host ran
+	// out of memory.
+	SeverityCritical = "critical"
+	// SeverityPressure marks memory pressure warnings, raised before the
+	// OOM killer fires.
+	SeverityPressure = "pressure"
+)
+
+// SeverityStyle is how the chat notifiers render events of a severity.
+type SeverityStyle struct {
+	// Color is a Slack attachment color: good, warning, danger or a hex
+	// color such as #439FE0.
+	Color string
+	// Emoji replaces the emoji leading the message title.
+	Emoji string
+}
+
+// defaultStyle renders events of a severity without a style.
+var defaultStyle = SeverityStyle{Color: "danger"}
+
+// DefaultSeverityStyles are the styles used unless overridden.
+var DefaultSeverityStyles = map[string]SeverityStyle{
+	SeverityWarning:   {Color: "warning", Emoji: "⚠️"},
+	SeverityCritical:  {Color: "danger", Emoji: "🚨"},
+	SeverityHigh:      {Color: "danger", Emoji: "🔥"},
+	SeverityPressure:  {Color: "#439FE0", Emoji: "📈"},
+	SeverityRecovered: {Color: "good", Emoji: "✅"},
+}
+
+// severityStyles are the styles in use, set by SetSeverityStyles.
+var severityStyles = DefaultSeverityStyles
+
+var hexColor = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// teamsColors are the Slack named colors as hex, for MessageCards.
+var teamsColors = map[string]string{
+	"good":    "2EB67D",
+	"warning": "ECB22E",
+	"danger":  "E01E5A",
+}
+
+// EventSeverity returns the severity of an event of kind and OOM type
+// before any escalation: global OOM kills are critical, memory pressure has
+// its own severity, cgroup OOM kills and the other kernel events are
+// warnings, unless the severity map rates their class otherwise.
+func EventSeverity(kind, oomType string) string {
+	class := kindClass(kind, oomType)
+	if severity := severityMap[class].Severity; severity != "" {
+		return severity
+	}
+	switch class {
+	case ClassPressure:
+		return SeverityPressure
+	case ClassGlobal:
+		return SeverityCritical
+	}
+	return SeverityWarning
+}
+
+// ParseSeverityStyles returns DefaultSeverityStyles overridden by colors
+// and emojis, each given as severity=value.
+func ParseSeverityStyles(colors, emojis []string) (map[string]SeverityStyle, error) {
+	styles := make(map[string]SeverityStyle, len(DefaultSeverityStyles))
+	for severity, style := range DefaultSeverityStyles {
+		styles[severity] = style
+	}
+
+	for _, spec := range colors {
+		severity, color, err := parseSeverityValue(spec)
+		if err != nil {
+			return nil, err
+		}
+		if !validColor(color) {
+			return nil, fmt.Errorf("invalid color %q for severity %s, use good, warning, danger or #RRGGBB", color, severity)
+		}
+		style := styles[severity]
+		style.Color = color
+		styles[severity] = style
+	}
+	for _, spec := range emojis {
+		severity, emoji, err := parseSeverityValue(spec)
+		if err != nil {
+			return nil, err
+		}
+		style := styles[severity]
+		style.Emoji = emoji
+		styles[severity] = style
+	}
+	return styles, nil
+}
+
+// parseSeverityValue splits a severity=value pair.
+func parseSeverityValue(spec string) (string, string, error) {
+	severity, value, found := strings.Cut(spec, "=")
+	severity = strings.TrimSpace(severity)
+	value = strings.TrimSpace(value)
+	if !found || value == "" {
+		return "", "", fmt.Errorf("invalid severity style %q, expected severity=value", spec)
+	}
+	switch severity {
+	case SeverityWarning, SeverityCritical, SeverityHigh, SeverityPressure, SeverityRecovered:
+	default:
+		return "", "", fmt.Errorf("unknown severity %q, expected %s, %s, %s, %s or %s", severity, SeverityWarning, SeverityCritical, SeverityHigh, SeverityPressure, SeverityRecovered)
+	}
+	return severity, value, nil
+}
+
+// validColor reports whether color is a Slack named color or a hex color.
+func validColor(color string) bool {
+	_, named := teamsColors[color]
+	return named || hexColor.MatchString(color)
+}
+
+// SetSeverityStyles sets the styles of the chat notifiers, see
+// ParseSeverityStyles. It must be called before events are sent.
+func SetSeverityStyles(styles map[string]SeverityStyle) {
+	severityStyles = styles
+}
+
+// severityStyle returns the style of severity.
+func severityStyle(severity string) SeverityStyle {
+	if style, found := severityStyles[severity]; found {
+		return style
+	}
+	return defaultStyle
+}
+
+// styledTitle replaces the emoji leading title with the one of the style of
+// event, see eventStyle, leaving title as is when the style has none.
+func styledTitle(title string, event OOMEvent) string {
+	emoji := eventStyle(event).Emoji
+	if emoji == "" {
+		return title
+	}
+	if _, rest, found := strings.Cut(title, " "); found {
+		title = rest
+	}
+	return emoji + " " + title
+}
+
+// teamsColor returns a Slack color as a MessageCard theme color.
+func teamsColor(color string) string {
+	if hex, named := teamsColors[color]; named {
+		return hex
+	}
+	return strings.TrimPrefix(color, "#")
+}
@@ -0,0 +1,145 @@
+package notifier
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// useSeverityStyles sets the severity styles for the duration of the test.
+func useSeverityStyles(t *testing.T, styles map[string]SeverityStyle) {
+	t.Helper()
+	SetSeverityStyles(styles)
+	t.Cleanup(func() { SetSeverityStyles(DefaultSeverityStyles) })
+}
+
+func TestEventSeverity(t *testing.T) {
+	for _, tt := range []struct {
+		kind, oomType, want string
+	}{
+		{"oom", "global", SeverityCritical},
+		{"oom", "", SeverityCritical},
+		{"oom", "memcg", SeverityWarning},
+		{"memory_pressure", "", SeverityPressure},
+		{"segfault", "", SeverityWarning},
+	} {
+		if got := EventSeverity(tt.kind, tt.oomType); got != tt.want {
+			t.Errorf("EventSeverity(%q, %q) = %q, want %q", tt.kind, tt.oomType, got, tt.want)
+		}
+	}
+}
+
+func TestParseSeverityStyles(t *testing.T) {
+	styles, err := ParseSeverityStyles([]string{"warning=#439FE0", " critical = good "}, []string{"critical=🔥"})
+	if err != nil {
+		t.Fatalf("ParseSeverityStyles: %v", err)
+	}
+	if got := styles[SeverityWarning]; got.Color != "#439FE0" || got.Emoji != DefaultSeverityStyles[SeverityWarning].Emoji {
+		t.Errorf("warning style %+v, want the color overridden and the default emoji", got)
+	}
+	if got := styles[SeverityCritical]; got != (SeverityStyle{Color: "good", Emoji: "🔥"}) {
+		t.Errorf("critical style %+v, want both overridden", got)
+	}
+	if DefaultSeverityStyles[SeverityCritical].Color != "danger" {
+		t.Error("ParseSeverityStyles changed the defaults")
+	}
+
+	for _, tt := range []struct {
+		colors, emojis []string
+		want           string
+	}{
+		{colors: []string{"warning=purple"}, want: "invalid color"},
+		{colors: []string{"warning=#43F"}, want: "invalid color"},
+		{colors: []string{"fatal=danger"}, want: "unknown severity"},
+		{emojis: []string{"critical"}, want: "expected severity=value"},
+		{emojis: []string{"critical="}, want: "expected severity=value"},
+	} {
+		if _, err := ParseSeverityStyles(tt.colors, tt.emojis); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseSeverityStyles(%q, %q) = %v, want an error containing %q", tt.colors, tt.emojis, err, tt.want)
+		}
+	}
+}
+
+func TestSlackColorsBySeverity(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+
+	for severity, want := range map[string]SeverityStyle{
+		SeverityWarning:  {Color: "warning", Emoji: "⚠️"},
+		SeverityCritical: {Color: "danger", Emoji: "🚨"},
+		SeverityHigh:     {Color: "danger", Emoji: "🔥"},
+		"":               {Color: "danger", Emoji: "🚨"},
+	} {
+		event := testEvent()
+		event.Severity = severity
+		if err := s.Notify(event); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+		var payload SlackPayload
+		webhook.last(t, &payload)
+		attachment := payload.Attachments[0]
+		if attachment.Color != want.Color || !strings.HasPrefix(attachment.Title, want.Emoji+" ") {
+			t.Errorf("%q event colored %q titled %q, want %q and %s", severity, attachment.Color, attachment.Title, want.Color, want.Emoji)
+		}
+	}
+}
+
+func TestSlackPressureWarning(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	event := testEvent()
+	event.Kind = "memory_pressure"
+	event.Severity = SeverityPressure
+	if err := newTestSlack(SlackModeAll, webhook).Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	attachment := payload.Attachments[0]
+	if attachment.Color != "#439FE0" || attachment.Title != "📈 Memory Pressure Warning" {
+		t.Errorf("pressure warning colored %q titled %q, want the pressure style", attachment.Color, attachment.Title)
+	}
+	if got := eventSubject(event); got != "Memory pressure on node-1" {
+		t.Errorf("subject = %q, want a pressure warning, not a kill", got)
+	}
+}
+
+func TestSeverityStylesOverrideColors(t *testing.T) {
+	styles, err := ParseSeverityStyles([]string{"warning=#439FE0"}, []string{"warning=:zzz:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	useSeverityStyles(t, styles)
+	event := testEvent()
+	event.Severity = SeverityWarning
+
+	webhook := newTestWebhook(t, http.StatusOK)
+	if err := newTestSlack(SlackModeAll, webhook).Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	if got := payload.Attachments[0]; got.Color != "#439FE0" || !strings.HasPrefix(got.Title, ":zzz: ") {
+		t.Errorf("Slack attachment colored %q titled %q, want the overrides", got.Color, got.Title)
+	}
+
+	teams, cards := newTestTeams(t, "1")
+	if err := teams.Notify(event); err != nil {
+		t.Fatal(err)
+	}
+	if got := (*cards)[0]; got.ThemeColor != "439FE0" || !strings.HasPrefix(got.Title, ":zzz: ") {
+		t.Errorf("Teams card colored %q titled %q, want the overrides", got.ThemeColor, got.Title)
+	}
+}
+
+func TestTeamsColor(t *testing.T) {
+	for color, want := range map[string]string{
+		"good":    "2EB67D",
+		"warning": "ECB22E",
+		"danger":  "E01E5A",
+		"#439FE0": "439FE0",
+	} {
+		if got := teamsColor(color); got != want {
+			t.Errorf("teamsColor(%q) = %q, want %q", color, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package notifier
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Event classes keyed in a severity map, see EventClass.
+const (
+	// ClassGlobal and ClassMemcg are OOM kills by OOM type.
+	ClassGlobal = "global"
+	ClassMemcg  = "memcg"
+	// ClassPressure is memory pressure warnings.
+	ClassPressure = "pressure"
+	// ClassOther is the other kernel events, such as segfaults.
+	ClassOther = "other"
+	// ClassFlapping and ClassRecovered are the events escalated by the flap
+	// detector and its recoveries.
+	ClassFlapping  = "flapping"
+	ClassRecovered = "recovered"
+)
+
+// SeverityMapEntry overrides how the events of a class are rated and
+// rendered, empty fields keeping the defaults. Severity replaces the one of
+// EventSeverity, Color and Emoji the severity style and Channel the Slack
+// channel the events are posted to.
+type SeverityMapEntry struct {
+	Severity string `yaml:"severity"`
+	Color    string `yaml:"color"`
+	Emoji    string `yaml:"emoji"`
+	Channel  string `yaml:"channel"`
+}
+
+// SeverityMap maps event classes to their overrides.
+type SeverityMap map[string]SeverityMapEntry
+
+// severityMap is the map in use, set by SetSeverityMap.
+var severityMap SeverityMap
+
+// LoadSeverityMap reads a severity map from path, a YAML or JSON object
+// keyed by event class, and validates every entry. Channels are normalized
+// as by NormalizeSlackChannel.
+func LoadSeverityMap(path string) (SeverityMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read severity map: %v", err)
+	}
+
+	var m SeverityMap
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse severity map: %v", err)
+	}
+
+	for class, entry := range m {
+		switch class {
+		case ClassGlobal, ClassMemcg, ClassPressure, ClassOther:
+			switch entry.Severity {
+			case "", SeverityWarning, SeverityCritical, SeverityPressure:
+			default:
+				return nil, fmt.Errorf("invalid severity %q for %s, expected %s, %s or %s", entry.Severity, class, SeverityWarning, SeverityCritical, SeverityPressure)
+			}
+		case ClassFlapping, ClassRecovered:
+			if entry.Severity != "" {
+				return nil, fmt.Errorf("%s events cannot be given a severity, it is set by the flap detector", class)
+			}
+		default:
+			return nil, fmt.Errorf("unknown event class %q, expected %s, %s, %s, %s, %s or %s", class, ClassGlobal, ClassMemcg, ClassPressure, ClassOther, ClassFlapping, ClassRecovered)
+		}
+		if entry.Color != "" && !validColor(entry.Color) {
+			return nil, fmt.Errorf("invalid color %q for %s, use good, warning, danger or #RRGGBB", entry.Color, class)
+		}
+		if entry.Channel != "" {
+			if entry.Channel, err = NormalizeSlackChannel(entry.Channel); err != nil {
+				return nil, fmt.Errorf("invalid channel for %s: %v", class, err)
+			}
+		}
+		m[class] = entry
+	}
+	return m, nil
+}
+
+// SetSeverityMap sets the map consulted by EventSeverity and the Slack and
+// Teams notifiers, nil for none. It must be called before events are sent.
+func SetSeverityMap(m SeverityMap) {
+	severityMap = m
+}
+
+// EventClass returns the class of event in a severity map: its flap state
+// once escalated, otherwise its kind and OOM type, see kindClass.
+func EventClass(event OOMEvent) string {
+	switch event.Severity {
+	case SeverityHigh:
+		return ClassFlapping
+	case SeverityRecovered:
+		return ClassRecovered
+	}
+	return kindClass(event.Kind, event.OOMType)
+}
+
+// kindClass returns the class of the events of kind and OOM type before any
+// escalation.
+func kindClass(kind, oomType string) string {
+	switch {
+	case kind == "memory_pressure":
+		return ClassPressure
+	case kind != "" && kind != "oom":
+		return ClassOther
+	case oomType == "memcg":
+		return ClassMemcg
+	}
+	return ClassGlobal
+}
+
+// eventStyle returns the style of event, the style of its severity with
+// the color and emoji of its class in the severity map.
+func eventStyle(event OOMEvent) SeverityStyle {
+	style := severityStyle(event.Severity)
+	entry := severityMap[EventClass(event)]
+	if entry.Color != "" {
+		style.Color = entry.Color
+	}
+	if entry.Emoji != "" {
+		style.Emoji = entry.Emoji
+	}
+	return style
+}
+
+// mappedChannel returns the Slack channel of the class of event in the
+// severity map, empty when it has none.
+func mappedChannel(event OOMEvent) string {
+	return severityMap[EventClass(event)].Channel
+}
@@ -0,0 +1,165 @@
+package notifier
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useSeverityMap loads the severity map testdata/severitymap/name and sets
+// it for the duration of the test.
+func useSeverityMap(t *testing.T, name string) SeverityMap {
+	t.Helper()
+	m, err := LoadSeverityMap(filepath.Join("testdata", "severitymap", name))
+	if err != nil {
+		t.Fatalf("LoadSeverityMap(%s): %v", name, err)
+	}
+	SetSeverityMap(m)
+	t.Cleanup(func() { SetSeverityMap(nil) })
+	return m
+}
+
+func TestLoadSeverityMap(t *testing.T) {
+	m := useSeverityMap(t, "valid.yaml")
+
+	want := SeverityMap{
+		ClassMemcg:    {Severity: SeverityWarning, Color: "#AAAAAA", Emoji: ":zzz:"},
+		ClassGlobal:   {Color: "danger", Channel: "#oncall"},
+		ClassFlapping: {Emoji: ":fire:", Channel: "#oom-flapping"},
+	}
+	if len(m) != len(want) {
+		t.Fatalf("loaded %d classes, want %d: %+v", len(m), len(want), m)
+	}
+	for class, entry := range want {
+		if m[class] != entry {
+			t.Errorf("%s: got %+v, want %+v", class, m[class], entry)
+		}
+	}
+}
+
+func TestLoadSeverityMapJSON(t *testing.T) {
+	useSeverityMap(t, "valid.json")
+
+	if got := EventSeverity("memory_pressure", ""); got != SeverityCritical {
+		t.Errorf("pressure severity %q, want %q from the map", got, SeverityCritical)
+	}
+	if got := EventSeverity("oom", "memcg"); got != SeverityWarning {
+		t.Errorf("memcg severity %q, want the default %q", got, SeverityWarning)
+	}
+}
+
+func TestLoadSeverityMapEmpty(t *testing.T) {
+	if m := useSeverityMap(t, "empty.yaml"); m != nil {
+		t.Errorf("empty file loaded %+v, want no map", m)
+	}
+	event := testEvent()
+	if got := eventStyle(event); got != DefaultSeverityStyles[SeverityCritical] {
+		t.Errorf("style %+v, want the default %+v", got, DefaultSeverityStyles[SeverityCritical])
+	}
+}
+
+func TestLoadSeverityMapInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		want string
+	}{
+		{"unknown_class.yaml", `unknown event class "segfault"`},
+		{"invalid_severity.yaml", `invalid severity "urgent" for memcg`},
+		{"invalid_color.yaml", `invalid color "purple" for global`},
+		{"invalid_channel.yaml", "invalid channel for global"},
+		{"flapping_severity.yaml", "flapping events cannot be given a severity"},
+		{"unknown_field.yaml", "failed to parse severity map"},
+		{"malformed.yaml", "failed to parse severity map"},
+		{"missing.yaml", "failed to read severity map"},
+	} {
+		_, err := LoadSeverityMap(filepath.Join("testdata", "severitymap", tc.file))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want %q", tc.file, err, tc.want)
+		}
+	}
+}
+
+func TestEventClass(t *testing.T) {
+	for _, tc := range []struct {
+		event OOMEvent
+		want  string
+	}{
+		{OOMEvent{Kind: "oom", OOMType: "global"}, ClassGlobal},
+		{OOMEvent{Kind: "oom"}, ClassGlobal},
+		{OOMEvent{Kind: "oom", OOMType: "memcg"}, ClassMemcg},
+		{OOMEvent{Kind: "memory_pressure"}, ClassPressure},
+		{OOMEvent{Kind: "segfault"}, ClassOther},
+		{OOMEvent{Kind: "oom", OOMType: "memcg", Severity: SeverityHigh}, ClassFlapping},
+		{OOMEvent{Kind: "oom", Severity: SeverityRecovered}, ClassRecovered},
+	} {
+		if got := EventClass(tc.event); got != tc.want {
+			t.Errorf("EventClass(%+v) = %q, want %q", tc.event, got, tc.want)
+		}
+	}
+}
+
+func TestSeverityMapStylesAndMissingClasses(t *testing.T) {
+	useSeverityMap(t, "valid.yaml")
+
+	memcg := testEvent()
+	memcg.Severity = EventSeverity(memcg.Kind, memcg.OOMType)
+	if got := eventStyle(memcg); got.Color != "#AAAAAA" || got.Emoji != ":zzz:" {
+		t.Errorf("memcg style %+v, want the mapped color and emoji", got)
+	}
+
+	// Classes and fields left out of the map keep the severity styles
+	global := OOMEvent{Kind: "oom", OOMType: "global", Severity: SeverityCritical}
+	if got := eventStyle(global); got.Color != "danger" || got.Emoji != DefaultSeverityStyles[SeverityCritical].Emoji {
+		t.Errorf("global style %+v, want the mapped color and default emoji", got)
+	}
+	pressure := OOMEvent{Kind: "memory_pressure", Severity: EventSeverity("memory_pressure", "")}
+	if pressure.Severity != SeverityPressure || eventStyle(pressure) != DefaultSeverityStyles[SeverityPressure] {
+		t.Errorf("pressure %q styled %+v, want the defaults", pressure.Severity, eventStyle(pressure))
+	}
+	if got := mappedChannel(pressure); got != "" {
+		t.Errorf("pressure channel %q, want none", got)
+	}
+}
+
+func TestSlackUsesSeverityMap(t *testing.T) {
+	useSeverityMap(t, "valid.yaml")
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+
+	flapping := testEvent()
+	flapping.Severity = SeverityHigh
+	if err := s.Notify(flapping); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	if payload.Channel != "#oom-flapping" {
+		t.Errorf("posted to %q, want the mapped channel", payload.Channel)
+	}
+	if title := payload.Attachments[0].Title; !strings.HasPrefix(title, ":fire:") {
+		t.Errorf("title %q, want the mapped emoji", title)
+	}
+	if color := payload.Attachments[0].Color; color != DefaultSeverityStyles[SeverityHigh].Color {
+		t.Errorf("color %q, want the default of the severity", color)
+	}
+
+	pressure := OOMEvent{Kind: "memory_pressure", Hostname: "node-1", Severity: SeverityPressure}
+	if err := s.Notify(pressure); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	webhook.last(t, &payload)
+	if payload.Channel != "#alerts" {
+		t.Errorf("posted to %q, want the default channel for an unmapped class", payload.Channel)
+	}
+}
+
+func TestTeamsUsesSeverityMap(t *testing.T) {
+	useSeverityMap(t, "valid.yaml")
+
+	memcg := testEvent()
+	memcg.Severity = SeverityWarning
+	if got := teamsColor(eventStyle(memcg).Color); got != "AAAAAA" {
+		t.Errorf("Teams theme color %q, want the mapped AAAAAA", got)
+	}
+}
@@ -0,0 +1,31 @@
+package notifier
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"4096":    4096,
+		"512B":    512,
+		"64k":     64 << 10,
+		"256MB":   256 << 20,
+		"256 mb":  256 << 20,
+		" 1.5G ":  3 << 29,
+		"2GiB":    2 << 30,
+		"1TB":     1 << 40,
+		"0":       0,
+		"0.5KiB":  512,
+		"100 MiB": 100 << 20,
+	} {
+		if got, err := ParseSize(s); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+}
+
+func TestParseSizeRejectsInvalidSizes(t *testing.T) {
+	for _, s := range []string{"", "MB", "256XB", "1.2.3G", "-5MB", "9999999999TB"} {
+		if got, err := ParseSize(s); err == nil {
+			t.Errorf("ParseSize(%q) = %d, want an error", s, got)
+		}
+	}
+}
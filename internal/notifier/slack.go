@@ -1,17 +1,105 @@
 package notifier
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
 	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// Delays used when Slack answers 429 Too Many Requests.
+const (
+	slackRetryAfterDefault = 5 * time.Second
+	slackRetryAfterMax     = 60 * time.Second
+)
+
+// slackAPI is the Web API endpoint, methods are called at <slackAPI>/<method>.
+const slackAPI = "https://slack.com/api"
+
+// Identity messages are posted under unless configured otherwise.
+const (
+	SlackDefaultUsername  = "oom-notifier"
+	SlackDefaultIconEmoji = ":firecracker:"
+)
+
+// slackChannelID matches conversation IDs, such as C024BE91L for a channel,
+// G for a private channel and D for a direct message.
+var slackChannelID = regexp.MustCompile(`^[CGD][A-Z0-9]{8,}$`)
+
+// slackNameMax is the longest channel name Slack allows.
+const slackNameMax = 80
+
+// NormalizeSlackChannel returns channel in the form Slack expects: plain
+// names get a leading #, while #names, @users and conversation IDs are kept
+// as is. It rejects empty names and names Slack cannot have, such as those
+// with spaces or commas.
+func NormalizeSlackChannel(channel string) (string, error) {
+	channel = strings.TrimSpace(channel)
+	if slackChannelID.MatchString(channel) {
+		return channel, nil
+	}
+
+	prefix, name := "#", channel
+	if strings.HasPrefix(channel, "#") || strings.HasPrefix(channel, "@") {
+		prefix, name = channel[:1], channel[1:]
+	}
+	switch {
+	case name == "":
+		return "", fmt.Errorf("invalid Slack channel %q, the name is empty", channel)
+	case len(name) > slackNameMax:
+		return "", fmt.Errorf("invalid Slack channel %q, names are at most %d characters", channel, slackNameMax)
+	case strings.ContainsAny(name, " \t\n#@,"):
+		return "", fmt.Errorf("invalid Slack channel %q, expected #name, name, @user or a channel ID", channel)
+	}
+	return prefix + name, nil
+}
+
+// Delivery modes for notifiers configured with several Slack webhooks.
+const (
+	// SlackModeAll sends every message to all webhooks. A message is
+	// delivered once one webhook took it, those that failed are logged but
+	// not retried later, to keep the others from getting it twice.
+	SlackModeAll = "all"
+	// SlackModeFailover tries the webhooks in order until one succeeds.
+	SlackModeFailover = "failover"
 )
 
 type SlackNotifier struct {
-	WebhookURL string
-	Channel    string
-	client     *http.Client
+	WebhookURLs []string
+	// Token, when set, is the bot token messages are posted with through
+	// the Web API method chat.postMessage instead of to WebhookURLs.
+	Token string
+	// Threads, when set, posts the repeats of an event as replies in the
+	// thread of the first one, see NewSlackThreads. It requires Token.
+	Threads *SlackThreads
+	// Channel receives every message not matched by one of Routes.
+	Channel string
+	Routes  []ChannelRoute
+	Mode    string
+	// Format is SlackFormatAttachment or SlackFormatBlocks.
+	Format string
+	// Username and IconEmoji override the webhook's default identity.
+	Username  string
+	IconEmoji string
+	// EscalationChannel, when set, receives the SeverityHigh events and
+	// their SeverityRecovered all-clears instead of Channel and Routes.
+	EscalationChannel string
+	// Template renders the message text of events, see
+	// ParseMessageTemplate. The attachment fields are always included.
+	Template *template.Template
+	// Link, when set, renders the URL of a page about the event, see
+	// ParseLinkTemplate. It is added as a field below the others.
+	Link    *template.Template
+	retrier *Retrier
+	client  *http.Client
+	apiURL  string
 }
 
 type SlackField struct {
@@ -23,6 +111,7 @@ type SlackField struct {
 type SlackAttachment struct {
 	Color  string       `json:"color"`
 	Title  string       `json:"title"`
+	Text   string       `json:"text,omitempty"`
 	Fields []SlackField `json:"fields"`
 }
 
@@ -32,98 +121,298 @@ type SlackPayload struct {
 	Username    string            `json:"username"`
 	IconEmoji   string            `json:"icon_emoji"`
 	Attachments []SlackAttachment `json:"attachments,omitempty"`
+	Blocks      []SlackBlock      `json:"blocks,omitempty"`
+	ThreadTS    string            `json:"thread_ts,omitempty"`
 }
 
-type OOMEvent struct {
-	Cmdline  string `json:"cmdline"`
-	PID      string `json:"pid"`
-	Hostname string `json:"hostname"`
-	Kernel   string `json:"kernel"`
-	Time     int64  `json:"time"`
+// slackMessage identifies a message posted through the Web API.
+type slackMessage struct {
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
 }
 
-func NewSlackNotifier(webhookURL, channel string) *SlackNotifier {
+// slackResponse is the envelope of a chat.postMessage response.
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	slackMessage
+}
+
+// NewSlackNotifier creates a Slack notifier. Events are posted to the channel
+// of the first route matching their command line or hostname, or to channel
+// when none does, see NormalizeSlackChannel. Messages are rendered in
+// format, SlackFormatAttachment or SlackFormatBlocks. retrier may be nil to
+// disable retries.
+func NewSlackNotifier(webhookURLs []string, channel string, routes []ChannelRoute, mode, format string, retrier *Retrier, client *http.Client) *SlackNotifier {
+	// Invalid channels are rejected by the caller, keep them as given
+	if normalized, err := NormalizeSlackChannel(channel); err == nil {
+		channel = normalized
+	}
 	return &SlackNotifier{
-		WebhookURL: webhookURL,
-		Channel:    channel,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		WebhookURLs: webhookURLs,
+		Channel:     channel,
+		Routes:      routes,
+		Mode:        mode,
+		Format:      format,
+		Username:    SlackDefaultUsername,
+		IconEmoji:   SlackDefaultIconEmoji,
+		Template:    defaultMessageTemplate,
+		retrier:     retrier,
+		client:      client,
+		apiURL:      slackAPI,
 	}
 }
 
+func (s *SlackNotifier) Name() string {
+	return "slack"
+}
+
 func (s *SlackNotifier) Notify(event OOMEvent) error {
-	// Convert timestamp to IST timezone
-	ist, err := time.LoadLocation("Asia/Kolkata")
-	if err != nil {
-		ist = time.UTC // Fallback to UTC if IST loading fails
+	return s.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (s *SlackNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	title, text := eventTitle(event)
+	if rendered, err := renderMessage(s.Template, event); err != nil {
+		logger.Warn("Falling back to the default Slack message text: %v", err)
+	} else if rendered != "" {
+		text = rendered
+	}
+
+	channel := routeChannel(s.Routes, s.Channel, event.Cmdline, event.Hostname)
+	if (event.Severity == SeverityHigh || event.Severity == SeverityRecovered) && s.EscalationChannel != "" {
+		channel = s.EscalationChannel
+	}
+	if mapped := mappedChannel(event); mapped != "" {
+		channel = mapped
+	}
+
+	attachments := eventAttachments(title, event)
+	if link := renderLink(s.Link, event); link != "" {
+		attachments[0].Fields = append(attachments[0].Fields, SlackField{
+			Title: "Logs",
+			Value: "<" + link + "|Open logs>",
+		})
+	}
+
+	payload := SlackPayload{
+		Channel:     channel,
+		Text:        text,
+		Username:    s.Username,
+		IconEmoji:   s.IconEmoji,
+		Attachments: attachments,
+	}
+
+	if s.Threads == nil {
+		return s.post(ctx, payload)
+	}
+	return s.postThreaded(ctx, event, payload)
+}
+
+// postThreaded posts payload in the thread of the previous events with the
+// fingerprint of event, or as a new message starting a thread.
+func (s *SlackNotifier) postThreaded(ctx context.Context, event OOMEvent, payload SlackPayload) error {
+	key := event.GroupKey
+	if key == "" {
+		key = event.Fingerprint()
+	}
+	key += "\x00" + payload.Channel
+
+	if parent, found := s.Threads.parent(key); found {
+		payload.Channel = parent.Channel
+		payload.ThreadTS = parent.TS
+		_, err := s.postMessage(ctx, payload)
+		return err
 	}
 
-	// Convert milliseconds to time and format in IST
-	eventTime := time.Unix(0, event.Time*int64(time.Millisecond)).In(ist)
-	timeStr := eventTime.Format("2006-01-02 15:04:05 IST")
+	message, err := s.postMessage(ctx, payload)
+	if err != nil {
+		return err
+	}
+	s.Threads.start(key, message)
+	return nil
+}
 
+// eventAttachments renders the fields of event, and its kernel report when
+// attached, as message attachments colored and titled for its severity.
+func eventAttachments(title string, event OOMEvent) []SlackAttachment {
+	color := eventStyle(event).Color
 	attachment := SlackAttachment{
-		Color: "danger",
-		Title: "🚨 Out of Memory (OOM) Event Detected",
-		Fields: []SlackField{
-			{
-				Title: "Process Command",
-				Value: event.Cmdline,
-				Short: false,
-			},
-			{
-				Title: "Process ID",
-				Value: event.PID,
-				Short: true,
-			},
-			{
-				Title: "Hostname",
-				Value: event.Hostname,
-				Short: true,
-			},
-			{
-				Title: "Kernel Version",
-				Value: event.Kernel,
-				Short: true,
-			},
-			{
-				Title: "Time (IST)",
-				Value: timeStr,
-				Short: true,
-			},
-		},
+		Color: color,
+		Title: styledTitle(title, event),
+	}
+	for _, field := range eventFields(event) {
+		attachment.Fields = append(attachment.Fields, SlackField(field))
 	}
 
+	attachments := []SlackAttachment{attachment}
+	if event.Report != "" {
+		// Slack collapses long attachments behind "Show more"
+		attachments = append(attachments, SlackAttachment{
+			Color: color,
+			Title: "Kernel OOM Report",
+			Text:  "```" + event.Report + "```",
+		})
+	}
+	if event.Context != "" {
+		attachments = append(attachments, SlackAttachment{
+			Color: color,
+			Title: "Kernel Log Context",
+			Text:  "```" + event.Context + "```",
+		})
+	}
+	return attachments
+}
+
+// NotifyText sends a plain text message, used for alerts about the notifier
+// itself rather than about an OOM event.
+func (s *SlackNotifier) NotifyText(text string) error {
+	return s.NotifyTextContext(context.Background(), text)
+}
+
+// NotifyTextContext is NotifyText with the request cancelled once ctx is
+// done.
+func (s *SlackNotifier) NotifyTextContext(ctx context.Context, text string) error {
 	payload := SlackPayload{
-		Channel:     s.Channel,
-		Text:        "OOM Killer Alert",
-		Username:    "oom-notifier",
-		IconEmoji:   ":firecracker:",
-		Attachments: []SlackAttachment{attachment},
+		Channel:   s.Channel,
+		Text:      text,
+		Username:  s.Username,
+		IconEmoji: s.IconEmoji,
+	}
+
+	return s.post(ctx, payload)
+}
+
+func (s *SlackNotifier) post(ctx context.Context, payload SlackPayload) error {
+	if s.Token != "" {
+		_, err := s.postMessage(ctx, payload)
+		return err
+	}
+
+	jsonPayload, err := s.encode(payload)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	delivered := 0
+	for i, webhookURL := range s.WebhookURLs {
+		err := s.retrier.Do(ctx, func() error {
+			_, err := s.send(ctx, webhookURL, "", jsonPayload)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhook %d: %v", i+1, err))
+			continue
+		}
+		delivered++
+		if s.Mode == SlackModeFailover {
+			return nil
+		}
+	}
+
+	// Failing here would queue the message for every webhook again,
+	// duplicating it on those that already have it
+	if delivered > 0 && len(errs) > 0 {
+		logger.Warn("Slack message delivered to %d of %d webhooks: %v", delivered, len(s.WebhookURLs), errors.Join(errs...))
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+// postMessage posts payload with chat.postMessage and returns the message
+// it created.
+func (s *SlackNotifier) postMessage(ctx context.Context, payload SlackPayload) (slackMessage, error) {
+	jsonPayload, err := s.encode(payload)
+	if err != nil {
+		return slackMessage{}, err
+	}
+
+	var result slackResponse
+	err = s.retrier.Do(ctx, func() error {
+		body, err := s.send(ctx, s.apiURL+"/chat.postMessage", s.Token, jsonPayload)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			return fmt.Errorf("failed to parse slack API response: %v", err)
+		}
+		if !result.OK {
+			return fmt.Errorf("slack API returned error: %s", result.Error)
+		}
+		return nil
+	})
+	return result.slackMessage, err
+}
+
+// encode marshals payload, converting its attachments to blocks in the
+// blocks format.
+func (s *SlackNotifier) encode(payload SlackPayload) ([]byte, error) {
+	if s.Format == SlackFormatBlocks && len(payload.Attachments) > 0 {
+		payload.Blocks = slackBlocks(payload)
+		payload.Attachments = nil
 	}
 
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal slack payload: %v", err)
+		return nil, fmt.Errorf("failed to marshal slack payload: %v", err)
+	}
+	return jsonPayload, nil
+}
+
+// send delivers the payload to a webhook or Web API method, authorized with
+// token unless it is empty, and returns the response body. A 429 response
+// is retried once after the delay Slack asks for.
+func (s *SlackNotifier) send(ctx context.Context, url, token string, jsonPayload []byte) ([]byte, error) {
+	resp, body, err := s.sendOnce(ctx, url, token, jsonPayload)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return body, err
 	}
 
-	req, err := http.NewRequest("POST", s.WebhookURL, bytes.NewBuffer(jsonPayload))
+	delay := retryAfter(resp.Header, slackRetryAfterDefault, slackRetryAfterMax)
+	logger.Warn("Slack rate limited the request, retrying in %v", delay)
+	if !s.retrier.wait(ctx, delay) {
+		return nil, fmt.Errorf("slack API rate limited the request")
+	}
+
+	resp, body, err = s.sendOnce(ctx, url, token, jsonPayload)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, fmt.Errorf("slack API rate limited the request")
 	}
+	return body, nil
+}
 
-	req.Header.Set("Content-Type", "application/json")
+// sendOnce makes a single request. A 429 response is returned without an
+// error so send can honor Retry-After.
+func (s *SlackNotifier) sendOnce(ctx context.Context, url, token string, jsonPayload []byte) (*http.Response, []byte, error) {
+	req, err := newJSONRequest(ctx, url, jsonPayload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
 
-	resp, err := s.client.Do(req)
+	resp, body, err := doRequest(s.client, req)
+	if err != nil && ctx.Err() != nil {
+		// Retrying a cancelled delivery fails right away again
+		return nil, nil, fmt.Errorf("failed to send slack notification: %v", err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to send slack notification: %v", err)
+		return nil, nil, retryable(fmt.Errorf("failed to send slack notification: %v", err))
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("slack API returned non-200 status: %d", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		return nil, nil, retryable(fmt.Errorf("slack API returned non-200 status: %d", resp.StatusCode))
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusTooManyRequests {
+		return nil, nil, fmt.Errorf("slack API returned non-200 status: %d", resp.StatusCode)
 	}
 
-	return nil
+	return resp, body, nil
 }
@@ -0,0 +1,100 @@
+package notifier
+
+import "strings"
+
+// Message formats supported by SlackNotifier.
+const (
+	// SlackFormatAttachment posts legacy attachments, the default.
+	SlackFormatAttachment = "attachment"
+	// SlackFormatBlocks posts Block Kit blocks.
+	SlackFormatBlocks = "blocks"
+)
+
+// Block Kit limits, longer texts are rejected by Slack.
+const (
+	maxBlockHeader        = 150
+	maxBlockText          = 3000
+	maxBlockFieldText     = 2000
+	maxBlockSectionFields = 10
+	maxBlocks             = 50
+)
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type SlackBlock struct {
+	Type     string      `json:"type"`
+	Text     *SlackText  `json:"text,omitempty"`
+	Fields   []SlackText `json:"fields,omitempty"`
+	Elements []SlackText `json:"elements,omitempty"`
+}
+
+// slackBlocks renders the attachments of payload as Block Kit blocks: for
+// each attachment a header with its title, a section with its text, short
+// fields side by side in sections of up to ten and long fields in their own
+// section, and finally a context block with the payload text.
+func slackBlocks(payload SlackPayload) []SlackBlock {
+	var blocks []SlackBlock
+	for _, attachment := range payload.Attachments {
+		if attachment.Title != "" {
+			blocks = append(blocks, SlackBlock{
+				Type: "header",
+				Text: &SlackText{Type: "plain_text", Text: truncate(attachment.Title, maxBlockHeader)},
+			})
+		}
+		if attachment.Text != "" {
+			blocks = append(blocks, sectionBlock(attachment.Text))
+		}
+
+		var short []SlackText
+		flush := func() {
+			if len(short) > 0 {
+				blocks = append(blocks, SlackBlock{Type: "section", Fields: short})
+				short = nil
+			}
+		}
+		for _, field := range attachment.Fields {
+			if !field.Short {
+				flush()
+				blocks = append(blocks, sectionBlock("*"+field.Title+"*\n"+field.Value))
+				continue
+			}
+			short = append(short, SlackText{
+				Type: "mrkdwn",
+				Text: truncate("*"+field.Title+"*\n"+field.Value, maxBlockFieldText),
+			})
+			if len(short) == maxBlockSectionFields {
+				flush()
+			}
+		}
+		flush()
+	}
+
+	if payload.Text != "" {
+		blocks = append(blocks, SlackBlock{
+			Type:     "context",
+			Elements: []SlackText{{Type: "mrkdwn", Text: truncate(payload.Text, maxBlockText)}},
+		})
+	}
+
+	if len(blocks) > maxBlocks {
+		blocks = blocks[:maxBlocks]
+	}
+	return blocks
+}
+
+// sectionBlock returns a section with text, keeping a truncated code block
+// closed.
+func sectionBlock(text string) SlackBlock {
+	if len(text) > maxBlockText && strings.HasPrefix(text, "```") {
+		text = truncate(strings.TrimSuffix(text, "```"), maxBlockText-3) + "```"
+	} else {
+		text = truncate(text, maxBlockText)
+	}
+	return SlackBlock{
+		Type: "section",
+		Text: &SlackText{Type: "mrkdwn", Text: text},
+	}
+}
@@ -0,0 +1,97 @@
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackBlocksStructure(t *testing.T) {
+	payload := SlackPayload{
+		Text: "OOM kill on node-1",
+		Attachments: []SlackAttachment{{
+			Title: "🚨 OOM Kill Detected",
+			Text:  "```Out of memory```",
+			Fields: []SlackField{
+				{Title: "Host", Value: "node-1", Short: true},
+				{Title: "PID", Value: "4242", Short: true},
+				{Title: "Command", Value: "stress --vm 1"},
+				{Title: "Type", Value: "memcg", Short: true},
+			},
+		}},
+	}
+
+	want := []SlackBlock{
+		{Type: "header", Text: &SlackText{Type: "plain_text", Text: "🚨 OOM Kill Detected"}},
+		{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "```Out of memory```"}},
+		{Type: "section", Fields: []SlackText{{Type: "mrkdwn", Text: "*Host*\nnode-1"}, {Type: "mrkdwn", Text: "*PID*\n4242"}}},
+		{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: "*Command*\nstress --vm 1"}},
+		{Type: "section", Fields: []SlackText{{Type: "mrkdwn", Text: "*Type*\nmemcg"}}},
+		{Type: "context", Elements: []SlackText{{Type: "mrkdwn", Text: "OOM kill on node-1"}}},
+	}
+	if got := slackBlocks(payload); !reflect.DeepEqual(got, want) {
+		t.Errorf("slackBlocks =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestSlackBlocksRespectLimits(t *testing.T) {
+	var fields []SlackField
+	for i := 0; i < maxBlockSectionFields+2; i++ {
+		fields = append(fields, SlackField{Title: fmt.Sprint("Field ", i), Value: "value", Short: true})
+	}
+	blocks := slackBlocks(SlackPayload{Attachments: []SlackAttachment{{
+		Title:  strings.Repeat("t", 200),
+		Text:   "```" + strings.Repeat("x", 4000) + "```",
+		Fields: fields,
+	}}})
+
+	if len(blocks) != 4 {
+		t.Fatalf("%d blocks, want a header, the text and two sections of fields", len(blocks))
+	}
+	if got := blocks[0].Text.Text; len(got) > maxBlockHeader {
+		t.Errorf("header of %d bytes, want at most %d", len(got), maxBlockHeader)
+	}
+	if got := blocks[1].Text.Text; len(got) > maxBlockText || !strings.HasSuffix(got, "...```") {
+		t.Errorf("text of %d bytes ending %q, want at most %d in a closed code block", len(got), got[len(got)-6:], maxBlockText)
+	}
+	if len(blocks[2].Fields) != maxBlockSectionFields || len(blocks[3].Fields) != 2 {
+		t.Errorf("sections of %d and %d fields, want %d and 2", len(blocks[2].Fields), len(blocks[3].Fields), maxBlockSectionFields)
+	}
+
+	var many []SlackAttachment
+	for i := 0; i < maxBlocks; i++ {
+		many = append(many, SlackAttachment{Title: "kill", Text: "text"})
+	}
+	if got := len(slackBlocks(SlackPayload{Attachments: many})); got != maxBlocks {
+		t.Errorf("%d blocks, want at most %d", got, maxBlocks)
+	}
+}
+
+func TestSlackBlocksFormatPostsBlocks(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := NewSlackNotifier([]string{webhook.URL}, "alerts", nil, SlackModeAll, SlackFormatBlocks, nil, NewHTTPClient(5*time.Second, nil))
+
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var body map[string]any
+	webhook.last(t, &body)
+	if _, ok := body["attachments"]; ok {
+		t.Error("blocks message also carries attachments")
+	}
+	if text, _ := body["text"].(string); text == "" {
+		t.Error("blocks message lacks the notification text")
+	}
+	blocks, _ := body["blocks"].([]any)
+	if len(blocks) < 3 {
+		t.Fatalf("blocks = %v, want a header, sections and a context", body["blocks"])
+	}
+	first, _ := blocks[0].(map[string]any)
+	last, _ := blocks[len(blocks)-1].(map[string]any)
+	if first["type"] != "header" || last["type"] != "context" {
+		t.Errorf("blocks from %v to %v, want a header first and a context last", first["type"], last["type"])
+	}
+}
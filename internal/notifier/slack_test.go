@@ -0,0 +1,289 @@
+package notifier
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testWebhook is an HTTP server recording the JSON bodies posted to it and
+// answering them with status.
+type testWebhook struct {
+	*httptest.Server
+	mu     sync.Mutex
+	status int
+	bodies [][]byte
+}
+
+func newTestWebhook(t *testing.T, status int) *testWebhook {
+	t.Helper()
+	w := &testWebhook{status: status}
+	w.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.mu.Lock()
+		w.bodies = append(w.bodies, body)
+		status := w.status
+		w.mu.Unlock()
+		rw.WriteHeader(status)
+	}))
+	t.Cleanup(w.Close)
+	return w
+}
+
+// received returns the number of requests the webhook got.
+func (w *testWebhook) received() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.bodies)
+}
+
+// last decodes the last body posted into v.
+func (w *testWebhook) last(t *testing.T, v any) {
+	t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.bodies) == 0 {
+		t.Fatal("webhook received nothing")
+	}
+	if err := json.Unmarshal(w.bodies[len(w.bodies)-1], v); err != nil {
+		t.Fatalf("invalid body %s: %v", w.bodies[len(w.bodies)-1], err)
+	}
+}
+
+// testEvent is an OOM kill as the monitor reports it.
+func testEvent() OOMEvent {
+	return OOMEvent{
+		Kind:     "oom",
+		Message:  "Out of memory: Killed process 4242 (stress)",
+		Cmdline:  "stress --vm 1",
+		PID:      "4242",
+		Hostname: "node-1",
+		Time:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).UnixMilli(),
+		Severity: SeverityCritical,
+		OOMType:  "memcg",
+	}
+}
+
+func newTestSlack(mode string, webhooks ...*testWebhook) *SlackNotifier {
+	var urls []string
+	for _, w := range webhooks {
+		urls = append(urls, w.URL)
+	}
+	return NewSlackNotifier(urls, "alerts", nil, mode, SlackFormatAttachment, nil, NewHTTPClient(5*time.Second, nil))
+}
+
+func TestSlackAllModeSendsToEveryWebhook(t *testing.T) {
+	first, second := newTestWebhook(t, http.StatusOK), newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, first, second)
+
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if first.received() != 1 || second.received() != 1 {
+		t.Fatalf("webhooks received %d and %d messages, want 1 each", first.received(), second.received())
+	}
+	var payload SlackPayload
+	second.last(t, &payload)
+	if payload.Channel != "#alerts" || len(payload.Attachments) == 0 {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+}
+
+func TestSlackAllModePartialFailureIsNotRetried(t *testing.T) {
+	failing, working := newTestWebhook(t, http.StatusBadRequest), newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, failing, working)
+
+	// Failing would queue the event, and its retry would post it to the
+	// working webhook again
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v, want the partial delivery to succeed", err)
+	}
+	if failing.received() != 1 || working.received() != 1 {
+		t.Errorf("webhooks received %d and %d messages, want 1 each", failing.received(), working.received())
+	}
+}
+
+func TestSlackAllModeFailsWhenEveryWebhookFails(t *testing.T) {
+	first, second := newTestWebhook(t, http.StatusBadRequest), newTestWebhook(t, http.StatusForbidden)
+	s := newTestSlack(SlackModeAll, first, second)
+
+	if err := s.Notify(testEvent()); err == nil {
+		t.Fatal("Notify succeeded with every webhook failing")
+	}
+	if first.received() != 1 || second.received() != 1 {
+		t.Errorf("webhooks received %d and %d messages, want 1 each", first.received(), second.received())
+	}
+}
+
+func TestSlackFailoverModeStopsAtFirstSuccess(t *testing.T) {
+	first, second := newTestWebhook(t, http.StatusOK), newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeFailover, first, second)
+
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if first.received() != 1 || second.received() != 0 {
+		t.Errorf("webhooks received %d and %d messages, want 1 and 0", first.received(), second.received())
+	}
+}
+
+func TestSlackFailoverModeTriesNextWebhook(t *testing.T) {
+	failing, working := newTestWebhook(t, http.StatusInternalServerError), newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeFailover, failing, working)
+
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if failing.received() != 1 || working.received() != 1 {
+		t.Errorf("webhooks received %d and %d messages, want 1 each", failing.received(), working.received())
+	}
+
+	working.mu.Lock()
+	working.status = http.StatusBadGateway
+	working.mu.Unlock()
+	if err := s.Notify(testEvent()); err == nil {
+		t.Error("Notify succeeded with every webhook failing")
+	}
+}
+
+func TestSlackHonorsRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	var retried time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		retried = time.Now()
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	start := time.Now()
+	slack := NewSlackNotifier([]string{server.URL}, "alerts", nil, "", SlackFormatAttachment, nil, NewHTTPClient(5*time.Second, nil))
+	if err := slack.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("%d requests, want 2", n)
+	}
+	if waited := retried.Sub(start); waited < 2*time.Second {
+		t.Errorf("retried after %v, want at least the 2s of Retry-After", waited)
+	}
+}
+
+func TestSlackFailsWhenStillRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	slack := NewSlackNotifier([]string{server.URL}, "alerts", nil, "", SlackFormatAttachment, nil, NewHTTPClient(5*time.Second, nil))
+	if err := slack.Notify(testEvent()); err == nil {
+		t.Fatal("Notify succeeded although every request was rate limited")
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want the request and one retry", n)
+	}
+}
+
+func TestSlackIdentity(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+
+	var payload SlackPayload
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	webhook.last(t, &payload)
+	if payload.Username != SlackDefaultUsername || payload.IconEmoji != SlackDefaultIconEmoji {
+		t.Errorf("posted as %q with %q, want the defaults %q and %q", payload.Username, payload.IconEmoji, SlackDefaultUsername, SlackDefaultIconEmoji)
+	}
+
+	s.Username, s.IconEmoji = "platform-bot", ":rotating_light:"
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	webhook.last(t, &payload)
+	if payload.Username != "platform-bot" || payload.IconEmoji != ":rotating_light:" {
+		t.Errorf("event posted as %q with %q, want the configured identity", payload.Username, payload.IconEmoji)
+	}
+	if err := s.NotifyText("3 OOM kills on node-1"); err != nil {
+		t.Fatalf("NotifyText: %v", err)
+	}
+	webhook.last(t, &payload)
+	if payload.Username != "platform-bot" || payload.IconEmoji != ":rotating_light:" {
+		t.Errorf("text posted as %q with %q, want the configured identity", payload.Username, payload.IconEmoji)
+	}
+}
+
+func TestNormalizeSlackChannel(t *testing.T) {
+	for channel, want := range map[string]string{
+		"alerts":      "#alerts",
+		"#alerts":     "#alerts",
+		" alerts\n":   "#alerts",
+		"@oncall":     "@oncall",
+		"C024BE91L":   "C024BE91L",
+		"G024BE91L":   "G024BE91L",
+		"D024BE91L":   "D024BE91L",
+		"c024be91l":   "#c024be91l",
+		"CPU-alerts":  "#CPU-alerts",
+		"team_alerts": "#team_alerts",
+	} {
+		if got, err := NormalizeSlackChannel(channel); err != nil || got != want {
+			t.Errorf("NormalizeSlackChannel(%q) = %q, %v, want %q", channel, got, err, want)
+		}
+	}
+
+	for _, channel := range []string{"", "#", "@", "my alerts", "alerts,ops", "#ops#alerts", "ops@example", "#" + strings.Repeat("a", 81)} {
+		if got, err := NormalizeSlackChannel(channel); err == nil {
+			t.Errorf("NormalizeSlackChannel(%q) = %q, want it rejected", channel, got)
+		}
+	}
+}
+
+func TestNewSlackNotifierNormalizesChannel(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	if err := newTestSlack(SlackModeAll, webhook).Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	if payload.Channel != "#alerts" {
+		t.Errorf("sent to %q for channel alerts, want #alerts", payload.Channel)
+	}
+
+	// An invalid channel, rejected at startup, is kept as given
+	if s := NewSlackNotifier(nil, "my alerts", nil, SlackModeAll, SlackFormatAttachment, nil, nil); s.Channel != "my alerts" {
+		t.Errorf("Channel = %q, want the invalid channel kept", s.Channel)
+	}
+}
+
+func TestSlackContextAttachment(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	event := testEvent()
+	event.Report = "Mem-Info:"
+	event.Context = "Free swap  = 0kB\nOut of memory: Killed process 4242 (stress)\noom_reaper: reaped process 4242 (stress)"
+	if err := newTestSlack(SlackModeAll, webhook).Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	if len(payload.Attachments) != 3 {
+		t.Fatalf("%d attachments, want the event, the report and the context", len(payload.Attachments))
+	}
+	if got := payload.Attachments[2]; got.Title != "Kernel Log Context" || got.Text != "```"+event.Context+"```" {
+		t.Errorf("last attachment %+v, want the context in a code block", got)
+	}
+}
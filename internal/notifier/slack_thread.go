@@ -0,0 +1,63 @@
+package notifier
+
+import "time"
+
+// SlackThreads remembers the Slack message starting the thread of each
+// event fingerprint, so that its repeats are posted as replies instead of
+// filling the channel. A thread ends once its fingerprint was quiet for the
+// quiet period; the next event starts a new one.
+type SlackThreads struct {
+	quiet     time.Duration
+	threads   map[string]*slackThread
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// slackThread is the parent message of a thread and when it was last
+// replied to.
+type slackThread struct {
+	parent slackMessage
+	last   time.Time
+}
+
+func NewSlackThreads(quiet time.Duration) *SlackThreads {
+	return &SlackThreads{
+		quiet:   quiet,
+		threads: make(map[string]*slackThread),
+		now:     time.Now,
+	}
+}
+
+// parent returns the message starting the thread of key, when there is one
+// that was not quiet for the quiet period, and counts the reply about to be
+// posted as activity.
+func (t *SlackThreads) parent(key string) (slackMessage, bool) {
+	now := t.now()
+	t.prune(now)
+
+	thread, found := t.threads[key]
+	if !found || now.Sub(thread.last) >= t.quiet {
+		return slackMessage{}, false
+	}
+	thread.last = now
+	return thread.parent, true
+}
+
+// start records parent as the message starting the thread of key.
+func (t *SlackThreads) start(key string, parent slackMessage) {
+	t.threads[key] = &slackThread{parent: parent, last: t.now()}
+}
+
+// prune forgets the threads that were quiet for the quiet period, at most
+// once per period.
+func (t *SlackThreads) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < t.quiet {
+		return
+	}
+	for key, thread := range t.threads {
+		if now.Sub(thread.last) >= t.quiet {
+			delete(t.threads, key)
+		}
+	}
+	t.lastPrune = now
+}
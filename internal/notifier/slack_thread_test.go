@@ -0,0 +1,163 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slackAPIPost is a chat.postMessage call received by a fake Slack API.
+type slackAPIPost struct {
+	auth    string
+	payload SlackPayload
+}
+
+// fakeSlackAPI is a Slack Web API answering chat.postMessage with a new
+// message timestamp for every post, or with err when it is set.
+type fakeSlackAPI struct {
+	*httptest.Server
+	mu    sync.Mutex
+	err   string
+	posts []slackAPIPost
+}
+
+func newFakeSlackAPI(t *testing.T) *fakeSlackAPI {
+	t.Helper()
+	api := &fakeSlackAPI{}
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat.postMessage" {
+			http.NotFound(w, r)
+			return
+		}
+		var payload SlackPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		if api.err != "" {
+			fmt.Fprintf(w, `{"ok": false, "error": %q}`, api.err)
+			return
+		}
+		api.posts = append(api.posts, slackAPIPost{auth: r.Header.Get("Authorization"), payload: payload})
+		fmt.Fprintf(w, `{"ok": true, "channel": "C0123", "ts": "1714564800.%06d"}`, len(api.posts))
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+func (api *fakeSlackAPI) fail(err string) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.err = err
+}
+
+func (api *fakeSlackAPI) received() []slackAPIPost {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	return append([]slackAPIPost(nil), api.posts...)
+}
+
+// newThreadedSlack returns a SlackNotifier posting to api, threading
+// repeats until they were quiet for a minute of clock.
+func newThreadedSlack(api *fakeSlackAPI, clock *fakeClock) *SlackNotifier {
+	s := NewSlackNotifier(nil, "alerts", nil, SlackModeAll, SlackFormatAttachment, nil, NewHTTPClient(5*time.Second, nil))
+	s.Token = "xoxb-test"
+	s.apiURL = api.URL
+	s.Threads = NewSlackThreads(time.Minute)
+	s.Threads.now = clock.Now
+	return s
+}
+
+func TestSlackThreadsRepliesToParent(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	s := newThreadedSlack(api, &fakeClock{now: time.Now()})
+
+	java := killBurst("node-1", "java", "java", "java")
+	for _, event := range append(java, killBurst("node-1", "postgres")...) {
+		if err := s.Notify(event); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+
+	posts := api.received()
+	if len(posts) != 4 {
+		t.Fatalf("%d posts, want 4", len(posts))
+	}
+	for i, want := range []struct{ channel, thread string }{
+		{"#alerts", ""},
+		{"C0123", "1714564800.000001"},
+		{"C0123", "1714564800.000001"},
+		// Another fingerprint starts its own thread
+		{"#alerts", ""},
+	} {
+		if got := posts[i].payload; got.Channel != want.channel || got.ThreadTS != want.thread {
+			t.Errorf("post %d to %q in thread %q, want %q in thread %q", i, got.Channel, got.ThreadTS, want.channel, want.thread)
+		}
+		if posts[i].auth != "Bearer xoxb-test" {
+			t.Errorf("post %d authorized with %q, want the bot token", i, posts[i].auth)
+		}
+	}
+}
+
+func TestSlackThreadEndsAfterQuietPeriod(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	clock := &fakeClock{now: time.Now()}
+	s := newThreadedSlack(api, clock)
+
+	for _, advance := range []time.Duration{0, 50 * time.Second, 50 * time.Second, time.Minute} {
+		clock.Advance(advance)
+		if err := s.Notify(testEvent()); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+
+	posts := api.received()
+	if len(posts) != 4 {
+		t.Fatalf("%d posts, want 4", len(posts))
+	}
+	// Replies keep the thread going, a minute of quiet ends it
+	for i, want := range []string{"", "1714564800.000001", "1714564800.000001", ""} {
+		if got := posts[i].payload.ThreadTS; got != want {
+			t.Errorf("post %d in thread %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSlackThreadNotStartedByFailedPost(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	s := newThreadedSlack(api, &fakeClock{now: time.Now()})
+
+	api.fail("channel_not_found")
+	if err := s.Notify(testEvent()); err == nil || err.Error() != "slack API returned error: channel_not_found" {
+		t.Errorf("Notify = %v, want the API error", err)
+	}
+	api.fail("")
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if posts := api.received(); len(posts) != 1 || posts[0].payload.ThreadTS != "" {
+		t.Errorf("posts %+v, want a new parent message", posts)
+	}
+}
+
+func TestSlackTokenPostsWithoutThreads(t *testing.T) {
+	api := newFakeSlackAPI(t)
+	s := NewSlackNotifier(nil, "alerts", nil, SlackModeAll, SlackFormatAttachment, nil, NewHTTPClient(5*time.Second, nil))
+	s.Token = "xoxb-test"
+	s.apiURL = api.URL
+
+	for i := 0; i < 2; i++ {
+		if err := s.Notify(testEvent()); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+	posts := api.received()
+	if len(posts) != 2 || posts[1].payload.ThreadTS != "" || posts[1].auth != "Bearer xoxb-test" {
+		t.Errorf("posts %+v, want two messages posted with the token", posts)
+	}
+}
@@ -0,0 +1,108 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// SNS rejects subjects of 100 characters or more and any character outside
+// printable ASCII.
+const snsMaxSubject = 99
+
+// snsTimeout bounds a single publish, including credential lookups.
+const snsTimeout = 10 * time.Second
+
+// snsPublisher is the part of the SNS client used by SNSNotifier.
+type snsPublisher interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// SNSNotifier publishes events to an AWS SNS topic. The message is the event
+// as JSON, like the generic webhook, with a plain text subject for email and
+// chat subscriptions.
+type SNSNotifier struct {
+	TopicARN string
+	client   snsPublisher
+}
+
+// NewSNSNotifier creates an SNS notifier. Credentials come from the default
+// AWS chain: environment, shared config files, web identity or the instance
+// role. An empty region also falls back to the default chain.
+func NewSNSNotifier(topicARN, region string) (*SNSNotifier, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), snsTimeout)
+	defer cancel()
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %v", err)
+	}
+
+	return &SNSNotifier{
+		TopicARN: topicARN,
+		client:   sns.NewFromConfig(cfg),
+	}, nil
+}
+
+func (s *SNSNotifier) Name() string {
+	return "sns"
+}
+
+func (s *SNSNotifier) Notify(event OOMEvent) error {
+	return s.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (s *SNSNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	message, err := MarshalEvent(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sns message: %v", err)
+	}
+	return s.publish(ctx, eventSubject(event), string(message))
+}
+
+func (s *SNSNotifier) NotifyText(text string) error {
+	return s.NotifyTextContext(context.Background(), text)
+}
+
+// NotifyTextContext is NotifyText with the request cancelled once ctx is
+// done.
+func (s *SNSNotifier) NotifyTextContext(ctx context.Context, text string) error {
+	return s.publish(ctx, text, text)
+}
+
+func (s *SNSNotifier) publish(ctx context.Context, subject, message string) error {
+	ctx, cancel := context.WithTimeout(ctx, snsTimeout)
+	defer cancel()
+
+	_, err := s.client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(s.TopicARN),
+		Subject:  aws.String(snsSubject(subject)),
+		Message:  aws.String(message),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish sns notification: %v", err)
+	}
+	return nil
+}
+
+// snsSubject makes subject acceptable to SNS: characters outside printable
+// ASCII become "?" and the result is truncated to snsMaxSubject.
+func snsSubject(subject string) string {
+	subject = strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, subject)
+	return truncate(subject, snsMaxSubject)
+}
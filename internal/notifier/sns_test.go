@@ -0,0 +1,98 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+)
+
+// fakeSNS records the publish inputs it is given, failing with err when set.
+type fakeSNS struct {
+	inputs []*sns.PublishInput
+	err    error
+}
+
+func (f *fakeSNS) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.inputs = append(f.inputs, params)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &sns.PublishOutput{MessageId: aws.String("1")}, nil
+}
+
+const testTopicARN = "arn:aws:sns:eu-west-1:123456789012:oom-alerts"
+
+func TestSNSPublishesEventAsJSON(t *testing.T) {
+	client := &fakeSNS{}
+	s := &SNSNotifier{TopicARN: testTopicARN, client: client}
+
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(client.inputs) != 1 {
+		t.Fatalf("%d publishes, want 1", len(client.inputs))
+	}
+	input := client.inputs[0]
+	if got := aws.ToString(input.TopicArn); got != testTopicARN {
+		t.Errorf("TopicArn = %q, want %q", got, testTopicARN)
+	}
+	if got, want := aws.ToString(input.Subject), "OOM killed stress --vm 1 on node-1"; got != want {
+		t.Errorf("Subject = %q, want %q", got, want)
+	}
+
+	doc := decodeJSON(t, []byte(aws.ToString(input.Message)))
+	for key, want := range map[string]any{
+		"pid":      "4242",
+		"cmdline":  "stress --vm 1",
+		"hostname": "node-1",
+		"oom_type": "memcg",
+	} {
+		if got := doc[key]; got != want {
+			t.Errorf("message %s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestSNSSubjectIsAcceptedBySNS(t *testing.T) {
+	client := &fakeSNS{}
+	s := &SNSNotifier{TopicARN: testTopicARN, client: client}
+	event := testEvent()
+	event.Cmdline = "python3 " + strings.Repeat("très-long-argument ", 10)
+
+	if err := s.Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	subject := aws.ToString(client.inputs[0].Subject)
+	if len(subject) > snsMaxSubject {
+		t.Errorf("subject of %d characters, want at most %d", len(subject), snsMaxSubject)
+	}
+	for _, r := range subject {
+		if r < ' ' || r > '~' {
+			t.Errorf("subject %q contains %q outside printable ASCII", subject, r)
+			break
+		}
+	}
+}
+
+func TestSNSReportsPublishFailures(t *testing.T) {
+	s := &SNSNotifier{TopicARN: testTopicARN, client: &fakeSNS{err: errors.New("AuthorizationError")}}
+	if err := s.Notify(testEvent()); err == nil || !strings.Contains(err.Error(), "AuthorizationError") {
+		t.Errorf("Notify = %v, want the publish error", err)
+	}
+}
+
+func TestSNSNotifyText(t *testing.T) {
+	client := &fakeSNS{}
+	s := &SNSNotifier{TopicARN: testTopicARN, client: client}
+	if err := s.NotifyText("3 OOM kills on node-1\n"); err != nil {
+		t.Fatalf("NotifyText: %v", err)
+	}
+	input := client.inputs[0]
+	if aws.ToString(input.Message) != "3 OOM kills on node-1\n" || aws.ToString(input.Subject) != "3 OOM kills on node-1?" {
+		t.Errorf("published subject %q and message %q", aws.ToString(input.Subject), aws.ToString(input.Message))
+	}
+}
@@ -0,0 +1,43 @@
+package notifier
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// StdoutNotifier writes every event as one JSON object per line, for
+// deployments where an existing log pipeline routes the events. Lines are
+// written whole, so it can be shared between goroutines.
+type StdoutNotifier struct {
+	// Encoding is the JSON representation of the events written.
+	Encoding EventEncoding
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// NewStdoutNotifier creates a notifier writing to out, normally os.Stdout.
+func NewStdoutNotifier(out io.Writer) *StdoutNotifier {
+	return &StdoutNotifier{out: out}
+}
+
+func (s *StdoutNotifier) Name() string {
+	return "stdout"
+}
+
+func (s *StdoutNotifier) Notify(event OOMEvent) error {
+	line, err := s.Encoding.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.out.Write(line); err != nil {
+		return fmt.Errorf("failed to write event: %v", err)
+	}
+	return nil
+}
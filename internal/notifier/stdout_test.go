@@ -0,0 +1,84 @@
+package notifier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStdoutWritesJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	s := NewStdoutNotifier(&out)
+	events := killBurst("node-1", "java", "postgres")
+
+	for _, event := range events {
+		if err := s.Notify(event); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(events) {
+		t.Fatalf("%d lines, want one per event: %q", len(lines), out.String())
+	}
+	for i, line := range lines {
+		var got OOMEvent
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d is not JSON: %v: %s", i, err, line)
+		}
+		if got.PID != events[i].PID || got.Cmdline != events[i].Cmdline {
+			t.Errorf("line %d = %+v, want %+v", i, got, events[i])
+		}
+	}
+}
+
+func TestStdoutConcurrentNotify(t *testing.T) {
+	var out bytes.Buffer
+	s := NewStdoutNotifier(&out)
+
+	const writers, perWriter = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				event := testEvent()
+				event.PID = fmt.Sprintf("%d-%d", i, j)
+				s.Notify(event)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var event OOMEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("interleaved line: %v: %s", err, scanner.Text())
+		}
+		seen[event.PID] = true
+	}
+	if len(seen) != writers*perWriter {
+		t.Errorf("%d distinct events written, want %d", len(seen), writers*perWriter)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestStdoutReportsWriteErrors(t *testing.T) {
+	err := NewStdoutNotifier(failingWriter{}).Notify(testEvent())
+	if err == nil || !strings.Contains(err.Error(), "broken pipe") {
+		t.Errorf("Notify = %v, want the write error", err)
+	}
+}
@@ -0,0 +1,272 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+const (
+	// streamBuffer bounds the messages a stream holds while disconnected.
+	streamBuffer = 100
+	// streamReconnectDelay is the wait before reconnecting after a failed
+	// attempt, doubled after each failure up to streamMaxReconnectDelay.
+	streamReconnectDelay    = time.Second
+	streamMaxReconnectDelay = 30 * time.Second
+	// streamTimeout bounds connecting to the broker and, on Close, flushing
+	// the held messages.
+	streamTimeout = 10 * time.Second
+)
+
+// errStreamClosed is returned for messages written after Close.
+var errStreamClosed = errors.New("stream closed")
+
+// streamMessage is a message produced to a stream. Key orders the messages
+// within the stream when the broker supports it.
+type streamMessage struct {
+	Key   []byte
+	Value []byte
+}
+
+// streamConn is a connection of a streaming notifier to its broker. Write
+// fails with an error wrapped by lostConnection once the connection is
+// lost, other errors rejecting only the message.
+type streamConn interface {
+	Write(ctx context.Context, msg streamMessage) error
+	Close() error
+}
+
+// lostConnectionError marks a write that failed because the connection to
+// the broker was lost.
+type lostConnectionError struct {
+	error
+}
+
+func lostConnection(err error) error {
+	return lostConnectionError{err}
+}
+
+func (e lostConnectionError) Unwrap() error {
+	return e.error
+}
+
+// stream manages the connection of a streaming notifier. The connection is
+// made in the background and made again with backoff whenever it is lost.
+// Messages written while disconnected are held, up to streamBuffer, and
+// flushed in order once connected or on Close, so a broker restart does not
+// lose events.
+type stream struct {
+	name string
+	dial func(ctx context.Context) (streamConn, error)
+
+	limit    int
+	delay    time.Duration
+	maxDelay time.Duration
+
+	mu           sync.Mutex
+	conn         streamConn
+	pending      []streamMessage
+	reconnecting bool
+	closed       bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// newStream creates the stream of the notifier called name, connecting
+// with dial, and starts connecting.
+func newStream(name string, dial func(ctx context.Context) (streamConn, error)) *stream {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &stream{
+		name:     name,
+		dial:     dial,
+		limit:    streamBuffer,
+		delay:    streamReconnectDelay,
+		maxDelay: streamMaxReconnectDelay,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	s.mu.Lock()
+	s.startReconnect()
+	s.mu.Unlock()
+	return s
+}
+
+// Write sends msg, or holds it while the stream is disconnected. It fails
+// when the message was rejected or the held messages are at their bound.
+func (s *stream) Write(ctx context.Context, msg streamMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errStreamClosed
+	}
+	if s.conn != nil {
+		err := s.conn.Write(ctx, msg)
+		var lost lostConnectionError
+		if err == nil || !errors.As(err, &lost) || ctx.Err() != nil {
+			return err
+		}
+		logger.Warn("Lost connection of %s notifier, reconnecting: %v", s.name, err)
+		s.disconnect()
+	}
+
+	if len(s.pending) >= s.limit {
+		return fmt.Errorf("%s disconnected with %d messages held already", s.name, len(s.pending))
+	}
+	s.pending = append(s.pending, msg)
+	logger.Debug("Holding %s message until reconnected, %d held", s.name, len(s.pending))
+	return nil
+}
+
+// Connected reports whether the stream is connected to its broker.
+func (s *stream) Connected() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn != nil
+}
+
+// Held returns the number of messages waiting for the stream to connect.
+func (s *stream) Held() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Close stops reconnecting, flushes the held messages, connecting one last
+// time if needed, and closes the connection. It fails when held messages
+// could not be delivered.
+func (s *stream) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), streamTimeout)
+	defer cancel()
+	if s.conn == nil && len(s.pending) > 0 {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("%d held messages lost, failed to connect: %v", len(s.pending), err)
+		}
+		s.conn = conn
+	}
+	if s.conn == nil {
+		return nil
+	}
+
+	flushErr := s.flush(ctx)
+	closeErr := s.conn.Close()
+	s.conn = nil
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// disconnect closes the lost connection and starts reconnecting. s.mu must
+// be held.
+func (s *stream) disconnect() {
+	s.conn.Close()
+	s.conn = nil
+	s.startReconnect()
+}
+
+// startReconnect starts connecting in the background unless it already is.
+// s.mu must be held.
+func (s *stream) startReconnect() {
+	if s.reconnecting || s.closed {
+		return
+	}
+	s.reconnecting = true
+	s.wg.Add(1)
+	go s.reconnect()
+}
+
+// reconnect connects until it succeeds and the held messages are flushed,
+// doubling the wait after every failure, or the stream is closed.
+func (s *stream) reconnect() {
+	defer s.wg.Done()
+
+	delay := s.delay
+	for {
+		ctx, cancel := context.WithTimeout(s.ctx, streamTimeout)
+		conn, err := s.dial(ctx)
+		if err == nil {
+			if s.connected(ctx, conn) {
+				cancel()
+				return
+			}
+			err = errors.New("connection lost while flushing held messages")
+		}
+		cancel()
+		logger.Warn("Failed to connect %s notifier, retrying in %v: %v", s.name, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-s.ctx.Done():
+			s.mu.Lock()
+			s.reconnecting = false
+			s.mu.Unlock()
+			return
+		}
+		if delay *= 2; delay > s.maxDelay {
+			delay = s.maxDelay
+		}
+	}
+}
+
+// connected takes conn into use once the held messages are flushed through
+// it. It reports false when the connection was lost meanwhile.
+func (s *stream) connected(ctx context.Context, conn streamConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		// Close flushes the held messages itself
+		conn.Close()
+		s.reconnecting = false
+		return true
+	}
+	s.conn = conn
+	held := len(s.pending)
+	if err := s.flush(ctx); err != nil {
+		conn.Close()
+		s.conn = nil
+		return false
+	}
+	s.reconnecting = false
+	if held > 0 {
+		logger.Info("Connected %s notifier, flushed %d held messages", s.name, held)
+	} else {
+		logger.Debug("Connected %s notifier", s.name)
+	}
+	return true
+}
+
+// flush writes the held messages in order through s.conn, dropping those
+// the broker rejects. It stops at a lost connection, keeping the messages
+// not written yet. s.mu must be held.
+func (s *stream) flush(ctx context.Context) error {
+	for len(s.pending) > 0 {
+		err := s.conn.Write(ctx, s.pending[0])
+		var lost lostConnectionError
+		if errors.As(err, &lost) || ctx.Err() != nil {
+			return fmt.Errorf("%d held messages not flushed: %v", len(s.pending), err)
+		}
+		if err != nil {
+			logger.Error("Dropping held %s message rejected by the broker: %v", s.name, err)
+		}
+		s.pending = s.pending[1:]
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeBroker is a broker that can be taken down and brought back. Its
+// connections fail with a lost connection while it is down, also once it is
+// back, like TCP connections across a broker restart.
+type fakeBroker struct {
+	mu       sync.Mutex
+	up       bool
+	restarts int
+	dials    int
+	received []string
+}
+
+func (b *fakeBroker) dial(ctx context.Context) (streamConn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dials++
+	if !b.up {
+		return nil, errors.New("connection refused")
+	}
+	return &fakeStreamConn{broker: b, restarts: b.restarts}, nil
+}
+
+func (b *fakeBroker) setUp(up bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !up {
+		b.restarts++
+	}
+	b.up = up
+}
+
+func (b *fakeBroker) messages() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.received...)
+}
+
+func (b *fakeBroker) dialCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dials
+}
+
+type fakeStreamConn struct {
+	broker   *fakeBroker
+	restarts int
+}
+
+func (c *fakeStreamConn) Write(ctx context.Context, msg streamMessage) error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if !c.broker.up || c.broker.restarts != c.restarts {
+		return lostConnection(errors.New("connection reset by peer"))
+	}
+	if string(msg.Value) == "reject" {
+		return errors.New("message too large")
+	}
+	c.broker.received = append(c.broker.received, string(msg.Value))
+	return nil
+}
+
+func (c *fakeStreamConn) Close() error {
+	return nil
+}
+
+// newTestStream creates a stream connecting to broker that holds up to 3
+// messages and retries within milliseconds.
+func newTestStream(t *testing.T, broker *fakeBroker) *stream {
+	t.Helper()
+	return newTestStreamDelay(t, broker, time.Millisecond)
+}
+
+// newTestStreamDelay is newTestStream waiting at least delay between
+// connection attempts.
+func newTestStreamDelay(t *testing.T, broker *fakeBroker, delay time.Duration) *stream {
+	t.Helper()
+	return newDialStream(t, broker.dial, delay)
+}
+
+// newDialStream is newTestStreamDelay connecting with dial.
+func newDialStream(t *testing.T, dial func(ctx context.Context) (streamConn, error), delay time.Duration) *stream {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &stream{
+		name:     "test",
+		dial:     dial,
+		limit:    3,
+		delay:    delay,
+		maxDelay: 5 * delay,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	s.mu.Lock()
+	s.startReconnect()
+	s.mu.Unlock()
+	return s
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func write(t *testing.T, s *stream, value string) {
+	t.Helper()
+	if err := s.Write(context.Background(), streamMessage{Value: []byte(value)}); err != nil {
+		t.Fatalf("Write(%q): %v", value, err)
+	}
+}
+
+func TestStreamConnectsInBackground(t *testing.T) {
+	broker := &fakeBroker{up: true}
+	s := newTestStream(t, broker)
+	defer s.Close()
+
+	waitFor(t, "connection", s.Connected)
+	write(t, s, "a")
+	if got := broker.messages(); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("received %q, want [a]", got)
+	}
+}
+
+func TestStreamHoldsMessagesUntilReconnected(t *testing.T) {
+	broker := &fakeBroker{up: true}
+	s := newTestStream(t, broker)
+	defer s.Close()
+	waitFor(t, "connection", s.Connected)
+	write(t, s, "a")
+
+	broker.setUp(false)
+	write(t, s, "b")
+	if s.Connected() {
+		t.Error("stream still connected after losing its connection")
+	}
+	write(t, s, "c")
+	if held := s.Held(); held != 2 {
+		t.Errorf("Held() = %d, want 2", held)
+	}
+	waitFor(t, "reconnection attempts", func() bool { return broker.dialCount() >= 3 })
+
+	broker.setUp(true)
+	waitFor(t, "reconnection", s.Connected)
+	write(t, s, "d")
+	if got, want := broker.messages(), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("received %q, want %q", got, want)
+	}
+	if held := s.Held(); held != 0 {
+		t.Errorf("Held() = %d after reconnecting, want 0", held)
+	}
+}
+
+func TestStreamRejectsMessagesBeyondBound(t *testing.T) {
+	broker := &fakeBroker{}
+	s := newTestStream(t, broker)
+	defer s.Close()
+
+	for i := 1; i <= 3; i++ {
+		write(t, s, fmt.Sprint(i))
+	}
+	if err := s.Write(context.Background(), streamMessage{Value: []byte("4")}); err == nil {
+		t.Fatal("Write succeeded with the held messages at their bound")
+	}
+
+	broker.setUp(true)
+	waitFor(t, "reconnection", s.Connected)
+	if got, want := broker.messages(), []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("received %q, want %q", got, want)
+	}
+}
+
+func TestStreamReturnsRejectedMessages(t *testing.T) {
+	broker := &fakeBroker{up: true}
+	s := newTestStream(t, broker)
+	defer s.Close()
+	waitFor(t, "connection", s.Connected)
+
+	if err := s.Write(context.Background(), streamMessage{Value: []byte("reject")}); err == nil {
+		t.Fatal("Write of a rejected message succeeded")
+	}
+	if !s.Connected() {
+		t.Error("rejected message disconnected the stream")
+	}
+	if held := s.Held(); held != 0 {
+		t.Errorf("Held() = %d, want the rejected message not held", held)
+	}
+}
+
+func TestStreamCloseFlushesHeldMessages(t *testing.T) {
+	broker := &fakeBroker{}
+	s := newTestStreamDelay(t, broker, time.Hour)
+	write(t, s, "a")
+	write(t, s, "b")
+
+	// The broker comes back as the notifier shuts down, before the next
+	// connection attempt
+	waitFor(t, "connection attempt", func() bool { return broker.dialCount() == 1 })
+	broker.setUp(true)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got, want := broker.messages(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("received %q, want %q", got, want)
+	}
+	if err := s.Write(context.Background(), streamMessage{Value: []byte("c")}); !errors.Is(err, errStreamClosed) {
+		t.Errorf("Write after Close = %v, want %v", err, errStreamClosed)
+	}
+}
+
+func TestStreamCloseReportsLostMessages(t *testing.T) {
+	broker := &fakeBroker{}
+	s := newTestStream(t, broker)
+	write(t, s, "a")
+
+	if err := s.Close(); err == nil {
+		t.Error("Close succeeded with a held message and the broker down")
+	}
+}
+
+type fakeProducer struct {
+	mu       sync.Mutex
+	err      error
+	messages []kafka.Message
+	closed   bool
+}
+
+func (p *fakeProducer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, msgs...)
+	return p.err
+}
+
+func (p *fakeProducer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *fakeProducer) produced() []kafka.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]kafka.Message(nil), p.messages...)
+}
+
+func TestKafkaConnLostConnection(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		lost bool
+	}{
+		{"delivered", nil, false},
+		{"eof", kafka.WriteErrors{io.EOF}, true},
+		{"connection reset", kafka.WriteErrors{fmt.Errorf("write: %w", syscall.ECONNRESET)}, true},
+		{"broker error", kafka.MessageSizeTooLarge, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &kafkaConn{producer: &fakeProducer{err: tt.err}}
+			err := conn.Write(context.Background(), streamMessage{Key: []byte("node-1"), Value: []byte("{}")})
+			var lost lostConnectionError
+			if got := errors.As(err, &lost); got != tt.lost {
+				t.Errorf("lost connection = %v, want %v (error %v)", got, tt.lost, err)
+			}
+			if (err != nil) != (tt.err != nil) {
+				t.Errorf("Write = %v, want an error: %v", err, tt.err != nil)
+			}
+		})
+	}
+}
+
+type fakePublisher struct {
+	mu         sync.Mutex
+	publishErr error
+	flushErr   error
+	published  []string
+	closed     bool
+}
+
+func (p *fakePublisher) Publish(subject string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.publishErr != nil {
+		return p.publishErr
+	}
+	p.published = append(p.published, subject+" "+string(data))
+	return nil
+}
+
+func (p *fakePublisher) FlushTimeout(timeout time.Duration) error {
+	return p.flushErr
+}
+
+func (p *fakePublisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+}
+
+// messages returns the messages published so far, each as the subject and
+// the payload separated by a space.
+func (p *fakePublisher) messages() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.published...)
+}
+
+func TestNATSConnLostConnection(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		publisher *fakePublisher
+		lost      bool
+	}{
+		{"delivered", &fakePublisher{}, false},
+		{"closed", &fakePublisher{publishErr: nats.ErrConnectionClosed}, true},
+		{"flush timeout", &fakePublisher{flushErr: nats.ErrTimeout}, true},
+		{"payload too large", &fakePublisher{publishErr: nats.ErrMaxPayload}, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &natsConn{subject: "oom", publisher: tt.publisher}
+			err := conn.Write(context.Background(), streamMessage{Value: []byte("{}")})
+			var lost lostConnectionError
+			if got := errors.As(err, &lost); got != tt.lost {
+				t.Errorf("lost connection = %v, want %v (error %v)", got, tt.lost, err)
+			}
+		})
+	}
+}
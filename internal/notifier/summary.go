@@ -0,0 +1,227 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NodeSummary describes a burst of OOM kills on a single host.
+type NodeSummary struct {
+	Hostname string
+	Kernel   string
+	// Victims are the distinct containers killed, see victimName.
+	Victims []string
+	// Containers is set when every victim is a container or cgroup rather
+	// than a bare command line.
+	Containers bool
+	Events     []OOMEvent
+	Start      int64
+	End        int64
+}
+
+// SummaryNotifier is implemented by notifiers that can render node summaries.
+type SummaryNotifier interface {
+	NotifySummary(summary NodeSummary) error
+}
+
+// SummaryContextNotifier is implemented by summary notifiers whose
+// deliveries can be cancelled. Their NotifySummary delivers with
+// context.Background().
+type SummaryContextNotifier interface {
+	NotifySummaryContext(ctx context.Context, summary NodeSummary) error
+}
+
+// Summarizer collects OOM events over a window and decides per host whether
+// they should be reported individually or rolled up into a NodeSummary.
+type Summarizer struct {
+	window    time.Duration
+	threshold int
+	pending   map[string][]OOMEvent
+	order     []string
+}
+
+func NewSummarizer(window time.Duration, threshold int) *Summarizer {
+	return &Summarizer{
+		window:    window,
+		threshold: threshold,
+		pending:   make(map[string][]OOMEvent),
+	}
+}
+
+// Window returns the aggregation window length.
+func (s *Summarizer) Window() time.Duration {
+	return s.window
+}
+
+// Add buffers an event. It returns true when the event opened a new window,
+// in which case the caller is responsible for calling Flush once the window
+// has elapsed.
+func (s *Summarizer) Add(event OOMEvent) bool {
+	opened := len(s.order) == 0
+	if _, ok := s.pending[event.Hostname]; !ok {
+		s.order = append(s.order, event.Hostname)
+	}
+	s.pending[event.Hostname] = append(s.pending[event.Hostname], event)
+	return opened
+}
+
+// Flush empties the window. Hosts with at least threshold distinct victims are
+// returned as summaries, all other buffered events are returned unchanged.
+func (s *Summarizer) Flush() ([]OOMEvent, []NodeSummary) {
+	var events []OOMEvent
+	var summaries []NodeSummary
+
+	for _, hostname := range s.order {
+		hostEvents := s.pending[hostname]
+		victims, containers := distinctVictims(hostEvents)
+		if len(victims) < s.threshold {
+			events = append(events, hostEvents...)
+			continue
+		}
+
+		summary := NodeSummary{
+			Hostname:   hostname,
+			Kernel:     hostEvents[0].Kernel,
+			Victims:    victims,
+			Containers: containers,
+			Events:     hostEvents,
+			Start:      hostEvents[0].Time,
+			End:        hostEvents[0].Time,
+		}
+		for _, event := range hostEvents {
+			if event.Time < summary.Start {
+				summary.Start = event.Time
+			}
+			if event.Time > summary.End {
+				summary.End = event.Time
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	s.pending = make(map[string][]OOMEvent)
+	s.order = nil
+	return events, summaries
+}
+
+// distinctVictims returns the sorted set of killed containers, see
+// victimName, and whether they all are containers. Repeated kills of the
+// same workload only count once towards node pressure, as do the
+// processes of one container.
+func distinctVictims(events []OOMEvent) ([]string, bool) {
+	seen := make(map[string]bool)
+	var victims []string
+	containers := true
+	for _, event := range events {
+		name, container := victimName(event)
+		containers = containers && container
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		victims = append(victims, name)
+	}
+	sort.Strings(victims)
+	return victims, containers
+}
+
+// victimName names the container an event killed in: its container name
+// when enrichment found one, otherwise the memory cgroup that hit its
+// limit. Kills outside a container are named by their command line, and
+// container is false for them.
+func victimName(event OOMEvent) (name string, container bool) {
+	switch {
+	case event.ContainerName != "":
+		return event.ContainerName, true
+	case event.Cgroup != "":
+		return event.Cgroup, true
+	}
+	return displayCmdline(event.Cmdline), false
+}
+
+// victimNoun is what the victims of summary are called in its title.
+func victimNoun(summary NodeSummary) string {
+	if summary.Containers {
+		return "containers"
+	}
+	return "processes"
+}
+
+// summaryCmdlines returns the distinct command lines killed in summary.
+func summaryCmdlines(summary NodeSummary) []string {
+	seen := make(map[string]bool)
+	var cmdlines []string
+	for _, event := range summary.Events {
+		if !seen[event.Cmdline] {
+			seen[event.Cmdline] = true
+			cmdlines = append(cmdlines, event.Cmdline)
+		}
+	}
+	return cmdlines
+}
+
+func (s *SlackNotifier) NotifySummary(summary NodeSummary) error {
+	return s.NotifySummaryContext(context.Background(), summary)
+}
+
+// NotifySummaryContext is NotifySummary with the request cancelled once ctx
+// is done.
+func (s *SlackNotifier) NotifySummaryContext(ctx context.Context, summary NodeSummary) error {
+	title := fmt.Sprintf("🚨 Node %s under memory pressure: %d %s killed",
+		summary.Hostname, len(summary.Victims), victimNoun(summary))
+	victimsTitle := "Killed Processes"
+	if summary.Containers {
+		victimsTitle = "Killed Containers"
+	}
+
+	attachment := SlackAttachment{
+		Color: "danger",
+		Title: title,
+		Fields: []SlackField{
+			{
+				Title: victimsTitle,
+				Value: strings.Join(summary.Victims, "\n"),
+				Short: false,
+			},
+			{
+				Title: "OOM Kills",
+				Value: fmt.Sprintf("%d", len(summary.Events)),
+				Short: true,
+			},
+			{
+				Title: "Hostname",
+				Value: summary.Hostname,
+				Short: true,
+			},
+			{
+				Title: "Kernel Version",
+				Value: summary.Kernel,
+				Short: true,
+			},
+			{
+				Title: "First Kill",
+				Value: formatEventTime(summary.Start),
+				Short: true,
+			},
+			{
+				Title: "Last Kill",
+				Value: formatEventTime(summary.End),
+				Short: true,
+			},
+		},
+	}
+
+	// A summary takes the first route matching its host or any victim
+	payload := SlackPayload{
+		Channel:     routeChannel(s.Routes, s.Channel, append([]string{summary.Hostname}, summaryCmdlines(summary)...)...),
+		Text:        "OOM Killer Alert",
+		Username:    s.Username,
+		IconEmoji:   s.IconEmoji,
+		Attachments: []SlackAttachment{attachment},
+	}
+
+	return s.post(ctx, payload)
+}
@@ -0,0 +1,89 @@
+package notifier
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSummarizerFlush(t *testing.T) {
+	s := NewSummarizer(0, 2)
+	busy := []OOMEvent{
+		{Hostname: "node-1", Cmdline: "java", ContainerName: "api", Time: 2000},
+		// Two processes of one container count once
+		{Hostname: "node-1", Cmdline: "java worker", ContainerName: "api", Time: 1000},
+		{Hostname: "node-1", Cmdline: "postgres", Cgroup: "/kubepods/pod-db", Time: 3000},
+	}
+	quiet := OOMEvent{Hostname: "node-2", Cmdline: "java", ContainerName: "api", Time: 1500}
+
+	if !s.Add(busy[0]) {
+		t.Error("first event did not open the window")
+	}
+	for _, event := range append(busy[1:], quiet) {
+		if s.Add(event) {
+			t.Error("later event opened another window")
+		}
+	}
+
+	events, summaries := s.Flush()
+	if len(events) != 1 || events[0].Hostname != "node-2" {
+		t.Errorf("individual events %+v, want the one of node-2", events)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(summaries))
+	}
+	summary := summaries[0]
+	if got := strings.Join(summary.Victims, ","); got != "/kubepods/pod-db,api" {
+		t.Errorf("victims %q, want the container and the cgroup", got)
+	}
+	if !summary.Containers || len(summary.Events) != 3 || summary.Start != 1000 || summary.End != 3000 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	if events, summaries := s.Flush(); len(events) != 0 || len(summaries) != 0 {
+		t.Error("flush did not empty the window")
+	}
+}
+
+func TestSummarizerCountsProcessesOutsideContainers(t *testing.T) {
+	s := NewSummarizer(0, 2)
+	s.Add(OOMEvent{Hostname: "node-1", Cmdline: "java -jar app.jar"})
+	s.Add(OOMEvent{Hostname: "node-1", Cmdline: "java -jar app.jar"})
+	if _, summaries := s.Flush(); len(summaries) != 0 {
+		t.Fatal("repeated kills of one process were summarized")
+	}
+
+	s.Add(OOMEvent{Hostname: "node-1", Cmdline: "java -jar app.jar"})
+	s.Add(OOMEvent{Hostname: "node-1", Cmdline: "postgres", ContainerName: "db"})
+	_, summaries := s.Flush()
+	if len(summaries) != 1 || summaries[0].Containers {
+		t.Fatalf("got %+v, want one summary of processes", summaries)
+	}
+}
+
+func TestSlackSummaryTitle(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+
+	for _, tc := range []struct {
+		summary NodeSummary
+		title   string
+		field   string
+	}{
+		{NodeSummary{Hostname: "node-1", Victims: []string{"api", "db"}, Containers: true}, "2 containers killed", "Killed Containers"},
+		{NodeSummary{Hostname: "node-1", Victims: []string{"api", "java"}}, "2 processes killed", "Killed Processes"},
+	} {
+		if err := s.NotifySummary(tc.summary); err != nil {
+			t.Fatalf("NotifySummary: %v", err)
+		}
+		var payload SlackPayload
+		webhook.last(t, &payload)
+		attachment := payload.Attachments[0]
+		if !strings.HasSuffix(attachment.Title, tc.title) {
+			t.Errorf("title %q, want it to end with %q", attachment.Title, tc.title)
+		}
+		if attachment.Fields[0].Title != tc.field || attachment.Fields[0].Value != strings.Join(tc.summary.Victims, "\n") {
+			t.Errorf("victims field %+v, want %s", attachment.Fields[0], tc.field)
+		}
+	}
+}
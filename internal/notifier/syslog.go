@@ -0,0 +1,203 @@
+package notifier
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transports of SyslogNotifier.
+const (
+	SyslogUDP = "udp"
+	SyslogTCP = "tcp"
+	SyslogTLS = "tls"
+)
+
+const (
+	// syslogTimeout bounds connecting to the server and writing a message.
+	syslogTimeout = 10 * time.Second
+	// maxSyslogDatagram is the largest message a UDP datagram can carry.
+	maxSyslogDatagram = 65507
+	// syslogSDID names the structured data element of events. 32473 is the
+	// enterprise number reserved for examples by RFC 5612.
+	syslogSDID = "oom@32473"
+	// syslogBOM starts a UTF-8 MSG, as required by RFC 5424.
+	syslogBOM = "\xef\xbb\xbf"
+)
+
+// syslogSeverities maps event severities to syslog severity codes: 1
+// alert, 2 critical, 4 warning, 5 notice and 6 informational. Others are 3,
+// error.
+var syslogSeverities = map[string]int{
+	SeverityHigh:      1,
+	SeverityCritical:  2,
+	SeverityWarning:   4,
+	SeverityPressure:  5,
+	SeverityRecovered: 6,
+}
+
+// SyslogNotifier sends every event to a syslog server as an RFC 5424
+// message, the event details in a structured data element. Messages go over
+// UDP, one per datagram, or over TCP or TLS framed by octet counting as in
+// RFC 6587 and RFC 5425. The connection is opened on the first event and
+// opened again after a failed write.
+type SyslogNotifier struct {
+	Network  string
+	Addr     string
+	Facility int
+	// TLSConfig is used by the TLS transport, nil for Go's defaults.
+	TLSConfig *tls.Config
+	conn      net.Conn
+}
+
+// NewSyslogNotifier creates a notifier sending to the syslog server at addr,
+// host:port, over network, SyslogUDP, SyslogTCP or SyslogTLS, with facility,
+// 0 to 23, e.g. 3 for daemon or 16 to 23 for local0 to local7.
+func NewSyslogNotifier(network, addr string, facility int) (*SyslogNotifier, error) {
+	switch network {
+	case SyslogUDP, SyslogTCP, SyslogTLS:
+	default:
+		return nil, fmt.Errorf("unknown syslog network %q, expected %s, %s or %s", network, SyslogUDP, SyslogTCP, SyslogTLS)
+	}
+	if facility < 0 || facility > 23 {
+		return nil, fmt.Errorf("invalid syslog facility %d, expected 0 to 23", facility)
+	}
+	return &SyslogNotifier{Network: network, Addr: addr, Facility: facility}, nil
+}
+
+func (s *SyslogNotifier) Name() string {
+	return "syslog"
+}
+
+func (s *SyslogNotifier) Notify(event OOMEvent) error {
+	message := syslogMessage(event, s.Facility, time.Now())
+	frame := []byte(message)
+	if s.Network == SyslogUDP {
+		if len(frame) > maxSyslogDatagram {
+			return fmt.Errorf("syslog message of %d bytes exceeds the %d bytes of a datagram", len(frame), maxSyslogDatagram)
+		}
+	} else {
+		frame = []byte(strconv.Itoa(len(message)) + " " + message)
+	}
+
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog server %s: %v", s.Addr, err)
+		}
+		s.conn = conn
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+	if _, err := s.conn.Write(frame); err != nil {
+		// A stream may have been cut mid-frame, start over on a new one
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("failed to send syslog message: %v", err)
+	}
+	return nil
+}
+
+func (s *SyslogNotifier) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogTimeout}
+	if s.Network == SyslogTLS {
+		return tls.DialWithDialer(dialer, "tcp", s.Addr, s.TLSConfig)
+	}
+	return dialer.Dial(s.Network, s.Addr)
+}
+
+// Close closes the connection, if any.
+func (s *SyslogNotifier) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// syslogMessage formats event as an RFC 5424 message with facility. The
+// timestamp is the time of the event, or now when it has none, and the MSG
+// is the one-line summary also used as email subject.
+func syslogMessage(event OOMEvent, facility int, now time.Time) string {
+	severity, known := syslogSeverities[event.Severity]
+	if !known {
+		severity = 3
+	}
+	timestamp := now
+	if event.Time != 0 {
+		timestamp = time.UnixMilli(event.Time)
+	}
+	msgID := event.Kind
+	if msgID == "" {
+		msgID = "oom"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s oom-notifier %d %s ",
+		facility*8+severity,
+		timestamp.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		syslogHeaderField(event.Hostname, 255),
+		os.Getpid(),
+		syslogHeaderField(msgID, 32))
+
+	b.WriteString("[" + syslogSDID)
+	for _, param := range [][2]string{
+		{"kind", event.Kind},
+		{"severity", event.Severity},
+		{"pid", event.PID},
+		{"cmdline", event.Cmdline},
+		{"uid", event.UID},
+		{"user", event.User},
+		{"oom_type", event.OOMType},
+		{"constraint", event.Constraint},
+		{"cgroup", event.Cgroup},
+		{"pod", event.PodName},
+		{"namespace", event.Namespace},
+		{"container", event.ContainerName},
+		{"anon_rss_kb", event.AnonRSS},
+		{"total_vm_kb", event.TotalVM},
+		{"kernel", event.Kernel},
+		{"fingerprint", event.GroupKey},
+		{"message", event.Message},
+	} {
+		if param[1] != "" {
+			fmt.Fprintf(&b, ` %s="%s"`, param[0], syslogParamValue(param[1]))
+		}
+	}
+	if event.Test {
+		b.WriteString(` test="true"`)
+	}
+	b.WriteString("] " + syslogBOM + eventSubject(event))
+	return b.String()
+}
+
+// syslogHeaderField returns value as a header field of at most limit
+// printable ASCII characters, "-" when it is empty. Other characters,
+// spaces included, are replaced by underscores.
+func syslogHeaderField(value string, limit int) string {
+	if value == "" {
+		return "-"
+	}
+	field := []byte(value)
+	if len(field) > limit {
+		field = field[:limit]
+	}
+	for i, c := range field {
+		if c < '!' || c > '~' {
+			field[i] = '_'
+		}
+	}
+	return string(field)
+}
+
+// syslogParamValue escapes the characters RFC 5424 requires to be escaped
+// in a structured data parameter value.
+func syslogParamValue(value string) string {
+	// Values must be UTF-8, command lines need not be
+	value = strings.ToValidUTF8(value, "\uFFFD")
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
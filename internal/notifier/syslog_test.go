@@ -0,0 +1,322 @@
+package notifier
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// syslogFrame is a parsed RFC 5424 message holding one structured data
+// element.
+type syslogFrame struct {
+	pri                                           int
+	timestamp, hostname, app, procID, msgID, sdID string
+	params                                        map[string]string
+	msg                                           string
+}
+
+// parseSyslog parses message as RFC 5424, failing t when it is malformed.
+func parseSyslog(t *testing.T, message string) syslogFrame {
+	t.Helper()
+	var frame syslogFrame
+	end := strings.Index(message, ">")
+	if !strings.HasPrefix(message, "<") || end < 0 {
+		t.Fatalf("message %q lacks a PRI", message)
+	}
+	pri, err := strconv.Atoi(message[1:end])
+	if err != nil {
+		t.Fatalf("message %q has an invalid PRI: %v", message, err)
+	}
+	frame.pri = pri
+
+	header := strings.SplitN(message[end+1:], " ", 7)
+	if len(header) != 7 || header[0] != "1" {
+		t.Fatalf("message %q lacks an RFC 5424 header", message)
+	}
+	frame.timestamp, frame.hostname, frame.app, frame.procID, frame.msgID = header[1], header[2], header[3], header[4], header[5]
+
+	rest := header[6]
+	if !strings.HasPrefix(rest, "[") {
+		t.Fatalf("message %q lacks structured data", message)
+	}
+	rest = rest[1:]
+	id := strings.IndexAny(rest, " ]")
+	if id < 0 {
+		t.Fatalf("message %q has an unterminated structured data element", message)
+	}
+	frame.sdID, rest = rest[:id], rest[id:]
+	frame.params = map[string]string{}
+	for strings.HasPrefix(rest, " ") {
+		eq := strings.Index(rest, `="`)
+		if eq < 0 {
+			t.Fatalf("message %q has a parameter without a value", message)
+		}
+		name := rest[1:eq]
+		rest = rest[eq+2:]
+		var value strings.Builder
+		for {
+			if rest == "" {
+				t.Fatalf("message %q has an unterminated value of %s", message, name)
+			}
+			c := rest[0]
+			rest = rest[1:]
+			if c == '"' {
+				break
+			}
+			if c == ']' {
+				t.Fatalf("message %q has an unescaped ] in the value of %s", message, name)
+			}
+			if c == '\\' && rest != "" && strings.ContainsRune(`"\]`, rune(rest[0])) {
+				c, rest = rest[0], rest[1:]
+			}
+			value.WriteByte(c)
+		}
+		frame.params[name] = value.String()
+	}
+	if !strings.HasPrefix(rest, "] "+syslogBOM) {
+		t.Fatalf("message %q lacks a UTF-8 MSG after the structured data", message)
+	}
+	frame.msg = strings.TrimPrefix(rest, "] "+syslogBOM)
+	return frame
+}
+
+// newSyslogUDP returns a notifier sending to a UDP listener with facility
+// and a function receiving the next message.
+func newSyslogUDP(t *testing.T, facility int) (*SyslogNotifier, func() string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s, err := NewSyslogNotifier(SyslogUDP, conn.LocalAddr().String(), facility)
+	if err != nil {
+		t.Fatalf("NewSyslogNotifier: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s, func() string {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		buf := make([]byte, maxSyslogDatagram)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("no syslog message received: %v", err)
+		}
+		return string(buf[:n])
+	}
+}
+
+// acceptFrames accepts connections on listener and sends the messages
+// framed by octet counting on each over the returned channel.
+func acceptFrames(t *testing.T, listener net.Listener) <-chan string {
+	t.Helper()
+	t.Cleanup(func() { listener.Close() })
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					length, err := r.ReadString(' ')
+					if err != nil {
+						return
+					}
+					n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+					if err != nil {
+						return
+					}
+					message := make([]byte, n)
+					if _, err := io.ReadFull(r, message); err != nil {
+						return
+					}
+					messages <- string(message)
+				}
+			}()
+		}
+	}()
+	return messages
+}
+
+// nextFrame returns the next message of messages.
+func nextFrame(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("no syslog frame received")
+		return ""
+	}
+}
+
+func TestSyslogUDPSendsStructuredData(t *testing.T) {
+	s, receive := newSyslogUDP(t, 16)
+	event := testEvent()
+	event.GroupKey = event.Fingerprint()
+	if err := s.Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	frame := parseSyslog(t, receive())
+	if frame.pri != 16*8+2 {
+		t.Errorf("PRI %d, want local0 (16) and critical (2)", frame.pri)
+	}
+	if frame.timestamp != "2024-05-01T12:00:00.000Z" || frame.hostname != "node-1" || frame.app != "oom-notifier" ||
+		frame.procID != strconv.Itoa(os.Getpid()) || frame.msgID != "oom" {
+		t.Errorf("header %+v, want the time, host and kind of the event sent by oom-notifier", frame)
+	}
+	if frame.sdID != syslogSDID {
+		t.Errorf("structured data element %q, want %q", frame.sdID, syslogSDID)
+	}
+	want := map[string]string{
+		"kind":        "oom",
+		"severity":    SeverityCritical,
+		"pid":         "4242",
+		"cmdline":     "stress --vm 1",
+		"oom_type":    "memcg",
+		"fingerprint": event.Fingerprint(),
+		"message":     "Out of memory: Killed process 4242 (stress)",
+	}
+	if !reflect.DeepEqual(frame.params, want) {
+		t.Errorf("parameters %v, want %v without the empty fields", frame.params, want)
+	}
+	if frame.msg != eventSubject(event) {
+		t.Errorf("MSG %q, want the subject %q", frame.msg, eventSubject(event))
+	}
+}
+
+func TestSyslogSeverities(t *testing.T) {
+	for severity, want := range map[string]int{
+		SeverityHigh:      1,
+		SeverityCritical:  2,
+		SeverityWarning:   4,
+		SeverityPressure:  5,
+		SeverityRecovered: 6,
+		"":                3,
+	} {
+		event := testEvent()
+		event.Severity = severity
+		if frame := parseSyslog(t, syslogMessage(event, 3, time.Now())); frame.pri != 3*8+want {
+			t.Errorf("severity %q: PRI %d, want daemon (3) and %d", severity, frame.pri, want)
+		}
+	}
+}
+
+func TestSyslogMessageEscapesFields(t *testing.T) {
+	event := testEvent()
+	event.Cmdline = `sh -c "echo [done] \ok"` + "\xff"
+	event.Hostname = "node 1"
+	event.Kind = ""
+	event.Time = 0
+	now := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+
+	frame := parseSyslog(t, syslogMessage(event, 3, now))
+	if got := frame.params["cmdline"]; got != `sh -c "echo [done] \ok"`+"�" {
+		t.Errorf("cmdline %q, want the command line made valid UTF-8", got)
+	}
+	if frame.hostname != "node_1" || frame.msgID != "oom" || frame.timestamp != "2024-05-01T13:00:00.000Z" {
+		t.Errorf("header %+v, want the space of the host replaced, the oom kind and the time now", frame)
+	}
+
+	event.Hostname = ""
+	if frame := parseSyslog(t, syslogMessage(event, 3, now)); frame.hostname != "-" {
+		t.Errorf("hostname %q without a host, want the nil value", frame.hostname)
+	}
+}
+
+func TestSyslogTCPFramesMessages(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := acceptFrames(t, listener)
+	s, err := NewSyslogNotifier(SyslogTCP, listener.Addr().String(), 3)
+	if err != nil {
+		t.Fatalf("NewSyslogNotifier: %v", err)
+	}
+	defer s.Close()
+
+	for _, cmdline := range []string{"java", "postgres"} {
+		event := testEvent()
+		event.Cmdline = cmdline
+		if err := s.Notify(event); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+		if frame := parseSyslog(t, nextFrame(t, messages)); frame.params["cmdline"] != cmdline {
+			t.Errorf("frame of %q, want %q", frame.params["cmdline"], cmdline)
+		}
+	}
+
+	// A closed connection is opened again
+	s.Close()
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify after Close: %v", err)
+	}
+	parseSyslog(t, nextFrame(t, messages))
+}
+
+func TestSyslogTLS(t *testing.T) {
+	// Borrow the certificate of a test HTTPS server, valid for 127.0.0.1
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	server.Close()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: server.TLS.Certificates})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := acceptFrames(t, listener)
+
+	s, err := NewSyslogNotifier(SyslogTLS, listener.Addr().String(), 3)
+	if err != nil {
+		t.Fatalf("NewSyslogNotifier: %v", err)
+	}
+	defer s.Close()
+	if err := s.Notify(testEvent()); err == nil {
+		t.Error("Notify trusted an unknown certificate")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	s.TLSConfig = &tls.Config{RootCAs: roots}
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if frame := parseSyslog(t, nextFrame(t, messages)); frame.params["pid"] != "4242" {
+		t.Errorf("frame of PID %q, want 4242", frame.params["pid"])
+	}
+}
+
+func TestSyslogUDPRejectsOversizedMessages(t *testing.T) {
+	s, _ := newSyslogUDP(t, 3)
+	event := testEvent()
+	event.Message = strings.Repeat("x", maxSyslogDatagram)
+	if err := s.Notify(event); err == nil || !strings.Contains(err.Error(), "datagram") {
+		t.Errorf("Notify = %v, want the message rejected as too large", err)
+	}
+}
+
+func TestNewSyslogNotifierRejectsInvalidOptions(t *testing.T) {
+	if _, err := NewSyslogNotifier("sctp", "127.0.0.1:514", 3); err == nil || !strings.Contains(err.Error(), "network") {
+		t.Errorf("network sctp: %v, want an unknown network error", err)
+	}
+	for _, facility := range []int{-1, 24} {
+		if _, err := NewSyslogNotifier(SyslogUDP, "127.0.0.1:514", facility); err == nil || !strings.Contains(err.Error(), "facility") {
+			t.Errorf("facility %d: %v, want an invalid facility error", facility, err)
+		}
+	}
+}
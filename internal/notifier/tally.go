@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tally counts OOM kills per host and command line between periodic
+// reports, so that a report saying there were none tells a quiet period
+// apart from a broken notifier. It is safe for concurrent use.
+type Tally struct {
+	mu     sync.Mutex
+	counts map[[2]string]int
+	since  time.Time
+	now    func() time.Time
+}
+
+// TallyReport holds the kills counted between Start and End.
+type TallyReport struct {
+	Start   time.Time
+	End     time.Time
+	Total   int
+	Entries []DigestEntry
+}
+
+func NewTally() *Tally {
+	t := &Tally{counts: make(map[[2]string]int), now: time.Now}
+	t.since = t.now()
+	return t
+}
+
+// Add counts an OOM kill.
+func (t *Tally) Add(event OOMEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.counts[[2]string{event.Hostname, event.Cmdline}]++
+}
+
+// Take returns the kills counted since the previous Take and starts
+// counting again.
+func (t *Tally) Take() TallyReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := TallyReport{Start: t.since, End: t.now(), Entries: digestEntries(t.counts)}
+	for _, count := range t.counts {
+		report.Total += count
+	}
+	t.counts = make(map[[2]string]int)
+	t.since = report.End
+	return report
+}
+
+// Hosts returns the number of distinct hosts in the report.
+func (r TallyReport) Hosts() int {
+	hosts := make(map[string]bool)
+	for _, entry := range r.Entries {
+		hosts[entry.Hostname] = true
+	}
+	return len(hosts)
+}
+
+// TallyText renders a report as plain text.
+func TallyText(r TallyReport) string {
+	since := formatEventTime(r.Start.UnixMilli())
+	if r.Total == 0 {
+		return fmt.Sprintf("📊 oom-notifier report: no OOM events since %s", since)
+	}
+	return fmt.Sprintf("📊 oom-notifier report: %d OOM kills on %d host(s) since %s:\n%s",
+		r.Total, r.Hosts(), since, entryLines(r.Entries))
+}
@@ -0,0 +1,66 @@
+package notifier
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestTally() (*Tally, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	tally := NewTally()
+	tally.now = clock.Now
+	tally.since = clock.Now()
+	return tally, clock
+}
+
+func TestTallyCountsKillsBetweenReports(t *testing.T) {
+	tally, clock := newTestTally()
+	for _, event := range append(killBurst("node-1", "java", "java", "postgres"), killBurst("node-2", "java")...) {
+		tally.Add(event)
+	}
+	clock.Advance(time.Hour)
+
+	report := tally.Take()
+	if report.Total != 4 || report.Hosts() != 2 {
+		t.Errorf("report of %d kills on %d hosts, want 4 on 2", report.Total, report.Hosts())
+	}
+	want := []DigestEntry{
+		{Hostname: "node-1", Cmdline: "java", Count: 2},
+		{Hostname: "node-1", Cmdline: "postgres", Count: 1},
+		{Hostname: "node-2", Cmdline: "java", Count: 1},
+	}
+	if !reflect.DeepEqual(report.Entries, want) {
+		t.Errorf("entries %+v, want %+v", report.Entries, want)
+	}
+	if !report.Start.Equal(clock.now.Add(-time.Hour)) || !report.End.Equal(clock.now) {
+		t.Errorf("report from %v to %v, want the last hour", report.Start, report.End)
+	}
+
+	// Counting starts again from the previous report
+	clock.Advance(time.Hour)
+	next := tally.Take()
+	if next.Total != 0 || len(next.Entries) != 0 || !next.Start.Equal(report.End) {
+		t.Errorf("next report %+v, want no kills since %v", next, report.End)
+	}
+}
+
+func TestTallyText(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	quiet := TallyText(TallyReport{Start: start, End: start.Add(time.Hour)})
+	if !strings.Contains(quiet, "no OOM events since") {
+		t.Errorf("report of a quiet hour %q, want it to say there were none", quiet)
+	}
+
+	busy := TallyText(TallyReport{Start: start, End: start.Add(time.Hour), Total: 3, Entries: []DigestEntry{
+		{Hostname: "node-1", Cmdline: "java", Count: 2},
+		{Hostname: "node-2", Cmdline: "postgres", Count: 1},
+	}})
+	for _, want := range []string{"3 OOM kills on 2 host(s)", "2× java on node-1\n1× postgres on node-2"} {
+		if !strings.Contains(busy, want) {
+			t.Errorf("report %q does not contain %q", busy, want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+type TeamsNotifier struct {
+	WebhookURL string
+	// Link, when set, renders the URL of a page about the event, see
+	// ParseLinkTemplate. It is added as a button to the card.
+	Link   *template.Template
+	client *http.Client
+}
+
+type TeamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type TeamsSection struct {
+	Title string      `json:"title,omitempty"`
+	Text  string      `json:"text,omitempty"`
+	Facts []TeamsFact `json:"facts,omitempty"`
+}
+
+type TeamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+// TeamsAction is an OpenUri action, shown as a button opening the target.
+type TeamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []TeamsTarget `json:"targets"`
+}
+
+// TeamsPayload is a connector MessageCard.
+type TeamsPayload struct {
+	Type            string         `json:"@type"`
+	Context         string         `json:"@context"`
+	ThemeColor      string         `json:"themeColor"`
+	Summary         string         `json:"summary"`
+	Title           string         `json:"title"`
+	Sections        []TeamsSection `json:"sections"`
+	PotentialAction []TeamsAction  `json:"potentialAction,omitempty"`
+}
+
+func NewTeamsNotifier(webhookURL string, client *http.Client) *TeamsNotifier {
+	return &TeamsNotifier{
+		WebhookURL: webhookURL,
+		client:     client,
+	}
+}
+
+func (t *TeamsNotifier) Name() string {
+	return "teams"
+}
+
+func (t *TeamsNotifier) Notify(event OOMEvent) error {
+	return t.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (t *TeamsNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	title, text := eventTitle(event)
+
+	section := TeamsSection{}
+	for _, field := range eventFields(event) {
+		section.Facts = append(section.Facts, TeamsFact{
+			Name:  field.Title,
+			Value: field.Value,
+		})
+	}
+
+	sections := []TeamsSection{section}
+	if event.Report != "" {
+		sections = append(sections, TeamsSection{
+			Title: "Kernel OOM Report",
+			Text:  "<pre>" + event.Report + "</pre>",
+		})
+	}
+	if event.Context != "" {
+		sections = append(sections, TeamsSection{
+			Title: "Kernel Log Context",
+			Text:  "<pre>" + event.Context + "</pre>",
+		})
+	}
+
+	var actions []TeamsAction
+	if link := renderLink(t.Link, event); link != "" {
+		actions = append(actions, TeamsAction{
+			Type:    "OpenUri",
+			Name:    "Open logs",
+			Targets: []TeamsTarget{{OS: "default", URI: link}},
+		})
+	}
+
+	return t.post(ctx, TeamsPayload{
+		Type:            "MessageCard",
+		Context:         "http://schema.org/extensions",
+		ThemeColor:      teamsColor(eventStyle(event).Color),
+		Summary:         text,
+		Title:           styledTitle(title, event),
+		Sections:        sections,
+		PotentialAction: actions,
+	})
+}
+
+func (t *TeamsNotifier) NotifyText(text string) error {
+	return t.NotifyTextContext(context.Background(), text)
+}
+
+// NotifyTextContext is NotifyText with the request cancelled once ctx is
+// done.
+func (t *TeamsNotifier) NotifyTextContext(ctx context.Context, text string) error {
+	return t.post(ctx, TeamsPayload{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: "E01E5A",
+		Summary:    text,
+		Title:      text,
+		Sections:   []TeamsSection{},
+	})
+}
+
+func (t *TeamsNotifier) post(ctx context.Context, payload TeamsPayload) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal teams payload: %v", err)
+	}
+
+	req, err := newJSONRequest(ctx, t.WebhookURL, jsonPayload)
+	if err != nil {
+		return err
+	}
+
+	resp, body, err := doRequest(t.client, req)
+	if err != nil {
+		return fmt.Errorf("failed to send teams notification: %v", err)
+	}
+
+	// Incoming webhooks answer 200 with a body of "1"; errors also come back
+	// as 200 with the error text in the body
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("teams API returned non-200 status: %d", resp.StatusCode)
+	}
+	if strings.TrimSpace(string(body)) != "1" {
+		return fmt.Errorf("teams API returned unexpected response: %q", truncate(string(body), 200))
+	}
+
+	return nil
+}
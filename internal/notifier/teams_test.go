@@ -0,0 +1,98 @@
+package notifier
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestTeams returns a Teams notifier posting to a webhook answering 200
+// with reply, and the payloads the webhook received.
+func newTestTeams(t *testing.T, reply string) (*TeamsNotifier, *[]TeamsPayload) {
+	t.Helper()
+	var payloads []TeamsPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload TeamsPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("invalid body %s: %v", body, err)
+		}
+		payloads = append(payloads, payload)
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(server.Close)
+	return NewTeamsNotifier(server.URL, NewHTTPClient(5*time.Second, nil)), &payloads
+}
+
+func TestTeamsMessageCard(t *testing.T) {
+	teams, payloads := newTestTeams(t, "1")
+	event := testEvent()
+	event.Report = "Mem-Info:"
+	if err := teams.Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(*payloads) != 1 {
+		t.Fatalf("%d payloads, want 1", len(*payloads))
+	}
+
+	card := (*payloads)[0]
+	if card.Type != "MessageCard" || card.Context != "http://schema.org/extensions" {
+		t.Errorf("@type %q, @context %q, want a MessageCard", card.Type, card.Context)
+	}
+	if card.Title == "" || card.ThemeColor == "" || card.ThemeColor[0] == '#' {
+		t.Errorf("title %q, themeColor %q, want a title and a hex color without #", card.Title, card.ThemeColor)
+	}
+	if len(card.Sections) != 2 || card.Sections[1].Text != "<pre>Mem-Info:</pre>" {
+		t.Fatalf("sections = %+v, want the facts and the report", card.Sections)
+	}
+	facts := make(map[string]string)
+	for _, fact := range card.Sections[0].Facts {
+		facts[fact.Name] = fact.Value
+	}
+	for name, want := range map[string]string{
+		"Process Command": "stress --vm 1",
+		"Process ID":      "4242",
+		"Hostname":        "node-1",
+	} {
+		if facts[name] != want {
+			t.Errorf("fact %s = %q, want %q", name, facts[name], want)
+		}
+	}
+}
+
+func TestTeamsValidatesResponseBody(t *testing.T) {
+	for reply, ok := range map[string]bool{
+		"1": true,
+		"":  false,
+		"Webhook message delivery failed with error: Microsoft Teams endpoint returned HTTP error 429": false,
+	} {
+		teams, _ := newTestTeams(t, reply)
+		if err := teams.Notify(testEvent()); (err == nil) != ok {
+			t.Errorf("reply %q: Notify = %v, want success %v", reply, err, ok)
+		}
+	}
+}
+
+func TestTeamsFailsOnErrorStatus(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusBadRequest)
+	teams := NewTeamsNotifier(webhook.URL, NewHTTPClient(5*time.Second, nil))
+	if err := teams.Notify(testEvent()); err == nil {
+		t.Error("Notify succeeded with 400 Bad Request")
+	}
+}
+
+func TestTeamsContextSection(t *testing.T) {
+	teams, payloads := newTestTeams(t, "1")
+	event := testEvent()
+	event.Context = "Free swap  = 0kB\nOut of memory: Killed process 4242 (stress)\noom_reaper: reaped process 4242 (stress)"
+	if err := teams.Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	sections := (*payloads)[0].Sections
+	if len(sections) != 2 || sections[1].Title != "Kernel Log Context" || sections[1].Text != "<pre>"+event.Context+"</pre>" {
+		t.Errorf("sections = %+v, want the facts and the context", sections)
+	}
+}
@@ -0,0 +1,170 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// telegramAPI is the Bot API endpoint, requests go to
+	// <telegramAPI>/bot<token>/<method>.
+	telegramAPI = "https://api.telegram.org"
+	// maxTelegramMessage is the longest message text accepted by sendMessage.
+	maxTelegramMessage = 4096
+	// maxTelegramField bounds each field value, before escaping.
+	maxTelegramField = 512
+)
+
+// telegramEscaper escapes the characters reserved by MarkdownV2.
+var telegramEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// telegramCodeEscaper escapes the characters reserved inside a MarkdownV2
+// code block.
+var telegramCodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+
+// TelegramNotifier sends messages to a chat through a Telegram bot.
+type TelegramNotifier struct {
+	ChatID string
+	token  string
+	apiURL string
+	client *http.Client
+}
+
+type TelegramPayload struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// telegramResponse is the envelope of every Bot API response.
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+}
+
+// NewTelegramNotifier creates a notifier posting as the bot identified by
+// botToken to chatID, a chat ID such as "-1001234567890" or a public
+// "@channelname".
+func NewTelegramNotifier(botToken, chatID string, client *http.Client) *TelegramNotifier {
+	return &TelegramNotifier{
+		ChatID: chatID,
+		token:  botToken,
+		apiURL: telegramAPI,
+		client: client,
+	}
+}
+
+func (t *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+func (t *TelegramNotifier) Notify(event OOMEvent) error {
+	return t.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (t *TelegramNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	title, _ := eventTitle(event)
+
+	lines := []string{"*" + telegramEscaper.Replace(title) + "*", ""}
+	for _, field := range eventFields(event) {
+		value := truncate(field.Value, maxTelegramField)
+		lines = append(lines, "*"+telegramEscaper.Replace(field.Title)+":* "+telegramEscaper.Replace(value))
+	}
+	text := strings.Join(lines, "\n")
+
+	text = telegramCodeBlock(text, "Kernel OOM Report", event.Report)
+	text = telegramCodeBlock(text, "Kernel Log Context", event.Context)
+
+	return t.post(ctx, TelegramPayload{
+		ChatID:    t.ChatID,
+		Text:      text,
+		ParseMode: "MarkdownV2",
+	})
+}
+
+func (t *TelegramNotifier) NotifyText(text string) error {
+	return t.NotifyTextContext(context.Background(), text)
+}
+
+// NotifyTextContext is NotifyText with the request cancelled once ctx is
+// done.
+func (t *TelegramNotifier) NotifyTextContext(ctx context.Context, text string) error {
+	return t.post(ctx, TelegramPayload{
+		ChatID: t.ChatID,
+		Text:   truncate(text, maxTelegramMessage),
+	})
+}
+
+func (t *TelegramNotifier) post(ctx context.Context, payload TelegramPayload) error {
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telegram payload: %v", err)
+	}
+
+	req, err := newJSONRequest(ctx, t.apiURL+"/bot"+t.token+"/sendMessage", jsonPayload)
+	if err != nil {
+		return err
+	}
+
+	resp, body, err := doRequest(t.client, req)
+	if err != nil {
+		// The request URL carries the bot token, keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to send telegram notification: %v", err)
+	}
+
+	// Errors come back as {"ok": false, ...}, with a 200 status for some of
+	// them
+	var result telegramResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("telegram API returned non-200 status: %d", resp.StatusCode)
+		}
+		return fmt.Errorf("failed to parse telegram API response: %v", err)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram API returned error %d: %s", result.ErrorCode, result.Description)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("telegram API returned non-200 status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// telegramCodeBlock appends as much of body as fits in a message to text, as
+// a code block under title. Text is returned as is when body is empty or
+// less than 64 bytes of it fit.
+func telegramCodeBlock(text, title, body string) string {
+	if body == "" {
+		return text
+	}
+	// Escaping can only lengthen the body
+	header := "\n\n*" + telegramEscaper.Replace(title) + "*\n```\n"
+	const footer = "\n```"
+	room := maxTelegramMessage - len(text) - len(header) - len(footer)
+	if room < 64 {
+		return text
+	}
+	limit := room
+	quoted := telegramCodeEscaper.Replace(truncate(body, limit))
+	for len(quoted) > room {
+		limit -= len(quoted) - room
+		quoted = telegramCodeEscaper.Replace(truncate(body, limit))
+	}
+	return text + header + quoted + footer
+}
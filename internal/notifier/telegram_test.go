@@ -0,0 +1,126 @@
+package notifier
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBotToken = "123456:ABC-secret"
+
+// newTestTelegram returns a notifier for chat -100123 sending to a Bot API
+// server answering with status and body, and records the requests it gets.
+func newTestTelegram(t *testing.T, status int, body string) (*TelegramNotifier, *[]*http.Request, *[]TelegramPayload) {
+	t.Helper()
+	var requests []*http.Request
+	var payloads []TelegramPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload TelegramPayload
+		data, _ := io.ReadAll(r.Body)
+		json.Unmarshal(data, &payload)
+		requests = append(requests, r)
+		payloads = append(payloads, payload)
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	telegram := NewTelegramNotifier(testBotToken, "-100123", NewHTTPClient(5*time.Second, nil))
+	telegram.apiURL = server.URL
+	return telegram, &requests, &payloads
+}
+
+func TestTelegramSendsMarkdownMessage(t *testing.T) {
+	telegram, requests, payloads := newTestTelegram(t, http.StatusOK, `{"ok": true, "result": {}}`)
+
+	if err := telegram.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(*requests))
+	}
+	if got, want := (*requests)[0].URL.Path, "/bot"+testBotToken+"/sendMessage"; got != want {
+		t.Errorf("request to %s, want %s", got, want)
+	}
+	payload := (*payloads)[0]
+	if payload.ChatID != "-100123" || payload.ParseMode != "MarkdownV2" {
+		t.Errorf("sent to chat %q in %q, want -100123 in MarkdownV2", payload.ChatID, payload.ParseMode)
+	}
+	for _, want := range []string{"*Process ID:* 4242", `*Process Command:* stress \-\-vm 1`, `*Hostname:* node\-1`} {
+		if !strings.Contains(payload.Text, want) {
+			t.Errorf("message %q lacks %q", payload.Text, want)
+		}
+	}
+}
+
+func TestTelegramEscapesMarkdown(t *testing.T) {
+	telegram, _, payloads := newTestTelegram(t, http.StatusOK, `{"ok": true}`)
+	event := testEvent()
+	event.Cmdline = "python3 job_runner.py [a]"
+	event.Report = "stress invoked oom-killer: ```"
+
+	if err := telegram.Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	text := (*payloads)[0].Text
+	if !strings.Contains(text, `python3 job\_runner\.py \[a\]`) {
+		t.Errorf("command line not escaped in %q", text)
+	}
+	if !strings.Contains(text, "```\nstress invoked oom-killer: \\`\\`\\`\n```") {
+		t.Errorf("kernel report not quoted in a code block in %q", text)
+	}
+}
+
+func TestTelegramReportsAPIErrors(t *testing.T) {
+	for name, tt := range map[string]struct {
+		status int
+		body   string
+		want   string
+	}{
+		"ok false with 200":  {http.StatusOK, `{"ok": false, "error_code": 400, "description": "Bad Request: chat not found"}`, "chat not found"},
+		"ok false with 403":  {http.StatusForbidden, `{"ok": false, "error_code": 403, "description": "Forbidden: bot was kicked"}`, "bot was kicked"},
+		"invalid 200 body":   {http.StatusOK, `<html>`, "failed to parse"},
+		"invalid error body": {http.StatusBadGateway, `<html>`, "502"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			telegram, _, _ := newTestTelegram(t, tt.status, tt.body)
+			err := telegram.Notify(testEvent())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Notify = %v, want an error mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramKeepsTokenOutOfErrors(t *testing.T) {
+	telegram := NewTelegramNotifier(testBotToken, "-100123", NewHTTPClient(time.Second, nil))
+	telegram.apiURL = "http://127.0.0.1:1"
+
+	err := telegram.Notify(testEvent())
+	if err == nil {
+		t.Fatal("Notify succeeded without a server")
+	}
+	if strings.Contains(err.Error(), "secret") {
+		t.Errorf("error %q reveals the bot token", err)
+	}
+}
+
+func TestTelegramQuotesContext(t *testing.T) {
+	telegram, _, payloads := newTestTelegram(t, http.StatusOK, `{"ok": true}`)
+	event := testEvent()
+	event.Report = "Mem-Info:"
+	event.Context = "Free swap  = 0kB\nOut of memory: Killed process 4242 (stress)"
+	if err := telegram.Notify(event); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	text := (*payloads)[0].Text
+	report := strings.Index(text, "*Kernel OOM Report*\n```\nMem-Info:\n```")
+	context := strings.Index(text, "*Kernel Log Context*\n```\n"+event.Context+"\n```")
+	if report < 0 || context < report {
+		t.Errorf("message %q, want the report then the context in code blocks", text)
+	}
+}
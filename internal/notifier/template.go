@@ -0,0 +1,82 @@
+package notifier
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+)
+
+// DefaultMessageTemplate renders the built-in message text of an event.
+const DefaultMessageTemplate = `{{if .Test}}oom-notifier Test Alert{{else if eq .Kind "" "oom" "cgroup_oom"}}OOM Killer Alert{{else if eq .Kind "memory_pressure"}}Memory Pressure Warning{{else}}Kernel Event Alert{{end}}`
+
+var defaultMessageTemplate = template.Must(ParseMessageTemplate(DefaultMessageTemplate))
+
+// ParseMessageTemplate parses a text/template rendering the message text of
+// an OOMEvent. The template is also executed against an empty event so that
+// references to unknown fields are reported now rather than on the first
+// alert.
+func ParseMessageTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("message").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %v", err)
+	}
+	if _, err := renderMessage(tmpl, OOMEvent{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// linkFuncs are available to link templates. Time is in milliseconds, as
+// expected by Grafana and Kibana, so that a range around the event can be
+// written as from={{addMinutes .Time -5}}&to={{addMinutes .Time 5}}.
+var linkFuncs = template.FuncMap{
+	"addMinutes": func(ms int64, minutes int) int64 {
+		return ms + int64(minutes)*time.Minute.Milliseconds()
+	},
+}
+
+// ParseLinkTemplate parses a text/template rendering the URL of a page about
+// an OOMEvent, such as logs filtered by hostname and time, which notifiers
+// show as a link. It is checked against an empty event like
+// ParseMessageTemplate.
+func ParseLinkTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("link").Funcs(linkFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link template: %v", err)
+	}
+	if _, err := renderMessage(tmpl, OOMEvent{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderMessage executes tmpl for event.
+func renderMessage(tmpl *template.Template, event OOMEvent) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, event); err != nil {
+		return "", fmt.Errorf("invalid %s template: %v", tmpl.Name(), err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// renderLink executes the link template tmpl for event. The link is left
+// out, returning "", when tmpl is nil or does not render an http(s) URL.
+func renderLink(tmpl *template.Template, event OOMEvent) string {
+	if tmpl == nil {
+		return ""
+	}
+	link, err := renderMessage(tmpl, event)
+	if err != nil {
+		logger.Warn("Leaving out the notification link: %v", err)
+		return ""
+	}
+	if u, err := url.Parse(link); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		logger.Warn("Leaving out the notification link, %q is not an http(s) URL", link)
+		return ""
+	}
+	return link
+}
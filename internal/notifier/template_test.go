@@ -0,0 +1,151 @@
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMessageTemplateRendersEvent(t *testing.T) {
+	tmpl, err := ParseMessageTemplate(`{{.Cmdline}} (PID {{.PID}}) killed on {{.Hostname}}`)
+	if err != nil {
+		t.Fatalf("ParseMessageTemplate: %v", err)
+	}
+	got, err := renderMessage(tmpl, testEvent())
+	if err != nil {
+		t.Fatalf("renderMessage: %v", err)
+	}
+	if want := "stress --vm 1 (PID 4242) killed on node-1"; got != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+}
+
+func TestDefaultMessageTemplate(t *testing.T) {
+	pressure := testEvent()
+	pressure.Kind = "memory_pressure"
+	test := testEvent()
+	test.Test = true
+
+	for want, event := range map[string]OOMEvent{
+		"OOM Killer Alert":        testEvent(),
+		"Memory Pressure Warning": pressure,
+		"oom-notifier Test Alert": test,
+	} {
+		if got, _ := renderMessage(defaultMessageTemplate, event); got != want {
+			t.Errorf("default template rendered %q for %s event, want %q", got, event.Kind, want)
+		}
+	}
+}
+
+func TestParseMessageTemplateRejectsBadTemplates(t *testing.T) {
+	for _, text := range []string{
+		"{{.Cmdline",
+		"{{.NoSuchField}}",
+		"{{template \"missing\"}}",
+	} {
+		if _, err := ParseMessageTemplate(text); err == nil || !strings.Contains(err.Error(), "template") {
+			t.Errorf("ParseMessageTemplate(%q) = %v, want an invalid template error", text, err)
+		}
+	}
+}
+
+func TestSlackUsesMessageTemplate(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+	tmpl, err := ParseMessageTemplate(`{{.Cmdline}} killed on {{.Hostname}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Template = tmpl
+
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	if payload.Text != "stress --vm 1 killed on node-1" {
+		t.Errorf("text = %q, want the rendered template", payload.Text)
+	}
+	if len(payload.Attachments) == 0 || len(payload.Attachments[0].Fields) == 0 {
+		t.Error("the event fields are missing with a message template")
+	}
+}
+
+// grafanaLink is a link template to logs around the event.
+const grafanaLink = `https://grafana.example.com/explore?host={{.Hostname}}&from={{addMinutes .Time -5}}&to={{addMinutes .Time 5}}`
+
+func TestRenderLink(t *testing.T) {
+	tmpl, err := ParseLinkTemplate(grafanaLink)
+	if err != nil {
+		t.Fatalf("ParseLinkTemplate: %v", err)
+	}
+	event := testEvent()
+	want := fmt.Sprintf("https://grafana.example.com/explore?host=node-1&from=%d&to=%d", event.Time-300000, event.Time+300000)
+	if got := renderLink(tmpl, event); got != want {
+		t.Errorf("renderLink = %q, want %q", got, want)
+	}
+
+	if got := renderLink(nil, event); got != "" {
+		t.Errorf("renderLink without a template = %q, want none", got)
+	}
+	notURL, _ := ParseLinkTemplate(`{{.Hostname}}`)
+	if got := renderLink(notURL, event); got != "" {
+		t.Errorf("renderLink of a bare hostname = %q, want the link left out", got)
+	}
+	if _, err := ParseLinkTemplate(`{{addHours .Time 1}}`); err == nil {
+		t.Error("link template calling an unknown function accepted")
+	}
+}
+
+func TestSlackAndTeamsShowLink(t *testing.T) {
+	tmpl, err := ParseLinkTemplate(`https://logs.example.com/?host={{.Hostname}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := newTestWebhook(t, http.StatusOK)
+	s := newTestSlack(SlackModeAll, webhook)
+	s.Link = tmpl
+	if err := s.Notify(testEvent()); err != nil {
+		t.Fatalf("Slack Notify: %v", err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	fields := payload.Attachments[0].Fields
+	if last := fields[len(fields)-1]; last.Title != "Logs" || last.Value != "<https://logs.example.com/?host=node-1|Open logs>" {
+		t.Errorf("last Slack field %+v, want the link", last)
+	}
+
+	teams, cards := newTestTeams(t, "1")
+	teams.Link = tmpl
+	if err := teams.Notify(testEvent()); err != nil {
+		t.Fatalf("Teams Notify: %v", err)
+	}
+	actions := (*cards)[0].PotentialAction
+	if len(actions) != 1 || actions[0].Type != "OpenUri" || actions[0].Targets[0].URI != "https://logs.example.com/?host=node-1" {
+		t.Errorf("Teams actions %+v, want a button opening the link", actions)
+	}
+}
+
+func TestNoLinkWithoutTemplate(t *testing.T) {
+	webhook := newTestWebhook(t, http.StatusOK)
+	if err := newTestSlack(SlackModeAll, webhook).Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	var payload SlackPayload
+	webhook.last(t, &payload)
+	for _, field := range payload.Attachments[0].Fields {
+		if field.Title == "Logs" {
+			t.Errorf("Slack field %+v without --link-template", field)
+		}
+	}
+
+	teams, cards := newTestTeams(t, "1")
+	if err := teams.Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if actions := (*cards)[0].PotentialAction; len(actions) != 0 {
+		t.Errorf("Teams actions %+v without --link-template", actions)
+	}
+}
@@ -0,0 +1,121 @@
+package notifier
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writePEM writes blocks of type to a file in dir and returns its path.
+func writePEM(t *testing.T, dir, name, typ string, blocks ...[]byte) string {
+	t.Helper()
+	var data []byte
+	for _, block := range blocks {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: block})...)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTLSServer starts an HTTPS server requiring client certificates as set
+// by clientAuth. Failed handshakes are expected and not logged.
+func newTLSServer(t *testing.T, handler http.HandlerFunc, clientAuth tls.ClientAuthType) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.TLS = &tls.Config{ClientAuth: clientAuth}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// postTLS posts an event to server through a webhook notifier using opts.
+func postTLS(t *testing.T, server *httptest.Server, opts TLSOptions) error {
+	t.Helper()
+	config, err := NewTLSConfig(opts)
+	if err != nil {
+		t.Fatalf("NewTLSConfig: %v", err)
+	}
+	return NewWebhookNotifier(server.URL, "", NewHTTPClient(5*time.Second, config)).Notify(testEvent())
+}
+
+func TestTLSCAFile(t *testing.T) {
+	server := newTLSServer(t, func(w http.ResponseWriter, r *http.Request) {}, tls.NoClientCert)
+	caFile := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	if err := postTLS(t, server, TLSOptions{}); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Notify = %v without the CA, want a certificate error", err)
+	}
+	if err := postTLS(t, server, TLSOptions{CAFile: caFile}); err != nil {
+		t.Errorf("Notify with --ca-file: %v", err)
+	}
+	if err := postTLS(t, server, TLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("Notify with --insecure-skip-verify: %v", err)
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	var presented []string
+	server := newTLSServer(t, func(w http.ResponseWriter, r *http.Request) {
+		for _, cert := range r.TLS.PeerCertificates {
+			presented = append(presented, cert.Subject.String())
+		}
+	}, tls.RequireAnyClientCert)
+
+	// The server certificate doubles as the client certificate
+	dir := t.TempDir()
+	serverCert := server.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(serverCert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := TLSOptions{
+		CAFile:   writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw),
+		CertFile: writePEM(t, dir, "client.pem", "CERTIFICATE", serverCert.Certificate...),
+		KeyFile:  writePEM(t, dir, "client.key", "PRIVATE KEY", key),
+	}
+
+	if err := postTLS(t, server, TLSOptions{CAFile: opts.CAFile}); err == nil {
+		t.Error("Notify succeeded without the client certificate the server requires")
+	}
+	if err := postTLS(t, server, opts); err != nil {
+		t.Fatalf("Notify with a client certificate: %v", err)
+	}
+	if len(presented) == 0 {
+		t.Error("server received no client certificate")
+	}
+}
+
+func TestNewTLSConfigRejectsBadOptions(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if config, err := NewTLSConfig(TLSOptions{}); config != nil || err != nil {
+		t.Errorf("NewTLSConfig of no options = %v, %v, want Go's defaults", config, err)
+	}
+	for name, opts := range map[string]TLSOptions{
+		"certificate without key": {CertFile: filepath.Join(dir, "client.pem")},
+		"missing CA file":         {CAFile: filepath.Join(dir, "missing.pem")},
+		"CA file without PEM":     {CAFile: notPEM},
+		"unreadable key pair":     {CertFile: notPEM, KeyFile: notPEM},
+	} {
+		if _, err := NewTLSConfig(opts); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// WebhookNotifier POSTs events as plain JSON to an arbitrary endpoint. When a
+// secret is set every request carries an X-Signature header with the hex
+// HMAC-SHA256 of the body so the receiver can authenticate it.
+type WebhookNotifier struct {
+	URL string
+	// Gzip compresses request bodies, the signature is still that of the
+	// uncompressed JSON.
+	Gzip bool
+	// Batch makes NotifyBatch POST the events as one JSON array instead of
+	// one request per event.
+	Batch bool
+	// Encoding is the JSON representation of the events posted.
+	Encoding EventEncoding
+
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string, secret string, client *http.Client) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		secret: []byte(secret),
+		client: client,
+	}
+}
+
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookNotifier) Notify(event OOMEvent) error {
+	return w.NotifyContext(context.Background(), event)
+}
+
+// NotifyContext is Notify with the request cancelled once ctx is done.
+func (w *WebhookNotifier) NotifyContext(ctx context.Context, event OOMEvent) error {
+	jsonPayload, err := w.Encoding.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+	return w.post(ctx, jsonPayload)
+}
+
+// NotifyBatch delivers events in one request holding a JSON array of the
+// events when Batch is set, and one request per event otherwise.
+func (w *WebhookNotifier) NotifyBatch(ctx context.Context, events []OOMEvent) error {
+	if !w.Batch {
+		var errs []error
+		for _, event := range events {
+			errs = append(errs, w.NotifyContext(ctx, event))
+		}
+		return errors.Join(errs...)
+	}
+
+	encoded := make([]json.RawMessage, 0, len(events))
+	for _, event := range events {
+		jsonEvent, err := w.Encoding.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal webhook payload: %v", err)
+		}
+		encoded = append(encoded, jsonEvent)
+	}
+	jsonPayload, err := json.Marshal(encoded)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %v", err)
+	}
+	return w.post(ctx, jsonPayload)
+}
+
+func (w *WebhookNotifier) post(ctx context.Context, jsonPayload []byte) error {
+	req, err := newPushRequest(ctx, w.URL, jsonPayload, w.Gzip)
+	if err != nil {
+		return err
+	}
+	if len(w.secret) > 0 {
+		req.Header.Set("X-Signature", signPayload(w.secret, jsonPayload))
+	}
+
+	resp, _, err := doRequest(w.client, req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook notification: %v", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned non-2xx status: %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 of body.
+func signPayload(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is the X-Signature of body
+// signed with secret, as sent by WebhookNotifier.
+func VerifySignature(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signPayload(secret, body)), []byte(signature))
+}
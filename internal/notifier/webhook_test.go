@@ -0,0 +1,165 @@
+package notifier
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignPayloadKnownVector(t *testing.T) {
+	// The HMAC-SHA256 example of Wikipedia, also given by openssl dgst -hmac
+	got := signPayload([]byte("key"), []byte("The quick brown fox jumps over the lazy dog"))
+	if want := "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"; got != want {
+		t.Errorf("signPayload = %s, want %s", got, want)
+	}
+}
+
+// signedRequest is a request received by a test webhook.
+type signedRequest struct {
+	body      []byte
+	signature string
+	signed    bool
+	encoding  string
+}
+
+func newSigningWebhook(t *testing.T, status int) (string, *[]signedRequest) {
+	t.Helper()
+	var requests []signedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, signed := r.Header["X-Signature"]
+		requests = append(requests, signedRequest{body, r.Header.Get("X-Signature"), signed, r.Header.Get("Content-Encoding")})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &requests
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	url, requests := newSigningWebhook(t, http.StatusOK)
+	if err := NewWebhookNotifier(url, "", NewHTTPClient(5*time.Second, nil)).Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(*requests))
+	}
+	if (*requests)[0].signed {
+		t.Error("request without a secret signed")
+	}
+	doc := decodeJSON(t, (*requests)[0].body)
+	if doc["pid"] != "4242" || doc["hostname"] != "node-1" {
+		t.Errorf("body %s, want the event", (*requests)[0].body)
+	}
+}
+
+func TestWebhookSigned(t *testing.T) {
+	url, requests := newSigningWebhook(t, http.StatusOK)
+	secret := "s3cret"
+	if err := NewWebhookNotifier(url, secret, NewHTTPClient(5*time.Second, nil)).Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	request := (*requests)[0]
+	if want := signPayload([]byte(secret), request.body); request.signature != want {
+		t.Errorf("X-Signature = %q, want %q", request.signature, want)
+	}
+	if !VerifySignature([]byte(secret), request.body, request.signature) {
+		t.Error("VerifySignature rejected the signature sent")
+	}
+	if VerifySignature([]byte("other"), request.body, request.signature) {
+		t.Error("VerifySignature accepted a signature made with another secret")
+	}
+}
+
+func TestWebhookAcceptsAny2xx(t *testing.T) {
+	for status, ok := range map[int]bool{
+		http.StatusOK:                  true,
+		http.StatusAccepted:            true,
+		http.StatusNoContent:           true,
+		http.StatusMultipleChoices:     false,
+		http.StatusInternalServerError: false,
+	} {
+		url, _ := newSigningWebhook(t, status)
+		err := NewWebhookNotifier(url, "", NewHTTPClient(5*time.Second, nil)).Notify(testEvent())
+		if (err == nil) != ok {
+			t.Errorf("status %d: Notify = %v, want success %v", status, err, ok)
+		}
+	}
+}
+
+// gunzip decompresses a request body sent with Content-Encoding: gzip.
+func gunzip(t *testing.T, body []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("invalid gzip body: %v", err)
+	}
+	return data
+}
+
+func TestWebhookGzip(t *testing.T) {
+	url, requests := newSigningWebhook(t, http.StatusOK)
+	w := NewWebhookNotifier(url, "s3cret", NewHTTPClient(5*time.Second, nil))
+	w.Gzip = true
+	if err := w.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	request := (*requests)[0]
+	if request.encoding != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", request.encoding)
+	}
+	body := gunzip(t, request.body)
+	if doc := decodeJSON(t, body); doc["pid"] != "4242" || doc["hostname"] != "node-1" {
+		t.Errorf("decompressed body %s, want the event", body)
+	}
+	if !VerifySignature([]byte("s3cret"), body, request.signature) {
+		t.Error("signature does not cover the uncompressed body")
+	}
+
+	url, requests = newSigningWebhook(t, http.StatusOK)
+	if err := NewWebhookNotifier(url, "", NewHTTPClient(5*time.Second, nil)).Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+	if encoding := (*requests)[0].encoding; encoding != "" {
+		t.Errorf("Content-Encoding = %q without Gzip", encoding)
+	}
+}
+
+func TestWebhookBatchPostsArray(t *testing.T) {
+	events := killBurst("node-1", "java", "postgres", "java")
+
+	url, requests := newSigningWebhook(t, http.StatusOK)
+	w := NewWebhookNotifier(url, "", NewHTTPClient(5*time.Second, nil))
+	w.Batch = true
+	if err := w.NotifyBatch(context.Background(), events); err != nil {
+		t.Fatalf("NotifyBatch: %v", err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("%d requests, want one for the batch", len(*requests))
+	}
+	var batch []OOMEvent
+	if err := json.Unmarshal((*requests)[0].body, &batch); err != nil {
+		t.Fatalf("body %s is not a JSON array of events: %v", (*requests)[0].body, err)
+	}
+	if len(batch) != 3 || batch[0].Cmdline != "java" || batch[1].Cmdline != "postgres" || batch[2].PID != events[2].PID {
+		t.Errorf("batch %+v, want the events in order", batch)
+	}
+
+	url, requests = newSigningWebhook(t, http.StatusOK)
+	if err := NewWebhookNotifier(url, "", NewHTTPClient(5*time.Second, nil)).NotifyBatch(context.Background(), events); err != nil {
+		t.Fatalf("NotifyBatch: %v", err)
+	}
+	if len(*requests) != 3 {
+		t.Errorf("%d requests without Batch, want one per event", len(*requests))
+	}
+}
@@ -0,0 +1,231 @@
+package spool
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oom-notifier/go/internal/logger"
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+const (
+	// retryDelay is the wait before retrying queued events, doubled after
+	// every pass with failures up to maxRetryDelay.
+	retryDelay    = 10 * time.Second
+	maxRetryDelay = 5 * time.Minute
+	// maxQueued bounds the events kept on disk; further failures are
+	// dropped.
+	maxQueued = 10000
+)
+
+// Queue persists events that notifiers failed to deliver, one JSON file per
+// event in a directory, and retries them with backoff until they are
+// delivered or expire. Files are named after the time they were queued so
+// that events are retried oldest first, including after a restart, and an
+// event is never delivered to a notifier before the older events still
+// queued for it. A Queue is not safe for concurrent use.
+type Queue struct {
+	dir     string
+	maxAge  time.Duration
+	entries []*entry
+	seq     int
+	delay   time.Duration
+	next    time.Time
+	now     func() time.Time
+}
+
+// entry is a queued event, or plain text message when Text is set, and the
+// notifiers still to deliver it.
+type entry struct {
+	Event     notifier.OOMEvent `json:"event"`
+	Text      string            `json:"text,omitempty"`
+	Notifiers []string          `json:"notifiers"`
+	Queued    time.Time         `json:"queued"`
+	Attempts  int               `json:"attempts"`
+
+	file string
+}
+
+// Open opens the queue in dir, creating it if needed, and loads the events
+// left by a previous run. Events are dropped once queued for maxAge.
+func Open(dir string, maxAge time.Duration) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create retry queue: %v", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retry queue: %v", err)
+	}
+
+	q := &Queue{
+		dir:    dir,
+		maxAge: maxAge,
+		delay:  retryDelay,
+		now:    time.Now,
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read retry queue: %v", err)
+		}
+		e := &entry{file: path}
+		if err := json.Unmarshal(data, e); err != nil {
+			logger.Warn("Removing unreadable retry queue file %s: %v", path, err)
+			os.Remove(path)
+			continue
+		}
+		q.entries = append(q.entries, e)
+	}
+	sort.Slice(q.entries, func(i, j int) bool {
+		return q.entries[i].file < q.entries[j].file
+	})
+	return q, nil
+}
+
+// Len returns the number of queued events.
+func (q *Queue) Len() int {
+	return len(q.entries)
+}
+
+// Add queues event for the notifiers named in names.
+func (q *Queue) Add(event notifier.OOMEvent, names []string) error {
+	return q.add(&entry{Event: event, Notifiers: names})
+}
+
+// AddText queues a plain text message, such as a periodic report, for the
+// notifiers named in names.
+func (q *Queue) AddText(text string, names []string) error {
+	return q.add(&entry{Text: text, Notifiers: names})
+}
+
+func (q *Queue) add(e *entry) error {
+	if len(q.entries) >= maxQueued {
+		return fmt.Errorf("retry queue is full with %d events", len(q.entries))
+	}
+
+	now := q.now()
+	q.seq++
+	e.Queued = now
+	e.file = filepath.Join(q.dir, fmt.Sprintf("%020d-%06d.json", now.UnixNano(), q.seq%1000000))
+	if err := q.write(e); err != nil {
+		return err
+	}
+	if len(q.entries) == 0 {
+		q.next = now.Add(q.delay)
+	}
+	q.entries = append(q.entries, e)
+	return nil
+}
+
+// Retry makes a pass over the queue once the backoff has elapsed, oldest
+// event first. send delivers an event and sendText a text message to the
+// named notifiers, and both return the names of those that failed again. A
+// notifier failing during a pass is not tried with the newer events until
+// the next one. Expired events are dropped with an error logged.
+func (q *Queue) Retry(send func(event notifier.OOMEvent, names []string) []string, sendText func(text string, names []string) []string) {
+	now := q.now()
+	if len(q.entries) == 0 || now.Before(q.next) {
+		return
+	}
+
+	failing := make(map[string]bool)
+	kept := q.entries[:0]
+	for _, e := range q.entries {
+		if now.Sub(e.Queued) >= q.maxAge {
+			what := fmt.Sprintf("%s event for %s", e.Event.Kind, e.Event.Cmdline)
+			if e.Text != "" {
+				what = "text message"
+			}
+			logger.Error("Dropping %s queued since %s, it was not delivered to %s",
+				what, e.Queued.Format(time.RFC3339), strings.Join(e.Notifiers, ", "))
+			q.remove(e)
+			continue
+		}
+
+		var names, held []string
+		for _, name := range e.Notifiers {
+			if failing[name] {
+				held = append(held, name)
+			} else {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			kept = append(kept, e)
+			continue
+		}
+
+		var failed []string
+		if e.Text != "" {
+			failed = sendText(e.Text, names)
+		} else {
+			failed = send(e.Event, names)
+		}
+		for _, name := range failed {
+			failing[name] = true
+		}
+		if len(failed) == 0 && len(held) == 0 {
+			q.remove(e)
+			continue
+		}
+		e.Notifiers = append(held, failed...)
+		e.Attempts++
+		if err := q.write(e); err != nil {
+			logger.Warn("%v", err)
+		}
+		kept = append(kept, e)
+	}
+	q.entries = kept
+
+	if len(failing) > 0 {
+		if q.delay *= 2; q.delay > maxRetryDelay {
+			q.delay = maxRetryDelay
+		}
+	} else {
+		q.delay = retryDelay
+	}
+	q.next = now.Add(q.delay)
+}
+
+// write replaces the file of e atomically, so that a crash never leaves a
+// truncated event behind.
+func (q *Queue) write(e *entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode queued event: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(q.dir, filepath.Base(e.file)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write retry queue file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write retry queue file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write retry queue file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), e.file); err != nil {
+		return fmt.Errorf("failed to write retry queue file: %v", err)
+	}
+	return nil
+}
+
+// remove deletes the file of e.
+func (q *Queue) remove(e *entry) {
+	if err := os.Remove(e.file); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to remove retry queue file: %v", err)
+	}
+}
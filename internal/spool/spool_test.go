@@ -0,0 +1,133 @@
+package spool
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oom-notifier/go/internal/notifier"
+)
+
+// testQueue opens a queue in dir whose clock is at *now.
+func testQueue(t *testing.T, dir string, maxAge time.Duration, now *time.Time) *Queue {
+	t.Helper()
+	q, err := Open(dir, maxAge)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	q.now = func() time.Time { return *now }
+	return q
+}
+
+func kill(cmdline string) notifier.OOMEvent {
+	return notifier.OOMEvent{Kind: "oom", PID: "4242", Cmdline: cmdline, Hostname: "node-1"}
+}
+
+// retried records what a pass delivered, failing the notifiers in failing.
+type retried struct {
+	failing map[string]bool
+	sent    []string
+}
+
+func (r *retried) send(event notifier.OOMEvent, names []string) []string {
+	return r.deliver(event.Cmdline, names)
+}
+
+func (r *retried) sendText(text string, names []string) []string {
+	return r.deliver(text, names)
+}
+
+func (r *retried) deliver(what string, names []string) []string {
+	var failed []string
+	for _, name := range names {
+		if r.failing[name] {
+			failed = append(failed, name)
+			continue
+		}
+		r.sent = append(r.sent, name+":"+what)
+	}
+	return failed
+}
+
+func TestQueueDrainsOldestFirstAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Unix(1700000000, 0)
+	q := testQueue(t, dir, time.Hour, &now)
+	for _, cmdline := range []string{"first", "second"} {
+		if err := q.Add(kill(cmdline), []string{"slack"}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		now = now.Add(time.Millisecond)
+	}
+	if err := q.AddText("report", []string{"slack"}); err != nil {
+		t.Fatalf("AddText: %v", err)
+	}
+
+	// Nothing is retried before the backoff elapsed
+	r := &retried{}
+	q.Retry(r.send, r.sendText)
+	if len(r.sent) != 0 {
+		t.Fatalf("retried %v before the backoff", r.sent)
+	}
+
+	restarted := testQueue(t, dir, time.Hour, &now)
+	if restarted.Len() != 3 {
+		t.Fatalf("%d events after a restart, want 3", restarted.Len())
+	}
+	restarted.Retry(r.send, r.sendText)
+	if want := []string{"slack:first", "slack:second", "slack:report"}; !reflect.DeepEqual(r.sent, want) {
+		t.Errorf("retried %v, want %v", r.sent, want)
+	}
+	if restarted.Len() != 0 {
+		t.Errorf("%d events left once delivered", restarted.Len())
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files left once delivered", len(files))
+	}
+}
+
+func TestQueueKeepsFailedNotifiersInOrder(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	q := testQueue(t, t.TempDir(), time.Hour, &now)
+	q.Add(kill("first"), []string{"slack", "webhook"})
+	q.Add(kill("second"), []string{"slack", "webhook"})
+
+	now = now.Add(retryDelay)
+	r := &retried{failing: map[string]bool{"slack": true}}
+	q.Retry(r.send, r.sendText)
+	// slack failed the first event and holds back the second
+	if want := []string{"webhook:first", "webhook:second"}; !reflect.DeepEqual(r.sent, want) {
+		t.Fatalf("retried %v, want %v", r.sent, want)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("%d events left, want both for slack", q.Len())
+	}
+
+	// The backoff doubled after the failure
+	now = now.Add(retryDelay)
+	r = &retried{}
+	q.Retry(r.send, r.sendText)
+	if len(r.sent) != 0 {
+		t.Fatalf("retried %v before the doubled backoff", r.sent)
+	}
+	now = now.Add(retryDelay)
+	q.Retry(r.send, r.sendText)
+	if want := []string{"slack:first", "slack:second"}; !reflect.DeepEqual(r.sent, want) {
+		t.Errorf("retried %v, want %v", r.sent, want)
+	}
+}
+
+func TestQueueDropsExpiredEvents(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	q := testQueue(t, t.TempDir(), time.Minute, &now)
+	q.Add(kill("old"), []string{"slack"})
+	q.AddText("old report", []string{"slack"})
+
+	now = now.Add(time.Minute)
+	r := &retried{}
+	q.Retry(r.send, r.sendText)
+	if len(r.sent) != 0 || q.Len() != 0 {
+		t.Errorf("expired events retried %v, %d left", r.sent, q.Len())
+	}
+}